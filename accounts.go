@@ -0,0 +1,483 @@
+package keystore
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var accountNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// reservedAccountNames cannot be used for accounts since callers use them to
+// refer to the primary key or the default account.
+var reservedAccountNames = map[string]bool{
+	"default": true,
+	"primary": true,
+}
+
+const maxLabelLength = 64
+
+// Account is a named key stored alongside the primary key. Watch-only
+// accounts carry an address but no key material.
+type Account struct {
+	Address      string            `json:"address"`
+	PrivateKey   string            `json:"private_key,omitempty"`
+	EncryptedKey *EncryptedValue   `json:"encrypted_key,omitempty"`
+	WatchOnly    bool              `json:"watch_only,omitempty"`
+	CreatedAt    int64             `json:"created_at,omitempty"`
+	Provenance   *Provenance       `json:"provenance,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	ChainID      string            `json:"chain_id,omitempty"`
+	NetworkName  string            `json:"network_name,omitempty"`
+	UseCount     int64             `json:"use_count,omitempty"`
+	LastUsedAt   int64             `json:"last_used_at,omitempty"`
+	DeletedAt    int64             `json:"deleted_at,omitempty"`
+	Purpose      KeyPurpose        `json:"purpose,omitempty"`
+}
+
+// AccountInfo is the non-secret description of an account returned by ListAccounts.
+type AccountInfo struct {
+	Name        string            `json:"name"`
+	Address     common.Address    `json:"address"`
+	WatchOnly   bool              `json:"watch_only"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	ChainID     string            `json:"chain_id,omitempty"`
+	NetworkName string            `json:"network_name,omitempty"`
+	Provenance  *Provenance       `json:"provenance,omitempty"`
+	UseCount    int64             `json:"use_count,omitempty"`
+	LastUsedAt  *time.Time        `json:"last_used_at,omitempty"`
+	DeletedAt   *time.Time        `json:"deleted_at,omitempty"`
+	Purpose     KeyPurpose        `json:"purpose,omitempty"`
+}
+
+func validateAccountName(name string) error {
+	if !accountNamePattern.MatchString(name) {
+		return fmt.Errorf("%w: %q", ErrInvalidAccountName, name)
+	}
+	if reservedAccountNames[strings.ToLower(name)] {
+		return fmt.Errorf("%w: %q is reserved", ErrInvalidAccountName, name)
+	}
+	return nil
+}
+
+// SaveAccount stores privateKeyHex under name. Saving a key for an existing
+// watch-only account upgrades it in place, provided the key derives to the
+// watched address.
+func (s *Store) SaveAccount(name, privateKeyHex string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := validateAccountName(name); err != nil {
+		return err
+	}
+
+	key, err := parsePrivateKeyHex(privateKeyHex)
+	if err != nil {
+		return err
+	}
+
+	return s.updateScope(scopeKey, func() error {
+		return s.putAccount(name, key, privateKeyHex, s.newProvenance(ProvenanceHex, ""))
+	})
+}
+
+// SaveAccountForChain stores privateKeyHex under name, recording the chain it
+// is intended for.
+func (s *Store) SaveAccountForChain(name, privateKeyHex string, chainID *big.Int, networkName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if chainID == nil || chainID.Sign() <= 0 {
+		return fmt.Errorf("%w %v", ErrInvalidChainID, chainID)
+	}
+
+	if err := validateAccountName(name); err != nil {
+		return err
+	}
+
+	key, err := parsePrivateKeyHex(privateKeyHex)
+	if err != nil {
+		return err
+	}
+
+	return s.updateScope(scopeKey, func() error {
+		if err := s.putAccount(name, key, privateKeyHex, s.newProvenance(ProvenanceHex, "")); err != nil {
+			return err
+		}
+		s.Accounts[name].ChainID = chainID.String()
+		s.Accounts[name].NetworkName = networkName
+		return nil
+	})
+}
+
+// putAccount adds or upgrades an account in memory without saving.
+func (s *Store) putAccount(name string, key *ecdsa.PrivateKey, privateKeyHex string, p *Provenance) error {
+	if err := s.checkTestKey(key); err != nil {
+		return err
+	}
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+
+	account, exists := s.Accounts[name]
+	switch {
+	case !exists:
+		account = &Account{Address: addr.Hex(), CreatedAt: s.now().Unix()}
+	case !account.WatchOnly:
+		return fmt.Errorf("%w: %q", ErrAccountExists, name)
+	case common.HexToAddress(account.Address) != addr:
+		return fmt.Errorf("%w: key derives to %s, account %q watches %s", ErrAddressMismatch, addr.Hex(), name, account.Address)
+	}
+
+	plain, ev, err := s.sealKey(privateKeyHex)
+	if err != nil {
+		return err
+	}
+
+	account.PrivateKey = plain
+	account.EncryptedKey = ev
+	account.WatchOnly = false
+	account.Provenance = p
+
+	if s.Accounts == nil {
+		s.Accounts = make(map[string]*Account)
+	}
+	s.Accounts[name] = account
+	return nil
+}
+
+// accountByAddress returns the account holding addr, preferring one with a
+// key over a watch-only one.
+func (s *Store) accountByAddress(addr common.Address) (string, *Account, bool) {
+	var watchName string
+	var watched *Account
+	for name, account := range s.Accounts {
+		if common.HexToAddress(account.Address) != addr {
+			continue
+		}
+		if !account.WatchOnly {
+			return name, account, true
+		}
+		if watched == nil || name < watchName {
+			watchName, watched = name, account
+		}
+	}
+	return watchName, watched, watched != nil
+}
+
+// SaveWatchAddress stores a watch-only account that tracks addr without any
+// key material.
+func (s *Store) SaveWatchAddress(name string, addr common.Address) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := validateAccountName(name); err != nil {
+		return err
+	}
+
+	if addr == (common.Address{}) {
+		return fmt.Errorf("%w: zero address", ErrInvalidAddress)
+	}
+
+	return s.update(func() error {
+		if _, exists := s.Accounts[name]; exists {
+			return fmt.Errorf("%w: %q", ErrAccountExists, name)
+		}
+
+		if s.Accounts == nil {
+			s.Accounts = make(map[string]*Account)
+		}
+		s.Accounts[name] = &Account{
+			Address:   addr.Hex(),
+			WatchOnly: true,
+			CreatedAt: s.now().Unix(),
+		}
+		return nil
+	})
+}
+
+// LoadAccountKey returns the private key of the named account.
+func (s *Store) LoadAccountKey(name string) (*ecdsa.PrivateKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	return s.accountKey(name)
+}
+
+// SignWithAccount signs a 32-byte hash with the named account's key.
+func (s *Store) SignWithAccount(name string, hash []byte) (sig []byte, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer func() { s.audit(AuditSign, name, err) }()
+
+	if err := s.authorized(AuthSignWithAccount); err != nil {
+		return nil, err
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	key, err := s.accountKey(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkSigningKey(name); err != nil {
+		return nil, err
+	}
+	if err := s.allowDigests(name); err != nil {
+		return nil, err
+	}
+
+	return crypto.Sign(hash, key)
+}
+
+// ListAccounts returns all accounts sorted by name. With WithDeleted,
+// accounts in the trash follow the live account of the same name.
+func (s *Store) ListAccounts(opts ...ListOption) ([]AccountInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var o listOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if err := s.load(); err != nil {
+		if isNoKeystore(err) {
+			return []AccountInfo{}, nil
+		}
+		return nil, err
+	}
+
+	infos := s.accountInfos()
+	if o.deleted {
+		infos = append(infos, s.trashInfos()...)
+		sort.SliceStable(infos, func(i, j int) bool {
+			if infos[i].Name != infos[j].Name {
+				return infos[i].Name < infos[j].Name
+			}
+			return infos[i].DeletedAt == nil && infos[j].DeletedAt != nil
+		})
+	}
+	return infos, nil
+}
+
+// accountInfos describes the in-memory accounts, sorted by name.
+func (s *Store) accountInfos() []AccountInfo {
+	infos := make([]AccountInfo, 0, len(s.Accounts))
+	for name, account := range s.Accounts {
+		info := AccountInfo{
+			Name:        name,
+			Address:     common.HexToAddress(account.Address),
+			WatchOnly:   account.WatchOnly,
+			Labels:      copyLabels(account.Labels),
+			ChainID:     account.ChainID,
+			NetworkName: account.NetworkName,
+			Provenance:  account.Provenance.copy(),
+			Purpose:     account.Purpose.orAny(),
+		}
+		info.UseCount, info.LastUsedAt = s.usageOf(name, account.UseCount, account.LastUsedAt)
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// RenameAccount renames an account, updating the default-account pointer in
+// the same write.
+func (s *Store) RenameAccount(oldName, newName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := validateAccountName(newName); err != nil {
+		return err
+	}
+
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	account, ok := s.Accounts[oldName]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrAccountNotFound, oldName)
+	}
+
+	if oldName == newName {
+		return nil
+	}
+
+	if _, exists := s.Accounts[newName]; exists {
+		return fmt.Errorf("%w: %q", ErrAccountExists, newName)
+	}
+
+	delete(s.Accounts, oldName)
+	s.Accounts[newName] = account
+
+	if s.DefaultAccount == oldName {
+		s.DefaultAccount = newName
+	}
+	if s.EncryptionAccount == oldName {
+		s.EncryptionAccount = newName
+	}
+
+	return s.save()
+}
+
+// SetDefaultAccount marks the named account as the default one.
+// An empty name clears the pointer.
+func (s *Store) SetDefaultAccount(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	if _, ok := s.Accounts[name]; !ok && name != "" {
+		return fmt.Errorf("%w: %q", ErrAccountNotFound, name)
+	}
+
+	s.DefaultAccount = name
+	return s.save()
+}
+
+// GetDefaultAccount returns the name of the default account, if any.
+func (s *Store) GetDefaultAccount() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return "", err
+	}
+
+	return s.DefaultAccount, nil
+}
+
+// SetAccountLabel attaches a descriptive label to an account. An empty value
+// removes the label.
+func (s *Store) SetAccountLabel(name, key, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := validateLabel(key, value); err != nil {
+		return err
+	}
+
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	account, ok := s.Accounts[name]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrAccountNotFound, name)
+	}
+
+	setLabel(account, key, value)
+	return s.save()
+}
+
+func validateLabel(key, value string) error {
+	if key == "" || len(key) > maxLabelLength || len(value) > maxLabelLength {
+		return fmt.Errorf("%w %q: keys must be 1-%d and values at most %d characters", ErrInvalidLabel, key, maxLabelLength, maxLabelLength)
+	}
+	return nil
+}
+
+// setLabel sets or, for an empty value, removes a label.
+func setLabel(account *Account, key, value string) {
+	if value == "" {
+		delete(account.Labels, key)
+		return
+	}
+
+	if account.Labels == nil {
+		account.Labels = make(map[string]string)
+	}
+	account.Labels[key] = value
+}
+
+// GetAccountLabels returns a copy of the labels attached to an account.
+func (s *Store) GetAccountLabels(name string) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	account, ok := s.Accounts[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrAccountNotFound, name)
+	}
+
+	return copyLabels(account.Labels), nil
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	if len(labels) == 0 {
+		return nil
+	}
+
+	out := make(map[string]string, len(labels))
+	for k, v := range labels {
+		out[k] = v
+	}
+	return out
+}
+
+func (s *Store) accountKey(name string) (*ecdsa.PrivateKey, error) {
+	if err := s.frozenError(); err != nil {
+		return nil, err
+	}
+	return s.readAccountKey(name)
+}
+
+// readAccountKey is accountKey ignoring a freeze, for deriving public data.
+func (s *Store) readAccountKey(name string) (*ecdsa.PrivateKey, error) {
+	account, ok := s.Accounts[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrAccountNotFound, name)
+	}
+
+	if account.WatchOnly {
+		return nil, fmt.Errorf("%w: %q", ErrWatchOnly, name)
+	}
+
+	privateKeyHex, err := s.openKey(account.PrivateKey, account.EncryptedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := crypto.HexToECDSA(privateKeyHex)
+	if err != nil {
+		return nil, s.invalidStoredKey("accounts."+name, err)
+	}
+	return key, nil
+}
+
+func (s *Store) hasPlaintextKey() bool {
+	if s.persisted.PrivateKey != "" || s.SSHKey != "" {
+		return true
+	}
+
+	for _, accounts := range []map[string]*Account{s.Accounts, s.Trash} {
+		for _, account := range accounts {
+			if account.PrivateKey != "" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,288 @@
+package keystore
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// GetAddress returns the address of the primary key. It is read from the
+// stored address field, so encrypted keys need not be unlocked.
+func (s *Store) GetAddress() (common.Address, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.address()
+}
+
+func (s *Store) address() (common.Address, error) {
+	if s.creds.privateKey == "" {
+		if err := s.load(); err != nil {
+			return common.Address{}, err
+		}
+
+		if s.Address != "" {
+			return common.HexToAddress(s.Address), nil
+		}
+	}
+
+	key, _, err := s.readPrimaryKey()
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(key.PublicKey), nil
+}
+
+// ChecksummedAddress returns the EIP-55 mixed-case form of the primary address.
+func (s *Store) ChecksummedAddress() (string, error) {
+	addr, err := s.GetAddress()
+	if err != nil {
+		return "", err
+	}
+	return addr.Hex(), nil
+}
+
+// PublicKeyHex returns the primary public key as hex, either as the 33-byte
+// compressed or the 65-byte uncompressed SEC1 encoding. The public key is read
+// from the stored public data, so encrypted keys need not be unlocked.
+func (s *Store) PublicKeyHex(compressed bool) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pub, err := s.publicKey()
+	if err != nil {
+		return "", err
+	}
+
+	if compressed {
+		return hex.EncodeToString(crypto.CompressPubkey(pub)), nil
+	}
+	return hex.EncodeToString(crypto.FromECDSAPub(pub)), nil
+}
+
+// secp256k1Order is the order n of the secp256k1 group.
+var secp256k1Order = crypto.S256().Params().N
+
+// ValidatePrivateKeyHex checks that s is a usable secp256k1 private key: 64
+// hex digits encoding a nonzero scalar below the group order whose public
+// key is not the point at infinity. Errors never include the key itself.
+func ValidatePrivateKeyHex(s string) error {
+	if len(s) != 64 {
+		return fmt.Errorf("%w: expected 64 hex digits, got %d characters", ErrInvalidPrivateKey, len(s))
+	}
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return fmt.Errorf("%w: not a hex string", ErrInvalidPrivateKey)
+	}
+	defer wipe(b)
+
+	d := new(big.Int).SetBytes(b)
+	defer d.SetInt64(0)
+
+	if d.Sign() == 0 {
+		return fmt.Errorf("%w: key is zero", ErrInvalidPrivateKey)
+	}
+	if d.Cmp(secp256k1Order) >= 0 {
+		return fmt.Errorf("%w: key is not below the secp256k1 group order", ErrInvalidPrivateKey)
+	}
+
+	if x, y := crypto.S256().ScalarBaseMult(b); x.Sign() == 0 && y.Sign() == 0 {
+		return fmt.Errorf("%w: public key is the point at infinity", ErrInvalidPrivateKey)
+	}
+
+	return nil
+}
+
+// invalidStoredKey reports a private key stored under field that does not
+// parse.
+func (s *Store) invalidStoredKey(field string, err error) error {
+	return s.corrupt(field, fmt.Errorf("%w: %v", ErrInvalidStoredKey, err))
+}
+
+// parsePrivateKeyHex validates and parses a key entering the keystore.
+func parsePrivateKeyHex(s string) (*ecdsa.PrivateKey, error) {
+	if err := ValidatePrivateKeyHex(s); err != nil {
+		return nil, err
+	}
+	return crypto.HexToECDSA(s)
+}
+
+func (s *Store) publicKey() (*ecdsa.PublicKey, error) {
+	if s.creds.privateKey == "" {
+		if err := s.load(); err != nil {
+			return nil, err
+		}
+
+		if err := s.checkEthereumKey(); err != nil {
+			return nil, err
+		}
+
+		if s.PublicKey != "" {
+			data, err := hex.DecodeString(s.PublicKey)
+			if err != nil {
+				return nil, s.corrupt("public_key", err)
+			}
+			return crypto.UnmarshalPubkey(data)
+		}
+	}
+
+	key, _, err := s.readPrimaryKey()
+	if err != nil {
+		return nil, err
+	}
+	return &key.PublicKey, nil
+}
+
+// ValidateChecksumAddress checks that s is a well-formed 0x-prefixed address
+// and, if it uses mixed case, that the case matches its EIP-55 checksum.
+// All-lowercase and all-uppercase addresses carry no checksum and are accepted.
+func ValidateChecksumAddress(s string) error {
+	if !strings.HasPrefix(s, "0x") || len(s) != 2+2*common.AddressLength || !common.IsHexAddress(s) {
+		return fmt.Errorf("%w: %q", ErrInvalidAddress, s)
+	}
+
+	body := s[2:]
+	if body == strings.ToLower(body) || body == strings.ToUpper(body) {
+		return nil
+	}
+
+	if expected := common.HexToAddress(s).Hex(); expected != s {
+		return fmt.Errorf("%w: %q, expected %s", ErrBadChecksum, s, expected)
+	}
+
+	return nil
+}
+
+// primaryKey returns the primary private key for use, as readPrimaryKey
+// does, failing with ErrKeystoreFrozen while the keystore is frozen.
+func (s *Store) primaryKey() (*ecdsa.PrivateKey, string, error) {
+	if s.creds.privateKey != "" {
+		// Credential keys are not cached, so the freeze flag is read here.
+		if err := s.checkFrozen(); err != nil {
+			return nil, "", err
+		}
+	}
+
+	key, privateKeyHex, err := s.readPrimaryKey()
+	if err != nil {
+		return nil, "", err
+	}
+
+	// A cached key is only returned while the backend is unchanged, so the
+	// loaded freeze flag is current.
+	if err := s.frozenError(); err != nil {
+		return nil, "", err
+	}
+	return key, privateKeyHex, nil
+}
+
+// readPrimaryKey loads the primary private key, returning it both parsed
+// and in hex form. The key is checked against the stored address; files
+// written before the address was recorded have it populated on the first
+// load. The parsed key is cached until the backend changes. Unlike
+// primaryKey, it ignores a freeze, for deriving public data.
+func (s *Store) readPrimaryKey() (*ecdsa.PrivateKey, string, error) {
+	if s.creds.privateKey != "" {
+		key, err := crypto.HexToECDSA(s.creds.privateKey)
+		if err != nil {
+			return nil, "", err
+		}
+		if err := s.checkExpectedAddress(key); err != nil {
+			return nil, "", err
+		}
+		return key, s.creds.privateKey, nil
+	}
+
+	if key, privateKeyHex, ok := s.cachedKey(); ok {
+		return key, privateKeyHex, nil
+	}
+
+	// The stamp is taken before reading so a concurrent write can only make
+	// the cache look stale, never fresh.
+	stamp, cacheable := s.currentStamp()
+
+	if err := s.load(); err != nil {
+		return nil, "", err
+	}
+
+	if err := s.checkEthereumKey(); err != nil {
+		return nil, "", err
+	}
+
+	privateKeyHex, err := s.privateKeyHex()
+	if err != nil {
+		return nil, "", err
+	}
+
+	key, err := crypto.HexToECDSA(privateKeyHex)
+	if err != nil {
+		return nil, "", s.invalidStoredKey("private_key", err)
+	}
+
+	if err := s.verifyAddress(key); err != nil {
+		return nil, "", err
+	}
+
+	if err := s.checkExpectedAddress(key); err != nil {
+		return nil, "", err
+	}
+
+	if cacheable {
+		s.cache = &keyCache{key: key, hex: privateKeyHex, stamp: stamp}
+	}
+
+	return key, privateKeyHex, nil
+}
+
+// checkExpectedAddress enforces Config.ExpectedAddress, if set.
+func (s *Store) checkExpectedAddress(key *ecdsa.PrivateKey) error {
+	expected := s.config.ExpectedAddress
+	if expected == (common.Address{}) {
+		return nil
+	}
+
+	derived := crypto.PubkeyToAddress(key.PublicKey)
+	if derived != expected {
+		return fmt.Errorf("%w: expected %s, key derives to %s", ErrUnexpectedAddress, expected.Hex(), derived.Hex())
+	}
+
+	return nil
+}
+
+func (s *Store) verifyAddress(key *ecdsa.PrivateKey) error {
+	derived := crypto.PubkeyToAddress(key.PublicKey)
+
+	if s.Address != "" {
+		stored := common.HexToAddress(s.Address)
+		if stored != derived {
+			if !s.config.WarnOnAddressMismatch {
+				return fmt.Errorf("%w: stored %s, key derives to %s", ErrAddressMismatch, stored.Hex(), derived.Hex())
+			}
+			s.config.Logger.Warn("keystore: private key does not match stored address",
+				"stored", stored.Hex(), "derived", derived.Hex())
+			return nil
+		}
+	}
+
+	if s.Address == "" || s.PublicKey == "" {
+		s.setPublicData(key)
+		if err := s.save(); err != nil {
+			s.config.Logger.Warn("keystore: failed to record key address", "error", err)
+		}
+	}
+
+	return nil
+}
+
+// setPublicData records the address and public key derived from key so they
+// can be read without decrypting the key.
+func (s *Store) setPublicData(key *ecdsa.PrivateKey) {
+	s.Address = crypto.PubkeyToAddress(key.PublicKey).Hex()
+	s.PublicKey = hex.EncodeToString(crypto.FromECDSAPub(&key.PublicKey))
+}
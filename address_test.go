@@ -0,0 +1,323 @@
+package keystore_test
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/theblitlabs/keystore"
+)
+
+func scalarHex(n *big.Int) string {
+	return fmt.Sprintf("%064x", n)
+}
+
+var secp256k1Order = crypto.S256().Params().N
+
+func TestValidatePrivateKeyHex(t *testing.T) {
+	one := big.NewInt(1)
+
+	tests := []struct {
+		name    string
+		key     string
+		wantErr string
+	}{
+		{name: "one", key: scalarHex(one)},
+		{name: "order-1", key: scalarHex(new(big.Int).Sub(secp256k1Order, one))},
+		{name: "order", key: scalarHex(secp256k1Order), wantErr: "group order"},
+		{name: "order+1", key: scalarHex(new(big.Int).Add(secp256k1Order, one)), wantErr: "group order"},
+		{name: "all ones", key: strings.Repeat("f", 64), wantErr: "group order"},
+		{name: "zero", key: strings.Repeat("0", 64), wantErr: "zero"},
+		{name: "typical", key: fileKeyHex},
+		{name: "uppercase", key: strings.ToUpper(fileKeyHex)},
+		{name: "short", key: fileKeyHex[:62], wantErr: "64 hex digits"},
+		{name: "long", key: fileKeyHex + "00", wantErr: "64 hex digits"},
+		{name: "0x prefix", key: "0x" + fileKeyHex[2:], wantErr: "not a hex string"},
+		{name: "not hex", key: "zz" + fileKeyHex[2:], wantErr: "not a hex string"},
+		{name: "empty", key: "", wantErr: "64 hex digits"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := keystore.ValidatePrivateKeyHex(tt.key)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ValidatePrivateKeyHex: %v", err)
+				}
+				return
+			}
+
+			if !errors.Is(err, keystore.ErrInvalidPrivateKey) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ValidatePrivateKeyHex: got %v, want ErrInvalidPrivateKey mentioning %q", err, tt.wantErr)
+			}
+			if len(tt.key) >= 8 && strings.Contains(strings.ToLower(err.Error()), strings.ToLower(tt.key[2:10])) {
+				t.Fatalf("error %q echoes the key", err)
+			}
+		})
+	}
+}
+
+func TestPrivateKeyEntryPointsValidate(t *testing.T) {
+	order := scalarHex(secp256k1Order)
+	chain := big.NewInt(1)
+
+	entryPoints := []struct {
+		name string
+		save func(ks *keystore.Store, key string) error
+	}{
+		{"SavePrivateKey", func(ks *keystore.Store, key string) error { return ks.SavePrivateKey(key) }},
+		{"SavePrivateKeyForChain", func(ks *keystore.Store, key string) error { return ks.SavePrivateKeyForChain(key, chain, "mainnet") }},
+		{"SavePrivateKeyWithPurpose", func(ks *keystore.Store, key string) error {
+			return ks.SavePrivateKeyWithPurpose(key, keystore.KeyPurposeSigning)
+		}},
+		{"SaveAccount", func(ks *keystore.Store, key string) error { return ks.SaveAccount("acct", key) }},
+		{"SaveAccountForChain", func(ks *keystore.Store, key string) error {
+			return ks.SaveAccountForChain("acct", key, chain, "mainnet")
+		}},
+		{"SaveAccountWithPurpose", func(ks *keystore.Store, key string) error {
+			return ks.SaveAccountWithPurpose("acct", key, keystore.KeyPurposeSigning)
+		}},
+		{"UpdateFields", func(ks *keystore.Store, key string) error { return ks.UpdateFields(keystore.Fields{PrivateKey: &key}) }},
+		{"SavePrivateKeyBytes", func(ks *keystore.Store, key string) error {
+			b, err := hex.DecodeString(key)
+			if err != nil {
+				return fmt.Errorf("%w: not a hex string", keystore.ErrInvalidPrivateKey)
+			}
+			return ks.SavePrivateKeyBytes(b)
+		}},
+	}
+
+	bad := map[string]string{
+		"zero":  strings.Repeat("0", 64),
+		"order": order,
+		"short": fileKeyHex[:62],
+	}
+
+	for _, ep := range entryPoints {
+		t.Run(ep.name, func(t *testing.T) {
+			ks, err := keystore.NewKeystore(keystore.Config{DirPath: t.TempDir()})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for name, key := range bad {
+				if err := ep.save(ks, key); !errors.Is(err, keystore.ErrInvalidPrivateKey) {
+					t.Errorf("%s key: got %v, want ErrInvalidPrivateKey", name, err)
+				}
+			}
+			if _, err := ks.LoadPrivateKey(); !errors.Is(err, keystore.ErrNoKeystore) {
+				t.Errorf("a rejected key was written: %v", err)
+			}
+
+			if err := ep.save(ks, fileKeyHex); err != nil {
+				t.Fatalf("valid key: %v", err)
+			}
+		})
+	}
+}
+
+// eip55Addresses are the test vectors of EIP-55.
+var eip55Addresses = []string{
+	// All caps
+	"0x52908400098527886E0F7030069857D2E4169EE7",
+	"0x8617E340B3D01FA5F11F306F4090FD50E238070D",
+	// All lower
+	"0xde709f2102306220921060314715629080e2fb77",
+	"0x27b1fdb04752bbc536007a920d24acb045561c26",
+	// Normal
+	"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+	"0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359",
+	"0xdbF03B407c01E7cD3CBea99509d93f8DDDC8C6FB",
+	"0xD1220A0cf47c7B9Be7A2E6BA89F429762e7b9aDb",
+}
+
+func TestValidateChecksumAddress(t *testing.T) {
+	for _, addr := range eip55Addresses {
+		if err := keystore.ValidateChecksumAddress(addr); err != nil {
+			t.Errorf("ValidateChecksumAddress(%s): %v", addr, err)
+		}
+	}
+
+	// Changing the case of one letter of a mixed-case address breaks its
+	// checksum, and the error gives the right casing.
+	for _, addr := range eip55Addresses[4:] {
+		i := strings.IndexAny(addr[2:], "abcdefABCDEF") + 2
+		flipped := addr[:i] + string(addr[i]^0x20) + addr[i+1:]
+		err := keystore.ValidateChecksumAddress(flipped)
+		if !errors.Is(err, keystore.ErrBadChecksum) || !strings.Contains(err.Error(), addr) {
+			t.Errorf("ValidateChecksumAddress(%s): got %v, want ErrBadChecksum naming %s", flipped, err, addr)
+		}
+	}
+
+	for _, addr := range []string{
+		"", "0x", "5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", "0X5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+		"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAe", "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed00",
+		"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAeg",
+	} {
+		if err := keystore.ValidateChecksumAddress(addr); !errors.Is(err, keystore.ErrInvalidAddress) {
+			t.Errorf("ValidateChecksumAddress(%q): got %v, want ErrInvalidAddress", addr, err)
+		}
+	}
+}
+
+// publicKeyVectors are public keys in both SEC1 encodings, with the
+// EIP-55 address where it is published. They cover both parities of y,
+// which pick the 02 and 03 compressed prefixes.
+var publicKeyVectors = []struct {
+	keyHex       string
+	uncompressed string
+	compressed   string
+	address      string
+}{
+	{
+		// The generator point
+		keyHex:       "0000000000000000000000000000000000000000000000000000000000000001",
+		uncompressed: "0479be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8",
+		compressed:   "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798",
+		address:      "0x7E5F4552091A69125d5DfCb7b8C2659029395Bdf",
+	},
+	{
+		keyHex:       "0000000000000000000000000000000000000000000000000000000000000006",
+		uncompressed: "04fff97bd5755eeea420453a14355235d382f6472f8568a18b2f057a1460297556ae12777aacfbb620f3be96017f45c560de80f0f6518fe4a03c870c36b075f297",
+		compressed:   "03fff97bd5755eeea420453a14355235d382f6472f8568a18b2f057a1460297556",
+	},
+	{
+		// The web3.js documentation key
+		keyHex:       fileKeyHex,
+		uncompressed: "044e3b81af9c2234cad09d679ce6035ed1392347ce64ce405f5dcd36228a25de6e47fd35c4215d1edf53e6f83de344615ce719bdb0fd878f6ed76f06dd277956de",
+		compressed:   "024e3b81af9c2234cad09d679ce6035ed1392347ce64ce405f5dcd36228a25de6e",
+		address:      "0x2c7536E3605D9C16a7a3D7b1898e529396a65c23",
+	},
+	{
+		keyHex:       credentialKeyHex,
+		uncompressed: "04d11e94912283d217fd98be5ad59c659aede69bbef0e72a2213edf0fbd8de3cc95030d006b137e22b89e738e5565766b83d12c438fe970e3e729532fcfafad2a7",
+		compressed:   "03d11e94912283d217fd98be5ad59c659aede69bbef0e72a2213edf0fbd8de3cc9",
+	},
+}
+
+func TestPublicKeyHexVectors(t *testing.T) {
+	for _, v := range publicKeyVectors {
+		dir := t.TempDir()
+		writer := newErrorStore(t, keystore.Config{DirPath: dir, Passphrase: keystore.StaticPassphrase("vectors")})
+		if err := writer.SavePrivateKey(v.keyHex); err != nil {
+			t.Fatal(err)
+		}
+
+		// The public data is read without unlocking the encrypted key.
+		ks := newErrorStore(t, keystore.Config{DirPath: dir})
+		if got, err := ks.PublicKeyHex(false); err != nil || got != v.uncompressed {
+			t.Errorf("PublicKeyHex(false) for %s = %s, %v, want %s", v.keyHex, got, err, v.uncompressed)
+		}
+		if got, err := ks.PublicKeyHex(true); err != nil || got != v.compressed {
+			t.Errorf("PublicKeyHex(true) for %s = %s, %v, want %s", v.keyHex, got, err, v.compressed)
+		}
+		got, err := ks.ChecksummedAddress()
+		if err != nil {
+			t.Fatalf("ChecksummedAddress: %v", err)
+		}
+		if err := keystore.ValidateChecksumAddress(got); err != nil || got == strings.ToLower(got) {
+			t.Errorf("ChecksummedAddress for %s = %s, not in EIP-55 form: %v", v.keyHex, got, err)
+		}
+		if v.address != "" && got != v.address {
+			t.Errorf("ChecksummedAddress for %s = %s, want %s", v.keyHex, got, v.address)
+		}
+		if _, err := ks.LoadPrivateKey(); !errors.Is(err, keystore.ErrLocked) {
+			t.Fatalf("LoadPrivateKey without a passphrase: got %v, want ErrLocked", err)
+		}
+	}
+
+	if _, err := newErrorStore(t, keystore.Config{}).PublicKeyHex(true); err == nil {
+		t.Fatal("PublicKeyHex without a key succeeded")
+	}
+}
+
+func TestExpectedAddress(t *testing.T) {
+	fileAddr := crypto.PubkeyToAddress(mustKey(t, fileKeyHex).PublicKey)
+	credentialAddr := crypto.PubkeyToAddress(mustKey(t, credentialKeyHex).PublicKey)
+	envAddr := crypto.PubkeyToAddress(mustKey(t, envKeyHex).PublicKey)
+
+	// assertUnexpected checks that err reports both addresses, EIP-55 cased.
+	assertUnexpected := func(t *testing.T, op string, err error, derived common.Address) {
+		t.Helper()
+		if !errors.Is(err, keystore.ErrUnexpectedAddress) {
+			t.Fatalf("%s: got %v, want ErrUnexpectedAddress", op, err)
+		}
+		for _, addr := range []common.Address{fileAddr, derived} {
+			if !strings.Contains(err.Error(), addr.Hex()) {
+				t.Fatalf("%s: %q does not name %s", op, err, addr.Hex())
+			}
+		}
+	}
+
+	// The pin is compared as an address, however its hex was cased.
+	for _, pin := range []string{fileAddr.Hex(), strings.ToLower(fileAddr.Hex()), "0x" + strings.ToUpper(fileAddr.Hex()[2:])} {
+		dir := t.TempDir()
+		ks := newErrorStore(t, keystore.Config{DirPath: dir, ExpectedAddress: common.HexToAddress(pin)})
+		if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+			t.Fatalf("SavePrivateKey of the pinned key with pin %s: %v", pin, err)
+		}
+		if _, err := ks.LoadPrivateKey(); err != nil {
+			t.Fatalf("LoadPrivateKey of the pinned key with pin %s: %v", pin, err)
+		}
+	}
+
+	pinned := keystore.Config{ExpectedAddress: fileAddr}
+
+	t.Run("save", func(t *testing.T) {
+		dir := t.TempDir()
+		cfg := pinned
+		cfg.DirPath = dir
+		ks := newErrorStore(t, cfg)
+		assertUnexpected(t, "SavePrivateKey", ks.SavePrivateKey(credentialKeyHex), credentialAddr)
+		if _, err := os.Stat(filepath.Join(dir, keystore.DefaultFileName)); !os.IsNotExist(err) {
+			t.Fatalf("a rejected save wrote the keystore: %v", err)
+		}
+	})
+
+	t.Run("mnemonic", func(t *testing.T) {
+		ks := newErrorStore(t, pinned)
+		_, err := ks.ImportFromMnemonic(hardhatMnemonic, "", nil)
+		assertUnexpected(t, "ImportFromMnemonic", err, common.HexToAddress("0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266"))
+	})
+
+	t.Run("load", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := newErrorStore(t, keystore.Config{DirPath: dir}).SavePrivateKey(credentialKeyHex); err != nil {
+			t.Fatal(err)
+		}
+		cfg := pinned
+		cfg.DirPath = dir
+		ks := newErrorStore(t, cfg)
+		_, err := ks.LoadPrivateKey()
+		assertUnexpected(t, "LoadPrivateKey", err, credentialAddr)
+		_, err = ks.GetPrivateKeyHex()
+		assertUnexpected(t, "GetPrivateKeyHex", err, credentialAddr)
+	})
+
+	t.Run("systemd credential", func(t *testing.T) {
+		credDir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(credDir, keystore.DefaultPrivateKeyCredential), []byte(credentialKeyHex+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv(keystore.CredentialsDirectoryEnv, credDir)
+		cfg := pinned
+		cfg.SystemdCredentials = true
+		_, err := newErrorStore(t, cfg).LoadPrivateKey()
+		assertUnexpected(t, "LoadPrivateKey from a credential", err, credentialAddr)
+	})
+
+	t.Run("environment", func(t *testing.T) {
+		t.Setenv("KEYSTORE_TEST_PINNED_KEY", envKeyHex)
+		cfg := pinned
+		cfg.KeyFromEnv = "KEYSTORE_TEST_PINNED_KEY"
+		_, err := newErrorStore(t, cfg).LoadPrivateKey()
+		assertUnexpected(t, "LoadPrivateKey from the environment", err, envAddr)
+	})
+}
@@ -0,0 +1,192 @@
+package keystore
+
+import (
+	"context"
+	"sync"
+)
+
+// asyncWriter queues writes made with SaveTokenAsync and UpdateFieldsAsync.
+// Queued operations form a batch written in one update cycle by a
+// background goroutine, or by the next synchronous write, whichever takes
+// the Store mutex first. Either way they are applied in the order they
+// were queued, before any write requested after them. Queueing takes only
+// mu, never the Store mutex.
+type asyncWriter struct {
+	mu      sync.Mutex
+	pending *asyncBatch
+	writing *asyncBatch
+}
+
+// asyncBatch is a set of queued operations written together.
+type asyncBatch struct {
+	ops  []*asyncOp
+	done chan struct{}
+	err  error
+}
+
+// asyncOp is one queued operation. Consecutive operations with the same
+// non-empty coalesce key collapse into the last of them.
+type asyncOp struct {
+	coalesce string
+	token    bool
+	apply    func() error
+	waiters  []chan error
+}
+
+// SaveTokenAsync queues token to be saved like SaveToken and returns at
+// once. The channel receives the outcome once the write is done. Token
+// saves queued in quick succession are coalesced, so only the last one is
+// written and all of them report its outcome. Queued writes are applied in
+// call order and before any later synchronous write, so the last call
+// wins. They are written under the same file lock as any other save; call
+// Flush or Close before the process exits, or they are lost.
+func (s *Store) SaveTokenAsync(token string) <-chan error {
+	// Only the configuration, which never changes, is consulted here, so
+	// queueing does not wait for the Store mutex while a write holds it.
+	if err := s.checkToken(token); err != nil {
+		return asyncResult(err)
+	}
+
+	ttl := s.tokenTTL()
+	return s.enqueue(&asyncOp{
+		coalesce: "token",
+		token:    true,
+		apply:    func() error { return s.setToken(token, ttl) },
+	})
+}
+
+// UpdateFieldsAsync queues fields to be applied like UpdateFields and
+// returns at once, with the ordering guarantees of SaveTokenAsync. Fields
+// are validated before queueing; the channel reports errors found only
+// when applying them, such as an unknown account.
+func (s *Store) UpdateFieldsAsync(fields Fields) <-chan error {
+	apply, err := s.checkFields(fields)
+	if err != nil {
+		return asyncResult(err)
+	}
+	return s.enqueue(&asyncOp{token: fields.AuthToken != nil, apply: apply})
+}
+
+// Flush waits until the writes queued so far are done and returns the
+// first error of the last batch written. If ctx ends first it returns
+// ctx.Err() and the writes carry on in the background.
+func (s *Store) Flush(ctx context.Context) error {
+	w := s.async
+	if w == nil {
+		return nil
+	}
+
+	w.mu.Lock()
+	b := w.pending
+	if b == nil {
+		b = w.writing
+	}
+	w.mu.Unlock()
+	if b == nil {
+		return nil
+	}
+
+	select {
+	case <-b.done:
+		return b.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// enqueue adds op to the pending batch, starting a writer for a new batch.
+// It takes only the queue's own lock.
+func (s *Store) enqueue(op *asyncOp) <-chan error {
+	w := s.async
+
+	ch := make(chan error, 1)
+	w.mu.Lock()
+	start := w.pending == nil
+	if start {
+		w.pending = &asyncBatch{done: make(chan struct{})}
+	}
+	b := w.pending
+	if n := len(b.ops); op.coalesce != "" && n > 0 && b.ops[n-1].coalesce == op.coalesce {
+		last := b.ops[n-1]
+		last.apply = op.apply
+		last.waiters = append(last.waiters, ch)
+	} else {
+		op.waiters = []chan error{ch}
+		b.ops = append(b.ops, op)
+	}
+	w.mu.Unlock()
+
+	if start {
+		go func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.drainAsync()
+		}()
+	}
+	return ch
+}
+
+// drainAsync writes the pending batch, if any, in one update cycle. If
+// the cycle fails, its operations are retried one cycle each so that only
+// the failing ones report an error. A batch queued meanwhile is written
+// after this one, by its own writer. The caller holds s.mu.
+func (s *Store) drainAsync() {
+	w := s.async
+	if w == nil {
+		return
+	}
+
+	w.mu.Lock()
+	b := w.pending
+	w.pending = nil
+	w.writing = b
+	w.mu.Unlock()
+	if b == nil {
+		return
+	}
+
+	b.err = s.updateQueued(scopeStore, func() error {
+		for _, op := range b.ops {
+			if err := op.apply(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if b.err != nil && len(b.ops) > 1 {
+		b.err = nil
+		for _, op := range b.ops {
+			err := s.updateQueued(scopeStore, op.apply)
+			if b.err == nil {
+				b.err = err
+			}
+			op.finish(s, err)
+		}
+	} else {
+		for _, op := range b.ops {
+			op.finish(s, b.err)
+		}
+	}
+
+	w.mu.Lock()
+	if w.writing == b {
+		w.writing = nil
+	}
+	w.mu.Unlock()
+	close(b.done)
+}
+
+func (op *asyncOp) finish(s *Store, err error) {
+	if err == nil && op.token {
+		s.rearmWatchers()
+	}
+	for _, ch := range op.waiters {
+		ch <- err
+	}
+}
+
+func asyncResult(err error) <-chan error {
+	ch := make(chan error, 1)
+	ch <- err
+	return ch
+}
@@ -0,0 +1,269 @@
+package keystore_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/theblitlabs/keystore"
+	"github.com/theblitlabs/keystore/faultinject"
+)
+
+const slowWrite = 300 * time.Millisecond
+
+func newAsyncStore(t *testing.T, dir string, inj *faultinject.Injector) *keystore.Store {
+	t.Helper()
+
+	cfg := keystore.Config{DirPath: dir, Logger: discardLogger}
+	if inj != nil {
+		cfg.FaultInjector = inj
+	}
+	ks, err := keystore.NewKeystore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ks
+}
+
+// busyWriting starts a synchronous save that holds the Store for
+// slowWrite, and returns once it is writing.
+func busyWriting(t *testing.T, ks *keystore.Store, inj *faultinject.Injector) <-chan error {
+	t.Helper()
+
+	inj.Once(keystore.FaultOpWrite, keystore.Fault{Delay: slowWrite})
+	before := inj.Calls(keystore.FaultOpWrite)
+	done := make(chan error, 1)
+	go func() { done <- ks.SaveToken("synchronous") }()
+	waitFor(t, "the synchronous write to start", func() bool {
+		return inj.Calls(keystore.FaultOpWrite) > before
+	})
+	return done
+}
+
+func ptr(s string) *string { return &s }
+
+func TestAsyncOrdering(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  func(ks *keystore.Store) []<-chan error
+		want string
+	}{
+		{
+			name: "async after async",
+			ops: func(ks *keystore.Store) []<-chan error {
+				return []<-chan error{ks.SaveTokenAsync("first"), ks.SaveTokenAsync("second")}
+			},
+			want: "second",
+		},
+		{
+			name: "sync after async",
+			ops: func(ks *keystore.Store) []<-chan error {
+				ch := ks.SaveTokenAsync("async")
+				return []<-chan error{ch, asyncDone(ks.SaveToken("sync"))}
+			},
+			want: "sync",
+		},
+		{
+			name: "async after sync",
+			ops: func(ks *keystore.Store) []<-chan error {
+				return []<-chan error{asyncDone(ks.SaveToken("sync")), ks.SaveTokenAsync("async")}
+			},
+			want: "async",
+		},
+		{
+			name: "fields between tokens",
+			ops: func(ks *keystore.Store) []<-chan error {
+				return []<-chan error{
+					ks.SaveTokenAsync("first"),
+					ks.UpdateFieldsAsync(keystore.Fields{AuthToken: ptr("fields")}),
+					ks.SaveTokenAsync("last"),
+				}
+			},
+			want: "last",
+		},
+		{
+			name: "fields last",
+			ops: func(ks *keystore.Store) []<-chan error {
+				return []<-chan error{
+					ks.SaveTokenAsync("token"),
+					ks.UpdateFieldsAsync(keystore.Fields{AuthToken: ptr("fields")}),
+				}
+			},
+			want: "fields",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			ks := newAsyncStore(t, dir, nil)
+			for i, ch := range tt.ops(ks) {
+				if err := <-ch; err != nil {
+					t.Fatalf("operation %d: %v", i, err)
+				}
+			}
+			if err := ks.Flush(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if token, err := newAsyncStore(t, dir, nil).LoadToken(); err != nil || token != tt.want {
+				t.Fatalf("persisted token = %q, %v, want %q", token, err, tt.want)
+			}
+		})
+	}
+}
+
+func asyncDone(err error) <-chan error {
+	ch := make(chan error, 1)
+	ch <- err
+	return ch
+}
+
+func TestSaveTokenAsyncCoalesces(t *testing.T) {
+	inj := faultinject.New()
+	ks := newAsyncStore(t, t.TempDir(), inj)
+	if err := ks.SaveToken("initial"); err != nil {
+		t.Fatal(err)
+	}
+	rev, _ := ks.Revision()
+	writes := inj.Calls(keystore.FaultOpWrite)
+
+	busy := busyWriting(t, ks, inj)
+
+	// Queueing never waits for the write holding the Store.
+	start := time.Now()
+	var chans []<-chan error
+	for i := 0; i < 10; i++ {
+		chans = append(chans, ks.SaveTokenAsync(fmt.Sprintf("token-%d", i)))
+	}
+	if elapsed := time.Since(start); elapsed > slowWrite/2 {
+		t.Fatalf("queueing took %v while a write was in progress", elapsed)
+	}
+	select {
+	case <-busy:
+		t.Fatal("synchronous write finished while queueing")
+	default:
+	}
+
+	if err := ks.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if err := <-busy; err != nil {
+		t.Fatal(err)
+	}
+	for i, ch := range chans {
+		if err := <-ch; err != nil {
+			t.Fatalf("save %d: %v", i, err)
+		}
+	}
+
+	// The synchronous write and a single one for the ten queued saves.
+	if n := inj.Calls(keystore.FaultOpWrite) - writes; n != 2 {
+		t.Fatalf("%d writes, want 2", n)
+	}
+	if got, _ := ks.Revision(); got != rev+2 {
+		t.Fatalf("revision = %d, want %d", got, rev+2)
+	}
+	if token, err := ks.LoadToken(); err != nil || token != "token-9" {
+		t.Fatalf("LoadToken = %q, %v, want the last queued token", token, err)
+	}
+}
+
+func TestAsyncErrors(t *testing.T) {
+	ks := newAsyncStore(t, t.TempDir(), nil)
+
+	// Invalid input is reported at once, without queueing.
+	for name, ch := range map[string]<-chan error{
+		"empty token":  ks.SaveTokenAsync(""),
+		"negative TTL": ks.UpdateFieldsAsync(keystore.Fields{TokenTTL: -time.Second}),
+		"invalid key":  ks.UpdateFieldsAsync(keystore.Fields{PrivateKey: ptr("not a key")}),
+	} {
+		select {
+		case err := <-ch:
+			if err == nil {
+				t.Errorf("%s: no error", name)
+			}
+		default:
+			t.Errorf("%s: error not reported at once", name)
+		}
+	}
+
+	// A failure found while applying affects only its own operation.
+	first := ks.SaveTokenAsync("first")
+	bad := ks.UpdateFieldsAsync(keystore.Fields{DefaultAccount: ptr("missing")})
+	last := ks.UpdateFieldsAsync(keystore.Fields{AuthToken: ptr("last")})
+	if err := <-first; err != nil {
+		t.Errorf("first: %v", err)
+	}
+	if err := <-bad; !errors.Is(err, keystore.ErrAccountNotFound) {
+		t.Errorf("unknown default account: got %v, want ErrAccountNotFound", err)
+	}
+	if err := <-last; err != nil {
+		t.Errorf("last: %v", err)
+	}
+	if token, err := ks.LoadToken(); err != nil || token != "last" {
+		t.Fatalf("LoadToken = %q, %v", token, err)
+	}
+}
+
+func TestAsyncRetryOrdering(t *testing.T) {
+	dir := t.TempDir()
+	inj := faultinject.New()
+	ks := newAsyncStore(t, dir, inj)
+
+	// The batch's first cycle fails slowly, so it is retried one operation
+	// at a time. A token queued meanwhile is newer than all of them.
+	inj.Once(keystore.FaultOpSave, keystore.Fault{Err: errors.New("disk full"), Delay: slowWrite})
+	first := ks.SaveTokenAsync("t1")
+	fields := ks.UpdateFieldsAsync(keystore.Fields{TokenTTL: time.Hour})
+	waitFor(t, "the batch to start writing", func() bool {
+		return inj.Calls(keystore.FaultOpSave) > 0
+	})
+	last := ks.SaveTokenAsync("t2")
+
+	for name, ch := range map[string]<-chan error{"t1": first, "fields": fields, "t2": last} {
+		if err := <-ch; err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	if err := ks.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if token, err := newAsyncStore(t, dir, nil).LoadToken(); err != nil || token != "t2" {
+		t.Fatalf("persisted token = %q, %v, want t2", token, err)
+	}
+}
+
+func TestFlushAndClose(t *testing.T) {
+	inj := faultinject.New()
+	dir := t.TempDir()
+	ks := newAsyncStore(t, dir, inj)
+
+	if err := ks.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush with nothing queued: %v", err)
+	}
+
+	busy := busyWriting(t, ks, inj)
+	queued := ks.SaveTokenAsync("queued")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := ks.Flush(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Flush with an expiring context: got %v, want DeadlineExceeded", err)
+	}
+
+	// Close waits for the queue.
+	if err := ks.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := <-busy; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-queued; err != nil {
+		t.Fatal(err)
+	}
+	if token, err := newAsyncStore(t, dir, nil).LoadToken(); err != nil || token != "queued" {
+		t.Fatalf("token after Close = %q, %v, want the queued one", token, err)
+	}
+}
@@ -0,0 +1,115 @@
+package keystore
+
+import (
+	"log/slog"
+	"sort"
+	"time"
+)
+
+// Audit operations reported in AuditEvent.Op
+const (
+	AuditLoad      = "load"
+	AuditSave      = "save"
+	AuditSign      = "sign"
+	AuditKeyAccess = "key_access"
+	AuditDerive    = "derive"
+	AuditExport    = "export"
+	AuditAuthorize = "authorize"
+	AuditMirror    = "mirror"
+)
+
+// AuditEvent describes one use of the keystore. It never contains secret
+// values. Info carries the attribution attached with WithContextInfo.
+type AuditEvent struct {
+	Time    time.Time         `json:"time"`
+	Op      string            `json:"op"`
+	Account string            `json:"account,omitempty"`
+	Address string            `json:"address,omitempty"`
+	Origin  string            `json:"origin,omitempty"`
+	Error   string            `json:"error,omitempty"`
+	Info    map[string]string `json:"info,omitempty"`
+}
+
+// WithContextInfo returns a view of the Store that attaches info, such as
+// component=deployer or request_id=..., to every audit event and log line
+// it produces. The view shares the configuration, backend and unlock state
+// at the time of the call; it keeps its own in-memory copy of the keystore,
+// which is reloaded from the backend on every operation as usual. Info of
+// an existing view is extended, not replaced. The base Store is unaffected.
+func (s *Store) WithContextInfo(info map[string]string) *Store {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	merged := make(map[string]string, len(s.info)+len(info))
+	for k, v := range s.info {
+		merged[k] = v
+	}
+
+	keys := make([]string, 0, len(info))
+	for k, v := range info {
+		merged[k] = v
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	args := make([]any, 0, len(keys))
+	for _, k := range keys {
+		args = append(args, slog.String(k, info[k]))
+	}
+
+	cfg := s.config
+	cfg.Logger = s.config.Logger.With(args...)
+
+	view := &Store{
+		config:   cfg,
+		creds:    s.creds,
+		backend:  s.backend,
+		unlocked: s.unlocked,
+		info:     merged,
+		usage:    s.usage,
+		stats:    s.stats,
+	}
+	view.initShared(s.unlocks)
+	return view
+}
+
+// audit reports an operation to Config.Audit. It is called with the lock
+// held, so the hook must not call back into the Store.
+func (s *Store) audit(op, account string, err error) {
+	s.observe(op, err)
+	if err == nil && (op == AuditSign || op == AuditKeyAccess || op == AuditDerive) {
+		s.recordUse(account)
+	}
+
+	if s.config.Audit == nil {
+		return
+	}
+
+	event := AuditEvent{
+		Time:    s.now(),
+		Op:      op,
+		Account: account,
+		Address: s.auditAddress(account),
+		Info:    s.info,
+	}
+	if op == AuditSign || op == AuditKeyAccess || op == AuditDerive {
+		event.Origin = s.auditProvenance(account)
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+
+	s.config.Audit(event)
+}
+
+// auditAddress returns the in-memory address of the primary key or of a
+// named account, without touching storage.
+func (s *Store) auditAddress(account string) string {
+	if account == "" {
+		return s.Address
+	}
+	if a, ok := s.Accounts[account]; ok {
+		return a.Address
+	}
+	return ""
+}
@@ -0,0 +1,128 @@
+package keystore
+
+import (
+	"fmt"
+	"time"
+)
+
+// Operations that Config.RequireAuthorizationFor can gate, named after the
+// methods they guard. AuthSignTransaction also gates TransactOpts and its
+// signers, and AuthLoadPrivateKey LoadECDSAKey.
+const (
+	AuthSignTransaction  = "SignTransaction"
+	AuthSignDigest       = "SignDigest"
+	AuthSignWithAccount  = "SignWithAccount"
+	AuthGetPrivateKeyHex = "GetPrivateKeyHex"
+	AuthLoadPrivateKey   = "LoadPrivateKey"
+	AuthPrivateKeyBytes  = "PrivateKeyBytes"
+	AuthUpdatePolicy     = "UpdatePolicy"
+
+	AuthExportPaperBackup = "ExportPaperBackup"
+
+	// AuthEnv gates Env, RunWithEnv and WriteDotEnv with EnvPrivateKey.
+	AuthEnv = "Env"
+)
+
+var authOperations = map[string]bool{
+	AuthSignTransaction:  true,
+	AuthSignDigest:       true,
+	AuthSignWithAccount:  true,
+	AuthGetPrivateKeyHex: true,
+	AuthLoadPrivateKey:   true,
+	AuthPrivateKeyBytes:  true,
+	AuthUpdatePolicy:     true,
+
+	AuthExportPaperBackup: true,
+	AuthEnv:               true,
+}
+
+// Authorize obtains fresh approval and opens a window of d during which
+// the operations in Config.RequireAuthorizationFor are allowed. Approval
+// comes from Config.Approve if set, otherwise from re-entering the
+// passphrase through Config.Passphrase, which is checked against the stored
+// key and never taken from the unlock cache. The window lives in this Store
+// only and is not persisted; Lock and a zero or negative d end it.
+func (s *Store) Authorize(d time.Duration) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer func() { s.audit(AuditAuthorize, "", err) }()
+
+	if d <= 0 {
+		s.authorizedUntil = time.Time{}
+		return nil
+	}
+
+	if err := s.approve(); err != nil {
+		return err
+	}
+
+	s.authorizedUntil = s.now().Add(d)
+	return nil
+}
+
+// approve asks for the approval that Authorize needs.
+func (s *Store) approve() error {
+	if s.config.Approve != nil {
+		if err := s.config.Approve(); err != nil {
+			return fmt.Errorf("%w: approval denied: %w", ErrAuthorizationRequired, err)
+		}
+		return nil
+	}
+
+	if s.config.Passphrase == nil {
+		return configError("RequireAuthorizationFor", "authorization needs Approve or a Passphrase provider")
+	}
+
+	if err := s.load(); err != nil && !isNoKeystore(err) {
+		return err
+	}
+	if s.EncryptedKey == nil && s.unlocked == nil {
+		return configError("RequireAuthorizationFor", "authorization by passphrase needs an encrypted private key")
+	}
+
+	passphrase, err := s.config.Passphrase.Passphrase()
+	if err != nil {
+		s.countUnlockFailure()
+		return fmt.Errorf("%w: failed to obtain passphrase: %w", ErrAuthorizationRequired, err)
+	}
+
+	if s.EncryptedKey != nil {
+		plaintext, err := decryptValue(passphrase, s.EncryptedKey)
+		if err != nil {
+			s.countUnlockFailure()
+			return err
+		}
+		wipe(plaintext)
+	} else if passphrase != *s.unlocked {
+		s.countUnlockFailure()
+		return ErrWrongPassphrase
+	}
+	return nil
+}
+
+// authorized fails with ErrAuthorizationRequired if op needs authorization
+// and no Authorize window is open.
+func (s *Store) authorized(op string) error {
+	if !s.requiresAuthorization(op) || s.now().Before(s.authorizedUntil) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrAuthorizationRequired, op)
+}
+
+func (s *Store) requiresAuthorization(op string) bool {
+	for _, required := range s.config.RequireAuthorizationFor {
+		if required == op {
+			return true
+		}
+	}
+	return false
+}
+
+func validateAuthorizationConfig(cfg Config) error {
+	for _, op := range cfg.RequireAuthorizationFor {
+		if !authOperations[op] {
+			return configError("RequireAuthorizationFor", fmt.Sprintf("unknown operation %q", op))
+		}
+	}
+	return nil
+}
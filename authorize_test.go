@@ -0,0 +1,307 @@
+package keystore_test
+
+import (
+	"errors"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/theblitlabs/keystore"
+)
+
+// authorizedOps runs each operation Config.RequireAuthorizationFor can
+// gate against a store holding fileKeyHex as its primary key and account
+// "hot".
+var authorizedOps = []struct {
+	op  string
+	run func(ks *keystore.Store) error
+}{
+	{keystore.AuthSignTransaction, func(ks *keystore.Store) error {
+		tx := types.NewTransaction(0, common.Address{}, big.NewInt(0), 21000, big.NewInt(1), nil)
+		_, err := ks.SignTransaction(tx, big.NewInt(1))
+		return err
+	}},
+	{keystore.AuthSignTransaction, func(ks *keystore.Store) error {
+		_, err := ks.TransactOpts(big.NewInt(1))
+		return err
+	}},
+	{keystore.AuthLoadPrivateKey, func(ks *keystore.Store) error {
+		_, err := ks.LoadECDSAKey()
+		return err
+	}},
+	{keystore.AuthSignDigest, func(ks *keystore.Store) error {
+		_, err := ks.SignDigest(crypto.Keccak256([]byte("authorize")))
+		return err
+	}},
+	{keystore.AuthSignWithAccount, func(ks *keystore.Store) error {
+		_, err := ks.SignWithAccount("hot", crypto.Keccak256([]byte("authorize")))
+		return err
+	}},
+	{keystore.AuthGetPrivateKeyHex, func(ks *keystore.Store) error {
+		_, err := ks.GetPrivateKeyHex()
+		return err
+	}},
+	{keystore.AuthLoadPrivateKey, func(ks *keystore.Store) error {
+		_, err := ks.LoadPrivateKey()
+		return err
+	}},
+	{keystore.AuthPrivateKeyBytes, func(ks *keystore.Store) error {
+		key, err := ks.PrivateKeyBytes()
+		if err == nil {
+			key.Wipe()
+		}
+		return err
+	}},
+	{keystore.AuthUpdatePolicy, func(ks *keystore.Store) error {
+		return ks.UpdatePolicy(&keystore.SigningPolicy{})
+	}},
+	{keystore.AuthExportPaperBackup, func(ks *keystore.Store) error {
+		_, err := ks.ExportPaperBackup("paper passphrase")
+		return err
+	}},
+	{keystore.AuthEnv, func(ks *keystore.Store) error {
+		_, err := ks.Env("APP_", keystore.EnvPrivateKey)
+		return err
+	}},
+}
+
+// newAuthorizeStore returns a store gating ops, approved by approve.
+func newAuthorizeStore(t *testing.T, clock *testClock, approve func() error, ops ...string) *keystore.Store {
+	t.Helper()
+
+	ks, err := keystore.NewKeystore(clock.config(keystore.Config{
+		DirPath:                 t.TempDir(),
+		RequireAuthorizationFor: ops,
+		Approve:                 approve,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveAccount("hot", credentialKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	return ks
+}
+
+func approveAlways() error { return nil }
+
+func TestAuthorizationWindow(t *testing.T) {
+	for _, tt := range authorizedOps {
+		t.Run(tt.op, func(t *testing.T) {
+			clock := newTestClock(epoch)
+			ks := newAuthorizeStore(t, clock, approveAlways, tt.op)
+
+			if err := tt.run(ks); !errors.Is(err, keystore.ErrAuthorizationRequired) {
+				t.Fatalf("before Authorize: got %v, want ErrAuthorizationRequired", err)
+			}
+
+			if err := ks.Authorize(time.Minute); err != nil {
+				t.Fatal(err)
+			}
+			clock.Advance(time.Minute - time.Second)
+			if err := tt.run(ks); err != nil {
+				t.Fatalf("inside the window: %v", err)
+			}
+
+			clock.Advance(time.Second)
+			if err := tt.run(ks); !errors.Is(err, keystore.ErrAuthorizationRequired) {
+				t.Fatalf("after the window: got %v, want ErrAuthorizationRequired", err)
+			}
+		})
+	}
+}
+
+func TestAuthorizationOnlyGatesListedOps(t *testing.T) {
+	ks := newAuthorizeStore(t, newTestClock(epoch), approveAlways, keystore.AuthSignTransaction)
+	for _, tt := range authorizedOps {
+		if tt.op == keystore.AuthSignTransaction {
+			continue
+		}
+		if err := tt.run(ks); err != nil {
+			t.Errorf("%s without authorization: %v", tt.op, err)
+		}
+	}
+}
+
+func TestAuthorizationTransactOpts(t *testing.T) {
+	clock := newTestClock(epoch)
+	ks := newAuthorizeStore(t, clock, approveAlways, keystore.AuthSignTransaction)
+	if err := ks.Authorize(time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	opts, err := ks.TransactOpts(big.NewInt(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := types.NewTransaction(0, common.Address{}, big.NewInt(0), 21000, big.NewInt(1), nil)
+	if _, err := opts.Signer(opts.From, tx); err != nil {
+		t.Fatalf("Signer inside the window: %v", err)
+	}
+
+	// The signer outlives the window it was made in, but does not sign
+	// outside one.
+	clock.Advance(time.Minute)
+	if _, err := opts.Signer(opts.From, tx); !errors.Is(err, keystore.ErrAuthorizationRequired) {
+		t.Fatalf("Signer after the window: got %v, want ErrAuthorizationRequired", err)
+	}
+	if err := ks.Authorize(time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := opts.Signer(opts.From, tx); err != nil {
+		t.Fatalf("Signer in a new window: %v", err)
+	}
+}
+
+func TestAuthorizationEnds(t *testing.T) {
+	tests := []struct {
+		name string
+		end  func(t *testing.T, ks *keystore.Store)
+	}{
+		{name: "Lock", end: func(t *testing.T, ks *keystore.Store) { ks.Lock() }},
+		{name: "zero duration", end: func(t *testing.T, ks *keystore.Store) {
+			if err := ks.Authorize(0); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ks := newAuthorizeStore(t, newTestClock(epoch), approveAlways, keystore.AuthSignDigest)
+			if err := ks.Authorize(time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			tt.end(t, ks)
+			if _, err := ks.SignDigest(crypto.Keccak256([]byte("x"))); !errors.Is(err, keystore.ErrAuthorizationRequired) {
+				t.Fatalf("SignDigest: got %v, want ErrAuthorizationRequired", err)
+			}
+		})
+	}
+}
+
+func TestAuthorizationIsPerStore(t *testing.T) {
+	clock := newTestClock(epoch)
+	ks := newAuthorizeStore(t, clock, approveAlways, keystore.AuthSignDigest)
+	if err := ks.Authorize(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := keystore.NewKeystore(clock.config(keystore.Config{
+		DirPath:                 ks.Dir(),
+		RequireAuthorizationFor: []string{keystore.AuthSignDigest},
+		Approve:                 approveAlways,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.SignDigest(crypto.Keccak256([]byte("x"))); !errors.Is(err, keystore.ErrAuthorizationRequired) {
+		t.Fatalf("another Store: got %v, want ErrAuthorizationRequired", err)
+	}
+}
+
+func TestAuthorizationApproval(t *testing.T) {
+	t.Run("denied", func(t *testing.T) {
+		denied := errors.New("user clicked no")
+		ks := newAuthorizeStore(t, newTestClock(epoch), func() error { return denied }, keystore.AuthSignDigest)
+		err := ks.Authorize(time.Minute)
+		if !errors.Is(err, keystore.ErrAuthorizationRequired) || !errors.Is(err, denied) {
+			t.Fatalf("Authorize: got %v, want ErrAuthorizationRequired wrapping the denial", err)
+		}
+		if _, err := ks.SignDigest(crypto.Keccak256([]byte("x"))); !errors.Is(err, keystore.ErrAuthorizationRequired) {
+			t.Fatalf("SignDigest after a denial: %v", err)
+		}
+	})
+
+	t.Run("passphrase", func(t *testing.T) {
+		dir := t.TempDir()
+		writer, err := keystore.NewKeystore(keystore.Config{DirPath: dir, Passphrase: keystore.StaticPassphrase("right")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.SavePrivateKey(fileKeyHex); err != nil {
+			t.Fatal(err)
+		}
+
+		var prompts atomic.Int32
+		answer := "wrong"
+		ks, err := keystore.NewKeystore(keystore.Config{
+			DirPath:                 dir,
+			RequireAuthorizationFor: []string{keystore.AuthSignDigest},
+			Passphrase: keystore.PassphraseFunc(func() (string, error) {
+				prompts.Add(1)
+				return answer, nil
+			}),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ks.Authorize(time.Minute); !errors.Is(err, keystore.ErrWrongPassphrase) {
+			t.Fatalf("Authorize with a wrong passphrase: got %v, want ErrWrongPassphrase", err)
+		}
+		answer = "right"
+		if err := ks.Authorize(time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ks.SignDigest(crypto.Keccak256([]byte("x"))); err != nil {
+			t.Fatal(err)
+		}
+		// Each approval asks again rather than reusing the unlock cache.
+		before := prompts.Load()
+		if err := ks.Authorize(time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		if prompts.Load() != before+1 {
+			t.Fatalf("Authorize did not prompt again")
+		}
+	})
+
+	t.Run("unknown operation", func(t *testing.T) {
+		_, err := keystore.NewKeystore(keystore.Config{DirPath: t.TempDir(), RequireAuthorizationFor: []string{"ExportPEM"}})
+		if !errors.Is(err, keystore.ErrInvalidConfig) {
+			t.Fatalf("NewKeystore: got %v, want ErrInvalidConfig", err)
+		}
+	})
+}
+
+func TestAuthorizationConcurrentExpiry(t *testing.T) {
+	clock := newTestClock(epoch)
+	ks := newAuthorizeStore(t, clock, approveAlways, keystore.AuthSignDigest)
+	digest := crypto.Keccak256([]byte("x"))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if err := ks.Authorize(time.Second); err != nil {
+					t.Error(err)
+				}
+				clock.Advance(time.Second)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if _, err := ks.SignDigest(digest); err != nil && !errors.Is(err, keystore.ErrAuthorizationRequired) {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	clock.Advance(time.Second)
+	if _, err := ks.SignDigest(digest); !errors.Is(err, keystore.ErrAuthorizationRequired) {
+		t.Fatalf("SignDigest after every window closed: got %v", err)
+	}
+}
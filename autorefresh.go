@@ -0,0 +1,147 @@
+package keystore
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+var (
+	refreshAttempts   = 5
+	refreshBaseDelay  = time.Second
+	refreshMaxBackoff = time.Minute
+
+	// refreshMinInterval is the shortest time between two refreshes, so a
+	// server issuing tokens that live no longer than the lead cannot make
+	// the refresher spin.
+	refreshMinInterval = 30 * time.Second
+)
+
+// RefreshFunc obtains a new token and its lifetime. A zero lifetime uses
+// Config.TokenTTL.
+type RefreshFunc func(ctx context.Context) (string, time.Duration, error)
+
+// StartAutoRefresh runs a background goroutine that calls refresh lead before
+// the stored token expires, persists the new token and repeats until ctx is
+// cancelled. Failed refreshes are retried with jittered exponential backoff;
+// when all attempts fail the error is passed to Config.OnRefreshError and the
+// cycle starts over after a pause. Refreshes are at least 30 seconds apart,
+// even when the new token lives no longer than lead. Only one refresher may
+// run per Store.
+func (s *Store) StartAutoRefresh(ctx context.Context, refresh RefreshFunc, lead time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.refreshing {
+		return ErrAutoRefreshRunning
+	}
+
+	if s.creds.authToken != "" {
+		return fmt.Errorf("auth token is provided by systemd credentials: %w", ErrReadOnly)
+	}
+
+	s.refreshing = true
+	go s.autoRefresh(ctx, refresh, lead)
+	return nil
+}
+
+func (s *Store) autoRefresh(ctx context.Context, refresh RefreshFunc, lead time.Duration) {
+	defer func() {
+		s.mu.Lock()
+		s.refreshing = false
+		s.mu.Unlock()
+	}()
+
+	var last time.Time
+	for {
+		due, cancel := s.NotifyBeforeExpiry(lead)
+		select {
+		case <-ctx.Done():
+			cancel()
+			return
+		case <-due:
+			cancel()
+		}
+
+		if !last.IsZero() {
+			if wait := last.Add(refreshMinInterval).Sub(s.now()); wait > 0 && !s.sleepContext(ctx, wait) {
+				return
+			}
+		}
+		last = s.now()
+
+		if err := s.refreshWithRetry(ctx, refresh, lead); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			if s.config.OnRefreshError != nil {
+				s.config.OnRefreshError(err)
+			}
+
+			if !s.sleepContext(ctx, refreshMaxBackoff) {
+				return
+			}
+		}
+	}
+}
+
+func (s *Store) refreshWithRetry(ctx context.Context, refresh RefreshFunc, lead time.Duration) error {
+	var lastErr error
+
+	for attempt := 0; attempt < refreshAttempts; attempt++ {
+		if attempt > 0 && !s.sleepContext(ctx, backoff(refreshBaseDelay, refreshMaxBackoff, attempt)) {
+			return ctx.Err()
+		}
+
+		token, ttl, err := refresh(ctx)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if ttl <= 0 {
+			err = s.SaveToken(token)
+			ttl = s.tokenTTL()
+		} else {
+			err = s.SaveTokenWithExpiry(token, ttl)
+		}
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if ttl <= lead {
+			s.config.Logger.Warn("keystore: refreshed token expires within the refresh lead", "ttl", ttl, "lead", lead, "min_interval", refreshMinInterval)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("token refresh failed after %d attempts: %w", refreshAttempts, lastErr)
+}
+
+// backoff returns the jittered delay before the given retry attempt: base
+// doubled per attempt, capped at max, scaled by a random factor in [0.5, 1.5).
+func backoff(base, max time.Duration, attempt int) time.Duration {
+	d := base << (attempt - 1)
+	if d <= 0 || d > max {
+		d = max
+	}
+	return time.Duration(float64(d) * (0.5 + rand.Float64()))
+}
+
+// sleepContext waits d on the Store's clock, returning false if ctx is
+// cancelled first.
+func (s *Store) sleepContext(ctx context.Context, d time.Duration) bool {
+	done := make(chan struct{})
+	stop := s.afterFunc(d, func() { close(done) })
+	defer stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-done:
+		return true
+	}
+}
@@ -0,0 +1,100 @@
+package keystore_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/theblitlabs/keystore"
+)
+
+// waitFor polls cond until it holds or a second has passed.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestAutoRefreshShortTTLDoesNotSpin(t *testing.T) {
+	clock := newTestClock(epoch)
+	s, err := keystore.NewKeystore(clock.config(keystore.Config{DirPath: t.TempDir(), Logger: discardLogger}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var calls atomic.Int32
+	refresh := func(ctx context.Context) (string, time.Duration, error) {
+		calls.Add(1)
+		return "token", time.Minute, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := s.StartAutoRefresh(ctx, refresh, 5*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	for want := int32(1); want <= 3; want++ {
+		waitFor(t, "the refresher to wait", func() bool { return calls.Load() == want && clock.Pending() == 1 })
+
+		time.Sleep(20 * time.Millisecond)
+		if got := calls.Load(); got != want {
+			t.Fatalf("refresh called %d times before the clock moved, want %d", got, want)
+		}
+		clock.Advance(30 * time.Second)
+	}
+	waitFor(t, "the refresher to wait", func() bool { return calls.Load() == 4 && clock.Pending() == 1 })
+}
+
+func TestAutoRefreshBeforeExpiry(t *testing.T) {
+	clock := newTestClock(epoch)
+	s, err := keystore.NewKeystore(clock.config(keystore.Config{DirPath: t.TempDir(), Logger: discardLogger}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveTokenWithExpiry("initial", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	var calls atomic.Int32
+	refresh := func(ctx context.Context) (string, time.Duration, error) {
+		calls.Add(1)
+		return "refreshed", time.Hour, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := s.StartAutoRefresh(ctx, refresh, 5*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "the refresher to wait", func() bool { return clock.Pending() == 1 })
+	clock.Advance(54 * time.Minute)
+	time.Sleep(20 * time.Millisecond)
+	if got := calls.Load(); got != 0 {
+		t.Fatalf("refresh called %d times 6 minutes before expiry", got)
+	}
+
+	clock.Advance(time.Minute)
+	waitFor(t, "the refresh", func() bool { return calls.Load() == 1 })
+	waitFor(t, "the refresher to wait", func() bool { return clock.Pending() == 1 })
+
+	token, err := s.LoadToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "refreshed" {
+		t.Errorf("token = %q, want %q", token, "refreshed")
+	}
+}
@@ -0,0 +1,186 @@
+package keystore
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Backend is the storage medium a Store persists its serialized state to.
+// Read must return an error matching fs.ErrNotExist when nothing has been
+// written yet.
+type Backend interface {
+	Read() ([]byte, error)
+	Write(data []byte) error
+	Remove() error
+}
+
+// FileBackend stores the keystore in a single file on disk.
+type FileBackend struct {
+	path string
+}
+
+func NewFileBackend(path string) *FileBackend {
+	return &FileBackend{path: path}
+}
+
+func (b *FileBackend) Path() string {
+	return b.path
+}
+
+func (b *FileBackend) String() string {
+	return b.path
+}
+
+func (b *FileBackend) Read() ([]byte, error) {
+	return os.ReadFile(b.path)
+}
+
+// limitedReader is implemented by backends that can stop reading once more
+// than max bytes would be returned.
+type limitedReader interface {
+	readLimited(max int64) ([]byte, error)
+}
+
+// readLimited reads at most max+1 bytes so oversized files are detected
+// without being loaded in full.
+func (b *FileBackend) readLimited(max int64) ([]byte, error) {
+	f, err := os.Open(b.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return io.ReadAll(io.LimitReader(f, max+1))
+}
+
+// Write replaces the file atomically: data is written and synced to a
+// temporary file in the same directory, which is then renamed over the target.
+func (b *FileBackend) Write(data []byte) error {
+	return writeFileAtomic(b.path, data, DefaultFileMode)
+}
+
+func (b *FileBackend) Remove() error {
+	if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// MemoryBackend keeps the keystore in process memory only.
+type MemoryBackend struct {
+	mu   sync.Mutex
+	data []byte
+	gen  uint64
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{}
+}
+
+func (b *MemoryBackend) String() string {
+	return "memory"
+}
+
+func (b *MemoryBackend) Read() ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.data == nil {
+		return nil, fmt.Errorf("memory backend is empty: %w", fs.ErrNotExist)
+	}
+
+	return append([]byte(nil), b.data...), nil
+}
+
+func (b *MemoryBackend) Write(data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	wipe(b.data)
+	b.data = append([]byte(nil), data...)
+	b.gen++
+	return nil
+}
+
+func (b *MemoryBackend) Remove() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	wipe(b.data)
+	b.data = nil
+	b.gen++
+	return nil
+}
+
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	return writeAtomic(path, mode, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// writeAtomic writes a file through write into a temporary file that
+// replaces path only once complete and synced, so readers never see a
+// partial file.
+func writeAtomic(path string, mode os.FileMode, write func(io.Writer) error) error {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+
+	tmp, err := os.CreateTemp(dir, base+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	cleanup := func(err error) error {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := tmp.Chmod(mode); err != nil {
+		return cleanup(err)
+	}
+
+	if err := write(tmp); err != nil {
+		return cleanup(err)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		return cleanup(err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	syncDir(dir)
+	return nil
+}
+
+// syncDir flushes a directory entry update to disk. Errors are ignored since
+// not every platform supports syncing directories.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
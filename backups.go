@@ -0,0 +1,213 @@
+package keystore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// BackupTimeFormat is the UTC timestamp in backup file names, as in
+	// keystore.json.bak.20240511T120301
+	BackupTimeFormat = "20060102T150405"
+
+	backupInfix = ".bak."
+)
+
+// BackupInfo describes a timestamped backup of the keystore file.
+type BackupInfo struct {
+	Name          string    `json:"name"`
+	Path          string    `json:"path"`
+	CreatedAt     time.Time `json:"created_at"`
+	Size          int64     `json:"size"`
+	SchemaVersion int       `json:"schema_version,omitempty"`
+	Revision      int64     `json:"revision,omitempty"`
+}
+
+// ListBackups returns the keystore's timestamped backups, newest first.
+func (s *Store) ListBackups() ([]BackupInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.config.Backend != nil {
+		return nil, fmt.Errorf("backups: %w", ErrNotFileBacked)
+	}
+	return s.listBackups()
+}
+
+// RestoreBackup replaces the keystore with the named backup, as returned
+// by ListBackups. The current file is backed up first, and backups written
+// by older versions of this package are migrated.
+func (s *Store) RestoreBackup(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.config.Backend != nil {
+		return fmt.Errorf("backups: %w", ErrNotFileBacked)
+	}
+
+	if _, ok := parseBackupName(s.config.FileName, name); !ok || filepath.Base(name) != name {
+		return fmt.Errorf("%w: %q is not a backup name", ErrNoBackup, name)
+	}
+
+	data, err := os.ReadFile(filepath.Join(s.config.DirPath, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: %s", ErrNoBackup, name)
+		}
+		return fmt.Errorf("failed to read backup: %w", err)
+	}
+	defer wipe(data)
+
+	return s.update(func() error {
+		// With retention configured the save backs up the current file.
+		if !s.backupsEnabled() {
+			if err := s.backupCurrent(); err != nil {
+				return err
+			}
+		}
+		return s.loadDocument(data)
+	})
+}
+
+func (s *Store) backupsEnabled() bool {
+	return s.config.Backend == nil && (s.config.BackupRetain > 0 || s.config.BackupMaxAge > 0)
+}
+
+// backupCurrent copies the persisted keystore to a new timestamped backup.
+func (s *Store) backupCurrent() error {
+	data, err := s.readBackend()
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to read keystore for backup: %w", err)
+	}
+	defer wipe(data)
+
+	base := s.path() + backupInfix + s.now().UTC().Format(BackupTimeFormat)
+	path := base
+	for i := 2; ; i++ {
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			break
+		}
+		path = fmt.Sprintf("%s-%d", base, i)
+	}
+
+	if err := writeFileAtomic(path, data, DefaultFileMode); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	return nil
+}
+
+// pruneBackups applies Config.BackupRetain and Config.BackupMaxAge.
+func (s *Store) pruneBackups() {
+	backups, err := s.listBackups()
+	if err != nil {
+		s.config.Logger.Warn("keystore: failed to list backups", "error", err)
+		return
+	}
+
+	now := s.now()
+	for i, b := range backups {
+		excess := s.config.BackupRetain > 0 && i >= s.config.BackupRetain
+		expired := s.config.BackupMaxAge > 0 && now.Sub(b.CreatedAt) > s.config.BackupMaxAge
+		if !excess && !expired {
+			continue
+		}
+		if err := os.Remove(b.Path); err != nil && !os.IsNotExist(err) {
+			s.config.Logger.Warn("keystore: failed to remove backup", "path", b.Path, "error", err)
+		}
+	}
+}
+
+func (s *Store) listBackups() ([]BackupInfo, error) {
+	entries, err := os.ReadDir(s.config.DirPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	backups := []BackupInfo{}
+	for _, entry := range entries {
+		created, ok := parseBackupName(s.config.FileName, entry.Name())
+		if !ok || !entry.Type().IsRegular() {
+			continue
+		}
+
+		b := BackupInfo{
+			Name:      entry.Name(),
+			Path:      filepath.Join(s.config.DirPath, entry.Name()),
+			CreatedAt: created,
+		}
+		if info, err := entry.Info(); err == nil {
+			b.Size = info.Size()
+		}
+		b.SchemaVersion, b.Revision = s.backupHeader(b.Path)
+
+		backups = append(backups, b)
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		if !backups[i].CreatedAt.Equal(backups[j].CreatedAt) {
+			return backups[i].CreatedAt.After(backups[j].CreatedAt)
+		}
+		return backups[i].Name > backups[j].Name
+	})
+	return backups, nil
+}
+
+// parseBackupName returns the time encoded in a backup file name, which is
+// fileName.bak.<timestamp> with an optional -N suffix.
+func parseBackupName(fileName, name string) (time.Time, bool) {
+	stamp, ok := strings.CutPrefix(name, fileName+backupInfix)
+	if !ok {
+		return time.Time{}, false
+	}
+	stamp, _, _ = strings.Cut(stamp, "-")
+
+	created, err := time.Parse(BackupTimeFormat, stamp)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return created, true
+}
+
+// backupHeader reads the schema version and revision of a plaintext
+// backup, reversing any transforms. Encrypted or unreadable backups report zeros.
+func (s *Store) backupHeader(path string) (int, int64) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0
+	}
+	defer wipe(data)
+
+	info, data, err := splitHeader(data)
+	if err != nil {
+		return 0, 0
+	}
+	if data, err = s.decodeTransforms(info, data); err != nil {
+		return 0, 0
+	}
+
+	if data, err = s.documentJSON(data); err != nil {
+		return 0, 0
+	}
+
+	var header struct {
+		Version  int   `json:"version"`
+		Revision int64 `json:"revision"`
+	}
+	if json.Unmarshal(data, &header) != nil {
+		return 0, 0
+	}
+	if header.Version == 0 {
+		header.Version = 1
+	}
+	return header.Version, header.Revision
+}
@@ -0,0 +1,253 @@
+package keystore_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/theblitlabs/keystore"
+	"github.com/theblitlabs/keystore/keystoretest"
+)
+
+func backupNames(t *testing.T, ks *keystore.Store) []string {
+	t.Helper()
+
+	backups, err := ks.ListBackups()
+	if err != nil {
+		t.Fatalf("ListBackups: %v", err)
+	}
+	names := make([]string, len(backups))
+	for i, b := range backups {
+		names[i] = b.Name
+	}
+	return names
+}
+
+func TestBackupRetention(t *testing.T) {
+	const bak = keystore.DefaultFileName + ".bak."
+
+	tests := []struct {
+		name   string
+		retain int
+		maxAge time.Duration
+		saves  []time.Duration // offsets from epoch
+		want   []string
+	}{
+		{
+			name:  "disabled",
+			saves: []time.Duration{0, time.Hour},
+			want:  []string{},
+		},
+		{
+			name:   "first save has nothing to back up",
+			retain: 3,
+			saves:  []time.Duration{0},
+			want:   []string{},
+		},
+		{
+			name:   "by count",
+			retain: 2,
+			saves:  []time.Duration{0, time.Hour, 2 * time.Hour, 3 * time.Hour},
+			want:   []string{bak + "20240101T030000", bak + "20240101T020000"},
+		},
+		{
+			name:   "by age",
+			maxAge: 90 * time.Minute,
+			saves:  []time.Duration{0, time.Hour, 2 * time.Hour, 3 * time.Hour},
+			want:   []string{bak + "20240101T030000", bak + "20240101T020000"},
+		},
+		{
+			name:   "count and age",
+			retain: 1,
+			maxAge: 24 * time.Hour,
+			saves:  []time.Duration{0, time.Hour, 2 * time.Hour},
+			want:   []string{bak + "20240101T020000"},
+		},
+		{
+			name:   "same second",
+			retain: 5,
+			saves:  []time.Duration{0, time.Hour, time.Hour, time.Hour},
+			want:   []string{bak + "20240101T010000-3", bak + "20240101T010000-2", bak + "20240101T010000"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newTestClock(epoch)
+			ks, err := keystore.NewKeystore(clock.config(keystore.Config{
+				DirPath:      t.TempDir(),
+				BackupRetain: tt.retain,
+				BackupMaxAge: tt.maxAge,
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, offset := range tt.saves {
+				clock.Set(epoch.Add(offset))
+				if err := ks.SaveToken("token-" + string(rune('a'+i))); err != nil {
+					t.Fatalf("save %d: %v", i, err)
+				}
+			}
+
+			got := backupNames(t, ks)
+			if len(got) != len(tt.want) {
+				t.Fatalf("backups = %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("backups = %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBackupMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not enforced on Windows")
+	}
+
+	clock := newTestClock(epoch)
+	ks, err := keystore.NewKeystore(clock.config(keystore.Config{DirPath: t.TempDir(), BackupRetain: 2}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		clock.Advance(time.Minute)
+		if err := ks.SaveToken("token"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backups, err := ks.ListBackups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range backups {
+		info, err := os.Stat(b.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode := info.Mode().Perm(); mode != keystore.DefaultFileMode {
+			t.Errorf("%s has mode %o, want %o", b.Name, mode, keystore.DefaultFileMode)
+		}
+		if b.SchemaVersion != keystore.SchemaVersion || b.Revision == 0 {
+			t.Errorf("%s: schema %d revision %d", b.Name, b.SchemaVersion, b.Revision)
+		}
+	}
+}
+
+func TestRestoreBackup(t *testing.T) {
+	dir := t.TempDir()
+	clock := newTestClock(epoch)
+	ks, err := keystore.NewKeystore(clock.config(keystore.Config{DirPath: dir, BackupRetain: 10}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ks.SaveToken("first"); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Minute)
+	if err := ks.SaveToken("second"); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, err := ks.ListBackups()
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("ListBackups = %v, %v", backups, err)
+	}
+
+	clock.Advance(time.Minute)
+	if err := ks.RestoreBackup(backups[0].Name); err != nil {
+		t.Fatalf("RestoreBackup: %v", err)
+	}
+	if token, err := ks.LoadToken(); err != nil || token != "first" {
+		t.Fatalf("LoadToken = %q, %v, want first", token, err)
+	}
+
+	// The file replaced by the restore is kept as a backup too.
+	restored := backupNames(t, ks)
+	if len(restored) != 2 {
+		t.Fatalf("backups after restore = %q", restored)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, restored[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	undoDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(undoDir, keystore.DefaultFileName), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	undo, err := keystore.NewKeystore(clock.config(keystore.Config{DirPath: undoDir}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token, err := undo.LoadToken(); err != nil || token != "second" {
+		t.Fatalf("newest backup holds %q, %v, want second", token, err)
+	}
+}
+
+func TestRestoreBackupMigrates(t *testing.T) {
+	dir := t.TempDir()
+	data, err := fs.ReadFile(keystoretest.Fixtures, "v1.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := keystore.DefaultFileName + ".bak.20231231T000000"
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	clock := newTestClock(epoch)
+	ks, err := keystore.NewKeystore(clock.config(keystore.Config{DirPath: dir}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveToken("current"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ks.RestoreBackup(name); err != nil {
+		t.Fatalf("RestoreBackup: %v", err)
+	}
+	if token, err := ks.LoadToken(); err != nil || token != "conformance-token" {
+		t.Fatalf("LoadToken = %q, %v", token, err)
+	}
+	if _, err := ks.LoadPrivateKey(); err != nil {
+		t.Fatalf("LoadPrivateKey: %v", err)
+	}
+	if ks.Version != keystore.SchemaVersion {
+		t.Fatalf("restored schema version %d, want %d", ks.Version, keystore.SchemaVersion)
+	}
+}
+
+func TestRestoreBackupErrors(t *testing.T) {
+	ks, err := keystore.NewKeystore(keystore.Config{DirPath: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{
+		keystore.DefaultFileName,
+		keystore.DefaultFileName + ".bak.20240101T000000",
+		"../" + keystore.DefaultFileName + ".bak.20240101T000000",
+		keystore.DefaultFileName + ".bak.yesterday",
+	} {
+		if err := ks.RestoreBackup(name); !errors.Is(err, keystore.ErrNoBackup) {
+			t.Errorf("RestoreBackup(%q): got %v, want ErrNoBackup", name, err)
+		}
+	}
+
+	mem, err := keystore.NewKeystore(keystore.Config{Backend: keystore.NewMemoryBackend()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mem.ListBackups(); !errors.Is(err, keystore.ErrNotFileBacked) {
+		t.Fatalf("ListBackups: got %v, want ErrNotFileBacked", err)
+	}
+}
@@ -0,0 +1,230 @@
+package keystore
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"runtime"
+	"sync"
+
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+)
+
+// batchParallelMin is the smallest batch that SignDigests spreads over
+// several workers.
+const batchParallelMin = 64
+
+// Signer signs batches of digests with a key pinned by Store.BatchSigner.
+// It is safe for concurrent use.
+type Signer struct {
+	store    *Store
+	external ExternalSigner
+	workers  int
+
+	mu     sync.RWMutex
+	key    *ecdsa.PrivateKey
+	closed bool
+	stop   func() bool
+}
+
+// BatchSigner decrypts the primary key once and pins a copy of it for
+// signing many digests without the per-call cost of SignDigest. The copy is
+// wiped when the signer is closed, when ctx is done and when the Store is
+// locked. With Config.Signer, digests are passed to the external signer one
+// at a time instead.
+func (s *Store) BatchSigner(ctx context.Context) (sg *Signer, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer func() { s.audit(AuditKeyAccess, "", err) }()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := s.authorized(AuthSignDigest); err != nil {
+		return nil, err
+	}
+
+	sg = &Signer{store: s, external: s.config.Signer, workers: s.config.BatchSignWorkers}
+	if sg.external != nil {
+		if err := s.checkFrozen(); err != nil {
+			return nil, err
+		}
+		if err := s.checkLease(); err != nil {
+			return nil, err
+		}
+	} else {
+		key, _, err := s.primaryKey()
+		if err != nil {
+			return nil, err
+		}
+		if err := s.checkSigningKey(""); err != nil {
+			return nil, err
+		}
+		if err := s.allowDigests(""); err != nil {
+			return nil, err
+		}
+
+		// The signer owns its copy, so wiping it leaves the key cache alone.
+		b := ethcrypto.FromECDSA(key)
+		sg.key, err = ethcrypto.ToECDSA(b)
+		wipe(b)
+		if err != nil {
+			return nil, fmt.Errorf("failed to pin private key: %w", err)
+		}
+	}
+
+	if s.signers == nil {
+		s.signers = make(map[*Signer]struct{})
+	}
+	s.signers[sg] = struct{}{}
+	sg.stop = context.AfterFunc(ctx, func() { sg.Close() })
+	return sg, nil
+}
+
+// SignDigests signs each 32-byte digest and returns the signatures in the
+// same order, in the format SignDigest uses. Batches of batchParallelMin
+// digests or more are spread over Config.BatchSignWorkers goroutines. One
+// digest that cannot be signed fails the whole batch. Each batch is checked
+// against Config.RequireAuthorizationFor and audited as a single AuditSign
+// event.
+func (sg *Signer) SignDigests(digests [][]byte) (sigs [][]byte, err error) {
+	s := sg.store
+
+	s.mu.Lock()
+	err = s.authorized(AuthSignDigest)
+	if err == nil {
+		// The pinned key outlives the freeze and lease checks of
+		// BatchSigner.
+		err = s.checkFrozen()
+	}
+	if err == nil {
+		err = s.checkLease()
+	}
+	s.mu.Unlock()
+
+	if err == nil {
+		sigs, err = sg.sign(digests)
+	}
+
+	s.mu.Lock()
+	s.audit(AuditSign, "", err)
+	s.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+	return sigs, nil
+}
+
+func (sg *Signer) sign(digests [][]byte) ([][]byte, error) {
+	sg.mu.RLock()
+	defer sg.mu.RUnlock()
+
+	if sg.closed {
+		return nil, ErrSignerClosed
+	}
+
+	sigs := make([][]byte, len(digests))
+	signOne := func(i int) error {
+		var err error
+		if sg.external != nil {
+			sigs[i], err = sg.external.SignDigest(digests[i])
+		} else {
+			sigs[i], err = ethcrypto.Sign(digests[i], sg.key)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to sign digest %d: %w", i, err)
+		}
+		return nil
+	}
+
+	workers := sg.workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if sg.external != nil || workers == 1 || len(digests) < batchParallelMin {
+		for i := range digests {
+			if err := signOne(i); err != nil {
+				return nil, err
+			}
+		}
+		return sigs, nil
+	}
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+		next     = make(chan int)
+	)
+	for w := 0; w < min(workers, len(digests)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if err := signOne(i); err != nil {
+					errOnce.Do(func() { firstErr = err })
+				}
+			}
+		}()
+	}
+	for i := range digests {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return sigs, nil
+}
+
+// Close wipes the pinned key. Later calls to SignDigests fail with
+// ErrSignerClosed. Closing twice is a no-op.
+func (sg *Signer) Close() error {
+	sg.close()
+
+	s := sg.store
+	s.mu.Lock()
+	delete(s.signers, sg)
+	s.mu.Unlock()
+	return nil
+}
+
+// close wipes the key without touching the Store, so that Store.Lock can
+// call it while holding the Store mutex. SignDigests never holds the
+// signer's lock while waiting for the Store's.
+func (sg *Signer) close() {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+
+	if sg.closed {
+		return
+	}
+	sg.closed = true
+	if sg.stop != nil {
+		sg.stop()
+	}
+	if sg.key != nil {
+		wipeECDSA(sg.key)
+		sg.key = nil
+	}
+}
+
+// closeSigners closes every open batch signer. The caller holds s.mu.
+func (s *Store) closeSigners() {
+	for sg := range s.signers {
+		sg.close()
+	}
+	s.signers = nil
+}
+
+// wipeECDSA zeroes the private scalar of key in place.
+func wipeECDSA(key *ecdsa.PrivateKey) {
+	words := key.D.Bits()
+	for i := range words {
+		words[i] = 0
+	}
+	key.D.SetInt64(0)
+}
@@ -0,0 +1,174 @@
+package keystore_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/theblitlabs/keystore"
+)
+
+func newBatchStore(tb testing.TB, workers int) *keystore.Store {
+	tb.Helper()
+
+	ks, err := keystore.NewKeystore(keystore.Config{DirPath: tb.TempDir(), BatchSignWorkers: workers})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		tb.Fatal(err)
+	}
+	return ks
+}
+
+func digests(n int) [][]byte {
+	ds := make([][]byte, n)
+	for i := range ds {
+		ds[i] = crypto.Keccak256([]byte(fmt.Sprintf("message %d", i)))
+	}
+	return ds
+}
+
+func TestBatchSignerOrder(t *testing.T) {
+	tests := []struct {
+		workers int
+		batch   int
+	}{
+		{workers: 1, batch: 1},
+		{workers: 1, batch: 100},
+		{workers: 4, batch: 63},
+		{workers: 4, batch: 64},
+		{workers: 4, batch: 500},
+		{workers: 16, batch: 65},
+		{workers: 0, batch: 257},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d workers %d digests", tt.workers, tt.batch), func(t *testing.T) {
+			ks := newBatchStore(t, tt.workers)
+			sg, err := ks.BatchSigner(context.Background())
+			if err != nil {
+				t.Fatalf("BatchSigner: %v", err)
+			}
+			defer sg.Close()
+
+			ds := digests(tt.batch)
+			sigs, err := sg.SignDigests(ds)
+			if err != nil {
+				t.Fatalf("SignDigests: %v", err)
+			}
+			if len(sigs) != len(ds) {
+				t.Fatalf("got %d signatures for %d digests", len(sigs), len(ds))
+			}
+
+			// Signatures are deterministic, so each must be the one
+			// SignDigest makes for the digest at the same index.
+			for i, d := range ds {
+				want, err := ks.SignDigest(d)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(sigs[i], want) {
+					t.Fatalf("signature %d does not belong to digest %d", i, i)
+				}
+			}
+		})
+	}
+}
+
+func TestBatchSignerBadDigest(t *testing.T) {
+	for _, at := range []int{0, 10, 99} {
+		t.Run(fmt.Sprint(at), func(t *testing.T) {
+			ks := newBatchStore(t, 4)
+			sg, err := ks.BatchSigner(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sg.Close()
+
+			ds := digests(100)
+			ds[at] = ds[at][:31]
+			if sigs, err := sg.SignDigests(ds); err == nil || sigs != nil {
+				t.Fatalf("SignDigests with a short digest = %d signatures, %v", len(sigs), err)
+			}
+		})
+	}
+}
+
+func TestBatchSignerClosed(t *testing.T) {
+	tests := []struct {
+		name  string
+		close func(ks *keystore.Store, sg *keystore.Signer, cancel context.CancelFunc)
+	}{
+		{name: "Close", close: func(_ *keystore.Store, sg *keystore.Signer, _ context.CancelFunc) { sg.Close() }},
+		{name: "Close twice", close: func(_ *keystore.Store, sg *keystore.Signer, _ context.CancelFunc) {
+			sg.Close()
+			sg.Close()
+		}},
+		{name: "context canceled", close: func(_ *keystore.Store, _ *keystore.Signer, cancel context.CancelFunc) { cancel() }},
+		{name: "Store locked", close: func(ks *keystore.Store, _ *keystore.Signer, _ context.CancelFunc) { ks.Lock() }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ks := newBatchStore(t, 1)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			sg, err := ks.BatchSigner(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.close(ks, sg, cancel)
+
+			waitFor(t, "the signer to close", func() bool {
+				_, err := sg.SignDigests(digests(1))
+				return errors.Is(err, keystore.ErrSignerClosed)
+			})
+		})
+	}
+
+	ks := newBatchStore(t, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ks.BatchSigner(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("BatchSigner with a canceled context: got %v, want context.Canceled", err)
+	}
+}
+
+func BenchmarkSignDigest(b *testing.B) {
+	ks := newBatchStore(b, 0)
+	ds := digests(1024)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ks.SignDigest(ds[i%len(ds)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBatchSigner(b *testing.B) {
+	for _, workers := range []int{1, 0} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			ks := newBatchStore(b, workers)
+			sg, err := ks.BatchSigner(context.Background())
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer sg.Close()
+			ds := digests(1024)
+
+			// b.N counts digests, as in BenchmarkSignDigest.
+			b.ResetTimer()
+			for n := b.N; n > 0; n -= len(ds) {
+				if _, err := sg.SignDigests(ds[:min(n, len(ds))]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
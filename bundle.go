@@ -0,0 +1,236 @@
+package keystore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// BundleFormat identifies keystore bundle files
+const BundleFormat = "keystore-bundle"
+
+const bundleVersion = 1
+
+// BundleContents selects what ExportBundle includes.
+type BundleContents int
+
+const (
+	// BundlePrimaryKey includes the primary key
+	BundlePrimaryKey BundleContents = 1 << iota
+
+	// BundleAccounts includes named and watch-only accounts
+	BundleAccounts
+
+	// BundleToken includes the auth token and its expiry
+	BundleToken
+
+	// BundleAll includes everything
+	BundleAll = BundlePrimaryKey | BundleAccounts | BundleToken
+)
+
+// bundleFile is the on-disk form of a bundle. Payload is a keystore document
+// with plaintext secrets, encrypted as a whole; GCM authentication detects
+// both wrong passphrases and tampered or truncated payloads.
+type bundleFile struct {
+	Format    string          `json:"format"`
+	Version   int             `json:"version"`
+	CreatedAt int64           `json:"created_at"`
+	Payload   *EncryptedValue `json:"payload"`
+}
+
+// ExportBundle writes the selected contents of the keystore to a single
+// passphrase-encrypted file at path, suitable for backing up or moving to
+// another machine with ImportBundle. Encrypted keys are decrypted first, so
+// the Store must be unlocked. An existing file at path is never overwritten.
+func (s *Store) ExportBundle(path, passphrase string, include BundleContents, opts ...ExportOption) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer func() { s.audit(AuditExport, "", err) }()
+
+	if err := s.redeemExport("ExportBundle", ExportScopeFull, opts); err != nil {
+		return err
+	}
+
+	if passphrase == "" {
+		return fmt.Errorf("%w: bundle passphrase", ErrEmptyPassphrase)
+	}
+
+	if _, err := os.Lstat(path); err == nil {
+		return fmt.Errorf("%w: %s", ErrExportExists, path)
+	}
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	if err := s.frozenError(); err != nil {
+		return err
+	}
+
+	bundle, err := s.bundleState(include)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal((*storeJSON)(bundle))
+	if err != nil {
+		return fmt.Errorf("failed to marshal bundle: %w", err)
+	}
+	defer wipe(payload)
+
+	ev, err := encryptValue(passphrase, payload)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt bundle: %w", err)
+	}
+
+	data, err := json.MarshalIndent(bundleFile{
+		Format:    BundleFormat,
+		Version:   bundleVersion,
+		CreatedAt: s.now().Unix(),
+		Payload:   ev,
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal bundle: %w", err)
+	}
+
+	if err := writeFileAtomic(path, data, DefaultFileMode); err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+
+	return nil
+}
+
+// bundleState returns a detached Store holding the selected contents with
+// every secret in plaintext.
+func (s *Store) bundleState(include BundleContents) (*Store, error) {
+	b := &Store{Version: SchemaVersion}
+
+	if include&BundlePrimaryKey != 0 && (s.persisted.PrivateKey != "" || s.EncryptedKey != nil) {
+		privateKeyHex, err := s.privateKeyHex()
+		if err != nil {
+			return nil, err
+		}
+		b.persisted.PrivateKey = privateKeyHex
+		b.Address = s.Address
+		b.PublicKey = s.PublicKey
+		b.KeyCurve = s.KeyCurve
+		b.KeyPurpose = s.KeyPurpose
+		b.ChainID = s.ChainID
+		b.NetworkName = s.NetworkName
+	}
+
+	if include&BundleAccounts != 0 && len(s.Accounts) > 0 {
+		b.Accounts = make(map[string]*Account, len(s.Accounts))
+		for name, account := range s.Accounts {
+			copied := &Account{
+				Address:     account.Address,
+				WatchOnly:   account.WatchOnly,
+				CreatedAt:   account.CreatedAt,
+				Labels:      copyLabels(account.Labels),
+				ChainID:     account.ChainID,
+				NetworkName: account.NetworkName,
+				Purpose:     account.Purpose,
+			}
+			if !account.WatchOnly {
+				privateKeyHex, err := s.openKey(account.PrivateKey, account.EncryptedKey)
+				if err != nil {
+					return nil, fmt.Errorf("failed to read account %q: %w", name, err)
+				}
+				copied.PrivateKey = privateKeyHex
+			}
+			b.Accounts[name] = copied
+		}
+		b.DefaultAccount = s.DefaultAccount
+		b.EncryptionAccount = s.EncryptionAccount
+	}
+
+	if include&BundleToken != 0 {
+		token, err := s.storedToken()
+		if err != nil {
+			return nil, err
+		}
+		if token != nil {
+			b.persisted.AuthToken = token.value
+			b.persisted.CreatedAt = token.createdAt
+			b.ExpiresAt = token.expiresAt
+		}
+	}
+
+	return b, nil
+}
+
+// ImportBundle restores a bundle written by ExportBundle, resolving entries
+// that conflict with local ones by strategy as Merge does. The bundle is
+// fully decrypted and verified before anything local is modified, and all
+// changes are applied in a single write. Secrets are re-encrypted with this
+// Store's settings.
+func (s *Store) ImportBundle(path, passphrase string, strategy ConflictStrategy) (ImportReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := ImportReport{Imported: []ImportEntry{}, Skipped: []ImportEntry{}, Failed: []ImportEntry{}}
+
+	bundle, err := s.readBundle(path, passphrase)
+	if err != nil {
+		return report, err
+	}
+
+	merged, err := s.mergeStore(bundle, strategy, path)
+
+	for _, e := range merged.Added {
+		report.Imported = append(report.Imported, ImportEntry{Source: path, Name: e.Item, Reason: e.Reason})
+	}
+	for _, e := range merged.Skipped {
+		report.Skipped = append(report.Skipped, ImportEntry{Source: path, Name: e.Item, Reason: e.Reason})
+	}
+	for _, e := range merged.Conflicts {
+		entry := ImportEntry{Source: path, Name: e.Item, Reason: e.Reason}
+		switch {
+		case strategy == PreferOther && err == nil:
+			report.Imported = append(report.Imported, entry)
+		case strategy == PreferLocal:
+			report.Skipped = append(report.Skipped, entry)
+		default:
+			report.Failed = append(report.Failed, entry)
+		}
+	}
+
+	return report, err
+}
+
+// readBundle decrypts the bundle at path into a detached Store.
+func (s *Store) readBundle(path, passphrase string) (*Store, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle: %w", err)
+	}
+
+	var file bundleFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+
+	if file.Format != BundleFormat || file.Payload == nil {
+		return nil, fmt.Errorf("%w: not a keystore bundle", ErrInvalidBundle)
+	}
+
+	if file.Version > bundleVersion {
+		return nil, fmt.Errorf("%w: bundle version %d", ErrUnsupportedVersion, file.Version)
+	}
+
+	payload, err := decryptValue(passphrase, file.Payload)
+	if err != nil {
+		if errors.Is(err, ErrWrongPassphrase) {
+			return nil, fmt.Errorf("%w or corrupted bundle", ErrWrongPassphrase)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+	defer wipe(payload)
+
+	bundle := &Store{config: Config{Now: s.config.Now, Logger: s.config.Logger}}
+	if err := json.Unmarshal(payload, (*storeJSON)(bundle)); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+
+	return bundle, nil
+}
@@ -0,0 +1,116 @@
+package keystore_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/theblitlabs/keystore"
+)
+
+func TestImportBundleDamaged(t *testing.T) {
+	bundleDir := t.TempDir()
+	bundlePath := filepath.Join(bundleDir, "bundle")
+	source := newErrorStore(t, keystore.Config{})
+	if err := source.SaveAccount("payroll", envKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.SaveToken("bundled token"); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.ExportBundle(bundlePath, "bundle passphrase", keystore.BundleAll); err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := os.ReadFile(bundlePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, keystore.DefaultFileName)
+	ks := newErrorStore(t, keystore.Config{DirPath: dir})
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveAccount("ops", credentialKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveToken("local token"); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts, err := ks.ListAccounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A payload cut short inside the JSON still parses, and GCM rejects it.
+	var file map[string]any
+	if err := json.Unmarshal(bundle, &file); err != nil {
+		t.Fatal(err)
+	}
+	payload := file["payload"].(map[string]any)
+	payload["ciphertext"] = payload["ciphertext"].(string)[:len(payload["ciphertext"].(string))-2]
+	shortPayload, err := json.Marshal(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name       string
+		data       []byte
+		passphrase string
+		want       error
+	}{
+		{"empty", nil, "bundle passphrase", keystore.ErrInvalidBundle},
+		{"truncated header", bundle[:16], "bundle passphrase", keystore.ErrInvalidBundle},
+		{"truncated half way", bundle[:len(bundle)/2], "bundle passphrase", keystore.ErrInvalidBundle},
+		{"truncated last byte", bundle[:len(bundle)-1], "bundle passphrase", keystore.ErrInvalidBundle},
+		{"truncated payload", shortPayload, "bundle passphrase", keystore.ErrWrongPassphrase},
+		{"wrong passphrase", bundle, "wrong passphrase", keystore.ErrWrongPassphrase},
+	} {
+		damaged := filepath.Join(t.TempDir(), "bundle")
+		if err := os.WriteFile(damaged, tt.data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		report, err := ks.ImportBundle(damaged, tt.passphrase, keystore.PreferOther)
+		if !errors.Is(err, tt.want) {
+			t.Fatalf("%s: ImportBundle: got %v, want %v", tt.name, err, tt.want)
+		}
+		if len(report.Imported) != 0 {
+			t.Fatalf("%s: ImportBundle reported %d imported entries", tt.name, len(report.Imported))
+		}
+
+		// Nothing local changed, on disk or as the Store sees it.
+		if data, err := os.ReadFile(path); err != nil || !bytes.Equal(data, before) {
+			t.Fatalf("%s: the keystore file changed: %v", tt.name, err)
+		}
+		if got, err := ks.ListAccounts(); err != nil || !reflect.DeepEqual(got, accounts) {
+			t.Fatalf("%s: ListAccounts = %v, %v, want %v", tt.name, got, err, accounts)
+		}
+		if key, err := ks.GetPrivateKeyHex(); err != nil || key != fileKeyHex {
+			t.Fatalf("%s: GetPrivateKeyHex = %v, want the original key", tt.name, err)
+		}
+		if token, err := ks.LoadToken(); err != nil || token != "local token" {
+			t.Fatalf("%s: LoadToken = %q, %v", tt.name, token, err)
+		}
+	}
+
+	// The intact bundle still imports.
+	if _, err := ks.ImportBundle(bundlePath, "bundle passphrase", keystore.PreferOther); err != nil {
+		t.Fatalf("ImportBundle: %v", err)
+	}
+	if key, err := ks.LoadAccountKey("payroll"); err != nil || hexKey(key) != envKeyHex {
+		t.Fatalf("LoadAccountKey of the imported account: %v", err)
+	}
+	if token, err := ks.LoadToken(); err != nil || token != "bundled token" {
+		t.Fatalf("LoadToken after the import = %q, %v", token, err)
+	}
+}
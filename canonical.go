@@ -0,0 +1,142 @@
+package keystore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// canonicalIndent is the indentation of keystore files.
+const canonicalIndent = "  "
+
+// Canonicalize rewrites a JSON keystore document in the canonical form
+// every save writes: object keys sorted at every level, two-space
+// indentation, no HTML escaping, integers in plain decimal and other
+// numbers in their shortest round-tripping form. Two Stores saving the
+// same state write the same bytes whatever the field order of the struct,
+// the map iteration order or the release, so files can be deduplicated by
+// content. Timestamps are stored as integers, so no float or time
+// formatting is involved. Files written before the canonical form are
+// read as before, and rewritten in it by their next save.
+func Canonicalize(data []byte) ([]byte, error) {
+	doc, err := decodeDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	return canonicalDocument(doc)
+}
+
+// canonicalDocument encodes a decoded document in the canonical form of
+// keystore files.
+func canonicalDocument(doc any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeCanonical(&buf, doc, canonicalIndent, 0); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// canonicalJSON encodes a decoded JSON value reproducibly, as Canonicalize
+// does but without insignificant whitespace. Manifests sign this form of
+// the document, so they do not depend on how the file is formatted.
+func canonicalJSON(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeCanonical(&buf, v, "", 0); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeCanonical writes v at the given nesting depth. An empty indent
+// writes no whitespace at all.
+func writeCanonical(buf *bytes.Buffer, v any, indent string, depth int) error {
+	newline := func(depth int) {
+		if indent != "" {
+			buf.WriteByte('\n')
+			buf.WriteString(strings.Repeat(indent, depth))
+		}
+	}
+
+	switch v := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			buf.WriteString(strconv.FormatInt(i, 10))
+			return nil
+		}
+		if !strings.ContainsAny(string(v), ".eE") {
+			// Integers beyond 64 bits, such as policy limits in wei, are
+			// kept exact.
+			buf.WriteString(string(v))
+			return nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return fmt.Errorf("invalid number %q", v)
+		}
+		buf.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
+	case string:
+		enc := json.NewEncoder(buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		buf.Truncate(buf.Len() - 1) // Encode appends a newline
+	case []any:
+		if len(v) == 0 {
+			buf.WriteString("[]")
+			return nil
+		}
+		buf.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			newline(depth + 1)
+			if err := writeCanonical(buf, item, indent, depth+1); err != nil {
+				return err
+			}
+		}
+		newline(depth)
+		buf.WriteByte(']')
+	case map[string]any:
+		if len(v) == 0 {
+			buf.WriteString("{}")
+			return nil
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			newline(depth + 1)
+			if err := writeCanonical(buf, k, indent, depth+1); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if indent != "" {
+				buf.WriteByte(' ')
+			}
+			if err := writeCanonical(buf, v[k], indent, depth+1); err != nil {
+				return err
+			}
+		}
+		newline(depth)
+		buf.WriteByte('}')
+	default:
+		return fmt.Errorf("cannot canonicalize %T", v)
+	}
+	return nil
+}
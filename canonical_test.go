@@ -0,0 +1,275 @@
+package keystore_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"flag"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/theblitlabs/keystore"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the canonical golden files in keystoretest/testdata")
+
+// canonicalMaxValue is a policy limit in wei beyond 64 bits, which float64
+// cannot hold exactly.
+const canonicalMaxValue = "120000000000000000000000000001"
+
+// buildCanonicalKeystore saves the same state in cfg at the test epoch,
+// doing the order-independent steps in reverse if reverse is set.
+func buildCanonicalKeystore(t *testing.T, cfg keystore.Config, reverse bool) *keystore.Store {
+	t.Helper()
+
+	ks := newErrorStore(t, newTestClock(epoch).config(cfg))
+	if err := ks.SaveTokenWithExpiry("canonical-token", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+
+	maxValue, _ := new(big.Int).SetString(canonicalMaxValue, 10)
+	steps := []func() error{
+		func() error { return ks.SaveAccount("ops", credentialKeyHex) },
+		func() error { return ks.SaveAccount("payroll", envKeyHex) },
+		func() error { return ks.SaveWatchAddress("cold", dumpWatchAddress) },
+		func() error { return ks.SetAccountLabel("ops", "team", "<infra & ops>") },
+		func() error { return ks.SetAccountLabel("ops", "role", "deploy") },
+		func() error { return ks.SetAccountLabel("payroll", "team", "finance") },
+		func() error {
+			value := "-----BEGIN CERTIFICATE-----\n<chain>\n"
+			return ks.PutSecret("chain.pem", strings.NewReader(value), int64(len(value)))
+		},
+		func() error {
+			return ks.UpdatePolicy(&keystore.SigningPolicy{Accounts: map[string]keystore.AccountPolicy{
+				"ops":     {MaxValue: maxValue},
+				"payroll": {MaxValue: big.NewInt(1)},
+			}})
+		},
+	}
+	// Accounts are reordered among themselves and stay first, so labels
+	// have accounts to go on.
+	if reverse {
+		for i, j := 0, 2; i < j; i, j = i+1, j-1 {
+			steps[i], steps[j] = steps[j], steps[i]
+		}
+		for i, j := 3, len(steps)-1; i < j; i, j = i+1, j-1 {
+			steps[i], steps[j] = steps[j], steps[i]
+		}
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ks
+}
+
+// readKeystoreFile returns the named file in dir.
+func readKeystoreFile(t *testing.T, dir, name string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// assertCanonical fails unless data is in the canonical form.
+func assertCanonical(t *testing.T, name string, data []byte) {
+	t.Helper()
+
+	canonical, err := keystore.Canonicalize(data)
+	if err != nil {
+		t.Fatalf("Canonicalize(%s): %v", name, err)
+	}
+	if !bytes.Equal(canonical, data) {
+		t.Fatalf("%s is not canonical:\n%s\n---\n%s", name, data, canonical)
+	}
+}
+
+// assertGolden compares data with the golden file name in
+// keystoretest/testdata, rewriting it under -update.
+func assertGolden(t *testing.T, name string, data []byte) {
+	t.Helper()
+
+	path := filepath.Join("keystoretest", "testdata", name)
+	if *updateGolden {
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	golden, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v; run go test -run %s -update to create it", err, t.Name())
+	}
+	if !bytes.Equal(data, golden) {
+		t.Fatalf("%s changed; files written by earlier releases would differ:\n%s\n--- golden\n%s", name, data, golden)
+	}
+}
+
+func TestCanonicalFiles(t *testing.T) {
+	var first []byte
+	for i := 0; i < 20; i++ {
+		dir := t.TempDir()
+		buildCanonicalKeystore(t, keystore.Config{DirPath: dir}, i%2 == 1)
+		data := readKeystoreFile(t, dir, keystore.DefaultFileName)
+		if first == nil {
+			first = data
+			assertCanonical(t, keystore.DefaultFileName, data)
+			continue
+		}
+		if !bytes.Equal(data, first) {
+			t.Fatalf("keystore %d differs from the first:\n%s\n---\n%s", i, data, first)
+		}
+	}
+
+	// Values are written as they are: big integers exactly, HTML unescaped.
+	for _, want := range []string{`"max_value": ` + canonicalMaxValue, `"<infra & ops>"`} {
+		if !bytes.Contains(first, []byte(want)) {
+			t.Errorf("keystore file lacks %s:\n%s", want, first)
+		}
+	}
+
+	// A Store resaving the file, as any later release does, keeps it
+	// canonical.
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, keystore.DefaultFileName), first, keystore.DefaultFileMode); err != nil {
+		t.Fatal(err)
+	}
+	ks := newErrorStore(t, newTestClock(epoch).config(keystore.Config{DirPath: dir}))
+	if err := ks.SaveTokenWithExpiry("canonical-token", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	assertCanonical(t, "the resaved file", readKeystoreFile(t, dir, keystore.DefaultFileName))
+}
+
+func TestCanonicalSplitFiles(t *testing.T) {
+	var key, token []byte
+	for i := 0; i < 10; i++ {
+		dir := t.TempDir()
+		buildCanonicalKeystore(t, keystore.Config{DirPath: dir, SplitFiles: true}, i%2 == 1)
+		k := readKeystoreFile(t, dir, keystore.DefaultKeyFileName)
+		tok := readKeystoreFile(t, dir, keystore.DefaultTokenFileName)
+		if key == nil {
+			key, token = k, tok
+			assertCanonical(t, keystore.DefaultKeyFileName, k)
+			assertCanonical(t, keystore.DefaultTokenFileName, tok)
+			continue
+		}
+		if !bytes.Equal(k, key) || !bytes.Equal(tok, token) {
+			t.Fatalf("split keystore %d differs from the first", i)
+		}
+	}
+}
+
+func TestCanonicalize(t *testing.T) {
+	const want = `{
+  "a": 100,
+  "b": 1,
+  "c": 1.5,
+  "d": 120000000000000000000000000001,
+  "e": "<&>",
+  "f": [],
+  "g": {},
+  "h": [
+    {
+      "x": null,
+      "y": true
+    }
+  ]
+}`
+	for _, in := range []string{
+		`{"h":[{"y":true,"x":null}],"g":{},"f":[],"e":"<&>","d":120000000000000000000000000001,"c":1.5,"b":1.0,"a":1e2}`,
+		"{\n\t\"a\": 100,\n\t\"b\": 1,\n\t\"c\": 1.50,\n\t\"d\": 120000000000000000000000000001,\n\t\"e\": \"\\u003c\\u0026\\u003e\",\n\t\"f\": [ ],\n\t\"g\": { },\n\t\"h\": [{\"x\": null, \"y\": true}]\n}\n",
+		want,
+	} {
+		// The same input gives the same bytes every time.
+		for i := 0; i < 50; i++ {
+			got, err := keystore.Canonicalize([]byte(in))
+			if err != nil {
+				t.Fatalf("Canonicalize(%s): %v", in, err)
+			}
+			if string(got) != want {
+				t.Fatalf("Canonicalize(%s) =\n%s\nwant\n%s", in, got, want)
+			}
+		}
+	}
+
+	for _, in := range []string{"", "null", "[]", `{"a":`, `{"a":1}{`, `{"a":1} 2`} {
+		if _, err := keystore.Canonicalize([]byte(in)); err == nil {
+			t.Errorf("Canonicalize(%q) succeeded", in)
+		}
+	}
+}
+
+func TestCanonicalGolden(t *testing.T) {
+	dir := t.TempDir()
+	buildCanonicalKeystore(t, keystore.Config{DirPath: dir}, false)
+	assertGolden(t, "canonical.json", readKeystoreFile(t, dir, keystore.DefaultFileName))
+
+	// Files from earlier releases convert to the same bytes in every
+	// release.
+	for _, name := range []string{"v1.json", "v2.json"} {
+		data, err := os.ReadFile(filepath.Join("keystoretest", "testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		canonical, err := keystore.Canonicalize(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertGolden(t, strings.TrimSuffix(name, ".json")+".canonical.json", canonical)
+	}
+}
+
+func TestCanonicalManifest(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	buildCanonicalKeystore(t, keystore.Config{DirPath: dir}, false)
+	signed, err := keystore.SignManifest(readKeystoreFile(t, dir, keystore.DefaultFileName), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The signature covers the content, not its formatting.
+	var tabs, compact bytes.Buffer
+	if err := json.Indent(&tabs, signed, "", "\t"); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Compact(&compact, signed); err != nil {
+		t.Fatal(err)
+	}
+	canonical, err := keystore.Canonicalize(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string][]byte{"signed": signed, "tabs": tabs.Bytes(), "compact": compact.Bytes(), "canonical": canonical} {
+		if err := keystore.VerifyManifest(data, &key.PublicKey); err != nil {
+			t.Errorf("VerifyManifest of the %s file: %v", name, err)
+		}
+	}
+
+	// Big integers are signed exactly: a limit that rounds to the same
+	// float64 is a different limit.
+	changed := bytes.Replace(signed, []byte(canonicalMaxValue), []byte("120000000000000000000000000002"), 1)
+	if bytes.Equal(changed, signed) {
+		t.Fatal("signed file lacks the policy limit")
+	}
+	if err := keystore.VerifyManifest(changed, &key.PublicKey); !errors.Is(err, keystore.ErrManifestInvalid) {
+		t.Fatalf("VerifyManifest of a changed limit: got %v, want ErrManifestInvalid", err)
+	}
+}
@@ -0,0 +1,179 @@
+package keystore
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// SavePrivateKeyForChain stores the primary key together with the chain it
+// is intended for. SignTransaction and TransactOpts then refuse other chains.
+// networkName is descriptive only.
+func (s *Store) SavePrivateKeyForChain(privateKeyHex string, chainID *big.Int, networkName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if chainID == nil || chainID.Sign() <= 0 {
+		return fmt.Errorf("%w %v", ErrInvalidChainID, chainID)
+	}
+
+	key, err := s.checkPrivateKey(privateKeyHex)
+	if err != nil {
+		return err
+	}
+
+	return s.updateScope(scopeKey, func() error {
+		if err := s.setPrimaryKey(privateKeyHex, key, s.newProvenance(ProvenanceHex, "")); err != nil {
+			return err
+		}
+		s.ChainID = chainID.String()
+		s.NetworkName = networkName
+		return nil
+	})
+}
+
+// Chain returns the chain ID and network name recorded with the primary key.
+// A nil chain ID means the key is not restricted to a chain.
+func (s *Store) Chain() (*big.Int, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, "", err
+	}
+
+	chainID, err := s.parseChainID(s.ChainID)
+	return chainID, s.NetworkName, err
+}
+
+// SignTransaction signs tx for chainID with the primary key. If the key was
+// saved for a different chain it fails with ErrChainMismatch, unless
+// Config.AllowChainMismatch is set, and if it is for encryption only with
+// ErrWrongKeyPurpose.
+func (s *Store) SignTransaction(tx *types.Transaction, chainID *big.Int) (signed *types.Transaction, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer func() { s.audit(AuditSign, "", err) }()
+
+	key, err := s.transactionKey(tx, chainID)
+	if err != nil {
+		return nil, err
+	}
+	return types.SignTx(tx, types.LatestSignerForChainID(chainID), key)
+}
+
+// TransactOpts returns bind.TransactOpts signing with the primary key for
+// chainID, subject to the same checks as SignTransaction. They are made
+// again for every transaction the Signer signs, with the key read afresh,
+// so a freeze, a lost signing lease or a rotated key stops it.
+func (s *Store) TransactOpts(chainID *big.Int) (opts *bind.TransactOpts, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer func() { s.audit(AuditKeyAccess, "", err) }()
+
+	if err := s.authorized(AuthSignTransaction); err != nil {
+		return nil, err
+	}
+
+	key, err := s.chainKey(chainID)
+	if err != nil {
+		return nil, err
+	}
+
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	opts = &bind.TransactOpts{
+		From:    from,
+		Context: context.Background(),
+		Signer: func(address common.Address, tx *types.Transaction) (signed *types.Transaction, err error) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			defer func() { s.audit(AuditSign, "", err) }()
+
+			key, err := s.transactionKey(tx, chainID)
+			if err != nil {
+				return nil, err
+			}
+			if address != from || crypto.PubkeyToAddress(key.PublicKey) != from {
+				return nil, bind.ErrNotAuthorized
+			}
+			return types.SignTx(tx, types.LatestSignerForChainID(chainID), key)
+		},
+	}
+	return opts, nil
+}
+
+// transactionKey returns the primary key for signing tx on chainID after
+// the authorization, chain and policy checks. The caller holds s.mu.
+func (s *Store) transactionKey(tx *types.Transaction, chainID *big.Int) (*ecdsa.PrivateKey, error) {
+	if err := s.authorized(AuthSignTransaction); err != nil {
+		return nil, err
+	}
+
+	key, err := s.chainKey(chainID)
+	if err != nil {
+		return nil, err
+	}
+
+	if txChain := tx.ChainId(); tx.Type() != types.LegacyTxType && txChain.Cmp(chainID) != 0 {
+		return nil, fmt.Errorf("%w: transaction is for chain %s, signing for %s", ErrChainMismatch, txChain, chainID)
+	}
+
+	if err := s.enforcePolicy("", tx, chainID); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// chainKey returns the primary key after checking chainID against the chain
+// recorded with it. Keys without a recorded chain sign for any chain.
+func (s *Store) chainKey(chainID *big.Int) (*ecdsa.PrivateKey, error) {
+	if chainID == nil {
+		return nil, fmt.Errorf("%w: chain id is required", ErrInvalidChainID)
+	}
+
+	key, _, err := s.primaryKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkSigningKey(""); err != nil {
+		return nil, err
+	}
+
+	stored, err := s.parseChainID(s.ChainID)
+	if err != nil || stored == nil || stored.Cmp(chainID) == 0 {
+		return key, err
+	}
+
+	mismatch := fmt.Errorf("%w: key is for %s, signing for chain %s", ErrChainMismatch, s.describeChain(stored), chainID)
+	if !s.config.AllowChainMismatch {
+		return nil, mismatch
+	}
+
+	s.config.Logger.Warn("keystore: signing for a different chain than the key was saved for", "error", mismatch)
+	return key, nil
+}
+
+func (s *Store) describeChain(chainID *big.Int) string {
+	if s.NetworkName != "" {
+		return fmt.Sprintf("chain %s (%s)", chainID, s.NetworkName)
+	}
+	return "chain " + chainID.String()
+}
+
+func (s *Store) parseChainID(v string) (*big.Int, error) {
+	if v == "" {
+		return nil, nil
+	}
+
+	chainID, ok := new(big.Int).SetString(v, 10)
+	if !ok {
+		return nil, s.corrupt("chain_id", fmt.Errorf("%w %q", ErrInvalidChainID, v))
+	}
+	return chainID, nil
+}
@@ -0,0 +1,132 @@
+package keystore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Codec encodes the keystore document on disk. The document is built with
+// its JSON field names, so every codec sees the same keys.
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+	// Ext is the file extension used when Config.FileName is not set,
+	// including the leading dot.
+	Ext() string
+}
+
+// JSONCodec is the default codec.
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(v any) ([]byte, error)      { return json.MarshalIndent(v, "", "  ") }
+func (JSONCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+func (JSONCodec) Ext() string                        { return ".json" }
+
+// YAMLCodec stores the keystore as YAML.
+type YAMLCodec struct{}
+
+func (YAMLCodec) Marshal(v any) ([]byte, error)      { return yaml.Marshal(v) }
+func (YAMLCodec) Unmarshal(data []byte, v any) error { return yaml.Unmarshal(data, v) }
+func (YAMLCodec) Ext() string                        { return ".yaml" }
+
+// TOMLCodec stores the keystore as TOML.
+type TOMLCodec struct{}
+
+func (TOMLCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (TOMLCodec) Unmarshal(data []byte, v any) error { return toml.Unmarshal(data, v) }
+func (TOMLCodec) Ext() string                        { return ".toml" }
+
+func (s *Store) codec() Codec {
+	if s.config.Codec != nil {
+		return s.config.Codec
+	}
+	return JSONCodec{}
+}
+
+func isJSONCodec(c Codec) bool {
+	_, ok := c.(JSONCodec)
+	return ok
+}
+
+// encodeDocument converts the JSON document data to the configured codec.
+func (s *Store) encodeDocument(data []byte) ([]byte, error) {
+	c := s.codec()
+	if isJSONCodec(c) {
+		return data, nil
+	}
+
+	doc, err := decodeDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(data)
+
+	encoded, err := c.Marshal(plainValues(doc))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode keystore as %s: %w", c.Ext(), err)
+	}
+	return encoded, nil
+}
+
+// documentJSON converts persisted data to a JSON document, trying the
+// configured codec first and falling back to JSON so files written before
+// a codec change keep loading.
+func (s *Store) documentJSON(data []byte) ([]byte, error) {
+	c := s.codec()
+	if isJSONCodec(c) {
+		return data, nil
+	}
+
+	var doc map[string]any
+	err := c.Unmarshal(data, &doc)
+	if err == nil && doc != nil {
+		return json.Marshal(doc)
+	}
+
+	if json.Valid(data) {
+		return data, nil
+	}
+	if err == nil {
+		err = fmt.Errorf("empty document")
+	}
+	return nil, s.corrupt("", fmt.Errorf("failed to parse as %s: %w", c.Ext(), err))
+}
+
+// plainValues replaces json.Number with int64 or float64 and drops nulls,
+// which TOML cannot represent, so other codecs encode numbers as numbers.
+func plainValues(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, e := range v {
+			if e != nil {
+				out[k] = plainValues(e)
+			}
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			out[i] = plainValues(e)
+		}
+		return out
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return v
+}
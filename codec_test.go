@@ -0,0 +1,126 @@
+package keystore_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/theblitlabs/keystore"
+	"gopkg.in/yaml.v3"
+)
+
+func TestCodecs(t *testing.T) {
+	tests := []struct {
+		codec    keystore.Codec
+		fileName string
+		parse    func([]byte, any) error
+	}{
+		{codec: keystore.JSONCodec{}, fileName: "keystore.json", parse: json.Unmarshal},
+		{codec: keystore.YAMLCodec{}, fileName: "keystore.yaml", parse: yaml.Unmarshal},
+		{codec: keystore.TOMLCodec{}, fileName: "keystore.toml", parse: toml.Unmarshal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.codec.Ext(), func(t *testing.T) {
+			dir := t.TempDir()
+			cfg := keystore.Config{DirPath: dir, Codec: tt.codec}
+			ks, err := keystore.NewKeystore(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := ks.SaveToken("codec-token"); err != nil {
+				t.Fatal(err)
+			}
+			if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+				t.Fatal(err)
+			}
+			if err := ks.SaveAccount("ops", credentialKeyHex); err != nil {
+				t.Fatal(err)
+			}
+			if err := ks.SetAccountLabel("ops", "team", "infra"); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(filepath.Join(dir, tt.fileName))
+			if err != nil {
+				t.Fatalf("keystore not written as %s: %v", tt.fileName, err)
+			}
+			var doc map[string]any
+			if err := tt.parse(data, &doc); err != nil {
+				t.Fatalf("file is not valid %s: %v", tt.codec.Ext(), err)
+			}
+			if doc["auth_token"] != "codec-token" {
+				t.Fatalf("auth_token = %v", doc["auth_token"])
+			}
+
+			other, err := keystore.NewKeystore(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token, err := other.LoadToken(); err != nil || token != "codec-token" {
+				t.Fatalf("LoadToken = %q, %v", token, err)
+			}
+			key, err := other.LoadPrivateKey()
+			if err != nil || hexKey(key) != fileKeyHex {
+				t.Fatalf("LoadPrivateKey: %v", err)
+			}
+			accounts, err := other.ListAccounts()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var found bool
+			for _, a := range accounts {
+				if a.Name == "ops" {
+					found = a.Labels["team"] == "infra"
+				}
+			}
+			if !found {
+				t.Fatalf("account labels lost: %+v", accounts)
+			}
+		})
+	}
+}
+
+func TestCodecFallsBackToJSON(t *testing.T) {
+	dir := t.TempDir()
+	cfg := keystore.Config{DirPath: dir, FileName: "keystore.json"}
+	ks, err := keystore.NewKeystore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveToken("json-token"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The explicit FileName is kept after switching codecs.
+	cfg.Codec = keystore.YAMLCodec{}
+	yml, err := keystore.NewKeystore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token, err := yml.LoadToken(); err != nil || token != "json-token" {
+		t.Fatalf("LoadToken of a JSON file with the YAML codec = %q, %v", token, err)
+	}
+
+	if err := yml.SaveToken("yaml-token"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "keystore.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if json.Valid(bytes.TrimSpace(data)) {
+		t.Fatal("save with the YAML codec still wrote JSON")
+	}
+	var doc map[string]any
+	if err := yaml.Unmarshal(data, &doc); err != nil || doc["auth_token"] != "yaml-token" {
+		t.Fatalf("file is not the YAML document: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "keystore.yaml")); !os.IsNotExist(err) {
+		t.Fatalf("codec changed the explicit file name: %v", err)
+	}
+}
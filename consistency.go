@@ -0,0 +1,40 @@
+package keystore
+
+import (
+	"fmt"
+	"time"
+)
+
+// A Store reads its own writes: once it has saved a revision, it never
+// returns state read from an older one. An older revision can be read when
+// a writer that does not share the lock, such as a process on another
+// machine of a network filesystem, saves stale state in between, or when
+// a filesystem serves a cached copy of the file. The read is then retried
+// staleReadAttempts times, staleReadDelay apart, before failing with
+// ErrStaleRead.
+const (
+	staleReadAttempts = 3
+	staleReadDelay    = 20 * time.Millisecond
+)
+
+// staleRead reports whether the loaded revision is older than the last one
+// this Store wrote. State loaded from the mirror is stale by design and
+// not checked.
+func (s *Store) staleRead() bool {
+	return !s.fromMirror && s.Rev < s.writtenRev
+}
+
+// staleReadError reports a read that stayed stale after retrying. The
+// in-memory state is discarded, and the revision found is accepted from
+// then on, so that a keystore replaced by an older copy on purpose, such
+// as a backup restored by hand, is reported once instead of becoming
+// unreadable. Revisions restart at 1 when another Store or process
+// destroys the keystore and creates a new one, so this Store reports that
+// as a stale read once too.
+func (s *Store) staleReadError() error {
+	err := fmt.Errorf("%w: read revision %d at %s, this Store wrote revision %d", ErrStaleRead, s.Rev, s.location(), s.writtenRev)
+	s.writtenRev = s.Rev
+	s.cache = nil
+	s.reset()
+	return err
+}
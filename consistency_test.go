@@ -0,0 +1,148 @@
+package keystore_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/theblitlabs/keystore"
+)
+
+// laggingBackend is a MemoryBackend that serves an old copy of the
+// keystore for the next lag reads, as a filesystem with a stale cache does.
+type laggingBackend struct {
+	*keystore.MemoryBackend
+
+	mu    sync.Mutex
+	old   []byte
+	lag   int
+	reads int
+}
+
+// serveOld makes the next n reads return old.
+func (b *laggingBackend) serveOld(old []byte, n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.old, b.lag, b.reads = old, n, 0
+}
+
+func (b *laggingBackend) Read() ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.reads++
+	if b.lag > 0 {
+		b.lag--
+		return append([]byte(nil), b.old...), nil
+	}
+	return b.MemoryBackend.Read()
+}
+
+func TestReadYourWritesRacingWriter(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, keystore.DefaultFileName)
+	ks := newErrorStore(t, keystore.Config{DirPath: dir})
+	if err := ks.SaveToken("first"); err != nil {
+		t.Fatal(err)
+	}
+	old, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveToken("second"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A writer that does not take the lock puts back the older revision
+	// between this Store's save and its next load.
+	if err := os.WriteFile(path, old, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if token, err := ks.LoadToken(); !errors.Is(err, keystore.ErrStaleRead) {
+		t.Fatalf("LoadToken after a racing write = %q, %v, want ErrStaleRead", token, err)
+	}
+
+	// The error is reported once; the revision found is then accepted.
+	if token, err := ks.LoadToken(); err != nil || token != "first" {
+		t.Fatalf("LoadToken after ErrStaleRead = %q, %v, want the revision on disk", token, err)
+	}
+	if err := ks.SaveToken("third"); err != nil {
+		t.Fatalf("SaveToken after ErrStaleRead: %v", err)
+	}
+	if token, err := newErrorStore(t, keystore.Config{DirPath: dir}).LoadToken(); err != nil || token != "third" {
+		t.Fatalf("another Store reads %q, %v, want the last save", token, err)
+	}
+}
+
+func TestReadYourWritesRetries(t *testing.T) {
+	backend := &laggingBackend{MemoryBackend: keystore.NewMemoryBackend()}
+	ks := newErrorStore(t, keystore.Config{Backend: backend})
+	if err := ks.SaveToken("first"); err != nil {
+		t.Fatal(err)
+	}
+	old, err := backend.MemoryBackend.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveToken("second"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A stale copy served briefly is read past.
+	backend.serveOld(old, 2)
+	if token, err := ks.LoadToken(); err != nil || token != "second" {
+		t.Fatalf("LoadToken while briefly stale = %q, %v, want this Store's write", token, err)
+	}
+	if backend.reads != 3 {
+		t.Fatalf("LoadToken read %d times, want 3: two stale reads and a fresh one", backend.reads)
+	}
+
+	// One that stays is reported, without returning its data.
+	backend.serveOld(old, 100)
+	if token, err := ks.LoadToken(); !errors.Is(err, keystore.ErrStaleRead) || token != "" {
+		t.Fatalf("LoadToken while stale = %q, %v, want ErrStaleRead", token, err)
+	}
+	if backend.reads < 2 {
+		t.Fatalf("LoadToken gave up after %d reads, want retries", backend.reads)
+	}
+}
+
+func TestReadYourWritesDestroyAndRecreate(t *testing.T) {
+	dir := t.TempDir()
+	ks := newErrorStore(t, keystore.Config{DirPath: dir})
+	if err := ks.SaveToken("old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+
+	// Newer revisions written by another Store are read as usual.
+	other := newErrorStore(t, keystore.Config{DirPath: dir})
+	if err := other.SaveToken("newer"); err != nil {
+		t.Fatal(err)
+	}
+	if token, err := ks.LoadToken(); err != nil || token != "newer" {
+		t.Fatalf("LoadToken after another Store saved = %q, %v", token, err)
+	}
+
+	// A recreated keystore starts again at revision 1, which this Store
+	// reports as stale once.
+	if err := other.Destroy(); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.SaveToken("recreated"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.LoadToken(); !errors.Is(err, keystore.ErrStaleRead) {
+		t.Fatalf("LoadToken of a recreated keystore: got %v, want ErrStaleRead", err)
+	}
+	if token, err := ks.LoadToken(); err != nil || token != "recreated" {
+		t.Fatalf("LoadToken after ErrStaleRead = %q, %v, want the recreated keystore", token, err)
+	}
+	if _, err := ks.LoadPrivateKey(); !errors.Is(err, keystore.ErrNoPrivateKey) {
+		t.Fatalf("LoadPrivateKey of the recreated keystore: got %v, want ErrNoPrivateKey", err)
+	}
+}
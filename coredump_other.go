@@ -0,0 +1,12 @@
+//go:build !unix
+
+package keystore
+
+import (
+	"errors"
+	"runtime"
+)
+
+func disableCoreDumps() error {
+	return errors.New("not supported on " + runtime.GOOS)
+}
@@ -0,0 +1,10 @@
+//go:build unix
+
+package keystore
+
+import "syscall"
+
+// disableCoreDumps sets the core file size limit of the process to zero.
+func disableCoreDumps() error {
+	return syscall.Setrlimit(syscall.RLIMIT_CORE, &syscall.Rlimit{Cur: 0, Max: 0})
+}
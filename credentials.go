@@ -0,0 +1,117 @@
+package keystore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// CredentialsDirectoryEnv is the environment variable systemd uses to expose
+	// the directory holding credentials passed via LoadCredential= and friends
+	CredentialsDirectoryEnv = "CREDENTIALS_DIRECTORY"
+
+	// DefaultPrivateKeyCredential is the default credential name for the private key
+	DefaultPrivateKeyCredential = "private_key"
+
+	// DefaultAuthTokenCredential is the default credential name for the auth token
+	DefaultAuthTokenCredential = "auth_token"
+)
+
+const (
+	keySourceCredential = "systemd-credential"
+	keySourceEnv        = "env"
+)
+
+// credentials holds the values sourced from systemd credentials or the
+// environment. Fields left empty were not provided and fall back to the
+// keystore file.
+type credentials struct {
+	privateKey string
+	keySource  string
+	authToken  string
+}
+
+func loadCredentials(cfg Config) (credentials, error) {
+	creds, err := loadSystemdCredentials(cfg)
+	if err != nil {
+		return creds, err
+	}
+
+	if cfg.KeyFromEnv != "" {
+		value, ok := os.LookupEnv(cfg.KeyFromEnv)
+		if !ok {
+			return creds, configError("KeyFromEnv", fmt.Sprintf("private key environment variable %s is not set", cfg.KeyFromEnv))
+		}
+		if cfg.ClearKeyEnv {
+			os.Unsetenv(cfg.KeyFromEnv)
+		}
+
+		value = strings.TrimSpace(value)
+		if err := ValidatePrivateKeyHex(value); err != nil {
+			return creds, fmt.Errorf("invalid private key in environment variable %s: %w", cfg.KeyFromEnv, err)
+		}
+		creds.privateKey = value
+		creds.keySource = keySourceEnv
+	}
+
+	return creds, nil
+}
+
+func loadSystemdCredentials(cfg Config) (credentials, error) {
+	var creds credentials
+
+	if !cfg.SystemdCredentials {
+		return creds, nil
+	}
+
+	dir := os.Getenv(CredentialsDirectoryEnv)
+	if dir == "" {
+		return creds, nil
+	}
+
+	keyName := cfg.PrivateKeyCredential
+	if keyName == "" {
+		keyName = DefaultPrivateKeyCredential
+	}
+
+	tokenName := cfg.AuthTokenCredential
+	if tokenName == "" {
+		tokenName = DefaultAuthTokenCredential
+	}
+
+	var err error
+	if creds.privateKey, err = readCredential(dir, keyName); err != nil {
+		return creds, err
+	}
+
+	if creds.privateKey != "" {
+		if err := ValidatePrivateKeyHex(creds.privateKey); err != nil {
+			return creds, fmt.Errorf("invalid private key in credential %q: %w", keyName, err)
+		}
+		creds.keySource = keySourceCredential
+	}
+
+	if creds.authToken, err = readCredential(dir, tokenName); err != nil {
+		return creds, err
+	}
+
+	return creds, nil
+}
+
+func readCredential(dir, name string) (string, error) {
+	if name != filepath.Base(name) {
+		return "", configError("Credential", fmt.Sprintf("invalid credential name %q", name))
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read credential %q: %w", name, err)
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
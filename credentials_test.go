@@ -0,0 +1,161 @@
+package keystore_test
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/theblitlabs/keystore"
+)
+
+const (
+	fileKeyHex       = "4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318"
+	credentialKeyHex = "8da4ef21b864d2cc526dbdb2a120bd2874c36c9d0a1fb7f8c63d7f7a8b41de8f"
+	envKeyHex        = "c87509a1c067bbde78beb793e6fa76530b6382a4c0241e5e4a9ec0a0f44dc0d3"
+)
+
+func TestCredentialPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	credDir := t.TempDir()
+
+	file, err := keystore.NewKeystore(keystore.Config{DirPath: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := file.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.SaveToken("file-token"); err != nil {
+		t.Fatal(err)
+	}
+
+	writeCredential := func(name, value string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(credDir, name), []byte(value+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		name      string
+		setup     func(t *testing.T)
+		cfg       keystore.Config
+		wantKey   string
+		wantToken string
+	}{
+		{
+			name:      "keystore file by default",
+			cfg:       keystore.Config{DirPath: dir, SystemdCredentials: true},
+			wantKey:   fileKeyHex,
+			wantToken: "file-token",
+		},
+		{
+			name: "credentials disabled in config",
+			setup: func(t *testing.T) {
+				writeCredential(keystore.DefaultPrivateKeyCredential, credentialKeyHex)
+				writeCredential(keystore.DefaultAuthTokenCredential, "credential-token")
+				t.Setenv(keystore.CredentialsDirectoryEnv, credDir)
+			},
+			cfg:       keystore.Config{DirPath: dir},
+			wantKey:   fileKeyHex,
+			wantToken: "file-token",
+		},
+		{
+			name: "credential overrides keystore file",
+			setup: func(t *testing.T) {
+				writeCredential(keystore.DefaultPrivateKeyCredential, credentialKeyHex)
+				writeCredential(keystore.DefaultAuthTokenCredential, "credential-token")
+				t.Setenv(keystore.CredentialsDirectoryEnv, credDir)
+			},
+			cfg:       keystore.Config{DirPath: dir, SystemdCredentials: true},
+			wantKey:   credentialKeyHex,
+			wantToken: "credential-token",
+		},
+		{
+			name: "missing credential falls back to keystore file",
+			setup: func(t *testing.T) {
+				writeCredential("other_token", "credential-token")
+				t.Setenv(keystore.CredentialsDirectoryEnv, credDir)
+			},
+			cfg:       keystore.Config{DirPath: dir, SystemdCredentials: true, PrivateKeyCredential: "other_key", AuthTokenCredential: "other_token"},
+			wantKey:   fileKeyHex,
+			wantToken: "credential-token",
+		},
+		{
+			name: "environment overrides credential",
+			setup: func(t *testing.T) {
+				writeCredential(keystore.DefaultPrivateKeyCredential, credentialKeyHex)
+				t.Setenv(keystore.CredentialsDirectoryEnv, credDir)
+				t.Setenv("KEYSTORE_TEST_KEY", envKeyHex)
+			},
+			cfg:       keystore.Config{DirPath: dir, SystemdCredentials: true, KeyFromEnv: "KEYSTORE_TEST_KEY"},
+			wantKey:   envKeyHex,
+			wantToken: "file-token",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			for _, name := range []string{keystore.DefaultPrivateKeyCredential, keystore.DefaultAuthTokenCredential, "other_token"} {
+				os.Remove(filepath.Join(credDir, name))
+			}
+			if c.setup != nil {
+				c.setup(t)
+			}
+
+			s, err := keystore.NewKeystore(c.cfg)
+			if err != nil {
+				t.Fatalf("NewKeystore: %v", err)
+			}
+
+			key, err := s.LoadPrivateKey()
+			if err != nil {
+				t.Fatalf("LoadPrivateKey: %v", err)
+			}
+			if got := hexKey(key); got != c.wantKey {
+				t.Errorf("private key = %s, want %s", got, c.wantKey)
+			}
+
+			token, err := s.LoadToken()
+			if err != nil {
+				t.Fatalf("LoadToken: %v", err)
+			}
+			if token != c.wantToken {
+				t.Errorf("token = %q, want %q", token, c.wantToken)
+			}
+		})
+	}
+}
+
+func TestCredentialWritesAreReadOnly(t *testing.T) {
+	credDir := t.TempDir()
+	for name, value := range map[string]string{
+		keystore.DefaultPrivateKeyCredential: credentialKeyHex,
+		keystore.DefaultAuthTokenCredential:  "credential-token",
+	} {
+		if err := os.WriteFile(filepath.Join(credDir, name), []byte(value), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv(keystore.CredentialsDirectoryEnv, credDir)
+
+	s, err := keystore.NewKeystore(keystore.Config{DirPath: t.TempDir(), SystemdCredentials: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.SavePrivateKey(fileKeyHex); !errors.Is(err, keystore.ErrReadOnly) {
+		t.Errorf("SavePrivateKey: got %v, want ErrReadOnly", err)
+	}
+	if err := s.SaveToken("new-token"); !errors.Is(err, keystore.ErrReadOnly) {
+		t.Errorf("SaveToken: got %v, want ErrReadOnly", err)
+	}
+}
+
+func hexKey(key *ecdsa.PrivateKey) string {
+	return hex.EncodeToString(crypto.FromECDSA(key))
+}
@@ -0,0 +1,151 @@
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// machineID returns a stable identifier for the current machine. It is a
+// variable so the platform lookup can be substituted.
+var machineID = readMachineID
+
+func currentMachineID() (string, error) {
+	id, err := machineID()
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrNoMachineID, err)
+	}
+
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return "", fmt.Errorf("%w: identifier is empty", ErrNoMachineID)
+	}
+
+	return id, nil
+}
+
+func deviceKey(id string) []byte {
+	sum := sha256.Sum256([]byte("keystore/device-binding/key\x00" + id))
+	return sum[:]
+}
+
+func deviceFingerprint(id string) string {
+	sum := sha256.Sum256([]byte("keystore/device-binding/id\x00" + id))
+	return hex.EncodeToString(sum[:8])
+}
+
+func sealForDevice(id, token string) (string, error) {
+	gcm, err := deviceCipher(id)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(token), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func openForDevice(id, sealed string) (string, error) {
+	gcm, err := deviceCipher(id)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < gcm.NonceSize() {
+		return "", ErrInvalidToken
+	}
+
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", ErrDeviceMismatch
+	}
+
+	return string(plaintext), nil
+}
+
+func deviceCipher(id string) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(deviceKey(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// bindToken encrypts the token for the current machine and records the
+// device fingerprint alongside it.
+func (s *Store) bindToken(token string) error {
+	id, err := currentMachineID()
+	if err != nil {
+		return err
+	}
+
+	sealed, err := sealForDevice(id, token)
+	if err != nil {
+		return err
+	}
+
+	s.TokenDevice = deviceFingerprint(id)
+	return s.setAuthToken(sealed)
+}
+
+// unbindToken returns the plaintext of a device-bound token.
+func (s *Store) unbindToken(sealed string) (string, error) {
+	id, err := currentMachineID()
+	if err != nil {
+		return "", err
+	}
+
+	if deviceFingerprint(id) != s.TokenDevice {
+		return "", ErrDeviceMismatch
+	}
+
+	return openForDevice(id, sealed)
+}
+
+// RebindDevice re-encrypts a device-bound token for the current machine after
+// a legitimate hardware migration. previousMachineID is the identifier of the
+// machine that originally wrote the token.
+func (s *Store) RebindDevice(previousMachineID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	if s.TokenDevice == "" {
+		return ErrNotDeviceBound
+	}
+
+	previousMachineID = strings.TrimSpace(previousMachineID)
+	if deviceFingerprint(previousMachineID) != s.TokenDevice {
+		return ErrDeviceMismatch
+	}
+
+	sealed, err := s.authToken()
+	if err != nil {
+		return err
+	}
+
+	token, err := openForDevice(previousMachineID, sealed)
+	if err != nil {
+		return err
+	}
+
+	if err := s.bindToken(token); err != nil {
+		return err
+	}
+
+	return s.save()
+}
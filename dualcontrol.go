@@ -0,0 +1,195 @@
+package keystore
+
+import (
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// DefaultShareWindow is how long a dual-control unlock may take from the
+// first share when Config.ShareWindow is not set
+const DefaultShareWindow = 10 * time.Minute
+
+// KeyShares is a primary key split into Shamir shares, each encrypted with
+// its own operator's passphrase. Threshold shares reconstruct the key.
+type KeyShares struct {
+	Threshold int               `json:"threshold"`
+	Shares    []*EncryptedValue `json:"shares"`
+}
+
+// shareCeremony collects the shares submitted to ProvideShare. It lives
+// only in memory.
+type shareCeremony struct {
+	shares   map[int][]byte
+	deadline time.Time
+}
+
+// SplitPrimaryKey puts the primary key under dual control: it is replaced
+// by one share per passphrase, any threshold of which reconstruct it, and
+// is no longer written whole. After the save the key is unavailable until
+// the shares are supplied with ProvideShare.
+func (s *Store) SplitPrimaryKey(threshold int, passphrases ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkKeySource(); err != nil {
+		return err
+	}
+
+	for i, p := range passphrases {
+		if p == "" {
+			return fmt.Errorf("%w: share %d", ErrNoPassphrase, i)
+		}
+	}
+
+	return s.update(func() error {
+		if s.KeyShares != nil {
+			return fmt.Errorf("%w: it is already split", ErrKeySplit)
+		}
+
+		if err := s.checkEthereumKey(); err != nil {
+			return err
+		}
+
+		privateKeyHex, err := s.privateKeyHex()
+		if err != nil {
+			return err
+		}
+		if err := verifyKeyAddress(privateKeyHex, s.Address); err != nil {
+			return err
+		}
+
+		secret, err := hex.DecodeString(privateKeyHex)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidPrivateKey, err)
+		}
+		defer wipe(secret)
+
+		parts, err := splitSecret(secret, len(passphrases), threshold)
+		if err != nil {
+			return err
+		}
+
+		shares := &KeyShares{Threshold: threshold, Shares: make([]*EncryptedValue, len(parts))}
+		for i, part := range parts {
+			shares.Shares[i], err = encryptValue(passphrases[i], part)
+			wipe(part)
+			if err != nil {
+				return err
+			}
+		}
+
+		s.KeyShares = shares
+		s.persisted.PrivateKey = ""
+		s.EncryptedKey = nil
+		s.cache = nil
+		return nil
+	})
+}
+
+// ProvideShare submits share idx of a split primary key, decrypted with
+// passphrase, and returns how many more shares are needed. Shares may come
+// in any order. Once the threshold is met the key is reconstructed in memory
+// for the session, until Lock. The collected shares are wiped when a share
+// is wrong and when Config.ShareWindow passes before the threshold is met.
+func (s *Store) ProvideShare(idx int, passphrase string) (remaining int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return 0, err
+	}
+
+	ks := s.KeyShares
+	if ks == nil {
+		return 0, fmt.Errorf("%w: primary key is not split", ErrInvalidShare)
+	}
+	if s.shareKey != nil {
+		return 0, nil
+	}
+	if idx < 0 || idx >= len(ks.Shares) {
+		return 0, fmt.Errorf("%w: no share %d", ErrInvalidShare, idx)
+	}
+
+	if c := s.ceremony; c != nil && !s.now().Before(c.deadline) {
+		s.wipeCeremony()
+		return ks.Threshold, ErrShareWindowExpired
+	}
+
+	share, err := decryptValue(passphrase, ks.Shares[idx])
+	if err == nil && (len(share) == 0 || int(share[0]) != idx+1) {
+		wipe(share)
+		err = fmt.Errorf("%w: share %d is malformed", ErrInvalidShare, idx)
+	}
+	if err != nil {
+		s.countUnlockFailure()
+		s.wipeCeremony()
+		return ks.Threshold, err
+	}
+
+	if s.ceremony == nil {
+		s.ceremony = &shareCeremony{shares: make(map[int][]byte), deadline: s.now().Add(s.shareWindow())}
+	}
+	c := s.ceremony
+	if _, ok := c.shares[idx]; ok {
+		wipe(share)
+	} else {
+		c.shares[idx] = share
+	}
+
+	if len(c.shares) < ks.Threshold {
+		return ks.Threshold - len(c.shares), nil
+	}
+
+	parts := make([][]byte, 0, len(c.shares))
+	for _, part := range c.shares {
+		parts = append(parts, part)
+	}
+	secret, err := combineShares(parts)
+	s.wipeCeremony()
+	if err != nil {
+		return ks.Threshold, fmt.Errorf("%w: %v", ErrInvalidShare, err)
+	}
+	defer wipe(secret)
+
+	privateKeyHex := hex.EncodeToString(secret)
+	if err := verifyKeyAddress(privateKeyHex, s.Address); err != nil {
+		s.countUnlockFailure()
+		return ks.Threshold, fmt.Errorf("%w: shares do not reconstruct the key", ErrInvalidShare)
+	}
+
+	s.shareKey = &privateKeyHex
+	s.updateGauges()
+	return 0, nil
+}
+
+func (s *Store) shareWindow() time.Duration {
+	if s.config.ShareWindow > 0 {
+		return s.config.ShareWindow
+	}
+	return DefaultShareWindow
+}
+
+// wipeCeremony discards the shares collected so far.
+func (s *Store) wipeCeremony() {
+	if s.ceremony == nil {
+		return
+	}
+	for _, share := range s.ceremony.shares {
+		wipe(share)
+	}
+	s.ceremony = nil
+}
+
+// splitKeyHex returns the reconstructed primary key of a split keystore.
+func (s *Store) splitKeyHex() (string, error) {
+	if s.shareKey != nil {
+		return *s.shareKey, nil
+	}
+
+	remaining := s.KeyShares.Threshold
+	if s.ceremony != nil {
+		remaining -= len(s.ceremony.shares)
+	}
+	return "", fmt.Errorf("%w: %d more shares required", ErrKeySplit, remaining)
+}
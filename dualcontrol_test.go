@@ -0,0 +1,192 @@
+package keystore_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/theblitlabs/keystore"
+)
+
+func sharePassphrases(n int) []string {
+	passphrases := make([]string, n)
+	for i := range passphrases {
+		passphrases[i] = fmt.Sprintf("operator-%d", i)
+	}
+	return passphrases
+}
+
+// newSplitStore saves fileKeyHex in dir and splits it threshold-of-n.
+func newSplitStore(t *testing.T, clock *testClock, threshold, n int) (*keystore.Store, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	ks, err := keystore.NewKeystore(clock.config(keystore.Config{DirPath: dir, ShareWindow: 5 * time.Minute}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SplitPrimaryKey(threshold, sharePassphrases(n)...); err != nil {
+		t.Fatalf("SplitPrimaryKey(%d of %d): %v", threshold, n, err)
+	}
+	return ks, dir
+}
+
+func TestDualControlUnlock(t *testing.T) {
+	tests := []struct {
+		threshold int
+		n         int
+		order     []int
+	}{
+		{threshold: 2, n: 2, order: []int{0, 1}},
+		{threshold: 2, n: 2, order: []int{1, 0}},
+		{threshold: 2, n: 3, order: []int{2, 0}},
+		{threshold: 3, n: 5, order: []int{4, 1, 3}},
+		{threshold: 3, n: 5, order: []int{3, 3, 0, 2}},
+		{threshold: 5, n: 5, order: []int{4, 3, 2, 1, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d of %d %v", tt.threshold, tt.n, tt.order), func(t *testing.T) {
+			ks, dir := newSplitStore(t, newTestClock(epoch), tt.threshold, tt.n)
+			passphrases := sharePassphrases(tt.n)
+
+			data, err := os.ReadFile(filepath.Join(dir, keystore.DefaultFileName))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(data), fileKeyHex) {
+				t.Fatal("split key still written whole")
+			}
+			if _, err := ks.LoadPrivateKey(); !errors.Is(err, keystore.ErrKeySplit) {
+				t.Fatalf("LoadPrivateKey before the ceremony: got %v, want ErrKeySplit", err)
+			}
+
+			seen := map[int]bool{}
+			for i, idx := range tt.order {
+				seen[idx] = true
+				remaining, err := ks.ProvideShare(idx, passphrases[idx])
+				if err != nil {
+					t.Fatalf("ProvideShare(%d): %v", idx, err)
+				}
+				want := max(tt.threshold-len(seen), 0)
+				if remaining != want {
+					t.Fatalf("after share %d of %v: remaining = %d, want %d", i, tt.order, remaining, want)
+				}
+			}
+
+			key, err := ks.LoadPrivateKey()
+			if err != nil || hexKey(key) != fileKeyHex {
+				t.Fatalf("LoadPrivateKey after the ceremony: %v", err)
+			}
+			if _, err := ks.SignDigest(crypto.Keccak256([]byte("treasury"))); err != nil {
+				t.Fatalf("SignDigest: %v", err)
+			}
+
+			ks.Lock()
+			if _, err := ks.LoadPrivateKey(); !errors.Is(err, keystore.ErrKeySplit) {
+				t.Fatalf("LoadPrivateKey after Lock: got %v, want ErrKeySplit", err)
+			}
+		})
+	}
+}
+
+func TestDualControlWrongShare(t *testing.T) {
+	ks, _ := newSplitStore(t, newTestClock(epoch), 3, 4)
+	passphrases := sharePassphrases(4)
+
+	if _, err := ks.ProvideShare(0, passphrases[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.ProvideShare(1, passphrases[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	// Share 2 with share 3's passphrase fails and wipes the shares so far.
+	remaining, err := ks.ProvideShare(2, passphrases[3])
+	if !errors.Is(err, keystore.ErrWrongPassphrase) || remaining != 3 {
+		t.Fatalf("wrong share = %d, %v, want 3, ErrWrongPassphrase", remaining, err)
+	}
+	if remaining, err := ks.ProvideShare(2, passphrases[2]); err != nil || remaining != 2 {
+		t.Fatalf("ProvideShare after a wrong share = %d, %v, want 2 remaining", remaining, err)
+	}
+
+	for _, idx := range []int{-1, 4} {
+		if _, err := ks.ProvideShare(idx, passphrases[0]); !errors.Is(err, keystore.ErrInvalidShare) {
+			t.Fatalf("ProvideShare(%d): got %v, want ErrInvalidShare", idx, err)
+		}
+	}
+}
+
+func TestDualControlWindowExpires(t *testing.T) {
+	clock := newTestClock(epoch)
+	ks, _ := newSplitStore(t, clock, 2, 2)
+	passphrases := sharePassphrases(2)
+
+	if _, err := ks.ProvideShare(0, passphrases[0]); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(5 * time.Minute)
+
+	remaining, err := ks.ProvideShare(1, passphrases[1])
+	if !errors.Is(err, keystore.ErrShareWindowExpired) || remaining != 2 {
+		t.Fatalf("ProvideShare after the window = %d, %v, want 2, ErrShareWindowExpired", remaining, err)
+	}
+	if _, err := ks.LoadPrivateKey(); !errors.Is(err, keystore.ErrKeySplit) {
+		t.Fatalf("LoadPrivateKey: got %v, want ErrKeySplit", err)
+	}
+
+	// The ceremony starts over.
+	if remaining, err := ks.ProvideShare(1, passphrases[1]); err != nil || remaining != 1 {
+		t.Fatalf("ProvideShare = %d, %v, want 1 remaining", remaining, err)
+	}
+	if remaining, err := ks.ProvideShare(0, passphrases[0]); err != nil || remaining != 0 {
+		t.Fatalf("ProvideShare = %d, %v, want 0 remaining", remaining, err)
+	}
+}
+
+func TestDualControlSplitRejected(t *testing.T) {
+	tests := []struct {
+		name        string
+		threshold   int
+		passphrases []string
+		want        error
+	}{
+		{name: "threshold above shares", threshold: 3, passphrases: sharePassphrases(2), want: keystore.ErrInvalidShare},
+		{name: "threshold of one", threshold: 1, passphrases: sharePassphrases(2), want: keystore.ErrInvalidShare},
+		{name: "empty passphrase", threshold: 2, passphrases: []string{"a", ""}, want: keystore.ErrNoPassphrase},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ks, err := keystore.NewKeystore(keystore.Config{DirPath: t.TempDir()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+				t.Fatal(err)
+			}
+			if err := ks.SplitPrimaryKey(tt.threshold, tt.passphrases...); !errors.Is(err, tt.want) {
+				t.Fatalf("SplitPrimaryKey: got %v, want %v", err, tt.want)
+			}
+			if key, err := ks.LoadPrivateKey(); err != nil || hexKey(key) != fileKeyHex {
+				t.Fatalf("key changed by a rejected split: %v", err)
+			}
+		})
+	}
+
+	ks, _ := newSplitStore(t, newTestClock(epoch), 2, 2)
+	if err := ks.SplitPrimaryKey(2, sharePassphrases(2)...); !errors.Is(err, keystore.ErrKeySplit) {
+		t.Fatalf("splitting twice: got %v, want ErrKeySplit", err)
+	}
+	if err := ks.SavePrivateKey(credentialKeyHex); !errors.Is(err, keystore.ErrKeySplit) {
+		t.Fatalf("replacing a split key: got %v, want ErrKeySplit", err)
+	}
+}
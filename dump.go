@@ -0,0 +1,269 @@
+package keystore
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// DumpFormat identifies the documents written by Dump
+const DumpFormat = "keystore-dump"
+
+const dumpVersion = 1
+
+// RedactionMode is how Dump treats one class of fields.
+type RedactionMode int
+
+// Redaction modes. The zero value omits the field, so an empty
+// RedactionPolicy reveals nothing beyond the shape of the keystore.
+const (
+	// RedactOmit leaves the field out.
+	RedactOmit RedactionMode = iota
+
+	// RedactHash replaces the value with a short unsalted SHA-256 digest,
+	// so dumps from two machines can be compared without revealing it.
+	RedactHash
+
+	// RedactInclude writes the value as is.
+	RedactInclude
+)
+
+// RedactionPolicy selects how Dump treats each class of identifying
+// fields. Secrets, such as keys, tokens and signatures, are never written
+// whatever the policy.
+type RedactionPolicy struct {
+	// Addresses covers the addresses of the primary key and accounts.
+	Addresses RedactionMode
+
+	// Fingerprints covers key fingerprints.
+	Fingerprints RedactionMode
+
+	// Labels covers account names and labels, network names and the
+	// freeze reason: text chosen by the user.
+	Labels RedactionMode
+
+	// Timestamps covers every recorded time.
+	Timestamps RedactionMode
+
+	// Paths covers the keystore location and the sources keys were
+	// imported from.
+	Paths RedactionMode
+}
+
+// Redaction presets for Dump
+var (
+	// RedactionMinimal includes every field class.
+	RedactionMinimal = RedactionPolicy{
+		Addresses:    RedactInclude,
+		Fingerprints: RedactInclude,
+		Labels:       RedactInclude,
+		Timestamps:   RedactInclude,
+		Paths:        RedactInclude,
+	}
+
+	// RedactionStrict keeps only timestamps, for deployments that must not
+	// reveal which keys or machines a report comes from.
+	RedactionStrict = RedactionPolicy{
+		Addresses:    RedactOmit,
+		Fingerprints: RedactOmit,
+		Labels:       RedactOmit,
+		Timestamps:   RedactInclude,
+		Paths:        RedactOmit,
+	}
+)
+
+// Dump writes a diagnostic description of the keystore to w as indented
+// JSON with sorted keys, so that dumps from two machines can be diffed.
+// Identifying fields are included, hashed or omitted as policy selects;
+// secret values are always omitted. Nothing is decrypted, and a missing
+// keystore yields a dump with "exists" false.
+func (s *Store) Dump(w io.Writer, policy RedactionPolicy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, err := s.status()
+	if err != nil {
+		return err
+	}
+
+	d := dumper{policy: policy}
+	doc := map[string]any{
+		"format":             DumpFormat,
+		"version":            dumpVersion,
+		"exists":             st.Exists,
+		"backend":            st.Backend,
+		"encryption_enabled": st.EncryptionEnabled,
+		"locked":             st.Locked,
+	}
+	d.set(doc, "location", policy.Paths, st.Location)
+	if st.Exists {
+		doc["schema_version"] = s.fileVersion
+		doc["revision"] = s.Rev
+		doc["file_size"] = s.fileSize
+		sections, _ := s.sections()
+		names := make(map[string]int64, len(sections))
+		for _, sec := range sections {
+			names[sec.Name] = sec.Bytes
+		}
+		doc["sections"] = names
+	}
+
+	if st.HasPrivateKey {
+		key := map[string]any{
+			"source":    st.KeySource,
+			"encrypted": st.KeyEncrypted,
+			"purpose":   s.KeyPurpose.orAny(),
+			"use_count": st.KeyUseCount,
+		}
+		d.set(key, "address", policy.Addresses, st.Address)
+		d.set(key, "fingerprint", policy.Fingerprints, st.KeyFingerprint)
+		d.set(key, "chain_id", RedactInclude, st.ChainID)
+		d.set(key, "network_name", policy.Labels, st.NetworkName)
+		d.provenance(key, st.Provenance)
+		if st.KeyLastUsedAt != nil {
+			d.time(key, "last_used_at", st.KeyLastUsedAt.Unix())
+		}
+		if s.KeyCurve != "" {
+			key["curve"] = s.KeyCurve
+		}
+		doc["primary_key"] = key
+	}
+	if s.External != nil {
+		doc["external_key"] = map[string]any{"type": s.External.Type}
+	}
+
+	doc["accounts"] = d.accounts(s, s.Accounts, true)
+	doc["trash"] = d.accounts(s, s.Trash, false)
+	if s.EncryptionAccount != "" {
+		d.set(doc, "encryption_account", policy.Labels, s.EncryptionAccount)
+	}
+
+	if st.HasToken {
+		token := map[string]any{
+			"source":       st.TokenSource,
+			"encrypted":    st.TokenEncrypted,
+			"device_bound": st.TokenDeviceBound,
+			"expired":      st.TokenExpired,
+			"attested":     s.TokenBinding != nil,
+		}
+		if st.TokenSource == "keystore" {
+			d.time(token, "created_at", s.persisted.CreatedAt)
+			d.time(token, "expires_at", s.ExpiresAt)
+		}
+		doc["token"] = token
+	}
+	doc["url_tokens"] = len(s.URLTokens)
+
+	doc["ssh_key"] = s.SSHKey != "" || s.EncryptedSSHKey != nil
+	doc["key_shares"] = s.KeyShares != nil
+	doc["escrow"] = s.Escrow != nil
+	doc["sealed_key"] = s.Sealed != nil
+	doc["manifest"] = s.Manifest != nil
+	doc["signing_policy"] = s.Policy != nil
+	d.time(doc, "mnemonic_backed_up_at", s.MnemonicBackedUpAt)
+	if s.Provisioning != nil {
+		d.time(doc, "provisioned_at", s.Provisioning.ProvisionedAt)
+	}
+	if s.Frozen != nil {
+		frozen := map[string]any{}
+		d.set(frozen, "reason", policy.Labels, s.Frozen.Reason)
+		d.time(frozen, "frozen_at", s.Frozen.FrozenAt)
+		doc["frozen"] = frozen
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode dump: %w", err)
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// dumper applies a RedactionPolicy while Dump builds its document.
+type dumper struct {
+	policy RedactionPolicy
+}
+
+// set stores v under name as mode selects. Empty values are left out.
+func (d dumper) set(m map[string]any, name string, mode RedactionMode, v string) {
+	if v == "" {
+		return
+	}
+	switch mode {
+	case RedactInclude:
+		m[name] = v
+	case RedactHash:
+		sum := sha256.Sum256([]byte(v))
+		m[name] = fmt.Sprintf("sha256:%x", sum[:8])
+	}
+}
+
+// time stores the Unix time t under name as an RFC 3339 UTC time. Zero
+// times are left out.
+func (d dumper) time(m map[string]any, name string, t int64) {
+	if t == 0 {
+		return
+	}
+	d.set(m, name, d.policy.Timestamps, time.Unix(t, 0).UTC().Format(time.RFC3339))
+}
+
+func (d dumper) provenance(m map[string]any, p *Provenance) {
+	if p == nil {
+		return
+	}
+	out := map[string]any{"origin": p.Origin}
+	d.time(out, "recorded_at", p.RecordedAt)
+	d.set(out, "source", d.policy.Paths, p.Source)
+	m["provenance"] = out
+}
+
+// accounts describes accounts in name order. With Labels omitted, names
+// are left out too and the order is still by name. Usage not yet flushed
+// is counted for live accounts.
+func (d dumper) accounts(s *Store, accounts map[string]*Account, live bool) []any {
+	names := make([]string, 0, len(accounts))
+	for name := range accounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := make([]any, 0, len(names))
+	for _, name := range names {
+		a := accounts[name]
+		entry := map[string]any{
+			"watch_only": a.WatchOnly,
+			"encrypted":  a.EncryptedKey != nil,
+			"purpose":    a.Purpose.orAny(),
+		}
+		d.set(entry, "name", d.policy.Labels, name)
+		d.set(entry, "address", d.policy.Addresses, a.Address)
+		d.set(entry, "chain_id", RedactInclude, a.ChainID)
+		d.set(entry, "network_name", d.policy.Labels, a.NetworkName)
+		if len(a.Labels) > 0 && d.policy.Labels != RedactOmit {
+			labels := make(map[string]any, len(a.Labels))
+			for k, v := range a.Labels {
+				d.set(labels, k, d.policy.Labels, v)
+			}
+			entry["labels"] = labels
+		}
+		d.provenance(entry, a.Provenance)
+		d.time(entry, "created_at", a.CreatedAt)
+		d.time(entry, "deleted_at", a.DeletedAt)
+		useCount, lastUsed := a.UseCount, a.LastUsedAt
+		if live {
+			var at *time.Time
+			if useCount, at = s.usageOf(name, a.UseCount, a.LastUsedAt); at != nil {
+				lastUsed = at.Unix()
+			}
+		}
+		if useCount > 0 {
+			entry["use_count"] = useCount
+		}
+		d.time(entry, "last_used_at", lastUsed)
+		out = append(out, entry)
+	}
+	return out
+}
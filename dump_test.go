@@ -0,0 +1,267 @@
+package keystore_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/theblitlabs/keystore"
+)
+
+const (
+	dumpToken  = "dump-secret-token"
+	dumpLabel  = "deploy-team"
+	dumpReason = "incident 42"
+)
+
+var dumpWatchAddress = common.HexToAddress("0x00000000000000000000000000000000000000c0")
+
+// dumpFixture is a keystore with one of everything Dump describes, and
+// the identifying values it holds.
+type dumpFixture struct {
+	ks          *keystore.Store
+	addresses   []string
+	paths       []string
+	labels      []string
+	fingerprint string
+}
+
+func newDumpFixture(t *testing.T, clock *testClock) dumpFixture {
+	t.Helper()
+
+	dir := t.TempDir()
+	ks := newErrorStore(t, clock.config(keystore.Config{DirPath: dir}))
+	if err := ks.SaveToken(dumpToken); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveAccount("ops", credentialKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SetAccountLabel("ops", "role", dumpLabel); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveWatchAddress("cold", dumpWatchAddress); err != nil {
+		t.Fatal(err)
+	}
+
+	// An account imported from a bundle records the bundle's path.
+	bundleDir := t.TempDir()
+	bundlePath := filepath.Join(bundleDir, "bundle")
+	other := newErrorStore(t, clock.config(keystore.Config{}))
+	if err := other.SaveAccount("payroll", envKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.ExportBundle(bundlePath, "bundle passphrase", keystore.BundleAll); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.ImportBundle(bundlePath, "bundle passphrase", keystore.FailOnConflict); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Freeze(dumpReason); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := ks.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var addresses []string
+	for _, key := range []string{fileKeyHex, credentialKeyHex, envKeyHex} {
+		addresses = append(addresses, crypto.PubkeyToAddress(mustKey(t, key).PublicKey).Hex())
+	}
+	return dumpFixture{
+		ks:          ks,
+		addresses:   append(addresses, dumpWatchAddress.Hex()),
+		paths:       []string{dir, bundleDir},
+		labels:      []string{"ops", "cold", "payroll", dumpLabel, dumpReason},
+		fingerprint: st.KeyFingerprint,
+	}
+}
+
+// dump returns the dump of ks under policy, checking that it is JSON.
+func dump(t *testing.T, ks *keystore.Store, policy keystore.RedactionPolicy) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := ks.Dump(&buf, policy); err != nil {
+		t.Fatalf("Dump: %v", err)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("Dump wrote invalid JSON: %v\n%s", err, buf.String())
+	}
+	if doc["format"] != keystore.DumpFormat {
+		t.Fatalf("Dump format = %v, want %s", doc["format"], keystore.DumpFormat)
+	}
+	return buf.String()
+}
+
+// contains reports whether out holds value in any of the forms it may be
+// written in: as is, lower-cased, without a 0x prefix or JSON-escaped.
+func contains(out, value string) bool {
+	escaped, _ := json.Marshal(value)
+	for _, form := range []string{value, strings.ToLower(value), strings.TrimPrefix(strings.ToLower(value), "0x"), strings.Trim(string(escaped), `"`)} {
+		if strings.Contains(strings.ToLower(out), strings.ToLower(form)) {
+			return true
+		}
+	}
+	return false
+}
+
+// assertOmitted fails if out contains any of values.
+func assertOmitted(t *testing.T, out, class string, values ...string) {
+	t.Helper()
+
+	for _, v := range values {
+		if contains(out, v) {
+			t.Errorf("dump contains the %s %q", class, v)
+		}
+	}
+}
+
+// assertIncluded fails unless out contains every one of values.
+func assertIncluded(t *testing.T, out, class string, values ...string) {
+	t.Helper()
+
+	for _, v := range values {
+		if !contains(out, v) {
+			t.Errorf("dump does not contain the %s %q", class, v)
+		}
+	}
+}
+
+func assertNoSecrets(t *testing.T, out string) {
+	t.Helper()
+	assertOmitted(t, out, "secret", fileKeyHex, credentialKeyHex, envKeyHex, dumpToken)
+}
+
+func TestDumpStrict(t *testing.T) {
+	f := newDumpFixture(t, newTestClock(epoch))
+	out := dump(t, f.ks, keystore.RedactionStrict)
+
+	assertNoSecrets(t, out)
+	assertOmitted(t, out, "address", f.addresses...)
+	assertOmitted(t, out, "path", f.paths...)
+	assertOmitted(t, out, "label", f.labels...)
+	assertOmitted(t, out, "fingerprint", f.fingerprint)
+	if !strings.Contains(out, epoch.Format("2006-01-02T")) {
+		t.Errorf("strict dump has no timestamps:\n%s", out)
+	}
+	for _, field := range []string{`"primary_key"`, `"accounts"`, `"token"`, `"frozen"`} {
+		if !strings.Contains(out, field) {
+			t.Errorf("strict dump lacks %s:\n%s", field, out)
+		}
+	}
+}
+
+func TestDumpMinimal(t *testing.T) {
+	f := newDumpFixture(t, newTestClock(epoch))
+	out := dump(t, f.ks, keystore.RedactionMinimal)
+
+	assertNoSecrets(t, out)
+	assertIncluded(t, out, "address", f.addresses...)
+	assertIncluded(t, out, "path", f.paths...)
+	assertIncluded(t, out, "label", f.labels...)
+	assertIncluded(t, out, "fingerprint", f.fingerprint)
+}
+
+func TestDumpPolicyClasses(t *testing.T) {
+	f := newDumpFixture(t, newTestClock(epoch))
+
+	// Each class alone is included; the others stay out.
+	out := dump(t, f.ks, keystore.RedactionPolicy{Addresses: keystore.RedactInclude})
+	assertIncluded(t, out, "address", f.addresses...)
+	assertOmitted(t, out, "path", f.paths...)
+	assertOmitted(t, out, "label", f.labels...)
+
+	out = dump(t, f.ks, keystore.RedactionPolicy{Paths: keystore.RedactInclude})
+	assertIncluded(t, out, "path", f.paths...)
+	assertOmitted(t, out, "address", f.addresses...)
+
+	out = dump(t, f.ks, keystore.RedactionPolicy{Labels: keystore.RedactInclude})
+	assertIncluded(t, out, "label", f.labels...)
+	assertOmitted(t, out, "address", f.addresses...)
+
+	// The zero policy reveals only the shape of the keystore.
+	out = dump(t, f.ks, keystore.RedactionPolicy{})
+	assertNoSecrets(t, out)
+	assertOmitted(t, out, "address", f.addresses...)
+	assertOmitted(t, out, "path", f.paths...)
+	assertOmitted(t, out, "label", f.labels...)
+	assertOmitted(t, out, "fingerprint", f.fingerprint)
+	if strings.Contains(out, epoch.Format("2006-01-02T")) {
+		t.Errorf("dump with timestamps omitted has a timestamp:\n%s", out)
+	}
+}
+
+func TestDumpHashed(t *testing.T) {
+	hashAll := keystore.RedactionPolicy{
+		Addresses:    keystore.RedactHash,
+		Fingerprints: keystore.RedactHash,
+		Labels:       keystore.RedactHash,
+		Timestamps:   keystore.RedactHash,
+		Paths:        keystore.RedactHash,
+	}
+	f := newDumpFixture(t, newTestClock(epoch))
+	out := dump(t, f.ks, hashAll)
+
+	assertNoSecrets(t, out)
+	assertOmitted(t, out, "address", f.addresses...)
+	assertOmitted(t, out, "path", f.paths...)
+	assertOmitted(t, out, "label", f.labels...)
+	assertOmitted(t, out, "fingerprint", f.fingerprint)
+	if !strings.Contains(out, `"sha256:`) {
+		t.Fatalf("hashed dump has no digests:\n%s", out)
+	}
+
+	// The same keys on another machine hash alike, so dumps can be
+	// compared; only the location, in another directory, differs.
+	other := dump(t, newDumpFixture(t, newTestClock(epoch)).ks, hashAll)
+	var a, b map[string]any
+	if err := json.Unmarshal([]byte(out), &a); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(other), &b); err != nil {
+		t.Fatal(err)
+	}
+	if a["location"] == b["location"] {
+		t.Error("locations in different directories hash alike")
+	}
+	if pa, pb := a["primary_key"].(map[string]any), b["primary_key"].(map[string]any); pa["address"] != pb["address"] {
+		t.Errorf("the same address hashes to %v and %v", pa["address"], pb["address"])
+	}
+}
+
+func TestDumpStable(t *testing.T) {
+	clock := newTestClock(epoch)
+	first := newDumpFixture(t, clock)
+	out := dump(t, first.ks, keystore.RedactionStrict)
+	if again := dump(t, first.ks, keystore.RedactionStrict); again != out {
+		t.Fatalf("two dumps of one keystore differ:\n%s\n---\n%s", out, again)
+	}
+
+	// Strict dumps leave out everything machine-specific, so the same
+	// keystore set up on two machines dumps identically.
+	second := newDumpFixture(t, newTestClock(epoch))
+	if other := dump(t, second.ks, keystore.RedactionStrict); other != out {
+		t.Fatalf("strict dumps of identical keystores differ:\n%s\n---\n%s", out, other)
+	}
+}
+
+func TestDumpMissingKeystore(t *testing.T) {
+	out := dump(t, newErrorStore(t, keystore.Config{}), keystore.RedactionMinimal)
+	var doc map[string]any
+	if err := json.Unmarshal([]byte(out), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc["exists"] != false {
+		t.Fatalf("dump of a missing keystore: exists = %v", doc["exists"])
+	}
+}
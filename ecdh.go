@@ -0,0 +1,86 @@
+package keystore
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/ecies"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// SharedSecretLength is the length in bytes of keys returned by SharedSecret
+	SharedSecretLength = 32
+
+	sharedSecretInfo = "keystore/ecdh/v1"
+)
+
+// ParsePublicKey parses a secp256k1 public key in 33-byte compressed or
+// 65-byte uncompressed SEC1 form.
+func ParsePublicKey(b []byte) (*ecdsa.PublicKey, error) {
+	var (
+		pub *ecdsa.PublicKey
+		err error
+	)
+
+	switch len(b) {
+	case 33:
+		pub, err = crypto.DecompressPubkey(b)
+	case 65:
+		pub, err = crypto.UnmarshalPubkey(b)
+	default:
+		return nil, fmt.Errorf("%w: unexpected length %d", ErrInvalidPublicKey, len(b))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPublicKey, err)
+	}
+
+	return pub, nil
+}
+
+// SharedSecret derives a symmetric key shared with the holder of peerPub:
+// secp256k1 ECDH with the encryption key, passed through HKDF-SHA256. Both
+// sides derive the same SharedSecretLength-byte key. The encryption key is
+// the account set by GenerateKeyPairSet, or else the primary key; a key for
+// signing only fails with ErrWrongKeyPurpose.
+func (s *Store) SharedSecret(peerPub *ecdsa.PublicKey) ([]byte, error) {
+	if peerPub == nil || peerPub.X == nil || peerPub.Y == nil ||
+		peerPub.Curve != crypto.S256() || !crypto.S256().IsOnCurve(peerPub.X, peerPub.Y) {
+		return nil, fmt.Errorf("%w: peer key is not a point on secp256k1", ErrInvalidPublicKey)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, err := s.encryptionKey()
+	s.audit(AuditDerive, "", err)
+	if err != nil {
+		return nil, err
+	}
+
+	shared, err := ecies.ImportECDSA(key).GenerateShared(ecies.ImportECDSAPublic(peerPub), 16, 16)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPublicKey, err)
+	}
+	defer wipe(shared)
+
+	secret := make([]byte, SharedSecretLength)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, nil, []byte(sharedSecretInfo)), secret); err != nil {
+		return nil, fmt.Errorf("failed to derive shared secret: %w", err)
+	}
+
+	return secret, nil
+}
+
+// SharedSecretBytes is SharedSecret for a peer key in compressed or
+// uncompressed byte form.
+func (s *Store) SharedSecretBytes(peerPub []byte) ([]byte, error) {
+	pub, err := ParsePublicKey(peerPub)
+	if err != nil {
+		return nil, err
+	}
+	return s.SharedSecret(pub)
+}
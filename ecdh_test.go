@@ -0,0 +1,110 @@
+package keystore_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/theblitlabs/keystore"
+)
+
+// newSharedSecretStore returns a Store holding keyHex as its primary key.
+func newSharedSecretStore(t *testing.T, keyHex string) *keystore.Store {
+	t.Helper()
+
+	ks := newErrorStore(t, keystore.Config{})
+	if err := ks.SavePrivateKey(keyHex); err != nil {
+		t.Fatal(err)
+	}
+	return ks
+}
+
+func TestSharedSecret(t *testing.T) {
+	a := newSharedSecretStore(t, fileKeyHex)
+	b := newSharedSecretStore(t, credentialKeyHex)
+	aPub, bPub := &mustKey(t, fileKeyHex).PublicKey, &mustKey(t, credentialKeyHex).PublicKey
+
+	// Both sides derive the same key.
+	ab, err := a.SharedSecret(bPub)
+	if err != nil {
+		t.Fatalf("SharedSecret: %v", err)
+	}
+	ba, err := b.SharedSecret(aPub)
+	if err != nil {
+		t.Fatalf("SharedSecret: %v", err)
+	}
+	if !bytes.Equal(ab, ba) || len(ab) != keystore.SharedSecretLength {
+		t.Fatalf("the two sides derived %x and %x, want the same %d bytes", ab, ba, keystore.SharedSecretLength)
+	}
+
+	// It is passed through the KDF rather than being the point's X
+	// coordinate.
+	x, _ := crypto.S256().ScalarMult(bPub.X, bPub.Y, mustKey(t, fileKeyHex).D.Bytes())
+	if bytes.Equal(ab, x.FillBytes(make([]byte, 32))) {
+		t.Fatal("SharedSecret returned the raw ECDH X coordinate")
+	}
+
+	// Either byte form of the peer key gives the same key.
+	for name, encoded := range map[string][]byte{
+		"compressed":   crypto.CompressPubkey(bPub),
+		"uncompressed": crypto.FromECDSAPub(bPub),
+	} {
+		got, err := a.SharedSecretBytes(encoded)
+		if err != nil || !bytes.Equal(got, ab) {
+			t.Errorf("SharedSecretBytes of the %s key = %x, %v, want %x", name, got, err, ab)
+		}
+	}
+
+	// Another peer shares another key.
+	ae, err := a.SharedSecret(&mustKey(t, envKeyHex).PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(ae, ab) {
+		t.Fatal("two peers share the same key")
+	}
+}
+
+func TestSharedSecretInvalidPeer(t *testing.T) {
+	ks := newSharedSecretStore(t, fileKeyHex)
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := mustKey(t, credentialKeyHex).PublicKey
+	offCurve := &ecdsa.PublicKey{Curve: crypto.S256(), X: new(big.Int).Set(pub.X), Y: new(big.Int).Add(pub.Y, big.NewInt(1))}
+
+	for name, peer := range map[string]*ecdsa.PublicKey{
+		"nil":               nil,
+		"point at infinity": {Curve: crypto.S256(), X: new(big.Int), Y: new(big.Int)},
+		"off the curve":     offCurve,
+		"missing Y":         {Curve: crypto.S256(), X: pub.X},
+		"P-256":             &p256.PublicKey,
+	} {
+		if _, err := ks.SharedSecret(peer); !errors.Is(err, keystore.ErrInvalidPublicKey) {
+			t.Errorf("SharedSecret with a %s key: got %v, want ErrInvalidPublicKey", name, err)
+		}
+	}
+
+	uncompressed := crypto.FromECDSAPub(&pub)
+	badPrefix := crypto.CompressPubkey(&pub)
+	badPrefix[0] = 0x05
+	for name, encoded := range map[string][]byte{
+		"empty":                 nil,
+		"infinity":              {0x00},
+		"all zero":              make([]byte, 65),
+		"zero point":            append([]byte{0x04}, make([]byte, 64)...),
+		"truncated":             uncompressed[:64],
+		"off the curve":         append([]byte{0x04}, append(offCurve.X.FillBytes(make([]byte, 32)), offCurve.Y.FillBytes(make([]byte, 32))...)...),
+		"bad compressed prefix": badPrefix,
+	} {
+		if _, err := ks.SharedSecretBytes(encoded); !errors.Is(err, keystore.ErrInvalidPublicKey) {
+			t.Errorf("SharedSecretBytes with a %s key: got %v, want ErrInvalidPublicKey", name, err)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package keystore
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	// CurveSecp256k1 is the Ethereum curve, used when no curve is recorded
+	CurveSecp256k1 = "secp256k1"
+
+	// CurveP256 is NIST P-256, also known as secp256r1
+	CurveP256 = "P-256"
+
+	// CurveP384 is NIST P-384
+	CurveP384 = "P-384"
+
+	ecPrivateKeyPEMType = "EC PRIVATE KEY"
+)
+
+// curveName returns the name of a supported curve.
+func curveName(c elliptic.Curve) (string, bool) {
+	switch c {
+	case crypto.S256():
+		return CurveSecp256k1, true
+	case elliptic.P256():
+		return CurveP256, true
+	case elliptic.P384():
+		return CurveP384, true
+	}
+	return "", false
+}
+
+// SaveECDSAKey stores priv as the primary key. Besides secp256k1 it accepts
+// P-256 and P-384 keys, which are persisted as SEC1 PEM. Such keys have no
+// Ethereum address, and the Ethereum-specific methods return
+// ErrWrongKeyType for them.
+func (s *Store) SaveECDSAKey(priv *ecdsa.PrivateKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if priv == nil {
+		return fmt.Errorf("%w: key is nil", ErrInvalidPrivateKey)
+	}
+
+	name, ok := curveName(priv.Curve)
+	if !ok {
+		return fmt.Errorf("%w: unsupported curve %s", ErrWrongKeyType, priv.Params().Name)
+	}
+
+	if name == CurveSecp256k1 {
+		privateKeyHex := hex.EncodeToString(crypto.FromECDSA(priv))
+		key, err := s.checkPrivateKey(privateKeyHex)
+		if err != nil {
+			return err
+		}
+		return s.updateScope(scopeKey, func() error {
+			return s.setPrimaryKey(privateKeyHex, key, s.newProvenance(ProvenanceImported, ""))
+		})
+	}
+
+	if err := s.checkKeySource(); err != nil {
+		return err
+	}
+	if s.config.ExpectedAddress != (common.Address{}) {
+		return fmt.Errorf("%w: %s keys have no address to check against ExpectedAddress", ErrWrongKeyType, name)
+	}
+
+	pub, err := encodePublicKey(&priv.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	der, err := x509.MarshalECPrivateKey(priv)
+	if err != nil {
+		return fmt.Errorf("failed to encode private key: %w", err)
+	}
+	text := string(pem.EncodeToMemory(&pem.Block{Type: ecPrivateKeyPEMType, Bytes: der}))
+	wipe(der)
+
+	return s.updateScope(scopeKey, func() error {
+		if err := s.setPrivateKey(text); err != nil {
+			return err
+		}
+		if s.PublicKey != pub || s.Provenance == nil {
+			s.Provenance = s.newProvenance(ProvenanceImported, "")
+		}
+		s.KeyCurve = name
+		s.Address = ""
+		s.PublicKey = pub
+		s.ChainID = ""
+		s.NetworkName = ""
+		s.UseCount = 0
+		s.LastUsedAt = 0
+		return s.escrowKey(text)
+	})
+}
+
+// LoadECDSAKey returns the primary key on whichever curve it was saved. It
+// is gated by AuthLoadPrivateKey like LoadPrivateKey.
+func (s *Store) LoadECDSAKey() (*ecdsa.PrivateKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, err := s.loadECDSAKey()
+	s.audit(AuditKeyAccess, "", err)
+	return key, err
+}
+
+func (s *Store) loadECDSAKey() (*ecdsa.PrivateKey, error) {
+	if err := s.authorized(AuthLoadPrivateKey); err != nil {
+		return nil, err
+	}
+
+	if s.creds.privateKey == "" {
+		if err := s.load(); err != nil {
+			return nil, err
+		}
+
+		if s.checkEthereumKey() != nil {
+			if err := s.frozenError(); err != nil {
+				return nil, err
+			}
+			text, err := s.privateKeyHex()
+			if err != nil {
+				return nil, err
+			}
+			return parseCurveKey(text, s.KeyCurve)
+		}
+	}
+
+	key, _, err := s.primaryKey()
+	return key, err
+}
+
+// checkEthereumKey fails with ErrWrongKeyType when the primary key is not
+// on secp256k1.
+func (s *Store) checkEthereumKey() error {
+	if s.KeyCurve != "" && s.KeyCurve != CurveSecp256k1 {
+		return fmt.Errorf("%w: primary key is %s, not %s", ErrWrongKeyType, s.KeyCurve, CurveSecp256k1)
+	}
+	return nil
+}
+
+// parseCurveKey decodes a stored non-Ethereum key and checks its curve.
+func parseCurveKey(text, curve string) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(text))
+	if block == nil || block.Type != ecPrivateKeyPEMType {
+		return nil, fmt.Errorf("%w: invalid %s private key", ErrCorruptKeystore, curve)
+	}
+	defer wipe(block.Bytes)
+
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s private key in keystore: %w", curve, err)
+	}
+
+	if name, _ := curveName(key.Curve); name != curve {
+		return nil, fmt.Errorf("%w: stored as %s, key is %s", ErrWrongKeyType, curve, key.Params().Name)
+	}
+	return key, nil
+}
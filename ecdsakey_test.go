@@ -0,0 +1,168 @@
+package keystore_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/theblitlabs/keystore"
+)
+
+func TestECDSAKeyRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		curve elliptic.Curve
+		pem   bool
+	}{
+		{name: keystore.CurveSecp256k1, curve: crypto.S256()},
+		{name: keystore.CurveP256, curve: elliptic.P256(), pem: true},
+		{name: keystore.CurveP384, curve: elliptic.P384(), pem: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			ks, err := keystore.NewKeystore(keystore.Config{DirPath: dir})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			priv, err := ecdsa.GenerateKey(tt.curve, rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ks.SaveECDSAKey(priv); err != nil {
+				t.Fatalf("SaveECDSAKey: %v", err)
+			}
+
+			data, err := os.ReadFile(filepath.Join(dir, keystore.DefaultFileName))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Contains(string(data), "BEGIN EC PRIVATE KEY"); got != tt.pem {
+				t.Fatalf("PEM in file = %v, want %v", got, tt.pem)
+			}
+
+			// A fresh Store decodes the persisted form.
+			other, err := keystore.NewKeystore(keystore.Config{DirPath: dir})
+			if err != nil {
+				t.Fatal(err)
+			}
+			loaded, err := other.LoadECDSAKey()
+			if err != nil {
+				t.Fatalf("LoadECDSAKey: %v", err)
+			}
+			if loaded.Curve != tt.curve || loaded.D.Cmp(priv.D) != 0 {
+				t.Fatal("loaded key differs from the saved one")
+			}
+
+			digest := sha256.Sum256([]byte("round trip"))
+			sig, err := ecdsa.SignASN1(rand.Reader, loaded, digest[:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ecdsa.VerifyASN1(&priv.PublicKey, digest[:], sig) {
+				t.Fatal("signature by the loaded key does not verify")
+			}
+		})
+	}
+}
+
+func TestECDSAKeyEthereumHelpers(t *testing.T) {
+	ks, err := keystore.NewKeystore(keystore.Config{DirPath: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveECDSAKey(priv); err != nil {
+		t.Fatal(err)
+	}
+
+	digest := crypto.Keccak256([]byte("payload"))
+	tx := types.NewTx(&types.LegacyTx{Nonce: 1, Gas: 21000, GasPrice: big.NewInt(1)})
+
+	checks := map[string]func() error{
+		"GetAddress":      func() error { _, err := ks.GetAddress(); return err },
+		"LoadPrivateKey":  func() error { _, err := ks.LoadPrivateKey(); return err },
+		"PublicKeyHex":    func() error { _, err := ks.PublicKeyHex(true); return err },
+		"SignDigest":      func() error { _, err := ks.SignDigest(digest); return err },
+		"SignTransaction": func() error { _, err := ks.SignTransaction(tx, big.NewInt(1)); return err },
+	}
+	for name, check := range checks {
+		if err := check(); !errors.Is(err, keystore.ErrWrongKeyType) {
+			t.Errorf("%s: got %v, want ErrWrongKeyType", name, err)
+		}
+	}
+}
+
+func TestECDSAKeyRejected(t *testing.T) {
+	ks, err := keystore.NewKeystore(keystore.Config{DirPath: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p224, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveECDSAKey(p224); !errors.Is(err, keystore.ErrWrongKeyType) {
+		t.Fatalf("P-224 key: got %v, want ErrWrongKeyType", err)
+	}
+	if err := ks.SaveECDSAKey(nil); !errors.Is(err, keystore.ErrInvalidPrivateKey) {
+		t.Fatalf("nil key: got %v, want ErrInvalidPrivateKey", err)
+	}
+}
+
+func TestECDSAKeyCurveMismatch(t *testing.T) {
+	dir := t.TempDir()
+	ks, err := keystore.NewKeystore(keystore.Config{DirPath: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveECDSAKey(priv); err != nil {
+		t.Fatal(err)
+	}
+
+	// Relabel the P-256 key as P-384 behind the Store's back.
+	path := filepath.Join(dir, keystore.DefaultFileName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	doc["key_curve"] = keystore.CurveP384
+	if data, err = json.Marshal(doc); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := keystore.NewKeystore(keystore.Config{DirPath: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.LoadECDSAKey(); !errors.Is(err, keystore.ErrWrongKeyType) {
+		t.Fatalf("LoadECDSAKey: got %v, want ErrWrongKeyType", err)
+	}
+}
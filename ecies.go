@@ -0,0 +1,46 @@
+package keystore
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/ecies"
+)
+
+// EncryptFor encrypts plaintext with ECIES so that only the holder of the
+// private key for pub can decrypt it with Store.Decrypt.
+func EncryptFor(pub *ecdsa.PublicKey, plaintext []byte) ([]byte, error) {
+	if pub == nil || pub.Curve != crypto.S256() {
+		return nil, fmt.Errorf("%w: ECIES requires a secp256k1 public key", ErrInvalidPublicKey)
+	}
+
+	ciphertext, err := ecies.Encrypt(rand.Reader, ecies.ImportECDSAPublic(pub), plaintext, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt: %w", err)
+	}
+
+	return ciphertext, nil
+}
+
+// Decrypt decrypts an ECIES ciphertext addressed to the encryption key: the
+// account set by GenerateKeyPairSet, or else the primary key. A key for
+// signing only fails with ErrWrongKeyPurpose. For encrypted keystores the
+// passphrase must be available or the Store unlocked.
+func (s *Store) Decrypt(ciphertext []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, err := s.encryptionKey()
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := ecies.ImportECDSA(key).Decrypt(ciphertext, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecryptFailed, err)
+	}
+
+	return plaintext, nil
+}
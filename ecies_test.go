@@ -0,0 +1,104 @@
+package keystore_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/theblitlabs/keystore"
+)
+
+func TestDecrypt(t *testing.T) {
+	dir := t.TempDir()
+	writer := newErrorStore(t, keystore.Config{DirPath: dir, Passphrase: keystore.StaticPassphrase("ecies")})
+	if err := writer.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	pub := &mustKey(t, fileKeyHex).PublicKey
+
+	// Without the passphrase the encrypted key cannot decrypt, until the
+	// Store is unlocked.
+	ks := newErrorStore(t, keystore.Config{DirPath: dir})
+	ciphertext, err := keystore.EncryptFor(pub, []byte("config blob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Decrypt(ciphertext); !errors.Is(err, keystore.ErrLocked) {
+		t.Fatalf("Decrypt of a locked keystore: got %v, want ErrLocked", err)
+	}
+	if err := ks.Unlock("ecies"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, plaintext := range [][]byte{{0}, []byte("config blob"), bytes.Repeat([]byte{0xa5}, 64<<10)} {
+		first, err := keystore.EncryptFor(pub, plaintext)
+		if err != nil {
+			t.Fatalf("EncryptFor of %d bytes: %v", len(plaintext), err)
+		}
+		second, err := keystore.EncryptFor(pub, plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Equal(first, second) {
+			t.Fatalf("EncryptFor of %d bytes gave the same ciphertext twice", len(plaintext))
+		}
+		for _, c := range [][]byte{first, second} {
+			got, err := ks.Decrypt(c)
+			if err != nil {
+				t.Fatalf("Decrypt of %d bytes: %v", len(plaintext), err)
+			}
+			if !bytes.Equal(got, plaintext) {
+				t.Fatalf("Decrypt returned %d bytes, want the %d encrypted", len(got), len(plaintext))
+			}
+		}
+	}
+}
+
+func TestDecryptFailures(t *testing.T) {
+	ks := newErrorStore(t, keystore.Config{})
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := keystore.EncryptFor(&mustKey(t, fileKeyHex).PublicKey, []byte("credentials"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A change anywhere, to the ephemeral key, the IV, the body or the MAC,
+	// is detected.
+	for _, i := range []int{1, 65, 65 + 16, len(ciphertext) / 2, len(ciphertext) - 1} {
+		tampered := append([]byte(nil), ciphertext...)
+		tampered[i] ^= 0x01
+		if got, err := ks.Decrypt(tampered); !errors.Is(err, keystore.ErrDecryptFailed) {
+			t.Errorf("Decrypt with byte %d changed = %q, %v, want ErrDecryptFailed", i, got, err)
+		}
+	}
+	for _, truncated := range [][]byte{nil, ciphertext[:1], ciphertext[:65], ciphertext[:len(ciphertext)-1]} {
+		if _, err := ks.Decrypt(truncated); !errors.Is(err, keystore.ErrDecryptFailed) {
+			t.Errorf("Decrypt of %d of %d bytes: got %v, want ErrDecryptFailed", len(truncated), len(ciphertext), err)
+		}
+	}
+
+	// A ciphertext for another key does not decrypt.
+	other, err := keystore.EncryptFor(&mustKey(t, credentialKeyHex).PublicKey, []byte("credentials"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ks.Decrypt(other); !errors.Is(err, keystore.ErrDecryptFailed) {
+		t.Fatalf("Decrypt with the wrong key = %q, %v, want ErrDecryptFailed", got, err)
+	}
+
+	// Only secp256k1 keys can be encrypted for.
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, pub := range map[string]*ecdsa.PublicKey{"nil": nil, "P-256": &p256.PublicKey} {
+		if _, err := keystore.EncryptFor(pub, []byte("x")); !errors.Is(err, keystore.ErrInvalidPublicKey) {
+			t.Errorf("EncryptFor a %s key: got %v, want ErrInvalidPublicKey", name, err)
+		}
+	}
+}
@@ -0,0 +1,460 @@
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// CipherAES256GCM identifies AES-256 in GCM mode
+	CipherAES256GCM = "aes-256-gcm"
+
+	// KDFScrypt identifies the scrypt key derivation function
+	KDFScrypt = "scrypt"
+
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+	saltLen      = 16
+)
+
+// PassphraseProvider supplies the passphrase protecting encrypted values.
+type PassphraseProvider interface {
+	Passphrase() (string, error)
+}
+
+// PassphraseFunc adapts a function to a PassphraseProvider.
+type PassphraseFunc func() (string, error)
+
+func (f PassphraseFunc) Passphrase() (string, error) {
+	return f()
+}
+
+// StaticPassphrase returns a PassphraseProvider that always yields p.
+func StaticPassphrase(p string) PassphraseProvider {
+	return PassphraseFunc(func() (string, error) { return p, nil })
+}
+
+// ScryptParams are the cost parameters used to derive an encryption key.
+type ScryptParams struct {
+	N int `json:"n"`
+	R int `json:"r"`
+	P int `json:"p"`
+}
+
+// EncryptedValue is the on-disk envelope of a passphrase-encrypted value.
+type EncryptedValue struct {
+	Cipher     string       `json:"cipher"`
+	KDF        string       `json:"kdf"`
+	KDFParams  ScryptParams `json:"kdfparams"`
+	Salt       string       `json:"salt"`
+	Nonce      string       `json:"nonce"`
+	Ciphertext string       `json:"ciphertext"`
+}
+
+func encryptValue(passphrase string, plaintext []byte) (*EncryptedValue, error) {
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	params := ScryptParams{N: scryptN, R: scryptR, P: scryptP}
+	gcm, err := passphraseCipher(passphrase, salt, params)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	return &EncryptedValue{
+		Cipher:     CipherAES256GCM,
+		KDF:        KDFScrypt,
+		KDFParams:  params,
+		Salt:       hex.EncodeToString(salt),
+		Nonce:      hex.EncodeToString(nonce),
+		Ciphertext: hex.EncodeToString(gcm.Seal(nil, nonce, plaintext, nil)),
+	}, nil
+}
+
+func decryptValue(passphrase string, ev *EncryptedValue) ([]byte, error) {
+	if ev.Cipher != CipherAES256GCM || ev.KDF != KDFScrypt {
+		return nil, fmt.Errorf("%w: unsupported encryption %s/%s", ErrCorruptKeystore, ev.Cipher, ev.KDF)
+	}
+
+	salt, err := hex.DecodeString(ev.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid salt: %v", ErrCorruptKeystore, err)
+	}
+
+	nonce, err := hex.DecodeString(ev.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid nonce: %v", ErrCorruptKeystore, err)
+	}
+
+	ciphertext, err := hex.DecodeString(ev.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid ciphertext: %v", ErrCorruptKeystore, err)
+	}
+
+	gcm, err := passphraseCipher(passphrase, salt, ev.KDFParams)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("%w: invalid nonce length %d", ErrCorruptKeystore, len(nonce))
+	}
+
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	return plaintext, nil
+}
+
+func passphraseCipher(passphrase string, salt []byte, params ScryptParams) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, params.N, params.R, params.P, scryptKeyLen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	defer wipe(key)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// Unlock verifies passphrase against the stored key and keeps it in memory so
+// encrypted values can be read and written without consulting the configured
+// PassphraseProvider until Lock is called.
+func (s *Store) Unlock(passphrase string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil && !isNoKeystore(err) {
+		return err
+	}
+
+	if s.EncryptedKey != nil {
+		plaintext, err := decryptValue(passphrase, s.EncryptedKey)
+		if err != nil {
+			s.countUnlockFailure()
+			return err
+		}
+		wipe(plaintext)
+	}
+
+	s.unlocked = &passphrase
+	s.resetUnlocks()
+	s.updateGauges()
+	return nil
+}
+
+// Lock forgets the passphrase supplied to Unlock, along with any key
+// decrypted with it or reconstructed from shares.
+func (s *Store) Lock() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.unlocked = nil
+	s.cache = nil
+	s.shareKey = nil
+	s.authorizedUntil = time.Time{}
+	s.exportTickets = nil
+	s.closeSigners()
+	s.wipeCeremony()
+	s.resetUnlocks()
+	s.updateGauges()
+}
+
+// IsLocked reports whether an encrypted key can be read without a passphrase
+// or, for a split key, whether its shares are still needed.
+func (s *Store) IsLocked() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.KeyShares != nil {
+		return s.shareKey == nil
+	}
+	return s.unlocked == nil && s.config.Passphrase == nil && s.config.Sealer == nil
+}
+
+// encryptionEnabled reports whether a passphrase or sealer is available for
+// writing encrypted values.
+func (s *Store) encryptionEnabled() bool {
+	return s.unlocked != nil || s.config.Passphrase != nil || s.config.Sealer != nil
+}
+
+func (s *Store) passphrase() (string, error) {
+	if s.unlocked != nil {
+		return *s.unlocked, nil
+	}
+
+	if s.config.Sealer != nil {
+		return s.sealedPassphrase()
+	}
+
+	if s.config.Passphrase == nil {
+		return "", ErrLocked
+	}
+
+	p, err := s.providerPassphrase()
+	if err != nil {
+		s.countUnlockFailure()
+		return "", fmt.Errorf("failed to obtain passphrase: %w", err)
+	}
+	return p, nil
+}
+
+// setPrivateKey stores privateKeyHex in its persisted form.
+func (s *Store) setPrivateKey(privateKeyHex string) error {
+	if s.KeyShares != nil {
+		return fmt.Errorf("%w: it cannot be replaced", ErrKeySplit)
+	}
+
+	plain, ev, err := s.sealKey(privateKeyHex)
+	if err != nil {
+		return err
+	}
+
+	s.persisted.PrivateKey = plain
+	s.EncryptedKey = ev
+	return nil
+}
+
+// privateKeyHex returns the stored key in hex form, decrypting it if needed.
+func (s *Store) privateKeyHex() (string, error) {
+	if s.KeyShares != nil {
+		return s.splitKeyHex()
+	}
+	return s.openKey(s.persisted.PrivateKey, s.EncryptedKey)
+}
+
+// sealKey returns the persisted form of privateKeyHex: an encrypted envelope
+// when a passphrase is available, otherwise the plaintext hex.
+func (s *Store) sealKey(privateKeyHex string) (string, *EncryptedValue, error) {
+	if !s.encryptionEnabled() {
+		if s.config.RequireEncryption {
+			return "", nil, ErrEncryptionRequired
+		}
+		return privateKeyHex, nil, nil
+	}
+
+	passphrase, err := s.passphrase()
+	if err != nil {
+		return "", nil, err
+	}
+
+	ev, err := encryptValue(passphrase, []byte(privateKeyHex))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to encrypt private key: %w", err)
+	}
+
+	return "", ev, nil
+}
+
+// openKey returns the hex key from its persisted form, decrypting it if needed.
+func (s *Store) openKey(plain string, ev *EncryptedValue) (string, error) {
+	if ev != nil {
+		plaintext, err := s.decryptSecret(ev)
+		if err != nil {
+			return "", err
+		}
+		defer wipe(plaintext)
+
+		return string(plaintext), nil
+	}
+
+	if plain == "" {
+		return "", ErrNoPrivateKey
+	}
+
+	if s.config.RequireEncryption {
+		return "", ErrPlaintextKey
+	}
+
+	return plain, nil
+}
+
+// setAuthToken stores the (possibly device-sealed) token value in its
+// persisted form, encrypting it when EncryptToken is set.
+func (s *Store) setAuthToken(value string) error {
+	plain, ev, err := s.sealToken(value)
+	if err != nil {
+		return err
+	}
+
+	s.persisted.AuthToken = plain
+	s.EncryptedToken = ev
+	return nil
+}
+
+// sealToken returns the persisted form of a token value.
+func (s *Store) sealToken(value string) (string, *EncryptedValue, error) {
+	if !s.config.EncryptToken {
+		return value, nil, nil
+	}
+
+	passphrase, err := s.passphrase()
+	if err != nil {
+		if errors.Is(err, ErrLocked) {
+			return "", nil, ErrEncryptionRequired
+		}
+		return "", nil, err
+	}
+
+	ev, err := encryptValue(passphrase, []byte(value))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to encrypt token: %w", err)
+	}
+
+	return "", ev, nil
+}
+
+// authToken returns the persisted token value, decrypting it if needed.
+func (s *Store) authToken() (string, error) {
+	return s.openToken(s.persisted.AuthToken, s.EncryptedToken)
+}
+
+// openToken returns a token value from its persisted form.
+func (s *Store) openToken(plain string, ev *EncryptedValue) (string, error) {
+	if ev == nil {
+		return plain, nil
+	}
+
+	plaintext, err := s.decryptSecret(ev)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// EncryptInPlace migrates a plaintext keystore to encrypted form using
+// passphrase. The token is included when Config.EncryptToken is set.
+// Already-encrypted values are left untouched, so running it again is a
+// no-op. For file-backed keystores the original is kept as a
+// .pre-encryption backup until the encrypted file has been read back and
+// verified; if verification fails the original is restored.
+func (s *Store) EncryptInPlace(passphrase string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.encryptInPlace(passphrase)
+}
+
+func (s *Store) encryptInPlace(passphrase string) error {
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	if s.EncryptedKey != nil {
+		plaintext, err := decryptValue(passphrase, s.EncryptedKey)
+		if err != nil {
+			return err
+		}
+		wipe(plaintext)
+	}
+
+	previous := s.unlocked
+	s.unlocked = &passphrase
+	defer func() { s.unlocked = previous }()
+
+	if !s.needsEncryption() {
+		// An earlier run may have stopped before removing its backup.
+		return s.finishEncryption()
+	}
+
+	var original []byte
+	err := s.update(func() error {
+		var err error
+		if original, err = s.readBackend(); err != nil {
+			return fmt.Errorf("failed to read keystore: %w", err)
+		}
+		if err := s.writeEncryptionBackup(original); err != nil {
+			return err
+		}
+		return s.encryptValues()
+	})
+	defer wipe(original)
+	if err != nil {
+		return err
+	}
+
+	if err := s.verifyEncrypted(); err != nil {
+		if rerr := s.restoreEncryptionBackup(original); rerr != nil {
+			return fmt.Errorf("encrypted keystore failed verification (%v) and could not be restored: %w", err, rerr)
+		}
+		return fmt.Errorf("encrypted keystore failed verification, original restored: %w", err)
+	}
+
+	return s.removeEncryptionBackup()
+}
+
+// needsEncryption reports whether any value that should be encrypted is
+// stored in plaintext.
+func (s *Store) needsEncryption() bool {
+	return s.hasPlaintextKey() || (s.config.EncryptToken && s.hasPlaintextToken())
+}
+
+// encryptValues encrypts every plaintext key, and the token when
+// EncryptToken is set.
+func (s *Store) encryptValues() error {
+	var err error
+
+	if s.persisted.PrivateKey != "" {
+		if err := s.setPrivateKey(s.persisted.PrivateKey); err != nil {
+			return err
+		}
+	}
+
+	if s.SSHKey != "" {
+		if s.SSHKey, s.EncryptedSSHKey, err = s.sealKey(s.SSHKey); err != nil {
+			return fmt.Errorf("failed to encrypt SSH key: %w", err)
+		}
+	}
+
+	for _, accounts := range []map[string]*Account{s.Accounts, s.Trash} {
+		for name, account := range accounts {
+			if account.PrivateKey == "" {
+				continue
+			}
+			if account.PrivateKey, account.EncryptedKey, err = s.sealKey(account.PrivateKey); err != nil {
+				return fmt.Errorf("failed to encrypt account %q: %w", name, err)
+			}
+		}
+	}
+
+	if s.config.EncryptToken && s.persisted.AuthToken != "" {
+		if err := s.setAuthToken(s.persisted.AuthToken); err != nil {
+			return err
+		}
+	}
+
+	if s.config.EncryptToken {
+		for key, entry := range s.URLTokens {
+			if entry.AuthToken == "" {
+				continue
+			}
+			if entry.AuthToken, entry.EncryptedToken, err = s.sealToken(entry.AuthToken); err != nil {
+				return fmt.Errorf("failed to encrypt token for %s: %w", key, err)
+			}
+		}
+	}
+
+	return nil
+}
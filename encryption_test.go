@@ -0,0 +1,136 @@
+package keystore_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/theblitlabs/keystore"
+)
+
+// assertNoPlaintext fails if any file under dir contains one of the hex keys.
+func assertNoPlaintext(t *testing.T, dir string, keys ...string) {
+	t.Helper()
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		lower := bytes.ToLower(data)
+		for _, key := range keys {
+			if bytes.Contains(lower, []byte(strings.ToLower(key))) {
+				t.Errorf("%s contains a plaintext private key", path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRequireEncryptionWithoutPassphrase(t *testing.T) {
+	dir := t.TempDir()
+	s, err := keystore.NewKeystore(keystore.Config{DirPath: dir, RequireEncryption: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.SavePrivateKey(fileKeyHex); !errors.Is(err, keystore.ErrEncryptionRequired) {
+		t.Errorf("SavePrivateKey: got %v, want ErrEncryptionRequired", err)
+	}
+	if err := s.SaveAccount("alice", credentialKeyHex); !errors.Is(err, keystore.ErrEncryptionRequired) {
+		t.Errorf("SaveAccount: got %v, want ErrEncryptionRequired", err)
+	}
+	key, _ := hex.DecodeString(envKeyHex)
+	if err := s.SavePrivateKeyBytes(key); !errors.Is(err, keystore.ErrEncryptionRequired) {
+		t.Errorf("SavePrivateKeyBytes: got %v, want ErrEncryptionRequired", err)
+	}
+
+	assertNoPlaintext(t, dir, fileKeyHex, credentialKeyHex, envKeyHex)
+}
+
+func TestRequireEncryptionWithPassphrase(t *testing.T) {
+	dir := t.TempDir()
+	s, err := keystore.NewKeystore(keystore.Config{
+		DirPath:           dir,
+		RequireEncryption: true,
+		Passphrase:        keystore.StaticPassphrase("correct horse"),
+		MirrorPath:        filepath.Join(dir, "mirror", "keystore.json"),
+		BackupRetain:      5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name string
+		run  func() error
+	}{
+		{"SavePrivateKey", func() error { return s.SavePrivateKey(fileKeyHex) }},
+		{"SaveAccount", func() error { return s.SaveAccount("alice", credentialKeyHex) }},
+		{"SaveToken", func() error { return s.SaveToken("token") }},
+		{"RenameAccount", func() error { return s.RenameAccount("alice", "bob") }},
+		{"SetAccountLabel", func() error { return s.SetAccountLabel("bob", "role", "ops") }},
+		{"SavePrivateKey again", func() error { return s.SavePrivateKey(envKeyHex) }},
+	}
+
+	for _, step := range steps {
+		if err := step.run(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		assertNoPlaintext(t, dir, fileKeyHex, credentialKeyHex, envKeyHex)
+	}
+
+	key, err := s.LoadPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hexKey(key); got != envKeyHex {
+		t.Errorf("private key = %s, want %s", got, envKeyHex)
+	}
+}
+
+func TestRequireEncryptionPlaintextFile(t *testing.T) {
+	dir := t.TempDir()
+	plain, err := keystore.NewKeystore(keystore.Config{DirPath: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := plain.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := keystore.NewKeystore(keystore.Config{DirPath: dir, RequireEncryption: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.LoadPrivateKey(); !errors.Is(err, keystore.ErrPlaintextKey) {
+		t.Fatalf("LoadPrivateKey: got %v, want ErrPlaintextKey", err)
+	}
+
+	if err := s.EncryptInPlace("correct horse"); err != nil {
+		t.Fatalf("EncryptInPlace: %v", err)
+	}
+	assertNoPlaintext(t, dir, fileKeyHex)
+
+	if err := s.Unlock("correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	key, err := s.LoadPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hexKey(key); got != fileKeyHex {
+		t.Errorf("private key = %s, want %s", got, fileKeyHex)
+	}
+}
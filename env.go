@@ -0,0 +1,189 @@
+package keystore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// EnvContents selects the variables Env returns.
+type EnvContents int
+
+const (
+	// EnvAddress includes ADDRESS, the checksummed primary address, and
+	// CHAIN_ID when one is recorded with the key
+	EnvAddress EnvContents = 1 << iota
+
+	// EnvToken includes AUTH_TOKEN
+	EnvToken
+
+	// EnvPrivateKey includes PRIVATE_KEY, the primary key in hex. No
+	// other value implies it, so it is only exported when named.
+	EnvPrivateKey
+
+	// EnvDefault includes the address and the token, and is used when
+	// include is zero
+	EnvDefault = EnvAddress | EnvToken
+)
+
+var envPrefixPattern = regexp.MustCompile(`^([A-Z_][A-Z0-9_]*)?$`)
+
+// Env returns the selected values as KEY=value pairs for exec.Cmd.Env,
+// each name preceded by prefix, as in "DEPLOYER_PRIVATE_KEY". A selected
+// value that is missing fails, for example with ErrNoToken or
+// ErrTokenExpired. Including EnvPrivateKey is an export of the key: it can
+// be gated with AuthEnv in Config.RequireAuthorizationFor and takes a
+// ticket under Config.RequireExportTicket.
+func (s *Store) Env(prefix string, include EnvContents, opts ...ExportOption) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.env("Env", prefix, include, opts)
+}
+
+// RunWithEnv runs cmd with the variables from Env, without a prefix, added
+// to its environment, or to that of the current process if cmd.Env is nil,
+// and waits for it to exit. The variables are never written to disk or set
+// in the current process, and cmd.Env is restored once cmd exits. cmd is
+// killed if ctx is done first.
+func (s *Store) RunWithEnv(ctx context.Context, cmd *exec.Cmd, include EnvContents, opts ...ExportOption) error {
+	s.mu.Lock()
+	env, err := s.env("RunWithEnv", "", include, opts)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	original := cmd.Env
+	base := original
+	if base == nil {
+		base = os.Environ()
+	}
+	cmd.Env = append(base[:len(base):len(base)], env...)
+	defer func() { cmd.Env = original }()
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			cmd.Process.Kill()
+		case <-done:
+		}
+	}()
+
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("%w: %v", ctx.Err(), err)
+		}
+		return err
+	}
+	return nil
+}
+
+// WriteDotEnv writes the variables from Env to a new .env file at path,
+// readable by the owner only. Unlike Env, it always needs a ticket from
+// AuthorizeExport: an ExportScopeFull ticket when the file holds the token
+// or the key, an ExportScopePublic one for the address alone. An existing
+// file is never overwritten.
+func (s *Store) WriteDotEnv(path, prefix string, include EnvContents, opts ...ExportOption) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer func() { s.audit(AuditExport, "", err) }()
+
+	if include == 0 {
+		include = EnvDefault
+	}
+	scope := ExportScopePublic
+	if include&(EnvToken|EnvPrivateKey) != 0 {
+		scope = ExportScopeFull
+	}
+	if err := s.redeemExportTicket("WriteDotEnv", scope, opts, true); err != nil {
+		return err
+	}
+
+	if _, err := os.Lstat(path); err == nil {
+		return fmt.Errorf("%w: %s", ErrExportExists, path)
+	}
+
+	// The ticket is used up; the key export needs no second one.
+	env, err := s.env("WriteDotEnv", prefix, include&^EnvPrivateKey, nil)
+	if err != nil {
+		return err
+	}
+	if include&EnvPrivateKey != 0 {
+		kv, err := s.envPrivateKey(prefix)
+		if err != nil {
+			return err
+		}
+		env = append(env, kv)
+	}
+
+	data := []byte(strings.Join(env, "\n") + "\n")
+	defer wipe(data)
+	return writeFileAtomic(path, data, DefaultFileMode)
+}
+
+func (s *Store) env(op, prefix string, include EnvContents, opts []ExportOption) ([]string, error) {
+	if !envPrefixPattern.MatchString(prefix) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidEnvPrefix, prefix)
+	}
+	if include == 0 {
+		include = EnvDefault
+	}
+	if include&^(EnvAddress|EnvToken|EnvPrivateKey) != 0 {
+		return nil, fmt.Errorf("%w: %#x", ErrUnknownEnvContents, int(include))
+	}
+
+	var env []string
+	if include&EnvAddress != 0 {
+		addr, err := s.address()
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, prefix+"ADDRESS="+addr.Hex())
+		if s.ChainID != "" {
+			env = append(env, prefix+"CHAIN_ID="+s.ChainID)
+		}
+	}
+
+	if include&EnvToken != 0 {
+		token, err := s.loadToken()
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, prefix+"AUTH_TOKEN="+token)
+	}
+
+	if include&EnvPrivateKey != 0 {
+		if err := s.redeemExport(op, ExportScopeFull, opts); err != nil {
+			return nil, err
+		}
+		kv, err := s.envPrivateKey(prefix)
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, kv)
+	}
+	return env, nil
+}
+
+func (s *Store) envPrivateKey(prefix string) (kv string, err error) {
+	defer func() { s.audit(AuditKeyAccess, "", err) }()
+
+	if err := s.authorized(AuthEnv); err != nil {
+		return "", err
+	}
+	_, privateKeyHex, err := s.primaryKey()
+	if err != nil {
+		return "", err
+	}
+	return prefix + "PRIVATE_KEY=" + privateKeyHex, nil
+}
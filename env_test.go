@@ -0,0 +1,287 @@
+package keystore_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/theblitlabs/keystore"
+)
+
+// envHelperEnv tells TestEnvHelperProcess what to do: "print" or "sleep".
+const envHelperEnv = "KEYSTORE_TEST_ENV_HELPER"
+
+// envVars are the variables Env may set, and one the tests set themselves.
+var envVars = []string{"ADDRESS", "CHAIN_ID", "AUTH_TOKEN", "PRIVATE_KEY", "ENV_TEST_BASE"}
+
+// newEnvStore returns a store with a token and a primary key for chain
+// 11155111.
+func newEnvStore(t *testing.T, cfg keystore.Config) *keystore.Store {
+	t.Helper()
+
+	ks := newErrorStore(t, cfg)
+	if err := ks.SaveToken("env-token"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SavePrivateKeyForChain(fileKeyHex, big.NewInt(11155111), "sepolia"); err != nil {
+		t.Fatal(err)
+	}
+	return ks
+}
+
+// environ returns the environment of the current process in order.
+func environ() []string {
+	env := os.Environ()
+	sort.Strings(env)
+	return env
+}
+
+// assertEnvUnchanged fails unless the environment of the current process
+// is still before.
+func assertEnvUnchanged(t *testing.T, before []string) {
+	t.Helper()
+
+	if after := environ(); strings.Join(after, "\n") != strings.Join(before, "\n") {
+		t.Fatal("the environment of the current process changed")
+	}
+	for _, name := range envVars[:4] {
+		if v, ok := os.LookupEnv(name); ok {
+			t.Fatalf("%s is set in the current process to %q", name, v)
+		}
+	}
+}
+
+// TestEnvHelperProcess is run by the RunWithEnv tests in child processes.
+// It prints the variables it was given, or sleeps.
+func TestEnvHelperProcess(t *testing.T) {
+	switch os.Getenv(envHelperEnv) {
+	case "print":
+		for _, name := range envVars {
+			if v, ok := os.LookupEnv(name); ok {
+				fmt.Printf("env %s=%s\n", name, v)
+			}
+		}
+	case "sleep":
+		time.Sleep(time.Minute)
+	default:
+		t.Skip("run by the RunWithEnv tests")
+	}
+}
+
+// helperCmd returns a command running TestEnvHelperProcess in mode, in an
+// empty directory. The mode is set in the environment of the current
+// process, which the child inherits, so callers take their snapshot of it
+// afterwards.
+func helperCmd(t *testing.T, mode string) *exec.Cmd {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("starts child processes")
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestEnvHelperProcess$")
+	cmd.Dir = t.TempDir()
+	t.Setenv(envHelperEnv, mode)
+	return cmd
+}
+
+// childEnv runs cmd with RunWithEnv and returns the variables it saw.
+func childEnv(t *testing.T, ks *keystore.Store, cmd *exec.Cmd, include keystore.EnvContents) map[string]string {
+	t.Helper()
+
+	var out strings.Builder
+	cmd.Stdout, cmd.Stderr = &out, &out
+	if err := ks.RunWithEnv(context.Background(), cmd, include); err != nil {
+		t.Fatalf("RunWithEnv: %v\n%s", err, out.String())
+	}
+	seen := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(out.String()))
+	for scanner.Scan() {
+		if kv, ok := strings.CutPrefix(scanner.Text(), "env "); ok {
+			name, value, _ := strings.Cut(kv, "=")
+			seen[name] = value
+		}
+	}
+	return seen
+}
+
+func TestEnv(t *testing.T) {
+	before := environ()
+	ks := newEnvStore(t, keystore.Config{})
+	addr := crypto.PubkeyToAddress(mustKey(t, fileKeyHex).PublicKey).Hex()
+
+	tests := []struct {
+		prefix  string
+		include keystore.EnvContents
+		want    []string
+	}{
+		{"", 0, []string{"ADDRESS=" + addr, "CHAIN_ID=11155111", "AUTH_TOKEN=env-token"}},
+		{"", keystore.EnvDefault, []string{"ADDRESS=" + addr, "CHAIN_ID=11155111", "AUTH_TOKEN=env-token"}},
+		{"DEPLOYER_", keystore.EnvToken, []string{"DEPLOYER_AUTH_TOKEN=env-token"}},
+		{"DEPLOYER_", keystore.EnvAddress, []string{"DEPLOYER_ADDRESS=" + addr, "DEPLOYER_CHAIN_ID=11155111"}},
+		{"APP_", keystore.EnvPrivateKey, []string{"APP_PRIVATE_KEY=" + fileKeyHex}},
+		{"", keystore.EnvDefault | keystore.EnvPrivateKey, []string{"ADDRESS=" + addr, "CHAIN_ID=11155111", "AUTH_TOKEN=env-token", "PRIVATE_KEY=" + fileKeyHex}},
+	}
+	for _, tt := range tests {
+		env, err := ks.Env(tt.prefix, tt.include)
+		if err != nil {
+			t.Fatalf("Env(%q, %#x): %v", tt.prefix, int(tt.include), err)
+		}
+		if strings.Join(env, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("Env(%q, %#x) = %v, want %v", tt.prefix, int(tt.include), env, tt.want)
+		}
+	}
+	assertEnvUnchanged(t, before)
+
+	for _, prefix := range []string{"lower_", "1ST_", "WITH SPACE_", "A=B"} {
+		if _, err := ks.Env(prefix, keystore.EnvDefault); !errors.Is(err, keystore.ErrInvalidEnvPrefix) {
+			t.Errorf("Env with prefix %q: got %v, want ErrInvalidEnvPrefix", prefix, err)
+		}
+	}
+	if _, err := ks.Env("", keystore.EnvPrivateKey<<1); !errors.Is(err, keystore.ErrUnknownEnvContents) {
+		t.Errorf("Env with unknown contents: got %v, want ErrUnknownEnvContents", err)
+	}
+
+	// A missing value fails rather than being left out.
+	empty := newErrorStore(t, keystore.Config{})
+	if err := empty.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if env, err := empty.Env("", keystore.EnvDefault); !errors.Is(err, keystore.ErrNoToken) {
+		t.Fatalf("Env without a token = %v, %v, want ErrNoToken", env, err)
+	}
+	if env, err := empty.Env("", keystore.EnvAddress); err != nil || len(env) != 1 {
+		t.Fatalf("Env of a key without a chain = %v, %v, want the address alone", env, err)
+	}
+}
+
+func TestRunWithEnv(t *testing.T) {
+	dir := t.TempDir()
+	ks := newEnvStore(t, keystore.Config{DirPath: dir})
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := helperCmd(t, "print")
+	before := environ()
+	seen := childEnv(t, ks, cmd, keystore.EnvDefault)
+	if seen["AUTH_TOKEN"] != "env-token" || seen["CHAIN_ID"] != "11155111" || seen["ADDRESS"] == "" {
+		t.Fatalf("child saw %v", seen)
+	}
+	if _, ok := seen["PRIVATE_KEY"]; ok {
+		t.Fatal("the private key was passed without EnvPrivateKey")
+	}
+	if cmd.Env != nil {
+		t.Fatalf("cmd.Env = %v after RunWithEnv, want it restored to nil", cmd.Env)
+	}
+	assertEnvUnchanged(t, before)
+
+	// Only an explicit opt-in passes the key.
+	seen = childEnv(t, ks, helperCmd(t, "print"), keystore.EnvPrivateKey)
+	if seen["PRIVATE_KEY"] != fileKeyHex || seen["AUTH_TOKEN"] != "" {
+		t.Fatalf("child saw %v, want the private key alone", seen)
+	}
+	assertEnvUnchanged(t, before)
+
+	// A caller's environment is extended for the child and left as given.
+	cmd = helperCmd(t, "print")
+	base := append(make([]string, 0, 16), envHelperEnv+"=print", "ENV_TEST_BASE=kept")
+	cmd.Env = base
+	seen = childEnv(t, ks, cmd, keystore.EnvToken)
+	if seen["ENV_TEST_BASE"] != "kept" || seen["AUTH_TOKEN"] != "env-token" {
+		t.Fatalf("child saw %v, want the caller's variables and the token", seen)
+	}
+	if len(cmd.Env) != 2 || base[:3][2] != "" {
+		t.Fatalf("RunWithEnv changed the caller's environment: %v", base[:3])
+	}
+
+	// Nothing is written to disk, neither where the child runs nor next
+	// to the keystore.
+	if entries, err := os.ReadDir(cmd.Dir); err != nil || len(entries) != 0 {
+		t.Fatalf("the child's directory holds %v, %v", entries, err)
+	}
+	if after, err := os.ReadDir(dir); err != nil || len(after) != len(files) {
+		t.Fatalf("the keystore directory holds %v, %v, want %v", after, err, files)
+	}
+}
+
+func TestRunWithEnvCancel(t *testing.T) {
+	ks := newEnvStore(t, keystore.Config{})
+	cmd := helperCmd(t, "sleep")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := ks.RunWithEnv(ctx, cmd, keystore.EnvDefault); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("RunWithEnv past the deadline: got %v, want context.DeadlineExceeded", err)
+	}
+	if d := time.Since(start); d > 30*time.Second {
+		t.Fatalf("RunWithEnv returned after %v, the child was not killed", d)
+	}
+
+	// A missing value fails before anything is started.
+	empty := newErrorStore(t, keystore.Config{})
+	cmd = helperCmd(t, "print")
+	if err := empty.RunWithEnv(context.Background(), cmd, keystore.EnvToken); err == nil || cmd.Process != nil {
+		t.Fatalf("RunWithEnv without a token: got %v, started %v", err, cmd.Process != nil)
+	}
+}
+
+func TestWriteDotEnv(t *testing.T) {
+	ks := newEnvStore(t, keystore.Config{Approve: approveAlways})
+	path := filepath.Join(t.TempDir(), ".env")
+
+	if err := ks.WriteDotEnv(path, "APP_", keystore.EnvDefault); !errors.Is(err, keystore.ErrExportNotAuthorized) {
+		t.Fatalf("WriteDotEnv without a ticket: got %v, want ErrExportNotAuthorized", err)
+	}
+	public, err := ks.AuthorizeExport(time.Minute, keystore.ExportScopePublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.WriteDotEnv(path, "APP_", keystore.EnvToken, keystore.WithExportTicket(public)); !errors.Is(err, keystore.ErrExportNotAuthorized) {
+		t.Fatalf("WriteDotEnv of the token with a public ticket: got %v, want ErrExportNotAuthorized", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("a refused WriteDotEnv created the file: %v", err)
+	}
+
+	full, err := ks.AuthorizeExport(time.Minute, keystore.ExportScopeFull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.WriteDotEnv(path, "APP_", keystore.EnvToken|keystore.EnvPrivateKey, keystore.WithExportTicket(full)); err != nil {
+		t.Fatalf("WriteDotEnv: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "APP_AUTH_TOKEN=env-token\nAPP_PRIVATE_KEY=" + fileKeyHex + "\n"; string(data) != want {
+		t.Fatalf(".env holds %q, want %q", data, want)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm()&0o077 != 0 {
+		t.Fatalf(".env mode = %v, %v, want owner-only", info.Mode(), err)
+	}
+
+	// An existing file is never overwritten.
+	again, err := ks.AuthorizeExport(time.Minute, keystore.ExportScopeFull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.WriteDotEnv(path, "", keystore.EnvDefault, keystore.WithExportTicket(again)); !errors.Is(err, keystore.ErrExportExists) {
+		t.Fatalf("WriteDotEnv over an existing file: got %v, want ErrExportExists", err)
+	}
+	if after, err := os.ReadFile(path); err != nil || string(after) != string(data) {
+		t.Fatalf("WriteDotEnv changed the existing file: %v", err)
+	}
+}
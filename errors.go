@@ -0,0 +1,63 @@
+package keystore
+
+import "fmt"
+
+// CorruptKeystoreError reports a keystore file that cannot be parsed, or a
+// stored field that cannot be decoded. It matches ErrCorruptKeystore and the
+// underlying error with errors.Is.
+type CorruptKeystoreError struct {
+	Path  string
+	Field string
+	Err   error
+}
+
+func (e *CorruptKeystoreError) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("%v at %s: field %s: %v", ErrCorruptKeystore, e.Path, e.Field, e.Err)
+	}
+	return fmt.Sprintf("%v at %s: %v", ErrCorruptKeystore, e.Path, e.Err)
+}
+
+func (e *CorruptKeystoreError) Unwrap() []error {
+	return []error{ErrCorruptKeystore, e.Err}
+}
+
+// corrupt reports err as corruption of field in the keystore. An empty
+// field means the document as a whole.
+func (s *Store) corrupt(field string, err error) error {
+	return &CorruptKeystoreError{Path: s.location(), Field: field, Err: err}
+}
+
+// ConfigError reports an invalid Config, or backend configuration, naming
+// the offending field. It matches ErrInvalidConfig with errors.Is.
+type ConfigError struct {
+	Field  string
+	Reason string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("%v: %s: %s", ErrInvalidConfig, e.Field, e.Reason)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return ErrInvalidConfig
+}
+
+func configError(field, reason string) error {
+	return &ConfigError{Field: field, Reason: reason}
+}
+
+// ServiceError reports a response from the keystore service that has no
+// more specific mapping. It matches ErrServiceResponse with errors.Is.
+type ServiceError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *ServiceError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrServiceResponse, e.Status)
+}
+
+func (e *ServiceError) Unwrap() error {
+	return ErrServiceResponse
+}
@@ -0,0 +1,932 @@
+package keystore_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/theblitlabs/keystore"
+	"github.com/theblitlabs/keystore/faultinject"
+)
+
+// sentinels lists every exported sentinel error of the package.
+// TestSentinelsEnumerated fails when one is added without being listed
+// here, and TestFailureModes when it has no failure mode.
+var sentinels = map[string]error{
+	"ErrEmptyToken":            keystore.ErrEmptyToken,
+	"ErrNoKeystore":            keystore.ErrNoKeystore,
+	"ErrTokenExpired":          keystore.ErrTokenExpired,
+	"ErrInvalidToken":          keystore.ErrInvalidToken,
+	"ErrNoToken":               keystore.ErrNoToken,
+	"ErrNoPrivateKey":          keystore.ErrNoPrivateKey,
+	"ErrInvalidStoredKey":      keystore.ErrInvalidStoredKey,
+	"ErrReadOnly":              keystore.ErrReadOnly,
+	"ErrDeviceMismatch":        keystore.ErrDeviceMismatch,
+	"ErrLocked":                keystore.ErrLocked,
+	"ErrWrongPassphrase":       keystore.ErrWrongPassphrase,
+	"ErrEncryptionRequired":    keystore.ErrEncryptionRequired,
+	"ErrPlaintextKey":          keystore.ErrPlaintextKey,
+	"ErrAccountNotFound":       keystore.ErrAccountNotFound,
+	"ErrAccountExists":         keystore.ErrAccountExists,
+	"ErrInvalidAccountName":    keystore.ErrInvalidAccountName,
+	"ErrInvalidAddress":        keystore.ErrInvalidAddress,
+	"ErrAddressMismatch":       keystore.ErrAddressMismatch,
+	"ErrWatchOnly":             keystore.ErrWatchOnly,
+	"ErrUnexpectedAddress":     keystore.ErrUnexpectedAddress,
+	"ErrBadChecksum":           keystore.ErrBadChecksum,
+	"ErrInvalidPublicKey":      keystore.ErrInvalidPublicKey,
+	"ErrDecryptFailed":         keystore.ErrDecryptFailed,
+	"ErrUnsupportedVersion":    keystore.ErrUnsupportedVersion,
+	"ErrAutoRefreshRunning":    keystore.ErrAutoRefreshRunning,
+	"ErrInvalidUserID":         keystore.ErrInvalidUserID,
+	"ErrUserNotFound":          keystore.ErrUserNotFound,
+	"ErrNotFileBacked":         keystore.ErrNotFileBacked,
+	"ErrExportExists":          keystore.ErrExportExists,
+	"ErrKeystoreTooLarge":      keystore.ErrKeystoreTooLarge,
+	"ErrLockTimeout":           keystore.ErrLockTimeout,
+	"ErrMergeConflict":         keystore.ErrMergeConflict,
+	"ErrInvalidBundle":         keystore.ErrInvalidBundle,
+	"ErrReadOnlyKeySource":     keystore.ErrReadOnlyKeySource,
+	"ErrChainMismatch":         keystore.ErrChainMismatch,
+	"ErrUnauthorized":          keystore.ErrUnauthorized,
+	"ErrConflict":              keystore.ErrConflict,
+	"ErrDeviceNotFound":        keystore.ErrDeviceNotFound,
+	"ErrPINBlocked":            keystore.ErrPINBlocked,
+	"ErrTouchRequired":         keystore.ErrTouchRequired,
+	"ErrNoSecretKey":           keystore.ErrNoSecretKey,
+	"ErrTPMUnavailable":        keystore.ErrTPMUnavailable,
+	"ErrPCRMismatch":           keystore.ErrPCRMismatch,
+	"ErrNoBackup":              keystore.ErrNoBackup,
+	"ErrManifestInvalid":       keystore.ErrManifestInvalid,
+	"ErrStorageReadOnly":       keystore.ErrStorageReadOnly,
+	"ErrNonInteractive":        keystore.ErrNonInteractive,
+	"ErrNoPassphrase":          keystore.ErrNoPassphrase,
+	"ErrWrongKeyType":          keystore.ErrWrongKeyType,
+	"ErrNoSSHKey":              keystore.ErrNoSSHKey,
+	"ErrNoTokenForURL":         keystore.ErrNoTokenForURL,
+	"ErrInvalidPrivateKey":     keystore.ErrInvalidPrivateKey,
+	"ErrInvalidPortable":       keystore.ErrInvalidPortable,
+	"ErrKeySplit":              keystore.ErrKeySplit,
+	"ErrInvalidShare":          keystore.ErrInvalidShare,
+	"ErrShareWindowExpired":    keystore.ErrShareWindowExpired,
+	"ErrCorruptKeystore":       keystore.ErrCorruptKeystore,
+	"ErrInvalidConfig":         keystore.ErrInvalidConfig,
+	"ErrServiceResponse":       keystore.ErrServiceResponse,
+	"ErrInvalidChainID":        keystore.ErrInvalidChainID,
+	"ErrInvalidLabel":          keystore.ErrInvalidLabel,
+	"ErrInvalidTokenTTL":       keystore.ErrInvalidTokenTTL,
+	"ErrInvalidURL":            keystore.ErrInvalidURL,
+	"ErrEmptyPassphrase":       keystore.ErrEmptyPassphrase,
+	"ErrNoEscrow":              keystore.ErrNoEscrow,
+	"ErrNoSealedKey":           keystore.ErrNoSealedKey,
+	"ErrNotDeviceBound":        keystore.ErrNotDeviceBound,
+	"ErrNoMachineID":           keystore.ErrNoMachineID,
+	"ErrAuthorizationRequired": keystore.ErrAuthorizationRequired,
+	"ErrInvalidProvenance":     keystore.ErrInvalidProvenance,
+	"ErrRecoveredFromMirror":   keystore.ErrRecoveredFromMirror,
+	"ErrNoHomeDir":             keystore.ErrNoHomeDir,
+	"ErrSignerClosed":          keystore.ErrSignerClosed,
+	"ErrPolicyViolation":       keystore.ErrPolicyViolation,
+	"ErrInvalidPolicy":         keystore.ErrInvalidPolicy,
+	"ErrKeystoreExists":        keystore.ErrKeystoreExists,
+	"ErrTransformMismatch":     keystore.ErrTransformMismatch,
+	"ErrPaperBackupDamaged":    keystore.ErrPaperBackupDamaged,
+	"ErrStoreRegistered":       keystore.ErrStoreRegistered,
+	"ErrUnknownStore":          keystore.ErrUnknownStore,
+	"ErrPrivateMaterial":       keystore.ErrPrivateMaterial,
+	"ErrAlreadyProvisioned":    keystore.ErrAlreadyProvisioned,
+	"ErrInvalidSignature":      keystore.ErrInvalidSignature,
+	"ErrKeystoreFrozen":        keystore.ErrKeystoreFrozen,
+	"ErrWrongKeyPurpose":       keystore.ErrWrongKeyPurpose,
+	"ErrExportNotAuthorized":   keystore.ErrExportNotAuthorized,
+	"ErrTokenNotAttested":      keystore.ErrTokenNotAttested,
+	"ErrGenerationUnsupported": keystore.ErrGenerationUnsupported,
+	"ErrStaleRead":             keystore.ErrStaleRead,
+	"ErrNoSecret":              keystore.ErrNoSecret,
+	"ErrSecretTooLarge":        keystore.ErrSecretTooLarge,
+	"ErrInvalidSecretName":     keystore.ErrInvalidSecretName,
+	"ErrWellKnownTestKey":      keystore.ErrWellKnownTestKey,
+	"ErrNotLeaseHolder":        keystore.ErrNotLeaseHolder,
+	"ErrInvalidExportTicket":   keystore.ErrInvalidExportTicket,
+	"ErrEmptyFreezeReason":     keystore.ErrEmptyFreezeReason,
+	"ErrInvalidRegistration":   keystore.ErrInvalidRegistration,
+	"ErrInvalidPollInterval":   keystore.ErrInvalidPollInterval,
+	"ErrUnknownLayout":         keystore.ErrUnknownLayout,
+	"ErrInvalidSecretSize":     keystore.ErrInvalidSecretSize,
+	"ErrInvalidEnvPrefix":      keystore.ErrInvalidEnvPrefix,
+	"ErrUnknownEnvContents":    keystore.ErrUnknownEnvContents,
+	"ErrInvalidLease":          keystore.ErrInvalidLease,
+	"ErrInvalidHash":           keystore.ErrInvalidHash,
+	"ErrInvalidMnemonic":       keystore.ErrInvalidMnemonic,
+	"ErrMnemonicNotConfirmed":  keystore.ErrMnemonicNotConfirmed,
+}
+
+// testedElsewhere maps sentinels whose failure modes need more setup than
+// fits in TestFailureModes to the test covering them, or to why no test
+// can reach them here.
+var testedElsewhere = map[string]string{
+	"ErrLockTimeout":        "TestStaleLockTakeover",
+	"ErrUnauthorized":       "TestHTTPBackendStatusMapping",
+	"ErrConflict":           "TestHTTPBackendStatusMapping",
+	"ErrServiceResponse":    "TestHTTPBackendStatusMapping",
+	"ErrNonInteractive":     "TestTerminalPromptNonInteractive",
+	"ErrNoBackup":           "TestRestoreBackupErrors",
+	"ErrWrongKeyType":       "TestECDSAKeyRejected",
+	"ErrKeySplit":           "TestDualControlUnlock",
+	"ErrInvalidShare":       "TestDualControlSplitRejected",
+	"ErrShareWindowExpired": "TestDualControlWindowExpires",
+	"ErrNoEscrow":           "TestEscrowDisabledStripsRecord",
+
+	"ErrDeviceNotFound": "needs a PIV hardware token",
+	"ErrPINBlocked":     "needs a PIV hardware token",
+	"ErrTouchRequired":  "needs a PIV hardware token",
+	"ErrTPMUnavailable": "needs a TPM build and device",
+	"ErrPCRMismatch":    "needs a TPM build and device",
+	"ErrNoSecretKey":    "needs gpg and a keyring",
+	"ErrNoMachineID":    "the host always has a machine id",
+	"ErrNoHomeDir":      "the user database always yields a home directory",
+}
+
+func TestSentinelsEnumerated(t *testing.T) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := map[string]bool{}
+	for _, file := range pkgs["keystore"].Files {
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.VAR {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				for _, name := range spec.(*ast.ValueSpec).Names {
+					if strings.HasPrefix(name.Name, "Err") {
+						found[name.Name] = true
+					}
+				}
+			}
+		}
+	}
+
+	for name := range found {
+		if _, ok := sentinels[name]; !ok {
+			t.Errorf("%s is not listed in sentinels", name)
+		}
+	}
+	for name := range sentinels {
+		if !found[name] {
+			t.Errorf("sentinels lists %s, which the package does not declare", name)
+		}
+	}
+}
+
+func TestSentinelsAreDistinct(t *testing.T) {
+	messages := map[string]string{}
+	for name, err := range sentinels {
+		if err == nil {
+			t.Errorf("%s is nil", name)
+			continue
+		}
+		if other, ok := messages[err.Error()]; ok {
+			t.Errorf("%s and %s share the message %q", name, other, err.Error())
+		}
+		messages[err.Error()] = name
+
+		for otherName, other := range sentinels {
+			if otherName != name && errors.Is(err, other) {
+				t.Errorf("%s matches %s", name, otherName)
+			}
+		}
+	}
+}
+
+// newErrorStore returns a Store in a fresh directory, unless cfg names one.
+func newErrorStore(t *testing.T, cfg keystore.Config) *keystore.Store {
+	t.Helper()
+
+	if cfg.DirPath == "" && cfg.Backend == nil {
+		cfg.DirPath = t.TempDir()
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = discardLogger
+	}
+	ks, err := keystore.NewKeystore(cfg)
+	if err != nil {
+		t.Fatalf("NewKeystore: %v", err)
+	}
+	return ks
+}
+
+// editKeystore rewrites the keystore file in dir with edit applied to its
+// decoded JSON.
+func editKeystore(t *testing.T, dir string, edit func(doc map[string]any)) {
+	t.Helper()
+
+	path := filepath.Join(dir, keystore.DefaultFileName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	edit(doc)
+	if data, err = json.Marshal(doc); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// nopSealer seals keys by copying them.
+type nopSealer struct{}
+
+func (nopSealer) Seal(key []byte) (*keystore.SealedKey, error) {
+	return &keystore.SealedKey{Blob: append([]byte(nil), key...)}, nil
+}
+
+func (nopSealer) Unseal(sealed *keystore.SealedKey) ([]byte, error) {
+	return append([]byte(nil), sealed.Blob...), nil
+}
+
+func TestFailureModes(t *testing.T) {
+	digest := crypto.Keccak256([]byte("failure modes"))
+	credentialAddr := crypto.PubkeyToAddress(mustKey(t, credentialKeyHex).PublicKey)
+
+	tests := []struct {
+		name string
+		want error
+		run  func(t *testing.T) error
+	}{
+		{"ErrEmptyToken", keystore.ErrEmptyToken, func(t *testing.T) error {
+			return newErrorStore(t, keystore.Config{}).SaveToken("")
+		}},
+		{"ErrNoKeystore", keystore.ErrNoKeystore, func(t *testing.T) error {
+			_, err := newErrorStore(t, keystore.Config{}).LoadToken()
+			return err
+		}},
+		{"ErrTokenExpired", keystore.ErrTokenExpired, func(t *testing.T) error {
+			clock := newTestClock(epoch)
+			ks := newErrorStore(t, clock.config(keystore.Config{TokenTTL: time.Hour}))
+			if err := ks.SaveToken("token"); err != nil {
+				t.Fatal(err)
+			}
+			clock.Advance(2 * time.Hour)
+			_, err := ks.LoadToken()
+			return err
+		}},
+		{"ErrInvalidToken", keystore.ErrInvalidToken, func(t *testing.T) error {
+			return newErrorStore(t, keystore.Config{}).SaveToken("   ")
+		}},
+		{"ErrNoToken", keystore.ErrNoToken, func(t *testing.T) error {
+			ks := newErrorStore(t, keystore.Config{})
+			if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+				t.Fatal(err)
+			}
+			_, err := ks.LoadToken()
+			return err
+		}},
+		{"ErrNoPrivateKey", keystore.ErrNoPrivateKey, func(t *testing.T) error {
+			ks := newErrorStore(t, keystore.Config{})
+			if err := ks.SaveToken("token"); err != nil {
+				t.Fatal(err)
+			}
+			_, err := ks.LoadPrivateKey()
+			return err
+		}},
+		{"ErrInvalidStoredKey", keystore.ErrInvalidStoredKey, func(t *testing.T) error {
+			dir := t.TempDir()
+			if err := newErrorStore(t, keystore.Config{DirPath: dir}).SavePrivateKey(fileKeyHex); err != nil {
+				t.Fatal(err)
+			}
+			editKeystore(t, dir, func(doc map[string]any) { doc["private_key"] = "not hex" })
+			_, err := newErrorStore(t, keystore.Config{DirPath: dir}).LoadPrivateKey()
+			return err
+		}},
+		{"ErrReadOnly", keystore.ErrReadOnly, func(t *testing.T) error {
+			ks := newErrorStore(t, keystore.Config{})
+			if err := ks.SaveToken("token"); err != nil {
+				t.Fatal(err)
+			}
+			ro, err := keystore.NewKeystoreFromFS(os.DirFS(ks.Dir()), keystore.DefaultFileName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return ro.SaveToken("other")
+		}},
+		{"ErrDeviceMismatch", keystore.ErrDeviceMismatch, func(t *testing.T) error {
+			ks := newErrorStore(t, keystore.Config{DeviceBound: true})
+			if err := ks.SaveToken("token"); err != nil {
+				t.Fatal(err)
+			}
+			return ks.RebindDevice("another-machine")
+		}},
+		{"ErrNotDeviceBound", keystore.ErrNotDeviceBound, func(t *testing.T) error {
+			ks := newErrorStore(t, keystore.Config{})
+			if err := ks.SaveToken("token"); err != nil {
+				t.Fatal(err)
+			}
+			return ks.RebindDevice("another-machine")
+		}},
+		{"ErrLocked", keystore.ErrLocked, func(t *testing.T) error {
+			dir := t.TempDir()
+			ks := newErrorStore(t, keystore.Config{DirPath: dir, Passphrase: keystore.StaticPassphrase("right")})
+			if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+				t.Fatal(err)
+			}
+			_, err := newErrorStore(t, keystore.Config{DirPath: dir}).LoadPrivateKey()
+			return err
+		}},
+		{"ErrWrongPassphrase", keystore.ErrWrongPassphrase, func(t *testing.T) error {
+			dir := t.TempDir()
+			ks := newErrorStore(t, keystore.Config{DirPath: dir, Passphrase: keystore.StaticPassphrase("right")})
+			if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+				t.Fatal(err)
+			}
+			return newErrorStore(t, keystore.Config{DirPath: dir}).Unlock("wrong")
+		}},
+		{"ErrEncryptionRequired", keystore.ErrEncryptionRequired, func(t *testing.T) error {
+			return newErrorStore(t, keystore.Config{RequireEncryption: true}).SavePrivateKey(fileKeyHex)
+		}},
+		{"ErrPlaintextKey", keystore.ErrPlaintextKey, func(t *testing.T) error {
+			dir := t.TempDir()
+			if err := newErrorStore(t, keystore.Config{DirPath: dir}).SavePrivateKey(fileKeyHex); err != nil {
+				t.Fatal(err)
+			}
+			ks := newErrorStore(t, keystore.Config{DirPath: dir, RequireEncryption: true, Passphrase: keystore.StaticPassphrase("right")})
+			_, err := ks.LoadPrivateKey()
+			return err
+		}},
+		{"ErrAccountNotFound", keystore.ErrAccountNotFound, func(t *testing.T) error {
+			ks := newErrorStore(t, keystore.Config{})
+			if err := ks.SaveToken("token"); err != nil {
+				t.Fatal(err)
+			}
+			_, err := ks.LoadAccountKey("missing")
+			return err
+		}},
+		{"ErrAccountExists", keystore.ErrAccountExists, func(t *testing.T) error {
+			ks := newErrorStore(t, keystore.Config{})
+			if err := ks.SaveAccount("a", fileKeyHex); err != nil {
+				t.Fatal(err)
+			}
+			if err := ks.SaveAccount("b", credentialKeyHex); err != nil {
+				t.Fatal(err)
+			}
+			return ks.RenameAccount("a", "b")
+		}},
+		{"ErrInvalidAccountName", keystore.ErrInvalidAccountName, func(t *testing.T) error {
+			return newErrorStore(t, keystore.Config{}).SaveAccount("", fileKeyHex)
+		}},
+		{"ErrInvalidAddress", keystore.ErrInvalidAddress, func(t *testing.T) error {
+			return keystore.ValidateChecksumAddress("0x1234")
+		}},
+		{"ErrBadChecksum", keystore.ErrBadChecksum, func(t *testing.T) error {
+			addr := []byte(credentialAddr.Hex())
+			i := bytes.IndexAny(addr[2:], "abcdefABCDEF") + 2
+			addr[i] ^= 'a' - 'A'
+			return keystore.ValidateChecksumAddress(string(addr))
+		}},
+		{"ErrAddressMismatch", keystore.ErrAddressMismatch, func(t *testing.T) error {
+			ks := newErrorStore(t, keystore.Config{})
+			if err := ks.SaveWatchAddress("watched", credentialAddr); err != nil {
+				t.Fatal(err)
+			}
+			return ks.SaveAccount("watched", fileKeyHex)
+		}},
+		{"ErrWatchOnly", keystore.ErrWatchOnly, func(t *testing.T) error {
+			ks := newErrorStore(t, keystore.Config{})
+			if err := ks.SaveWatchAddress("watched", credentialAddr); err != nil {
+				t.Fatal(err)
+			}
+			_, err := ks.LoadAccountKey("watched")
+			return err
+		}},
+		{"ErrUnexpectedAddress", keystore.ErrUnexpectedAddress, func(t *testing.T) error {
+			return newErrorStore(t, keystore.Config{ExpectedAddress: credentialAddr}).SavePrivateKey(fileKeyHex)
+		}},
+		{"ErrInvalidPublicKey", keystore.ErrInvalidPublicKey, func(t *testing.T) error {
+			_, err := keystore.ParsePublicKey([]byte{4, 1, 2, 3})
+			return err
+		}},
+		{"ErrDecryptFailed", keystore.ErrDecryptFailed, func(t *testing.T) error {
+			ks := newErrorStore(t, keystore.Config{})
+			if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+				t.Fatal(err)
+			}
+			ciphertext, err := keystore.EncryptFor(&mustKey(t, fileKeyHex).PublicKey, []byte("secret"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ciphertext[len(ciphertext)-1] ^= 1
+			_, err = ks.Decrypt(ciphertext)
+			return err
+		}},
+		{"ErrUnsupportedVersion", keystore.ErrUnsupportedVersion, func(t *testing.T) error {
+			dir := t.TempDir()
+			if err := newErrorStore(t, keystore.Config{DirPath: dir}).SaveToken("token"); err != nil {
+				t.Fatal(err)
+			}
+			editKeystore(t, dir, func(doc map[string]any) { doc["version"] = 999 })
+			_, err := newErrorStore(t, keystore.Config{DirPath: dir}).LoadToken()
+			return err
+		}},
+		{"ErrAutoRefreshRunning", keystore.ErrAutoRefreshRunning, func(t *testing.T) error {
+			ks := newErrorStore(t, keystore.Config{})
+			ctx, cancel := context.WithCancel(context.Background())
+			t.Cleanup(cancel)
+			refresh := func(context.Context) (string, time.Duration, error) { return "token", time.Hour, nil }
+			if err := ks.StartAutoRefresh(ctx, refresh, time.Minute); err != nil {
+				t.Fatal(err)
+			}
+			return ks.StartAutoRefresh(ctx, refresh, time.Minute)
+		}},
+		{"ErrInvalidUserID", keystore.ErrInvalidUserID, func(t *testing.T) error {
+			_, err := newErrorStore(t, keystore.Config{}).ForUser("../escape")
+			return err
+		}},
+		{"ErrUserNotFound", keystore.ErrUserNotFound, func(t *testing.T) error {
+			return newErrorStore(t, keystore.Config{}).DeleteUser("nobody")
+		}},
+		{"ErrNotFileBacked", keystore.ErrNotFileBacked, func(t *testing.T) error {
+			_, err := newErrorStore(t, keystore.Config{Backend: keystore.NewMemoryBackend()}).ListBackups()
+			return err
+		}},
+		{"ErrExportExists", keystore.ErrExportExists, func(t *testing.T) error {
+			ks := newErrorStore(t, keystore.Config{Approve: func() error { return nil }})
+			if err := ks.SaveToken("token"); err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(t.TempDir(), ".env")
+			if err := os.WriteFile(path, nil, 0o600); err != nil {
+				t.Fatal(err)
+			}
+			ticket, err := ks.AuthorizeExport(time.Minute, keystore.ExportScopeFull)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return ks.WriteDotEnv(path, "APP_", keystore.EnvToken, keystore.WithExportTicket(ticket))
+		}},
+		{"ErrKeystoreTooLarge", keystore.ErrKeystoreTooLarge, func(t *testing.T) error {
+			return newErrorStore(t, keystore.Config{MaxFileSize: 16}).SaveToken("token")
+		}},
+		{"ErrMergeConflict", keystore.ErrMergeConflict, func(t *testing.T) error {
+			ks := newErrorStore(t, keystore.Config{})
+			_, err := ks.Merge(filepath.Join(ks.Dir(), keystore.DefaultFileName), keystore.FailOnConflict)
+			return err
+		}},
+		{"ErrInvalidBundle", keystore.ErrInvalidBundle, func(t *testing.T) error {
+			path := filepath.Join(t.TempDir(), "bundle")
+			if err := os.WriteFile(path, []byte("not a bundle"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := newErrorStore(t, keystore.Config{}).ImportBundle(path, "passphrase", keystore.FailOnConflict)
+			return err
+		}},
+		{"ErrReadOnlyKeySource", keystore.ErrReadOnlyKeySource, func(t *testing.T) error {
+			t.Setenv("ERRORS_TEST_KEY", envKeyHex)
+			return newErrorStore(t, keystore.Config{KeyFromEnv: "ERRORS_TEST_KEY"}).SavePrivateKey(fileKeyHex)
+		}},
+		{"ErrChainMismatch", keystore.ErrChainMismatch, func(t *testing.T) error {
+			ks := newErrorStore(t, keystore.Config{})
+			if err := ks.SavePrivateKeyForChain(fileKeyHex, big.NewInt(1), "mainnet"); err != nil {
+				t.Fatal(err)
+			}
+			tx := types.NewTransaction(0, common.Address{}, big.NewInt(0), 21000, big.NewInt(1), nil)
+			_, err := ks.SignTransaction(tx, big.NewInt(5))
+			return err
+		}},
+		{"ErrManifestInvalid", keystore.ErrManifestInvalid, func(t *testing.T) error {
+			return keystore.VerifyManifest([]byte(`{}`), &mustKey(t, fileKeyHex).PublicKey)
+		}},
+		{"ErrStorageReadOnly", keystore.ErrStorageReadOnly, func(t *testing.T) error {
+			inj := faultinject.New()
+			inj.Always(keystore.FaultOpWrite, keystore.Fault{Err: syscall.EROFS})
+			return newErrorStore(t, keystore.Config{FaultInjector: inj}).SaveToken("token")
+		}},
+		{"ErrNoPassphrase", keystore.ErrNoPassphrase, func(t *testing.T) error {
+			ks := newErrorStore(t, keystore.Config{})
+			if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+				t.Fatal(err)
+			}
+			return ks.SplitPrimaryKey(2, "one", "")
+		}},
+		{"ErrNoSSHKey", keystore.ErrNoSSHKey, func(t *testing.T) error {
+			ks := newErrorStore(t, keystore.Config{})
+			if err := ks.SaveToken("token"); err != nil {
+				t.Fatal(err)
+			}
+			_, err := ks.GetSSHSigner()
+			return err
+		}},
+		{"ErrNoTokenForURL", keystore.ErrNoTokenForURL, func(t *testing.T) error {
+			ks := newErrorStore(t, keystore.Config{})
+			if err := ks.SaveToken("token"); err != nil {
+				t.Fatal(err)
+			}
+			_, err := ks.TokenForURL("https://api.example.com")
+			return err
+		}},
+		{"ErrInvalidPrivateKey", keystore.ErrInvalidPrivateKey, func(t *testing.T) error {
+			return newErrorStore(t, keystore.Config{}).SavePrivateKey("not hex")
+		}},
+		{"ErrInvalidPortable", keystore.ErrInvalidPortable, func(t *testing.T) error {
+			_, err := keystore.NewKeystoreFromPortable("not portable", "passphrase")
+			return err
+		}},
+		{"ErrCorruptKeystore", keystore.ErrCorruptKeystore, func(t *testing.T) error {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, keystore.DefaultFileName), []byte("{"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := newErrorStore(t, keystore.Config{DirPath: dir}).LoadToken()
+			return err
+		}},
+		{"ErrInvalidConfig", keystore.ErrInvalidConfig, func(t *testing.T) error {
+			_, err := keystore.NewKeystore(keystore.Config{DirPath: t.TempDir(), RequireAuthorizationFor: []string{"bogus"}})
+			return err
+		}},
+		{"ErrInvalidChainID", keystore.ErrInvalidChainID, func(t *testing.T) error {
+			return newErrorStore(t, keystore.Config{}).SavePrivateKeyForChain(fileKeyHex, big.NewInt(0), "")
+		}},
+		{"ErrInvalidLabel", keystore.ErrInvalidLabel, func(t *testing.T) error {
+			ks := newErrorStore(t, keystore.Config{})
+			if err := ks.SaveAccount("a", fileKeyHex); err != nil {
+				t.Fatal(err)
+			}
+			return ks.SetAccountLabel("a", "", "value")
+		}},
+		{"ErrInvalidTokenTTL", keystore.ErrInvalidTokenTTL, func(t *testing.T) error {
+			return newErrorStore(t, keystore.Config{}).SaveTokenWithExpiry("token", 0)
+		}},
+		{"ErrInvalidURL", keystore.ErrInvalidURL, func(t *testing.T) error {
+			_, err := keystore.NormalizeTokenURL("://")
+			return err
+		}},
+		{"ErrEmptyPassphrase", keystore.ErrEmptyPassphrase, func(t *testing.T) error {
+			ks := newErrorStore(t, keystore.Config{})
+			if err := ks.SaveToken("token"); err != nil {
+				t.Fatal(err)
+			}
+			_, err := ks.MarshalPortable("")
+			return err
+		}},
+		{"ErrNoSealedKey", keystore.ErrNoSealedKey, func(t *testing.T) error {
+			ks := newErrorStore(t, keystore.Config{Sealer: nopSealer{}})
+			if err := ks.SaveToken("token"); err != nil {
+				t.Fatal(err)
+			}
+			return ks.Reseal("")
+		}},
+		{"ErrAuthorizationRequired", keystore.ErrAuthorizationRequired, func(t *testing.T) error {
+			ks := newErrorStore(t, keystore.Config{RequireAuthorizationFor: []string{keystore.AuthLoadPrivateKey}})
+			if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+				t.Fatal(err)
+			}
+			_, err := ks.LoadPrivateKey()
+			return err
+		}},
+		{"ErrInvalidProvenance", keystore.ErrInvalidProvenance, func(t *testing.T) error {
+			ks := newErrorStore(t, keystore.Config{})
+			if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+				t.Fatal(err)
+			}
+			return ks.OverrideProvenance("", "bogus", "test")
+		}},
+		{"ErrRecoveredFromMirror", keystore.ErrRecoveredFromMirror, func(t *testing.T) error {
+			// Recovery succeeds, so the sentinel only reaches the audit hook.
+			dir := t.TempDir()
+			var audited []string
+			cfg := keystore.Config{
+				DirPath:    dir,
+				MirrorPath: filepath.Join(t.TempDir(), "mirror.json"),
+				Audit:      func(e keystore.AuditEvent) { audited = append(audited, e.Error) },
+			}
+			if err := newErrorStore(t, cfg).SaveToken("token"); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, keystore.DefaultFileName), []byte("{"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := newErrorStore(t, cfg).LoadToken(); err != nil {
+				t.Fatal(err)
+			}
+			for _, msg := range audited {
+				if strings.Contains(msg, keystore.ErrRecoveredFromMirror.Error()) {
+					return keystore.ErrRecoveredFromMirror
+				}
+			}
+			return errors.New(strings.Join(audited, "; "))
+		}},
+		{"ErrSignerClosed", keystore.ErrSignerClosed, func(t *testing.T) error {
+			ks := newErrorStore(t, keystore.Config{})
+			if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+				t.Fatal(err)
+			}
+			sg, err := ks.BatchSigner(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			sg.Close()
+			_, err = sg.SignDigests([][]byte{digest})
+			return err
+		}},
+		{"ErrPolicyViolation", keystore.ErrPolicyViolation, func(t *testing.T) error {
+			ks := newErrorStore(t, keystore.Config{})
+			if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+				t.Fatal(err)
+			}
+			if err := ks.UpdatePolicy(&keystore.SigningPolicy{Accounts: map[string]keystore.AccountPolicy{"": {}}}); err != nil {
+				t.Fatal(err)
+			}
+			_, err := ks.SignDigest(digest)
+			return err
+		}},
+		{"ErrInvalidPolicy", keystore.ErrInvalidPolicy, func(t *testing.T) error {
+			return newErrorStore(t, keystore.Config{}).UpdatePolicy(&keystore.SigningPolicy{
+				Accounts: map[string]keystore.AccountPolicy{"": {MaxTxPerHour: -1}},
+			})
+		}},
+		{"ErrKeystoreExists", keystore.ErrKeystoreExists, func(t *testing.T) error {
+			src, dst := newErrorStore(t, keystore.Config{}), newErrorStore(t, keystore.Config{})
+			if err := src.SavePrivateKey(fileKeyHex); err != nil {
+				t.Fatal(err)
+			}
+			if err := dst.SavePrivateKey(credentialKeyHex); err != nil {
+				t.Fatal(err)
+			}
+			return src.CopyTo(dst)
+		}},
+		{"ErrTransformMismatch", keystore.ErrTransformMismatch, func(t *testing.T) error {
+			dir := t.TempDir()
+			gz := newErrorStore(t, keystore.Config{DirPath: dir, Transforms: []keystore.Transform{keystore.GzipTransform{}}})
+			if err := gz.SaveToken("token"); err != nil {
+				t.Fatal(err)
+			}
+			_, err := newErrorStore(t, keystore.Config{DirPath: dir}).LoadToken()
+			return err
+		}},
+		{"ErrPaperBackupDamaged", keystore.ErrPaperBackupDamaged, func(t *testing.T) error {
+			return newErrorStore(t, keystore.Config{}).ImportPaperBackup([]string{"not a paper backup"}, "passphrase")
+		}},
+		{"ErrStoreRegistered", keystore.ErrStoreRegistered, func(t *testing.T) error {
+			m, ks := keystore.NewManager(), newErrorStore(t, keystore.Config{})
+			if err := m.Register("main", ks); err != nil {
+				t.Fatal(err)
+			}
+			return m.Register("main", ks)
+		}},
+		{"ErrUnknownStore", keystore.ErrUnknownStore, func(t *testing.T) error {
+			_, err := keystore.NewManager().Get("missing")
+			return err
+		}},
+		{"ErrPrivateMaterial", keystore.ErrPrivateMaterial, func(t *testing.T) error {
+			_, err := keystore.ParsePublicBundle([]byte(`{"format":"keystore-public-bundle","private_key":"00"}`))
+			return err
+		}},
+		{"ErrAlreadyProvisioned", keystore.ErrAlreadyProvisioned, func(t *testing.T) error {
+			ks := newErrorStore(t, keystore.Config{})
+			provision := func(p *keystore.Provisioner) error { return p.SaveToken("token") }
+			if err := ks.ProvisionOnce("prov", provision); err != nil {
+				t.Fatal(err)
+			}
+			return ks.ProvisionOnce("prov", provision)
+		}},
+		{"ErrInvalidSignature", keystore.ErrInvalidSignature, func(t *testing.T) error {
+			_, err := keystore.RecoverAddress([]byte("message"), []byte{1, 2, 3})
+			return err
+		}},
+		{"ErrKeystoreFrozen", keystore.ErrKeystoreFrozen, func(t *testing.T) error {
+			ks := newErrorStore(t, keystore.Config{})
+			if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+				t.Fatal(err)
+			}
+			if err := ks.Freeze("incident"); err != nil {
+				t.Fatal(err)
+			}
+			_, err := ks.SignDigest(digest)
+			return err
+		}},
+		{"ErrWrongKeyPurpose", keystore.ErrWrongKeyPurpose, func(t *testing.T) error {
+			ks := newErrorStore(t, keystore.Config{})
+			if err := ks.SavePrivateKeyWithPurpose(fileKeyHex, keystore.KeyPurposeEncryption); err != nil {
+				t.Fatal(err)
+			}
+			_, err := ks.SignDigest(digest)
+			return err
+		}},
+		{"ErrExportNotAuthorized", keystore.ErrExportNotAuthorized, func(t *testing.T) error {
+			ks := newErrorStore(t, keystore.Config{RequireExportTicket: true})
+			if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+				t.Fatal(err)
+			}
+			_, err := ks.MarshalPortable("passphrase")
+			return err
+		}},
+		{"ErrTokenNotAttested", keystore.ErrTokenNotAttested, func(t *testing.T) error {
+			ks := newErrorStore(t, keystore.Config{})
+			if err := ks.SaveToken("token"); err != nil {
+				t.Fatal(err)
+			}
+			_, _, err := ks.TokenAttestation()
+			return err
+		}},
+		{"ErrGenerationUnsupported", keystore.ErrGenerationUnsupported, func(t *testing.T) error {
+			b := &interleavingBackend{Backend: keystore.NewMemoryBackend()}
+			_, err := newErrorStore(t, keystore.Config{Backend: b}).Generation()
+			return err
+		}},
+		{"ErrStaleRead", keystore.ErrStaleRead, func(t *testing.T) error {
+			ks := newErrorStore(t, keystore.Config{})
+			if err := ks.SaveToken("first"); err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(ks.Dir(), keystore.DefaultFileName)
+			old, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ks.SaveToken("second"); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, old, 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, err = ks.LoadToken()
+			return err
+		}},
+		{"ErrNoSecret", keystore.ErrNoSecret, func(t *testing.T) error {
+			_, err := newErrorStore(t, keystore.Config{}).OpenSecret("missing")
+			return err
+		}},
+		{"ErrSecretTooLarge", keystore.ErrSecretTooLarge, func(t *testing.T) error {
+			return newErrorStore(t, keystore.Config{MaxSecretSize: 4}).PutSecret("big", bytes.NewReader(make([]byte, 5)), 5)
+		}},
+		{"ErrInvalidSecretName", keystore.ErrInvalidSecretName, func(t *testing.T) error {
+			return newErrorStore(t, keystore.Config{}).PutSecret("../escape", bytes.NewReader(nil), 0)
+		}},
+		{"ErrWellKnownTestKey", keystore.ErrWellKnownTestKey, func(t *testing.T) error {
+			// The first Hardhat and Anvil development account.
+			const hardhat = "ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80"
+			return newErrorStore(t, keystore.Config{Environment: keystore.EnvironmentProd}).SavePrivateKey(hardhat)
+		}},
+		{"ErrNotLeaseHolder", keystore.ErrNotLeaseHolder, func(t *testing.T) error {
+			holder := newErrorStore(t, keystore.Config{})
+			if err := holder.SavePrivateKey(fileKeyHex); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := holder.AcquireSigningLease(context.Background(), "holder", time.Minute); err != nil {
+				t.Fatal(err)
+			}
+			_, err := newErrorStore(t, keystore.Config{DirPath: holder.Dir()}).SignDigest(digest)
+			return err
+		}},
+		{"ErrInvalidExportTicket", keystore.ErrInvalidExportTicket, func(t *testing.T) error {
+			_, err := newErrorStore(t, keystore.Config{}).AuthorizeExport(0, keystore.ExportScopeFull)
+			return err
+		}},
+		{"ErrEmptyFreezeReason", keystore.ErrEmptyFreezeReason, func(t *testing.T) error {
+			return newErrorStore(t, keystore.Config{}).Freeze("")
+		}},
+		{"ErrInvalidRegistration", keystore.ErrInvalidRegistration, func(t *testing.T) error {
+			return keystore.NewManager().Register("", newErrorStore(t, keystore.Config{}))
+		}},
+		{"ErrInvalidPollInterval", keystore.ErrInvalidPollInterval, func(t *testing.T) error {
+			_, err := newErrorStore(t, keystore.Config{}).PollChanges(context.Background(), 0)
+			return err
+		}},
+		{"ErrUnknownLayout", keystore.ErrUnknownLayout, func(t *testing.T) error {
+			return newErrorStore(t, keystore.Config{}).ConvertLayout("zipped", "passphrase")
+		}},
+		{"ErrInvalidSecretSize", keystore.ErrInvalidSecretSize, func(t *testing.T) error {
+			return newErrorStore(t, keystore.Config{}).PutSecret("negative", bytes.NewReader(nil), -1)
+		}},
+		{"ErrInvalidEnvPrefix", keystore.ErrInvalidEnvPrefix, func(t *testing.T) error {
+			_, err := newErrorStore(t, keystore.Config{}).Env("lower_", keystore.EnvDefault)
+			return err
+		}},
+		{"ErrUnknownEnvContents", keystore.ErrUnknownEnvContents, func(t *testing.T) error {
+			_, err := newErrorStore(t, keystore.Config{}).Env("", keystore.EnvPrivateKey<<1)
+			return err
+		}},
+		{"ErrInvalidLease", keystore.ErrInvalidLease, func(t *testing.T) error {
+			_, err := newErrorStore(t, keystore.Config{}).AcquireSigningLease(context.Background(), "", time.Minute)
+			return err
+		}},
+		{"ErrInvalidHash", keystore.ErrInvalidHash, func(t *testing.T) error {
+			_, err := keystore.RecoverAddressFromHash(digest[:31], make([]byte, 65))
+			return err
+		}},
+		{"ErrInvalidMnemonic", keystore.ErrInvalidMnemonic, func(t *testing.T) error {
+			_, err := keystore.NewMnemonicConfirmation("too short", 1)
+			return err
+		}},
+		{"ErrMnemonicNotConfirmed", keystore.ErrMnemonicNotConfirmed, func(t *testing.T) error {
+			return newErrorStore(t, keystore.Config{}).MarkMnemonicBackedUp(nil)
+		}},
+	}
+
+	tested := map[string]bool{}
+	for _, tt := range tests {
+		tested[tt.name] = true
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.run(t)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			for name, other := range sentinels {
+				if other != tt.want && errors.Is(err, other) && !wraps[tt.name][name] {
+					t.Errorf("%v also matches %s", err, name)
+				}
+			}
+		})
+	}
+
+	for name := range sentinels {
+		if _, ok := testedElsewhere[name]; !tested[name] && !ok {
+			t.Errorf("%s has no failure mode", name)
+		}
+	}
+}
+
+// wraps lists the other sentinels a failure mode legitimately matches.
+var wraps = map[string]map[string]bool{
+	"ErrInvalidStoredKey": {"ErrCorruptKeystore": true},
+}
+
+func TestTypedErrors(t *testing.T) {
+	t.Run("CorruptKeystoreError", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := newErrorStore(t, keystore.Config{DirPath: dir}).SavePrivateKey(fileKeyHex); err != nil {
+			t.Fatal(err)
+		}
+		editKeystore(t, dir, func(doc map[string]any) { doc["private_key"] = "not hex" })
+
+		_, err := newErrorStore(t, keystore.Config{DirPath: dir}).LoadPrivateKey()
+		var cerr *keystore.CorruptKeystoreError
+		if !errors.As(err, &cerr) {
+			t.Fatalf("got %v, want a CorruptKeystoreError", err)
+		}
+		if cerr.Path != filepath.Join(dir, keystore.DefaultFileName) || cerr.Field != "private_key" {
+			t.Fatalf("path %q, field %q", cerr.Path, cerr.Field)
+		}
+		if !errors.Is(err, keystore.ErrCorruptKeystore) || !errors.Is(err, keystore.ErrInvalidStoredKey) {
+			t.Fatalf("%v does not match its sentinels", err)
+		}
+	})
+
+	t.Run("ConfigError", func(t *testing.T) {
+		_, err := keystore.NewKeystore(keystore.Config{DirPath: t.TempDir(), RequireAuthorizationFor: []string{"bogus"}})
+		var cerr *keystore.ConfigError
+		if !errors.As(err, &cerr) || cerr.Field != "RequireAuthorizationFor" {
+			t.Fatalf("got %v, want a ConfigError for RequireAuthorizationFor", err)
+		}
+	})
+
+	t.Run("ReadOnlyError", func(t *testing.T) {
+		inj := faultinject.New()
+		inj.Always(keystore.FaultOpWrite, keystore.Fault{Err: syscall.EROFS})
+		err := newErrorStore(t, keystore.Config{FaultInjector: inj}).SaveToken("token")
+
+		var rerr *keystore.ReadOnlyError
+		if !errors.As(err, &rerr) || rerr.Errno != syscall.EROFS {
+			t.Fatalf("got %v, want an EROFS ReadOnlyError", err)
+		}
+		if !errors.Is(err, syscall.EROFS) {
+			t.Fatalf("%v does not match EROFS", err)
+		}
+	})
+
+	t.Run("UnknownStoreError", func(t *testing.T) {
+		m := keystore.NewManager()
+		if err := m.Register("main", newErrorStore(t, keystore.Config{})); err != nil {
+			t.Fatal(err)
+		}
+		_, err := m.Get("other")
+		var uerr *keystore.UnknownStoreError
+		if !errors.As(err, &uerr) || uerr.Name != "other" || len(uerr.Registered) != 1 || uerr.Registered[0] != "main" {
+			t.Fatalf("got %#v", err)
+		}
+	})
+}
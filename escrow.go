@@ -0,0 +1,155 @@
+package keystore
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/ecies"
+)
+
+// EscrowFormat identifies escrow blobs
+const EscrowFormat = "keystore-escrow"
+
+// Escrow is a recovery copy of the primary key encrypted with ECIES to an
+// organizational key. Only the organization's private key can open it; the
+// keystore passphrase plays no part.
+type Escrow struct {
+	Format     string `json:"format"`
+	Recipient  string `json:"recipient"`
+	Address    string `json:"address,omitempty"`
+	KeyCurve   string `json:"key_curve,omitempty"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// EscrowBlob returns the stored escrow record, to be kept with the
+// organization's recovery material and opened offline by RecoverFromEscrow.
+func (s *Store) EscrowBlob(opts ...ExportOption) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.redeemExport("EscrowBlob", ExportScopeFull, opts); err != nil {
+		return nil, err
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if err := s.frozenError(); err != nil {
+		return nil, err
+	}
+	if s.Escrow == nil {
+		return nil, ErrNoEscrow
+	}
+	return json.Marshal(s.Escrow)
+}
+
+// RecoverFromEscrow decrypts an escrow record with the organization's
+// private key and returns the escrowed key as stored: hex for secp256k1
+// keys, SEC1 PEM for other curves. escrowBlob may be a record from
+// EscrowBlob or a whole keystore file. Tampering with any field of the
+// record makes recovery fail.
+func RecoverFromEscrow(escrowBlob []byte, orgPrivateKey *ecdsa.PrivateKey) (string, error) {
+	if orgPrivateKey == nil || orgPrivateKey.Curve != crypto.S256() {
+		return "", fmt.Errorf("%w: escrow requires a secp256k1 organization key", ErrInvalidPublicKey)
+	}
+
+	var record Escrow
+	if err := json.Unmarshal(escrowBlob, &record); err != nil {
+		return "", fmt.Errorf("invalid escrow record: %w", err)
+	}
+	if record.Format != EscrowFormat {
+		var doc struct {
+			Escrow *Escrow `json:"escrow"`
+		}
+		if json.Unmarshal(escrowBlob, &doc) != nil || doc.Escrow == nil || doc.Escrow.Format != EscrowFormat {
+			return "", fmt.Errorf("%w: not an escrow record or keystore with escrow", ErrNoEscrow)
+		}
+		record = *doc.Escrow
+	}
+
+	if want := escrowRecipient(&orgPrivateKey.PublicKey); record.Recipient != want {
+		return "", fmt.Errorf("%w: escrow is for recipient %s, key is %s", ErrDecryptFailed, record.Recipient, want)
+	}
+
+	plaintext, err := ecies.ImportECDSA(orgPrivateKey).Decrypt(record.Ciphertext, nil, escrowSharedInfo(&record))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrDecryptFailed, err)
+	}
+	defer wipe(plaintext)
+
+	return string(plaintext), nil
+}
+
+// escrowRecipient identifies an organization key by fingerprint.
+func escrowRecipient(pub *ecdsa.PublicKey) string {
+	return keyFingerprint(crypto.CompressPubkey(pub))
+}
+
+// escrowSharedInfo binds the record's metadata into the ECIES MAC.
+func escrowSharedInfo(record *Escrow) []byte {
+	return []byte(record.Format + "\x00" + record.Recipient + "\x00" + record.Address + "\x00" + record.KeyCurve)
+}
+
+// escrowKey records secret, the primary key in its stored plaintext form,
+// encrypted to Config.EscrowPublicKey.
+func (s *Store) escrowKey(secret string) error {
+	pub := s.config.EscrowPublicKey
+	if pub == nil {
+		s.Escrow = nil
+		return nil
+	}
+
+	record := &Escrow{
+		Format:    EscrowFormat,
+		Recipient: escrowRecipient(pub),
+		Address:   s.Address,
+		KeyCurve:  s.KeyCurve,
+	}
+
+	ciphertext, err := ecies.Encrypt(rand.Reader, ecies.ImportECDSAPublic(pub), []byte(secret), nil, escrowSharedInfo(record))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt escrow copy: %w", err)
+	}
+	record.Ciphertext = ciphertext
+
+	s.Escrow = record
+	return nil
+}
+
+// syncEscrow runs before each save: it strips the escrow record when
+// escrow is disabled, and re-escrows the key when the organization key
+// changed or no record exists yet, provided the key can be read.
+func (s *Store) syncEscrow() {
+	pub := s.config.EscrowPublicKey
+	if pub == nil {
+		s.Escrow = nil
+		return
+	}
+
+	if s.persisted.PrivateKey == "" && s.EncryptedKey == nil && s.KeyShares == nil {
+		s.Escrow = nil
+		return
+	}
+
+	if s.Escrow != nil && s.Escrow.Recipient == escrowRecipient(pub) && s.Escrow.Address == s.Address {
+		return
+	}
+
+	secret, err := s.privateKeyHex()
+	if err == nil {
+		err = s.escrowKey(secret)
+	}
+	if err != nil {
+		s.config.Logger.Warn("keystore: failed to update escrow copy", "error", err)
+	}
+}
+
+func validateEscrowConfig(cfg Config) error {
+	if pub := cfg.EscrowPublicKey; pub != nil && pub.Curve != crypto.S256() {
+		return fmt.Errorf("%w: EscrowPublicKey must be a secp256k1 key", ErrInvalidPublicKey)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package keystore_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/theblitlabs/keystore"
+)
+
+func newEscrowStore(t *testing.T, dir string, org *ecdsa.PrivateKey) *keystore.Store {
+	t.Helper()
+
+	cfg := keystore.Config{DirPath: dir, Passphrase: keystore.StaticPassphrase("user")}
+	if org != nil {
+		cfg.EscrowPublicKey = &org.PublicKey
+	}
+	ks, err := keystore.NewKeystore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ks
+}
+
+func TestEscrowRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	org := mustKey(t, envKeyHex)
+	ks := newEscrowStore(t, dir, org)
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+
+	blob, err := ks.EscrowBlob()
+	if err != nil {
+		t.Fatalf("EscrowBlob: %v", err)
+	}
+	if got, err := keystore.RecoverFromEscrow(blob, org); err != nil || got != fileKeyHex {
+		t.Fatalf("RecoverFromEscrow = %q, %v", got, err)
+	}
+
+	// A whole keystore file works as the blob too.
+	file, err := os.ReadFile(filepath.Join(dir, keystore.DefaultFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := keystore.RecoverFromEscrow(file, org); err != nil || got != fileKeyHex {
+		t.Fatalf("RecoverFromEscrow from the file = %q, %v", got, err)
+	}
+
+	// Neither the user's own key nor any other key opens it.
+	for name, key := range map[string]*ecdsa.PrivateKey{
+		"user key":  mustKey(t, fileKeyHex),
+		"other key": mustKey(t, credentialKeyHex),
+	} {
+		if _, err := keystore.RecoverFromEscrow(blob, key); !errors.Is(err, keystore.ErrDecryptFailed) {
+			t.Errorf("%s: got %v, want ErrDecryptFailed", name, err)
+		}
+	}
+}
+
+func TestEscrowTamper(t *testing.T) {
+	org := mustKey(t, envKeyHex)
+	ks := newEscrowStore(t, t.TempDir(), org)
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	blob, err := ks.EscrowBlob()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(*keystore.Escrow)
+		want   error
+	}{
+		{name: "address", tamper: func(e *keystore.Escrow) { e.Address = "0x0000000000000000000000000000000000000001" }, want: keystore.ErrDecryptFailed},
+		{name: "curve", tamper: func(e *keystore.Escrow) { e.KeyCurve = keystore.CurveP256 }, want: keystore.ErrDecryptFailed},
+		{name: "recipient", tamper: func(e *keystore.Escrow) { e.Recipient = strings.Repeat("0", len(e.Recipient)) }, want: keystore.ErrDecryptFailed},
+		{name: "ciphertext", tamper: func(e *keystore.Escrow) { e.Ciphertext[len(e.Ciphertext)/2] ^= 1 }, want: keystore.ErrDecryptFailed},
+		{name: "truncated", tamper: func(e *keystore.Escrow) { e.Ciphertext = e.Ciphertext[:20] }, want: keystore.ErrDecryptFailed},
+		{name: "format", tamper: func(e *keystore.Escrow) { e.Format = "other" }, want: keystore.ErrNoEscrow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var record keystore.Escrow
+			if err := json.Unmarshal(blob, &record); err != nil {
+				t.Fatal(err)
+			}
+			tt.tamper(&record)
+			tampered, err := json.Marshal(record)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := keystore.RecoverFromEscrow(tampered, org); !errors.Is(err, tt.want) {
+				t.Fatalf("RecoverFromEscrow: got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEscrowDisabledStripsRecord(t *testing.T) {
+	dir := t.TempDir()
+	org := mustKey(t, envKeyHex)
+	if err := newEscrowStore(t, dir, org).SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+
+	ks := newEscrowStore(t, dir, nil)
+	if err := ks.SaveToken("token"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.EscrowBlob(); !errors.Is(err, keystore.ErrNoEscrow) {
+		t.Fatalf("EscrowBlob after disabling escrow: got %v, want ErrNoEscrow", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, keystore.DefaultFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), keystore.EscrowFormat) {
+		t.Fatal("escrow record left in the file")
+	}
+
+	// Enabling it again escrows the existing key on the next save.
+	again := newEscrowStore(t, dir, org)
+	if err := again.SaveToken("token"); err != nil {
+		t.Fatal(err)
+	}
+	blob, err := again.EscrowBlob()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := keystore.RecoverFromEscrow(blob, org); err != nil || got != fileKeyHex {
+		t.Fatalf("RecoverFromEscrow = %q, %v", got, err)
+	}
+}
+
+func TestEscrowNISTKey(t *testing.T) {
+	org := mustKey(t, envKeyHex)
+	ks := newEscrowStore(t, t.TempDir(), org)
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveECDSAKey(priv); err != nil {
+		t.Fatal(err)
+	}
+
+	blob, err := ks.EscrowBlob()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := keystore.RecoverFromEscrow(blob, org)
+	if err != nil || !strings.Contains(got, "EC PRIVATE KEY") {
+		t.Fatalf("RecoverFromEscrow = %q, %v, want a PEM key", got, err)
+	}
+}
+
+func TestEscrowRequiresSecp256k1(t *testing.T) {
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = keystore.NewKeystore(keystore.Config{DirPath: t.TempDir(), EscrowPublicKey: &p256.PublicKey})
+	if !errors.Is(err, keystore.ErrInvalidPublicKey) {
+		t.Fatalf("NewKeystore with a P-256 escrow key: got %v, want ErrInvalidPublicKey", err)
+	}
+	if _, err := keystore.RecoverFromEscrow([]byte("{}"), p256); !errors.Is(err, keystore.ErrInvalidPublicKey) {
+		t.Fatalf("RecoverFromEscrow with a P-256 key: got %v, want ErrInvalidPublicKey", err)
+	}
+}
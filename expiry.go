@@ -0,0 +1,94 @@
+package keystore
+
+import (
+	"sync"
+	"time"
+)
+
+type expiryWatcher struct {
+	lead  time.Duration
+	ch    chan time.Time
+	timer func() bool
+	once  sync.Once
+}
+
+func (w *expiryWatcher) fire(now time.Time) {
+	w.once.Do(func() { w.ch <- now })
+}
+
+func (w *expiryWatcher) stop() {
+	if w.timer != nil {
+		w.timer()
+		w.timer = nil
+	}
+}
+
+// NotifyBeforeExpiry returns a channel that receives the current time once,
+// when lead remains before the stored token expires. It fires immediately if
+// no token is stored or the token is already within lead of expiring. Saving
+// a new token through this Store re-arms the timer for the new expiry; saves
+// made by other processes are not observed.
+//
+// The returned function cancels the notification and must be called to
+// release the watcher. The channel is never closed.
+func (s *Store) NotifyBeforeExpiry(lead time.Duration) (<-chan time.Time, func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w := &expiryWatcher{lead: lead, ch: make(chan time.Time, 1)}
+	if s.armWatcher(w) {
+		if s.watchers == nil {
+			s.watchers = make(map[*expiryWatcher]struct{})
+		}
+		s.watchers[w] = struct{}{}
+	}
+
+	cancel := func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		w.stop()
+		delete(s.watchers, w)
+	}
+
+	return w.ch, cancel
+}
+
+// armWatcher schedules w against the stored token's expiry, firing it right
+// away when that moment has already passed. It reports whether w is still
+// pending.
+func (s *Store) armWatcher(w *expiryWatcher) bool {
+	if s.creds.authToken != "" {
+		return true
+	}
+
+	if err := s.load(); err != nil || (s.persisted.AuthToken == "" && s.EncryptedToken == nil) {
+		w.fire(s.now())
+		return false
+	}
+
+	delay := time.Unix(s.ExpiresAt, 0).Add(-w.lead).Sub(s.now())
+	if delay <= 0 {
+		w.fire(s.now())
+		return false
+	}
+
+	w.timer = s.afterFunc(delay, func() {
+		w.fire(s.now())
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.watchers, w)
+	})
+	return true
+}
+
+// rearmWatchers reschedules pending watchers after the token changed.
+func (s *Store) rearmWatchers() {
+	for w := range s.watchers {
+		w.stop()
+		if !s.armWatcher(w) {
+			delete(s.watchers, w)
+		}
+	}
+}
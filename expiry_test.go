@@ -0,0 +1,123 @@
+package keystore_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/theblitlabs/keystore"
+)
+
+func TestNotifyBeforeExpiry(t *testing.T) {
+	clock := newTestClock(epoch)
+	s, err := keystore.NewKeystore(clock.config(keystore.Config{DirPath: t.TempDir(), TokenTTL: time.Hour}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveToken("token"); err != nil {
+		t.Fatal(err)
+	}
+
+	due, cancel := s.NotifyBeforeExpiry(10 * time.Minute)
+	defer cancel()
+
+	clock.Advance(49 * time.Minute)
+	select {
+	case <-due:
+		t.Fatal("notification fired 11 minutes before expiry")
+	default:
+	}
+
+	clock.Advance(time.Minute)
+	select {
+	case at := <-due:
+		if want := epoch.Add(50 * time.Minute); !at.Equal(want) {
+			t.Errorf("notified at %v, want %v", at, want)
+		}
+	default:
+		t.Fatal("notification did not fire 10 minutes before expiry")
+	}
+}
+
+func TestNotifyBeforeExpiryRearmsOnSave(t *testing.T) {
+	clock := newTestClock(epoch)
+	s, err := keystore.NewKeystore(clock.config(keystore.Config{DirPath: t.TempDir(), TokenTTL: time.Hour}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveToken("token"); err != nil {
+		t.Fatal(err)
+	}
+
+	due, cancel := s.NotifyBeforeExpiry(10 * time.Minute)
+	defer cancel()
+
+	clock.Advance(30 * time.Minute)
+	if err := s.SaveToken("refreshed"); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(30 * time.Minute)
+	select {
+	case <-due:
+		t.Fatal("notification fired for the replaced token")
+	default:
+	}
+
+	clock.Advance(20 * time.Minute)
+	select {
+	case <-due:
+	default:
+		t.Fatal("notification did not fire for the new token")
+	}
+}
+
+func TestNotifyBeforeExpiryImmediate(t *testing.T) {
+	clock := newTestClock(epoch)
+	s, err := keystore.NewKeystore(clock.config(keystore.Config{DirPath: t.TempDir(), TokenTTL: time.Hour}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	due, cancel := s.NotifyBeforeExpiry(time.Minute)
+	defer cancel()
+	select {
+	case <-due:
+	default:
+		t.Fatal("notification did not fire without a stored token")
+	}
+
+	if err := s.SaveToken("token"); err != nil {
+		t.Fatal(err)
+	}
+	due, cancel = s.NotifyBeforeExpiry(2 * time.Hour)
+	defer cancel()
+	select {
+	case <-due:
+	default:
+		t.Fatal("notification did not fire for a token already within lead")
+	}
+}
+
+func TestNotifyBeforeExpiryCancel(t *testing.T) {
+	clock := newTestClock(epoch)
+	s, err := keystore.NewKeystore(clock.config(keystore.Config{DirPath: t.TempDir(), TokenTTL: time.Hour}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveToken("token"); err != nil {
+		t.Fatal(err)
+	}
+
+	due, cancel := s.NotifyBeforeExpiry(10 * time.Minute)
+	cancel()
+	if n := clock.Pending(); n != 0 {
+		t.Errorf("%d timers pending after cancel", n)
+	}
+
+	clock.Advance(time.Hour)
+	select {
+	case <-due:
+		t.Fatal("cancelled notification fired")
+	default:
+	}
+}
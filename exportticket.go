@@ -0,0 +1,140 @@
+package keystore
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+const exportTicketIDSize = 16
+
+// ExportScope is what an ExportTicket allows.
+type ExportScope int
+
+// Export scopes
+const (
+	// ExportScopePublic allows PublicBundle and WriteDotEnv of the
+	// address alone.
+	ExportScopePublic ExportScope = iota + 1
+
+	// ExportScopeFull allows the exports that carry private keys, in
+	// encrypted form: ExportBundle, ExportPaperBackup, MarshalPortable,
+	// ExportToKeystoreDir and EscrowBlob, as well as Env and RunWithEnv
+	// with EnvPrivateKey and WriteDotEnv with the token or the key.
+	ExportScopeFull
+)
+
+func (sc ExportScope) String() string {
+	switch sc {
+	case ExportScopePublic:
+		return "public"
+	case ExportScopeFull:
+		return "full"
+	default:
+		return fmt.Sprintf("ExportScope(%d)", int(sc))
+	}
+}
+
+// ExportTicket authorizes one export of its scope until ExpiresAt. It is
+// issued by AuthorizeExport and presented with WithExportTicket.
+type ExportTicket struct {
+	ID        string      `json:"id"`
+	Scope     ExportScope `json:"scope"`
+	ExpiresAt time.Time   `json:"expires_at"`
+}
+
+// ExportOption modifies an export.
+type ExportOption func(*exportOptions)
+
+type exportOptions struct {
+	ticket *ExportTicket
+}
+
+// WithExportTicket presents ticket for an export. It is needed with
+// Config.RequireExportTicket, and checked whenever given.
+func WithExportTicket(ticket ExportTicket) ExportOption {
+	return func(o *exportOptions) { o.ticket = &ticket }
+}
+
+type exportGrant struct {
+	scope     ExportScope
+	expiresAt time.Time
+}
+
+// AuthorizeExport obtains fresh approval, as Authorize does, and issues a
+// ticket allowing one export of scope within d. Tickets live in this Store
+// only: they are not persisted, and Lock, WipeSecrets and Close discard
+// them.
+func (s *Store) AuthorizeExport(d time.Duration, scope ExportScope) (ticket ExportTicket, err error) {
+	if d <= 0 {
+		return ExportTicket{}, fmt.Errorf("%w: lifetime must be positive, got %v", ErrInvalidExportTicket, d)
+	}
+	if scope != ExportScopePublic && scope != ExportScopeFull {
+		return ExportTicket{}, fmt.Errorf("%w: unknown scope %v", ErrInvalidExportTicket, scope)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer func() { s.audit(AuditAuthorize, "", err) }()
+
+	if err := s.approve(); err != nil {
+		return ExportTicket{}, err
+	}
+
+	id := make([]byte, exportTicketIDSize)
+	if _, err := rand.Read(id); err != nil {
+		return ExportTicket{}, fmt.Errorf("failed to generate export ticket: %w", err)
+	}
+
+	now := s.now()
+	for existing, grant := range s.exportTickets {
+		if !now.Before(grant.expiresAt) {
+			delete(s.exportTickets, existing)
+		}
+	}
+	if s.exportTickets == nil {
+		s.exportTickets = make(map[string]exportGrant)
+	}
+
+	ticket = ExportTicket{ID: hex.EncodeToString(id), Scope: scope, ExpiresAt: now.Add(d)}
+	s.exportTickets[ticket.ID] = exportGrant{scope: scope, expiresAt: ticket.ExpiresAt}
+	return ticket, nil
+}
+
+// redeemExport fails with ErrExportNotAuthorized unless opts present a
+// valid ticket for scope, which is then used up. Without
+// Config.RequireExportTicket, an export without a ticket is allowed.
+func (s *Store) redeemExport(op string, scope ExportScope, opts []ExportOption) error {
+	return s.redeemExportTicket(op, scope, opts, s.config.RequireExportTicket)
+}
+
+// redeemExportTicket is redeemExport for exports that may need a ticket
+// whatever the configuration.
+func (s *Store) redeemExportTicket(op string, scope ExportScope, opts []ExportOption, required bool) error {
+	var o exportOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.ticket == nil {
+		if required {
+			return fmt.Errorf("%w: %s needs a ticket from AuthorizeExport", ErrExportNotAuthorized, op)
+		}
+		return nil
+	}
+
+	grant, ok := s.exportTickets[o.ticket.ID]
+	switch {
+	case !ok:
+		return fmt.Errorf("%w: %s: ticket is unknown or was already used", ErrExportNotAuthorized, op)
+	case !s.now().Before(grant.expiresAt):
+		delete(s.exportTickets, o.ticket.ID)
+		return fmt.Errorf("%w: %s: ticket expired at %s", ErrExportNotAuthorized, op, grant.expiresAt.UTC().Format(time.RFC3339))
+	case grant.scope != scope:
+		return fmt.Errorf("%w: %s needs a %s ticket, got %s", ErrExportNotAuthorized, op, scope, grant.scope)
+	}
+
+	delete(s.exportTickets, o.ticket.ID)
+	return nil
+}
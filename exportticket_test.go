@@ -0,0 +1,232 @@
+package keystore_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/theblitlabs/keystore"
+)
+
+// exportOps are the exports gated by tickets, with the scope they need.
+var exportOps = []struct {
+	name  string
+	scope keystore.ExportScope
+	run   func(t *testing.T, ks *keystore.Store, opts ...keystore.ExportOption) error
+}{
+	{"PublicBundle", keystore.ExportScopePublic, func(t *testing.T, ks *keystore.Store, opts ...keystore.ExportOption) error {
+		_, err := ks.PublicBundle(opts...)
+		return err
+	}},
+	{"WriteDotEnv address", keystore.ExportScopePublic, func(t *testing.T, ks *keystore.Store, opts ...keystore.ExportOption) error {
+		return ks.WriteDotEnv(filepath.Join(t.TempDir(), ".env"), "APP_", keystore.EnvAddress, opts...)
+	}},
+	{"WriteDotEnv token", keystore.ExportScopeFull, func(t *testing.T, ks *keystore.Store, opts ...keystore.ExportOption) error {
+		return ks.WriteDotEnv(filepath.Join(t.TempDir(), ".env"), "APP_", keystore.EnvToken, opts...)
+	}},
+	{"ExportBundle", keystore.ExportScopeFull, func(t *testing.T, ks *keystore.Store, opts ...keystore.ExportOption) error {
+		return ks.ExportBundle(filepath.Join(t.TempDir(), "bundle"), "bundle passphrase", keystore.BundleAll, opts...)
+	}},
+	{"ExportPaperBackup", keystore.ExportScopeFull, func(t *testing.T, ks *keystore.Store, opts ...keystore.ExportOption) error {
+		_, err := ks.ExportPaperBackup("paper passphrase", opts...)
+		return err
+	}},
+	{"MarshalPortable", keystore.ExportScopeFull, func(t *testing.T, ks *keystore.Store, opts ...keystore.ExportOption) error {
+		_, err := ks.MarshalPortable(portablePassphrase, opts...)
+		return err
+	}},
+	{"ExportToKeystoreDir", keystore.ExportScopeFull, func(t *testing.T, ks *keystore.Store, opts ...keystore.ExportOption) error {
+		return ks.ExportToKeystoreDir(t.TempDir(), "geth passphrase", false, opts...)
+	}},
+	{"EscrowBlob", keystore.ExportScopeFull, func(t *testing.T, ks *keystore.Store, opts ...keystore.ExportOption) error {
+		_, err := ks.EscrowBlob(opts...)
+		return err
+	}},
+	{"Env private key", keystore.ExportScopeFull, func(t *testing.T, ks *keystore.Store, opts ...keystore.ExportOption) error {
+		_, err := ks.Env("APP_", keystore.EnvPrivateKey, opts...)
+		return err
+	}},
+	{"RunWithEnv private key", keystore.ExportScopeFull, func(t *testing.T, ks *keystore.Store, opts ...keystore.ExportOption) error {
+		cmd := exec.Command(os.Args[0], "-test.run=^$")
+		return ks.RunWithEnv(context.Background(), cmd, keystore.EnvPrivateKey, opts...)
+	}},
+}
+
+// newExportStore returns a store with a token, a primary key and an
+// escrow key, requiring export tickets if required is set.
+func newExportStore(t *testing.T, clock *testClock, required bool) *keystore.Store {
+	t.Helper()
+
+	ks := newErrorStore(t, clock.config(keystore.Config{
+		RequireExportTicket: required,
+		Approve:             approveAlways,
+		EscrowPublicKey:     &mustKey(t, envKeyHex).PublicKey,
+		Passphrase:          keystore.StaticPassphrase("user"),
+	}))
+	if err := ks.SaveToken("token"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	return ks
+}
+
+func otherScope(scope keystore.ExportScope) keystore.ExportScope {
+	if scope == keystore.ExportScopePublic {
+		return keystore.ExportScopeFull
+	}
+	return keystore.ExportScopePublic
+}
+
+func TestExportTickets(t *testing.T) {
+	for _, op := range exportOps {
+		t.Run(op.name, func(t *testing.T) {
+			ks := newExportStore(t, newTestClock(epoch), true)
+
+			if err := op.run(t, ks); !errors.Is(err, keystore.ErrExportNotAuthorized) {
+				t.Fatalf("without a ticket: got %v, want ErrExportNotAuthorized", err)
+			}
+
+			// A ticket for the other scope is refused.
+			wrong, err := ks.AuthorizeExport(time.Minute, otherScope(op.scope))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := op.run(t, ks, keystore.WithExportTicket(wrong)); !errors.Is(err, keystore.ErrExportNotAuthorized) {
+				t.Fatalf("with a %s ticket: got %v, want ErrExportNotAuthorized", wrong.Scope, err)
+			}
+
+			ticket, err := ks.AuthorizeExport(time.Minute, op.scope)
+			if err != nil {
+				t.Fatalf("AuthorizeExport: %v", err)
+			}
+			if err := op.run(t, ks, keystore.WithExportTicket(ticket)); err != nil {
+				t.Fatalf("with a %s ticket: %v", ticket.Scope, err)
+			}
+			if err := op.run(t, ks, keystore.WithExportTicket(ticket)); !errors.Is(err, keystore.ErrExportNotAuthorized) {
+				t.Fatalf("reusing the ticket: got %v, want ErrExportNotAuthorized", err)
+			}
+
+			// A forged ticket copying a used one's fields is unknown.
+			forged := keystore.ExportTicket{ID: ticket.ID, Scope: op.scope, ExpiresAt: epoch.Add(time.Hour)}
+			if err := op.run(t, ks, keystore.WithExportTicket(forged)); !errors.Is(err, keystore.ErrExportNotAuthorized) {
+				t.Fatalf("with a forged ticket: got %v, want ErrExportNotAuthorized", err)
+			}
+		})
+	}
+}
+
+func TestExportTicketExpiry(t *testing.T) {
+	clock := newTestClock(epoch)
+	ks := newExportStore(t, clock, true)
+
+	ticket, err := ks.AuthorizeExport(time.Minute, keystore.ExportScopeFull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ticket.ExpiresAt.Equal(epoch.Add(time.Minute)) {
+		t.Fatalf("ExpiresAt = %v, want %v", ticket.ExpiresAt, epoch.Add(time.Minute))
+	}
+	clock.Advance(time.Minute)
+	if _, err := ks.MarshalPortable(portablePassphrase, keystore.WithExportTicket(ticket)); !errors.Is(err, keystore.ErrExportNotAuthorized) {
+		t.Fatalf("with an expired ticket: got %v, want ErrExportNotAuthorized", err)
+	}
+
+	ticket, err = ks.AuthorizeExport(time.Minute, keystore.ExportScopeFull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Minute - time.Second)
+	if _, err := ks.MarshalPortable(portablePassphrase, keystore.WithExportTicket(ticket)); err != nil {
+		t.Fatalf("with a ticket about to expire: %v", err)
+	}
+}
+
+func TestExportTicketsDiscarded(t *testing.T) {
+	for name, discard := range map[string]func(t *testing.T, ks *keystore.Store){
+		"Lock":        func(t *testing.T, ks *keystore.Store) { ks.Lock() },
+		"WipeSecrets": func(t *testing.T, ks *keystore.Store) { ks.WipeSecrets() },
+		"Close": func(t *testing.T, ks *keystore.Store) {
+			if err := ks.Close(); err != nil {
+				t.Fatal(err)
+			}
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ks := newExportStore(t, newTestClock(epoch), true)
+			ticket, err := ks.AuthorizeExport(time.Hour, keystore.ExportScopePublic)
+			if err != nil {
+				t.Fatal(err)
+			}
+			discard(t, ks)
+			if _, err := ks.PublicBundle(keystore.WithExportTicket(ticket)); !errors.Is(err, keystore.ErrExportNotAuthorized) {
+				t.Fatalf("with a ticket issued before %s: got %v, want ErrExportNotAuthorized", name, err)
+			}
+
+			// Tickets are per Store: another Store never saw this one.
+			other := newErrorStore(t, keystore.Config{DirPath: ks.Dir(), RequireExportTicket: true})
+			fresh, err := ks.AuthorizeExport(time.Hour, keystore.ExportScopePublic)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := other.PublicBundle(keystore.WithExportTicket(fresh)); !errors.Is(err, keystore.ErrExportNotAuthorized) {
+				t.Fatalf("with a ticket of another Store: got %v, want ErrExportNotAuthorized", err)
+			}
+		})
+	}
+}
+
+func TestExportTicketsOptional(t *testing.T) {
+	ks := newExportStore(t, newTestClock(epoch), false)
+
+	// Without RequireExportTicket, only WriteDotEnv needs a ticket...
+	for _, op := range exportOps {
+		err := op.run(t, ks)
+		if dotEnv := strings.HasPrefix(op.name, "WriteDotEnv"); dotEnv != errors.Is(err, keystore.ErrExportNotAuthorized) || (!dotEnv && err != nil) {
+			t.Errorf("%s without a ticket: %v", op.name, err)
+		}
+	}
+
+	// ...but a ticket that is given is still checked.
+	ticket, err := ks.AuthorizeExport(time.Minute, keystore.ExportScopePublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.MarshalPortable(portablePassphrase, keystore.WithExportTicket(ticket)); !errors.Is(err, keystore.ErrExportNotAuthorized) {
+		t.Fatalf("MarshalPortable with a public ticket: got %v, want ErrExportNotAuthorized", err)
+	}
+}
+
+func TestAuthorizeExport(t *testing.T) {
+	denied := errors.New("denied")
+	ks := newErrorStore(t, keystore.Config{Approve: func() error { return denied }})
+	if _, err := ks.AuthorizeExport(time.Minute, keystore.ExportScopePublic); !errors.Is(err, denied) {
+		t.Fatalf("AuthorizeExport without approval: got %v, want the approval error", err)
+	}
+
+	ks = newErrorStore(t, keystore.Config{Approve: approveAlways})
+	if _, err := ks.AuthorizeExport(0, keystore.ExportScopePublic); !errors.Is(err, keystore.ErrInvalidExportTicket) {
+		t.Fatalf("AuthorizeExport with no lifetime: got %v, want ErrInvalidExportTicket", err)
+	}
+	if _, err := ks.AuthorizeExport(time.Minute, keystore.ExportScope(0)); !errors.Is(err, keystore.ErrInvalidExportTicket) {
+		t.Fatalf("AuthorizeExport with an unknown scope: got %v, want ErrInvalidExportTicket", err)
+	}
+
+	first, err := ks.AuthorizeExport(time.Minute, keystore.ExportScopeFull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := ks.AuthorizeExport(time.Minute, keystore.ExportScopeFull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ID == second.ID || len(first.ID) != 32 {
+		t.Fatalf("ticket IDs %q and %q, want distinct random IDs", first.ID, second.ID)
+	}
+}
@@ -0,0 +1,70 @@
+package keystore
+
+import "time"
+
+// FaultOp names an operation a FaultInjector can disrupt.
+type FaultOp string
+
+// Operations passed to FaultInjector.Fault
+const (
+	// FaultOpLoad is every load of the keystore, including the one at the
+	// start of each update. A stale fault keeps the state loaded before.
+	FaultOpLoad FaultOp = "load"
+
+	// FaultOpRead is each attempt to read the backend. Transient errors
+	// such as syscall.EIO are retried as real ones are. A corrupt fault
+	// truncates the data read.
+	FaultOpRead FaultOp = "read"
+
+	// FaultOpSave is every save, before anything is written.
+	FaultOpSave FaultOp = "save"
+
+	// FaultOpWrite is each attempt to write the backend, retried as
+	// FaultOpRead is.
+	FaultOpWrite FaultOp = "write"
+
+	// FaultOpLoadToken is every token load, by LoadToken,
+	// LoadTokenDetailed and the methods built on them.
+	FaultOpLoadToken FaultOp = "load_token"
+)
+
+// FaultInjector makes Store operations misbehave on purpose, so that tests
+// can check how an application copes with a failing keystore. It is set
+// with Config.FaultInjector; the faultinject package provides one driven
+// by rules. Fault is called with the Store locked, at the start of each
+// operation, and must not call back into the Store.
+type FaultInjector interface {
+	Fault(op FaultOp) Fault
+}
+
+// Fault is what a FaultInjector does to one operation. The zero Fault
+// leaves it alone.
+type Fault struct {
+	// Delay is slept before the operation runs.
+	Delay time.Duration
+
+	// Err, if set, is returned instead of running the operation.
+	Err error
+
+	// Stale makes FaultOpLoad keep the state loaded before instead of
+	// reading the backend. The first load of a Store is never stale.
+	Stale bool
+
+	// Corrupt makes FaultOpRead return the first half of the data read,
+	// as a torn write would leave it.
+	Corrupt bool
+}
+
+// injectFault applies the fault Config.FaultInjector chooses for op. It
+// costs a nil check when no injector is set.
+func (s *Store) injectFault(op FaultOp) (Fault, error) {
+	if s.config.FaultInjector == nil {
+		return Fault{}, nil
+	}
+
+	f := s.config.FaultInjector.Fault(op)
+	if f.Delay > 0 {
+		time.Sleep(f.Delay)
+	}
+	return f, f.Err
+}
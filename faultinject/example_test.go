@@ -0,0 +1,78 @@
+package faultinject_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/theblitlabs/keystore"
+	"github.com/theblitlabs/keystore/faultinject"
+)
+
+// The third token load fails as if the token had expired, while the
+// stored token itself stays valid.
+func ExampleInjector_Nth() {
+	dir, err := os.MkdirTemp("", "keystore")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+
+	inj := faultinject.New()
+	inj.Nth(keystore.FaultOpLoadToken, 3, keystore.Fault{Err: keystore.ErrTokenExpired})
+	ks, err := keystore.NewKeystore(keystore.Config{DirPath: dir, FaultInjector: inj})
+	if err != nil {
+		panic(err)
+	}
+	if err := ks.SaveToken("api-token"); err != nil {
+		panic(err)
+	}
+
+	for i := 1; i <= 4; i++ {
+		token, err := ks.LoadToken()
+		fmt.Printf("load %d: %q, expired: %v\n", i, token, errors.Is(err, keystore.ErrTokenExpired))
+	}
+	// Output:
+	// load 1: "api-token", expired: false
+	// load 2: "api-token", expired: false
+	// load 3: "", expired: true
+	// load 4: "api-token", expired: false
+}
+
+// The next save fails, leaving the keystore as it was, and the one after
+// it succeeds.
+func ExampleInjector_Once() {
+	dir, err := os.MkdirTemp("", "keystore")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+
+	inj := faultinject.New()
+	ks, err := keystore.NewKeystore(keystore.Config{DirPath: dir, FaultInjector: inj})
+	if err != nil {
+		panic(err)
+	}
+	if err := ks.SaveToken("old-token"); err != nil {
+		panic(err)
+	}
+
+	diskFull := errors.New("disk full")
+	inj.Once(keystore.FaultOpSave, keystore.Fault{Err: diskFull})
+	err = ks.SaveToken("new-token")
+	fmt.Println("first save failed:", errors.Is(err, diskFull))
+	token, _ := ks.LoadToken()
+	fmt.Println("token:", token)
+
+	err = ks.SaveToken("new-token")
+	fmt.Println("second save failed:", err != nil)
+	token, _ = ks.LoadToken()
+	fmt.Println("token:", token)
+	fmt.Println("saves:", inj.Calls(keystore.FaultOpSave))
+	// Output:
+	// first save failed: true
+	// token: old-token
+	// second save failed: false
+	// token: new-token
+	// saves: 3
+}
@@ -0,0 +1,113 @@
+// Package faultinject provides a keystore.FaultInjector driven by rules,
+// for testing how an application behaves when its keystore misbehaves:
+// tokens expiring at the wrong moment, intermittent I/O errors, a file
+// corrupted on the next load. Rules pick a call to an operation by its
+// number, counted from 1 per operation, and the Fault to inject there.
+//
+// The third token load fails as if the token had expired:
+//
+//	inj := faultinject.New()
+//	inj.Nth(keystore.FaultOpLoadToken, 3, keystore.Fault{Err: keystore.ErrTokenExpired})
+//	ks, err := keystore.NewKeystore(keystore.Config{DirPath: dir, FaultInjector: inj})
+//
+// The next save fails once, and the one after it succeeds:
+//
+//	inj.Once(keystore.FaultOpSave, keystore.Fault{Err: errors.New("disk full")})
+//
+// A failing write of syscall.EIO is retried by the Store like a real one,
+// so injecting it once checks that the application never notices, and
+// injecting it on every attempt checks the error path:
+//
+//	inj.Always(keystore.FaultOpWrite, keystore.Fault{Err: syscall.EIO})
+//
+// An Injector is safe for concurrent use, and can be shared by Stores.
+package faultinject
+
+import (
+	"sync"
+
+	"github.com/theblitlabs/keystore"
+)
+
+// Injector is a keystore.FaultInjector applying rules added with Nth,
+// Once, After and Always. When several rules match a call, the one added
+// first wins.
+type Injector struct {
+	mu    sync.Mutex
+	rules []rule
+	calls map[keystore.FaultOp]int
+}
+
+// rule injects fault into calls first to last of op; last 0 means every
+// call from first on.
+type rule struct {
+	op          keystore.FaultOp
+	first, last int
+	fault       keystore.Fault
+}
+
+// New returns an Injector with no rules, which injects nothing.
+func New() *Injector {
+	return &Injector{calls: make(map[keystore.FaultOp]int)}
+}
+
+// Nth injects f into call n of op.
+func (in *Injector) Nth(op keystore.FaultOp, n int, f keystore.Fault) {
+	in.add(rule{op: op, first: n, last: n, fault: f})
+}
+
+// Once injects f into the next call of op.
+func (in *Injector) Once(op keystore.FaultOp, f keystore.Fault) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	next := in.calls[op] + 1
+	in.rules = append(in.rules, rule{op: op, first: next, last: next, fault: f})
+}
+
+// After injects f into call n of op and every call after it.
+func (in *Injector) After(op keystore.FaultOp, n int, f keystore.Fault) {
+	in.add(rule{op: op, first: n, fault: f})
+}
+
+// Always injects f into every call of op from now on.
+func (in *Injector) Always(op keystore.FaultOp, f keystore.Fault) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.rules = append(in.rules, rule{op: op, first: in.calls[op] + 1, fault: f})
+}
+
+// Calls returns how many times op was called so far, faulted or not.
+func (in *Injector) Calls(op keystore.FaultOp) int {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return in.calls[op]
+}
+
+// Reset removes every rule and restarts the call counts.
+func (in *Injector) Reset() {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.rules = nil
+	in.calls = make(map[keystore.FaultOp]int)
+}
+
+// Fault counts the call and returns the fault of the first matching rule.
+func (in *Injector) Fault(op keystore.FaultOp) keystore.Fault {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	in.calls[op]++
+	n := in.calls[op]
+	for _, r := range in.rules {
+		if r.op == op && n >= r.first && (r.last == 0 || n <= r.last) {
+			return r.fault
+		}
+	}
+	return keystore.Fault{}
+}
+
+func (in *Injector) add(r rule) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.rules = append(in.rules, r)
+}
@@ -0,0 +1,115 @@
+package keystore
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"time"
+)
+
+// Fields is a set of updates applied together by UpdateFields. Nil fields are
+// left unchanged.
+type Fields struct {
+	// AuthToken replaces the stored token.
+	AuthToken *string
+
+	// TokenTTL is the lifetime of AuthToken. Zero uses Config.TokenTTL.
+	TokenTTL time.Duration
+
+	// PrivateKey replaces the primary key, given in hex.
+	PrivateKey *string
+
+	// DefaultAccount sets the default account; an empty name clears it.
+	DefaultAccount *string
+
+	// AccountLabels sets labels per account name. An empty value removes
+	// the label.
+	AccountLabels map[string]map[string]string
+}
+
+// UpdateFields applies every update in fields in a single load-merge-write
+// cycle. If any update is invalid the whole call fails and nothing is written.
+func (s *Store) UpdateFields(fields Fields) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	apply, err := s.checkFields(fields)
+	if err != nil {
+		return err
+	}
+
+	if err := s.update(apply); err != nil {
+		return err
+	}
+
+	if fields.AuthToken != nil {
+		s.rearmWatchers()
+	}
+	return nil
+}
+
+// checkFields validates fields and returns the update cycle step that
+// applies them.
+func (s *Store) checkFields(fields Fields) (func() error, error) {
+	if fields.TokenTTL < 0 {
+		return nil, fmt.Errorf("%w %s", ErrInvalidTokenTTL, fields.TokenTTL)
+	}
+
+	if fields.AuthToken != nil {
+		if err := s.checkToken(*fields.AuthToken); err != nil {
+			return nil, err
+		}
+	}
+
+	var key *ecdsa.PrivateKey
+	if fields.PrivateKey != nil {
+		var err error
+		if key, err = s.checkPrivateKey(*fields.PrivateKey); err != nil {
+			return nil, err
+		}
+	}
+
+	for name, labels := range fields.AccountLabels {
+		for k, v := range labels {
+			if err := validateLabel(k, v); err != nil {
+				return nil, fmt.Errorf("account %q: %w", name, err)
+			}
+		}
+	}
+
+	return func() error {
+		if fields.DefaultAccount != nil {
+			if _, ok := s.Accounts[*fields.DefaultAccount]; !ok && *fields.DefaultAccount != "" {
+				return fmt.Errorf("%w: %q", ErrAccountNotFound, *fields.DefaultAccount)
+			}
+			s.DefaultAccount = *fields.DefaultAccount
+		}
+
+		for name, labels := range fields.AccountLabels {
+			account, ok := s.Accounts[name]
+			if !ok {
+				return fmt.Errorf("%w: %q", ErrAccountNotFound, name)
+			}
+			for k, v := range labels {
+				setLabel(account, k, v)
+			}
+		}
+
+		if key != nil {
+			if err := s.setPrimaryKey(*fields.PrivateKey, key, s.newProvenance(ProvenanceHex, "")); err != nil {
+				return err
+			}
+		}
+
+		if fields.AuthToken != nil {
+			ttl := fields.TokenTTL
+			if ttl == 0 {
+				ttl = s.tokenTTL()
+			}
+			if err := s.setToken(*fields.AuthToken, ttl); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, nil
+}
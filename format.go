@@ -0,0 +1,224 @@
+package keystore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// FileMagic identifies files written by this package. Binary formats
+	// start with it; JSON documents carry it in their _format object
+	FileMagic = "BLITKS"
+
+	// HeaderVersion is the version of the file header written by this
+	// package
+	HeaderVersion = 1
+
+	// FormatJSON, FormatYAML, FormatTOML, FormatPGP and FormatPortable
+	// name the formats FormatInfo reports
+	FormatJSON     = "json"
+	FormatYAML     = "yaml"
+	FormatTOML     = "toml"
+	FormatPGP      = "pgp"
+	FormatPortable = "portable"
+
+	modulePath = "github.com/theblitlabs/keystore"
+)
+
+// FormatInfo describes how a keystore file was written. Files written
+// before headers were introduced have an empty Magic and, unless they are
+// plaintext documents, no schema version or tool.
+type FormatInfo struct {
+	Magic         string `json:"magic,omitempty"`
+	HeaderVersion int    `json:"header_version,omitempty"`
+	Format        string `json:"format"`
+	SchemaVersion int    `json:"schema_version,omitempty"`
+	Tool          string `json:"tool,omitempty"`
+
+	// Transforms names the Config.Transforms the file was written with,
+	// in the order they were applied.
+	Transforms []string `json:"transforms,omitempty"`
+
+	// Layout is how much of the file is encrypted, as found by
+	// IdentifyFile. It is empty when transforms hide the document.
+	Layout Layout `json:"layout,omitempty"`
+}
+
+// IdentifyFile reports the format and layout of the keystore file at path
+// without decrypting it. A file from a newer version of this package returns
+// ErrUnsupportedVersion; a file that is not a keystore returns
+// ErrCorruptKeystore.
+func IdentifyFile(path string) (FormatInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return FormatInfo{}, fmt.Errorf("failed to read keystore: %w", err)
+	}
+	defer wipe(data)
+
+	info, body, err := splitHeader(data)
+	if err != nil {
+		return FormatInfo{}, err
+	}
+	if info != nil {
+		switch {
+		case info.Format == FormatPGP:
+			info.Layout = LayoutEncrypted
+		case len(info.Transforms) == 0:
+			if _, doc, err := identifyDocument(body); err == nil {
+				info.Layout = documentLayout(doc)
+			}
+		}
+		return *info, nil
+	}
+
+	switch {
+	case isPGPMessage(body):
+		return FormatInfo{Format: FormatPGP, Layout: LayoutEncrypted}, nil
+	case bytes.HasPrefix(bytes.TrimSpace(body), []byte(PortablePrefix)):
+		return FormatInfo{Format: FormatPortable}, nil
+	}
+
+	format, doc, err := identifyDocument(body)
+	if err != nil {
+		return FormatInfo{}, &CorruptKeystoreError{Path: path, Err: err}
+	}
+
+	var header struct {
+		Format  *FormatInfo `json:"_format"`
+		Version int         `json:"version"`
+	}
+	if err := json.Unmarshal(doc, &header); err != nil {
+		return FormatInfo{}, &CorruptKeystoreError{Path: path, Err: err}
+	}
+
+	if header.Format != nil {
+		if err := header.Format.check(); err != nil {
+			return FormatInfo{}, err
+		}
+		info := *header.Format
+		info.Layout = documentLayout(doc)
+		return info, nil
+	}
+	if header.Version == 0 {
+		header.Version = 1
+	}
+	return FormatInfo{Format: format, SchemaVersion: header.Version, Layout: documentLayout(doc)}, nil
+}
+
+// identifyDocument finds the built-in codec that parses data, returning
+// its format name and the document as JSON.
+func identifyDocument(data []byte) (string, []byte, error) {
+	if json.Valid(data) {
+		return FormatJSON, data, nil
+	}
+	for _, c := range []Codec{YAMLCodec{}, TOMLCodec{}} {
+		var doc map[string]any
+		if c.Unmarshal(data, &doc) != nil || doc == nil {
+			continue
+		}
+		encoded, err := json.Marshal(doc)
+		if err != nil {
+			continue
+		}
+		return strings.TrimPrefix(c.Ext(), "."), encoded, nil
+	}
+	return "", nil, errors.New("unrecognized keystore format")
+}
+
+// check rejects headers newer than this package understands.
+func (f *FormatInfo) check() error {
+	if f.Magic != FileMagic {
+		return nil
+	}
+	if f.HeaderVersion > HeaderVersion {
+		return fmt.Errorf("%w: header version %d, supported %d", ErrUnsupportedVersion, f.HeaderVersion, HeaderVersion)
+	}
+	if f.SchemaVersion > SchemaVersion {
+		return fmt.Errorf("%w: file version %d, supported %d", ErrUnsupportedVersion, f.SchemaVersion, SchemaVersion)
+	}
+	return nil
+}
+
+// documentFormat describes the document save is about to write, before
+// any OpenPGP encryption.
+func (s *Store) documentFormat() *FormatInfo {
+	format := strings.TrimPrefix(s.codec().Ext(), ".")
+	if isJSONCodec(s.codec()) {
+		format = FormatJSON
+	}
+	return &FormatInfo{
+		Magic:         FileMagic,
+		HeaderVersion: HeaderVersion,
+		Format:        format,
+		SchemaVersion: SchemaVersion,
+		Tool:          toolVersion(),
+	}
+}
+
+// fileHeader returns the line prepended to binary formats and transformed
+// files: "BLITKS <header version> <format> <schema version> <tool>", where
+// format is followed by any transforms, as in "json+gzip".
+func fileHeader(format string) []byte {
+	return []byte(fmt.Sprintf("%s %d %s %d %s\n", FileMagic, HeaderVersion, format, SchemaVersion, toolVersion()))
+}
+
+// splitHeader strips the binary file header from data, returning nil info
+// for data without one.
+func splitHeader(data []byte) (*FormatInfo, []byte, error) {
+	if !bytes.HasPrefix(data, []byte(FileMagic+" ")) {
+		return nil, data, nil
+	}
+
+	line, body, ok := bytes.Cut(data, []byte("\n"))
+	fields := strings.Fields(string(line))
+	if !ok || len(fields) < 4 {
+		return nil, nil, fmt.Errorf("%w: malformed file header", ErrCorruptKeystore)
+	}
+
+	headerVersion, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: malformed file header version %q", ErrCorruptKeystore, fields[1])
+	}
+	chain := strings.Split(fields[2], "+")
+	info := &FormatInfo{Magic: FileMagic, HeaderVersion: headerVersion, Format: chain[0], Transforms: chain[1:]}
+	if len(info.Transforms) == 0 {
+		info.Transforms = nil
+	}
+	if headerVersion > HeaderVersion {
+		return nil, nil, info.check()
+	}
+
+	if info.SchemaVersion, err = strconv.Atoi(fields[3]); err != nil {
+		return nil, nil, fmt.Errorf("%w: malformed schema version %q", ErrCorruptKeystore, fields[3])
+	}
+	if len(fields) > 4 {
+		info.Tool = strings.Join(fields[4:], " ")
+	}
+	if err := info.check(); err != nil {
+		return nil, nil, err
+	}
+	return info, body, nil
+}
+
+// toolVersion names this package and the module version it was built at.
+var toolVersion = sync.OnceValue(func() string {
+	version := "(devel)"
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if bi.Main.Path == modulePath && bi.Main.Version != "" {
+			version = bi.Main.Version
+		}
+		for _, dep := range bi.Deps {
+			if dep.Path == modulePath {
+				version = dep.Version
+			}
+		}
+	}
+	return "keystore/" + version
+})
@@ -0,0 +1,144 @@
+package keystore_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/theblitlabs/keystore"
+	"github.com/theblitlabs/keystore/keystoretest"
+)
+
+func TestIdentifyFile(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     keystore.Config
+		file       string
+		format     string
+		transforms []string
+		layout     keystore.Layout
+	}{
+		{name: "json", file: keystore.DefaultFileName, format: keystore.FormatJSON, layout: keystore.LayoutPlaintext},
+		{name: "yaml", config: keystore.Config{Codec: keystore.YAMLCodec{}}, file: "keystore.yaml", format: keystore.FormatYAML, layout: keystore.LayoutPlaintext},
+		{name: "toml", config: keystore.Config{Codec: keystore.TOMLCodec{}}, file: "keystore.toml", format: keystore.FormatTOML, layout: keystore.LayoutPlaintext},
+		{name: "gzip", config: keystore.Config{Transforms: []keystore.Transform{keystore.GzipTransform{}}}, file: keystore.DefaultFileName, format: keystore.FormatJSON, transforms: []string{"gzip"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.config
+			cfg.DirPath = t.TempDir()
+			ks, err := keystore.NewKeystore(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+				t.Fatal(err)
+			}
+
+			info, err := keystore.IdentifyFile(filepath.Join(cfg.DirPath, tt.file))
+			if err != nil {
+				t.Fatalf("IdentifyFile: %v", err)
+			}
+			if info.Magic != keystore.FileMagic || info.HeaderVersion != keystore.HeaderVersion {
+				t.Errorf("header = %q %d", info.Magic, info.HeaderVersion)
+			}
+			if info.Format != tt.format || info.SchemaVersion != keystore.SchemaVersion {
+				t.Errorf("format = %s v%d, want %s v%d", info.Format, info.SchemaVersion, tt.format, keystore.SchemaVersion)
+			}
+			if strings.Join(info.Transforms, "+") != strings.Join(tt.transforms, "+") {
+				t.Errorf("transforms = %v, want %v", info.Transforms, tt.transforms)
+			}
+			if info.Layout != tt.layout {
+				t.Errorf("layout = %q, want %q", info.Layout, tt.layout)
+			}
+			if info.Tool == "" {
+				t.Error("no tool recorded")
+			}
+
+			status, err := ks.Status()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status.Format == nil || status.Format.Format != tt.format || status.Format.Magic != keystore.FileMagic {
+				t.Errorf("Status().Format = %+v", status.Format)
+			}
+		})
+	}
+}
+
+func TestIdentifyFileWithoutHeader(t *testing.T) {
+	data, err := fs.ReadFile(keystoretest.Fixtures, "v1.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "v1.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := keystore.IdentifyFile(path)
+	if err != nil {
+		t.Fatalf("IdentifyFile: %v", err)
+	}
+	if info.Magic != "" || info.Format != keystore.FormatJSON || info.SchemaVersion != 1 {
+		t.Fatalf("legacy file identified as %+v", info)
+	}
+}
+
+func TestIdentifyFileRejected(t *testing.T) {
+	future := keystore.HeaderVersion + 1
+	tests := []struct {
+		name string
+		data string
+		want error
+	}{
+		{
+			name: "newer binary header",
+			data: keystore.FileMagic + " 99 json 3 keystore/v9\n{}",
+			want: keystore.ErrUnsupportedVersion,
+		},
+		{
+			name: "newer JSON header",
+			data: `{"_format":{"magic":"` + keystore.FileMagic + `","header_version":` + strconv.Itoa(future) + `,"format":"json"}}`,
+			want: keystore.ErrUnsupportedVersion,
+		},
+		{
+			name: "newer schema",
+			data: `{"_format":{"magic":"` + keystore.FileMagic + `","header_version":1,"format":"json","schema_version":` + strconv.Itoa(keystore.SchemaVersion+1) + `}}`,
+			want: keystore.ErrUnsupportedVersion,
+		},
+		{name: "malformed binary header", data: keystore.FileMagic + " x\n{}", want: keystore.ErrCorruptKeystore},
+		{name: "not a keystore", data: "\x00\x01garbage", want: keystore.ErrCorruptKeystore},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, keystore.DefaultFileName)
+			if err := os.WriteFile(path, []byte(tt.data), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := keystore.IdentifyFile(path); !errors.Is(err, tt.want) {
+				t.Fatalf("IdentifyFile: got %v, want %v", err, tt.want)
+			}
+
+			ks, err := keystore.NewKeystore(keystore.Config{DirPath: dir})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ks.LoadToken(); !errors.Is(err, tt.want) {
+				t.Fatalf("LoadToken: got %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := keystore.IdentifyFile(filepath.Join(t.TempDir(), "missing.json")); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("IdentifyFile of a missing file: got %v, want fs.ErrNotExist", err)
+	}
+}
@@ -0,0 +1,300 @@
+package keystore_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/theblitlabs/keystore"
+)
+
+const freezeReason = "incident 42"
+
+// frozenOps are the operations a freeze blocks.
+var frozenOps = []struct {
+	name string
+	run  func(t *testing.T, ks *keystore.Store) error
+}{
+	{"SignDigest", func(t *testing.T, ks *keystore.Store) error {
+		_, err := ks.SignDigest(crypto.Keccak256([]byte("freeze")))
+		return err
+	}},
+	{"SignMessage", func(t *testing.T, ks *keystore.Store) error {
+		_, err := ks.SignMessage([]byte("freeze"))
+		return err
+	}},
+	{"SignWithAccount", func(t *testing.T, ks *keystore.Store) error {
+		_, err := ks.SignWithAccount("hot", crypto.Keccak256([]byte("freeze")))
+		return err
+	}},
+	{"SignTransaction", func(t *testing.T, ks *keystore.Store) error {
+		tx := types.NewTransaction(0, common.Address{}, big.NewInt(0), 21000, big.NewInt(1), nil)
+		_, err := ks.SignTransaction(tx, big.NewInt(1))
+		return err
+	}},
+	{"BatchSigner", func(t *testing.T, ks *keystore.Store) error {
+		sg, err := ks.BatchSigner(context.Background())
+		if err == nil {
+			sg.Close()
+		}
+		return err
+	}},
+	{"LoadPrivateKey", func(t *testing.T, ks *keystore.Store) error {
+		_, err := ks.LoadPrivateKey()
+		return err
+	}},
+	{"LoadECDSAKey", func(t *testing.T, ks *keystore.Store) error {
+		_, err := ks.LoadECDSAKey()
+		return err
+	}},
+	{"TransactOpts", func(t *testing.T, ks *keystore.Store) error {
+		_, err := ks.TransactOpts(big.NewInt(1))
+		return err
+	}},
+	{"LoadAccountKey", func(t *testing.T, ks *keystore.Store) error {
+		_, err := ks.LoadAccountKey("hot")
+		return err
+	}},
+	{"GetPrivateKeyHex", func(t *testing.T, ks *keystore.Store) error {
+		_, err := ks.GetPrivateKeyHex()
+		return err
+	}},
+	{"PrivateKeyBytes", func(t *testing.T, ks *keystore.Store) error {
+		key, err := ks.PrivateKeyBytes()
+		if err == nil {
+			key.Wipe()
+		}
+		return err
+	}},
+	{"ExportPaperBackup", func(t *testing.T, ks *keystore.Store) error {
+		_, err := ks.ExportPaperBackup("paper passphrase")
+		return err
+	}},
+	{"MarshalPortable", func(t *testing.T, ks *keystore.Store) error {
+		_, err := ks.MarshalPortable(portablePassphrase)
+		return err
+	}},
+	{"ExportBundle", func(t *testing.T, ks *keystore.Store) error {
+		return ks.ExportBundle(filepath.Join(t.TempDir(), "bundle"), "bundle passphrase", keystore.BundleAll)
+	}},
+	{"CopyTo", func(t *testing.T, ks *keystore.Store) error {
+		return ks.CopyTo(newErrorStore(t, keystore.Config{}))
+	}},
+}
+
+// newFreezeStore returns a store with a token, a primary key and
+// the account "hot".
+func newFreezeStore(t *testing.T, cfg keystore.Config) *keystore.Store {
+	t.Helper()
+
+	ks := newErrorStore(t, cfg)
+	if err := ks.SaveToken("token"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveAccount("hot", credentialKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	return ks
+}
+
+// assertFrozen checks that every frozen op fails on ks with the reason,
+// and that the token, address and status stay available.
+func assertFrozen(t *testing.T, ks *keystore.Store, reason string) {
+	t.Helper()
+
+	for _, op := range frozenOps {
+		err := op.run(t, ks)
+		if !errors.Is(err, keystore.ErrKeystoreFrozen) || !strings.Contains(err.Error(), reason) {
+			t.Errorf("%s while frozen: got %v, want ErrKeystoreFrozen with %q", op.name, err, reason)
+		}
+	}
+
+	if token, err := ks.LoadToken(); err != nil || token != "token" {
+		t.Errorf("LoadToken while frozen = %q, %v", token, err)
+	}
+	if _, err := ks.GetAddress(); err != nil {
+		t.Errorf("GetAddress while frozen: %v", err)
+	}
+	if accounts, err := ks.ListAccounts(); err != nil || len(accounts) != 1 {
+		t.Errorf("ListAccounts while frozen = %v, %v", accounts, err)
+	}
+	st, err := ks.Status()
+	if err != nil {
+		t.Fatalf("Status while frozen: %v", err)
+	}
+	if !st.Frozen || st.FrozenReason != reason || st.FrozenAt == nil {
+		t.Errorf("Status = frozen %v, reason %q, at %v", st.Frozen, st.FrozenReason, st.FrozenAt)
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	clock := newTestClock(epoch)
+	ks := newFreezeStore(t, clock.config(keystore.Config{}))
+
+	if err := ks.Freeze(""); !errors.Is(err, keystore.ErrEmptyFreezeReason) {
+		t.Fatalf("Freeze without a reason: got %v, want ErrEmptyFreezeReason", err)
+	}
+	if err := ks.Freeze(freezeReason); err != nil {
+		t.Fatalf("Freeze: %v", err)
+	}
+	assertFrozen(t, ks, freezeReason)
+
+	// Freezing again updates the reason and keeps the time.
+	clock.Advance(time.Hour)
+	if err := ks.Freeze("still investigating"); err != nil {
+		t.Fatal(err)
+	}
+	st, err := ks.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.FrozenReason != "still investigating" || !st.FrozenAt.Equal(epoch) {
+		t.Fatalf("refrozen: reason %q at %v, want the new reason at %v", st.FrozenReason, st.FrozenAt, epoch)
+	}
+
+	if err := ks.Unfreeze(); err != nil {
+		t.Fatalf("Unfreeze: %v", err)
+	}
+	for _, op := range frozenOps {
+		if err := op.run(t, ks); err != nil {
+			t.Errorf("%s after Unfreeze: %v", op.name, err)
+		}
+	}
+	if st, _ := ks.Status(); st.Frozen {
+		t.Fatal("Status still frozen after Unfreeze")
+	}
+	if err := ks.Unfreeze(); err != nil {
+		t.Fatalf("Unfreeze of a keystore that is not frozen: %v", err)
+	}
+}
+
+func TestFreezeCurveKeys(t *testing.T) {
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384()} {
+		curve := curve
+		t.Run(curve.Params().Name, func(t *testing.T) {
+			priv, err := ecdsa.GenerateKey(curve, rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ks := newErrorStore(t, keystore.Config{})
+			if err := ks.SaveECDSAKey(priv); err != nil {
+				t.Fatal(err)
+			}
+			if err := ks.Freeze(freezeReason); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ks.LoadECDSAKey(); !errors.Is(err, keystore.ErrKeystoreFrozen) {
+				t.Fatalf("LoadECDSAKey while frozen: got %v, want ErrKeystoreFrozen", err)
+			}
+
+			if err := ks.Unfreeze(); err != nil {
+				t.Fatal(err)
+			}
+			if key, err := ks.LoadECDSAKey(); err != nil || !key.Equal(priv) {
+				t.Fatalf("LoadECDSAKey after Unfreeze: %v", err)
+			}
+		})
+	}
+}
+
+func TestFreezePersists(t *testing.T) {
+	dir := t.TempDir()
+	first := newFreezeStore(t, keystore.Config{DirPath: dir})
+	if _, err := first.LoadPrivateKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	second := newErrorStore(t, keystore.Config{DirPath: dir})
+	if err := second.Freeze(freezeReason); err != nil {
+		t.Fatal(err)
+	}
+
+	// The Store that loaded the key before the freeze and a fresh one both
+	// read the flag from the file.
+	assertFrozen(t, first, freezeReason)
+	assertFrozen(t, newErrorStore(t, keystore.Config{DirPath: dir}), freezeReason)
+
+	if err := newErrorStore(t, keystore.Config{DirPath: dir}).Unfreeze(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := first.SignDigest(crypto.Keccak256([]byte("thawed"))); err != nil {
+		t.Fatalf("SignDigest after another Store unfroze: %v", err)
+	}
+}
+
+func TestFreezeBatchSigners(t *testing.T) {
+	dir := t.TempDir()
+	ks := newFreezeStore(t, keystore.Config{DirPath: dir})
+	other := newErrorStore(t, keystore.Config{DirPath: dir})
+
+	own, err := ks.BatchSigner(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign, err := other.BatchSigner(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer foreign.Close()
+
+	if err := ks.Freeze(freezeReason); err != nil {
+		t.Fatal(err)
+	}
+
+	digest := [][]byte{crypto.Keccak256([]byte("batch"))}
+	for name, sg := range map[string]*keystore.Signer{"frozen Store": own, "other Store": foreign} {
+		if _, err := sg.SignDigests(digest); !errors.Is(err, keystore.ErrKeystoreFrozen) {
+			t.Fatalf("batch signer of the %s: got %v, want ErrKeystoreFrozen", name, err)
+		}
+	}
+
+	// The freeze closed the signers of the Store that froze; those of
+	// other Stores work again once it is lifted.
+	if err := ks.Unfreeze(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := own.SignDigests(digest); !errors.Is(err, keystore.ErrSignerClosed) {
+		t.Fatalf("batch signer of the Store that froze: got %v, want ErrSignerClosed", err)
+	}
+	if _, err := foreign.SignDigests(digest); err != nil {
+		t.Fatalf("batch signer of another Store after Unfreeze: %v", err)
+	}
+}
+
+func TestUnfreezeConfirmation(t *testing.T) {
+	denied := errors.New("denied")
+	approve := denied
+	ks := newFreezeStore(t, keystore.Config{
+		ConfirmUnfreeze: true,
+		Approve:         func() error { return approve },
+	})
+	if err := ks.Freeze(freezeReason); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ks.Unfreeze(); !errors.Is(err, denied) {
+		t.Fatalf("Unfreeze without approval: got %v, want the approval error", err)
+	}
+	assertFrozen(t, ks, freezeReason)
+
+	approve = nil
+	if err := ks.Unfreeze(); err != nil {
+		t.Fatalf("Unfreeze with approval: %v", err)
+	}
+	if _, err := ks.LoadPrivateKey(); err != nil {
+		t.Fatalf("LoadPrivateKey after Unfreeze: %v", err)
+	}
+}
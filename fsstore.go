@@ -0,0 +1,181 @@
+package keystore
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// fsBackend reads a keystore from an fs.FS, such as one embedded with
+// go:embed. It cannot be written.
+type fsBackend struct {
+	fsys fs.FS
+	name string
+}
+
+func (b *fsBackend) String() string {
+	return "fs:" + b.name
+}
+
+func (b *fsBackend) Read() ([]byte, error) {
+	return fs.ReadFile(b.fsys, b.name)
+}
+
+func (b *fsBackend) readLimited(max int64) ([]byte, error) {
+	f, err := b.fsys.Open(b.name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return io.ReadAll(io.LimitReader(f, max+1))
+}
+
+func (b *fsBackend) Write([]byte) error {
+	return b.readOnly()
+}
+
+func (b *fsBackend) Remove() error {
+	return b.readOnly()
+}
+
+func (b *fsBackend) readOnly() error {
+	return fmt.Errorf("%w: keystore is read from %s", ErrReadOnly, b)
+}
+
+// NewKeystoreFromFS opens the keystore stored as name in fsys, for example
+// a provisioning keystore embedded in the binary with go:embed. The Store
+// is read-only: every write fails with ErrReadOnly. Use CopyTo to
+// materialize it into a writable Store. The file is read and checked
+// before NewKeystoreFromFS returns.
+func NewKeystoreFromFS(fsys fs.FS, name string) (*Store, error) {
+	if !fs.ValidPath(name) {
+		return nil, configError("name", fmt.Sprintf("%q is not a valid fs.FS path", name))
+	}
+
+	s, err := NewKeystore(Config{Backend: &fsBackend{fsys: fsys, name: name}})
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// CopyTo writes the keystore held by s into dst, which must not hold a
+// keystore yet. The document is migrated to the current schema and checked
+// on the way: its manifest, if any, is verified as on every load, and each
+// stored address is compared with the key it belongs to where that key is
+// readable without unlocking. Secrets are copied as stored, so an
+// encrypted key stays encrypted under its original passphrase. dst then
+// applies its own settings, such as its manifest policy, when saving.
+func (s *Store) CopyTo(dst *Store) error {
+	if dst == s {
+		return fmt.Errorf("%w: cannot copy a keystore onto itself", ErrKeystoreExists)
+	}
+
+	data, err := s.copyDocument()
+	if err != nil {
+		return err
+	}
+	defer wipe(data)
+
+	dst.mu.Lock()
+	defer dst.mu.Unlock()
+
+	return dst.update(func() error {
+		if dst.hasPrimaryKey() || len(dst.Accounts) > 0 || dst.persisted.AuthToken != "" || dst.EncryptedToken != nil {
+			return fmt.Errorf("%w at %s", ErrKeystoreExists, dst.location())
+		}
+
+		dst.reset()
+		if err := json.Unmarshal(data, (*storeJSON)(dst)); err != nil {
+			return fmt.Errorf("failed to copy keystore: %w", err)
+		}
+		return nil
+	})
+}
+
+// copyDocument loads and checks s, returning its migrated document.
+func (s *Store) copyDocument() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if err := s.frozenError(); err != nil {
+		return nil, err
+	}
+	if err := s.checkAddresses(); err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal((*storeJSON)(s))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal keystore: %w", err)
+	}
+	return data, nil
+}
+
+// checkAddresses fails with ErrAddressMismatch if a stored address does
+// not match the public key or plaintext private key stored with it.
+func (s *Store) checkAddresses() error {
+	if s.Address != "" && (s.KeyCurve == "" || s.KeyCurve == CurveSecp256k1) {
+		addr, err := derivedAddress(s.PublicKey, s.persisted.PrivateKey)
+		if err != nil {
+			return s.corrupt("public_key", err)
+		}
+		if addr != "" && addr != s.Address {
+			return fmt.Errorf("%w: primary key derives to %s, stored %s", ErrAddressMismatch, addr, s.Address)
+		}
+	}
+
+	for name, a := range s.Accounts {
+		if a.Address == "" || a.PrivateKey == "" {
+			continue
+		}
+		addr, err := derivedAddress("", a.PrivateKey)
+		if err != nil {
+			return s.invalidStoredKey("accounts."+name, err)
+		}
+		if addr != a.Address {
+			return fmt.Errorf("%w: account %q derives to %s, stored %s", ErrAddressMismatch, name, addr, a.Address)
+		}
+	}
+	return nil
+}
+
+// derivedAddress returns the address of a secp256k1 key from its hex
+// public key or, failing that, its plaintext hex private key. It returns
+// an empty address if both are empty.
+func derivedAddress(publicKeyHex, privateKeyHex string) (string, error) {
+	switch {
+	case publicKeyHex != "":
+		data, err := hex.DecodeString(publicKeyHex)
+		if err != nil {
+			return "", err
+		}
+		pub, err := crypto.UnmarshalPubkey(data)
+		if err != nil {
+			return "", err
+		}
+		return crypto.PubkeyToAddress(*pub).Hex(), nil
+	case privateKeyHex != "":
+		key, err := parsePrivateKeyHex(privateKeyHex)
+		if err != nil {
+			return "", err
+		}
+		return crypto.PubkeyToAddress(key.PublicKey).Hex(), nil
+	}
+	return "", nil
+}
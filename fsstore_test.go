@@ -0,0 +1,168 @@
+package keystore_test
+
+import (
+	"embed"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/theblitlabs/keystore"
+	"github.com/theblitlabs/keystore/keystoretest"
+)
+
+//go:embed keystoretest/testdata/v1.json keystoretest/testdata/v2-encrypted.json
+var embedded embed.FS
+
+const (
+	embeddedV1        = "keystoretest/testdata/v1.json"
+	embeddedEncrypted = "keystoretest/testdata/v2-encrypted.json"
+	fixtureAddress    = "0x2c7536E3605D9C16a7a3D7b1898e529396a65c23"
+)
+
+func TestNewKeystoreFromFSReadOnly(t *testing.T) {
+	ks, err := keystore.NewKeystoreFromFS(embedded, embeddedEncrypted)
+	if err != nil {
+		t.Fatalf("NewKeystoreFromFS: %v", err)
+	}
+	if addr, err := ks.GetAddress(); err != nil || addr.Hex() != fixtureAddress {
+		t.Fatalf("Address = %s, %v", addr.Hex(), err)
+	}
+
+	writes := map[string]func() error{
+		"SaveToken":      func() error { return ks.SaveToken("token") },
+		"SavePrivateKey": func() error { return ks.SavePrivateKey(fileKeyHex) },
+		"SaveAccount":    func() error { return ks.SaveAccount("new", credentialKeyHex) },
+		"DeleteAccount":  func() error { return ks.DeleteAccount("ops") },
+		"Destroy":        ks.Destroy,
+	}
+	for name, write := range writes {
+		if err := write(); !errors.Is(err, keystore.ErrReadOnly) {
+			t.Errorf("%s: got %v, want ErrReadOnly", name, err)
+		}
+	}
+}
+
+func TestNewKeystoreFromFSErrors(t *testing.T) {
+	fsys := fstest.MapFS{
+		"keystore.json": {Data: []byte("{not json")},
+		"mismatch.json": {Data: []byte(`{"version": 2, "private_key": "` + fileKeyHex + `", "address": "0x0000000000000000000000000000000000000001"}`)},
+	}
+
+	var cerr *keystore.ConfigError
+	if _, err := keystore.NewKeystoreFromFS(fsys, "../keystore.json"); !errors.As(err, &cerr) {
+		t.Errorf("invalid path: got %v, want a ConfigError", err)
+	}
+
+	tests := []struct {
+		name string
+		file string
+		want error
+	}{
+		{name: "missing", file: "missing.json", want: keystore.ErrNoKeystore},
+		{name: "corrupt", file: "keystore.json", want: keystore.ErrCorruptKeystore},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := keystore.NewKeystoreFromFS(fsys, tt.file); !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// A document whose address does not match its key opens, but is not
+	// copied anywhere.
+	src, err := keystore.NewKeystoreFromFS(fsys, "mismatch.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	dst, err := keystore.NewKeystore(keystore.Config{DirPath: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := src.CopyTo(dst); !errors.Is(err, keystore.ErrAddressMismatch) {
+		t.Fatalf("CopyTo: got %v, want ErrAddressMismatch", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, keystore.DefaultFileName)); !os.IsNotExist(err) {
+		t.Fatalf("failed CopyTo wrote the destination: %v", err)
+	}
+}
+
+func TestCopyTo(t *testing.T) {
+	t.Run("encrypted", func(t *testing.T) {
+		src, err := keystore.NewKeystoreFromFS(embedded, embeddedEncrypted)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dir := t.TempDir()
+		dst, err := keystore.NewKeystore(keystore.Config{
+			DirPath:    dir,
+			Passphrase: keystore.StaticPassphrase(keystoretest.FixturePassphrase),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := src.CopyTo(dst); err != nil {
+			t.Fatalf("CopyTo: %v", err)
+		}
+
+		// The key stays encrypted under the fixture's passphrase.
+		data, err := os.ReadFile(filepath.Join(dir, keystore.DefaultFileName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(data), "4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318") {
+			t.Fatal("copy holds the plaintext key")
+		}
+		key, err := dst.LoadPrivateKey()
+		if err != nil {
+			t.Fatalf("LoadPrivateKey: %v", err)
+		}
+		if hexKey(key) != "4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318" {
+			t.Fatal("copied key differs")
+		}
+
+		// The copy is writable, and cannot be copied over.
+		if err := dst.SaveToken("writable"); err != nil {
+			t.Fatalf("SaveToken on the copy: %v", err)
+		}
+		if err := src.CopyTo(dst); !errors.Is(err, keystore.ErrKeystoreExists) {
+			t.Fatalf("CopyTo over a keystore: got %v, want ErrKeystoreExists", err)
+		}
+		if err := src.CopyTo(src); !errors.Is(err, keystore.ErrKeystoreExists) {
+			t.Fatalf("CopyTo onto itself: got %v, want ErrKeystoreExists", err)
+		}
+	})
+
+	t.Run("migrated", func(t *testing.T) {
+		src, err := keystore.NewKeystoreFromFS(embedded, embeddedV1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dir := t.TempDir()
+		dst, err := keystore.NewKeystore(newTestClock(epoch).config(keystore.Config{DirPath: dir}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := src.CopyTo(dst); err != nil {
+			t.Fatalf("CopyTo: %v", err)
+		}
+
+		info, err := keystore.IdentifyFile(filepath.Join(dir, keystore.DefaultFileName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.SchemaVersion != keystore.SchemaVersion {
+			t.Fatalf("copy has schema version %d, want %d", info.SchemaVersion, keystore.SchemaVersion)
+		}
+		if token, err := dst.LoadToken(); err != nil || token != "conformance-token" {
+			t.Fatalf("LoadToken = %q, %v", token, err)
+		}
+		if addr, err := dst.GetAddress(); err != nil || addr.Hex() != fixtureAddress {
+			t.Fatalf("Address = %s, %v", addr.Hex(), err)
+		}
+	})
+}
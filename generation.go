@@ -0,0 +1,168 @@
+package keystore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// generationSuffix names the sidecar file holding the generation of a file
+// keystore.
+const generationSuffix = ".gen"
+
+// generationBackend is implemented by backends that keep a generation
+// file next to the keystore, incremented on every write.
+type generationBackend interface {
+	generationPath() string
+}
+
+func (b *FileBackend) generationPath() string {
+	return b.path + generationSuffix
+}
+
+// generationPath is next to the key file, and counts writes to either
+// file.
+func (b *SplitFileBackend) generationPath() string {
+	return b.key.path + generationSuffix
+}
+
+// Generation returns the number of writes to the keystore so far, as kept
+// in a small sidecar file next to file keystores. It changes with every
+// save by any Store or process, so comparing it is a cheap way to tell
+// whether the keystore changed. A keystore never written, or written by a
+// release without generations, is at generation 0. Backends other than the
+// file, split and memory backends fail with ErrGenerationUnsupported.
+// Destroy leaves the generation file in place, so it never goes back.
+func (s *Store) Generation() (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	read, err := s.generationReader()
+	if err != nil {
+		return 0, err
+	}
+	return read()
+}
+
+// PollChanges reads the generation every interval, one small file read,
+// and sends its new value on the returned channel whenever it changes,
+// for processes that must reload after another one saves where
+// filesystem notifications are unreliable, as on some network
+// filesystems. A receiver that falls behind gets the latest value. The
+// channel is closed when ctx is done.
+func (s *Store) PollChanges(ctx context.Context, interval time.Duration) (<-chan uint64, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("%w: must be positive, got %v", ErrInvalidPollInterval, interval)
+	}
+
+	s.mu.Lock()
+	read, err := s.generationReader()
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	last, err := read()
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan uint64, 1)
+	go func() {
+		defer close(ch)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			gen, err := read()
+			if err != nil {
+				s.config.Logger.Warn("keystore: failed to read generation", "location", s.location(), "error", err)
+				continue
+			}
+			if gen == last {
+				continue
+			}
+			last = gen
+
+			// Replace a value the receiver has not taken yet.
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- gen
+		}
+	}()
+	return ch, nil
+}
+
+// generationReader returns a function reading the generation of the
+// backend without the Store lock.
+func (s *Store) generationReader() (func() (uint64, error), error) {
+	if b, ok := s.backend.(generationBackend); ok {
+		path := b.generationPath()
+		return func() (uint64, error) { return readGeneration(path) }, nil
+	}
+	if b, ok := s.backend.(*MemoryBackend); ok {
+		return func() (uint64, error) {
+			stamp, err := b.stamp()
+			return stamp.gen, err
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrGenerationUnsupported, s.location())
+}
+
+// bumpGeneration increments the generation file after a write. Writers
+// of the split backend's two files do not share a lock, so the increment
+// takes a lock of its own. A failure is logged, since the write itself
+// succeeded.
+func (s *Store) bumpGeneration() {
+	b, ok := s.backend.(generationBackend)
+	if !ok {
+		return
+	}
+	path := b.generationPath()
+
+	err := func() error {
+		release, err := (&FileBackend{path: path}).acquireLock(scopeStore, s.lockTimeout())
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		gen, err := readGeneration(path)
+		if err != nil {
+			// Restart from a damaged file rather than stop counting.
+			s.config.Logger.Warn("keystore: resetting damaged generation file", "path", path, "error", err)
+			gen = 0
+		}
+		return writeFileAtomic(path, []byte(strconv.FormatUint(gen+1, 10)+"\n"), DefaultFileMode)
+	}()
+	if err != nil {
+		s.config.Logger.Warn("keystore: failed to update generation file", "path", path, "error", err)
+	}
+}
+
+func readGeneration(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read generation: %w", err)
+	}
+	gen, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid generation file %s: %w", path, err)
+	}
+	return gen, nil
+}
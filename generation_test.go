@@ -0,0 +1,223 @@
+package keystore_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/theblitlabs/keystore"
+)
+
+const pollInterval = 5 * time.Millisecond
+
+// assertGeneration fails unless ks reports generation want.
+func assertGeneration(t *testing.T, ks *keystore.Store, want uint64) {
+	t.Helper()
+
+	if gen, err := ks.Generation(); err != nil || gen != want {
+		t.Fatalf("Generation = %d, %v, want %d", gen, err, want)
+	}
+}
+
+// receiveGeneration waits for the next generation on ch.
+func receiveGeneration(t *testing.T, ch <-chan uint64) uint64 {
+	t.Helper()
+
+	select {
+	case gen, ok := <-ch:
+		if !ok {
+			t.Fatal("PollChanges channel closed")
+		}
+		return gen
+	case <-time.After(5 * time.Second):
+		t.Fatal("PollChanges sent nothing")
+		return 0
+	}
+}
+
+func TestGeneration(t *testing.T) {
+	for name, cfg := range map[string]keystore.Config{
+		"file":   {DirPath: t.TempDir()},
+		"split":  {DirPath: t.TempDir(), SplitFiles: true},
+		"memory": {Backend: keystore.NewMemoryBackend()},
+	} {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			ks := newErrorStore(t, cfg)
+			assertGeneration(t, ks, 0)
+
+			if err := ks.SaveToken("token"); err != nil {
+				t.Fatal(err)
+			}
+			assertGeneration(t, ks, 1)
+			if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+				t.Fatal(err)
+			}
+			assertGeneration(t, ks, 2)
+
+			// Reads do not count.
+			if _, err := ks.LoadToken(); err != nil {
+				t.Fatal(err)
+			}
+			assertGeneration(t, ks, 2)
+
+			// Every Store on the keystore shares the count.
+			other := newErrorStore(t, cfg)
+			assertGeneration(t, other, 2)
+			if err := other.SaveToken("other"); err != nil {
+				t.Fatal(err)
+			}
+			assertGeneration(t, ks, 3)
+		})
+	}
+}
+
+func TestGenerationUnsupported(t *testing.T) {
+	ks := newErrorStore(t, keystore.Config{Backend: struct{ *keystore.MemoryBackend }{keystore.NewMemoryBackend()}})
+	if _, err := ks.Generation(); !errors.Is(err, keystore.ErrGenerationUnsupported) {
+		t.Fatalf("Generation: got %v, want ErrGenerationUnsupported", err)
+	}
+	if _, err := ks.PollChanges(context.Background(), pollInterval); !errors.Is(err, keystore.ErrGenerationUnsupported) {
+		t.Fatalf("PollChanges: got %v, want ErrGenerationUnsupported", err)
+	}
+}
+
+func TestGenerationDamagedFile(t *testing.T) {
+	dir := t.TempDir()
+	var logs bytes.Buffer
+	ks := newErrorStore(t, keystore.Config{DirPath: dir, Logger: slog.New(slog.NewTextHandler(&logs, nil))})
+	if err := ks.SaveToken("token"); err != nil {
+		t.Fatal(err)
+	}
+
+	genPath := filepath.Join(dir, keystore.DefaultFileName+".gen")
+	if err := os.WriteFile(genPath, []byte("garbage\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Generation(); err == nil {
+		t.Fatal("Generation of a damaged file succeeded")
+	}
+
+	// The next save restarts the count rather than failing.
+	if err := ks.SaveToken("token"); err != nil {
+		t.Fatalf("SaveToken with a damaged generation file: %v", err)
+	}
+	assertGeneration(t, ks, 1)
+	if !strings.Contains(logs.String(), "resetting damaged generation file") {
+		t.Fatalf("no warning about the damaged file, logged %q", logs.String())
+	}
+}
+
+func TestPollChanges(t *testing.T) {
+	dir := t.TempDir()
+	reader := newErrorStore(t, keystore.Config{DirPath: dir})
+	writer := newErrorStore(t, keystore.Config{DirPath: dir})
+	if err := writer.SaveToken("first"); err != nil {
+		t.Fatal(err)
+	}
+	if token, err := reader.LoadToken(); err != nil || token != "first" {
+		t.Fatalf("LoadToken = %q, %v", token, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes, err := reader.PollChanges(ctx, pollInterval)
+	if err != nil {
+		t.Fatalf("PollChanges: %v", err)
+	}
+
+	// Nothing is sent until the generation changes.
+	select {
+	case gen := <-changes:
+		t.Fatalf("PollChanges sent %d without a change", gen)
+	case <-time.After(10 * pollInterval):
+	}
+
+	if err := writer.SaveToken("second"); err != nil {
+		t.Fatal(err)
+	}
+	if gen := receiveGeneration(t, changes); gen != 2 {
+		t.Fatalf("PollChanges sent %d, want 2", gen)
+	}
+	if token, err := reader.LoadToken(); err != nil || token != "second" {
+		t.Fatalf("LoadToken after the change = %q, %v, want the other Store's token", token, err)
+	}
+
+	cancel()
+	for range changes {
+	}
+}
+
+func TestPollChangesCoalesces(t *testing.T) {
+	dir := t.TempDir()
+	reader := newErrorStore(t, keystore.Config{DirPath: dir})
+	writer := newErrorStore(t, keystore.Config{DirPath: dir})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes, err := reader.PollChanges(ctx, pollInterval)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A receiver that falls behind gets the latest generation, not a
+	// backlog of old ones.
+	for i := 0; i < 5; i++ {
+		if err := writer.SaveToken("token"); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(3 * pollInterval)
+	}
+	waitFor(t, "the last generation", func() bool {
+		gen, err := writer.Generation()
+		return err == nil && gen == 5
+	})
+	time.Sleep(5 * pollInterval)
+	if gen := receiveGeneration(t, changes); gen != 5 {
+		t.Fatalf("PollChanges sent %d to a slow receiver, want the latest, 5", gen)
+	}
+	select {
+	case gen := <-changes:
+		t.Fatalf("PollChanges sent %d after the latest generation", gen)
+	default:
+	}
+
+	if _, err := reader.PollChanges(ctx, 0); !errors.Is(err, keystore.ErrInvalidPollInterval) {
+		t.Fatalf("PollChanges with no interval: got %v, want ErrInvalidPollInterval", err)
+	}
+}
+
+func TestKeyCacheOtherStoreWrites(t *testing.T) {
+	dir := t.TempDir()
+	reader := newErrorStore(t, keystore.Config{DirPath: dir})
+	writer := newErrorStore(t, keystore.Config{DirPath: dir})
+	if err := writer.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if key, err := reader.LoadPrivateKey(); err != nil || hexKey(key) != fileKeyHex {
+		t.Fatalf("LoadPrivateKey = %v", err)
+	}
+
+	// Re-keying yields a file of the same size, here with the same
+	// modification time; the Store still drops its cached key.
+	info, err := os.Stat(filepath.Join(dir, keystore.DefaultFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.SavePrivateKey(credentialKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, keystore.DefaultFileName)
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if key, err := reader.LoadPrivateKey(); err != nil || hexKey(key) != credentialKeyHex {
+		t.Fatalf("LoadPrivateKey after another Store re-keyed: %v, want the new key", err)
+	}
+}
@@ -0,0 +1,306 @@
+package keystore
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	gethkeystore "github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/google/uuid"
+)
+
+// ImportEntry describes one item considered by an import.
+type ImportEntry struct {
+	Source string `json:"source"`
+	Name   string `json:"name,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// ImportReport lists what an import stored, skipped and failed to import.
+type ImportReport struct {
+	Imported []ImportEntry `json:"imported"`
+	Skipped  []ImportEntry `json:"skipped"`
+	Failed   []ImportEntry `json:"failed"`
+}
+
+// v3Header holds the fields used to recognise a V3 keystore file without
+// decrypting it.
+type v3Header struct {
+	Address string          `json:"address"`
+	Crypto  json.RawMessage `json:"crypto"`
+	Version int             `json:"version"`
+}
+
+// ImportKeystoreDir imports every geth V3 keystore file in dir as a named
+// account whose name is the EIP-55 address. passphraseFor is called with each
+// file's address to obtain its passphrase. Each successful import is saved
+// immediately, so an interrupted import can be resumed: addresses already
+// present are skipped, and a watch-only account for an address gains its key
+// under its existing name. Individual failures, such as a wrong passphrase, are
+// recorded in the report without aborting the rest of the import.
+func (s *Store) ImportKeystoreDir(dir string, passphraseFor func(address string) (string, error)) (ImportReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := ImportReport{Imported: []ImportEntry{}, Skipped: []ImportEntry{}, Failed: []ImportEntry{}}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return report, fmt.Errorf("failed to read keystore directory: %w", err)
+	}
+
+	if err := s.load(); err != nil && !isNoKeystore(err) {
+		return report, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		result, ok := s.importV3File(path, passphraseFor)
+		switch {
+		case !ok:
+			report.Failed = append(report.Failed, result)
+		case result.Reason != "":
+			report.Skipped = append(report.Skipped, result)
+		default:
+			report.Imported = append(report.Imported, result)
+		}
+	}
+
+	return report, nil
+}
+
+// importV3File imports a single file. It reports false on failure; a
+// successful result with a Reason set means the file was skipped.
+func (s *Store) importV3File(path string, passphraseFor func(address string) (string, error)) (ImportEntry, bool) {
+	result := ImportEntry{Source: path}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		result.Reason = fmt.Sprintf("failed to read file: %v", err)
+		return result, false
+	}
+
+	var header v3Header
+	if err := json.Unmarshal(data, &header); err != nil || header.Version != 3 || len(header.Crypto) == 0 {
+		result.Reason = "not a V3 keystore file"
+		return result, true
+	}
+
+	addr := common.HexToAddress(header.Address)
+	result.Name = addr.Hex()
+
+	// A watch-only account for addr is upgraded in place.
+	name, existing, exists := s.accountByAddress(addr)
+	if exists {
+		result.Name = name
+		if !existing.WatchOnly {
+			result.Reason = "already imported"
+			return result, true
+		}
+	}
+
+	passphrase, err := passphraseFor(addr.Hex())
+	if err != nil {
+		result.Reason = fmt.Sprintf("failed to obtain passphrase: %v", err)
+		return result, false
+	}
+
+	key, err := gethkeystore.DecryptKey(data, passphrase)
+	if err != nil {
+		result.Reason = fmt.Sprintf("failed to decrypt: %v", err)
+		return result, false
+	}
+
+	if key.Address != addr {
+		result.Reason = fmt.Sprintf("key derives to %s, file claims %s", key.Address.Hex(), addr.Hex())
+		return result, false
+	}
+
+	privateKeyHex := hex.EncodeToString(crypto.FromECDSA(key.PrivateKey))
+	if err := ValidatePrivateKeyHex(privateKeyHex); err != nil {
+		result.Reason = err.Error()
+		return result, false
+	}
+	var previous *Account
+	if exists {
+		saved := *existing
+		previous = &saved
+	}
+
+	if err := s.putAccount(result.Name, key.PrivateKey, privateKeyHex, s.newProvenance(ProvenanceGeth, path)); err != nil {
+		result.Reason = err.Error()
+		return result, false
+	}
+
+	if err := s.save(); err != nil {
+		if previous != nil {
+			s.Accounts[result.Name] = previous
+		} else {
+			delete(s.Accounts, result.Name)
+		}
+		result.Reason = err.Error()
+		return result, false
+	}
+
+	return result, true
+}
+
+// ExportToKeystoreDir writes the primary key and every named account as a
+// geth V3 keystore file encrypted with passphrase, using geth's standard
+// scrypt parameters and UTC--<timestamp>--<address> file names. Watch-only
+// accounts are skipped. Existing files for the same address are left alone
+// and reported as an error unless overwrite is set.
+func (s *Store) ExportToKeystoreDir(dir, passphrase string, overwrite bool, opts ...ExportOption) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer func() { s.audit(AuditExport, "", err) }()
+
+	if err := s.redeemExport("ExportToKeystoreDir", ExportScopeFull, opts); err != nil {
+		return err
+	}
+
+	keys, err := s.exportableKeys()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, DefaultDirMode); err != nil {
+		return fmt.Errorf("failed to create export directory: %w", err)
+	}
+
+	existing, err := v3FilesByAddress(dir)
+	if err != nil {
+		return err
+	}
+
+	if !overwrite {
+		for _, key := range keys {
+			addr := crypto.PubkeyToAddress(key.PublicKey)
+			if len(existing[addr]) > 0 {
+				return fmt.Errorf("%w: %s already has a keystore file in %s", ErrExportExists, addr.Hex(), dir)
+			}
+		}
+	}
+
+	for _, key := range keys {
+		addr := crypto.PubkeyToAddress(key.PublicKey)
+
+		data, err := gethkeystore.EncryptKey(&gethkeystore.Key{
+			Id:         uuid.New(),
+			Address:    addr,
+			PrivateKey: key,
+		}, passphrase, gethkeystore.StandardScryptN, gethkeystore.StandardScryptP)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt %s: %w", addr.Hex(), err)
+		}
+
+		path := filepath.Join(dir, v3FileName(addr, s.now()))
+		if err := writeFileAtomic(path, data, DefaultFileMode); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+
+		for _, old := range existing[addr] {
+			if old != path {
+				if err := os.Remove(old); err != nil && !os.IsNotExist(err) {
+					return fmt.Errorf("failed to remove replaced file %s: %w", old, err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// exportableKeys returns the primary key, if any, followed by every named
+// account that holds a key, deduplicated by address.
+func (s *Store) exportableKeys() ([]*ecdsa.PrivateKey, error) {
+	var keys []*ecdsa.PrivateKey
+	seen := make(map[common.Address]bool)
+
+	add := func(key *ecdsa.PrivateKey) {
+		addr := crypto.PubkeyToAddress(key.PublicKey)
+		if !seen[addr] {
+			seen[addr] = true
+			keys = append(keys, key)
+		}
+	}
+
+	key, _, err := s.primaryKey()
+	switch {
+	case err == nil:
+		add(key)
+	case !errors.Is(err, ErrNoPrivateKey) && !isNoKeystore(err):
+		return nil, err
+	}
+
+	names := make([]string, 0, len(s.Accounts))
+	for name, account := range s.Accounts {
+		if !account.WatchOnly {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		key, err := s.accountKey(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load account %q: %w", name, err)
+		}
+		add(key)
+	}
+
+	if len(keys) == 0 {
+		return nil, ErrNoPrivateKey
+	}
+
+	return keys, nil
+}
+
+func v3FilesByAddress(dir string) (map[common.Address][]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read export directory: %w", err)
+	}
+
+	files := make(map[common.Address][]string)
+	for _, entry := range entries {
+		name := entry.Name()
+		i := strings.LastIndex(name, "--")
+		if entry.IsDir() || !strings.HasPrefix(name, "UTC--") || i < 0 {
+			continue
+		}
+
+		suffix := name[i+2:]
+		if len(suffix) != 2*common.AddressLength || !common.IsHexAddress(suffix) {
+			continue
+		}
+
+		addr := common.HexToAddress(suffix)
+		files[addr] = append(files[addr], filepath.Join(dir, name))
+	}
+
+	return files, nil
+}
+
+// v3FileName mirrors the naming geth uses for keystore files.
+func v3FileName(addr common.Address, t time.Time) string {
+	t = t.UTC()
+	ts := fmt.Sprintf("%04d-%02d-%02dT%02d-%02d-%02d.%09dZ",
+		t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond())
+	return fmt.Sprintf("UTC--%s--%s", ts, hex.EncodeToString(addr[:]))
+}
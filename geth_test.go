@@ -0,0 +1,237 @@
+package keystore_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	gethkeystore "github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/google/uuid"
+	"github.com/theblitlabs/keystore"
+	"github.com/theblitlabs/keystore/faultinject"
+)
+
+// writeV3 writes keyHex to dir/name as a geth V3 file and returns its address.
+func writeV3(t *testing.T, dir, name, keyHex, passphrase string) common.Address {
+	t.Helper()
+
+	key, err := crypto.HexToECDSA(keyHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := &gethkeystore.Key{Id: uuid.New(), Address: crypto.PubkeyToAddress(key.PublicKey), PrivateKey: key}
+	data, err := gethkeystore.EncryptKey(k, passphrase, gethkeystore.LightScryptN, gethkeystore.LightScryptP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return k.Address
+}
+
+func TestImportKeystoreDir(t *testing.T) {
+	src := t.TempDir()
+	first := writeV3(t, src, "a.json", fileKeyHex, "one")
+	writeV3(t, src, "b.json", credentialKeyHex, "two")
+	if err := os.WriteFile(filepath.Join(src, "notes.txt"), []byte("hello"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := keystore.NewKeystore(keystore.Config{DirPath: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	passphrases := map[string]string{first.Hex(): "one"}
+	passphraseFor := func(addr string) (string, error) { return passphrases[addr], nil }
+
+	report, err := s.ImportKeystoreDir(src, passphraseFor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Imported) != 1 || report.Imported[0].Name != first.Hex() {
+		t.Errorf("Imported = %+v, want %s", report.Imported, first.Hex())
+	}
+	if len(report.Failed) != 1 || len(report.Skipped) != 1 {
+		t.Errorf("report = %+v, want one failure and one skipped file", report)
+	}
+
+	// Resuming with the right passphrase imports the rest and skips the first.
+	passphrases[crypto.PubkeyToAddress(mustKey(t, credentialKeyHex).PublicKey).Hex()] = "two"
+	report, err = s.ImportKeystoreDir(src, passphraseFor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Imported) != 1 || len(report.Failed) != 0 || len(report.Skipped) != 2 {
+		t.Errorf("resumed report = %+v, want one import and two skipped files", report)
+	}
+}
+
+func TestImportKeystoreDirUpgradesWatchOnly(t *testing.T) {
+	src := t.TempDir()
+	addr := writeV3(t, src, "a.json", fileKeyHex, "pass")
+
+	s, err := keystore.NewKeystore(keystore.Config{DirPath: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveWatchAddress("treasury", addr); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := s.ImportKeystoreDir(src, func(string) (string, error) { return "pass", nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Imported) != 1 || report.Imported[0].Name != "treasury" {
+		t.Fatalf("Imported = %+v, want the watched account", report.Imported)
+	}
+
+	accounts, err := s.ListAccounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 1 || accounts[0].Name != "treasury" || accounts[0].WatchOnly {
+		t.Errorf("accounts = %+v, want treasury upgraded in place", accounts)
+	}
+	if _, err := s.LoadAccountKey("treasury"); err != nil {
+		t.Errorf("LoadAccountKey: %v", err)
+	}
+}
+
+func TestImportKeystoreDirFailedSaveKeepsWatchOnly(t *testing.T) {
+	src := t.TempDir()
+	watched := writeV3(t, src, "a.json", fileKeyHex, "pass")
+	other := writeV3(t, src, "b.json", credentialKeyHex, "pass")
+
+	inj := faultinject.New()
+	s, err := keystore.NewKeystore(keystore.Config{DirPath: t.TempDir(), FaultInjector: inj})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveWatchAddress("treasury", watched); err != nil {
+		t.Fatal(err)
+	}
+
+	inj.Once(keystore.FaultOpSave, keystore.Fault{Err: errors.New("disk full")})
+	report, err := s.ImportKeystoreDir(src, func(string) (string, error) { return "pass", nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Failed) != 1 || len(report.Imported) != 1 || report.Imported[0].Name != other.Hex() {
+		t.Fatalf("report = %+v, want the first file failed and the second imported", report)
+	}
+
+	infos, err := s.ListAccounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]keystore.AccountInfo)
+	for _, info := range infos {
+		byName[info.Name] = info
+	}
+	if info, ok := byName["treasury"]; !ok || !info.WatchOnly {
+		t.Errorf("treasury = %+v, want it kept as watch-only", info)
+	}
+	if len(byName) != 2 {
+		t.Errorf("accounts = %+v, want treasury and %s", infos, other.Hex())
+	}
+}
+
+func TestExportToKeystoreDir(t *testing.T) {
+	if testing.Short() {
+		t.Skip("encrypts with geth's standard scrypt parameters")
+	}
+
+	clock := newTestClock(epoch)
+	ks := newErrorStore(t, clock.config(keystore.Config{}))
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveAccount("ops", credentialKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveWatchAddress("cold", dumpWatchAddress); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := ks.ExportToKeystoreDir(dir, "geth passphrase", false); err != nil {
+		t.Fatalf("ExportToKeystoreDir: %v", err)
+	}
+
+	// go-ethereum decrypts every exported file to the key it came from;
+	// the watch-only account has nothing to export.
+	want := map[common.Address]string{}
+	for _, keyHex := range []string{fileKeyHex, credentialKeyHex} {
+		want[crypto.PubkeyToAddress(mustKey(t, keyHex).PublicKey)] = keyHex
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("exported %d files, want %d", len(entries), len(want))
+	}
+	for _, e := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := gethkeystore.DecryptKey(data, "geth passphrase")
+		if err != nil {
+			t.Fatalf("DecryptKey(%s): %v", e.Name(), err)
+		}
+		keyHex, ok := want[key.Address]
+		if !ok || key.Address != crypto.PubkeyToAddress(key.PrivateKey.PublicKey) {
+			t.Fatalf("%s holds an unexpected key for %s", e.Name(), key.Address.Hex())
+		}
+		if !key.PrivateKey.Equal(mustKey(t, keyHex)) {
+			t.Fatalf("%s decrypts to another key than %s", e.Name(), key.Address.Hex())
+		}
+		if prefix := "UTC--2024-01-01T00-00-00.000000000Z--"; e.Name() != prefix+strings.ToLower(key.Address.Hex()[2:]) {
+			t.Errorf("file name %s, want geth's for %s", e.Name(), key.Address.Hex())
+		}
+		if _, err := gethkeystore.DecryptKey(data, "wrong passphrase"); err == nil {
+			t.Fatalf("%s decrypted with the wrong passphrase", e.Name())
+		}
+		delete(want, key.Address)
+	}
+
+	// Exported files import back into a fresh keystore.
+	imported := newErrorStore(t, keystore.Config{})
+	if _, err := imported.ImportKeystoreDir(dir, func(string) (string, error) { return "geth passphrase", nil }); err != nil {
+		t.Fatalf("ImportKeystoreDir of the export: %v", err)
+	}
+	if accounts, err := imported.ListAccounts(); err != nil || len(accounts) != 2 {
+		t.Fatalf("imported accounts = %v, %v, want 2", accounts, err)
+	}
+
+	// A second export refuses to add files for the same addresses, unless
+	// told to replace them.
+	clock.Advance(time.Second)
+	if err := ks.ExportToKeystoreDir(dir, "geth passphrase", false); !errors.Is(err, keystore.ErrExportExists) {
+		t.Fatalf("second export: got %v, want ErrExportExists", err)
+	}
+	if err := ks.ExportToKeystoreDir(dir, "new passphrase", true); err != nil {
+		t.Fatalf("overwriting export: %v", err)
+	}
+	entries, err = os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("after overwriting, %d files, want one per address", len(entries))
+	}
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), "UTC--2024-01-01T00-00-01.") {
+			t.Errorf("overwriting kept %s", e.Name())
+		}
+	}
+}
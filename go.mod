@@ -2,12 +2,44 @@ module github.com/theblitlabs/keystore
 
 go 1.21
 
-require github.com/ethereum/go-ethereum v1.13.14
+require (
+	github.com/BurntSushi/toml v1.3.2
+	github.com/ProtonMail/go-crypto v1.1.6
+	github.com/ethereum/go-ethereum v1.13.14
+	github.com/go-piv/piv-go v1.11.0
+	github.com/google/go-tpm v0.9.0
+	github.com/google/uuid v1.3.0
+	github.com/tyler-smith/go-bip39 v1.1.0
+	golang.org/x/crypto v0.17.0
+	golang.org/x/sys v0.16.0
+	golang.org/x/term v0.16.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
+	github.com/Microsoft/go-winio v0.6.1 // indirect
+	github.com/StackExchange/wmi v1.2.1 // indirect
+	github.com/bits-and-blooms/bitset v1.10.0 // indirect
 	github.com/btcsuite/btcd/btcec/v2 v2.2.0 // indirect
+	github.com/cloudflare/circl v1.3.7 // indirect
+	github.com/consensys/bavard v0.1.13 // indirect
+	github.com/consensys/gnark-crypto v0.12.1 // indirect
+	github.com/crate-crypto/go-kzg-4844 v0.7.0 // indirect
+	github.com/deckarep/golang-set/v2 v2.1.0 // indirect
 	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.0.1 // indirect
+	github.com/ethereum/c-kzg-4844 v0.4.0 // indirect
+	github.com/fsnotify/fsnotify v1.6.0 // indirect
+	github.com/go-ole/go-ole v1.3.0 // indirect
+	github.com/gorilla/websocket v1.4.2 // indirect
 	github.com/holiman/uint256 v1.2.4 // indirect
-	golang.org/x/crypto v0.17.0 // indirect
-	golang.org/x/sys v0.16.0 // indirect
+	github.com/mmcloughlin/addchain v0.4.0 // indirect
+	github.com/shirou/gopsutil v3.21.4-0.20210419000835-c7a38de76ee5+incompatible // indirect
+	github.com/supranational/blst v0.3.11 // indirect
+	github.com/tklauser/go-sysconf v0.3.12 // indirect
+	github.com/tklauser/numcpus v0.6.1 // indirect
+	golang.org/x/exp v0.0.0-20231110203233-9a3e6036ecaa // indirect
+	golang.org/x/mod v0.14.0 // indirect
+	golang.org/x/sync v0.5.0 // indirect
+	golang.org/x/tools v0.15.0 // indirect
+	rsc.io/tmplfunc v0.0.3 // indirect
 )
@@ -0,0 +1,154 @@
+package keystore
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultPath returns the keystore directory NewKeystore uses when
+// Config.DirPath is empty: DefaultDirName in the home directory. The home
+// directory is taken from $HOME, then $USERPROFILE, then the user database.
+// If none yields an absolute path, DefaultPath fails with ErrNoHomeDir,
+// listing every location tried, rather than fall back to a shared temporary
+// directory such as /tmp.
+func DefaultPath() (string, error) {
+	home, err := homeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, DefaultDirName), nil
+}
+
+// homeDir resolves the home directory as DefaultPath describes.
+func homeDir() (string, error) {
+	var tried []string
+
+	for _, env := range []string{"HOME", "USERPROFILE"} {
+		dir, ok := os.LookupEnv(env)
+		switch {
+		case !ok || dir == "":
+			tried = append(tried, "$"+env+" is not set")
+		case !filepath.IsAbs(dir):
+			tried = append(tried, fmt.Sprintf("$%s=%q is not an absolute path", env, dir))
+		default:
+			return dir, nil
+		}
+	}
+
+	u, err := user.Current()
+	switch {
+	case err != nil:
+		tried = append(tried, fmt.Sprintf("user lookup failed: %v", err))
+	case u.HomeDir == "":
+		tried = append(tried, fmt.Sprintf("user %q has no home directory", u.Username))
+	case !filepath.IsAbs(u.HomeDir):
+		tried = append(tried, fmt.Sprintf("home directory %q of user %q is not an absolute path", u.HomeDir, u.Username))
+	default:
+		return u.HomeDir, nil
+	}
+
+	return "", fmt.Errorf("%w (%s); refusing to fall back to %s, set Config.DirPath",
+		ErrNoHomeDir, strings.Join(tried, "; "), os.TempDir())
+}
+
+// PathMode selects where NewKeystore puts a keystore whose Config.DirPath
+// is empty or relative. An absolute DirPath is always used as is.
+type PathMode int
+
+const (
+	// PathModeHome puts the keystore in DefaultPath, and resolves relative
+	// DirPaths against the working directory. It is the default.
+	PathModeHome PathMode = iota
+
+	// PathModeExecutable puts the keystore next to the executable, for
+	// portable installs such as a tool run from a USB stick: an empty
+	// DirPath becomes DefaultDirName in the executable's directory, and a
+	// relative one is resolved against it. Symlinks to the executable are
+	// followed, so the keystore lives with the real binary. If that
+	// directory cannot be written, NewKeystore fails with
+	// ErrStorageReadOnly rather than use the home directory, unless
+	// Config.FallbackDirs are given.
+	PathModeExecutable
+
+	// PathModeWorkingDir puts the keystore in DefaultDirName in the working
+	// directory, and resolves relative DirPaths against it, as of the call
+	// to NewKeystore.
+	PathModeWorkingDir
+)
+
+func (m PathMode) String() string {
+	switch m {
+	case PathModeHome:
+		return "home"
+	case PathModeExecutable:
+		return "executable"
+	case PathModeWorkingDir:
+		return "working-dir"
+	default:
+		return fmt.Sprintf("PathMode(%d)", int(m))
+	}
+}
+
+// resolveDirPath applies mode to dirPath.
+func resolveDirPath(dirPath string, mode PathMode) (string, error) {
+	if filepath.IsAbs(dirPath) {
+		return dirPath, nil
+	}
+
+	var base string
+	var err error
+	switch mode {
+	case PathModeHome:
+		if dirPath != "" {
+			return dirPath, nil
+		}
+		return DefaultPath()
+	case PathModeExecutable:
+		base, err = executableDir()
+	case PathModeWorkingDir:
+		base, err = os.Getwd()
+		if err != nil {
+			err = fmt.Errorf("failed to determine the working directory: %w", err)
+		}
+	default:
+		return "", configError("PathMode", fmt.Sprintf("unknown path mode %d", int(mode)))
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if dirPath == "" {
+		dirPath = DefaultDirName
+	}
+	return filepath.Join(base, dirPath), nil
+}
+
+// executableDir returns the directory of the running executable, with
+// symlinks resolved.
+func executableDir() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate the executable: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	return filepath.Dir(exe), nil
+}
+
+// checkExecutableDir fails with ErrStorageReadOnly, and advice, if dir,
+// next to the executable, cannot be written.
+func checkExecutableDir(dir string) error {
+	roErr, err := prepareDir(dir, true)
+	if roErr == nil {
+		if err != nil {
+			return fmt.Errorf("failed to create keystore directory: %w", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w; PathModeExecutable keeps the keystore next to the executable, so move the "+
+		"installation to writable storage, set an absolute Config.DirPath or configure Config.FallbackDirs", roErr)
+}
@@ -0,0 +1,290 @@
+package keystore_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/theblitlabs/keystore"
+)
+
+func TestDefaultPath(t *testing.T) {
+	home, profile := t.TempDir(), t.TempDir()
+
+	tests := []struct {
+		name    string
+		home    string
+		profile string
+		want    string
+	}{
+		{name: "HOME", home: home, profile: profile, want: home},
+		{name: "USERPROFILE without HOME", profile: profile, want: profile},
+		{name: "relative HOME is skipped", home: "relative", profile: profile, want: profile},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOME", tt.home)
+			t.Setenv("USERPROFILE", tt.profile)
+
+			got, err := keystore.DefaultPath()
+			if err != nil {
+				t.Fatalf("DefaultPath: %v", err)
+			}
+			if want := filepath.Join(tt.want, keystore.DefaultDirName); got != want {
+				t.Fatalf("DefaultPath = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestDefaultPathUserLookup(t *testing.T) {
+	t.Setenv("HOME", "")
+	t.Setenv("USERPROFILE", "relative")
+
+	got, err := keystore.DefaultPath()
+
+	u, uerr := user.Current()
+	if uerr == nil && filepath.IsAbs(u.HomeDir) {
+		if err != nil || got != filepath.Join(u.HomeDir, keystore.DefaultDirName) {
+			t.Fatalf("DefaultPath = %s, %v, want the home directory of %s", got, err, u.Username)
+		}
+		return
+	}
+
+	// Without a usable passwd entry every location has been tried.
+	if !errors.Is(err, keystore.ErrNoHomeDir) {
+		t.Fatalf("DefaultPath: got %s, %v, want ErrNoHomeDir", got, err)
+	}
+	for _, tried := range []string{"$HOME is not set", `$USERPROFILE="relative" is not an absolute path`, os.TempDir()} {
+		if !strings.Contains(err.Error(), tried) {
+			t.Errorf("error %q does not mention %s", err, tried)
+		}
+	}
+}
+
+func TestNewKeystoreUsesDefaultPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	ks, err := keystore.NewKeystore(keystore.Config{})
+	if err != nil {
+		t.Fatalf("NewKeystore: %v", err)
+	}
+	if want := filepath.Join(home, keystore.DefaultDirName); ks.Dir() != want {
+		t.Fatalf("Dir = %s, want %s", ks.Dir(), want)
+	}
+}
+
+func TestRequireExplicitPath(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	_, err := keystore.NewKeystore(keystore.Config{RequireExplicitPath: true})
+	var cerr *keystore.ConfigError
+	if !errors.As(err, &cerr) || cerr.Field != "DirPath" {
+		t.Fatalf("NewKeystore without DirPath: got %v, want a DirPath ConfigError", err)
+	}
+
+	dir := t.TempDir()
+	ks, err := keystore.NewKeystore(keystore.Config{DirPath: dir, RequireExplicitPath: true})
+	if err != nil {
+		t.Fatalf("NewKeystore with DirPath: %v", err)
+	}
+	if ks.Dir() != dir {
+		t.Fatalf("Dir = %s, want %s", ks.Dir(), dir)
+	}
+}
+
+// pathModeDirEnv tells TestPathModeHelperProcess which DirPath to open
+// with PathModeExecutable.
+const pathModeDirEnv = "KEYSTORE_TEST_PATHMODE_DIR"
+
+// chdir changes the working directory for the rest of the test.
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestPathModes(t *testing.T) {
+	home, wd, abs := t.TempDir(), t.TempDir(), t.TempDir()
+	t.Setenv("HOME", home)
+	chdir(t, wd)
+	// The working directory may be reached through a symlink, as with
+	// /tmp on macOS; os.Getwd reports the path that was given to Chdir.
+	if got, err := os.Getwd(); err == nil {
+		wd = got
+	}
+
+	tests := []struct {
+		mode    keystore.PathMode
+		dirPath string
+		want    string
+	}{
+		{keystore.PathModeHome, "", filepath.Join(home, keystore.DefaultDirName)},
+		{keystore.PathModeHome, "rel", "rel"},
+		{keystore.PathModeHome, abs, abs},
+		{keystore.PathModeWorkingDir, "", filepath.Join(wd, keystore.DefaultDirName)},
+		{keystore.PathModeWorkingDir, "rel", filepath.Join(wd, "rel")},
+		{keystore.PathModeWorkingDir, abs, abs},
+		{keystore.PathModeExecutable, abs, abs},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %q", tt.mode, tt.dirPath), func(t *testing.T) {
+			ks, err := keystore.NewKeystore(keystore.Config{DirPath: tt.dirPath, PathMode: tt.mode})
+			if err != nil {
+				t.Fatalf("NewKeystore: %v", err)
+			}
+			if ks.Dir() != tt.want {
+				t.Fatalf("Dir = %s, want %s", ks.Dir(), tt.want)
+			}
+			if err := ks.SaveToken("token"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(filepath.Join(tt.want, keystore.DefaultFileName)); err != nil {
+				t.Fatalf("keystore not written to %s: %v", tt.want, err)
+			}
+		})
+	}
+
+	_, err := keystore.NewKeystore(keystore.Config{PathMode: keystore.PathMode(42)})
+	var cerr *keystore.ConfigError
+	if !errors.As(err, &cerr) || cerr.Field != "PathMode" {
+		t.Fatalf("NewKeystore with an unknown PathMode: got %v, want a PathMode ConfigError", err)
+	}
+}
+
+// TestPathModeHelperProcess is run by the PathModeExecutable tests from a
+// copy of the test binary. It reports where the keystore ended up.
+func TestPathModeHelperProcess(t *testing.T) {
+	dirPath, ok := os.LookupEnv(pathModeDirEnv)
+	if !ok {
+		t.Skip("run by the PathModeExecutable tests")
+	}
+
+	ks, err := keystore.NewKeystore(keystore.Config{DirPath: dirPath, PathMode: keystore.PathModeExecutable})
+	switch {
+	case errors.Is(err, keystore.ErrStorageReadOnly):
+		fmt.Printf("pathmode read-only %v\n", err)
+	case err != nil:
+		t.Fatal(err)
+	default:
+		fmt.Printf("pathmode dir %s\n", ks.Dir())
+	}
+}
+
+// copyTestBinary copies the running test binary into dir and returns its
+// path, so the PathModeExecutable tests control where it lives.
+func copyTestBinary(t *testing.T, dir string) string {
+	t.Helper()
+
+	src, err := os.Open(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	path := filepath.Join(dir, filepath.Base(os.Args[0]))
+	dst, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		t.Fatal(err)
+	}
+	if err := dst.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// runPathModeHelper runs exe as TestPathModeHelperProcess with dirPath and
+// returns what it reported.
+func runPathModeHelper(t *testing.T, exe, dirPath string) string {
+	t.Helper()
+
+	cmd := exec.Command(exe, "-test.run=^TestPathModeHelperProcess$", "-test.v")
+	cmd.Env = append(os.Environ(), pathModeDirEnv+"="+dirPath)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("helper process: %v\n%s", err, out)
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if report, ok := strings.CutPrefix(line, "pathmode "); ok {
+			return strings.TrimSpace(report)
+		}
+	}
+	t.Fatalf("helper process reported nothing:\n%s", out)
+	return ""
+}
+
+func TestPathModeExecutable(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts child processes")
+	}
+	install, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	exe := copyTestBinary(t, install)
+
+	// Run through a symlink in another directory, as a binary linked into
+	// a bin directory is: the keystore stays with the real binary.
+	link := filepath.Join(t.TempDir(), "linked")
+	if err := os.Symlink(exe, link); err != nil {
+		t.Skipf("cannot create symlinks: %v", err)
+	}
+
+	for _, tt := range []struct{ dirPath, want string }{
+		{"", keystore.DefaultDirName},
+		{"data", "data"},
+	} {
+		for _, run := range []string{exe, link} {
+			want := "dir " + filepath.Join(install, tt.want)
+			if got := runPathModeHelper(t, run, tt.dirPath); got != want {
+				t.Errorf("running %s with DirPath %q: got %q, want %q", run, tt.dirPath, got, want)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(install, tt.want)); err != nil {
+			t.Errorf("no keystore directory next to the executable: %v", err)
+		}
+	}
+}
+
+func TestPathModeExecutableReadOnly(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts a child process")
+	}
+	install, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	exe := copyTestBinary(t, install)
+	if err := os.Chmod(install, 0o555); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(install, 0o755) })
+	if f, err := os.CreateTemp(install, "probe"); err == nil {
+		f.Close()
+		os.Remove(f.Name())
+		t.Skip("a read-only directory is still writable, as it is for root")
+	}
+
+	got := runPathModeHelper(t, exe, "")
+	if !strings.HasPrefix(got, "read-only ") || !strings.Contains(got, "PathModeExecutable") {
+		t.Fatalf("helper process reported %q, want ErrStorageReadOnly with guidance rather than another directory", got)
+	}
+}
@@ -0,0 +1,265 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultHTTPTimeout bounds each request made by an HTTPBackend
+	DefaultHTTPTimeout = 30 * time.Second
+
+	httpRetryMaxBackoff = 10 * time.Second
+)
+
+// HTTPBackendConfig configures an HTTPBackend.
+type HTTPBackendConfig struct {
+	// BaseURL is the root of the keystore service, e.g.
+	// https://keys.internal.example.com/v1.
+	BaseURL string
+
+	// NodeID identifies this machine's keystore on the service. Its
+	// resource is BaseURL/keystores/<NodeID>.
+	NodeID string
+
+	// BearerToken is sent in the Authorization header of every request.
+	BearerToken string
+
+	// TLSConfig customizes TLS, e.g. with a private CA or client
+	// certificates. Ignored when Client is set.
+	TLSConfig *tls.Config
+
+	// Client overrides the HTTP client. Defaults to one with
+	// DefaultHTTPTimeout and TLSConfig.
+	Client *http.Client
+
+	// RetryAttempts is the number of attempts for requests failing with
+	// network errors or 5xx responses. Zero uses DefaultRetryAttempts; a
+	// negative value disables retries.
+	RetryAttempts int
+
+	// RetryBackoff is the base delay between retries. Defaults to
+	// DefaultRetryBackoff.
+	RetryBackoff time.Duration
+}
+
+// HTTPBackend stores the keystore as a single resource on a remote service:
+// GET reads it, PUT writes it, HEAD checks for it and DELETE removes it.
+// Writes carry the ETag of the last read in If-Match, or If-None-Match: *
+// when nothing was read, so a concurrent update by another node fails with
+// ErrConflict instead of being overwritten.
+type HTTPBackend struct {
+	cfg      HTTPBackendConfig
+	client   *http.Client
+	resource string
+
+	mu   sync.Mutex
+	etag string
+}
+
+func NewHTTPBackend(cfg HTTPBackendConfig) (*HTTPBackend, error) {
+	base, err := url.Parse(cfg.BaseURL)
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return nil, configError("BaseURL", fmt.Sprintf("invalid keystore service URL %q", cfg.BaseURL))
+	}
+
+	if cfg.NodeID == "" {
+		return nil, configError("NodeID", "node id is required")
+	}
+
+	client := cfg.Client
+	if client == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = cfg.TLSConfig
+		client = &http.Client{Timeout: DefaultHTTPTimeout, Transport: transport}
+	}
+
+	return &HTTPBackend{
+		cfg:      cfg,
+		client:   client,
+		resource: strings.TrimRight(base.String(), "/") + "/keystores/" + url.PathEscape(cfg.NodeID),
+	}, nil
+}
+
+func (b *HTTPBackend) String() string {
+	return b.resource
+}
+
+func (b *HTTPBackend) Read() ([]byte, error) {
+	return b.readLimited(-1)
+}
+
+func (b *HTTPBackend) readLimited(max int64) ([]byte, error) {
+	resp, err := b.do(http.MethodGet, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+
+	body := io.Reader(resp.Body)
+	if max >= 0 {
+		body = io.LimitReader(resp.Body, max+1)
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	b.mu.Lock()
+	b.etag = resp.Header.Get("ETag")
+	b.mu.Unlock()
+
+	return data, nil
+}
+
+func (b *HTTPBackend) Write(data []byte) error {
+	b.mu.Lock()
+	etag := b.etag
+	b.mu.Unlock()
+
+	header := http.Header{"Content-Type": {"application/json"}}
+	if etag != "" {
+		header.Set("If-Match", etag)
+	} else {
+		header.Set("If-None-Match", "*")
+	}
+
+	resp, err := b.do(http.MethodPut, data, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp, http.StatusOK, http.StatusCreated, http.StatusNoContent); err != nil {
+		if errors.Is(err, ErrConflict) {
+			b.clearETag()
+		}
+		return err
+	}
+
+	b.mu.Lock()
+	b.etag = resp.Header.Get("ETag")
+	b.mu.Unlock()
+
+	return nil
+}
+
+// Exists reports whether the keystore resource exists on the service.
+func (b *HTTPBackend) Exists() (bool, error) {
+	resp, err := b.do(http.MethodHead, nil, nil)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+
+	if err := checkStatus(resp, http.StatusOK); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (b *HTTPBackend) Remove() error {
+	resp, err := b.do(http.MethodDelete, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	b.clearETag()
+	if err := checkStatus(resp, http.StatusOK, http.StatusNoContent); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (b *HTTPBackend) clearETag() {
+	b.mu.Lock()
+	b.etag = ""
+	b.mu.Unlock()
+}
+
+// do sends a request, retrying network errors and 5xx responses with
+// jittered exponential backoff.
+func (b *HTTPBackend) do(method string, body []byte, header http.Header) (*http.Response, error) {
+	attempts := b.cfg.RetryAttempts
+	switch {
+	case attempts < 0:
+		attempts = 1
+	case attempts == 0:
+		attempts = DefaultRetryAttempts
+	}
+
+	base := b.cfg.RetryBackoff
+	if base <= 0 {
+		base = DefaultRetryBackoff
+	}
+
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequest(method, b.resource, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		if b.cfg.BearerToken != "" {
+			req.Header.Set("Authorization", "Bearer "+b.cfg.BearerToken)
+		}
+
+		resp, err := b.client.Do(req)
+		if err == nil && resp.StatusCode < 500 {
+			return resp, nil
+		}
+
+		if attempt >= attempts {
+			if err != nil {
+				return nil, fmt.Errorf("keystore service request failed: %w", err)
+			}
+			return resp, nil
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		time.Sleep(backoff(base, httpRetryMaxBackoff, attempt))
+	}
+}
+
+// checkStatus maps unexpected responses to errors: 404 to fs.ErrNotExist,
+// 401 and 403 to ErrUnauthorized, and 409 and 412 to ErrConflict.
+func checkStatus(resp *http.Response, ok ...int) error {
+	for _, code := range ok {
+		if resp.StatusCode == code {
+			return nil
+		}
+	}
+
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return fmt.Errorf("keystore service: %w", fs.ErrNotExist)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("%w: %s", ErrUnauthorized, resp.Status)
+	case http.StatusConflict, http.StatusPreconditionFailed:
+		return fmt.Errorf("%w: %s", ErrConflict, resp.Status)
+	default:
+		return &ServiceError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+}
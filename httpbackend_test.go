@@ -0,0 +1,180 @@
+package keystore_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/theblitlabs/keystore"
+	"github.com/theblitlabs/keystore/keystoretest"
+)
+
+const testBearer = "s3cret"
+
+func newHTTPBackend(t *testing.T, srv *keystoretest.HTTPServer, node, token string) *keystore.HTTPBackend {
+	t.Helper()
+
+	b, err := keystore.NewHTTPBackend(keystore.HTTPBackendConfig{
+		BaseURL:       srv.URL + "/v1",
+		NodeID:        node,
+		BearerToken:   token,
+		RetryAttempts: 3,
+		RetryBackoff:  time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewHTTPBackend: %v", err)
+	}
+	return b
+}
+
+func TestHTTPBackendConformance(t *testing.T) {
+	srv := keystoretest.NewHTTPServer(testBearer)
+	t.Cleanup(srv.Close)
+
+	var nodes int
+	keystoretest.RunStoreConformanceTests(t, func() keystore.Backend {
+		nodes++
+		return newHTTPBackend(t, srv, fmt.Sprintf("node-%d", nodes), testBearer)
+	})
+}
+
+func TestHTTPBackendStatusMapping(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		status int
+		want   error
+	}{
+		{name: "wrong token", token: "wrong", want: keystore.ErrUnauthorized},
+		{name: "forbidden", token: testBearer, status: http.StatusForbidden, want: keystore.ErrUnauthorized},
+		{name: "conflict", token: testBearer, status: http.StatusConflict, want: keystore.ErrConflict},
+		{name: "precondition failed", token: testBearer, status: http.StatusPreconditionFailed, want: keystore.ErrConflict},
+		{name: "unexpected", token: testBearer, status: http.StatusTeapot, want: keystore.ErrServiceResponse},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := keystoretest.NewHTTPServer(testBearer)
+			defer srv.Close()
+
+			b := newHTTPBackend(t, srv, "node", tt.token)
+			if tt.status != 0 {
+				srv.FailNext(tt.status, 1)
+			}
+
+			err := b.Write([]byte(`{}`))
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Write: got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPBackendNotFound(t *testing.T) {
+	srv := keystoretest.NewHTTPServer(testBearer)
+	defer srv.Close()
+
+	b := newHTTPBackend(t, srv, "node", testBearer)
+	if ok, err := b.Exists(); err != nil || ok {
+		t.Fatalf("Exists: got %v, %v, want false, nil", ok, err)
+	}
+	if err := b.Remove(); err != nil {
+		t.Fatalf("Remove of a missing keystore: %v", err)
+	}
+
+	ks, err := keystore.NewKeystore(keystore.Config{Backend: b})
+	if err != nil {
+		t.Fatalf("NewKeystore: %v", err)
+	}
+	if _, err := ks.LoadToken(); !errors.Is(err, keystore.ErrNoKeystore) {
+		t.Fatalf("LoadToken: got %v, want ErrNoKeystore", err)
+	}
+}
+
+func TestHTTPBackendStaleETag(t *testing.T) {
+	srv := keystoretest.NewHTTPServer(testBearer)
+	defer srv.Close()
+
+	a := newHTTPBackend(t, srv, "node", testBearer)
+	b := newHTTPBackend(t, srv, "node", testBearer)
+
+	if err := a.Write([]byte(`{"v":1}`)); err != nil {
+		t.Fatalf("first write: %v", err)
+	}
+	if err := b.Write([]byte(`{"v":2}`)); !errors.Is(err, keystore.ErrConflict) {
+		t.Fatalf("create over an existing keystore: got %v, want ErrConflict", err)
+	}
+
+	if _, err := b.Read(); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if err := a.Write([]byte(`{"v":3}`)); err != nil {
+		t.Fatalf("second write: %v", err)
+	}
+	if err := b.Write([]byte(`{"v":4}`)); !errors.Is(err, keystore.ErrConflict) {
+		t.Fatalf("write with a stale ETag: got %v, want ErrConflict", err)
+	}
+
+	// The conflict drops the ETag; a fresh read makes the write succeed.
+	if _, err := b.Read(); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if err := b.Write([]byte(`{"v":5}`)); err != nil {
+		t.Fatalf("write after re-reading: %v", err)
+	}
+	if data, _ := srv.Document("node"); string(data) != `{"v":5}` {
+		t.Fatalf("stored document = %s", data)
+	}
+}
+
+func TestHTTPBackendRetries(t *testing.T) {
+	t.Run("recovers", func(t *testing.T) {
+		srv := keystoretest.NewHTTPServer(testBearer)
+		defer srv.Close()
+
+		b := newHTTPBackend(t, srv, "node", testBearer)
+		srv.FailNext(http.StatusServiceUnavailable, 2)
+		if err := b.Write([]byte(`{}`)); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		if n := srv.Requests(); n != 3 {
+			t.Fatalf("requests = %d, want 3", n)
+		}
+	})
+
+	t.Run("exhausted", func(t *testing.T) {
+		srv := keystoretest.NewHTTPServer(testBearer)
+		defer srv.Close()
+
+		b := newHTTPBackend(t, srv, "node", testBearer)
+		srv.FailNext(http.StatusBadGateway, 3)
+		err := b.Write([]byte(`{}`))
+
+		var serr *keystore.ServiceError
+		if !errors.As(err, &serr) || serr.StatusCode != http.StatusBadGateway {
+			t.Fatalf("Write: got %v, want a 502 ServiceError", err)
+		}
+		if n := srv.Requests(); n != 3 {
+			t.Fatalf("requests = %d, want 3", n)
+		}
+		if _, ok := srv.Document("node"); ok {
+			t.Fatal("failed write stored the keystore")
+		}
+	})
+
+	t.Run("client errors are not retried", func(t *testing.T) {
+		srv := keystoretest.NewHTTPServer(testBearer)
+		defer srv.Close()
+
+		b := newHTTPBackend(t, srv, "node", testBearer)
+		srv.FailNext(http.StatusConflict, 1)
+		if err := b.Write([]byte(`{}`)); !errors.Is(err, keystore.ErrConflict) {
+			t.Fatalf("Write: got %v, want ErrConflict", err)
+		}
+		if n := srv.Requests(); n != 1 {
+			t.Fatalf("requests = %d, want 1", n)
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package keystore
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// FileInfo describes the keystore file without revealing any of its contents.
+type FileInfo struct {
+	Path          string      `json:"path"`
+	Size          int64       `json:"size"`
+	Mode          os.FileMode `json:"mode"`
+	ModTime       time.Time   `json:"mod_time"`
+	SchemaVersion int         `json:"schema_version"`
+}
+
+// LastSavedAt returns when the keystore was last written, as recorded in the
+// file itself. The zero time means it was never saved by a version that
+// records it.
+func (s *Store) LastSavedAt() (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return time.Time{}, err
+	}
+
+	if s.SavedAt == 0 {
+		return time.Time{}, nil
+	}
+	return time.Unix(s.SavedAt, 0), nil
+}
+
+// Revision returns the revision of the persisted keystore. It increases by one
+// with every save, so callers can tell whether the keystore changed since
+// they last looked. A keystore that was never saved has revision 0.
+func (s *Store) Revision() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		if isNoKeystore(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return s.Rev, nil
+}
+
+// LastLoadedAt returns when this Store last read the keystore successfully.
+func (s *Store) LastLoadedAt() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.loadedAt
+}
+
+// FileInfo returns the location, size, permissions, modification time and
+// schema version of the keystore file. In split mode it describes the key file.
+func (s *Store) FileInfo() (FileInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.config.Backend != nil {
+		return FileInfo{}, fmt.Errorf("file info: %w", ErrNotFileBacked)
+	}
+
+	if err := s.load(); err != nil {
+		return FileInfo{}, err
+	}
+
+	path := s.path()
+	if b, ok := s.backend.(*SplitFileBackend); ok {
+		path = b.fileInfoPath()
+	}
+
+	st, err := os.Stat(path)
+	if err != nil {
+		return FileInfo{}, fmt.Errorf("failed to stat keystore: %w", err)
+	}
+
+	return FileInfo{
+		Path:          path,
+		Size:          st.Size(),
+		Mode:          st.Mode().Perm(),
+		ModTime:       st.ModTime(),
+		SchemaVersion: s.fileVersion,
+	}, nil
+}
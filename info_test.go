@@ -0,0 +1,75 @@
+package keystore_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/theblitlabs/keystore"
+)
+
+func TestLastSavedAndLoadedAt(t *testing.T) {
+	dir := t.TempDir()
+	clock := newTestClock(epoch)
+	cfg := clock.config(keystore.Config{DirPath: dir, Logger: discardLogger})
+	ks := newErrorStore(t, cfg)
+
+	if at := ks.LastLoadedAt(); !at.IsZero() {
+		t.Fatalf("LastLoadedAt before any load = %v", at)
+	}
+	if _, err := ks.LastSavedAt(); !errors.Is(err, keystore.ErrNoKeystore) {
+		t.Fatalf("LastSavedAt without a keystore: got %v, want ErrNoKeystore", err)
+	}
+
+	// A save records its time in the file.
+	saved := epoch.Add(time.Minute)
+	clock.Set(saved)
+	if err := ks.SaveToken("token"); err != nil {
+		t.Fatal(err)
+	}
+	if at, err := ks.LastSavedAt(); err != nil || !at.Equal(saved) {
+		t.Fatalf("LastSavedAt = %v, %v, want %v", at, err, saved)
+	}
+
+	// A load advances LastLoadedAt and leaves LastSavedAt alone.
+	loaded := saved.Add(time.Hour)
+	clock.Set(loaded)
+	if _, err := ks.LoadToken(); err != nil {
+		t.Fatal(err)
+	}
+	if at := ks.LastLoadedAt(); !at.Equal(loaded) {
+		t.Fatalf("LastLoadedAt = %v, want %v", at, loaded)
+	}
+	if at, err := ks.LastSavedAt(); err != nil || !at.Equal(saved) {
+		t.Fatalf("LastSavedAt after a load = %v, %v, want %v", at, err, saved)
+	}
+
+	// A save by another Store is seen, and reading it is a load.
+	resaved := loaded.Add(time.Hour)
+	clock.Set(resaved)
+	if err := newErrorStore(t, cfg).SaveToken("other"); err != nil {
+		t.Fatal(err)
+	}
+	reloaded := resaved.Add(time.Minute)
+	clock.Set(reloaded)
+	if at, err := ks.LastSavedAt(); err != nil || !at.Equal(resaved) {
+		t.Fatalf("LastSavedAt after another Store saved = %v, %v, want %v", at, err, resaved)
+	}
+	if at := ks.LastLoadedAt(); !at.Equal(reloaded) {
+		t.Fatalf("LastLoadedAt after another Store saved = %v, want %v", at, reloaded)
+	}
+
+	// A failed load does not count.
+	if err := os.WriteFile(filepath.Join(dir, keystore.DefaultFileName), []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	clock.Set(reloaded.Add(time.Hour))
+	if _, err := ks.LoadToken(); err == nil {
+		t.Fatal("LoadToken of a corrupt keystore succeeded")
+	}
+	if at := ks.LastLoadedAt(); !at.Equal(reloaded) {
+		t.Fatalf("LastLoadedAt after a failed load = %v, want %v", at, reloaded)
+	}
+}
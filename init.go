@@ -0,0 +1,174 @@
+package keystore
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// exclusiveBackend is implemented by backends that can create the keystore
+// only if it does not exist yet, failing with fs.ErrExist otherwise.
+type exclusiveBackend interface {
+	createExclusive(data []byte) error
+}
+
+// createExclusive writes data to a new keystore file with O_EXCL.
+func (b *FileBackend) createExclusive(data []byte) error {
+	f, err := os.OpenFile(b.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, DefaultFileMode)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(b.path)
+		return err
+	}
+
+	syncDir(filepath.Dir(b.path))
+	return nil
+}
+
+// InitOnce initializes the keystore with initFn unless it already exists,
+// then loads it. initFn receives a staging store with the same
+// configuration and should set it up through its methods, for example by
+// generating a key; it must not use the store InitOnce was called on.
+//
+// Only one of several processes starting at once initializes: the
+// directory is created, the cross-process lock is held throughout and the
+// file is created exclusively, so a process that loses the race discards
+// its staging state and loads the winner's keystore instead. initFn is not
+// called when the keystore exists, and nothing is written if it fails.
+func (s *Store) InitOnce(initFn func(*Store) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.writeStaged(func(staging *Store, exists bool) (bool, error) {
+		if exists {
+			return false, nil
+		}
+		return true, initFn(staging)
+	})
+	if errors.Is(err, fs.ErrExist) {
+		s.config.Logger.Warn("keystore: keystore was created concurrently, using it", "location", s.location())
+		s.cache = nil
+		return s.load()
+	}
+	return err
+}
+
+// writeStaged is the create-or-replace path of InitOnce and ProvisionOnce.
+// Holding the cross-process lock, it loads the keystore and calls stage
+// with an empty staging store and whether the keystore exists. If stage
+// returns true and saved something, the staging keystore is written in
+// place of the persisted one, with the backups, mirror and revision
+// bookkeeping of save, and loaded. A keystore that did not exist is created
+// exclusively; if another process created it first, writeStaged fails with
+// an error matching fs.ErrExist and writes nothing. Nothing is written if
+// stage fails. s.mu must be held.
+func (s *Store) writeStaged(stage func(staging *Store, exists bool) (bool, error)) error {
+	if err := s.checkReadOnly(); err != nil {
+		return err
+	}
+
+	if b, ok := s.backend.(*FileBackend); ok {
+		if err := os.MkdirAll(filepath.Dir(b.path), DefaultDirMode); err != nil {
+			return fmt.Errorf("failed to create keystore directory: %w", err)
+		}
+	}
+
+	if b, ok := s.backend.(lockingBackend); ok {
+		release, err := b.acquireLock(scopeStore, s.lockTimeout())
+		if err != nil {
+			if roErr := s.noteReadOnly(err); roErr != nil {
+				return roErr
+			}
+			return err
+		}
+		defer release()
+	}
+
+	exists := true
+	if err := s.load(); err != nil {
+		if !isNoKeystore(err) {
+			return err
+		}
+		exists = false
+	}
+
+	staging := s.stagingStore()
+	defer staging.reset()
+	write, err := stage(staging, exists)
+	if err != nil || !write {
+		return err
+	}
+
+	data, err := staging.backend.Read()
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			// The staging store saved nothing, so there is nothing to write.
+			return nil
+		}
+		return err
+	}
+	defer wipe(data)
+
+	if b, ok := s.backend.(exclusiveBackend); ok && !exists {
+		err = b.createExclusive(data)
+		if err == nil {
+			s.bumpGeneration()
+		}
+		if errors.Is(err, fs.ErrExist) {
+			return fmt.Errorf("keystore was created concurrently at %s: %w", s.location(), err)
+		}
+	} else {
+		if s.backupsEnabled() {
+			if err := s.backupCurrent(); err != nil {
+				return err
+			}
+		}
+		err = s.writeBackend(data)
+	}
+	if err != nil {
+		if roErr := s.noteReadOnly(err); roErr != nil {
+			return roErr
+		}
+		return fmt.Errorf("failed to write keystore file: %w", err)
+	}
+	s.writeMirror(data)
+	if s.backupsEnabled() {
+		s.pruneBackups()
+	}
+
+	s.cache = nil
+	if err := s.load(); err != nil {
+		return err
+	}
+	s.writtenRev = s.Rev
+	s.noteFileSize(int64(len(data)), true)
+	return nil
+}
+
+// stagingStore returns an empty store with s's configuration that saves to
+// memory. Mirroring and backups are left to the write of the real
+// keystore, so a staging save touches nothing on disk.
+func (s *Store) stagingStore() *Store {
+	cfg := s.config
+	cfg.Backend = NewMemoryBackend()
+	cfg.PrunePolicy = nil
+	cfg.MirrorPath = ""
+	cfg.BackupRetain = 0
+	cfg.BackupMaxAge = 0
+
+	staging := &Store{config: cfg, creds: s.creds, backend: cfg.Backend, stats: &storeStats{}}
+	staging.initShared(&unlockGate{})
+	return staging
+}
@@ -0,0 +1,222 @@
+package keystore_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/theblitlabs/keystore"
+)
+
+// initOnceDirEnv tells TestInitOnceHelperProcess where to initialize.
+const initOnceDirEnv = "KEYSTORE_TEST_INIT_DIR"
+
+func TestInitOnceConcurrent(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "not", "created", "yet")
+
+	const racers = 8
+	var (
+		calls     atomic.Int32
+		generated common.Address
+		wg        sync.WaitGroup
+		start     = make(chan struct{})
+		stores    = make([]*keystore.Store, racers)
+		errs      = make([]error, racers)
+	)
+	for i := range stores {
+		ks, err := keystore.NewKeystore(keystore.Config{DirPath: dir, Logger: discardLogger})
+		if err != nil {
+			t.Fatal(err)
+		}
+		stores[i] = ks
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			errs[i] = stores[i].InitOnce(func(staging *keystore.Store) error {
+				calls.Add(1)
+				addr, err := staging.GeneratePrivateKey()
+				generated = addr
+				return err
+			})
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("racer %d: %v", i, err)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("initFn ran %d times, want once", n)
+	}
+	for i, ks := range stores {
+		addr, err := ks.GetAddress()
+		if err != nil || addr != generated {
+			t.Fatalf("racer %d uses %s, %v, want %s", i, addr.Hex(), err, generated.Hex())
+		}
+	}
+}
+
+// TestInitOnceHelperProcess is run by TestInitOnceProcesses in child
+// processes. It reports whether it initialized the keystore and the
+// address it ended up with.
+func TestInitOnceHelperProcess(t *testing.T) {
+	dir := os.Getenv(initOnceDirEnv)
+	if dir == "" {
+		t.Skip("run by TestInitOnceProcesses")
+	}
+
+	ks, err := keystore.NewKeystore(keystore.Config{DirPath: dir, Logger: discardLogger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	initialized := false
+	err = ks.InitOnce(func(staging *keystore.Store) error {
+		initialized = true
+		_, err := staging.GeneratePrivateKey()
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, err := ks.GetAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Printf("initonce %v %s\n", initialized, addr.Hex())
+}
+
+func TestInitOnceProcesses(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts child processes")
+	}
+	dir := filepath.Join(t.TempDir(), "shared")
+
+	const racers = 4
+	cmds := make([]*exec.Cmd, racers)
+	outs := make([]strings.Builder, racers)
+	for i := range cmds {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestInitOnceHelperProcess$", "-test.v")
+		cmd.Env = append(os.Environ(), initOnceDirEnv+"="+dir)
+		cmd.Stdout, cmd.Stderr = &outs[i], &outs[i]
+		cmds[i] = cmd
+	}
+	for _, cmd := range cmds {
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	initialized := 0
+	addresses := map[string]bool{}
+	for i, cmd := range cmds {
+		if err := cmd.Wait(); err != nil {
+			t.Fatalf("process %d: %v\n%s", i, err, outs[i].String())
+		}
+		var didInit bool
+		var addr string
+		for _, line := range strings.Split(outs[i].String(), "\n") {
+			if _, err := fmt.Sscanf(line, "initonce %t %s", &didInit, &addr); err == nil {
+				break
+			}
+		}
+		if addr == "" {
+			t.Fatalf("process %d reported nothing:\n%s", i, outs[i].String())
+		}
+		if didInit {
+			initialized++
+		}
+		addresses[addr] = true
+	}
+
+	if initialized != 1 {
+		t.Errorf("%d processes initialized the keystore, want 1", initialized)
+	}
+	if len(addresses) != 1 {
+		t.Errorf("processes use %d different keys: %v", len(addresses), addresses)
+	}
+
+	ks, err := keystore.NewKeystore(keystore.Config{DirPath: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, err := ks.GetAddress()
+	if err != nil || !addresses[addr.Hex()] {
+		t.Fatalf("keystore holds %s, %v, processes use %v", addr.Hex(), err, addresses)
+	}
+}
+
+func TestInitOnceExisting(t *testing.T) {
+	dir := t.TempDir()
+	ks, err := keystore.NewKeystore(keystore.Config{DirPath: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := keystore.NewKeystore(keystore.Config{DirPath: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = other.InitOnce(func(*keystore.Store) error {
+		t.Fatal("initFn called for an existing keystore")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, err := other.LoadPrivateKey(); err != nil || hexKey(key) != fileKeyHex {
+		t.Fatalf("LoadPrivateKey: %v", err)
+	}
+}
+
+func TestInitOnceFailureWritesNothing(t *testing.T) {
+	dir := t.TempDir()
+	ks, err := keystore.NewKeystore(keystore.Config{DirPath: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	boom := errors.New("boom")
+	err = ks.InitOnce(func(staging *keystore.Store) error {
+		if err := staging.SavePrivateKey(fileKeyHex); err != nil {
+			return err
+		}
+		return boom
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("InitOnce: got %v, want the initFn error", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, keystore.DefaultFileName)); !os.IsNotExist(err) {
+		t.Fatalf("failed initFn left a keystore: %v", err)
+	}
+
+	// Saving nothing creates nothing either.
+	if err := ks.InitOnce(func(*keystore.Store) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, keystore.DefaultFileName)); !os.IsNotExist(err) {
+		t.Fatalf("empty initFn left a keystore: %v", err)
+	}
+
+	// The keystore can be initialized after a failure.
+	if err := ks.InitOnce(func(staging *keystore.Store) error { return staging.SavePrivateKey(credentialKeyHex) }); err != nil {
+		t.Fatal(err)
+	}
+	if key, err := ks.LoadPrivateKey(); err != nil || hexKey(key) != credentialKeyHex {
+		t.Fatalf("LoadPrivateKey: %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+package keystore
+
+import (
+	"crypto/ecdsa"
+	"os"
+)
+
+// backendStamp identifies a version of the persisted keystore. Two equal
+// stamps mean the backend has not been written in between.
+type backendStamp struct {
+	info os.FileInfo
+	gen  uint64
+}
+
+// equal compares stamps. Since file backends replace the file on every
+// write, a changed file is detected even when the write happened within the
+// filesystem's timestamp granularity.
+func (a backendStamp) equal(b backendStamp) bool {
+	if a.info == nil || b.info == nil {
+		return a.info == b.info && a.gen == b.gen
+	}
+	return a.gen == b.gen && os.SameFile(a.info, b.info) &&
+		a.info.ModTime().Equal(b.info.ModTime()) &&
+		a.info.Size() == b.info.Size()
+}
+
+// stamper is implemented by backends that can cheaply report whether their
+// contents changed. Keys are only cached for such backends.
+type stamper interface {
+	stamp() (backendStamp, error)
+}
+
+// stamp covers the generation file too, so a write by another process is
+// noticed even where file metadata is unreliable.
+func (b *FileBackend) stamp() (backendStamp, error) {
+	stamp, err := b.fileStamp()
+	if err != nil {
+		return backendStamp{}, err
+	}
+	if stamp.gen, err = readGeneration(b.generationPath()); err != nil {
+		return backendStamp{}, err
+	}
+	return stamp, nil
+}
+
+func (b *FileBackend) fileStamp() (backendStamp, error) {
+	info, err := os.Stat(b.path)
+	if err != nil {
+		return backendStamp{}, err
+	}
+	return backendStamp{info: info}, nil
+}
+
+func (b *MemoryBackend) stamp() (backendStamp, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return backendStamp{gen: b.gen}, nil
+}
+
+// keyCache holds the parsed primary key along with the backend stamp it was
+// read at.
+type keyCache struct {
+	key   *ecdsa.PrivateKey
+	hex   string
+	stamp backendStamp
+}
+
+// currentStamp returns the backend's stamp, or false when it cannot be
+// determined and caching should be skipped.
+func (s *Store) currentStamp() (backendStamp, bool) {
+	b, ok := s.backend.(stamper)
+	if !ok {
+		return backendStamp{}, false
+	}
+
+	stamp, err := b.stamp()
+	if err != nil {
+		return backendStamp{}, false
+	}
+	return stamp, true
+}
+
+// cachedKey returns the cached primary key if the backend is unchanged
+// since it was parsed.
+func (s *Store) cachedKey() (*ecdsa.PrivateKey, string, bool) {
+	if s.cache == nil {
+		return nil, "", false
+	}
+
+	stamp, ok := s.currentStamp()
+	if !ok || !stamp.equal(s.cache.stamp) {
+		s.cache = nil
+		return nil, "", false
+	}
+
+	return s.cache.key, s.cache.hex, true
+}
+
+// InvalidateCache drops the cached primary key so the next read goes to the
+// backend. The cache is already invalidated when the file is replaced or its
+// modification time or size changes; call this when it may have been edited
+// in place in a way that preserves both.
+func (s *Store) InvalidateCache() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cache = nil
+}
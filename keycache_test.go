@@ -0,0 +1,165 @@
+package keystore_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/theblitlabs/keystore"
+	"github.com/theblitlabs/keystore/faultinject"
+)
+
+// loadKeyReads loads the primary key from ks, fails unless it is keyHex,
+// and returns how many backend reads that took.
+func loadKeyReads(t *testing.T, ks *keystore.Store, inj *faultinject.Injector, keyHex string) int {
+	t.Helper()
+
+	before := inj.Calls(keystore.FaultOpRead)
+	key, err := ks.LoadPrivateKey()
+	if err != nil {
+		t.Fatalf("LoadPrivateKey: %v", err)
+	}
+	if !key.Equal(mustKey(t, keyHex)) {
+		t.Fatal("LoadPrivateKey returned another key")
+	}
+	return inj.Calls(keystore.FaultOpRead) - before
+}
+
+func TestKeyCache(t *testing.T) {
+	for name, cfg := range map[string]keystore.Config{
+		"file":   {DirPath: t.TempDir()},
+		"split":  {DirPath: t.TempDir(), SplitFiles: true},
+		"memory": {Backend: keystore.NewMemoryBackend()},
+	} {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			inj := faultinject.New()
+			readerCfg := cfg
+			readerCfg.FaultInjector = inj
+			ks := newErrorStore(t, readerCfg)
+			writer := newErrorStore(t, cfg)
+			if err := writer.SavePrivateKey(fileKeyHex); err != nil {
+				t.Fatal(err)
+			}
+
+			if loadKeyReads(t, ks, inj, fileKeyHex) == 0 {
+				t.Fatal("the first load did not read the backend")
+			}
+			if n := loadKeyReads(t, ks, inj, fileKeyHex); n != 0 {
+				t.Fatalf("a cached load read the backend %d times", n)
+			}
+
+			// A write by another Store drops the cache.
+			if err := writer.SavePrivateKey(credentialKeyHex); err != nil {
+				t.Fatal(err)
+			}
+			if loadKeyReads(t, ks, inj, credentialKeyHex) == 0 {
+				t.Fatal("the load after another Store's write did not read the backend")
+			}
+			if n := loadKeyReads(t, ks, inj, credentialKeyHex); n != 0 {
+				t.Fatalf("a cached load read the backend %d times", n)
+			}
+
+			// So does a token save, except with split files, where it leaves
+			// the key file alone.
+			if err := writer.SaveToken("token"); err != nil {
+				t.Fatal(err)
+			}
+			if n := loadKeyReads(t, ks, inj, credentialKeyHex); (n == 0) != cfg.SplitFiles {
+				t.Fatalf("the load after a token save read the backend %d times", n)
+			}
+
+			// InvalidateCache forces the next load to read.
+			ks.InvalidateCache()
+			if loadKeyReads(t, ks, inj, credentialKeyHex) == 0 {
+				t.Fatal("the load after InvalidateCache did not read the backend")
+			}
+		})
+	}
+}
+
+func TestInvalidateCacheInPlaceEdit(t *testing.T) {
+	dir := t.TempDir()
+	inj := faultinject.New()
+	ks := newErrorStore(t, keystore.Config{DirPath: dir, FaultInjector: inj})
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	loadKeyReads(t, ks, inj, fileKeyHex)
+
+	// Rewrite the file in place with another key of the same size, and
+	// put its modification time back, as some sync tools do.
+	path := filepath.Join(dir, keystore.DefaultFileName)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from, to := mustKey(t, fileKeyHex), mustKey(t, credentialKeyHex)
+	for _, r := range [][2]string{
+		{fileKeyHex, credentialKeyHex},
+		{crypto.PubkeyToAddress(from.PublicKey).Hex(), crypto.PubkeyToAddress(to.PublicKey).Hex()},
+		{hex.EncodeToString(crypto.FromECDSAPub(&from.PublicKey)), hex.EncodeToString(crypto.FromECDSAPub(&to.PublicKey))},
+	} {
+		if !bytes.Contains(data, []byte(r[0])) {
+			t.Fatalf("keystore file lacks %s", r[0])
+		}
+		data = bytes.ReplaceAll(data, []byte(r[0]), []byte(r[1]))
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt(data, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The edit goes unnoticed until the cache is invalidated.
+	if n := loadKeyReads(t, ks, inj, fileKeyHex); n != 0 {
+		t.Fatalf("a cached load read the backend %d times", n)
+	}
+	ks.InvalidateCache()
+	loadKeyReads(t, ks, inj, credentialKeyHex)
+}
+
+func BenchmarkLoadPrivateKey(b *testing.B) {
+	for _, bm := range []struct {
+		name       string
+		invalidate bool
+	}{
+		{"cached", false},
+		{"invalidated", true},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			ks, err := keystore.NewKeystore(keystore.Config{DirPath: b.TempDir()})
+			if err != nil {
+				b.Fatal(err)
+			}
+			if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+				b.Fatal(err)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if bm.invalidate {
+					ks.InvalidateCache()
+				}
+				if _, err := ks.LoadPrivateKey(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
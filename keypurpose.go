@@ -0,0 +1,277 @@
+package keystore
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// KeyPurpose restricts what a stored key may be used for.
+type KeyPurpose string
+
+// Key purposes. Keys saved without one, including all keys written before
+// purposes existed, are KeyPurposeAny.
+const (
+	KeyPurposeAny        KeyPurpose = "any"
+	KeyPurposeSigning    KeyPurpose = "signing"
+	KeyPurposeEncryption KeyPurpose = "encryption"
+)
+
+// EncryptionAccountName is the account GenerateKeyPairSet stores the
+// encryption key under.
+const EncryptionAccountName = "encryption"
+
+// KeyPairSet describes the keys created by GenerateKeyPairSet.
+type KeyPairSet struct {
+	SigningAddress    common.Address
+	EncryptionAddress common.Address
+
+	// EncryptionPublicKey is what peers pass to EncryptFor.
+	EncryptionPublicKey *ecdsa.PublicKey
+}
+
+func (p KeyPurpose) valid() bool {
+	switch p {
+	case KeyPurposeAny, KeyPurposeSigning, KeyPurposeEncryption:
+		return true
+	}
+	return false
+}
+
+// orAny returns the purpose, with the empty purpose of legacy keys read as
+// KeyPurposeAny.
+func (p KeyPurpose) orAny() KeyPurpose {
+	if p == "" {
+		return KeyPurposeAny
+	}
+	return p
+}
+
+// allows fails with ErrWrongKeyPurpose unless a key with purpose p may be
+// used for use. what names the key in the error.
+func (p KeyPurpose) allows(use KeyPurpose, what string) error {
+	switch p.orAny() {
+	case KeyPurposeAny, use:
+		return nil
+	case KeyPurposeSigning, KeyPurposeEncryption:
+		return fmt.Errorf("%w: %s is for %s only", ErrWrongKeyPurpose, what, p)
+	default:
+		return fmt.Errorf("%w: %s has unknown purpose %q", ErrWrongKeyPurpose, what, p)
+	}
+}
+
+func checkPurpose(p KeyPurpose) error {
+	if !p.valid() {
+		return fmt.Errorf("%w: unknown purpose %q", ErrWrongKeyPurpose, p)
+	}
+	return nil
+}
+
+// GeneratePrivateKeyWithPurpose generates the primary key as
+// GeneratePrivateKey does, restricted to purpose.
+func (s *Store) GeneratePrivateKeyWithPurpose(purpose KeyPurpose) (common.Address, error) {
+	if err := checkPurpose(purpose); err != nil {
+		return common.Address{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, privateKeyHex, err := generateKeyHex()
+	if err != nil {
+		return common.Address{}, err
+	}
+	if _, err := s.checkPrivateKey(privateKeyHex); err != nil {
+		return common.Address{}, err
+	}
+
+	err = s.updateScope(scopeKey, func() error {
+		if err := s.setPrimaryKey(privateKeyHex, key, s.newProvenance(ProvenanceGenerated, "")); err != nil {
+			return err
+		}
+		s.KeyPurpose = purpose
+		return nil
+	})
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(key.PublicKey), nil
+}
+
+// SavePrivateKeyWithPurpose stores privateKeyHex as the primary key as
+// SavePrivateKey does, restricted to purpose.
+func (s *Store) SavePrivateKeyWithPurpose(privateKeyHex string, purpose KeyPurpose) error {
+	if err := checkPurpose(purpose); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, err := s.checkPrivateKey(privateKeyHex)
+	if err != nil {
+		return err
+	}
+
+	return s.updateScope(scopeKey, func() error {
+		if err := s.setPrimaryKey(privateKeyHex, key, s.newProvenance(ProvenanceHex, "")); err != nil {
+			return err
+		}
+		s.KeyPurpose = purpose
+		return nil
+	})
+}
+
+// SaveAccountWithPurpose stores privateKeyHex under name as SaveAccount
+// does, restricted to purpose.
+func (s *Store) SaveAccountWithPurpose(name, privateKeyHex string, purpose KeyPurpose) error {
+	if err := checkPurpose(purpose); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := validateAccountName(name); err != nil {
+		return err
+	}
+
+	key, err := parsePrivateKeyHex(privateKeyHex)
+	if err != nil {
+		return err
+	}
+
+	return s.updateScope(scopeKey, func() error {
+		if err := s.putAccount(name, key, privateKeyHex, s.newProvenance(ProvenanceHex, "")); err != nil {
+			return err
+		}
+		s.Accounts[name].Purpose = purpose
+		return nil
+	})
+}
+
+// GenerateKeyPairSet generates a signing-only primary key and an
+// encryption-only key, stored as the EncryptionAccountName account, in a
+// single write. Decrypt and SharedSecret then use the encryption key, and
+// the signing methods the primary key. The primary key is replaced as by
+// GeneratePrivateKey; the call fails with ErrAccountExists if the
+// encryption account already exists.
+func (s *Store) GenerateKeyPairSet() (KeyPairSet, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	signing, signingHex, err := generateKeyHex()
+	if err != nil {
+		return KeyPairSet{}, err
+	}
+	encryption, encryptionHex, err := generateKeyHex()
+	if err != nil {
+		return KeyPairSet{}, err
+	}
+	if _, err := s.checkPrivateKey(signingHex); err != nil {
+		return KeyPairSet{}, err
+	}
+
+	err = s.updateScope(scopeKey, func() error {
+		if err := s.putAccount(EncryptionAccountName, encryption, encryptionHex, s.newProvenance(ProvenanceGenerated, "")); err != nil {
+			return err
+		}
+		s.Accounts[EncryptionAccountName].Purpose = KeyPurposeEncryption
+		s.EncryptionAccount = EncryptionAccountName
+
+		if err := s.setPrimaryKey(signingHex, signing, s.newProvenance(ProvenanceGenerated, "")); err != nil {
+			return err
+		}
+		s.KeyPurpose = KeyPurposeSigning
+		return nil
+	})
+	if err != nil {
+		return KeyPairSet{}, err
+	}
+
+	return KeyPairSet{
+		SigningAddress:      crypto.PubkeyToAddress(signing.PublicKey),
+		EncryptionAddress:   crypto.PubkeyToAddress(encryption.PublicKey),
+		EncryptionPublicKey: &encryption.PublicKey,
+	}, nil
+}
+
+// EncryptionPublicKey returns the public key peers encrypt to for Decrypt
+// and derive shared secrets with: that of the encryption account set by
+// GenerateKeyPairSet, or else of the primary key.
+func (s *Store) EncryptionPublicKey() (*ecdsa.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil && !isNoKeystore(err) {
+		return nil, err
+	}
+	if s.EncryptionAccount == "" {
+		key, _, err := s.readPrimaryKey()
+		if err != nil {
+			return nil, err
+		}
+		return &key.PublicKey, nil
+	}
+
+	key, err := s.readAccountKey(s.EncryptionAccount)
+	if err != nil {
+		return nil, err
+	}
+	return &key.PublicKey, nil
+}
+
+// encryptionKey returns the key for Decrypt and SharedSecret, failing
+// with ErrWrongKeyPurpose if it is for signing only.
+func (s *Store) encryptionKey() (*ecdsa.PrivateKey, error) {
+	if err := s.load(); err != nil && !isNoKeystore(err) {
+		return nil, err
+	}
+
+	if name := s.EncryptionAccount; name != "" {
+		key, err := s.accountKey(name)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.Accounts[name].Purpose.allows(KeyPurposeEncryption, fmt.Sprintf("account %q", name)); err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+
+	key, _, err := s.primaryKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.KeyPurpose.allows(KeyPurposeEncryption, "primary key"); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// checkSigningKey fails with ErrWrongKeyPurpose if the named account, or
+// the primary key for an empty name, is for encryption only. The keystore
+// must be loaded.
+func (s *Store) checkSigningKey(name string) error {
+	if err := s.checkLease(); err != nil {
+		return err
+	}
+	if name == "" {
+		return s.KeyPurpose.allows(KeyPurposeSigning, "primary key")
+	}
+	if account, ok := s.Accounts[name]; ok {
+		return account.Purpose.allows(KeyPurposeSigning, fmt.Sprintf("account %q", name))
+	}
+	return nil
+}
+
+func generateKeyHex() (*ecdsa.PrivateKey, string, error) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate key: %w", err)
+	}
+	return key, hex.EncodeToString(crypto.FromECDSA(key)), nil
+}
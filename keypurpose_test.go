@@ -0,0 +1,279 @@
+package keystore_test
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/theblitlabs/keystore"
+	"github.com/theblitlabs/keystore/faultinject"
+)
+
+// signingOps sign with the primary key.
+var signingOps = []struct {
+	name string
+	run  func(ks *keystore.Store) error
+}{
+	{"SignDigest", func(ks *keystore.Store) error {
+		_, err := ks.SignDigest(crypto.Keccak256([]byte("purpose")))
+		return err
+	}},
+	{"SignMessage", func(ks *keystore.Store) error {
+		_, err := ks.SignMessage([]byte("purpose"))
+		return err
+	}},
+	{"SignTransaction", func(ks *keystore.Store) error {
+		tx := types.NewTransaction(0, common.Address{}, big.NewInt(0), 21000, big.NewInt(1), nil)
+		_, err := ks.SignTransaction(tx, big.NewInt(1))
+		return err
+	}},
+}
+
+// encryptionOps use the encryption key, encrypting to it first.
+var encryptionOps = []struct {
+	name string
+	run  func(ks *keystore.Store) error
+}{
+	{"Decrypt", func(ks *keystore.Store) error {
+		pub, err := ks.EncryptionPublicKey()
+		if err != nil {
+			return err
+		}
+		ciphertext, err := keystore.EncryptFor(pub, []byte("secret"))
+		if err != nil {
+			return err
+		}
+		plaintext, err := ks.Decrypt(ciphertext)
+		if err == nil && string(plaintext) != "secret" {
+			return errors.New("Decrypt returned the wrong plaintext")
+		}
+		return err
+	}},
+	{"SharedSecret", func(ks *keystore.Store) error {
+		peer, err := crypto.GenerateKey()
+		if err != nil {
+			return err
+		}
+		_, err = ks.SharedSecret(&peer.PublicKey)
+		return err
+	}},
+}
+
+// verifyIssues returns the issues of Verify with the given problem, by key.
+func verifyIssues(t *testing.T, ks *keystore.Store, problem string) map[string]keystore.VerifyIssue {
+	t.Helper()
+
+	report, err := ks.Verify()
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	issues := map[string]keystore.VerifyIssue{}
+	for _, issue := range report.Issues {
+		if issue.Problem == problem {
+			issues[issue.Key] = issue
+		}
+	}
+	return issues
+}
+
+func TestKeyPurposes(t *testing.T) {
+	tests := []struct {
+		purpose       keystore.KeyPurpose
+		canSign       bool
+		canEncrypt    bool
+		dualUseWarned bool
+	}{
+		{keystore.KeyPurposeAny, true, true, true},
+		{keystore.KeyPurposeSigning, true, false, false},
+		{keystore.KeyPurposeEncryption, false, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.purpose), func(t *testing.T) {
+			ks := newErrorStore(t, keystore.Config{})
+			if err := ks.SavePrivateKeyWithPurpose(fileKeyHex, tt.purpose); err != nil {
+				t.Fatal(err)
+			}
+			for _, op := range signingOps {
+				if err := op.run(ks); (err == nil) != tt.canSign || (err != nil && !errors.Is(err, keystore.ErrWrongKeyPurpose)) {
+					t.Errorf("%s: got %v, want allowed %v or ErrWrongKeyPurpose", op.name, err, tt.canSign)
+				}
+			}
+			for _, op := range encryptionOps {
+				if err := op.run(ks); (err == nil) != tt.canEncrypt || (err != nil && !errors.Is(err, keystore.ErrWrongKeyPurpose)) {
+					t.Errorf("%s: got %v, want allowed %v or ErrWrongKeyPurpose", op.name, err, tt.canEncrypt)
+				}
+			}
+			if _, warned := verifyIssues(t, ks, keystore.VerifyDualUseKey)["primary"]; warned != tt.dualUseWarned {
+				t.Errorf("Verify dual-use warning = %v, want %v", warned, tt.dualUseWarned)
+			}
+		})
+	}
+
+	ks := newErrorStore(t, keystore.Config{})
+	if err := ks.SavePrivateKeyWithPurpose(fileKeyHex, "decoration"); !errors.Is(err, keystore.ErrWrongKeyPurpose) {
+		t.Fatalf("SavePrivateKeyWithPurpose with an unknown purpose: got %v, want ErrWrongKeyPurpose", err)
+	}
+}
+
+func TestKeyPurposeAccounts(t *testing.T) {
+	ks := newErrorStore(t, keystore.Config{})
+	if err := ks.SaveAccountWithPurpose("decrypt-only", credentialKeyHex, keystore.KeyPurposeEncryption); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveAccountWithPurpose("sign-only", envKeyHex, keystore.KeyPurposeSigning); err != nil {
+		t.Fatal(err)
+	}
+
+	hash := crypto.Keccak256([]byte("purpose"))
+	if _, err := ks.SignWithAccount("decrypt-only", hash); !errors.Is(err, keystore.ErrWrongKeyPurpose) {
+		t.Fatalf("SignWithAccount with an encryption key: got %v, want ErrWrongKeyPurpose", err)
+	}
+	if _, err := ks.SignWithAccount("sign-only", hash); err != nil {
+		t.Fatalf("SignWithAccount with a signing key: %v", err)
+	}
+
+	// Renaming keeps the purpose.
+	if err := ks.RenameAccount("decrypt-only", "renamed"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.SignWithAccount("renamed", hash); !errors.Is(err, keystore.ErrWrongKeyPurpose) {
+		t.Fatalf("SignWithAccount after renaming: got %v, want ErrWrongKeyPurpose", err)
+	}
+	if issues := verifyIssues(t, ks, keystore.VerifyDualUseKey); len(issues) != 0 {
+		t.Fatalf("Verify reported dual use for keys with purposes: %+v", issues)
+	}
+}
+
+func TestKeyPurposeLegacyKeys(t *testing.T) {
+	dir := t.TempDir()
+	ks := newErrorStore(t, keystore.Config{DirPath: dir})
+	if err := ks.SavePrivateKeyWithPurpose(fileKeyHex, keystore.KeyPurposeSigning); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveAccountWithPurpose("ops", credentialKeyHex, keystore.KeyPurposeSigning); err != nil {
+		t.Fatal(err)
+	}
+
+	// A keystore written before purposes existed has no purpose fields.
+	editKeystore(t, dir, func(doc map[string]any) {
+		delete(doc, "key_purpose")
+		for _, account := range doc["accounts"].(map[string]any) {
+			delete(account.(map[string]any), "purpose")
+		}
+	})
+	legacy := newErrorStore(t, keystore.Config{DirPath: dir})
+	for _, op := range append(signingOps, encryptionOps...) {
+		if err := op.run(legacy); err != nil {
+			t.Errorf("%s with a legacy key: %v", op.name, err)
+		}
+	}
+	if _, err := legacy.SignWithAccount("ops", crypto.Keccak256([]byte("legacy"))); err != nil {
+		t.Errorf("SignWithAccount with a legacy account: %v", err)
+	}
+
+	report, err := legacy.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Fatalf("Verify of a legacy keystore reported errors: %+v", report.Issues)
+	}
+	issues := verifyIssues(t, legacy, keystore.VerifyDualUseKey)
+	for _, key := range []string{"primary", "ops"} {
+		if issues[key].Severity != keystore.VerifySeverityWarning {
+			t.Errorf("Verify did not warn that %s is dual use: %+v", key, issues)
+		}
+	}
+
+	// An unknown purpose, from a newer version, refuses every use.
+	editKeystore(t, dir, func(doc map[string]any) { doc["key_purpose"] = "attestation" })
+	future := newErrorStore(t, keystore.Config{DirPath: dir})
+	for _, op := range append(signingOps, encryptionOps...) {
+		if err := op.run(future); !errors.Is(err, keystore.ErrWrongKeyPurpose) {
+			t.Errorf("%s with an unknown purpose: got %v, want ErrWrongKeyPurpose", op.name, err)
+		}
+	}
+	if issue, ok := verifyIssues(t, future, keystore.VerifyUnknownPurpose)["primary"]; !ok || issue.Severity != keystore.VerifySeverityError {
+		t.Errorf("Verify did not report the unknown purpose as an error: %+v", issue)
+	}
+}
+
+func TestGenerateKeyPairSet(t *testing.T) {
+	ks := newErrorStore(t, keystore.Config{})
+	set, err := ks.GenerateKeyPairSet()
+	if err != nil {
+		t.Fatalf("GenerateKeyPairSet: %v", err)
+	}
+	if set.SigningAddress == set.EncryptionAddress {
+		t.Fatal("GenerateKeyPairSet returned one key for both purposes")
+	}
+	if addr, err := ks.GetAddress(); err != nil || addr != set.SigningAddress {
+		t.Fatalf("GetAddress = %s, %v, want the signing key", addr.Hex(), err)
+	}
+	if pub, err := ks.EncryptionPublicKey(); err != nil || !pub.Equal(set.EncryptionPublicKey) {
+		t.Fatalf("EncryptionPublicKey = %v, %v, want the encryption key", pub, err)
+	}
+
+	for _, op := range append(signingOps, encryptionOps...) {
+		if err := op.run(ks); err != nil {
+			t.Errorf("%s: %v", op.name, err)
+		}
+	}
+	sig, err := ks.SignMessage([]byte("pair"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr, err := keystore.RecoverAddress([]byte("pair"), sig); err != nil || addr != set.SigningAddress {
+		t.Fatalf("SignMessage signed with %s, %v, want the signing key", addr.Hex(), err)
+	}
+	if _, err := ks.SignWithAccount(keystore.EncryptionAccountName, crypto.Keccak256([]byte("pair"))); !errors.Is(err, keystore.ErrWrongKeyPurpose) {
+		t.Fatalf("SignWithAccount with the encryption key: got %v, want ErrWrongKeyPurpose", err)
+	}
+	if issues := verifyIssues(t, ks, keystore.VerifyDualUseKey); len(issues) != 0 {
+		t.Fatalf("Verify reported dual use after GenerateKeyPairSet: %+v", issues)
+	}
+
+	if _, err := ks.GenerateKeyPairSet(); !errors.Is(err, keystore.ErrAccountExists) {
+		t.Fatalf("GenerateKeyPairSet again: got %v, want ErrAccountExists", err)
+	}
+	if addr, err := ks.GetAddress(); err != nil || addr != set.SigningAddress {
+		t.Fatalf("the refused GenerateKeyPairSet replaced the signing key: %s, %v", addr.Hex(), err)
+	}
+}
+
+func TestGenerateKeyPairSetSingleWrite(t *testing.T) {
+	inj := faultinject.New()
+	ks := newErrorStore(t, keystore.Config{FaultInjector: inj})
+	if err := ks.SaveToken("token"); err != nil {
+		t.Fatal(err)
+	}
+
+	writes := inj.Calls(keystore.FaultOpWrite)
+	if _, err := ks.GenerateKeyPairSet(); err != nil {
+		t.Fatal(err)
+	}
+	if n := inj.Calls(keystore.FaultOpWrite) - writes; n != 1 {
+		t.Fatalf("GenerateKeyPairSet wrote %d times, want once", n)
+	}
+
+	// When that write fails, neither key is stored.
+	fresh := newErrorStore(t, keystore.Config{FaultInjector: inj})
+	if err := fresh.SaveToken("token"); err != nil {
+		t.Fatal(err)
+	}
+	diskFull := errors.New("disk full")
+	inj.Once(keystore.FaultOpWrite, keystore.Fault{Err: diskFull})
+	if _, err := fresh.GenerateKeyPairSet(); !errors.Is(err, diskFull) {
+		t.Fatalf("GenerateKeyPairSet: got %v, want the injected failure", err)
+	}
+	if _, err := fresh.LoadPrivateKey(); !errors.Is(err, keystore.ErrNoPrivateKey) {
+		t.Fatalf("LoadPrivateKey after the failed write: got %v, want ErrNoPrivateKey", err)
+	}
+	if _, err := fresh.LoadAccountKey(keystore.EncryptionAccountName); !errors.Is(err, keystore.ErrAccountNotFound) {
+		t.Fatalf("LoadAccountKey after the failed write: got %v, want ErrAccountNotFound", err)
+	}
+}
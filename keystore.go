@@ -1,14 +1,21 @@
 package keystore
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
 )
 
@@ -27,137 +34,1394 @@ const (
 
 	// TokenExpiryDuration is the duration after which a token is considered expired
 	TokenExpiryDuration = 1 * time.Hour
+
+	// DefaultClockSkewTolerance is the default allowance for clock differences
+	// between the machine that saved a token and the one loading it
+	DefaultClockSkewTolerance = 2 * time.Minute
+
+	// DefaultLeaseSkewTolerance is the default allowance for clock differences
+	// between the hosts sharing a signing lease
+	DefaultLeaseSkewTolerance = 5 * time.Second
+
+	// DefaultMaxFileSize is the default limit on the size of a keystore file
+	DefaultMaxFileSize = 4 << 20
+
+	// DefaultMaxSecretSize is the default limit on the size of one secret
+	DefaultMaxSecretSize = 1 << 20
+
+	// maxTokenLength is the longest auth token accepted, far above any
+	// real bearer token
+	maxTokenLength = 64 << 10
 )
 
 var (
-	ErrEmptyToken   = errors.New("token cannot be empty")
-	ErrNoKeystore   = errors.New("no keystore found - please authenticate first")
-	ErrTokenExpired = errors.New("token has expired - please re-authenticate")
-	ErrInvalidToken = errors.New("invalid token found in keystore")
-	ErrNoPrivateKey = errors.New("no private key found in keystore")
+	ErrEmptyToken       = errors.New("token cannot be empty")
+	ErrNoKeystore       = errors.New("no keystore found - please authenticate first")
+	ErrTokenExpired     = errors.New("token has expired - please re-authenticate")
+	ErrInvalidToken     = errors.New("invalid token found in keystore")
+	ErrNoToken          = errors.New("no auth token found in keystore - please authenticate first")
+	ErrNoPrivateKey     = errors.New("no private key found in keystore")
+	ErrInvalidStoredKey = errors.New("stored private key is malformed")
+	ErrReadOnly         = errors.New("value is read-only")
+	ErrDeviceMismatch   = errors.New("token was bound to a different device - please re-authenticate")
+
+	ErrLocked             = errors.New("keystore is locked - passphrase required")
+	ErrWrongPassphrase    = errors.New("incorrect passphrase")
+	ErrEncryptionRequired = errors.New("encryption is required but no passphrase is configured")
+	ErrPlaintextKey       = errors.New("keystore holds an unencrypted private key - run EncryptInPlace to migrate it")
+
+	ErrAccountNotFound    = errors.New("account not found")
+	ErrAccountExists      = errors.New("account already exists")
+	ErrInvalidAccountName = errors.New("invalid account name")
+	ErrInvalidAddress     = errors.New("invalid address")
+	ErrAddressMismatch    = errors.New("private key does not match the stored address")
+	ErrWatchOnly          = errors.New("account is watch-only and has no private key")
+	ErrUnexpectedAddress  = errors.New("private key does not derive to the expected address")
+	ErrBadChecksum        = errors.New("address checksum mismatch")
+	ErrInvalidPublicKey   = errors.New("invalid public key")
+	ErrDecryptFailed      = errors.New("failed to decrypt payload")
+
+	ErrUnsupportedVersion    = errors.New("keystore was written by a newer version of this package - please upgrade")
+	ErrAutoRefreshRunning    = errors.New("auto refresh is already running")
+	ErrInvalidUserID         = errors.New("invalid user id")
+	ErrUserNotFound          = errors.New("user not found")
+	ErrNotFileBacked         = errors.New("operation requires a file-backed keystore")
+	ErrExportExists          = errors.New("export target already exists")
+	ErrKeystoreTooLarge      = errors.New("keystore exceeds the maximum file size")
+	ErrLockTimeout           = errors.New("timed out waiting for the keystore lock")
+	ErrMergeConflict         = errors.New("keystores have conflicting entries")
+	ErrInvalidBundle         = errors.New("invalid or corrupted keystore bundle")
+	ErrReadOnlyKeySource     = errors.New("private key comes from a read-only source")
+	ErrChainMismatch         = errors.New("key was saved for a different chain")
+	ErrUnauthorized          = errors.New("keystore service rejected the credentials")
+	ErrConflict              = errors.New("keystore was modified concurrently - reload and retry")
+	ErrDeviceNotFound        = errors.New("hardware token not found")
+	ErrPINBlocked            = errors.New("hardware token PIN is blocked")
+	ErrTouchRequired         = errors.New("hardware token requires a touch to sign")
+	ErrNoSecretKey           = errors.New("no secret key available to decrypt the keystore")
+	ErrTPMUnavailable        = errors.New("TPM is not available")
+	ErrPCRMismatch           = errors.New("PCR values no longer match the sealed key - re-seal with Reseal")
+	ErrNoBackup              = errors.New("no backup to roll back to")
+	ErrManifestInvalid       = errors.New("keystore manifest is missing or invalid")
+	ErrStorageReadOnly       = errors.New("keystore storage is read-only")
+	ErrNonInteractive        = errors.New("cannot prompt for a passphrase: input is not a terminal")
+	ErrNoPassphrase          = errors.New("no passphrase available")
+	ErrWrongKeyType          = errors.New("operation is not supported for this key type")
+	ErrNoSSHKey              = errors.New("no SSH key found in keystore")
+	ErrNoTokenForURL         = errors.New("no token stored for this URL")
+	ErrInvalidPrivateKey     = errors.New("invalid private key")
+	ErrInvalidPortable       = errors.New("invalid or corrupted portable keystore")
+	ErrKeySplit              = errors.New("primary key is split into shares")
+	ErrInvalidShare          = errors.New("invalid key share")
+	ErrShareWindowExpired    = errors.New("share window expired before enough shares were provided")
+	ErrCorruptKeystore       = errors.New("keystore is corrupted")
+	ErrInvalidConfig         = errors.New("invalid keystore configuration")
+	ErrServiceResponse       = errors.New("unexpected response from keystore service")
+	ErrInvalidChainID        = errors.New("invalid chain id")
+	ErrInvalidLabel          = errors.New("invalid label")
+	ErrInvalidTokenTTL       = errors.New("invalid token lifetime")
+	ErrInvalidURL            = errors.New("invalid URL")
+	ErrEmptyPassphrase       = errors.New("passphrase cannot be empty")
+	ErrNoEscrow              = errors.New("keystore has no escrow record")
+	ErrNoSealedKey           = errors.New("no sealed key available")
+	ErrNotDeviceBound        = errors.New("token is not bound to a device")
+	ErrNoMachineID           = errors.New("failed to determine machine id")
+	ErrAuthorizationRequired = errors.New("operation requires authorization - call Authorize first")
+	ErrInvalidProvenance     = errors.New("invalid key provenance")
+	ErrRecoveredFromMirror   = errors.New("keystore was recovered from the mirror")
+	ErrNoHomeDir             = errors.New("no home directory found")
+	ErrSignerClosed          = errors.New("batch signer is closed")
+	ErrPolicyViolation       = errors.New("signing policy violation")
+	ErrInvalidPolicy         = errors.New("invalid signing policy")
+	ErrKeystoreExists        = errors.New("destination already holds a keystore")
+	ErrTransformMismatch     = errors.New("keystore was written with different transforms")
+	ErrPaperBackupDamaged    = errors.New("paper backup is damaged")
+	ErrStoreRegistered       = errors.New("a store is already registered under this name")
+	ErrUnknownStore          = errors.New("no store is registered under this name")
+	ErrPrivateMaterial       = errors.New("public bundle contains private material")
+	ErrAlreadyProvisioned    = errors.New("keystore is already provisioned")
+	ErrInvalidSignature      = errors.New("invalid signature")
+	ErrKeystoreFrozen        = errors.New("keystore is frozen")
+	ErrWrongKeyPurpose       = errors.New("key cannot be used for this purpose")
+	ErrExportNotAuthorized   = errors.New("export not authorized")
+	ErrTokenNotAttested      = errors.New("token is not attested by the primary key")
+	ErrGenerationUnsupported = errors.New("backend does not track generations")
+	ErrStaleRead             = errors.New("keystore read is older than the last write by this Store")
+	ErrNoSecret              = errors.New("secret not found")
+	ErrSecretTooLarge        = errors.New("secret exceeds the size limit")
+	ErrInvalidSecretName     = errors.New("invalid secret name")
+	ErrWellKnownTestKey      = errors.New("refusing a well-known test key")
+	ErrNotLeaseHolder        = errors.New("not the signing lease holder")
+	ErrInvalidExportTicket   = errors.New("invalid export ticket request")
+	ErrEmptyFreezeReason     = errors.New("freeze reason cannot be empty")
+	ErrInvalidRegistration   = errors.New("invalid store registration")
+	ErrInvalidPollInterval   = errors.New("invalid poll interval")
+	ErrUnknownLayout         = errors.New("unknown keystore layout")
+	ErrInvalidSecretSize     = errors.New("invalid secret size")
+	ErrInvalidEnvPrefix      = errors.New("invalid environment variable prefix")
+	ErrUnknownEnvContents    = errors.New("unknown environment contents")
+	ErrInvalidLease          = errors.New("invalid signing lease request")
+	ErrInvalidHash           = errors.New("invalid hash")
+
+	ErrInvalidMnemonic      = errors.New("invalid mnemonic")
+	ErrMnemonicNotConfirmed = errors.New("mnemonic backup has not been confirmed")
 )
 
 type Config struct {
 	DirPath  string
 	FileName string
+
+	// FallbackDirs are tried in order when DirPath is on read-only storage.
+	// The directory in use is reported by Store.Dir.
+	FallbackDirs []string
+
+	// RequireExplicitPath makes NewKeystore fail instead of defaulting an
+	// empty DirPath to DefaultPath.
+	RequireExplicitPath bool
+
+	// PathMode selects where an empty or relative DirPath is resolved:
+	// the home directory by default, next to the executable or in the
+	// working directory. An absolute DirPath always wins.
+	PathMode PathMode
+
+	// Codec encodes the keystore file, JSON by default. When FileName is
+	// not set it defaults to keystore plus the codec's extension. Files
+	// that do not parse with the codec are read as JSON.
+	Codec Codec
+
+	// Transforms rewrite the serialized keystore on save, in order, and are
+	// reversed on load. The chain is recorded in the file header and a file
+	// written with a different chain fails to load with
+	// ErrTransformMismatch. Not supported with SplitFiles.
+	Transforms []Transform
+
+	// SystemdCredentials sources the private key and auth token from
+	// $CREDENTIALS_DIRECTORY when the named credential files exist.
+	// Credential values take precedence over the keystore file and are read-only.
+	SystemdCredentials   bool
+	PrivateKeyCredential string
+	AuthTokenCredential  string
+
+	// KeyFromEnv names an environment variable holding the primary key in
+	// hex. The variable is read once by NewKeystore; the key is then used
+	// for loading and signing but never persisted, and SavePrivateKey fails
+	// with ErrReadOnlyKeySource. It takes precedence over systemd credentials.
+	// ClearKeyEnv unsets the variable after reading it.
+	KeyFromEnv  string
+	ClearKeyEnv bool
+
+	// OpenPGP encrypts the whole keystore file to OpenPGP recipients.
+	OpenPGP *OpenPGPConfig
+
+	// Ephemeral keeps all state in memory only. Nothing is ever written to
+	// disk and no directories are created.
+	Ephemeral bool
+
+	// Backend overrides where the keystore is persisted. DirPath and FileName
+	// are ignored when it is set.
+	Backend Backend
+
+	// SplitFiles stores the auth token and the keys in separate files in
+	// DirPath, named by TokenFileName and KeyFileName. An existing combined
+	// keystore file is read until the first save, which migrates it. Each
+	// file is locked separately, so token and key writes do not wait for
+	// each other.
+	SplitFiles    bool
+	KeyFileName   string
+	TokenFileName string
+
+	// DeviceBound encrypts saved tokens with a key derived from the machine
+	// identifier so the keystore file only yields a token on this machine.
+	DeviceBound bool
+
+	// BindTokenToKey makes token saves also store a signature by the
+	// primary key over the token and its expiry, returned by
+	// TokenAttestation, so a server can tell that the token is presented
+	// by the key it was issued to. The key must be readable, so an
+	// encrypted keystore needs its passphrase. Tokens saved while the
+	// keystore holds no primary key are not bound.
+	BindTokenToKey bool
+
+	// Signer routes SignDigest to a key held outside the keystore, such as
+	// a PIVSigner.
+	Signer ExternalSigner
+
+	// Passphrase supplies the passphrase used to encrypt the private key.
+	// When nil, keys are stored in plaintext unless the Store is unlocked.
+	Passphrase PassphraseProvider
+
+	// Sealer encrypts values with a random data key sealed to hardware,
+	// such as a TPMSealer, instead of a passphrase. SealerRecovery, if set,
+	// also encrypts the data key with a recovery passphrase for Reseal.
+	Sealer         KeySealer
+	SealerRecovery PassphraseProvider
+
+	// ProvisioningPubKey, when set, makes loading fail with
+	// ErrManifestInvalid unless the keystore carries a manifest signed by
+	// this key (or by ManifestSigningKey). ManifestPolicy decides whether
+	// the first save drops the manifest or re-signs it with
+	// ManifestSigningKey.
+	ProvisioningPubKey *ecdsa.PublicKey
+	ManifestPolicy     ManifestPolicy
+	ManifestSigningKey *ecdsa.PrivateKey
+
+	// AutoEncryptOnLoad runs EncryptInPlace with the Passphrase provider
+	// when the keystore is opened and still holds plaintext values.
+	AutoEncryptOnLoad bool
+
+	// RequireEncryption refuses to persist or return an unencrypted private key.
+	RequireEncryption bool
+
+	// EncryptToken encrypts the auth token alongside the private key.
+	EncryptToken bool
+
+	// TokenTTL is the lifetime of tokens saved with SaveToken.
+	// Defaults to TokenExpiryDuration.
+	TokenTTL time.Duration
+
+	// OnRefreshError is called when StartAutoRefresh exhausts its retries.
+	OnRefreshError func(error)
+
+	// ExpectedAddress pins the address the primary key must derive to.
+	// The zero value disables the check.
+	ExpectedAddress common.Address
+
+	// WarnOnAddressMismatch logs a warning instead of failing with
+	// ErrAddressMismatch when the stored key does not derive to the stored address.
+	WarnOnAddressMismatch bool
+
+	// AllowChainMismatch lets SignTransaction and TransactOpts sign for a
+	// chain other than the one recorded with the key, logging a warning
+	// instead of failing with ErrChainMismatch.
+	AllowChainMismatch bool
+
+	// Logger receives warnings. Defaults to slog.Default().
+	Logger *slog.Logger
+
+	// ClockSkewTolerance is applied on both sides of the token expiry check.
+	// Zero uses DefaultClockSkewTolerance; a negative value disables it.
+	ClockSkewTolerance time.Duration
+
+	// ExpiryGracePeriod is how long after expiry LoadTokenDetailed still
+	// returns the token, in state TokenGraceExpired, and how long before
+	// expiry it reports TokenExpiringSoon. LoadToken ignores it.
+	ExpiryGracePeriod time.Duration
+
+	// LeaseSkewTolerance is how long after its expiry a signing lease is
+	// still honoured and cannot be taken over. Zero uses
+	// DefaultLeaseSkewTolerance; a negative value disables it.
+	LeaseSkewTolerance time.Duration
+
+	// RetryAttempts is the number of attempts made for storage operations
+	// failing with transient errors such as EIO or ESTALE. Zero uses
+	// DefaultRetryAttempts; a negative value disables retries.
+	RetryAttempts int
+
+	// RetryBackoff is the base delay between storage retries, doubled on
+	// each attempt. Defaults to DefaultRetryBackoff.
+	RetryBackoff time.Duration
+
+	// OnRetry is called before each storage retry with the operation
+	// ("read" or "write"), the failed attempt number and its error.
+	OnRetry func(op string, attempt int, err error)
+
+	// StrictParse rejects keystore files containing fields this package does
+	// not know, so typos in hand-edited files are reported instead of ignored.
+	// Leave it off to read files written by newer versions.
+	StrictParse bool
+
+	// MaxFileSize caps how many bytes are read from the backend, and the
+	// size of the data saves write, which otherwise fail with
+	// ErrKeystoreTooLarge. Defaults to DefaultMaxFileSize.
+	MaxFileSize int64
+
+	// Environment is the kind of deployment the Store runs in. With
+	// EnvironmentProd, saving or importing a well-known test key or a
+	// low-entropy key fails with ErrWellKnownTestKey. Defaults to
+	// EnvironmentDev.
+	Environment Environment
+
+	// AdditionalForbiddenKeys extends the list of well-known test keys
+	// with fingerprints from TestKeyFingerprint.
+	AdditionalForbiddenKeys []string
+
+	// MaxSecretSize caps the size of values stored with PutSecret.
+	// Defaults to DefaultMaxSecretSize.
+	MaxSecretSize int64
+
+	// FileSizeWarning is the size above which saves log a warning and call
+	// OnSizeWarning. Zero uses three quarters of MaxFileSize; a negative
+	// value disables the warning.
+	FileSizeWarning int64
+
+	// OnSizeWarning is called when a save writes more than FileSizeWarning
+	// bytes, with the size written and the sections of the keystore,
+	// largest first. It is called with the lock held, so it must not call
+	// back into the Store.
+	OnSizeWarning func(size int64, sections []SectionSize)
+
+	// LockTimeout bounds how long writes wait for another process holding
+	// the keystore lock. Defaults to DefaultLockTimeout.
+	LockTimeout time.Duration
+
+	// PrunePolicy, when set, prunes stale data as Prune does on every save.
+	// DryRun is ignored.
+	PrunePolicy *PrunePolicy
+
+	// BackupRetain and BackupMaxAge enable timestamped backups of the
+	// keystore file, written before every save. Backups beyond the newest
+	// BackupRetain, or older than BackupMaxAge, are removed on each save.
+	BackupRetain int
+	BackupMaxAge time.Duration
+
+	// SSHAgentLifetime is how long AddToAgent asks the agent to keep the SSH
+	// key. Defaults to DefaultSSHAgentLifetime.
+	SSHAgentLifetime time.Duration
+
+	// TrackUsage records how often and when each key is loaded or used to
+	// sign, reported by ListAccounts and Status. Usage is written in batches
+	// every UsageFlushInterval, default DefaultUsageFlushInterval, and on
+	// Close.
+	TrackUsage         bool
+	UsageFlushInterval time.Duration
+
+	// EscrowPublicKey, a secp256k1 organization key, enables key escrow:
+	// saving a primary key also stores a copy encrypted to it with ECIES,
+	// which RecoverFromEscrow opens offline. Without it the escrow copy is
+	// removed on the next save.
+	EscrowPublicKey *ecdsa.PublicKey
+
+	// UnlockCacheTTL bounds how long the outcome of a Passphrase prompt
+	// is reused: a passphrase is shared with callers that were waiting on
+	// the prompt, and a failed prompt or wrong passphrase is returned
+	// without prompting again. Defaults to DefaultUnlockCacheTTL; a
+	// negative value disables both.
+	UnlockCacheTTL time.Duration
+
+	// ShareWindow bounds a dual-control unlock: shares given to
+	// ProvideShare are discarded if the threshold is not met this long
+	// after the first one. Defaults to DefaultShareWindow.
+	ShareWindow time.Duration
+
+	// PublicCache keeps a side-cache of the addresses, fingerprints, labels
+	// and token expiry next to the keystore file, as <name>.pub.json, so
+	// PublicData can answer without unlocking. It is rewritten on every
+	// save and whenever it no longer matches the keystore. File backends
+	// only.
+	PublicCache bool
+
+	// TrashRetention is how long DeleteAccount keeps deleted accounts
+	// before Prune purges them. Defaults to DefaultTrashRetention.
+	TrashRetention time.Duration
+
+	// RequireAuthorizationFor lists operations, by the Auth constants,
+	// that fail with ErrAuthorizationRequired unless they are called within
+	// a window opened by Authorize.
+	RequireAuthorizationFor []string
+
+	// Approve, if set, grants the approval Authorize asks for instead of
+	// Passphrase re-entry, for example by showing a confirmation dialog.
+	// It returns nil to approve.
+	Approve func() error
+
+	// RequireExportTicket makes ExportBundle, ExportPaperBackup,
+	// MarshalPortable, ExportToKeystoreDir, EscrowBlob and PublicBundle
+	// fail with ErrExportNotAuthorized unless called WithExportTicket and
+	// a ticket from AuthorizeExport for their scope.
+	RequireExportTicket bool
+
+	// ImportLegacy makes a load that finds no keystore import the token
+	// and key files older releases wrote to LegacyDir, as
+	// ImportLegacyFiles does. LegacyDir defaults to DefaultLegacyDirName
+	// in the home directory.
+	ImportLegacy bool
+	LegacyDir    string
+
+	// MirrorPath, if set, receives a copy of every save, written
+	// atomically with the primary file's permissions once the primary
+	// write succeeded. Mirror failures are logged and audited without
+	// failing the save. Loads fall back to the mirror while the primary
+	// is missing or corrupt.
+	MirrorPath string
+
+	// BatchSignWorkers is the number of goroutines a batch signer spreads
+	// large batches over. Zero uses GOMAXPROCS and one signs serially.
+	BatchSignWorkers int
+
+	// SigningPolicy limits what SignTransaction and
+	// SignTransactionWithAccount sign. It is copied into the keystore file
+	// on first use; from then on the stored policy applies and only
+	// UpdatePolicy changes it.
+	SigningPolicy *SigningPolicy
+
+	// DisableCoreDumps makes RegisterShutdownWipe disable core dumps for
+	// the process by setting RLIMIT_CORE to zero. Unix only.
+	DisableCoreDumps bool
+
+	// ConfirmUnfreeze makes Unfreeze obtain approval as Authorize does,
+	// from Approve or by re-entering the passphrase.
+	ConfirmUnfreeze bool
+
+	// Audit, if set, is called with every load, save, signature, key
+	// access, export and authorization. Events never contain secrets. It
+	// is called with the Store locked and must not call back into it.
+	Audit func(AuditEvent)
+
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+
+	// AfterFunc runs f once d has passed on the clock behind Now and returns
+	// a function that cancels it, reporting whether it did. Expiry
+	// notifications, auto refresh and usage flushes wait through it, so a
+	// test clock that sets Now should set it too. Defaults to time.AfterFunc.
+	AfterFunc func(d time.Duration, f func()) (stop func() bool)
+
+	// FaultInjector, if set, makes operations fail, stall or misbehave as
+	// it chooses, for chaos testing. Leave it nil in production.
+	FaultInjector FaultInjector
 }
 
 type Store struct {
+	Format  *FormatInfo `json:"_format,omitempty"`
+	Version int         `json:"version,omitempty"`
+	Rev     int64       `json:"revision,omitempty"`
+
+	// persisted holds the fields behind the deprecated AuthToken,
+	// PrivateKey and CreatedAt, which shadow it.
+	persisted
+
+	Address     string     `json:"address,omitempty"`
+	PublicKey   string     `json:"public_key,omitempty"`
+	KeyCurve    string     `json:"key_curve,omitempty"`
+	KeyPurpose  KeyPurpose `json:"key_purpose,omitempty"`
+	ChainID     string     `json:"chain_id,omitempty"`
+	NetworkName string     `json:"network_name,omitempty"`
+	ExpiresAt   int64      `json:"expires_at,omitempty"`
+	TokenDevice string     `json:"token_device,omitempty"`
+	TokenSalt   string     `json:"token_salt,omitempty"`
+	SavedAt     int64      `json:"saved_at,omitempty"`
+
+	EncryptedKey   *EncryptedValue `json:"encrypted_key,omitempty"`
+	EncryptedToken *EncryptedValue `json:"encrypted_token,omitempty"`
+
+	TokenBinding *TokenBinding `json:"token_binding,omitempty"`
+
+	Accounts       map[string]*Account `json:"accounts,omitempty"`
+	DefaultAccount string              `json:"default_account,omitempty"`
+	Trash          map[string]*Account `json:"trash,omitempty"`
+
+	// EncryptionAccount names the account Decrypt and SharedSecret use
+	// instead of the primary key, as set by GenerateKeyPairSet.
+	EncryptionAccount string `json:"encryption_account,omitempty"`
+
+	URLTokens map[string]*URLToken `json:"url_tokens,omitempty"`
+
+	// Secrets holds the values stored with PutSecret, base64-encoded, on
+	// backends that are not a SecretBackend.
+	Secrets map[string]string `json:"secrets,omitempty"`
+
+	SSHKey          string          `json:"ssh_key,omitempty"`
+	EncryptedSSHKey *EncryptedValue `json:"encrypted_ssh_key,omitempty"`
+	SSHPublicKey    string          `json:"ssh_public_key,omitempty"`
+
+	KeyShares *KeyShares `json:"key_shares,omitempty"`
+
+	Escrow   *Escrow         `json:"escrow,omitempty"`
+	External *ExternalKeyRef `json:"external_key,omitempty"`
+	Sealed   *SealedKey      `json:"sealed_key,omitempty"`
+	Manifest *Manifest       `json:"manifest,omitempty"`
+
+	MnemonicBackedUpAt int64 `json:"mnemonic_backed_up_at,omitempty"`
+
+	Provenance *Provenance `json:"provenance,omitempty"`
+
+	Provisioning *Provisioning `json:"provisioning,omitempty"`
+
+	Frozen *FreezeState `json:"frozen,omitempty"`
+
+	SigningLease *SigningLease `json:"signing_lease,omitempty"`
+	LeaseFence   int64         `json:"lease_fence,omitempty"`
+
+	UseCount   int64 `json:"use_count,omitempty"`
+	LastUsedAt int64 `json:"last_used_at,omitempty"`
+
+	Policy      *SigningPolicy     `json:"signing_policy,omitempty"`
+	PolicyUsage map[string][]int64 `json:"policy_usage,omitempty"`
+
+	// AuthToken is a copy of the stored auth token, when it is not
+	// encrypted, as of the last load or save. Writes to it are ignored.
+	//
+	// Deprecated: Use LoadToken and SaveToken.
+	AuthToken string `json:"-"`
+
+	// PrivateKey is a copy of the stored private key hex, when it is not
+	// encrypted, as of the last load or save. Writes to it are ignored.
+	//
+	// Deprecated: Use LoadPrivateKey and SavePrivateKey.
+	PrivateKey string `json:"-"`
+
+	// CreatedAt is a copy of the Unix time the auth token was saved, as of
+	// the last load or save. Writes to it are ignored.
+	//
+	// Deprecated: Use TokenCreatedAt.
+	CreatedAt int64 `json:"-"`
+
+	config          Config
+	creds           credentials
+	backend         Backend
+	unlocked        *string
+	loadedAt        time.Time
+	writtenRev      int64
+	fileVersion     int
+	fileFormat      *FormatInfo
+	watchers        map[*expiryWatcher]struct{}
+	refreshing      bool
+	cache           *keyCache
+	registryKey     string
+	refs            int
+	manifestDropped bool
+	readOnly        *ReadOnlyError
+	fileSize        int64
+	info            map[string]string
+	usage           *usageTracker
+	stats           *storeStats
+	unlocks         *unlockGate
+	ceremony        *shareCeremony
+	shareKey        *string
+	authorizedUntil time.Time
+	exportTickets   map[string]exportGrant
+	fromMirror      bool
+	skipOpenPGP     bool
+	lease           *heldLease
+	mirroredAt      time.Time
+	mirrorErr       string
+	scope           lockScope
+	signers         map[*Signer]struct{}
+	policyWarned    bool
+	async           *asyncWriter
+	redaction       *redaction
+	mu              storeMutex
+}
+
+// persisted is the on-disk form of the fields the deprecated Store fields
+// used to hold. It is embedded so that it is encoded in place of them.
+type persisted struct {
 	AuthToken  string `json:"auth_token,omitempty"`
 	PrivateKey string `json:"private_key,omitempty"`
 	CreatedAt  int64  `json:"created_at,omitempty"`
-	config     Config
 }
 
 func NewKeystore(cfg Config) (*Store, error) {
-	if cfg.DirPath == "" {
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			return nil, fmt.Errorf("failed to get home directory: %w", err)
+	if cfg.Ephemeral && cfg.MirrorPath != "" {
+		return nil, configError("MirrorPath", "an ephemeral keystore is never written to disk")
+	}
+
+	if cfg.Ephemeral {
+		if cfg.Backend != nil {
+			return nil, configError("Ephemeral", "an ephemeral keystore cannot use a custom backend")
+		}
+		cfg.Backend = NewMemoryBackend()
+	}
+
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+
+	if cfg.AfterFunc == nil {
+		cfg.AfterFunc = func(d time.Duration, f func()) func() bool {
+			return time.AfterFunc(d, f).Stop
+		}
+	}
+
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+
+	if err := validateManifestConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := validateEscrowConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := validateAuthorizationConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.SigningPolicy.validate(); err != nil {
+		return nil, err
+	}
+
+	if err := validateEnvironment(cfg); err != nil {
+		return nil, err
+	}
+
+	if cfg.ExpiryGracePeriod < 0 {
+		return nil, configError("ExpiryGracePeriod", "grace period cannot be negative")
+	}
+
+	if cfg.Sealer != nil && cfg.Passphrase != nil {
+		return nil, configError("Sealer", "a sealer cannot be combined with a passphrase")
+	}
+
+	if cfg.OpenPGP != nil {
+		if err := cfg.OpenPGP.validate(); err != nil {
+			return nil, err
+		}
+		if cfg.SplitFiles {
+			return nil, configError("OpenPGP", "OpenPGP encryption cannot be combined with split files")
+		}
+	}
+
+	if err := validateTransforms(cfg); err != nil {
+		return nil, err
+	}
+
+	if cfg.Codec != nil && cfg.SplitFiles && !isJSONCodec(cfg.Codec) {
+		return nil, configError("Codec", "split files are always JSON and cannot use a codec")
+	}
+
+	creds, err := loadCredentials(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Backend != nil {
+		s := &Store{config: cfg, creds: creds, backend: cfg.Backend, stats: &storeStats{}}
+		s.initShared(&unlockGate{})
+		s.trackUsage()
+		if err := s.autoEncrypt(); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+
+	if cfg, err = resolveLocation(cfg); err != nil {
+		return nil, err
+	}
+
+	s := &Store{config: cfg, creds: creds, stats: &storeStats{}}
+	s.initShared(&unlockGate{})
+	if cfg.SplitFiles {
+		s.backend = s.splitBackend()
+	} else {
+		s.backend = NewFileBackend(s.path())
+	}
+	s.trackUsage()
+
+	if err := s.autoEncrypt(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// resolveLocation sets the DirPath and FileName of a file-backed cfg to the
+// directory and file the keystore lives in, creating the directory.
+func resolveLocation(cfg Config) (Config, error) {
+	if cfg.DirPath == "" && cfg.RequireExplicitPath {
+		return cfg, configError("DirPath", "RequireExplicitPath is set but no DirPath was given")
+	}
+
+	var err error
+	nextToExecutable := cfg.PathMode == PathModeExecutable && !filepath.IsAbs(cfg.DirPath)
+	if cfg.DirPath, err = resolveDirPath(cfg.DirPath, cfg.PathMode); err != nil {
+		return cfg, err
+	}
+	if nextToExecutable && len(cfg.FallbackDirs) == 0 {
+		if err := checkExecutableDir(cfg.DirPath); err != nil {
+			return cfg, err
 		}
-		cfg.DirPath = filepath.Join(homeDir, DefaultDirName)
 	}
 
 	if cfg.FileName == "" {
 		cfg.FileName = DefaultFileName
+		if cfg.Codec != nil {
+			cfg.FileName = strings.TrimSuffix(DefaultFileName, ".json") + cfg.Codec.Ext()
+		}
 	}
 
-	if err := os.MkdirAll(cfg.DirPath, DefaultDirMode); err != nil {
-		return nil, fmt.Errorf("failed to create keystore directory: %w", err)
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
 	}
-
-	return &Store{config: cfg}, nil
+	if cfg.DirPath, err = chooseDir(cfg.DirPath, cfg.FallbackDirs, cfg.Logger); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
 }
 
 func (s *Store) path() string {
 	return filepath.Join(s.config.DirPath, s.config.FileName)
 }
 
+func (s *Store) now() time.Time {
+	return s.config.Now()
+}
+
+func (s *Store) afterFunc(d time.Duration, f func()) func() bool {
+	return s.config.AfterFunc(d, f)
+}
+
+func (s *Store) location() string {
+	if l, ok := s.backend.(fmt.Stringer); ok {
+		return l.String()
+	}
+	return "custom backend"
+}
+
 func (s *Store) SaveToken(token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.saveToken(token, s.tokenTTL())
+}
+
+// SaveTokenWithExpiry saves a token whose lifetime is dictated by the server
+// rather than Config.TokenTTL.
+func (s *Store) SaveTokenWithExpiry(token string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ttl <= 0 {
+		return fmt.Errorf("%w %s", ErrInvalidTokenTTL, ttl)
+	}
+
+	return s.saveToken(token, ttl)
+}
+
+func (s *Store) saveToken(token string, ttl time.Duration) error {
+	if err := s.checkToken(token); err != nil {
+		return err
+	}
+
+	if err := s.updateScope(scopeToken, func() error { return s.setToken(token, ttl) }); err != nil {
+		return err
+	}
+
+	s.rearmWatchers()
+	return nil
+}
+
+func (s *Store) checkToken(token string) error {
 	if token == "" {
 		return ErrEmptyToken
 	}
 
-	s.AuthToken = token
-	s.CreatedAt = time.Now().Unix()
+	if problem := tokenProblem(token); problem != "" {
+		return fmt.Errorf("%w: %s", ErrInvalidToken, problem)
+	}
+
+	if s.creds.authToken != "" {
+		return fmt.Errorf("auth token is provided by systemd credentials: %w", ErrReadOnly)
+	}
+
+	return nil
+}
+
+// tokenProblem describes why token cannot be a real auth token, or returns
+// "" if it can.
+func tokenProblem(token string) string {
+	switch {
+	case strings.TrimSpace(token) == "":
+		return "token is blank"
+	case len(token) > maxTokenLength:
+		return fmt.Sprintf("token is %d bytes, limit %d", len(token), maxTokenLength)
+	case !utf8.ValidString(token):
+		return "token is not valid UTF-8"
+	}
+	return ""
+}
+
+// checkStoredToken reports a stored token that cannot be a real auth token.
+func (s *Store) checkStoredToken(token string) error {
+	if problem := tokenProblem(token); problem != "" {
+		return s.corrupt("auth_token", fmt.Errorf("%w: %s", ErrInvalidToken, problem))
+	}
+	return nil
+}
+
+// setToken stores token and its expiry in memory without saving.
+func (s *Store) setToken(token string, ttl time.Duration) error {
+	now := s.now()
+	s.TokenDevice = ""
+	s.persisted.CreatedAt = now.Unix()
+	s.ExpiresAt = now.Add(ttl).Unix()
 
-	return s.save()
+	if s.config.DeviceBound {
+		if err := s.bindToken(token); err != nil {
+			return err
+		}
+	} else if err := s.setAuthToken(token); err != nil {
+		return err
+	}
+	return s.attestToken(token)
 }
 
+// LoadToken returns the stored auth token. With Config.BindTokenToKey, a
+// token whose attestation no longer matches the primary key, as after
+// re-keying, is returned but logged as a warning.
 func (s *Store) LoadToken() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, err := s.loadToken()
+	if err != nil {
+		return "", err
+	}
+	s.warnTokenAttestation(token)
+	return token, nil
+}
+
+// warnTokenAttestation logs an invalid attestation under
+// Config.BindTokenToKey.
+func (s *Store) warnTokenAttestation(token string) {
+	if s.config.BindTokenToKey && s.creds.authToken == "" {
+		if err := s.checkTokenAttestation(token); err != nil {
+			s.config.Logger.Warn("keystore: token attestation is invalid", "location", s.location(), "error", err)
+		}
+	}
+}
+
+func (s *Store) loadToken() (string, error) {
+	return s.loadTokenWithin(0)
+}
+
+// loadTokenWithin returns the stored token unless it expired more than
+// grace ago.
+func (s *Store) loadTokenWithin(grace time.Duration) (string, error) {
+	if _, err := s.injectFault(FaultOpLoadToken); err != nil {
+		return "", err
+	}
+
+	if s.creds.authToken != "" {
+		return s.creds.authToken, nil
+	}
+
 	if err := s.load(); err != nil {
 		return "", err
 	}
 
-	if s.AuthToken == "" {
-		return "", ErrInvalidToken
+	if s.persisted.AuthToken == "" && s.EncryptedToken == nil {
+		return "", ErrNoToken
 	}
 
-	if time.Now().Unix()-s.CreatedAt > int64(TokenExpiryDuration.Seconds()) {
+	if s.tokenState(grace) == TokenExpired {
+		s.countExpiryRejection()
 		return "", ErrTokenExpired
 	}
 
-	return s.AuthToken, nil
+	token, err := s.authToken()
+	if err != nil {
+		return "", err
+	}
+
+	if s.TokenDevice != "" {
+		if token, err = s.unbindToken(token); err != nil {
+			return "", err
+		}
+	}
+
+	if err := s.checkStoredToken(token); err != nil {
+		return "", err
+	}
+	return token, nil
 }
 
-func (s *Store) SavePrivateKey(privateKeyHex string) error {
-	if _, err := crypto.HexToECDSA(privateKeyHex); err != nil {
-		return fmt.Errorf("invalid private key format: %w", err)
+// TokenCreatedAt returns when the stored token was saved. Tokens sourced
+// from systemd credentials report the zero time.
+func (s *Store) TokenCreatedAt() (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.creds.authToken != "" {
+		return time.Time{}, nil
+	}
+
+	if err := s.load(); err != nil {
+		return time.Time{}, err
+	}
+
+	if s.persisted.AuthToken == "" && s.EncryptedToken == nil {
+		return time.Time{}, ErrNoToken
 	}
 
-	s.PrivateKey = privateKeyHex
-	return s.save()
+	return time.Unix(s.persisted.CreatedAt, 0), nil
 }
 
-func (s *Store) LoadPrivateKey() (*ecdsa.PrivateKey, error) {
+// TokenExpiresAt returns when the stored token expires. Tokens sourced from
+// systemd credentials never expire and report the zero time.
+func (s *Store) TokenExpiresAt() (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.creds.authToken != "" {
+		return time.Time{}, nil
+	}
+
 	if err := s.load(); err != nil {
+		return time.Time{}, err
+	}
+
+	if s.persisted.AuthToken == "" && s.EncryptedToken == nil {
+		return time.Time{}, ErrNoToken
+	}
+
+	return time.Unix(s.ExpiresAt, 0), nil
+}
+
+func (s *Store) tokenTTL() time.Duration {
+	if s.config.TokenTTL > 0 {
+		return s.config.TokenTTL
+	}
+	return TokenExpiryDuration
+}
+
+func (s *Store) skewTolerance() time.Duration {
+	switch {
+	case s.config.ClockSkewTolerance < 0:
+		return 0
+	case s.config.ClockSkewTolerance == 0:
+		return DefaultClockSkewTolerance
+	default:
+		return s.config.ClockSkewTolerance
+	}
+}
+
+// tokenExpired reports whether the stored token is past its expiry. A token
+// saved in the future, as seen by a machine whose clock is behind, is valid
+// as long as it is within the skew tolerance.
+func (s *Store) tokenExpired() bool {
+	return s.tokenExpiredAt(s.persisted.CreatedAt, s.ExpiresAt)
+}
+
+func (s *Store) tokenExpiredAt(createdAt, expiresAt int64) bool {
+	now := s.now()
+	tolerance := s.skewTolerance()
+
+	if time.Unix(createdAt, 0).After(now.Add(tolerance)) {
+		return true
+	}
+
+	return now.After(time.Unix(expiresAt, 0).Add(tolerance))
+}
+
+func (s *Store) SavePrivateKey(privateKeyHex string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, err := s.checkPrivateKey(privateKeyHex)
+	if err != nil {
+		return err
+	}
+
+	return s.updateScope(scopeKey, func() error {
+		return s.setPrimaryKey(privateKeyHex, key, s.newProvenance(ProvenanceHex, ""))
+	})
+}
+
+// setPrimaryKey replaces the primary key in memory along with its public
+// data. Chain metadata is dropped and p recorded as the provenance when the
+// key changes.
+func (s *Store) setPrimaryKey(privateKeyHex string, key *ecdsa.PrivateKey, p *Provenance) error {
+	if err := s.checkTestKey(key); err != nil {
+		return err
+	}
+	if err := s.setPrivateKey(privateKeyHex); err != nil {
+		return err
+	}
+
+	if s.Address != crypto.PubkeyToAddress(key.PublicKey).Hex() {
+		s.ChainID = ""
+		s.NetworkName = ""
+		s.UseCount = 0
+		s.LastUsedAt = 0
+		s.Provenance = p
+		s.KeyPurpose = ""
+	} else if s.Provenance == nil {
+		s.Provenance = p
+	}
+	s.KeyCurve = ""
+	s.setPublicData(key)
+	return s.escrowKey(privateKeyHex)
+}
+
+// checkPrivateKey validates a key about to become the primary key.
+func (s *Store) checkPrivateKey(privateKeyHex string) (*ecdsa.PrivateKey, error) {
+	if err := s.checkKeySource(); err != nil {
+		return nil, err
+	}
+
+	key, err := parsePrivateKeyHex(privateKeyHex)
+	if err != nil {
 		return nil, err
 	}
 
-	if s.PrivateKey == "" {
-		return nil, ErrNoPrivateKey
+	if err := s.checkExpectedAddress(key); err != nil {
+		return nil, err
 	}
 
-	return crypto.HexToECDSA(s.PrivateKey)
+	return key, nil
 }
 
-func (s *Store) GetPrivateKeyHex() (string, error) {
-	if err := s.load(); err != nil {
+// checkKeySource fails when the primary key comes from a read-only source.
+func (s *Store) checkKeySource() error {
+	switch s.creds.keySource {
+	case keySourceEnv:
+		return fmt.Errorf("%w: environment variable %s", ErrReadOnlyKeySource, s.config.KeyFromEnv)
+	case keySourceCredential:
+		return fmt.Errorf("private key is provided by systemd credentials: %w", ErrReadOnly)
+	}
+	return nil
+}
+
+func (s *Store) LoadPrivateKey() (key *ecdsa.PrivateKey, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer func() { s.audit(AuditKeyAccess, "", err) }()
+
+	if err := s.authorized(AuthLoadPrivateKey); err != nil {
+		return nil, err
+	}
+
+	key, _, err = s.primaryKey()
+	return key, err
+}
+
+func (s *Store) GetPrivateKeyHex() (privateKeyHex string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer func() { s.audit(AuditKeyAccess, "", err) }()
+
+	if err := s.authorized(AuthGetPrivateKeyHex); err != nil {
 		return "", err
 	}
 
-	if s.PrivateKey == "" {
-		return "", ErrNoPrivateKey
+	_, privateKeyHex, err = s.primaryKey()
+	return privateKeyHex, err
+}
+
+// Destroy removes the persisted keystore and wipes the in-memory state.
+// For ephemeral keystores this only wipes memory.
+func (s *Store) Destroy() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.reset()
+	s.unlocked = nil
+	s.cache = nil
+	s.writtenRev = 0
+
+	if err := s.backend.Remove(); err != nil {
+		return fmt.Errorf("failed to remove keystore: %w", err)
 	}
+	s.bumpGeneration()
 
-	return s.PrivateKey, nil
+	if path, ok := s.publicCachePath(); ok {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove public cache: %w", err)
+		}
+	}
+
+	if path := s.config.MirrorPath; path != "" {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove mirror: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// reset clears all persisted fields so a load starts from a clean slate.
+func (s *Store) reset() {
+	s.Format = nil
+	s.Version = 0
+	s.Rev = 0
+	s.persisted.AuthToken = ""
+	s.persisted.PrivateKey = ""
+	s.Address = ""
+	s.PublicKey = ""
+	s.KeyCurve = ""
+	s.KeyPurpose = ""
+	s.ChainID = ""
+	s.NetworkName = ""
+	s.persisted.CreatedAt = 0
+	s.ExpiresAt = 0
+	s.SavedAt = 0
+	s.TokenDevice = ""
+	s.TokenSalt = ""
+	s.EncryptedKey = nil
+	s.EncryptedToken = nil
+	s.TokenBinding = nil
+	s.Accounts = nil
+	s.Trash = nil
+	s.DefaultAccount = ""
+	s.EncryptionAccount = ""
+	s.URLTokens = nil
+	s.Secrets = nil
+	s.SSHKey = ""
+	s.EncryptedSSHKey = nil
+	s.SSHPublicKey = ""
+	s.KeyShares = nil
+	s.Escrow = nil
+	s.External = nil
+	s.Sealed = nil
+	s.Manifest = nil
+	s.MnemonicBackedUpAt = 0
+	s.Provenance = nil
+	s.Provisioning = nil
+	s.Frozen = nil
+	s.SigningLease = nil
+	s.LeaseFence = 0
+	s.UseCount = 0
+	s.LastUsedAt = 0
+	s.Policy = nil
+	s.PolicyUsage = nil
+	s.exposeDeprecated()
 }
 
-func (s *Store) save() error {
-	data, err := json.MarshalIndent(s, "", "  ")
+// exposeDeprecated copies the persisted fields to the deprecated exported
+// fields that shadow them, so code still reading those sees current values,
+// and refreshes the redacted description String reports.
+func (s *Store) exposeDeprecated() {
+	s.AuthToken = s.persisted.AuthToken
+	s.PrivateKey = s.persisted.PrivateKey
+	s.CreatedAt = s.persisted.CreatedAt
+	s.refreshRedaction()
+}
+
+func (s *Store) save() (err error) {
+	defer func() { s.audit(AuditSave, "", err) }()
+
+	if _, err := s.injectFault(FaultOpSave); err != nil {
+		return err
+	}
+
+	if s.config.RequireEncryption && s.hasPlaintextKey() {
+		return fmt.Errorf("%w: refusing to write an unencrypted private key", ErrEncryptionRequired)
+	}
+
+	if err := s.checkReadOnly(); err != nil {
+		return err
+	}
+
+	if s.config.PrunePolicy != nil {
+		s.prune(*s.config.PrunePolicy, true)
+	}
+
+	s.syncEscrow()
+
+	s.cache = nil
+	s.Format = s.documentFormat()
+	s.Version = SchemaVersion
+	if s.scope != scopeKey {
+		// Key-only writes leave the token file, which holds these, alone.
+		rev, savedAt := s.Rev, s.SavedAt
+		defer func() {
+			if err != nil {
+				// Nothing was written, so the revision was not used.
+				s.Rev, s.SavedAt = rev, savedAt
+			}
+		}()
+		s.Rev++
+		s.SavedAt = s.now().Unix()
+	}
+
+	data, err := s.marshal()
 	if err != nil {
-		return fmt.Errorf("failed to marshal keystore: %w", err)
+		return err
 	}
 
-	if err := os.WriteFile(s.path(), data, DefaultFileMode); err != nil {
+	if data, err = s.applyManifestPolicy(data); err != nil {
+		return err
+	}
+
+	if data, err = s.encodeDocument(data); err != nil {
+		return err
+	}
+
+	if s.config.OpenPGP != nil && !s.skipOpenPGP {
+		if data, err = s.pgpEncrypt(data); err != nil {
+			return err
+		}
+		data = append(fileHeader(FormatPGP), data...)
+	}
+
+	if data, err = s.encodeTransforms(data); err != nil {
+		return err
+	}
+
+	if err := s.checkFileSize(data); err != nil {
+		return err
+	}
+
+	if s.backupsEnabled() {
+		if err := s.backupCurrent(); err != nil {
+			return err
+		}
+	}
+
+	if err := s.writeBackend(data); err != nil {
+		if roErr := s.noteReadOnly(err); roErr != nil {
+			return roErr
+		}
 		return fmt.Errorf("failed to write keystore file: %w", err)
 	}
+	s.writtenRev = s.Rev
+	s.fromMirror = false
+	s.writeMirror(data)
+
+	if s.backupsEnabled() {
+		s.pruneBackups()
+	}
+
+	s.exposeDeprecated()
+	s.noteFileSize(int64(len(data)), true)
+	s.syncPublicCache(data)
+	return nil
+}
+
+// marshal encodes s in the canonical form described at Canonicalize.
+func (s *Store) marshal() ([]byte, error) {
+	data, err := json.Marshal((*storeJSON)(s))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal keystore: %w", err)
+	}
+	defer wipe(data)
+
+	doc, err := decodeDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = canonicalDocument(doc); err != nil {
+		return nil, fmt.Errorf("failed to marshal keystore: %w", err)
+	}
+	return data, nil
+}
+
+func (s *Store) maxFileSize() int64 {
+	if s.config.MaxFileSize > 0 {
+		return s.config.MaxFileSize
+	}
+	return DefaultMaxFileSize
+}
+
+// decode parses a keystore document into s, rejecting trailing data and,
+// with StrictParse, unknown fields.
+func (s *Store) decode(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if s.config.StrictParse {
+		dec.DisallowUnknownFields()
+	}
+
+	if err := dec.Decode(s); err != nil {
+		return err
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("unexpected data after keystore document")
+	}
 
 	return nil
 }
 
-func (s *Store) load() error {
-	data, err := os.ReadFile(s.path())
+func isNoKeystore(err error) bool {
+	return errors.Is(err, ErrNoKeystore)
+}
+
+func (s *Store) load() (err error) {
+	defer func() { s.audit(AuditLoad, "", err) }()
+
+	for attempt := 1; ; attempt++ {
+		if err := s.loadOnce(); err != nil || !s.staleRead() {
+			return err
+		}
+		if attempt == staleReadAttempts {
+			return s.staleReadError()
+		}
+		time.Sleep(staleReadDelay)
+	}
+}
+
+// loadOnce reads the backend once, falling back to the mirror.
+func (s *Store) loadOnce() error {
+	if f, err := s.injectFault(FaultOpLoad); err != nil {
+		return err
+	} else if f.Stale && !s.loadedAt.IsZero() {
+		return nil
+	}
+
+	data, err := s.readBackend()
 	if err != nil {
-		if os.IsNotExist(err) {
-			return fmt.Errorf("%w at %s", ErrNoKeystore, s.path())
+		if errors.Is(err, fs.ErrNotExist) {
+			if s.loadMirror(err) {
+				return nil
+			}
+			if s.config.ImportLegacy {
+				return s.autoImportLegacy()
+			}
+			return fmt.Errorf("%w at %s", ErrNoKeystore, s.location())
 		}
 		return fmt.Errorf("failed to read keystore: %w", err)
 	}
 
-	if err := json.Unmarshal(data, s); err != nil {
-		return fmt.Errorf("failed to parse keystore: %w", err)
+	if err := s.loadDocument(data); err != nil {
+		if errors.Is(err, ErrCorruptKeystore) && s.loadMirror(err) {
+			return nil
+		}
+		return err
+	}
+
+	s.fromMirror = false
+	s.loadedAt = s.now()
+	s.noteFileSize(int64(len(data)), false)
+	s.syncPublicCache(data)
+	return nil
+}
+
+// loadDocument replaces the in-memory state with the persisted document
+// data, decrypting, verifying and migrating it as needed.
+func (s *Store) loadDocument(data []byte) error {
+	header, data, err := splitHeader(data)
+	if err != nil {
+		return err
+	}
+
+	if data, err = s.decodeTransforms(header, data); err != nil {
+		return err
+	}
+
+	if isPGPMessage(data) {
+		if data, err = s.pgpDecrypt(data); err != nil {
+			return err
+		}
 	}
 
+	if data, err = s.documentJSON(data); err != nil {
+		return err
+	}
+
+	if err := s.checkManifest(data); err != nil {
+		return err
+	}
+
+	s.reset()
+	if err := s.decode(data); err != nil {
+		return s.corrupt("", err)
+	}
+
+	if s.Format != nil {
+		if err := s.Format.check(); err != nil {
+			return err
+		}
+	}
+	s.fileFormat = header
+	if header == nil {
+		s.fileFormat = s.Format
+	}
+
+	if err := s.migrate(); err != nil {
+		return err
+	}
+	s.exposeDeprecated()
 	return nil
 }
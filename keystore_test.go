@@ -0,0 +1,505 @@
+package keystore_test
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/theblitlabs/keystore"
+	"github.com/theblitlabs/keystore/keystoretest"
+)
+
+func TestFileBackendConformance(t *testing.T) {
+	keystoretest.RunStoreConformanceTests(t, func() keystore.Backend {
+		return keystore.NewFileBackend(filepath.Join(t.TempDir(), keystore.DefaultFileName))
+	})
+}
+
+func TestMemoryBackendConformance(t *testing.T) {
+	keystoretest.RunStoreConformanceTests(t, func() keystore.Backend {
+		return keystore.NewMemoryBackend()
+	})
+}
+
+func TestGoldenFixtures(t *testing.T) {
+	keystoretest.RunGoldenFixtureTests(t)
+}
+
+// testClock is a settable time source for Config.Now and Config.AfterFunc.
+// Timers fire when Set or Advance move the clock past their deadline.
+type testClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*testTimer
+}
+
+type testTimer struct {
+	at time.Time
+	f  func()
+}
+
+func newTestClock(t time.Time) *testClock {
+	return &testClock{now: t}
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *testClock) AfterFunc(d time.Duration, f func()) func() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tt := &testTimer{at: c.now.Add(d), f: f}
+	c.timers = append(c.timers, tt)
+	return func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		for i, other := range c.timers {
+			if other == tt {
+				c.timers = append(c.timers[:i], c.timers[i+1:]...)
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Pending reports how many timers have not fired or been stopped.
+func (c *testClock) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.timers)
+}
+
+func (c *testClock) Set(t time.Time) {
+	c.mu.Lock()
+	c.now = t
+	var due []*testTimer
+	pending := c.timers[:0]
+	for _, tt := range c.timers {
+		if tt.at.After(t) {
+			pending = append(pending, tt)
+		} else {
+			due = append(due, tt)
+		}
+	}
+	c.timers = pending
+	c.mu.Unlock()
+
+	for _, tt := range due {
+		tt.f()
+	}
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// config returns cfg with its clock set to c.
+func (c *testClock) config(cfg keystore.Config) keystore.Config {
+	cfg.Now = c.Now
+	cfg.AfterFunc = c.AfterFunc
+	return cfg
+}
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestTokenExpiryBoundaries(t *testing.T) {
+	const ttl = time.Hour
+	skew := keystore.DefaultClockSkewTolerance
+
+	cases := []struct {
+		name    string
+		skew    time.Duration
+		savedAt time.Time
+		loadAt  time.Time
+		expired bool
+	}{
+		{name: "fresh", savedAt: epoch, loadAt: epoch},
+		{name: "expires exactly now without skew", skew: -1, savedAt: epoch, loadAt: epoch.Add(ttl)},
+		{name: "one second past expiry without skew", skew: -1, savedAt: epoch, loadAt: epoch.Add(ttl + time.Second), expired: true},
+		{name: "expires exactly now with skew", savedAt: epoch, loadAt: epoch.Add(ttl)},
+		{name: "past expiry by exactly the skew", savedAt: epoch, loadAt: epoch.Add(ttl + skew)},
+		{name: "past expiry beyond the skew", savedAt: epoch, loadAt: epoch.Add(ttl + skew + time.Second), expired: true},
+		{name: "custom skew boundary", skew: 10 * time.Second, savedAt: epoch, loadAt: epoch.Add(ttl + 10*time.Second)},
+		{name: "custom skew exceeded", skew: 10 * time.Second, savedAt: epoch, loadAt: epoch.Add(ttl + 11*time.Second), expired: true},
+		{name: "created in the future within the skew", savedAt: epoch.Add(skew), loadAt: epoch},
+		{name: "created in the future beyond the skew", savedAt: epoch.Add(skew + time.Second), loadAt: epoch, expired: true},
+		{name: "created in the future without skew", skew: -1, savedAt: epoch.Add(time.Second), loadAt: epoch, expired: true},
+		{name: "created far in the future", savedAt: epoch.Add(100 * 365 * 24 * time.Hour), loadAt: epoch, expired: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			clock := newTestClock(c.savedAt)
+			cfg := keystore.Config{DirPath: dir, TokenTTL: ttl, ClockSkewTolerance: c.skew, Now: clock.Now}
+
+			saver, err := keystore.NewKeystore(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := saver.SaveToken("token"); err != nil {
+				t.Fatal(err)
+			}
+
+			clock.Set(c.loadAt)
+			loader, err := keystore.NewKeystore(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = loader.LoadToken()
+			if c.expired && !errors.Is(err, keystore.ErrTokenExpired) {
+				t.Errorf("LoadToken: got %v, want ErrTokenExpired", err)
+			}
+			if !c.expired && err != nil {
+				t.Errorf("LoadToken: %v", err)
+			}
+		})
+	}
+}
+
+func mustKey(t *testing.T, keyHex string) *ecdsa.PrivateKey {
+	t.Helper()
+
+	key, err := crypto.HexToECDSA(keyHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestAccessorErrors(t *testing.T) {
+	type accessor struct {
+		name string
+		run  func(ks *keystore.Store) error
+	}
+	tokenAccessors := []accessor{
+		{"LoadToken", func(ks *keystore.Store) error { _, err := ks.LoadToken(); return err }},
+		{"TokenDigest", func(ks *keystore.Store) error { _, err := ks.TokenDigest(); return err }},
+	}
+	keyAccessors := []accessor{
+		{"LoadPrivateKey", func(ks *keystore.Store) error { _, err := ks.LoadPrivateKey(); return err }},
+		{"PrivateKeyBytes", func(ks *keystore.Store) error { _, err := ks.PrivateKeyBytes(); return err }},
+	}
+	accountAccessors := []accessor{
+		{"LoadAccountKey", func(ks *keystore.Store) error { _, err := ks.LoadAccountKey("ops"); return err }},
+	}
+
+	// Each field is removed, or replaced by each of its garbage values, in
+	// a keystore that otherwise holds a token, a primary key and an account.
+	fields := []struct {
+		field     string
+		accessors []accessor
+		missing   error
+		garbage   []any
+		malformed error
+	}{
+		{
+			field:     "auth_token",
+			accessors: tokenAccessors,
+			missing:   keystore.ErrNoToken,
+			garbage:   []any{"   ", strings.Repeat("t", 64<<10+1)},
+			malformed: keystore.ErrInvalidToken,
+		},
+		{
+			field:     "private_key",
+			accessors: keyAccessors,
+			missing:   keystore.ErrNoPrivateKey,
+			garbage:   []any{strings.Repeat("zz", 32), "abcd"},
+			malformed: keystore.ErrInvalidStoredKey,
+		},
+		{
+			field:     "accounts.ops.private_key",
+			accessors: accountAccessors,
+			missing:   keystore.ErrNoPrivateKey,
+			garbage:   []any{strings.Repeat("zz", 32), "abcd"},
+			malformed: keystore.ErrInvalidStoredKey,
+		},
+	}
+
+	newStore := func(t *testing.T) (*keystore.Store, string) {
+		dir := t.TempDir()
+		ks := newErrorStore(t, keystore.Config{DirPath: dir})
+		if err := ks.SaveToken("token"); err != nil {
+			t.Fatal(err)
+		}
+		if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+			t.Fatal(err)
+		}
+		if err := ks.SaveAccount("ops", credentialKeyHex); err != nil {
+			t.Fatal(err)
+		}
+		return ks, dir
+	}
+	// edit sets the dotted field path to value, or deletes it for nil.
+	edit := func(t *testing.T, dir, field string, value any) {
+		editKeystore(t, dir, func(doc map[string]any) {
+			path := strings.Split(field, ".")
+			for _, p := range path[:len(path)-1] {
+				doc = doc[p].(map[string]any)
+			}
+			if value == nil {
+				delete(doc, path[len(path)-1])
+			} else {
+				doc[path[len(path)-1]] = value
+			}
+		})
+	}
+	check := func(t *testing.T, a accessor, ks *keystore.Store, want ...error) {
+		t.Helper()
+		err := a.run(ks)
+		for _, w := range want {
+			if !errors.Is(err, w) {
+				t.Errorf("%s: got %v, want %v", a.name, err, w)
+			}
+		}
+	}
+
+	for _, f := range fields {
+		for _, a := range f.accessors {
+			t.Run(a.name+"/file missing", func(t *testing.T) {
+				check(t, a, newErrorStore(t, keystore.Config{}), keystore.ErrNoKeystore)
+			})
+
+			t.Run(a.name+"/field missing", func(t *testing.T) {
+				_, dir := newStore(t)
+				edit(t, dir, f.field, nil)
+				ks := newErrorStore(t, keystore.Config{DirPath: dir})
+				check(t, a, ks, f.missing)
+				if err := a.run(ks); errors.Is(err, keystore.ErrCorruptKeystore) || errors.Is(err, f.malformed) {
+					t.Errorf("%s: a missing field reported as malformed: %v", a.name, err)
+				}
+			})
+
+			for i, garbage := range f.garbage {
+				t.Run(fmt.Sprintf("%s/field garbage %d", a.name, i), func(t *testing.T) {
+					_, dir := newStore(t)
+					edit(t, dir, f.field, garbage)
+					ks := newErrorStore(t, keystore.Config{DirPath: dir})
+					check(t, a, ks, f.malformed, keystore.ErrCorruptKeystore)
+					if err := a.run(ks); errors.Is(err, f.missing) {
+						t.Errorf("%s: a malformed field reported as missing: %v", a.name, err)
+					}
+				})
+			}
+		}
+	}
+
+	// The token metadata accessors tell a missing token apart without
+	// reading the token itself.
+	t.Run("TokenExpiresAt", func(t *testing.T) {
+		if _, err := newErrorStore(t, keystore.Config{}).TokenExpiresAt(); !errors.Is(err, keystore.ErrNoKeystore) {
+			t.Errorf("file missing: got %v, want ErrNoKeystore", err)
+		}
+		_, dir := newStore(t)
+		edit(t, dir, "auth_token", nil)
+		if _, err := newErrorStore(t, keystore.Config{DirPath: dir}).TokenExpiresAt(); !errors.Is(err, keystore.ErrNoToken) {
+			t.Errorf("field missing: got %v, want ErrNoToken", err)
+		}
+	})
+}
+
+// TestDeprecatedFieldsIgnored guards the migration away from the exported
+// AuthToken, PrivateKey and CreatedAt fields: writing them no longer
+// changes what is saved, and they only mirror the stored values.
+func TestDeprecatedFieldsIgnored(t *testing.T) {
+	dir := t.TempDir()
+	clock := newTestClock(epoch)
+	cfg := clock.config(keystore.Config{DirPath: dir, Logger: discardLogger})
+
+	ks, err := keystore.NewKeystore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveToken("token"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if ks.AuthToken != "token" || ks.PrivateKey != fileKeyHex || ks.CreatedAt != epoch.Unix() {
+		t.Fatalf("deprecated fields after saving = %q, %q, %d", ks.AuthToken, ks.PrivateKey, ks.CreatedAt)
+	}
+
+	ks.AuthToken = "injected"
+	ks.PrivateKey = envKeyHex
+	ks.CreatedAt = 1
+	if key, err := ks.LoadPrivateKey(); err != nil || hexKey(key) != fileKeyHex {
+		t.Fatalf("LoadPrivateKey read the written field: %v", err)
+	}
+	if err := ks.SaveWatchAddress("cold", crypto.PubkeyToAddress(mustKey(t, credentialKeyHex).PublicKey)); err != nil {
+		t.Fatal(err)
+	}
+	if ks.AuthToken != "token" || ks.PrivateKey != fileKeyHex || ks.CreatedAt != epoch.Unix() {
+		t.Fatalf("a save kept the written deprecated fields: %q, %q, %d", ks.AuthToken, ks.PrivateKey, ks.CreatedAt)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, keystore.DefaultFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "injected") || strings.Contains(string(data), envKeyHex) {
+		t.Fatalf("deprecated field writes reached the file: %s", data)
+	}
+
+	reopened, err := keystore.NewKeystore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token, err := reopened.LoadToken(); err != nil || token != "token" {
+		t.Fatalf("LoadToken = %q, %v, want token", token, err)
+	}
+	if key, err := reopened.LoadPrivateKey(); err != nil || hexKey(key) != fileKeyHex {
+		t.Fatalf("LoadPrivateKey: %v", err)
+	}
+	if created, err := reopened.TokenCreatedAt(); err != nil || !created.Equal(epoch) {
+		t.Fatalf("TokenCreatedAt = %v, %v, want %v", created, err, epoch)
+	}
+
+	// Accessors on the Store whose fields were written ignore them too.
+	if token, err := ks.LoadToken(); err != nil || token != "token" {
+		t.Fatalf("LoadToken on the written Store = %q, %v", token, err)
+	}
+}
+
+func TestStrictParse(t *testing.T) {
+	dir := t.TempDir()
+	if err := newErrorStore(t, keystore.Config{DirPath: dir}).SaveToken("token"); err != nil {
+		t.Fatal(err)
+	}
+	strict := keystore.Config{DirPath: dir, StrictParse: true}
+	if token, err := newErrorStore(t, strict).LoadToken(); err != nil || token != "token" {
+		t.Fatalf("strict LoadToken of a clean file = %q, %v", token, err)
+	}
+
+	// A misspelt field, at the top level or nested, is named in the error.
+	for _, tt := range []struct {
+		field string
+		edit  func(doc map[string]any)
+	}{
+		{"auth_tokn", func(doc map[string]any) { doc["auth_tokn"] = "typo" }},
+		{"labelz", func(doc map[string]any) {
+			doc["accounts"] = map[string]any{"cold": map[string]any{"address": dumpWatchAddress.Hex(), "watch_only": true, "labelz": map[string]any{}}}
+		}},
+	} {
+		editKeystore(t, dir, tt.edit)
+		_, err := newErrorStore(t, strict).LoadToken()
+		if !errors.Is(err, keystore.ErrCorruptKeystore) || !strings.Contains(err.Error(), tt.field) {
+			t.Fatalf("strict LoadToken with %s: got %v, want ErrCorruptKeystore naming it", tt.field, err)
+		}
+		// Without StrictParse, as for files from newer releases, it is ignored.
+		if token, err := newErrorStore(t, keystore.Config{DirPath: dir}).LoadToken(); err != nil || token != "token" {
+			t.Fatalf("LoadToken with %s = %q, %v", tt.field, token, err)
+		}
+		editKeystore(t, dir, func(doc map[string]any) {
+			delete(doc, "auth_tokn")
+			delete(doc, "accounts")
+		})
+	}
+
+	// Trailing garbage is rejected with or without StrictParse.
+	path := filepath.Join(dir, keystore.DefaultFileName)
+	clean, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, trailer := range []string{"garbage", `{"auth_token":"other"}`, "}", "\x00"} {
+		if err := os.WriteFile(path, append(append([]byte(nil), clean...), trailer...), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		for _, cfg := range []keystore.Config{strict, {DirPath: dir}} {
+			if _, err := newErrorStore(t, cfg).LoadToken(); !errors.Is(err, keystore.ErrCorruptKeystore) {
+				t.Fatalf("LoadToken with %q appended (strict %v): got %v, want ErrCorruptKeystore", trailer, cfg.StrictParse, err)
+			}
+		}
+	}
+	// Trailing whitespace is not garbage.
+	if err := os.WriteFile(path, append(clean, "\n\n  \t"...), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if token, err := newErrorStore(t, strict).LoadToken(); err != nil || token != "token" {
+		t.Fatalf("strict LoadToken with trailing whitespace = %q, %v", token, err)
+	}
+}
+
+func TestEphemeral(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	missing := filepath.Join(t.TempDir(), "never", "created")
+
+	for name, open := range map[string]func(keystore.Config) (*keystore.Store, error){
+		"NewKeystore": keystore.NewKeystore,
+		"Open":        keystore.Open,
+	} {
+		for _, dir := range []string{"", missing} {
+			ks, err := open(keystore.Config{Ephemeral: true, DirPath: dir, Logger: discardLogger})
+			if err != nil {
+				t.Fatalf("%s(%q): %v", name, dir, err)
+			}
+			if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+				t.Fatal(err)
+			}
+			if err := ks.SaveAccount("ops", credentialKeyHex); err != nil {
+				t.Fatal(err)
+			}
+			if err := ks.SaveToken("token"); err != nil {
+				t.Fatal(err)
+			}
+			if token, err := ks.LoadToken(); err != nil || token != "token" {
+				t.Fatalf("%s(%q): LoadToken = %q, %v", name, dir, token, err)
+			}
+			if key, err := ks.LoadAccountKey("ops"); err != nil || hexKey(key) != credentialKeyHex {
+				t.Fatalf("%s(%q): LoadAccountKey: %v", name, dir, err)
+			}
+
+			// Another ephemeral Store on the same path starts empty.
+			other, err := open(keystore.Config{Ephemeral: true, DirPath: dir, Logger: discardLogger})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := other.LoadToken(); !errors.Is(err, keystore.ErrNoKeystore) {
+				t.Fatalf("%s(%q): LoadToken of another ephemeral Store: got %v, want ErrNoKeystore", name, dir, err)
+			}
+
+			if err := ks.Destroy(); err != nil {
+				t.Fatalf("Destroy: %v", err)
+			}
+			if _, err := ks.LoadToken(); !errors.Is(err, keystore.ErrNoKeystore) {
+				t.Fatalf("%s(%q): LoadToken after Destroy: got %v, want ErrNoKeystore", name, dir, err)
+			}
+		}
+	}
+
+	// Neither the home directory nor DirPath was touched.
+	if entries, err := os.ReadDir(home); err != nil || len(entries) != 0 {
+		t.Fatalf("the home directory holds %d entries, %v", len(entries), err)
+	}
+	if _, err := os.Stat(filepath.Dir(missing)); !os.IsNotExist(err) {
+		t.Fatalf("DirPath parent after ephemeral use: %v", err)
+	}
+
+	_, err := keystore.NewKeystore(keystore.Config{Ephemeral: true, MirrorPath: filepath.Join(home, "mirror.json")})
+	if !errors.Is(err, keystore.ErrInvalidConfig) {
+		t.Fatalf("NewKeystore with Ephemeral and MirrorPath: got %v, want ErrInvalidConfig", err)
+	}
+	_, err = keystore.NewKeystore(keystore.Config{Ephemeral: true, Backend: keystore.NewMemoryBackend()})
+	if !errors.Is(err, keystore.ErrInvalidConfig) {
+		t.Fatalf("NewKeystore with Ephemeral and a Backend: got %v, want ErrInvalidConfig", err)
+	}
+}
@@ -0,0 +1,125 @@
+package keystoretest
+
+import (
+	"embed"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/theblitlabs/keystore"
+)
+
+//go:embed testdata
+var testdata embed.FS
+
+// Fixtures holds the golden keystore files used by RunGoldenFixtureTests:
+// v1.json is a version 1 file, v2.* the current schema in each codec, plain
+// and encrypted, v2-split the split key and token files and v2.ksp a
+// portable string. Encrypted fixtures use the passphrase FixturePassphrase.
+// The *.canonical.json and canonical.json files hold the canonical form of
+// keystore files, which the package's own tests compare byte for byte.
+var Fixtures fs.FS
+
+// FixturePassphrase protects the encrypted fixtures.
+const FixturePassphrase = "conformance"
+
+// fixtureTime is when the fixtures were written; version 1 tokens, which
+// carry no expiry, are valid for keystore.TokenExpiryDuration after it.
+var fixtureTime = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func init() {
+	var err error
+	if Fixtures, err = fs.Sub(testdata, "testdata"); err != nil {
+		panic(err)
+	}
+}
+
+// RunGoldenFixtureTests loads every fixture with the current package and
+// checks its contents, then saves and reloads it to check that the file
+// survives a rewrite.
+func RunGoldenFixtureTests(t *testing.T) {
+	t.Helper()
+
+	cases := []struct {
+		name    string
+		version int
+		account bool
+		config  keystore.Config
+	}{
+		{name: "v1.json", version: 1},
+		{name: "v2.json", version: 2, account: true},
+		{name: "v2-encrypted.json", version: 2, account: true, config: keystore.Config{Passphrase: keystore.StaticPassphrase(FixturePassphrase), EncryptToken: true}},
+		{name: "v2.yaml", version: 2, account: true, config: keystore.Config{Codec: keystore.YAMLCodec{}}},
+		{name: "v2.toml", version: 2, account: true, config: keystore.Config{Codec: keystore.TOMLCodec{}}},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			data, err := fs.ReadFile(Fixtures, c.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			b := keystore.NewMemoryBackend()
+			mustDo(t, "Write", b.Write(data))
+
+			cfg := c.config
+			cfg.Backend = b
+			cfg.Now = func() time.Time { return fixtureTime.Add(time.Minute) }
+			s, err := keystore.NewKeystore(cfg)
+			if err != nil {
+				t.Fatalf("NewKeystore: %v", err)
+			}
+
+			status, err := s.Status()
+			if err != nil {
+				t.Fatalf("Status: %v", err)
+			}
+			if status.SchemaVersion != c.version {
+				t.Errorf("Status: schema version %d, want %d", status.SchemaVersion, c.version)
+			}
+			checkContents(t, s, c.account)
+
+			mustDo(t, "SaveToken", s.SaveToken(token))
+			reopened, err := keystore.NewKeystore(cfg)
+			if err != nil {
+				t.Fatalf("NewKeystore: %v", err)
+			}
+			checkContents(t, reopened, c.account)
+		})
+	}
+
+	t.Run("v2-split", func(t *testing.T) {
+		dir := t.TempDir()
+		for _, name := range []string{keystore.DefaultKeyFileName, keystore.DefaultTokenFileName} {
+			data, err := fs.ReadFile(Fixtures, "v2-split/"+name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			mustDo(t, "WriteFile", os.WriteFile(filepath.Join(dir, name), data, keystore.DefaultFileMode))
+		}
+
+		s, err := keystore.NewKeystore(keystore.Config{DirPath: dir, SplitFiles: true})
+		if err != nil {
+			t.Fatalf("NewKeystore: %v", err)
+		}
+		checkContents(t, s, true)
+	})
+
+	t.Run("v2.ksp", func(t *testing.T) {
+		data, err := fs.ReadFile(Fixtures, "v2.ksp")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s, err := keystore.NewKeystoreFromPortable(strings.TrimSpace(string(data)), FixturePassphrase)
+		if err != nil {
+			t.Fatalf("NewKeystoreFromPortable: %v", err)
+		}
+		checkContents(t, s, true)
+	})
+}
@@ -0,0 +1,145 @@
+package keystoretest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// HTTPServer is an in-memory keystore service implementing the contract
+// keystore.HTTPBackend relies on. Each keystore is a resource at
+// <any base path>/keystores/<node>: GET returns it with its ETag, HEAD checks for it, PUT
+// stores it and DELETE removes it. A PUT must carry If-Match with the
+// current ETag, or If-None-Match: * to create the resource, and fails with
+// 412 Precondition Failed otherwise. A missing resource is 404 and a
+// missing or wrong bearer token 401.
+type HTTPServer struct {
+	*httptest.Server
+
+	token string
+
+	mu       sync.Mutex
+	docs     map[string]httpDoc
+	version  int
+	faults   []int
+	requests int
+}
+
+type httpDoc struct {
+	data []byte
+	etag string
+}
+
+// NewHTTPServer starts an HTTPServer accepting requests with the bearer
+// token, or any request if token is empty. The caller must Close it.
+func NewHTTPServer(token string) *HTTPServer {
+	s := &HTTPServer{token: token, docs: make(map[string]httpDoc)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// FailNext makes the next n requests fail with status before they are
+// looked at, as a flaky service or one answering 403 or 409 would.
+func (s *HTTPServer) FailNext(status, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := 0; i < n; i++ {
+		s.faults = append(s.faults, status)
+	}
+}
+
+// Requests returns how many requests the server has received.
+func (s *HTTPServer) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests
+}
+
+// Document returns the stored keystore of node and whether it exists.
+func (s *HTTPServer) Document(node string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, ok := s.docs[node]
+	return doc.data, ok
+}
+
+func (s *HTTPServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests++
+	if len(s.faults) > 0 {
+		status := s.faults[0]
+		s.faults = s.faults[1:]
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	if s.token != "" && r.Header.Get("Authorization") != "Bearer "+s.token {
+		http.Error(w, "missing or invalid bearer token", http.StatusUnauthorized)
+		return
+	}
+
+	_, node, ok := strings.Cut(r.URL.Path, "/keystores/")
+	if !ok || node == "" || strings.Contains(node, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	doc, exists := s.docs[node]
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if !exists {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("ETag", doc.etag)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(doc.data)
+		}
+
+	case http.MethodPut:
+		match, noneMatch := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+		switch {
+		case noneMatch == "*" && exists,
+			match != "" && (!exists || match != doc.etag),
+			match == "" && noneMatch == "":
+			http.Error(w, "resource changed", http.StatusPreconditionFailed)
+			return
+		}
+
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.version++
+		s.docs[node] = httpDoc{data: data, etag: fmt.Sprintf(`"%d"`, s.version)}
+		w.Header().Set("ETag", s.docs[node].etag)
+		if exists {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusCreated)
+		}
+
+	case http.MethodDelete:
+		if !exists {
+			http.NotFound(w, r)
+			return
+		}
+		delete(s.docs, node)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, DELETE")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,235 @@
+// Package keystoretest checks that keystore storage behaves like the
+// built-in backends. RunStoreConformanceTests exercises the Store contract
+// against any Backend, and RunGoldenFixtureTests loads the embedded golden
+// files of every supported on-disk format and schema version.
+package keystoretest
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/theblitlabs/keystore"
+)
+
+const (
+	primaryKeyHex = "4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318"
+	primaryAddr   = "0x2c7536E3605D9C16a7a3D7b1898e529396a65c23"
+	accountKeyHex = "8da4ef21b864d2cc526dbdb2a120bd2874c36c9d0a1fb7f8c63d7f7a8b41de8f"
+	accountAddr   = "0x63FaC9201494f0bd17B9892B9fae4d52fe3BD377"
+	token         = "conformance-token"
+)
+
+// clock is a settable time source for Config.Now.
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newClock(t time.Time) *clock {
+	return &clock{now: t}
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+// RunStoreConformanceTests runs the Store contract against backends from
+// factory, which must return a new, empty backend on every call. Stores
+// sharing one backend must see each other's writes, as with the built-in
+// FileBackend and MemoryBackend.
+func RunStoreConformanceTests(t *testing.T, factory func() keystore.Backend) {
+	t.Helper()
+
+	open := func(t *testing.T, b keystore.Backend, c *clock) *keystore.Store {
+		t.Helper()
+		s, err := keystore.NewKeystore(keystore.Config{Backend: b, Now: c.Now})
+		if err != nil {
+			t.Fatalf("NewKeystore: %v", err)
+		}
+		return s
+	}
+
+	t.Run("Empty", func(t *testing.T) {
+		s := open(t, factory(), newClock(time.Now()))
+
+		if _, err := s.LoadPrivateKey(); !errors.Is(err, keystore.ErrNoKeystore) {
+			t.Errorf("LoadPrivateKey on empty backend: got %v, want ErrNoKeystore", err)
+		}
+		if _, err := s.LoadToken(); !errors.Is(err, keystore.ErrNoKeystore) {
+			t.Errorf("LoadToken on empty backend: got %v, want ErrNoKeystore", err)
+		}
+	})
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		b, c := factory(), newClock(time.Now())
+		s := open(t, b, c)
+
+		mustDo(t, "SavePrivateKey", s.SavePrivateKey(primaryKeyHex))
+		mustDo(t, "SaveAccount", s.SaveAccount("ops", accountKeyHex))
+		mustDo(t, "SaveToken", s.SaveToken(token))
+
+		checkContents(t, open(t, b, c), true)
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		c := newClock(time.Now())
+		s := open(t, factory(), c)
+
+		mustDo(t, "SaveTokenWithExpiry", s.SaveTokenWithExpiry(token, time.Minute))
+		if got, err := s.LoadToken(); err != nil || got != token {
+			t.Fatalf("LoadToken before expiry: got %q, %v", got, err)
+		}
+
+		c.Advance(time.Minute + keystore.DefaultClockSkewTolerance + time.Second)
+		if _, err := s.LoadToken(); !errors.Is(err, keystore.ErrTokenExpired) {
+			t.Errorf("LoadToken after expiry: got %v, want ErrTokenExpired", err)
+		}
+	})
+
+	t.Run("MergeOnSave", func(t *testing.T) {
+		b, c := factory(), newClock(time.Now())
+		first, second := open(t, b, c), open(t, b, c)
+
+		// second loads before first writes, so its copy is stale when it
+		// saves the token.
+		if _, err := second.LoadToken(); !errors.Is(err, keystore.ErrNoKeystore) {
+			t.Fatalf("LoadToken on empty backend: got %v, want ErrNoKeystore", err)
+		}
+		mustDo(t, "SavePrivateKey", first.SavePrivateKey(primaryKeyHex))
+		mustDo(t, "SaveToken", second.SaveToken(token))
+
+		for name, s := range map[string]*keystore.Store{"first": first, "second": second} {
+			if addr, err := s.GetAddress(); err != nil || addr.Hex() != primaryAddr {
+				t.Errorf("%s GetAddress: got %s, %v, want %s", name, addr.Hex(), err, primaryAddr)
+			}
+			if got, err := s.LoadToken(); err != nil || got != token {
+				t.Errorf("%s LoadToken: got %q, %v, want %q", name, got, err, token)
+			}
+		}
+	})
+
+	t.Run("Sentinels", func(t *testing.T) {
+		s := open(t, factory(), newClock(time.Now()))
+		mustDo(t, "SavePrivateKey", s.SavePrivateKey(primaryKeyHex))
+
+		checks := []struct {
+			op   string
+			err  error
+			want error
+		}{
+			{"SaveToken empty", s.SaveToken(""), keystore.ErrEmptyToken},
+			{"LoadToken without token", second(s.LoadToken()), keystore.ErrNoToken},
+			{"TokenExpiresAt without token", second(s.TokenExpiresAt()), keystore.ErrNoToken},
+			{"SaveToken blank", s.SaveToken(" \t"), keystore.ErrInvalidToken},
+			{"LoadAccountKey missing", second(s.LoadAccountKey("missing")), keystore.ErrAccountNotFound},
+			{"SaveAccount reserved name", s.SaveAccount("default", accountKeyHex), keystore.ErrInvalidAccountName},
+			{"SavePrivateKey invalid", s.SavePrivateKey("zz"), keystore.ErrInvalidPrivateKey},
+		}
+		for _, c := range checks {
+			if !errors.Is(c.err, c.want) {
+				t.Errorf("%s: got %v, want %v", c.op, c.err, c.want)
+			}
+		}
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		b, c := factory(), newClock(time.Now())
+		s := open(t, b, c)
+		mustDo(t, "SaveToken", s.SaveToken(token))
+
+		const workers = 8
+		keys := make([]string, workers)
+		for i := range keys {
+			key, err := crypto.GenerateKey()
+			if err != nil {
+				t.Fatalf("GenerateKey: %v", err)
+			}
+			keys[i] = fmt.Sprintf("%x", crypto.FromECDSA(key))
+		}
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 2*workers)
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if err := s.SaveAccount(fmt.Sprintf("worker-%d", i), keys[i]); err != nil {
+					errs <- err
+				}
+				if got, err := s.LoadToken(); err != nil || got != token {
+					errs <- fmt.Errorf("LoadToken: got %q, %v", got, err)
+				}
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Error(err)
+		}
+
+		accounts, err := open(t, b, c).ListAccounts()
+		if err != nil {
+			t.Fatalf("ListAccounts: %v", err)
+		}
+		if len(accounts) != workers {
+			t.Errorf("ListAccounts: got %d accounts, want %d", len(accounts), workers)
+		}
+	})
+}
+
+// checkContents verifies that s holds the primary key, the token and,
+// with account set, the ops account written by RoundTrip and the fixtures.
+func checkContents(t *testing.T, s *keystore.Store, account bool) {
+	t.Helper()
+
+	key, err := s.LoadPrivateKey()
+	if err != nil {
+		t.Fatalf("LoadPrivateKey: %v", err)
+	}
+	if got := fmt.Sprintf("%x", crypto.FromECDSA(key)); got != primaryKeyHex {
+		t.Errorf("LoadPrivateKey: got %s, want %s", got, primaryKeyHex)
+	}
+	if addr, err := s.GetAddress(); err != nil || addr.Hex() != primaryAddr {
+		t.Errorf("GetAddress: got %s, %v, want %s", addr.Hex(), err, primaryAddr)
+	}
+	if got, err := s.LoadToken(); err != nil || got != token {
+		t.Errorf("LoadToken: got %q, %v, want %q", got, err, token)
+	}
+
+	if !account {
+		return
+	}
+	key, err = s.LoadAccountKey("ops")
+	if err != nil {
+		t.Fatalf("LoadAccountKey: %v", err)
+	}
+	if addr := crypto.PubkeyToAddress(key.PublicKey).Hex(); addr != accountAddr {
+		t.Errorf("LoadAccountKey: key derives to %s, want %s", addr, accountAddr)
+	}
+}
+
+func mustDo(t *testing.T, op string, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %v", op, err)
+	}
+}
+
+// second returns the error of a two-value call.
+func second[T any](_ T, err error) error {
+	return err
+}
@@ -0,0 +1,165 @@
+package keystore
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Layout is how much of a keystore file is encrypted.
+type Layout string
+
+// Layouts reported in FormatInfo.Layout and accepted by ConvertLayout
+const (
+	// LayoutPlaintext stores every value in the clear.
+	LayoutPlaintext Layout = "plaintext"
+
+	// LayoutHybrid encrypts private keys with the passphrase and keeps the
+	// token and metadata in plaintext JSON, so saving and loading the
+	// token never derives a key.
+	LayoutHybrid Layout = "hybrid"
+
+	// LayoutEncrypted encrypts the whole file with Config.OpenPGP.
+	LayoutEncrypted Layout = "encrypted"
+)
+
+// ConvertLayout rewrites the keystore in layout, decrypting values that
+// are encrypted with passphrase:
+//
+//   - LayoutHybrid encrypts every private key with passphrase and stores
+//     tokens in plaintext.
+//   - LayoutPlaintext stores every key and token in plaintext.
+//   - LayoutEncrypted stores keys and tokens in plaintext inside a file
+//     encrypted with Config.OpenPGP, which must be set.
+//
+// Hybrid and plaintext files are written without OpenPGP even when
+// Config.OpenPGP is set, and it is used only to decrypt the current file.
+// Config is not changed: later saves follow it, so it should be updated
+// to match, for example by clearing EncryptToken and OpenPGP for the
+// hybrid layout. A key split into shares is left as it is. With
+// Config.RequireEncryption, layouts storing a plaintext key fail with
+// ErrEncryptionRequired.
+func (s *Store) ConvertLayout(layout Layout, passphrase string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch layout {
+	case LayoutHybrid:
+		if passphrase == "" {
+			return fmt.Errorf("%w: the hybrid layout needs one", ErrEmptyPassphrase)
+		}
+	case LayoutPlaintext:
+	case LayoutEncrypted:
+		if s.config.OpenPGP == nil {
+			return configError("OpenPGP", "the encrypted layout requires OpenPGP encryption")
+		}
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownLayout, layout)
+	}
+
+	s.skipOpenPGP = layout != LayoutEncrypted
+	defer func() { s.skipOpenPGP = false }()
+
+	return s.update(func() error {
+		seal := func(what, plain string, ev *EncryptedValue) (string, *EncryptedValue, error) {
+			value, err := openWith(passphrase, plain, ev)
+			if err != nil || value == "" {
+				return plain, ev, err
+			}
+			if layout != LayoutHybrid {
+				return value, nil, nil
+			}
+			ev, err = encryptValue(passphrase, []byte(value))
+			if err != nil {
+				return "", nil, fmt.Errorf("failed to encrypt %s: %w", what, err)
+			}
+			return "", ev, nil
+		}
+		var err error
+
+		if s.KeyShares == nil {
+			if s.persisted.PrivateKey, s.EncryptedKey, err = seal("private key", s.persisted.PrivateKey, s.EncryptedKey); err != nil {
+				return err
+			}
+		}
+		if s.SSHKey, s.EncryptedSSHKey, err = seal("SSH key", s.SSHKey, s.EncryptedSSHKey); err != nil {
+			return fmt.Errorf("SSH key: %w", err)
+		}
+		for _, accounts := range []map[string]*Account{s.Accounts, s.Trash} {
+			for name, account := range accounts {
+				if account.PrivateKey, account.EncryptedKey, err = seal("private key", account.PrivateKey, account.EncryptedKey); err != nil {
+					return fmt.Errorf("account %q: %w", name, err)
+				}
+			}
+		}
+
+		// Tokens are in plaintext in every layout.
+		if s.persisted.AuthToken, err = openWith(passphrase, s.persisted.AuthToken, s.EncryptedToken); err != nil {
+			return fmt.Errorf("token: %w", err)
+		}
+		s.EncryptedToken = nil
+		for key, entry := range s.URLTokens {
+			if entry.AuthToken, err = openWith(passphrase, entry.AuthToken, entry.EncryptedToken); err != nil {
+				return fmt.Errorf("token for %s: %w", key, err)
+			}
+			entry.EncryptedToken = nil
+		}
+
+		s.exposeDeprecated()
+		return nil
+	})
+}
+
+// openWith returns a value from its persisted form, decrypting it with
+// passphrase if needed.
+func openWith(passphrase, plain string, ev *EncryptedValue) (string, error) {
+	if ev == nil {
+		return plain, nil
+	}
+	plaintext, err := decryptValue(passphrase, ev)
+	if err != nil {
+		return "", err
+	}
+	defer wipe(plaintext)
+	return string(plaintext), nil
+}
+
+// documentLayout tells a hybrid document, in which no private key is
+// stored in plaintext and at least one is encrypted, from a plaintext one.
+func documentLayout(doc []byte) Layout {
+	type key struct {
+		PrivateKey   string          `json:"private_key"`
+		EncryptedKey json.RawMessage `json:"encrypted_key"`
+	}
+	var d struct {
+		key
+		SSHKey          string          `json:"ssh_key"`
+		EncryptedSSHKey json.RawMessage `json:"encrypted_ssh_key"`
+		KeyShares       json.RawMessage `json:"key_shares"`
+		Accounts        map[string]key  `json:"accounts"`
+		Trash           map[string]key  `json:"trash"`
+	}
+	if json.Unmarshal(doc, &d) != nil {
+		return ""
+	}
+
+	keys := []key{d.key, {PrivateKey: d.SSHKey, EncryptedKey: d.EncryptedSSHKey}}
+	for _, accounts := range []map[string]key{d.Accounts, d.Trash} {
+		for _, k := range accounts {
+			keys = append(keys, k)
+		}
+	}
+
+	protected := d.KeyShares != nil
+	for _, k := range keys {
+		if k.PrivateKey != "" {
+			return LayoutPlaintext
+		}
+		if k.EncryptedKey != nil {
+			protected = true
+		}
+	}
+	if protected {
+		return LayoutHybrid
+	}
+	return LayoutPlaintext
+}
@@ -0,0 +1,180 @@
+package keystore_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/theblitlabs/keystore"
+)
+
+const layoutPassphrase = "layout passphrase"
+
+// newOpenPGPConfig returns an OpenPGP configuration with a fresh key.
+func newOpenPGPConfig(t *testing.T) *keystore.OpenPGPConfig {
+	t.Helper()
+
+	entity, err := openpgp.NewEntity("keystore test", "", "test@example.com", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := openpgp.EntityList{entity}
+	return &keystore.OpenPGPConfig{Recipients: keys, Keyring: keys}
+}
+
+// assertLayout fails unless the keystore file in dir has layout want.
+func assertLayout(t *testing.T, dir string, want keystore.Layout) {
+	t.Helper()
+
+	info, err := keystore.IdentifyFile(filepath.Join(dir, keystore.DefaultFileName))
+	if err != nil {
+		t.Fatalf("IdentifyFile: %v", err)
+	}
+	if info.Layout != want {
+		t.Fatalf("layout = %q, want %q", info.Layout, want)
+	}
+}
+
+func TestHybridLayoutTokenSkipsKDF(t *testing.T) {
+	dir := t.TempDir()
+	var calls atomic.Int32
+	cfg := keystore.Config{DirPath: dir, Passphrase: countingPassphrase(layoutPassphrase, 0, &calls)}
+	ks := newErrorStore(t, cfg)
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveAccount("ops", credentialKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	assertLayout(t, dir, keystore.LayoutHybrid)
+
+	// Token refreshes, by this Store and by a fresh one as a restarted
+	// process uses, never ask for the passphrase.
+	calls.Store(0)
+	fresh := newErrorStore(t, cfg)
+	for i, store := range []*keystore.Store{ks, fresh, ks} {
+		if err := store.SaveToken("token"); err != nil {
+			t.Fatal(err)
+		}
+		if token, err := store.LoadToken(); err != nil || token != "token" {
+			t.Fatalf("refresh %d: LoadToken = %q, %v", i, token, err)
+		}
+		if _, err := store.GetAddress(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := calls.Load(); n != 0 {
+		t.Fatalf("token refreshes asked for the passphrase %d times", n)
+	}
+	assertLayout(t, dir, keystore.LayoutHybrid)
+
+	// The key itself does.
+	if key, err := fresh.LoadPrivateKey(); err != nil || hexKey(key) != fileKeyHex {
+		t.Fatalf("LoadPrivateKey: %v", err)
+	}
+	if calls.Load() == 0 {
+		t.Fatal("LoadPrivateKey did not ask for the passphrase")
+	}
+}
+
+func TestConvertLayout(t *testing.T) {
+	dir := t.TempDir()
+	pgp := newOpenPGPConfig(t)
+	ks := newErrorStore(t, keystore.Config{DirPath: dir, OpenPGP: pgp})
+	if err := ks.ConvertLayout(keystore.LayoutPlaintext, ""); err != nil {
+		t.Fatalf("ConvertLayout of a missing keystore: %v", err)
+	}
+	if err := ks.SaveToken("token"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveAccount("ops", credentialKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	assertLayout(t, dir, keystore.LayoutEncrypted)
+
+	// Each conversion is read back by a Store configured for the result.
+	readers := map[keystore.Layout]keystore.Config{
+		keystore.LayoutPlaintext: {DirPath: dir},
+		keystore.LayoutHybrid:    {DirPath: dir, Passphrase: keystore.StaticPassphrase(layoutPassphrase)},
+		keystore.LayoutEncrypted: {DirPath: dir, OpenPGP: pgp},
+	}
+	for _, layout := range []keystore.Layout{
+		keystore.LayoutHybrid,
+		keystore.LayoutPlaintext,
+		keystore.LayoutHybrid,
+		keystore.LayoutEncrypted,
+		keystore.LayoutPlaintext,
+	} {
+		if err := ks.ConvertLayout(layout, layoutPassphrase); err != nil {
+			t.Fatalf("ConvertLayout(%s): %v", layout, err)
+		}
+		assertLayout(t, dir, layout)
+
+		reader := newErrorStore(t, readers[layout])
+		if token, err := reader.LoadToken(); err != nil || token != "token" {
+			t.Fatalf("%s: LoadToken = %q, %v", layout, token, err)
+		}
+		if key, err := reader.LoadPrivateKey(); err != nil || hexKey(key) != fileKeyHex {
+			t.Fatalf("%s: LoadPrivateKey: %v", layout, err)
+		}
+		if key, err := reader.LoadAccountKey("ops"); err != nil || hexKey(key) != credentialKeyHex {
+			t.Fatalf("%s: LoadAccountKey: %v", layout, err)
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, keystore.DefaultFileName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if plain := bytes.Contains(data, []byte(fileKeyHex)); plain != (layout == keystore.LayoutPlaintext) {
+			t.Fatalf("%s: key in plaintext = %v", layout, plain)
+		}
+		if token := bytes.Contains(data, []byte(`"token"`)); token == (layout == keystore.LayoutEncrypted) {
+			t.Fatalf("%s: token in plaintext = %v", layout, token)
+		}
+	}
+}
+
+func TestConvertLayoutRefusals(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, keystore.DefaultFileName)
+	ks := newErrorStore(t, keystore.Config{DirPath: dir, Passphrase: keystore.StaticPassphrase(layoutPassphrase)})
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ks.ConvertLayout(keystore.LayoutPlaintext, "wrong passphrase"); err == nil {
+		t.Fatal("ConvertLayout with the wrong passphrase succeeded")
+	}
+	if err := ks.ConvertLayout(keystore.LayoutHybrid, ""); !errors.Is(err, keystore.ErrEmptyPassphrase) {
+		t.Fatalf("ConvertLayout to hybrid without a passphrase: got %v, want ErrEmptyPassphrase", err)
+	}
+	var cerr *keystore.ConfigError
+	if err := ks.ConvertLayout(keystore.LayoutEncrypted, layoutPassphrase); !errors.As(err, &cerr) || cerr.Field != "OpenPGP" {
+		t.Fatalf("ConvertLayout to encrypted without OpenPGP: got %v, want an OpenPGP ConfigError", err)
+	}
+	if err := ks.ConvertLayout("zipped", layoutPassphrase); !errors.Is(err, keystore.ErrUnknownLayout) {
+		t.Fatalf("ConvertLayout to an unknown layout: got %v, want ErrUnknownLayout", err)
+	}
+
+	strict := newErrorStore(t, keystore.Config{DirPath: dir, RequireEncryption: true, Passphrase: keystore.StaticPassphrase(layoutPassphrase)})
+	if err := strict.ConvertLayout(keystore.LayoutPlaintext, layoutPassphrase); !errors.Is(err, keystore.ErrEncryptionRequired) {
+		t.Fatalf("ConvertLayout to plaintext with RequireEncryption: got %v, want ErrEncryptionRequired", err)
+	}
+
+	if after, err := os.ReadFile(path); err != nil || !bytes.Equal(before, after) {
+		t.Fatalf("a refused conversion changed the keystore: %v", err)
+	}
+	assertLayout(t, dir, keystore.LayoutHybrid)
+}
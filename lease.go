@@ -0,0 +1,209 @@
+package keystore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// leaseRetryInterval is how often AcquireSigningLease retries while
+// another holder has the lease.
+var leaseRetryInterval = 500 * time.Millisecond
+
+// SigningLease is the persisted record of the signing lease. Fence
+// increases with every acquisition, across releases too, so a holder can
+// tell that the lease was taken over even by the same holder ID.
+// ExpiresAt is a Unix time in milliseconds.
+type SigningLease struct {
+	Holder    string `json:"holder"`
+	Fence     int64  `json:"fence"`
+	ExpiresAt int64  `json:"expires_at_ms"`
+}
+
+// Lease is a signing lease held by a Store, as returned by
+// AcquireSigningLease.
+type Lease struct {
+	Holder    string
+	Fence     int64
+	ExpiresAt time.Time
+
+	store *Store
+	ttl   time.Duration
+}
+
+// heldLease identifies the lease a Store holds.
+type heldLease struct {
+	holder string
+	fence  int64
+}
+
+// AcquireSigningLease takes the signing lease for holderID for ttl,
+// waiting until ctx is done while another holder has it. The lease is
+// persisted in the keystore, so Stores on other hosts sharing the keystore
+// see it: once a keystore has a lease, only the Store holding it signs, and
+// only until it expires unless renewed. Signing operations on other Stores
+// fail with ErrNotLeaseHolder, even with a cached unlocked key, until they
+// acquire the lease themselves. Keystores without a lease sign as before.
+//
+// A lease that is not renewed can be taken over once it has been expired
+// for Config.LeaseSkewTolerance, so that a holder whose clock is behind
+// the others has stopped signing by then. Every acquisition starts a new
+// fence, so a Store that lost the lease cannot sign again even under the
+// same holder ID.
+func (s *Store) AcquireSigningLease(ctx context.Context, holderID string, ttl time.Duration) (*Lease, error) {
+	if holderID == "" {
+		return nil, fmt.Errorf("%w: holder ID is required", ErrInvalidLease)
+	}
+	if ttl < time.Millisecond {
+		return nil, fmt.Errorf("%w: lifetime must be at least 1ms, got %v", ErrInvalidLease, ttl)
+	}
+
+	for {
+		lease, busy, err := s.tryAcquireLease(holderID, ttl)
+		if err != nil || busy == nil {
+			return lease, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: lease is held by %q until %s: %v", ErrNotLeaseHolder,
+				busy.Holder, time.UnixMilli(busy.ExpiresAt).UTC().Format(time.RFC3339), ctx.Err())
+		case <-time.After(leaseRetryInterval):
+		}
+	}
+}
+
+// tryAcquireLease takes the lease unless another holder has it, in which
+// case that holder's lease is returned.
+func (s *Store) tryAcquireLease(holderID string, ttl time.Duration) (lease *Lease, busy *SigningLease, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err = s.updateScope(scopeKey, func() error {
+		current := s.SigningLease
+		if current != nil && current.Holder != holderID && s.leaseActive(current) {
+			lease, busy = nil, current
+			return errLeaseUnchanged
+		}
+
+		fence := s.LeaseFence + 1
+		if current != nil && current.Fence >= fence {
+			fence = current.Fence + 1
+		}
+		expiresAt := s.now().Add(ttl)
+		s.SigningLease = &SigningLease{Holder: holderID, Fence: fence, ExpiresAt: expiresAt.UnixMilli()}
+		s.lease = &heldLease{holder: holderID, fence: fence}
+		lease = &Lease{Holder: holderID, Fence: fence, ExpiresAt: expiresAt, store: s, ttl: ttl}
+		return nil
+	})
+	if err == errLeaseUnchanged {
+		return nil, busy, nil
+	}
+	if err != nil {
+		s.lease = nil
+		return nil, nil, err
+	}
+	return lease, nil, nil
+}
+
+// errLeaseUnchanged aborts a lease update that has nothing to save.
+var errLeaseUnchanged = errors.New("keystore: lease is unchanged")
+
+// Renew extends the lease by its lifetime from now. It fails with
+// ErrNotLeaseHolder if the lease was released or taken over, after which
+// the Store no longer holds it. An expired lease that nobody took over is
+// renewed.
+func (l *Lease) Renew() error {
+	s := l.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.updateScope(scopeKey, func() error {
+		if err := l.checkCurrent(); err != nil {
+			return err
+		}
+		expiresAt := s.now().Add(l.ttl)
+		s.SigningLease.ExpiresAt = expiresAt.UnixMilli()
+		l.ExpiresAt = expiresAt
+		return nil
+	})
+}
+
+// Release gives up the lease, so that another holder can take it at once.
+// Releasing a lease that was taken over does nothing.
+func (l *Lease) Release() error {
+	s := l.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.updateScope(scopeKey, func() error {
+		if l.checkCurrent() != nil {
+			return errLeaseUnchanged
+		}
+		s.LeaseFence = s.SigningLease.Fence
+		s.SigningLease = nil
+		s.lease = nil
+		return nil
+	})
+	if err == errLeaseUnchanged {
+		return nil
+	}
+	return err
+}
+
+// checkCurrent fails unless the loaded lease is still l, forgetting the
+// lease held by the Store otherwise.
+func (l *Lease) checkCurrent() error {
+	s := l.store
+	current := s.SigningLease
+	if current != nil && current.Holder == l.Holder && current.Fence == l.Fence {
+		return nil
+	}
+
+	if s.lease != nil && s.lease.fence == l.Fence {
+		s.lease = nil
+	}
+	if current == nil {
+		return fmt.Errorf("%w: lease was released", ErrNotLeaseHolder)
+	}
+	return fmt.Errorf("%w: lease was taken over by %q", ErrNotLeaseHolder, current.Holder)
+}
+
+// checkLease fails with ErrNotLeaseHolder when the keystore has a lease
+// that this Store does not hold, or holds but let expire. Expired leases of
+// other holders still count, since only acquiring the lease makes it safe
+// to sign. It reads the loaded state, which is current whenever the key
+// is: the key cache is dropped when the backend changes.
+func (s *Store) checkLease() error {
+	current := s.SigningLease
+	if current == nil {
+		return nil
+	}
+	expiresAt := time.UnixMilli(current.ExpiresAt)
+	if s.lease == nil || s.lease.holder != current.Holder || s.lease.fence != current.Fence {
+		return fmt.Errorf("%w: lease is held by %q until %s", ErrNotLeaseHolder,
+			current.Holder, expiresAt.UTC().Format(time.RFC3339))
+	}
+	if s.now().After(expiresAt) {
+		return fmt.Errorf("%w: lease expired at %s", ErrNotLeaseHolder, expiresAt.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// leaseActive reports whether l may still be in use by its holder, allowing
+// for the holder's clock being ahead.
+func (s *Store) leaseActive(l *SigningLease) bool {
+	return !s.now().After(time.UnixMilli(l.ExpiresAt).Add(s.leaseSkewTolerance()))
+}
+
+func (s *Store) leaseSkewTolerance() time.Duration {
+	switch {
+	case s.config.LeaseSkewTolerance < 0:
+		return 0
+	case s.config.LeaseSkewTolerance == 0:
+		return DefaultLeaseSkewTolerance
+	default:
+		return s.config.LeaseSkewTolerance
+	}
+}
@@ -0,0 +1,367 @@
+package keystore_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/theblitlabs/keystore"
+)
+
+const leaseTTL = 30 * time.Second
+
+var leaseDigest = make([]byte, 32)
+
+// signingLeaseOps are the signing operations the lease gates.
+var signingLeaseOps = []struct {
+	name string
+	run  func(ks *keystore.Store) error
+}{
+	{"SignDigest", func(ks *keystore.Store) error {
+		_, err := ks.SignDigest(leaseDigest)
+		return err
+	}},
+	{"SignMessage", func(ks *keystore.Store) error {
+		_, err := ks.SignMessage([]byte("lease"))
+		return err
+	}},
+	{"SignWithAccount", func(ks *keystore.Store) error {
+		_, err := ks.SignWithAccount("hot", leaseDigest)
+		return err
+	}},
+	{"SignTransaction", func(ks *keystore.Store) error {
+		tx := types.NewTransaction(0, common.Address{}, big.NewInt(0), 21000, big.NewInt(1), nil)
+		_, err := ks.SignTransaction(tx, big.NewInt(1))
+		return err
+	}},
+	{"BatchSigner", func(ks *keystore.Store) error {
+		sg, err := ks.BatchSigner(context.Background())
+		if err != nil {
+			return err
+		}
+		defer sg.Close()
+		_, err = sg.SignDigests([][]byte{leaseDigest})
+		return err
+	}},
+}
+
+// newLeaseStores returns two Stores on one keystore with a primary key and
+// an account, as on two hosts, each with its own clock.
+func newLeaseStores(t *testing.T, cfg keystore.Config) (a, b *keystore.Store, clockA, clockB *testClock) {
+	t.Helper()
+
+	cfg.DirPath = t.TempDir()
+	clockA, clockB = newTestClock(epoch), newTestClock(epoch)
+	a = newErrorStore(t, clockA.config(cfg))
+	b = newErrorStore(t, clockB.config(cfg))
+	if err := a.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SaveAccount("hot", credentialKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	return a, b, clockA, clockB
+}
+
+// canSign reports whether every signing operation succeeds on ks, and
+// fails the test if they disagree or fail for another reason.
+func canSign(t *testing.T, ks *keystore.Store) bool {
+	t.Helper()
+
+	var ok, refused []string
+	for _, op := range signingLeaseOps {
+		switch err := op.run(ks); {
+		case err == nil:
+			ok = append(ok, op.name)
+		case errors.Is(err, keystore.ErrNotLeaseHolder):
+			refused = append(refused, op.name)
+		default:
+			t.Fatalf("%s: %v", op.name, err)
+		}
+	}
+	if len(ok) > 0 && len(refused) > 0 {
+		t.Fatalf("%v signed while %v were refused", ok, refused)
+	}
+	return len(ok) > 0
+}
+
+// tryAcquire takes the lease if it is free, without waiting.
+func tryAcquire(ks *keystore.Store, holder string) (*keystore.Lease, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ks.AcquireSigningLease(ctx, holder, leaseTTL)
+}
+
+func TestSigningLease(t *testing.T) {
+	a, b, clockA, clockB := newLeaseStores(t, keystore.Config{})
+	advance := func(d time.Duration) {
+		clockA.Advance(d)
+		clockB.Advance(d)
+	}
+
+	// Without a lease both sign, and both cache the unlocked key.
+	if !canSign(t, a) || !canSign(t, b) {
+		t.Fatal("a keystore without a lease refused to sign")
+	}
+
+	// A lease needs a holder and a lifetime of at least a millisecond.
+	for _, args := range []struct {
+		holder string
+		ttl    time.Duration
+	}{{"", leaseTTL}, {"host-a", 0}, {"host-a", time.Microsecond}} {
+		if _, err := a.AcquireSigningLease(context.Background(), args.holder, args.ttl); !errors.Is(err, keystore.ErrInvalidLease) {
+			t.Fatalf("AcquireSigningLease(%q, %v): got %v, want ErrInvalidLease", args.holder, args.ttl, err)
+		}
+	}
+
+	lease, err := a.AcquireSigningLease(context.Background(), "host-a", leaseTTL)
+	if err != nil {
+		t.Fatalf("AcquireSigningLease: %v", err)
+	}
+	if lease.Holder != "host-a" || lease.Fence != 1 || !lease.ExpiresAt.Equal(epoch.Add(leaseTTL)) {
+		t.Fatalf("lease = %+v", lease)
+	}
+	if !canSign(t, a) {
+		t.Fatal("the holder cannot sign")
+	}
+	if canSign(t, b) {
+		t.Fatal("another Store signed with its cached key while the lease was held")
+	}
+	if _, err := tryAcquire(b, "host-b"); !errors.Is(err, keystore.ErrNotLeaseHolder) {
+		t.Fatalf("AcquireSigningLease of a held lease: got %v, want ErrNotLeaseHolder", err)
+	}
+
+	// Renewing keeps the holder signing past the first expiry.
+	advance(leaseTTL - time.Second)
+	if err := lease.Renew(); err != nil {
+		t.Fatalf("Renew: %v", err)
+	}
+	advance(2 * time.Second)
+	if !canSign(t, a) {
+		t.Fatal("the holder cannot sign after renewing")
+	}
+
+	// The holder stops at its own expiry. Nobody else signs either until
+	// they acquire the lease.
+	advance(leaseTTL)
+	if canSign(t, a) {
+		t.Fatal("the holder signed after its lease expired")
+	}
+	if canSign(t, b) {
+		t.Fatal("another Store signed with an expired lease it does not hold")
+	}
+
+	// An expired lease nobody took over can be renewed.
+	if err := lease.Renew(); err != nil {
+		t.Fatalf("Renew of an expired lease: %v", err)
+	}
+	if !canSign(t, a) {
+		t.Fatal("the holder cannot sign after renewing an expired lease")
+	}
+
+	// Releasing frees the keystore for everyone.
+	if err := lease.Release(); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if !canSign(t, a) || !canSign(t, b) {
+		t.Fatal("a released lease still gates signing")
+	}
+	if err := lease.Renew(); !errors.Is(err, keystore.ErrNotLeaseHolder) {
+		t.Fatalf("Renew of a released lease: got %v, want ErrNotLeaseHolder", err)
+	}
+	if err := lease.Release(); err != nil {
+		t.Fatalf("Release of a released lease: %v", err)
+	}
+}
+
+func TestSigningLeaseTakeover(t *testing.T) {
+	a, b, clockA, clockB := newLeaseStores(t, keystore.Config{})
+	advance := func(d time.Duration) {
+		clockA.Advance(d)
+		clockB.Advance(d)
+	}
+
+	lease, err := a.AcquireSigningLease(context.Background(), "host-a", leaseTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A lease expired for less than the skew tolerance cannot be taken.
+	advance(leaseTTL + keystore.DefaultLeaseSkewTolerance)
+	if _, err := tryAcquire(b, "host-b"); !errors.Is(err, keystore.ErrNotLeaseHolder) {
+		t.Fatalf("takeover within the skew tolerance: got %v, want ErrNotLeaseHolder", err)
+	}
+
+	// After that it is taken over with a new fence.
+	advance(time.Millisecond)
+	taken, err := tryAcquire(b, "host-b")
+	if err != nil {
+		t.Fatalf("takeover of an expired lease: %v", err)
+	}
+	if taken.Fence != lease.Fence+1 {
+		t.Fatalf("takeover fence = %d, want %d", taken.Fence, lease.Fence+1)
+	}
+	if !canSign(t, b) {
+		t.Fatal("the new holder cannot sign")
+	}
+	if canSign(t, a) {
+		t.Fatal("the old holder signed after a takeover")
+	}
+	if err := lease.Renew(); !errors.Is(err, keystore.ErrNotLeaseHolder) {
+		t.Fatalf("Renew of a lost lease: got %v, want ErrNotLeaseHolder", err)
+	}
+	if err := lease.Release(); err != nil {
+		t.Fatalf("Release of a lost lease: %v", err)
+	}
+	if !canSign(t, b) {
+		t.Fatal("Release of a lost lease released the new holder's")
+	}
+
+	// The same holder ID on another Store is a new acquisition, which the
+	// Store that held it before does not share.
+	if err := taken.Release(); err != nil {
+		t.Fatal(err)
+	}
+	again, err := tryAcquire(b, "host-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Fence != taken.Fence+1 {
+		t.Fatalf("fence after a release = %d, want %d", again.Fence, taken.Fence+1)
+	}
+	if canSign(t, a) {
+		t.Fatal("a Store signed under a lease acquired by another Store with its holder ID")
+	}
+
+	// A holder waiting in AcquireSigningLease gets the lease once it is
+	// released.
+	acquired := make(chan error, 1)
+	go func() {
+		_, err := a.AcquireSigningLease(context.Background(), "host-a", leaseTTL)
+		acquired <- err
+	}()
+	if err := again.Release(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatalf("waiting AcquireSigningLease: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("AcquireSigningLease kept waiting after the lease was released")
+	}
+	if !canSign(t, a) || canSign(t, b) {
+		t.Fatal("the waiting Store did not get the lease")
+	}
+}
+
+func TestSigningLeaseClockSkew(t *testing.T) {
+	const tolerance = 5 * time.Second
+
+	tests := []struct {
+		name      string
+		skew      time.Duration // of the holder's clock
+		tolerance time.Duration
+		takeover  time.Duration // after the expiry
+	}{
+		{"holder ahead", 3 * time.Second, tolerance, 8 * time.Second},
+		{"holder behind", -3 * time.Second, tolerance, 2 * time.Second},
+		{"holder behind by the tolerance", -tolerance, tolerance, 0},
+		// Without a tolerance the other host takes over while the holder
+		// still thinks its lease current, and the fence stops the holder.
+		{"holder behind without tolerance", -3 * time.Second, -1, -3 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b, clockA, clockB := newLeaseStores(t, keystore.Config{LeaseSkewTolerance: tt.tolerance})
+			clockA.Set(epoch.Add(tt.skew))
+			if _, err := a.AcquireSigningLease(context.Background(), "host-a", leaseTTL); err != nil {
+				t.Fatal(err)
+			}
+
+			// Step through the expiry in true time. The holder records it
+			// by its clock and stops there; the other host compares it with
+			// its own and takes over once the tolerance has passed.
+			expiry := epoch.Add(leaseTTL)
+			takenOver := false
+			for at := -10 * time.Second; at <= 10*time.Second; at += 250 * time.Millisecond {
+				clockA.Set(expiry.Add(at + tt.skew))
+				clockB.Set(expiry.Add(at))
+				if !takenOver {
+					if _, err := tryAcquire(b, "host-b"); err == nil {
+						takenOver = true
+					} else if !errors.Is(err, keystore.ErrNotLeaseHolder) {
+						t.Fatal(err)
+					}
+				}
+				if want := at > tt.takeover; takenOver != want {
+					t.Fatalf("at %v: taken over %v, want %v", at, takenOver, want)
+				}
+
+				signA, signB := canSign(t, a), canSign(t, b)
+				if want := at <= 0 && !takenOver; signA != want {
+					t.Fatalf("at %v: holder signs %v, want %v", at, signA, want)
+				}
+				if signB != takenOver {
+					t.Fatalf("at %v: other host signs %v, want %v", at, signB, takenOver)
+				}
+			}
+		})
+	}
+}
+
+func TestSigningLeaseTransactOpts(t *testing.T) {
+	a, b, _, _ := newLeaseStores(t, keystore.Config{})
+	chainID := big.NewInt(1)
+	opts, err := a.TransactOpts(chainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func() error {
+		tx := types.NewTransaction(0, common.Address{}, big.NewInt(0), 21000, big.NewInt(1), nil)
+		_, err := opts.Signer(opts.From, tx)
+		return err
+	}
+	if err := sign(); err != nil {
+		t.Fatalf("Signer: %v", err)
+	}
+
+	// Opts made before another Store took the lease stop signing, as
+	// SignTransaction does.
+	lease, err := b.AcquireSigningLease(context.Background(), "host-b", leaseTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sign(); !errors.Is(err, keystore.ErrNotLeaseHolder) {
+		t.Fatalf("Signer after a takeover: got %v, want ErrNotLeaseHolder", err)
+	}
+	if err := lease.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sign(); err != nil {
+		t.Fatalf("Signer after the lease was released: %v", err)
+	}
+
+	// So do they once another Store freezes the keystore.
+	if err := b.Freeze("incident"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sign(); !errors.Is(err, keystore.ErrKeystoreFrozen) {
+		t.Fatalf("Signer while frozen: got %v, want ErrKeystoreFrozen", err)
+	}
+
+	// An address other than the key's is refused.
+	if err := b.Unfreeze(); err != nil {
+		t.Fatal(err)
+	}
+	tx := types.NewTransaction(0, common.Address{}, big.NewInt(0), 21000, big.NewInt(1), nil)
+	if _, err := opts.Signer(common.Address{1}, tx); !errors.Is(err, bind.ErrNotAuthorized) {
+		t.Fatalf("Signer for another address: got %v, want ErrNotAuthorized", err)
+	}
+}
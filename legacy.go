@@ -0,0 +1,186 @@
+package keystore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	// DefaultLegacyDirName is the directory, under the home directory,
+	// where older releases wrote their token and key files
+	DefaultLegacyDirName = ".parity"
+
+	// LegacyTokenFile and LegacyKeyFile are the legacy files holding a
+	// bare token and a raw hex private key
+	LegacyTokenFile = "token"
+	LegacyKeyFile   = "key"
+
+	// LegacyImportedSuffix is appended to legacy files once imported
+	LegacyImportedSuffix = ".imported"
+)
+
+// ImportLegacyFiles imports the token and key files that older releases
+// wrote to dir into the keystore, then renames them with
+// LegacyImportedSuffix so the migration runs only once. The token gets a
+// fresh Config.TokenTTL lifetime. A missing file is ignored; an empty or
+// invalid one is reported as failed and left in place without blocking
+// the other file. A token or key that the keystore already holds is
+// skipped.
+func (s *Store) ImportLegacyFiles(dir string) (ImportReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := ImportReport{Imported: []ImportEntry{}, Skipped: []ImportEntry{}, Failed: []ImportEntry{}}
+
+	if b, ok := s.backend.(lockingBackend); ok {
+		release, err := b.acquireLock(scopeStore, s.lockTimeout())
+		if err != nil {
+			return report, err
+		}
+		defer release()
+	}
+
+	if err := s.load(); err != nil {
+		if !isNoKeystore(err) {
+			return report, err
+		}
+		s.reset()
+	}
+
+	return s.importLegacy(dir)
+}
+
+// importLegacy imports the legacy files in dir into the in-memory state
+// and saves it. The caller has loaded the current state.
+func (s *Store) importLegacy(dir string) (ImportReport, error) {
+	report := ImportReport{Imported: []ImportEntry{}, Skipped: []ImportEntry{}, Failed: []ImportEntry{}}
+
+	var done []string
+	for _, file := range []struct {
+		name  string
+		entry string
+		apply func(path, value string) (skip string, err error)
+	}{
+		{LegacyTokenFile, "auth_token", s.importLegacyToken},
+		{LegacyKeyFile, "private_key", s.importLegacyKey},
+	} {
+		path := filepath.Join(dir, file.name)
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		result := ImportEntry{Source: path, Name: file.entry}
+		if err != nil {
+			result.Reason = fmt.Sprintf("failed to read file: %v", err)
+			report.Failed = append(report.Failed, result)
+			continue
+		}
+
+		value := strings.TrimSpace(string(data))
+		wipe(data)
+		skip, err := file.apply(path, value)
+		switch {
+		case err != nil:
+			result.Reason = err.Error()
+			report.Failed = append(report.Failed, result)
+		case skip != "":
+			result.Reason = skip
+			report.Skipped = append(report.Skipped, result)
+			done = append(done, path)
+		default:
+			report.Imported = append(report.Imported, result)
+			done = append(done, path)
+		}
+	}
+
+	if len(report.Imported) > 0 {
+		if err := s.save(); err != nil {
+			s.reset()
+			return report, err
+		}
+	}
+
+	for _, path := range done {
+		if err := os.Rename(path, path+LegacyImportedSuffix); err != nil {
+			s.config.Logger.Warn("keystore: failed to mark legacy file as imported", "path", path, "error", err)
+		}
+	}
+
+	return report, nil
+}
+
+func (s *Store) importLegacyToken(_, token string) (string, error) {
+	if token == "" {
+		return "", ErrEmptyToken
+	}
+	if strings.IndexFunc(token, func(r rune) bool { return unicode.IsSpace(r) || !unicode.IsPrint(r) }) >= 0 {
+		return "", fmt.Errorf("%w: legacy token contains whitespace or control characters", ErrInvalidToken)
+	}
+	if err := s.checkToken(token); err != nil {
+		return "", err
+	}
+
+	if s.persisted.AuthToken != "" || s.EncryptedToken != nil {
+		current, err := s.authToken()
+		if err == nil && s.TokenDevice == "" && current == token {
+			return "already imported", nil
+		}
+		return "keystore already has a token", nil
+	}
+
+	return "", s.setToken(token, s.tokenTTL())
+}
+
+func (s *Store) importLegacyKey(path, privateKeyHex string) (string, error) {
+	privateKeyHex = strings.TrimPrefix(privateKeyHex, "0x")
+	key, err := s.checkPrivateKey(privateKeyHex)
+	if err != nil {
+		return "", err
+	}
+
+	if s.Address != "" {
+		if s.Address == crypto.PubkeyToAddress(key.PublicKey).Hex() {
+			return "already imported", nil
+		}
+		return "", fmt.Errorf("keystore already has a different primary key %s", s.Address)
+	}
+
+	return "", s.setPrimaryKey(privateKeyHex, key, s.newProvenance(ProvenanceLegacy, path))
+}
+
+// autoImportLegacy runs for a load that found no keystore when
+// Config.ImportLegacy is set. It reports ErrNoKeystore unless something was
+// imported.
+func (s *Store) autoImportLegacy() error {
+	dir := s.config.LegacyDir
+	if dir == "" {
+		home, err := homeDir()
+		if err != nil {
+			return fmt.Errorf("%w at %s", ErrNoKeystore, s.location())
+		}
+		dir = filepath.Join(home, DefaultLegacyDirName)
+	}
+
+	s.reset()
+	report, err := s.importLegacy(dir)
+	if err != nil {
+		return err
+	}
+	for _, failed := range report.Failed {
+		s.config.Logger.Warn("keystore: failed to import legacy file", "path", failed.Source, "error", failed.Reason)
+	}
+	if len(report.Imported) == 0 {
+		return fmt.Errorf("%w at %s", ErrNoKeystore, s.location())
+	}
+
+	s.config.Logger.Warn("keystore: imported legacy files", "dir", dir, "files", len(report.Imported))
+	s.fileVersion = s.Version
+	s.fileFormat = s.Format
+	return nil
+}
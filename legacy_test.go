@@ -0,0 +1,216 @@
+package keystore_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/theblitlabs/keystore"
+)
+
+// writeLegacy writes the legacy files present in files to a new directory.
+func writeLegacy(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func entryNames(entries []keystore.ImportEntry) []string {
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	return names
+}
+
+func TestImportLegacyFiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		imported []string
+		failed   []string
+		token    bool
+		key      bool
+	}{
+		{
+			name:     "both",
+			files:    map[string]string{keystore.LegacyTokenFile: "legacy-token\n", keystore.LegacyKeyFile: "0x" + fileKeyHex + "\n"},
+			imported: []string{"auth_token", "private_key"},
+			token:    true,
+			key:      true,
+		},
+		{
+			name:     "token only",
+			files:    map[string]string{keystore.LegacyTokenFile: "legacy-token"},
+			imported: []string{"auth_token"},
+			token:    true,
+		},
+		{
+			name:     "empty token",
+			files:    map[string]string{keystore.LegacyTokenFile: "\n", keystore.LegacyKeyFile: fileKeyHex},
+			imported: []string{"private_key"},
+			failed:   []string{"auth_token"},
+			key:      true,
+		},
+		{
+			name:     "corrupt key",
+			files:    map[string]string{keystore.LegacyTokenFile: "legacy-token", keystore.LegacyKeyFile: "not a key"},
+			imported: []string{"auth_token"},
+			failed:   []string{"private_key"},
+			token:    true,
+		},
+		{
+			name:   "token with control characters",
+			files:  map[string]string{keystore.LegacyTokenFile: "legacy\x00token"},
+			failed: []string{"auth_token"},
+		},
+		{
+			name: "no files",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			legacy := writeLegacy(t, tt.files)
+			ks, err := keystore.NewKeystore(keystore.Config{DirPath: t.TempDir()})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			report, err := ks.ImportLegacyFiles(legacy)
+			if err != nil {
+				t.Fatalf("ImportLegacyFiles: %v", err)
+			}
+			if got, want := entryNames(report.Imported), tt.imported; !slices.Equal(got, want) {
+				t.Errorf("imported %v, want %v", got, want)
+			}
+			if got, want := entryNames(report.Failed), tt.failed; !slices.Equal(got, want) {
+				t.Errorf("failed %v, want %v", got, want)
+			}
+
+			if token, err := ks.LoadToken(); tt.token != (err == nil) || (tt.token && token != "legacy-token") {
+				t.Errorf("LoadToken = %q, %v", token, err)
+			}
+			if key, err := ks.LoadPrivateKey(); tt.key != (err == nil) || (tt.key && hexKey(key) != fileKeyHex) {
+				t.Errorf("LoadPrivateKey: %v", err)
+			}
+
+			// Imported files are renamed; failed ones stay for the user to fix.
+			for name := range tt.files {
+				_, statErr := os.Stat(filepath.Join(legacy, name))
+				_, importedErr := os.Stat(filepath.Join(legacy, name+keystore.LegacyImportedSuffix))
+				failed := failedFile(report.Failed, name)
+				if failed != (statErr == nil) || failed == (importedErr == nil) {
+					t.Errorf("%s: left in place %v, renamed %v, failed %v", name, statErr == nil, importedErr == nil, failed)
+				}
+			}
+		})
+	}
+}
+
+func TestImportLegacyFilesRunsOnce(t *testing.T) {
+	legacy := writeLegacy(t, map[string]string{keystore.LegacyTokenFile: "legacy-token", keystore.LegacyKeyFile: fileKeyHex})
+	ks, err := keystore.NewKeystore(keystore.Config{DirPath: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.ImportLegacyFiles(legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := ks.ImportLegacyFiles(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Imported)+len(report.Skipped)+len(report.Failed) != 0 {
+		t.Fatalf("second import = %+v, want nothing to do", report)
+	}
+
+	// Files restored by hand are skipped rather than imported twice.
+	for _, name := range []string{keystore.LegacyTokenFile, keystore.LegacyKeyFile} {
+		path := filepath.Join(legacy, name)
+		if err := os.Rename(path+keystore.LegacyImportedSuffix, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if report, err = ks.ImportLegacyFiles(legacy); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Skipped) != 2 || len(report.Imported) != 0 {
+		t.Fatalf("re-import = %+v, want both skipped", report)
+	}
+}
+
+func TestImportLegacyFilesConflict(t *testing.T) {
+	ks, err := keystore.NewKeystore(keystore.Config{DirPath: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SavePrivateKey(credentialKeyHex); err != nil {
+		t.Fatal(err)
+	}
+
+	legacy := writeLegacy(t, map[string]string{keystore.LegacyKeyFile: fileKeyHex})
+	report, err := ks.ImportLegacyFiles(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Failed) != 1 {
+		t.Fatalf("report = %+v, want the key failed", report)
+	}
+	if key, err := ks.LoadPrivateKey(); err != nil || hexKey(key) != credentialKeyHex {
+		t.Fatalf("existing key replaced: %v", err)
+	}
+}
+
+func TestAutoImportLegacy(t *testing.T) {
+	legacy := writeLegacy(t, map[string]string{keystore.LegacyTokenFile: "legacy-token", keystore.LegacyKeyFile: "not a key"})
+	dir := t.TempDir()
+	ks, err := keystore.NewKeystore(keystore.Config{DirPath: dir, ImportLegacy: true, LegacyDir: legacy, Logger: discardLogger})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token, err := ks.LoadToken(); err != nil || token != "legacy-token" {
+		t.Fatalf("LoadToken = %q, %v", token, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, keystore.DefaultFileName)); err != nil {
+		t.Fatalf("keystore not written: %v", err)
+	}
+
+	// Without legacy files the keystore is simply missing.
+	off, err := keystore.NewKeystore(keystore.Config{DirPath: t.TempDir(), ImportLegacy: true, LegacyDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := off.LoadToken(); !errors.Is(err, keystore.ErrNoKeystore) {
+		t.Fatalf("LoadToken: got %v, want ErrNoKeystore", err)
+	}
+
+	// Nor is anything imported unless asked for.
+	legacy = writeLegacy(t, map[string]string{keystore.LegacyTokenFile: "legacy-token"})
+	plain, err := keystore.NewKeystore(keystore.Config{DirPath: t.TempDir(), LegacyDir: legacy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plain.LoadToken(); !errors.Is(err, keystore.ErrNoKeystore) {
+		t.Fatalf("LoadToken without ImportLegacy: got %v, want ErrNoKeystore", err)
+	}
+}
+
+func failedFile(entries []keystore.ImportEntry, name string) bool {
+	for _, e := range entries {
+		if filepath.Base(e.Source) == name {
+			return true
+		}
+	}
+	return false
+}
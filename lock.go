@@ -0,0 +1,403 @@
+package keystore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultLockTimeout is how long a write waits for another process to
+	// release the keystore lock
+	DefaultLockTimeout = 10 * time.Second
+
+	lockSuffix       = ".lock"
+	lockPollInterval = 10 * time.Millisecond
+	conflictAttempts = 3
+
+	// takeoverSuffix names the file serializing the takeover of a stale lock
+	takeoverSuffix = ".takeover"
+)
+
+var (
+	// staleLockAge is how long a lock file whose owner cannot be checked,
+	// such as one taken on another host, is honoured before it is taken
+	// over. Locks held by a process on this host are honoured while it runs.
+	staleLockAge = 5 * time.Minute
+
+	// staleTakeoverAge is how long a takeover file is honoured. A process
+	// dying between creating and removing it leaves it behind.
+	staleTakeoverAge = 10 * time.Second
+)
+
+// lockScope is the part of the keystore a write covers.
+type lockScope int
+
+const (
+	// scopeStore covers the whole keystore
+	scopeStore lockScope = iota
+
+	// scopeToken covers only the token fields
+	scopeToken
+
+	// scopeKey covers everything but the token fields
+	scopeKey
+)
+
+// lockingBackend is implemented by backends shared between processes that
+// need writers to be serialized. lockScope reports the scope actually
+// locked for a write to scope: backends with a single lock return
+// scopeStore, while backends that lock their parts separately return the
+// scope itself and implement scopedBackend.
+type lockingBackend interface {
+	lockScope(scope lockScope) lockScope
+	acquireLock(scope lockScope, timeout time.Duration) (release func(), err error)
+}
+
+// scopedBackend is implemented by backends that can write a single part of
+// the keystore, leaving the other parts untouched.
+type scopedBackend interface {
+	writeScope(scope lockScope, data []byte) error
+}
+
+func (b *FileBackend) lockScope(lockScope) lockScope {
+	return scopeStore
+}
+
+// acquireLock creates an exclusive lock file next to the keystore holding the
+// owner's PID and host, polling until it can be created or timeout elapses.
+// A lock left by a process that died is taken over: on this host once the
+// process is gone, and for other hosts once the file is staleLockAge old.
+// The file holds the whole keystore, so every scope takes the same lock.
+func (b *FileBackend) acquireLock(_ lockScope, timeout time.Duration) (func(), error) {
+	path := b.path + lockSuffix
+	deadline := time.Now().Add(timeout)
+
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, DefaultFileMode)
+		if err == nil {
+			_, werr := f.WriteString(currentLockOwner().String() + "\n")
+			if cerr := f.Close(); werr == nil {
+				werr = cerr
+			}
+			if werr != nil {
+				os.Remove(path)
+				return nil, fmt.Errorf("failed to write lock file: %w", werr)
+			}
+			return func() { os.Remove(path) }, nil
+		}
+
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to create lock file: %w", err)
+		}
+
+		if info, _, stale := staleLock(path); stale {
+			if err := takeOverLock(path, info); err == nil {
+				continue
+			} else if !errors.Is(err, errTakeoverBusy) {
+				return nil, err
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%w: %s", ErrLockTimeout, path)
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+// lockOwner identifies the process holding a lock file. Lock files written
+// by older versions hold only the PID and are taken to be from this host.
+type lockOwner struct {
+	pid  int
+	host string
+}
+
+func currentLockOwner() lockOwner {
+	host, _ := os.Hostname()
+	return lockOwner{pid: os.Getpid(), host: host}
+}
+
+func (o lockOwner) String() string {
+	if o.host == "" {
+		return strconv.Itoa(o.pid)
+	}
+	return strconv.Itoa(o.pid) + " " + o.host
+}
+
+// local reports whether the owner runs on this host, so its PID can be
+// checked.
+func (o lockOwner) local() bool {
+	host, _ := os.Hostname()
+	return o.host == "" || o.host == host
+}
+
+// parseLockOwner parses the content of a lock file.
+func parseLockOwner(data []byte) (lockOwner, bool) {
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 || len(fields) > 2 {
+		return lockOwner{}, false
+	}
+
+	pid, err := strconv.Atoi(fields[0])
+	if err != nil || pid <= 0 {
+		return lockOwner{}, false
+	}
+
+	owner := lockOwner{pid: pid}
+	if len(fields) == 2 {
+		owner.host = fields[1]
+	}
+	return owner, true
+}
+
+// staleLock reports whether the lock file at path was left by an owner that
+// no longer holds it, with the file's info and the reason.
+func staleLock(path string) (fs.FileInfo, string, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, "", false
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", false
+	}
+
+	owner, ok := parseLockOwner(data)
+	if ok && owner.local() {
+		if owner.pid == os.Getpid() || processAlive(owner.pid) {
+			return info, "", false
+		}
+		return info, fmt.Sprintf("process %d is not running", owner.pid), true
+	}
+
+	if age := time.Since(info.ModTime()); age > staleLockAge {
+		return info, fmt.Sprintf("lock of %s is %s old", ownerName(owner, ok), age.Round(time.Second)), true
+	}
+	return info, "", false
+}
+
+func ownerName(owner lockOwner, ok bool) string {
+	if !ok {
+		return "unknown owner"
+	}
+	return fmt.Sprintf("process %d on %s", owner.pid, owner.host)
+}
+
+// errTakeoverBusy is returned by takeOverLock while another process is
+// taking over the same lock.
+var errTakeoverBusy = errors.New("keystore: lock takeover in progress")
+
+// takeOverLock removes the stale lock file at path, as long as it is still
+// the file described by judged and still stale. Takeovers are serialized
+// by a takeover file, so a waiter that judged the same lock stale cannot
+// remove the lock a faster one has taken since.
+func takeOverLock(path string, judged fs.FileInfo) error {
+	guard := path + takeoverSuffix
+	f, err := os.OpenFile(guard, os.O_WRONLY|os.O_CREATE|os.O_EXCL, DefaultFileMode)
+	if err != nil {
+		if !errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("failed to create lock takeover file: %w", err)
+		}
+		if info, err := os.Stat(guard); err == nil && time.Since(info.ModTime()) > staleTakeoverAge {
+			os.Remove(guard)
+		}
+		return errTakeoverBusy
+	}
+	f.Close()
+	defer os.Remove(guard)
+
+	// The lock may have been taken over and taken again since it was judged,
+	// and the new lock file can reuse the inode of the old one, so it is
+	// judged again now that no other takeover can run.
+	if current, _, stale := staleLock(path); stale && os.SameFile(current, judged) && current.ModTime().Equal(judged.ModTime()) {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove stale lock file: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) lockTimeout() time.Duration {
+	if s.config.LockTimeout > 0 {
+		return s.config.LockTimeout
+	}
+	return DefaultLockTimeout
+}
+
+// update performs one load-merge-write cycle: it takes the backend's
+// cross-process lock, loads the current state, applies fn and saves. A
+// missing keystore starts from empty state. Nothing is written if fn fails.
+// When the backend reports a concurrent modification the cycle is repeated
+// on the fresh state, so fn may run more than once.
+func (s *Store) update(fn func() error) error {
+	return s.updateScope(scopeStore, fn)
+}
+
+// updateScope is update for an fn that changes only the fields in scope.
+// Backends that lock their parts separately then lock and write only that
+// part, so a token refresh does not wait for a key operation.
+func (s *Store) updateScope(scope lockScope, fn func() error) error {
+	// Writes queued earlier by SaveTokenAsync go first.
+	s.drainAsync()
+	return s.updateQueued(scope, fn)
+}
+
+// updateQueued is updateScope without writing the queued batch first.
+// drainAsync writes through it, so that a batch queued while another is
+// being written waits its turn instead of going in the middle of it.
+func (s *Store) updateQueued(scope lockScope, fn func() error) error {
+	if b, ok := s.backend.(lockingBackend); ok {
+		scope = b.lockScope(scope)
+	} else {
+		scope = scopeStore
+	}
+
+	var err error
+	for attempt := 1; attempt <= conflictAttempts; attempt++ {
+		err = s.updateOnce(scope, fn)
+		if errors.Is(err, errWholeStore) {
+			// Retried without counting as a conflict.
+			scope = scopeStore
+			attempt--
+			continue
+		}
+		if !errors.Is(err, ErrConflict) {
+			return err
+		}
+		s.config.Logger.Warn("keystore: concurrent modification, retrying update", "attempt", attempt)
+	}
+	return err
+}
+
+// errWholeStore is returned by updateOnce when the loaded keystore cannot be
+// written in parts, because a manifest signs the whole document.
+var errWholeStore = errors.New("keystore: update needs the whole-store lock")
+
+func (s *Store) updateOnce(scope lockScope, fn func() error) error {
+	if err := s.checkReadOnly(); err != nil {
+		return err
+	}
+
+	if b, ok := s.backend.(lockingBackend); ok {
+		release, err := b.acquireLock(scope, s.lockTimeout())
+		if err != nil {
+			if roErr := s.noteReadOnly(err); roErr != nil {
+				return roErr
+			}
+			return err
+		}
+		defer release()
+	}
+
+	// The revision lives with the token fields, so a key-only write detects
+	// other writers by the key part's stamp instead.
+	stamp, stamped := s.currentStamp()
+
+	if err := s.load(); err != nil {
+		if !isNoKeystore(err) {
+			return err
+		}
+		s.reset()
+	}
+
+	if scope != scopeStore && s.Manifest != nil {
+		return errWholeStore
+	}
+
+	loaded := s.Rev
+
+	if err := fn(); err != nil {
+		// The in-memory state no longer matches the backend.
+		s.cache = nil
+		return err
+	}
+
+	if scope == scopeKey {
+		if current, ok := s.currentStamp(); stamped && ok && !current.equal(stamp) {
+			s.cache = nil
+			return fmt.Errorf("%w: key file changed", ErrConflict)
+		}
+	} else if err := s.checkRevision(loaded); err != nil {
+		s.cache = nil
+		s.Rev = loaded
+		return err
+	}
+
+	s.Rev = loaded
+	s.scope = scope
+	defer func() { s.scope = scopeStore }()
+	return s.save()
+}
+
+// checkRevision fails with ErrConflict if the persisted revision is no
+// longer the one an update started from, which happens when a writer that
+// does not share the lock, such as another machine on a network filesystem,
+// saved in between.
+func (s *Store) checkRevision(loaded int64) error {
+	current, err := s.persistedRevision()
+	if err != nil {
+		return err
+	}
+
+	if current != loaded {
+		return fmt.Errorf("%w: revision %d changed to %d", ErrConflict, loaded, current)
+	}
+	return nil
+}
+
+// persistedRevision reads the revision currently stored by the backend, or
+// by the mirror while the keystore is being served from it.
+func (s *Store) persistedRevision() (int64, error) {
+	if s.fromMirror {
+		return s.mirrorRevision()
+	}
+
+	data, err := s.readBackend()
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read keystore: %w", err)
+	}
+	defer wipe(data)
+
+	return s.revisionOf(data)
+}
+
+// revisionOf reads the revision of the persisted document data.
+func (s *Store) revisionOf(data []byte) (int64, error) {
+	info, data, err := splitHeader(data)
+	if err != nil {
+		return 0, err
+	}
+
+	if data, err = s.decodeTransforms(info, data); err != nil {
+		return 0, err
+	}
+
+	if isPGPMessage(data) {
+		if data, err = s.pgpDecrypt(data); err != nil {
+			return 0, err
+		}
+		defer wipe(data)
+	}
+
+	if data, err = s.documentJSON(data); err != nil {
+		return 0, err
+	}
+
+	var header struct {
+		Revision int64 `json:"revision"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return 0, fmt.Errorf("failed to parse keystore: %w", err)
+	}
+	return header.Revision, nil
+}
@@ -0,0 +1,257 @@
+package keystore_test
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/theblitlabs/keystore"
+	"github.com/theblitlabs/keystore/faultinject"
+)
+
+// deadPID returns the PID of a process that has exited.
+func deadPID(t *testing.T) int {
+	t.Helper()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	return cmd.Process.Pid
+}
+
+func writeLock(t *testing.T, dir, content string, age time.Duration) {
+	t.Helper()
+
+	path := filepath.Join(dir, keystore.DefaultFileName+".lock")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(-age)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStaleLockTakeover(t *testing.T) {
+	host, _ := os.Hostname()
+	dead := deadPID(t)
+
+	cases := []struct {
+		name    string
+		content string
+		age     time.Duration
+		held    bool
+	}{
+		{name: "dead process on this host", content: fmt.Sprintf("%d %s\n", dead, host)},
+		{name: "dead process without host", content: strconv.Itoa(dead) + "\n"},
+		{name: "running process", content: fmt.Sprintf("%d %s\n", os.Getppid(), host), age: time.Hour, held: true},
+		{name: "this process", content: fmt.Sprintf("%d %s\n", os.Getpid(), host), age: time.Hour, held: true},
+		{name: "fresh lock from another host", content: "1 other-host.example\n", held: true},
+		{name: "old lock from another host", content: "1 other-host.example\n", age: time.Hour},
+		{name: "fresh unreadable lock", content: "garbage", held: true},
+		{name: "old unreadable lock", content: "garbage", age: time.Hour},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeLock(t, dir, c.content, c.age)
+
+			s, err := keystore.NewKeystore(keystore.Config{DirPath: dir, LockTimeout: 100 * time.Millisecond})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = s.SaveToken("token")
+			if c.held && !errors.Is(err, keystore.ErrLockTimeout) {
+				t.Errorf("SaveToken: got %v, want ErrLockTimeout", err)
+			}
+			if !c.held && err != nil {
+				t.Errorf("SaveToken: %v", err)
+			}
+		})
+	}
+}
+
+func TestStaleLockTakeoverConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	writeLock(t, dir, strconv.Itoa(deadPID(t)), 0)
+
+	const writers = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 1; i <= writers; i++ {
+		s, err := keystore.NewKeystore(keystore.Config{DirPath: dir})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- s.SaveWatchAddress(fmt.Sprintf("watch-%d", i), common.BigToAddress(big.NewInt(int64(i))))
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := keystore.NewKeystore(keystore.Config{DirPath: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts, err := s.ListAccounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != writers {
+		t.Errorf("%d accounts saved, want %d", len(accounts), writers)
+	}
+}
+
+func TestRepairRemovesStaleLock(t *testing.T) {
+	dir := t.TempDir()
+	s, err := keystore.NewKeystore(keystore.Config{DirPath: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveToken("token"); err != nil {
+		t.Fatal(err)
+	}
+	writeLock(t, dir, strconv.Itoa(deadPID(t)), 0)
+
+	report, err := s.Repair(keystore.RepairOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, item := range report.Fixed {
+		found = found || item.Problem == keystore.RepairStaleLock
+	}
+	if !found {
+		t.Errorf("Fixed = %+v, want the stale lock removed", report.Fixed)
+	}
+}
+
+// interleavingBackend runs afterRead after each read of the keystore
+// returns, standing in for a writer that does not share the lock, such as
+// another machine on a network filesystem.
+type interleavingBackend struct {
+	keystore.Backend
+	afterRead func()
+}
+
+func (b *interleavingBackend) Read() ([]byte, error) {
+	data, err := b.Backend.Read()
+	if f := b.afterRead; f != nil {
+		f()
+	}
+	return data, err
+}
+
+func TestUpdateRetriesAfterInterleavedWrite(t *testing.T) {
+	dir := t.TempDir()
+	other, err := keystore.NewKeystore(keystore.Config{DirPath: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.SaveToken("first"); err != nil {
+		t.Fatal(err)
+	}
+
+	b := &interleavingBackend{Backend: keystore.NewFileBackend(filepath.Join(dir, keystore.DefaultFileName))}
+	ks, err := keystore.NewKeystore(keystore.Config{Backend: b, Logger: discardLogger})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b.afterRead = func() {
+		b.afterRead = nil
+		if err := other.SavePrivateKey(fileKeyHex); err != nil {
+			t.Errorf("interleaved write: %v", err)
+		}
+	}
+	if err := ks.SaveToken("second"); err != nil {
+		t.Fatalf("SaveToken: %v", err)
+	}
+
+	if token, err := other.LoadToken(); err != nil || token != "second" {
+		t.Fatalf("LoadToken = %q, %v, want second", token, err)
+	}
+	if _, err := other.LoadPrivateKey(); err != nil {
+		t.Fatalf("interleaved key was lost: %v", err)
+	}
+	if rev, err := other.Revision(); err != nil || rev != 3 {
+		t.Fatalf("Revision = %d, %v, want 3", rev, err)
+	}
+}
+
+func TestUpdateConflictPersists(t *testing.T) {
+	dir := t.TempDir()
+	other, err := keystore.NewKeystore(keystore.Config{DirPath: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.SaveToken("theirs"); err != nil {
+		t.Fatal(err)
+	}
+
+	b := &interleavingBackend{Backend: keystore.NewFileBackend(filepath.Join(dir, keystore.DefaultFileName))}
+	ks, err := keystore.NewKeystore(keystore.Config{Backend: b, Logger: discardLogger})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b.afterRead = func() {
+		if err := other.SaveToken("theirs"); err != nil {
+			t.Errorf("interleaved write: %v", err)
+		}
+	}
+	if err := ks.SaveToken("ours"); !errors.Is(err, keystore.ErrConflict) {
+		t.Fatalf("SaveToken: got %v, want ErrConflict", err)
+	}
+	b.afterRead = nil
+
+	if token, err := other.LoadToken(); err != nil || token != "theirs" {
+		t.Fatalf("LoadToken = %q, %v, want theirs", token, err)
+	}
+}
+
+func TestFailedSaveKeepsRevision(t *testing.T) {
+	in := faultinject.New()
+	ks, err := keystore.NewKeystore(keystore.Config{DirPath: t.TempDir(), FaultInjector: in})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveToken("a"); err != nil {
+		t.Fatal(err)
+	}
+
+	in.Once(keystore.FaultOpWrite, keystore.Fault{Err: errors.New("disk full")})
+	if err := ks.SaveToken("b"); err == nil {
+		t.Fatal("SaveToken succeeded despite the write fault")
+	}
+	if ks.Rev != 1 {
+		t.Fatalf("Rev after a failed save = %d, want 1", ks.Rev)
+	}
+
+	if err := ks.SaveToken("c"); err != nil {
+		t.Fatal(err)
+	}
+	if rev, err := ks.Revision(); err != nil || rev != 2 {
+		t.Fatalf("Revision = %d, %v, want 2", rev, err)
+	}
+}
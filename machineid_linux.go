@@ -0,0 +1,19 @@
+package keystore
+
+import (
+	"errors"
+	"os"
+)
+
+func readMachineID() (string, error) {
+	for _, path := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			return string(data), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	return "", errors.New("no machine-id file found")
+}
@@ -0,0 +1,19 @@
+//go:build !linux && !darwin && !windows
+
+package keystore
+
+import (
+	"errors"
+	"os"
+)
+
+func readMachineID() (string, error) {
+	data, err := os.ReadFile("/etc/hostid")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", errors.New("device binding is not supported on this platform")
+		}
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,16 @@
+package keystore
+
+import (
+	"golang.org/x/sys/windows/registry"
+)
+
+func readMachineID() (string, error) {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Cryptography`, registry.QUERY_VALUE|registry.WOW64_64KEY)
+	if err != nil {
+		return "", err
+	}
+	defer key.Close()
+
+	guid, _, err := key.GetStringValue("MachineGuid")
+	return guid, err
+}
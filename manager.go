@@ -0,0 +1,154 @@
+package keystore
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Manager keeps several Stores under names, for applications that use more
+// than one keystore, such as a node identity, a user wallet and a deploy
+// key. It is safe for concurrent use.
+type Manager struct {
+	mu     sync.RWMutex
+	stores map[string]*Store
+}
+
+// UnknownStoreError reports a Manager lookup of a name that is not
+// registered, listing those that are. It matches ErrUnknownStore with
+// errors.Is.
+type UnknownStoreError struct {
+	Name       string
+	Registered []string
+}
+
+func (e *UnknownStoreError) Error() string {
+	if len(e.Registered) == 0 {
+		return fmt.Sprintf("%v: %q (no stores are registered)", ErrUnknownStore, e.Name)
+	}
+	return fmt.Sprintf("%v: %q (registered: %s)", ErrUnknownStore, e.Name, strings.Join(e.Registered, ", "))
+}
+
+func (e *UnknownStoreError) Unwrap() error {
+	return ErrUnknownStore
+}
+
+// NewManager returns an empty Manager.
+func NewManager() *Manager {
+	return &Manager{stores: make(map[string]*Store)}
+}
+
+// Register adds s under name. It fails with ErrStoreRegistered if the name
+// is taken, and with ErrInvalidRegistration for an empty name or a nil s.
+func (m *Manager) Register(name string, s *Store) error {
+	if name == "" {
+		return fmt.Errorf("%w: name cannot be empty", ErrInvalidRegistration)
+	}
+	if s == nil {
+		return fmt.Errorf("%w: store %q is nil", ErrInvalidRegistration, name)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.stores[name]; ok {
+		return fmt.Errorf("%w: %q", ErrStoreRegistered, name)
+	}
+	m.stores[name] = s
+	return nil
+}
+
+// Get returns the Store registered under name, or an UnknownStoreError.
+func (m *Manager) Get(name string) (*Store, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s, ok := m.stores[name]
+	if !ok {
+		return nil, &UnknownStoreError{Name: name, Registered: sortedNames(m.stores)}
+	}
+	return s, nil
+}
+
+// Names returns the registered names in sorted order.
+func (m *Manager) Names() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return sortedNames(m.stores)
+}
+
+// Range calls fn for each registered Store in name order, stopping at and
+// returning the first error. It works on a snapshot, so fn may register
+// Stores and Stores registered meanwhile are not visited.
+func (m *Manager) Range(fn func(name string, s *Store) error) error {
+	for _, e := range m.snapshot() {
+		if err := fn(e.name, e.store); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StatusAll returns the Status of every registered Store. A Store whose
+// Status fails is reported with Status.Error set.
+func (m *Manager) StatusAll() map[string]Status {
+	entries := m.snapshot()
+	all := make(map[string]Status, len(entries))
+	for _, e := range entries {
+		st, err := e.store.Status()
+		if err != nil {
+			st.Error = err.Error()
+		}
+		all[e.name] = st
+	}
+	return all
+}
+
+// CloseAll closes every registered Store and wipes its in-memory secrets,
+// even when it is shared through Open and stays open for other callers,
+// then empties the Manager. It returns the errors of the Close calls
+// joined.
+func (m *Manager) CloseAll() error {
+	m.mu.Lock()
+	stores := m.stores
+	m.stores = make(map[string]*Store)
+	m.mu.Unlock()
+
+	var errs []error
+	for _, name := range sortedNames(stores) {
+		s := stores[name]
+		if err := s.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+		s.WipeSecrets()
+	}
+	return errors.Join(errs...)
+}
+
+type managedStore struct {
+	name  string
+	store *Store
+}
+
+func (m *Manager) snapshot() []managedStore {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entries := make([]managedStore, 0, len(m.stores))
+	for _, name := range sortedNames(m.stores) {
+		entries = append(entries, managedStore{name: name, store: m.stores[name]})
+	}
+	return entries
+}
+
+func sortedNames(stores map[string]*Store) []string {
+	names := make([]string, 0, len(stores))
+	for name := range stores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,205 @@
+package keystore_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/theblitlabs/keystore"
+)
+
+func TestManagerRegistry(t *testing.T) {
+	m := keystore.NewManager()
+
+	var unknown *keystore.UnknownStoreError
+	if _, err := m.Get("wallet"); !errors.As(err, &unknown) || !errors.Is(err, keystore.ErrUnknownStore) || len(unknown.Registered) != 0 {
+		t.Fatalf("Get on an empty manager: got %v, want an UnknownStoreError listing nothing", err)
+	}
+
+	node, wallet := newErrorStore(t, keystore.Config{}), newErrorStore(t, keystore.Config{})
+	if err := m.Register("wallet", wallet); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Register("node", node); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := m.Get("node"); err != nil || got != node {
+		t.Fatalf("Get(node) = %p, %v, want %p", got, err, node)
+	}
+	if _, err := m.Get("deploy"); !errors.As(err, &unknown) || unknown.Name != "deploy" ||
+		!reflect.DeepEqual(unknown.Registered, []string{"node", "wallet"}) {
+		t.Fatalf("Get(deploy): got %v, want an UnknownStoreError listing node and wallet", err)
+	}
+	if got := m.Names(); !reflect.DeepEqual(got, []string{"node", "wallet"}) {
+		t.Fatalf("Names = %v", got)
+	}
+
+	tests := []struct {
+		name  string
+		store *keystore.Store
+		want  error
+	}{
+		{"wallet", node, keystore.ErrStoreRegistered},
+		{"", node, keystore.ErrInvalidRegistration},
+		{"deploy", nil, keystore.ErrInvalidRegistration},
+	}
+	for _, tt := range tests {
+		if err := m.Register(tt.name, tt.store); !errors.Is(err, tt.want) {
+			t.Errorf("Register(%q, %p): got %v, want %v", tt.name, tt.store, err, tt.want)
+		}
+	}
+	if got, _ := m.Get("wallet"); got != wallet {
+		t.Fatal("a rejected registration replaced the store")
+	}
+}
+
+func TestManagerRange(t *testing.T) {
+	m := keystore.NewManager()
+	for _, name := range []string{"c", "a", "b"} {
+		if err := m.Register(name, newErrorStore(t, keystore.Config{})); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var visited []string
+	err := m.Range(func(name string, s *keystore.Store) error {
+		visited = append(visited, name)
+		// Registering from fn does not deadlock and is not visited.
+		return m.Register(name+"2", s)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(visited, []string{"a", "b", "c"}) {
+		t.Fatalf("visited %v, want name order", visited)
+	}
+
+	stop := errors.New("stop")
+	visited = nil
+	err = m.Range(func(name string, _ *keystore.Store) error {
+		visited = append(visited, name)
+		if name == "a2" {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) || !reflect.DeepEqual(visited, []string{"a", "a2"}) {
+		t.Fatalf("Range: got %v after %v, want stop after a, a2", err, visited)
+	}
+}
+
+func TestManagerStatusAll(t *testing.T) {
+	m := keystore.NewManager()
+
+	withKey := newErrorStore(t, keystore.Config{})
+	if err := withKey.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	corruptDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(corruptDir, keystore.DefaultFileName), []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for name, s := range map[string]*keystore.Store{
+		"node":    withKey,
+		"empty":   newErrorStore(t, keystore.Config{}),
+		"corrupt": newErrorStore(t, keystore.Config{DirPath: corruptDir}),
+	} {
+		if err := m.Register(name, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	all := m.StatusAll()
+	if len(all) != 3 {
+		t.Fatalf("StatusAll returned %d stores, want 3", len(all))
+	}
+	if st := all["node"]; !st.HasPrivateKey || st.Error != "" {
+		t.Errorf("node: %+v", st)
+	}
+	if st := all["empty"]; st.Exists || st.Error != "" {
+		t.Errorf("empty: %+v", st)
+	}
+	if st := all["corrupt"]; st.Error == "" {
+		t.Errorf("corrupt: Error not set in %+v", st)
+	}
+}
+
+func TestManagerCloseAll(t *testing.T) {
+	m := keystore.NewManager()
+
+	var keys []string
+	for i := 0; i < 3; i++ {
+		ks := newErrorStore(t, keystore.Config{})
+		if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Register(fmt.Sprintf("store-%d", i), ks); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, fmt.Sprintf("store-%d", i))
+	}
+
+	var loaded []*keystore.Store
+	for _, name := range keys {
+		ks, _ := m.Get(name)
+		if _, err := ks.LoadPrivateKey(); err != nil {
+			t.Fatal(err)
+		}
+		loaded = append(loaded, ks)
+	}
+	key, err := loaded[0].LoadPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.CloseAll(); err != nil {
+		t.Fatalf("CloseAll: %v", err)
+	}
+	if key.D.Sign() != 0 {
+		t.Fatal("CloseAll left a loaded key in memory")
+	}
+	if names := m.Names(); len(names) != 0 {
+		t.Fatalf("Names after CloseAll = %v", names)
+	}
+	if err := m.Register(keys[0], loaded[0]); err != nil {
+		t.Fatalf("re-registering after CloseAll: %v", err)
+	}
+}
+
+func TestManagerConcurrentUse(t *testing.T) {
+	m := keystore.NewManager()
+	ks := newErrorStore(t, keystore.Config{})
+
+	const workers = 8
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		w := w
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				name := fmt.Sprintf("w%d-%d", w, i)
+				if err := m.Register(name, ks); err != nil {
+					t.Error(err)
+					return
+				}
+				if _, err := m.Get(name); err != nil {
+					t.Error(err)
+					return
+				}
+				m.StatusAll()
+				m.Range(func(string, *keystore.Store) error { return nil })
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := len(m.Names()); n != workers*20 {
+		t.Fatalf("%d stores registered, want %d", n, workers*20)
+	}
+}
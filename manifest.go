@@ -0,0 +1,291 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// ManifestAlgorithm identifies an ASN.1 ECDSA signature over the SHA-256
+// digest of the canonical manifest payload
+const ManifestAlgorithm = "ecdsa-sha256"
+
+// manifestSecretFields hold secrets or encrypted blobs. The manifest
+// payload carries their hashes instead of their values.
+var manifestSecretFields = []string{"private_key", "auth_token", "encrypted_key", "encrypted_token", "sealed_key", "ssh_key", "encrypted_ssh_key", "escrow", "key_shares"}
+
+// Manifest is a detached signature over a keystore document.
+type Manifest struct {
+	Algorithm string `json:"algorithm"`
+	KeyID     string `json:"key_id"`
+	Signature string `json:"signature"`
+}
+
+// ManifestPolicy decides what a save does with a manifest, since any save
+// changes the signed content.
+type ManifestPolicy int
+
+const (
+	// ManifestDrop removes the manifest on the first save. The file can
+	// no longer be verified afterwards, so ProvisioningPubKey should only
+	// be set until provisioning is complete.
+	ManifestDrop ManifestPolicy = iota
+
+	// ManifestResign signs each save with Config.ManifestSigningKey, which
+	// load then accepts alongside the provisioning key.
+	ManifestResign
+)
+
+// SignManifest returns the keystore document data with a manifest signed
+// by key, replacing any existing manifest. Provisioning services use it on
+// files produced by a Store.
+func SignManifest(data []byte, key *ecdsa.PrivateKey) ([]byte, error) {
+	doc, err := decodeDocument(data)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := newManifest(doc, key)
+	if err != nil {
+		return nil, err
+	}
+	doc["manifest"] = manifest
+
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// VerifyManifest checks that data carries a valid manifest signed by one
+// of keys.
+func VerifyManifest(data []byte, keys ...*ecdsa.PublicKey) error {
+	doc, err := decodeDocument(data)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrManifestInvalid, err)
+	}
+
+	raw, ok := doc["manifest"]
+	if !ok {
+		return fmt.Errorf("%w: keystore has no manifest", ErrManifestInvalid)
+	}
+
+	var manifest Manifest
+	if encoded, err := json.Marshal(raw); err != nil || json.Unmarshal(encoded, &manifest) != nil {
+		return fmt.Errorf("%w: malformed manifest", ErrManifestInvalid)
+	}
+
+	if manifest.Algorithm != ManifestAlgorithm {
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrManifestInvalid, manifest.Algorithm)
+	}
+
+	sig, err := hex.DecodeString(manifest.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: malformed signature", ErrManifestInvalid)
+	}
+
+	digest, err := manifestDigest(doc)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrManifestInvalid, err)
+	}
+
+	for _, key := range keys {
+		id, err := manifestKeyID(key)
+		if err != nil || id != manifest.KeyID {
+			continue
+		}
+		if !ecdsa.VerifyASN1(key, digest, sig) {
+			return fmt.Errorf("%w: signature does not match content", ErrManifestInvalid)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("%w: signed by unknown key %s", ErrManifestInvalid, manifest.KeyID)
+}
+
+func newManifest(doc map[string]any, key *ecdsa.PrivateKey) (*Manifest, error) {
+	id, err := manifestKeyID(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	digest, err := manifestDigest(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign manifest: %w", err)
+	}
+
+	return &Manifest{Algorithm: ManifestAlgorithm, KeyID: id, Signature: hex.EncodeToString(sig)}, nil
+}
+
+// manifestKeyID fingerprints a NIST-curve public key by its PKIX encoding.
+func manifestKeyID(key *ecdsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", fmt.Errorf("unsupported manifest key: %w", err)
+	}
+	return keyFingerprint(der), nil
+}
+
+// manifestDigest hashes the canonical payload of doc: every field except
+// the manifest, with secrets and encrypted blobs replaced by their hashes.
+func manifestDigest(doc map[string]any) ([]byte, error) {
+	payload := make(map[string]any, len(doc))
+	for k, v := range doc {
+		if k != "manifest" {
+			payload[k] = v
+		}
+	}
+
+	if err := hashSecretFields(payload); err != nil {
+		return nil, err
+	}
+
+	for _, nested := range nestedSecretMaps {
+		entries, ok := payload[nested].(map[string]any)
+		if !ok {
+			continue
+		}
+		hashed := make(map[string]any, len(entries))
+		for name, entry := range entries {
+			fields, ok := entry.(map[string]any)
+			if !ok {
+				hashed[name] = entry
+				continue
+			}
+			copied := make(map[string]any, len(fields))
+			for k, v := range fields {
+				copied[k] = v
+			}
+			if err := hashSecretFields(copied); err != nil {
+				return nil, err
+			}
+			hashed[name] = copied
+		}
+		payload[nested] = hashed
+	}
+
+	canonical, err := canonicalJSON(payload)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(canonical)
+	return sum[:], nil
+}
+
+func hashSecretFields(fields map[string]any) error {
+	for _, name := range manifestSecretFields {
+		v, ok := fields[name]
+		if !ok {
+			continue
+		}
+		canonical, err := canonicalJSON(v)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(canonical)
+		fields[name] = "sha256:" + hex.EncodeToString(sum[:])
+	}
+	return nil
+}
+
+// decodeDocument parses a keystore document, keeping numbers exact. Like
+// json.Unmarshal, it rejects anything after the document.
+func decodeDocument(data []byte) (map[string]any, error) {
+	var doc map[string]any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCorruptKeystore, err)
+	}
+	if doc == nil {
+		return nil, fmt.Errorf("%w: document is null", ErrCorruptKeystore)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("%w: unexpected data after the document", ErrCorruptKeystore)
+	}
+	return doc, nil
+}
+
+// checkManifest enforces Config.ProvisioningPubKey on a loaded document. A
+// file whose manifest this Store dropped under ManifestDrop is accepted.
+func (s *Store) checkManifest(data []byte) error {
+	if s.config.ProvisioningPubKey == nil {
+		return nil
+	}
+
+	keys := []*ecdsa.PublicKey{s.config.ProvisioningPubKey}
+	if s.config.ManifestSigningKey != nil {
+		keys = append(keys, &s.config.ManifestSigningKey.PublicKey)
+	}
+
+	err := VerifyManifest(data, keys...)
+	if err != nil && s.manifestDropped {
+		var header struct {
+			Manifest *Manifest `json:"manifest"`
+		}
+		if json.Unmarshal(data, &header) == nil && header.Manifest == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// applyManifestPolicy prepares the manifest for a save of data, returning
+// the document to write.
+func (s *Store) applyManifestPolicy(data []byte) ([]byte, error) {
+	if s.Manifest == nil {
+		return data, nil
+	}
+
+	if s.config.ManifestPolicy != ManifestResign {
+		s.Manifest = nil
+		s.manifestDropped = true
+		return s.marshal()
+	}
+
+	// Sign the document as it will be written, minus the manifest itself.
+	s.Manifest = nil
+	unsigned, err := s.marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := decodeDocument(unsigned)
+	if err != nil {
+		return nil, err
+	}
+	if s.Manifest, err = newManifest(doc, s.config.ManifestSigningKey); err != nil {
+		return nil, err
+	}
+	return s.marshal()
+}
+
+func validateManifestConfig(cfg Config) error {
+	if cfg.ManifestPolicy == ManifestResign && cfg.ManifestSigningKey == nil {
+		return configError("ManifestSigningKey", "ManifestResign requires a ManifestSigningKey")
+	}
+	for _, key := range []*ecdsa.PublicKey{cfg.ProvisioningPubKey, signingPub(cfg.ManifestSigningKey)} {
+		if key == nil {
+			continue
+		}
+		if _, err := manifestKeyID(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func signingPub(key *ecdsa.PrivateKey) *ecdsa.PublicKey {
+	if key == nil {
+		return nil
+	}
+	return &key.PublicKey
+}
@@ -0,0 +1,188 @@
+package keystore_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/theblitlabs/keystore"
+)
+
+// newProvisionedKeystore writes a keystore holding fileKeyHex and a token
+// to dir, signed by key, and returns the signed contents.
+func newProvisionedKeystore(t *testing.T, dir string, key *ecdsa.PrivateKey) []byte {
+	t.Helper()
+
+	ks := newErrorStore(t, keystore.Config{DirPath: dir})
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveToken("provisioned"); err != nil {
+		t.Fatal(err)
+	}
+	signed, err := keystore.SignManifest(readKeystoreFile(t, dir, keystore.DefaultFileName), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, keystore.DefaultFileName), signed, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestProvisioningPubKey(t *testing.T) {
+	provisioning, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A keystore signed by the provisioning key loads.
+	dir := t.TempDir()
+	newProvisionedKeystore(t, dir, provisioning)
+	ks := newErrorStore(t, keystore.Config{DirPath: dir, ProvisioningPubKey: &provisioning.PublicKey})
+	if token, err := ks.LoadToken(); err != nil || token != "provisioned" {
+		t.Fatalf("LoadToken of a signed keystore = %q, %v", token, err)
+	}
+	if key, err := ks.GetPrivateKeyHex(); err != nil || key != fileKeyHex {
+		t.Fatalf("GetPrivateKeyHex of a signed keystore: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name  string
+		setup func(t *testing.T, dir string)
+	}{
+		{"unsigned", func(t *testing.T, dir string) {
+			newProvisionedKeystore(t, dir, provisioning)
+			editKeystore(t, dir, func(doc map[string]any) { delete(doc, "manifest") })
+		}},
+		{"signed by another key", func(t *testing.T, dir string) {
+			newProvisionedKeystore(t, dir, other)
+		}},
+		{"changed field", func(t *testing.T, dir string) {
+			newProvisionedKeystore(t, dir, provisioning)
+			editKeystore(t, dir, func(doc map[string]any) { doc["network_name"] = "attacker" })
+		}},
+		{"changed secret", func(t *testing.T, dir string) {
+			newProvisionedKeystore(t, dir, provisioning)
+			editKeystore(t, dir, func(doc map[string]any) { doc["private_key"] = credentialKeyHex })
+		}},
+		{"malformed signature", func(t *testing.T, dir string) {
+			newProvisionedKeystore(t, dir, provisioning)
+			editKeystore(t, dir, func(doc map[string]any) {
+				doc["manifest"].(map[string]any)["signature"] = "not hex"
+			})
+		}},
+		{"unsupported algorithm", func(t *testing.T, dir string) {
+			newProvisionedKeystore(t, dir, provisioning)
+			editKeystore(t, dir, func(doc map[string]any) {
+				doc["manifest"].(map[string]any)["algorithm"] = "none"
+			})
+		}},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tt.setup(t, dir)
+			data := readKeystoreFile(t, dir, keystore.DefaultFileName)
+			if err := keystore.VerifyManifest(data, &provisioning.PublicKey); !errors.Is(err, keystore.ErrManifestInvalid) {
+				t.Fatalf("VerifyManifest: got %v, want ErrManifestInvalid", err)
+			}
+
+			// Nothing from the file is returned, and nothing is rewritten.
+			ks := newErrorStore(t, keystore.Config{DirPath: dir, ProvisioningPubKey: &provisioning.PublicKey})
+			if token, err := ks.LoadToken(); !errors.Is(err, keystore.ErrManifestInvalid) {
+				t.Fatalf("LoadToken = %q, %v, want ErrManifestInvalid", token, err)
+			}
+			if _, err := ks.LoadPrivateKey(); !errors.Is(err, keystore.ErrManifestInvalid) {
+				t.Fatalf("LoadPrivateKey: got %v, want ErrManifestInvalid", err)
+			}
+			if err := ks.SaveToken("replacement"); !errors.Is(err, keystore.ErrManifestInvalid) {
+				t.Fatalf("SaveToken: got %v, want ErrManifestInvalid", err)
+			}
+			if got := readKeystoreFile(t, dir, keystore.DefaultFileName); string(got) != string(data) {
+				t.Fatal("a Store that rejected the manifest rewrote the keystore")
+			}
+
+			// Without ProvisioningPubKey the manifest is not checked.
+			if _, err := newErrorStore(t, keystore.Config{DirPath: dir}).LoadToken(); err != nil {
+				t.Fatalf("LoadToken without ProvisioningPubKey: %v", err)
+			}
+		})
+	}
+
+	// Manifests are signed with NIST curves, which x509 can encode.
+	secp := mustKey(t, fileKeyHex)
+	_, err = keystore.NewKeystore(keystore.Config{DirPath: t.TempDir(), ProvisioningPubKey: &secp.PublicKey, Logger: discardLogger})
+	if err == nil {
+		t.Fatal("NewKeystore accepted a secp256k1 ProvisioningPubKey")
+	}
+}
+
+func TestManifestPolicy(t *testing.T) {
+	provisioning, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	device, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("drop", func(t *testing.T) {
+		dir := t.TempDir()
+		newProvisionedKeystore(t, dir, provisioning)
+		ks := newErrorStore(t, keystore.Config{DirPath: dir, ProvisioningPubKey: &provisioning.PublicKey})
+		if err := ks.SaveToken("rotated"); err != nil {
+			t.Fatalf("SaveToken: %v", err)
+		}
+
+		// The Store that dropped the manifest keeps loading the file; a new
+		// one requiring the manifest does not.
+		if token, err := ks.LoadToken(); err != nil || token != "rotated" {
+			t.Fatalf("LoadToken after the save = %q, %v", token, err)
+		}
+		fresh := newErrorStore(t, keystore.Config{DirPath: dir, ProvisioningPubKey: &provisioning.PublicKey})
+		if _, err := fresh.LoadToken(); !errors.Is(err, keystore.ErrManifestInvalid) {
+			t.Fatalf("LoadToken by a new Store: got %v, want ErrManifestInvalid", err)
+		}
+	})
+
+	t.Run("resign", func(t *testing.T) {
+		dir := t.TempDir()
+		newProvisionedKeystore(t, dir, provisioning)
+		cfg := keystore.Config{
+			DirPath:            dir,
+			ProvisioningPubKey: &provisioning.PublicKey,
+			ManifestPolicy:     keystore.ManifestResign,
+			ManifestSigningKey: device,
+		}
+		if err := newErrorStore(t, cfg).SaveToken("rotated"); err != nil {
+			t.Fatalf("SaveToken: %v", err)
+		}
+
+		// The save is signed by the device key, which a new Store accepts.
+		data := readKeystoreFile(t, dir, keystore.DefaultFileName)
+		if err := keystore.VerifyManifest(data, &device.PublicKey); err != nil {
+			t.Fatalf("VerifyManifest with the device key: %v", err)
+		}
+		if err := keystore.VerifyManifest(data, &provisioning.PublicKey); !errors.Is(err, keystore.ErrManifestInvalid) {
+			t.Fatalf("VerifyManifest with the provisioning key: got %v, want ErrManifestInvalid", err)
+		}
+		if token, err := newErrorStore(t, cfg).LoadToken(); err != nil || token != "rotated" {
+			t.Fatalf("LoadToken by a new Store = %q, %v", token, err)
+		}
+	})
+
+	_, err = keystore.NewKeystore(keystore.Config{DirPath: t.TempDir(), ManifestPolicy: keystore.ManifestResign, Logger: discardLogger})
+	if !errors.Is(err, keystore.ErrInvalidConfig) {
+		t.Fatalf("NewKeystore with ManifestResign and no signing key: got %v, want ErrInvalidConfig", err)
+	}
+}
@@ -0,0 +1,326 @@
+package keystore
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ConflictStrategy decides how Merge resolves entries present in both
+// keystores with different values.
+type ConflictStrategy int
+
+const (
+	// FailOnConflict aborts the merge without writing anything
+	FailOnConflict ConflictStrategy = iota
+
+	// PreferLocal keeps the entry of the current keystore
+	PreferLocal
+
+	// PreferOther replaces the entry with the one from the other keystore
+	PreferOther
+)
+
+// MergeEntry describes one item considered by a merge: "private_key",
+// "auth_token" or "account:<name>".
+type MergeEntry struct {
+	Item   string `json:"item"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// MergeReport lists what a merge added, skipped as already present and found
+// in conflict.
+type MergeReport struct {
+	Added     []MergeEntry `json:"added"`
+	Skipped   []MergeEntry `json:"skipped"`
+	Conflicts []MergeEntry `json:"conflicts"`
+}
+
+// mergeToken is a decrypted token with its metadata.
+type mergeToken struct {
+	value     string
+	createdAt int64
+	expiresAt int64
+}
+
+// Merge folds the keystore file at otherPath into this one: its primary key,
+// token, accounts and default account. Secrets are re-encrypted with this
+// Store's settings, so the other file must be readable with the same
+// passphrase configuration. Entries present in both with different values are
+// resolved by strategy; with FailOnConflict the merge fails with
+// ErrMergeConflict and nothing is written. The result is a single write and
+// the other file is never modified.
+func (s *Store) Merge(otherPath string, strategy ConflictStrategy) (MergeReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := MergeReport{Added: []MergeEntry{}, Skipped: []MergeEntry{}, Conflicts: []MergeEntry{}}
+
+	if b, ok := s.backend.(*FileBackend); ok && samePath(b.path, otherPath) {
+		return report, fmt.Errorf("%w: cannot merge %s into itself", ErrMergeConflict, otherPath)
+	}
+
+	cfg := s.config
+	cfg.Backend = NewFileBackend(otherPath)
+	cfg.Ephemeral = false
+	cfg.SystemdCredentials = false
+	cfg.KeyFromEnv = ""
+	cfg.ExpectedAddress = common.Address{}
+	cfg.RequireEncryption = false
+	cfg.WarnOnAddressMismatch = true
+
+	other, err := NewKeystore(cfg)
+	if err != nil {
+		return report, err
+	}
+	other.unlocked = s.unlocked
+
+	if err := other.load(); err != nil {
+		return report, fmt.Errorf("failed to load %s: %w", otherPath, err)
+	}
+
+	return s.mergeStore(other, strategy, otherPath)
+}
+
+// mergeStore folds the loaded state of other, read from source, into this
+// Store in one load-merge-write cycle. Keys taken from other are recorded
+// as restored from source.
+func (s *Store) mergeStore(other *Store, strategy ConflictStrategy, source string) (MergeReport, error) {
+	report := MergeReport{Added: []MergeEntry{}, Skipped: []MergeEntry{}, Conflicts: []MergeEntry{}}
+
+	err := s.update(func() error {
+		conflict := func(item, reason string) bool {
+			switch strategy {
+			case PreferOther:
+				report.Conflicts = append(report.Conflicts, MergeEntry{Item: item, Reason: reason + "; replaced"})
+				return true
+			case PreferLocal:
+				report.Conflicts = append(report.Conflicts, MergeEntry{Item: item, Reason: reason + "; kept local"})
+			default:
+				report.Conflicts = append(report.Conflicts, MergeEntry{Item: item, Reason: reason})
+			}
+			return false
+		}
+
+		if err := s.mergePrimaryKey(other, source, &report, conflict); err != nil {
+			return err
+		}
+
+		if err := s.mergeToken(other, &report, conflict); err != nil {
+			return err
+		}
+
+		if err := s.mergeAccounts(other, source, &report, conflict); err != nil {
+			return err
+		}
+
+		if s.DefaultAccount == "" && other.DefaultAccount != "" {
+			if _, ok := s.Accounts[other.DefaultAccount]; ok {
+				s.DefaultAccount = other.DefaultAccount
+			}
+		}
+		if s.EncryptionAccount == "" && other.EncryptionAccount != "" {
+			if _, ok := s.Accounts[other.EncryptionAccount]; ok {
+				s.EncryptionAccount = other.EncryptionAccount
+			}
+		}
+
+		if strategy == FailOnConflict && len(report.Conflicts) > 0 {
+			return fmt.Errorf("%w: %d conflicting entries", ErrMergeConflict, len(report.Conflicts))
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	s.rearmWatchers()
+	return report, nil
+}
+
+func (s *Store) mergePrimaryKey(other *Store, source string, report *MergeReport, conflict func(item, reason string) bool) error {
+	const item = "private_key"
+
+	if other.persisted.PrivateKey == "" && other.EncryptedKey == nil {
+		return nil
+	}
+
+	if err := other.checkEthereumKey(); err != nil {
+		return fmt.Errorf("cannot merge primary key: %w", err)
+	}
+
+	otherHex, err := other.privateKeyHex()
+	if err != nil {
+		return fmt.Errorf("failed to read other private key: %w", err)
+	}
+
+	key, err := parsePrivateKeyHex(otherHex)
+	if err != nil {
+		return fmt.Errorf("invalid private key in other keystore: %w", err)
+	}
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+
+	if s.persisted.PrivateKey != "" || s.EncryptedKey != nil {
+		localHex, err := s.privateKeyHex()
+		if err != nil {
+			return err
+		}
+		if localHex == otherHex {
+			report.Skipped = append(report.Skipped, MergeEntry{Item: item, Reason: "identical"})
+			return nil
+		}
+		if !conflict(item, fmt.Sprintf("local key is %s, other is %s", s.Address, addr.Hex())) {
+			return nil
+		}
+	} else {
+		report.Added = append(report.Added, MergeEntry{Item: item, Reason: addr.Hex()})
+	}
+
+	if err := s.checkExpectedAddress(key); err != nil {
+		return err
+	}
+
+	if err := s.setPrimaryKey(otherHex, key, s.newProvenance(ProvenanceRestored, source)); err != nil {
+		return err
+	}
+	s.ChainID = other.ChainID
+	s.NetworkName = other.NetworkName
+	s.KeyPurpose = other.KeyPurpose
+	return nil
+}
+
+func (s *Store) mergeToken(other *Store, report *MergeReport, conflict func(item, reason string) bool) error {
+	const item = "auth_token"
+
+	theirs, err := other.storedToken()
+	if err != nil || theirs == nil {
+		return err
+	}
+
+	if s.creds.authToken != "" {
+		report.Skipped = append(report.Skipped, MergeEntry{Item: item, Reason: "provided by systemd credentials"})
+		return nil
+	}
+
+	ours, err := s.storedToken()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case ours == nil:
+		report.Added = append(report.Added, MergeEntry{Item: item})
+	case ours.value == theirs.value:
+		report.Skipped = append(report.Skipped, MergeEntry{Item: item, Reason: "identical"})
+		return nil
+	case !conflict(item, "tokens differ"):
+		return nil
+	}
+
+	if err := s.setToken(theirs.value, 0); err != nil {
+		return err
+	}
+	s.persisted.CreatedAt = theirs.createdAt
+	s.ExpiresAt = theirs.expiresAt
+	return s.attestToken(theirs.value)
+}
+
+// storedToken returns the decrypted persisted token, or nil if there is none.
+func (s *Store) storedToken() (*mergeToken, error) {
+	if s.persisted.AuthToken == "" && s.EncryptedToken == nil {
+		return nil, nil
+	}
+
+	value, err := s.authToken()
+	if err != nil {
+		return nil, err
+	}
+
+	if s.TokenDevice != "" {
+		if value, err = s.unbindToken(value); err != nil {
+			return nil, err
+		}
+	}
+
+	return &mergeToken{value: value, createdAt: s.persisted.CreatedAt, expiresAt: s.ExpiresAt}, nil
+}
+
+func (s *Store) mergeAccounts(other *Store, source string, report *MergeReport, conflict func(item, reason string) bool) error {
+	names := make([]string, 0, len(other.Accounts))
+	for name := range other.Accounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		item := "account:" + name
+		theirs := other.Accounts[name]
+
+		ours, exists := s.Accounts[name]
+		if exists {
+			sameAddress := common.HexToAddress(ours.Address) == common.HexToAddress(theirs.Address)
+			switch {
+			case sameAddress && (theirs.WatchOnly || !ours.WatchOnly):
+				report.Skipped = append(report.Skipped, MergeEntry{Item: item, Reason: "already present"})
+				continue
+			case !sameAddress && !conflict(item, fmt.Sprintf("local address %s, other %s", ours.Address, theirs.Address)):
+				continue
+			}
+		}
+
+		account := &Account{
+			Address:     theirs.Address,
+			WatchOnly:   theirs.WatchOnly,
+			CreatedAt:   theirs.CreatedAt,
+			Labels:      copyLabels(theirs.Labels),
+			ChainID:     theirs.ChainID,
+			NetworkName: theirs.NetworkName,
+			Purpose:     theirs.Purpose,
+		}
+		if exists && common.HexToAddress(ours.Address) == common.HexToAddress(theirs.Address) {
+			for k, v := range ours.Labels {
+				setLabel(account, k, v)
+			}
+		}
+
+		if !theirs.WatchOnly {
+			privateKeyHex, err := other.openKey(theirs.PrivateKey, theirs.EncryptedKey)
+			if err != nil {
+				return fmt.Errorf("failed to read other account %q: %w", name, err)
+			}
+			if key, err := crypto.HexToECDSA(privateKeyHex); err == nil {
+				err = s.checkTestKey(key)
+				wipeECDSA(key)
+				if err != nil {
+					return fmt.Errorf("account %q: %w", name, err)
+				}
+			}
+			if account.PrivateKey, account.EncryptedKey, err = s.sealKey(privateKeyHex); err != nil {
+				return err
+			}
+			account.Provenance = s.newProvenance(ProvenanceRestored, source)
+		}
+
+		if s.Accounts == nil {
+			s.Accounts = make(map[string]*Account)
+		}
+		s.Accounts[name] = account
+
+		if !exists {
+			report.Added = append(report.Added, MergeEntry{Item: item, Reason: theirs.Address})
+		} else if common.HexToAddress(ours.Address) == common.HexToAddress(theirs.Address) {
+			report.Added = append(report.Added, MergeEntry{Item: item, Reason: "upgraded watch-only account"})
+		}
+	}
+
+	return nil
+}
+
+func samePath(a, b string) bool {
+	a, errA := filepath.Abs(a)
+	b, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && a == b
+}
@@ -0,0 +1,67 @@
+package keystore
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+)
+
+// SignMessage signs msg as an EIP-191 personal message, the way wallets
+// such as MetaMask implement personal_sign: the Keccak-256 digest of
+// "\x19Ethereum Signed Message:\n" followed by the length of msg and msg
+// itself is signed as SignDigest does. The recovery id of a 65-byte
+// signature is returned as 27 or 28. RecoverAddress recovers the signer.
+func (s *Store) SignMessage(msg []byte) ([]byte, error) {
+	sig, err := s.SignDigest(accounts.TextHash(msg))
+	if err != nil {
+		return nil, err
+	}
+	if len(sig) == ethcrypto.SignatureLength && sig[ethcrypto.RecoveryIDOffset] < 27 {
+		sig[ethcrypto.RecoveryIDOffset] += 27
+	}
+	return sig, nil
+}
+
+// RecoverAddress returns the address that signed msg as an EIP-191
+// personal message, as SignMessage and wallets do. See
+// RecoverAddressFromHash for the accepted signatures.
+func RecoverAddress(msg, sig []byte) (common.Address, error) {
+	return RecoverAddressFromHash(accounts.TextHash(msg), sig)
+}
+
+// RecoverAddressFromHash returns the address that signed the 32-byte hash.
+// sig is a 65-byte [R || S || V] signature whose recovery id V is either 0
+// or 1, as SignDigest and SignWithAccount return, or 27 or 28, as wallets
+// and SignMessage return. Anything else fails with ErrInvalidSignature,
+// including 64-byte signatures, which lack the recovery id. A hash that is
+// not 32 bytes fails with ErrInvalidHash.
+func RecoverAddressFromHash(hash, sig []byte) (common.Address, error) {
+	if len(hash) != common.HashLength {
+		return common.Address{}, fmt.Errorf("%w: expected %d bytes, got %d", ErrInvalidHash, common.HashLength, len(hash))
+	}
+	switch {
+	case len(sig) == ethcrypto.SignatureLength-1:
+		return common.Address{}, fmt.Errorf("%w: 64-byte signature has no recovery id; expected 65 bytes [R || S || V]", ErrInvalidSignature)
+	case len(sig) != ethcrypto.SignatureLength:
+		return common.Address{}, fmt.Errorf("%w: expected %d bytes, got %d", ErrInvalidSignature, ethcrypto.SignatureLength, len(sig))
+	}
+
+	normalized := make([]byte, len(sig))
+	copy(normalized, sig)
+	v := normalized[ethcrypto.RecoveryIDOffset]
+	switch v {
+	case 0, 1:
+	case 27, 28:
+		normalized[ethcrypto.RecoveryIDOffset] = v - 27
+	default:
+		return common.Address{}, fmt.Errorf("%w: recovery id %d is not 0, 1, 27 or 28", ErrInvalidSignature, v)
+	}
+
+	pub, err := ethcrypto.SigToPub(hash, normalized)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	return ethcrypto.PubkeyToAddress(*pub), nil
+}
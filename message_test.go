@@ -0,0 +1,143 @@
+package keystore_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/theblitlabs/keystore"
+)
+
+// The personal_sign example of the web3.js and ethers documentation:
+// "Some data" signed with fileKeyHex.
+const (
+	walletMessage   = "Some data"
+	walletSignature = "b91467e570a6466aa9e9876cbcd013baba02900b8979d43fe208a4a4f339f5fd" +
+		"6007e74cd82e037b800186422fc2da167c747ef045e5d18a5f5d4300f8e1a029" + "1c"
+	walletSigner = "0x2c7536E3605D9C16a7a3D7b1898e529396a65c23"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestRecoverAddressWalletFixture(t *testing.T) {
+	sig := mustHex(t, walletSignature)
+
+	// Wallets use 27/28; SignDigest and go-ethereum use 0/1.
+	zeroOne := append([]byte(nil), sig...)
+	zeroOne[64] -= 27
+
+	for name, s := range map[string][]byte{"27/28": sig, "0/1": zeroOne} {
+		addr, err := keystore.RecoverAddress([]byte(walletMessage), s)
+		if err != nil || addr != common.HexToAddress(walletSigner) {
+			t.Errorf("RecoverAddress with a %s recovery id = %s, %v, want %s", name, addr.Hex(), err, walletSigner)
+		}
+	}
+
+	ks := newErrorStore(t, keystore.Config{})
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ks.SignMessage([]byte(walletMessage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, sig) {
+		t.Fatalf("SignMessage = %x, want the wallet signature %s", got, walletSignature)
+	}
+}
+
+func TestRecoverAddressRoundTrip(t *testing.T) {
+	ks := newErrorStore(t, keystore.Config{})
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveAccount("ops", credentialKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	primary := crypto.PubkeyToAddress(mustKey(t, fileKeyHex).PublicKey)
+	account := crypto.PubkeyToAddress(mustKey(t, credentialKeyHex).PublicKey)
+
+	for _, msg := range [][]byte{nil, []byte("a"), bytes.Repeat([]byte("long message "), 100)} {
+		sig, err := ks.SignMessage(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := sig[64]; v != 27 && v != 28 {
+			t.Fatalf("SignMessage recovery id = %d, want 27 or 28", v)
+		}
+		if addr, err := keystore.RecoverAddress(msg, sig); err != nil || addr != primary {
+			t.Fatalf("RecoverAddress(SignMessage(%d bytes)) = %s, %v", len(msg), addr.Hex(), err)
+		}
+	}
+
+	hash := crypto.Keccak256([]byte("digest"))
+	sig, err := ks.SignDigest(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr, err := keystore.RecoverAddressFromHash(hash, sig); err != nil || addr != primary {
+		t.Fatalf("RecoverAddressFromHash(SignDigest) = %s, %v", addr.Hex(), err)
+	}
+	sig, err = ks.SignWithAccount("ops", hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr, err := keystore.RecoverAddressFromHash(hash, sig); err != nil || addr != account {
+		t.Fatalf("RecoverAddressFromHash(SignWithAccount) = %s, %v", addr.Hex(), err)
+	}
+}
+
+func TestRecoverAddressMalformed(t *testing.T) {
+	sig := mustHex(t, walletSignature)
+	withV := func(v byte) []byte {
+		s := append([]byte(nil), sig...)
+		s[64] = v
+		return s
+	}
+	hash := crypto.Keccak256([]byte(walletMessage))
+
+	tests := []struct {
+		name string
+		hash []byte
+		sig  []byte
+		want error
+	}{
+		{"64-byte signature", hash, sig[:64], keystore.ErrInvalidSignature},
+		{"66-byte signature", hash, append(append([]byte(nil), sig...), 0), keystore.ErrInvalidSignature},
+		{"empty signature", hash, nil, keystore.ErrInvalidSignature},
+		{"recovery id 2", hash, withV(2), keystore.ErrInvalidSignature},
+		{"recovery id 26", hash, withV(26), keystore.ErrInvalidSignature},
+		{"recovery id 29", hash, withV(29), keystore.ErrInvalidSignature},
+		{"short hash", hash[:31], sig, keystore.ErrInvalidHash},
+		{"long hash", append(append([]byte(nil), hash...), 0), sig, keystore.ErrInvalidHash},
+		{"zero signature", hash, make([]byte, 65), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, err := keystore.RecoverAddressFromHash(tt.hash, tt.sig)
+			if err == nil {
+				t.Fatalf("RecoverAddressFromHash = %s, want an error", addr.Hex())
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("RecoverAddressFromHash: got %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// A signature over another message recovers some other address rather
+	// than failing, so callers must compare the result.
+	if addr, err := keystore.RecoverAddress([]byte("other data"), sig); err != nil || addr == common.HexToAddress(walletSigner) {
+		t.Fatalf("RecoverAddress of another message = %s, %v", addr.Hex(), err)
+	}
+}
@@ -0,0 +1,42 @@
+package keystore
+
+import "fmt"
+
+// SchemaVersion is the version of the on-disk format written by this package.
+// Files without a version field are treated as version 1.
+const SchemaVersion = 3
+
+// migrations upgrade a loaded keystore by one version each: migrations[i]
+// converts version i+1 to version i+2. Upgraded files are rewritten in the
+// current format on the next save.
+var migrations = []func(*Store){
+	migrateExpiresAt,
+	migrateProvenance,
+}
+
+func (s *Store) migrate() error {
+	version := s.Version
+	if version == 0 {
+		version = 1
+	}
+	s.fileVersion = version
+
+	if version > SchemaVersion {
+		return fmt.Errorf("%w: file version %d, supported %d", ErrUnsupportedVersion, version, SchemaVersion)
+	}
+
+	for ; version < SchemaVersion; version++ {
+		migrations[version-1](s)
+	}
+
+	s.Version = version
+	return nil
+}
+
+// migrateExpiresAt derives the absolute expiry that version 1 files implied
+// from their creation time.
+func migrateExpiresAt(s *Store) {
+	if s.ExpiresAt == 0 && s.persisted.CreatedAt != 0 {
+		s.ExpiresAt = s.persisted.CreatedAt + int64(TokenExpiryDuration.Seconds())
+	}
+}
@@ -0,0 +1,137 @@
+package keystore
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// MirrorStatus reports how far the mirror written with Config.MirrorPath
+// lags behind the primary keystore.
+type MirrorStatus struct {
+	Path            string     `json:"path"`
+	PrimaryRevision int64      `json:"primary_revision"`
+	MirrorRevision  int64      `json:"mirror_revision"`
+	Lag             int64      `json:"lag"`
+	LastMirroredAt  *time.Time `json:"last_mirrored_at,omitempty"`
+	LastError       string     `json:"last_error,omitempty"`
+	Recovered       bool       `json:"recovered"`
+}
+
+// MirrorStatus compares the revisions of the primary keystore and its
+// mirror; Lag is negative while the primary is lost. LastMirroredAt and
+// LastError describe the last mirror write by this Store, and Recovered
+// reports that the keystore is being served from the mirror because the
+// primary is missing or corrupt.
+func (s *Store) MirrorStatus() (MirrorStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := s.config.MirrorPath
+	if path == "" {
+		return MirrorStatus{}, configError("MirrorPath", "no mirror is configured")
+	}
+
+	st := MirrorStatus{Path: path, LastError: s.mirrorErr, Recovered: s.fromMirror}
+	if !s.mirroredAt.IsZero() {
+		mirroredAt := s.mirroredAt
+		st.LastMirroredAt = &mirroredAt
+	}
+
+	data, err := s.readBackend()
+	switch {
+	case err == nil:
+		st.PrimaryRevision, err = s.revisionOf(data)
+		wipe(data)
+		if err != nil && !s.fromMirror {
+			return st, err
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return st, fmt.Errorf("failed to read keystore: %w", err)
+	}
+
+	if st.MirrorRevision, err = s.mirrorRevision(); err != nil {
+		return st, err
+	}
+	st.Lag = st.PrimaryRevision - st.MirrorRevision
+	return st, nil
+}
+
+// mirrorRevision reads the revision stored in the mirror, zero if there is
+// none.
+func (s *Store) mirrorRevision() (int64, error) {
+	data, err := os.ReadFile(s.config.MirrorPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read mirror: %w", err)
+	}
+	defer wipe(data)
+
+	return s.revisionOf(data)
+}
+
+// writeMirror copies data, just written to the backend, to the mirror
+// with the primary file's permissions. Failures are logged and audited but
+// do not fail the save.
+func (s *Store) writeMirror(data []byte) {
+	path := s.config.MirrorPath
+	if path == "" {
+		return
+	}
+
+	mode := os.FileMode(DefaultFileMode)
+	if b, ok := s.backend.(*FileBackend); ok {
+		if info, err := os.Stat(b.path); err == nil {
+			mode = info.Mode().Perm()
+		}
+	}
+
+	err := os.MkdirAll(filepath.Dir(path), DefaultDirMode)
+	if err == nil {
+		err = writeFileAtomic(path, data, mode)
+	}
+	if err != nil {
+		s.mirrorErr = err.Error()
+		s.config.Logger.Warn("keystore: failed to write mirror", "path", path, "error", err)
+		s.audit(AuditMirror, "", fmt.Errorf("failed to write mirror: %w", err))
+		return
+	}
+
+	s.mirrorErr = ""
+	s.mirroredAt = s.now()
+}
+
+// loadMirror loads the mirror in place of a primary keystore that is
+// missing or corrupt, as described by cause. It reports false, leaving
+// cause to be returned, if there is no usable mirror.
+func (s *Store) loadMirror(cause error) bool {
+	path := s.config.MirrorPath
+	if path == "" {
+		return false
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			s.config.Logger.Warn("keystore: failed to read mirror", "path", path, "error", err)
+		}
+		return false
+	}
+	defer wipe(data)
+
+	if err := s.loadDocument(data); err != nil {
+		s.config.Logger.Warn("keystore: mirror is unusable", "path", path, "error", err)
+		return false
+	}
+
+	s.fromMirror = true
+	s.loadedAt = s.now()
+	s.config.Logger.Warn("keystore: primary keystore unusable, loaded mirror", "path", path, "error", cause)
+	s.audit(AuditMirror, "", fmt.Errorf("%w: %v", ErrRecoveredFromMirror, cause))
+	return true
+}
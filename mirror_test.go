@@ -0,0 +1,216 @@
+package keystore_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/theblitlabs/keystore"
+)
+
+func newMirrorStore(t *testing.T, dir, mirror string, audit func(keystore.AuditEvent)) *keystore.Store {
+	t.Helper()
+
+	ks, err := keystore.NewKeystore(keystore.Config{
+		DirPath:    dir,
+		MirrorPath: mirror,
+		Logger:     discardLogger,
+		Audit:      audit,
+	})
+	if err != nil {
+		t.Fatalf("NewKeystore: %v", err)
+	}
+	return ks
+}
+
+func assertMirrored(t *testing.T, dir, mirror string) {
+	t.Helper()
+
+	primary, err := os.ReadFile(filepath.Join(dir, keystore.DefaultFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	copied, err := os.ReadFile(mirror)
+	if err != nil {
+		t.Fatalf("reading mirror: %v", err)
+	}
+	if !bytes.Equal(primary, copied) {
+		t.Fatal("mirror differs from the primary keystore")
+	}
+}
+
+func TestMirrorWrittenOnSave(t *testing.T) {
+	dir := t.TempDir()
+	mirror := filepath.Join(t.TempDir(), "backup", "keystore.json")
+	ks := newMirrorStore(t, dir, mirror, nil)
+
+	if err := ks.SaveToken("first"); err != nil {
+		t.Fatal(err)
+	}
+	assertMirrored(t, dir, mirror)
+
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	assertMirrored(t, dir, mirror)
+	info, err := os.Stat(mirror)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != keystore.DefaultFileMode {
+		t.Fatalf("mirror mode = %v, want %v", info.Mode().Perm(), os.FileMode(keystore.DefaultFileMode))
+	}
+
+	st, err := ks.MirrorStatus()
+	if err != nil {
+		t.Fatalf("MirrorStatus: %v", err)
+	}
+	if st.PrimaryRevision != 2 || st.MirrorRevision != 2 || st.Lag != 0 || st.LastMirroredAt == nil || st.LastError != "" || st.Recovered {
+		t.Fatalf("MirrorStatus = %+v", st)
+	}
+}
+
+func TestMirrorRecovery(t *testing.T) {
+	tests := []struct {
+		name    string
+		damage  func(path string) error
+		wantLag int64
+	}{
+		{name: "missing", damage: os.Remove, wantLag: -1},
+		{name: "corrupt", damage: func(path string) error { return os.WriteFile(path, []byte("{not json"), 0o600) }, wantLag: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			mirror := filepath.Join(t.TempDir(), "keystore.json")
+			if err := newMirrorStore(t, dir, mirror, nil).SaveToken("mirrored"); err != nil {
+				t.Fatal(err)
+			}
+			primary := filepath.Join(dir, keystore.DefaultFileName)
+			if err := tt.damage(primary); err != nil {
+				t.Fatal(err)
+			}
+
+			var mu sync.Mutex
+			var events []keystore.AuditEvent
+			ks := newMirrorStore(t, dir, mirror, func(e keystore.AuditEvent) {
+				mu.Lock()
+				defer mu.Unlock()
+				events = append(events, e)
+			})
+			if token, err := ks.LoadToken(); err != nil || token != "mirrored" {
+				t.Fatalf("LoadToken = %q, %v, want the mirrored token", token, err)
+			}
+
+			mu.Lock()
+			var recovered bool
+			for _, e := range events {
+				recovered = recovered || e.Op == keystore.AuditMirror && strings.Contains(e.Error, keystore.ErrRecoveredFromMirror.Error())
+			}
+			mu.Unlock()
+			if !recovered {
+				t.Fatalf("no ErrRecoveredFromMirror audit event in %+v", events)
+			}
+
+			st, err := ks.MirrorStatus()
+			if err != nil {
+				t.Fatalf("MirrorStatus: %v", err)
+			}
+			if !st.Recovered || st.MirrorRevision != 1 || st.Lag != tt.wantLag {
+				t.Fatalf("MirrorStatus = %+v", st)
+			}
+
+			// The next save restores the primary.
+			if err := ks.SaveToken("restored"); err != nil {
+				t.Fatal(err)
+			}
+			assertMirrored(t, dir, mirror)
+			if st, _ := ks.MirrorStatus(); st.Recovered || st.Lag != 0 {
+				t.Fatalf("MirrorStatus after saving = %+v", st)
+			}
+		})
+	}
+}
+
+func TestMirrorFailureDoesNotFailSave(t *testing.T) {
+	blocker := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(blocker, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []keystore.AuditEvent
+	dir := t.TempDir()
+	ks := newMirrorStore(t, dir, filepath.Join(blocker, "keystore.json"), func(e keystore.AuditEvent) { events = append(events, e) })
+	if err := ks.SaveToken("token"); err != nil {
+		t.Fatalf("SaveToken with an unwritable mirror: %v", err)
+	}
+	if token, err := ks.LoadToken(); err != nil || token != "token" {
+		t.Fatalf("LoadToken = %q, %v", token, err)
+	}
+
+	// The mirror cannot be read either, but the status still carries the
+	// last write error.
+	st, err := ks.MirrorStatus()
+	if err == nil {
+		t.Fatal("MirrorStatus read a mirror below a file")
+	}
+	if st.LastError == "" || st.LastMirroredAt != nil {
+		t.Fatalf("MirrorStatus = %+v, want the write error", st)
+	}
+	var audited bool
+	for _, e := range events {
+		audited = audited || e.Op == keystore.AuditMirror && e.Error != ""
+	}
+	if !audited {
+		t.Fatalf("mirror failure not audited: %+v", events)
+	}
+}
+
+func TestMirrorInitOnce(t *testing.T) {
+	dir := t.TempDir()
+	mirror := filepath.Join(t.TempDir(), "keystore.json")
+	ks, err := keystore.NewKeystore(keystore.Config{
+		DirPath:      dir,
+		MirrorPath:   mirror,
+		BackupRetain: 3,
+		Logger:       discardLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A staging save must not reach the mirror before the keystore is
+	// actually created.
+	failed := errors.New("init failed")
+	err = ks.InitOnce(func(staging *keystore.Store) error {
+		if err := staging.SaveToken("discarded"); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("InitOnce: got %v, want the initFn error", err)
+	}
+	if _, err := os.Stat(mirror); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("failed InitOnce wrote the mirror: %v", err)
+	}
+
+	err = ks.InitOnce(func(staging *keystore.Store) error {
+		return staging.SaveToken("initialized")
+	})
+	if err != nil {
+		t.Fatalf("InitOnce: %v", err)
+	}
+	assertMirrored(t, dir, mirror)
+	if names := backupNames(t, ks); len(names) != 0 {
+		t.Fatalf("InitOnce left backups %v", names)
+	}
+	if st, err := ks.MirrorStatus(); err != nil || st.Lag != 0 || st.LastMirroredAt == nil {
+		t.Fatalf("MirrorStatus = %+v, %v", st, err)
+	}
+}
@@ -0,0 +1,225 @@
+package keystore
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/tyler-smith/go-bip39"
+)
+
+// Confirmation quizzes a user on a few word positions of a mnemonic to
+// check that it was written down. Positions are 1-based, as shown to users.
+type Confirmation struct {
+	mu        sync.Mutex
+	words     []string
+	challenge []int
+	passed    bool
+}
+
+// NewMnemonicConfirmation selects positions distinct random word positions
+// from mnemonic.
+func NewMnemonicConfirmation(mnemonic string, positions int) (*Confirmation, error) {
+	words := strings.Fields(normalizeWord(mnemonic))
+	if n := len(words); n < 12 || n > 24 || n%3 != 0 {
+		return nil, fmt.Errorf("%w: %d words", ErrInvalidMnemonic, n)
+	}
+
+	if positions < 1 || positions > len(words) {
+		return nil, fmt.Errorf("%w: cannot quiz %d of %d words", ErrInvalidMnemonic, positions, len(words))
+	}
+
+	// Partial Fisher-Yates shuffle of the indexes, using crypto/rand so the
+	// challenge cannot be predicted.
+	indexes := make([]int, len(words))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	for i := 0; i < positions; i++ {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(len(words)-i)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to select words: %w", err)
+		}
+		k := i + int(j.Int64())
+		indexes[i], indexes[k] = indexes[k], indexes[i]
+	}
+
+	challenge := make([]int, positions)
+	for i := range challenge {
+		challenge[i] = indexes[i] + 1
+	}
+	sort.Ints(challenge)
+
+	return &Confirmation{words: words, challenge: challenge}, nil
+}
+
+// Challenge returns the word positions the user must supply, in ascending
+// order.
+func (c *Confirmation) Challenge() []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]int(nil), c.challenge...)
+}
+
+// Verify checks answers, keyed by position, against the mnemonic. Case and
+// surrounding whitespace are ignored, and every answer is compared in
+// constant time. Answers must cover exactly the challenged positions. Once
+// Verify succeeds the mnemonic is discarded.
+func (c *Confirmation) Verify(answers map[int]string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.passed {
+		return true, nil
+	}
+
+	if len(answers) != len(c.challenge) {
+		return false, fmt.Errorf("%w: expected answers for words %v", ErrMnemonicNotConfirmed, c.challenge)
+	}
+
+	match := 1
+	for _, pos := range c.challenge {
+		answer, ok := answers[pos]
+		if !ok {
+			return false, fmt.Errorf("%w: missing answer for word %d", ErrMnemonicNotConfirmed, pos)
+		}
+		match &= subtle.ConstantTimeCompare([]byte(normalizeWord(answer)), []byte(c.words[pos-1]))
+	}
+
+	if match != 1 {
+		return false, nil
+	}
+
+	c.passed = true
+	c.words = nil
+	return true, nil
+}
+
+// Passed reports whether Verify has succeeded.
+func (c *Confirmation) Passed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.passed
+}
+
+// normalizeWord lower-cases s and collapses runs of whitespace.
+func normalizeWord(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
+
+// MarkMnemonicBackedUp records that the user has confirmed their recovery
+// phrase. It fails with ErrMnemonicNotConfirmed unless c has passed.
+func (s *Store) MarkMnemonicBackedUp(c *Confirmation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c == nil || !c.Passed() {
+		return ErrMnemonicNotConfirmed
+	}
+
+	return s.update(func() error {
+		s.MnemonicBackedUpAt = s.now().Unix()
+		return nil
+	})
+}
+
+// ImportFromMnemonic derives the primary key from a BIP-39 mnemonic and
+// optional passphrase along path, or accounts.DefaultBaseDerivationPath
+// (m/44'/60'/0'/0/0) when path is nil, and returns its address. The key is
+// recorded with ProvenanceMnemonic and the path as its source; the
+// mnemonic itself is not kept. A mnemonic with a wrong word or checksum
+// fails with ErrInvalidMnemonic.
+func (s *Store) ImportFromMnemonic(mnemonic, passphrase string, path accounts.DerivationPath) (common.Address, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if path == nil {
+		path = accounts.DefaultBaseDerivationPath
+	}
+
+	seed, err := bip39.NewSeedWithErrorChecking(normalizeWord(mnemonic), passphrase)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("%w: %v", ErrInvalidMnemonic, err)
+	}
+	defer wipe(seed)
+
+	key, err := deriveKey(seed, path)
+	if err != nil {
+		return common.Address{}, err
+	}
+	privateKeyHex := hex.EncodeToString(crypto.FromECDSA(key))
+
+	if _, err := s.checkPrivateKey(privateKeyHex); err != nil {
+		return common.Address{}, err
+	}
+
+	err = s.updateScope(scopeKey, func() error {
+		return s.setPrimaryKey(privateKeyHex, key, s.newProvenance(ProvenanceMnemonic, path.String()))
+	})
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(key.PublicKey), nil
+}
+
+// deriveKey derives the BIP-32 private key at path from seed.
+func deriveKey(seed []byte, path accounts.DerivationPath) (*ecdsa.PrivateKey, error) {
+	n := crypto.S256().Params().N
+
+	sum := hmacSHA512([]byte("Bitcoin seed"), seed)
+	defer func() { wipe(sum) }()
+	k, chain := new(big.Int).SetBytes(sum[:32]), sum[32:]
+	if k.Sign() == 0 || k.Cmp(n) >= 0 {
+		return nil, fmt.Errorf("%w: seed yields an invalid master key", ErrInvalidMnemonic)
+	}
+
+	for _, index := range path {
+		var data []byte
+		if index >= 0x80000000 {
+			data = append([]byte{0}, math.PaddedBigBytes(k, 32)...)
+		} else {
+			parent, err := crypto.ToECDSA(math.PaddedBigBytes(k, 32))
+			if err != nil {
+				return nil, fmt.Errorf("failed to derive key: %w", err)
+			}
+			data = crypto.CompressPubkey(&parent.PublicKey)
+		}
+		data = binary.BigEndian.AppendUint32(data, index)
+
+		child := hmacSHA512(chain, data)
+		wipe(data)
+		il := new(big.Int).SetBytes(child[:32])
+		if il.Cmp(n) >= 0 {
+			return nil, fmt.Errorf("%w: no valid key at %s", ErrInvalidMnemonic, path)
+		}
+		k.Add(k, il).Mod(k, n)
+		if k.Sign() == 0 {
+			return nil, fmt.Errorf("%w: no valid key at %s", ErrInvalidMnemonic, path)
+		}
+		wipe(sum)
+		sum, chain = child, child[32:]
+	}
+
+	return crypto.ToECDSA(math.PaddedBigBytes(k, 32))
+}
+
+func hmacSHA512(key, data []byte) []byte {
+	mac := hmac.New(sha512.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,117 @@
+package keystore_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/theblitlabs/keystore"
+)
+
+const (
+	abandonMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	hardhatMnemonic = "test test test test test test test test test test test junk"
+)
+
+func TestImportFromMnemonic(t *testing.T) {
+	tests := []struct {
+		name       string
+		mnemonic   string
+		passphrase string
+		path       string
+		want       string
+	}{
+		{"default path", abandonMnemonic, "", "", "0x9858EfFD232B4033E47d90003D41EC34EcaEda94"},
+		{"hardhat account 0", hardhatMnemonic, "", "m/44'/60'/0'/0/0", "0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266"},
+		{"hardhat account 1", hardhatMnemonic, "", "m/44'/60'/0'/0/1", "0x70997970C51812dc3A010C7d01b50e0d17dc79C8"},
+		{"case and spacing", "  TEST test\ttest test test test test test test test test  Junk\n", "", "", "0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var path accounts.DerivationPath
+			if tt.path != "" {
+				var err error
+				if path, err = accounts.ParseDerivationPath(tt.path); err != nil {
+					t.Fatal(err)
+				}
+			}
+			dir := t.TempDir()
+			ks := newErrorStore(t, keystore.Config{DirPath: dir})
+			addr, err := ks.ImportFromMnemonic(tt.mnemonic, tt.passphrase, path)
+			if err != nil {
+				t.Fatalf("ImportFromMnemonic: %v", err)
+			}
+			if addr.Hex() != tt.want {
+				t.Fatalf("address = %s, want %s", addr.Hex(), tt.want)
+			}
+			if got, err := ks.GetAddress(); err != nil || got != addr {
+				t.Fatalf("GetAddress = %s, %v, want %s", got.Hex(), err, tt.want)
+			}
+
+			wantSource := tt.path
+			if wantSource == "" {
+				wantSource = accounts.DefaultBaseDerivationPath.String()
+			}
+			p, err := ks.KeyProvenance("")
+			if err != nil || p.Origin != keystore.ProvenanceMnemonic || p.Source != wantSource {
+				t.Fatalf("KeyProvenance = %+v, %v, want %s from %s", p, err, keystore.ProvenanceMnemonic, wantSource)
+			}
+
+			// The mnemonic is not stored.
+			data, err := os.ReadFile(filepath.Join(dir, keystore.DefaultFileName))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if last := strings.Fields(tt.mnemonic)[11]; strings.Contains(strings.ToLower(string(data)), strings.ToLower(last)) {
+				t.Fatalf("keystore file contains the mnemonic word %q", last)
+			}
+		})
+	}
+
+	// The hardhat account 0 key is well known.
+	ks := newErrorStore(t, keystore.Config{})
+	if _, err := ks.ImportFromMnemonic(hardhatMnemonic, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if key, err := ks.GetPrivateKeyHex(); err != nil || key != "ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80" {
+		t.Fatalf("GetPrivateKeyHex = %v, want the hardhat account 0 key", err)
+	}
+
+	// A passphrase selects another wallet.
+	addr, err := ks.ImportFromMnemonic(hardhatMnemonic, "passphrase", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr == common.HexToAddress("0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266") {
+		t.Fatal("the passphrase did not change the derived key")
+	}
+}
+
+func TestImportFromMnemonicInvalid(t *testing.T) {
+	ks := newErrorStore(t, keystore.Config{})
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, mnemonic := range map[string]string{
+		"empty":        "",
+		"bad checksum": strings.Repeat("abandon ", 12),
+		"unknown word": strings.Replace(abandonMnemonic, "about", "abouts", 1),
+		"eleven words": strings.TrimSuffix(abandonMnemonic, " about"),
+	} {
+		if _, err := ks.ImportFromMnemonic(mnemonic, "", nil); !errors.Is(err, keystore.ErrInvalidMnemonic) {
+			t.Errorf("ImportFromMnemonic with %s: got %v, want ErrInvalidMnemonic", name, err)
+		}
+	}
+
+	// A failed import keeps the existing key.
+	if key, err := ks.GetPrivateKeyHex(); err != nil || key != fileKeyHex {
+		t.Fatalf("GetPrivateKeyHex after failed imports: %v, want the original key", err)
+	}
+}
@@ -0,0 +1,118 @@
+package keystore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// openStores holds the Stores shared by Open, keyed by canonical path.
+var openStores = struct {
+	mu     sync.Mutex
+	stores map[string]*Store
+}{stores: make(map[string]*Store)}
+
+// Open returns the Store for the keystore file cfg resolves to, sharing one
+// instance per canonical path within the process so every caller sees the
+// same cache and in-memory state. The configuration of the first Open for a
+// path is used by all later ones. Each call must be paired with Close.
+// Ephemeral keystores and custom backends have no path and always get a
+// fresh Store, like NewKeystore.
+func Open(cfg Config) (*Store, error) {
+	if cfg.Ephemeral || cfg.Backend != nil {
+		return NewKeystore(cfg)
+	}
+
+	cfg, err := resolveLocation(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := canonicalPath(filepath.Join(cfg.DirPath, cfg.FileName))
+	if err != nil {
+		return nil, err
+	}
+
+	openStores.mu.Lock()
+	defer openStores.mu.Unlock()
+
+	// A Store is only built on a miss: NewKeystore has side effects, such
+	// as clearing Config.KeyFromEnv or prompting for AutoEncryptOnLoad.
+	if shared, ok := openStores.stores[key]; ok {
+		shared.mu.Lock()
+		shared.refs++
+		shared.mu.Unlock()
+		return shared, nil
+	}
+
+	s, err := NewKeystore(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	s.registryKey = key
+	s.refs = 1
+	openStores.stores[key] = s
+	return s, nil
+}
+
+// canonicalPath resolves symlinks in path, or in its directory if the file
+// does not exist yet, and makes it absolute.
+func canonicalPath(path string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to resolve keystore path: %w", err)
+		}
+		dir, err := filepath.EvalSymlinks(filepath.Dir(path))
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve keystore path: %w", err)
+		}
+		resolved = filepath.Join(dir, filepath.Base(path))
+	}
+
+	return filepath.Abs(resolved)
+}
+
+// Close releases the Store. A Store shared through Open is only released
+// once every Open has been closed; after that a new Open creates a fresh
+// instance. Releasing wipes the in-memory state, including any passphrase
+// supplied to Unlock. Apart from writing pending key usage and flushing
+// writes queued by SaveTokenAsync, the persisted keystore is untouched.
+func (s *Store) Close() error {
+	flushErr := s.Flush(context.Background())
+
+	if s.registryKey != "" {
+		openStores.mu.Lock()
+		defer openStores.mu.Unlock()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.refs > 1 {
+		s.refs--
+		return nil
+	}
+
+	if s.registryKey != "" && openStores.stores[s.registryKey] == s {
+		delete(openStores.stores, s.registryKey)
+	}
+	s.refs = 0
+
+	err := s.flushUsage()
+	if err == nil {
+		err = flushErr
+	}
+
+	s.reset()
+	s.unlocked = nil
+	if s.cache != nil {
+		wipeECDSA(s.cache.key)
+		s.cache = nil
+	}
+	s.exportTickets = nil
+	return err
+}
@@ -0,0 +1,108 @@
+package keystore_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/theblitlabs/keystore"
+)
+
+func TestOpenSharesStore(t *testing.T) {
+	dir := t.TempDir()
+
+	a, err := keystore.Open(keystore.Config{DirPath: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := keystore.Open(keystore.Config{DirPath: dir + string(os.PathSeparator) + "."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b {
+		t.Fatal("Open returned different Stores for the same path")
+	}
+
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SaveToken("token"); err != nil {
+		t.Fatalf("SaveToken after the first Close: %v", err)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := keystore.Open(keystore.Config{DirPath: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if c == a {
+		t.Error("Open after the last Close returned the released Store")
+	}
+}
+
+func TestOpenReusesStoreWithoutSideEffects(t *testing.T) {
+	t.Run("ClearKeyEnv", func(t *testing.T) {
+		t.Setenv("KEYSTORE_OPEN_KEY", fileKeyHex)
+		cfg := keystore.Config{DirPath: t.TempDir(), KeyFromEnv: "KEYSTORE_OPEN_KEY", ClearKeyEnv: true}
+
+		a, err := keystore.Open(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer a.Close()
+		if _, ok := os.LookupEnv("KEYSTORE_OPEN_KEY"); ok {
+			t.Fatal("ClearKeyEnv left the variable set")
+		}
+
+		b, err := keystore.Open(cfg)
+		if err != nil {
+			t.Fatalf("second Open: %v", err)
+		}
+		defer b.Close()
+		if a != b {
+			t.Error("Open returned different Stores for the same path")
+		}
+	})
+
+	t.Run("AutoEncryptOnLoad", func(t *testing.T) {
+		dir := t.TempDir()
+		plain, err := keystore.NewKeystore(keystore.Config{DirPath: dir})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := plain.SavePrivateKey(fileKeyHex); err != nil {
+			t.Fatal(err)
+		}
+
+		prompts := 0
+		cfg := keystore.Config{
+			DirPath:           dir,
+			AutoEncryptOnLoad: true,
+			Passphrase: keystore.PassphraseFunc(func() (string, error) {
+				prompts++
+				return "correct horse", nil
+			}),
+		}
+
+		a, err := keystore.Open(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer a.Close()
+		afterFirst := prompts
+		if afterFirst == 0 {
+			t.Fatal("AutoEncryptOnLoad did not prompt")
+		}
+
+		b, err := keystore.Open(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer b.Close()
+		if prompts != afterFirst {
+			t.Errorf("second Open prompted %d more times", prompts-afterFirst)
+		}
+	})
+}
@@ -0,0 +1,206 @@
+package keystore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+const pgpArmorHeader = "-----BEGIN PGP MESSAGE-----"
+
+// OpenPGPConfig encrypts the whole keystore file to one or more OpenPGP
+// recipients.
+type OpenPGPConfig struct {
+	// Recipients are the public keys every save is encrypted to. Include a
+	// team escrow key so the file can always be recovered.
+	Recipients openpgp.EntityList
+
+	// Keyring holds the secret keys used to decrypt on load. It is not
+	// needed when Decrypt is set.
+	Keyring openpgp.EntityList
+
+	// Passphrase unlocks passphrase-protected secret keys in Keyring.
+	Passphrase PassphraseProvider
+
+	// Decrypt, if set, is used instead of Keyring, for example GPGDecrypt
+	// to decrypt through gpg-agent.
+	Decrypt func(ciphertext []byte) ([]byte, error)
+
+	// Armor writes ASCII-armored messages instead of binary ones.
+	Armor bool
+}
+
+func (c *OpenPGPConfig) validate() error {
+	if len(c.Recipients) == 0 {
+		return configError("OpenPGP.Recipients", "OpenPGP encryption requires at least one recipient")
+	}
+	if len(c.Keyring) == 0 && c.Decrypt == nil {
+		return configError("OpenPGP.Keyring", "OpenPGP encryption requires a keyring or a Decrypt function")
+	}
+	return nil
+}
+
+// GPGDecrypt decrypts an OpenPGP message with the gpg binary, which uses
+// gpg-agent for secret keys and passphrases.
+func GPGDecrypt(ciphertext []byte) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("gpg", "--batch", "--quiet", "--decrypt")
+	cmd.Stdin = bytes.NewReader(ciphertext)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if strings.Contains(msg, "No secret key") {
+			return nil, fmt.Errorf("%w: %s", ErrNoSecretKey, msg)
+		}
+		return nil, fmt.Errorf("gpg failed: %w: %s", err, msg)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// isPGPMessage reports whether data is an armored or binary OpenPGP
+// encrypted message rather than a JSON document.
+func isPGPMessage(data []byte) bool {
+	if bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte(pgpArmorHeader)) {
+		return true
+	}
+	if len(data) == 0 {
+		return false
+	}
+
+	// Encrypted messages open with a public-key (tag 1) or symmetric-key
+	// (tag 3) session key packet, in old or new packet format.
+	switch b := data[0]; {
+	case b&0xfc == 0x84, b&0xfc == 0x8c, b == 0xc1, b == 0xc3:
+		return true
+	}
+	return false
+}
+
+func (s *Store) pgpEncrypt(plaintext []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	out := io.WriteCloser(nopWriteCloser{&buf})
+
+	if s.config.OpenPGP.Armor {
+		w, err := armor.Encode(&buf, "PGP MESSAGE", nil)
+		if err != nil {
+			return nil, err
+		}
+		out = w
+	}
+
+	w, err := openpgp.Encrypt(out, s.config.OpenPGP.Recipients, nil, &openpgp.FileHints{IsBinary: true}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt keystore: %w", err)
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		return nil, fmt.Errorf("failed to encrypt keystore: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encrypt keystore: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encrypt keystore: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (s *Store) pgpDecrypt(data []byte) ([]byte, error) {
+	cfg := s.config.OpenPGP
+	if cfg == nil {
+		return nil, fmt.Errorf("%w: keystore is OpenPGP-encrypted but Config.OpenPGP is not set", ErrNoSecretKey)
+	}
+
+	if cfg.Decrypt != nil {
+		return cfg.Decrypt(data)
+	}
+
+	raw := data
+	if bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte(pgpArmorHeader)) {
+		block, err := armor.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid OpenPGP armor: %w", err)
+		}
+		if raw, err = io.ReadAll(block.Body); err != nil {
+			return nil, fmt.Errorf("invalid OpenPGP armor: %w", err)
+		}
+	}
+
+	md, err := openpgp.ReadMessage(bytes.NewReader(raw), cfg.Keyring, s.pgpPrompt(), nil)
+	if err != nil {
+		if errors.Is(err, pgperrors.ErrKeyIncorrect) {
+			return nil, fmt.Errorf("%w: message is encrypted to %s", ErrNoSecretKey, pgpKeyIDs(raw))
+		}
+		return nil, fmt.Errorf("failed to decrypt keystore: %w", err)
+	}
+
+	// The integrity check runs when the body is fully read.
+	plaintext, err := io.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt keystore: %w", err)
+	}
+	return plaintext, nil
+}
+
+// pgpPrompt unlocks passphrase-protected secret keys. ReadMessage calls it
+// until a key decrypts, so a wrong passphrase fails on the second call.
+func (s *Store) pgpPrompt() openpgp.PromptFunction {
+	tried := false
+	return func(keys []openpgp.Key, symmetric bool) ([]byte, error) {
+		if s.config.OpenPGP.Passphrase == nil {
+			return nil, fmt.Errorf("%w: secret key is passphrase-protected", ErrNoSecretKey)
+		}
+		if tried {
+			return nil, ErrWrongPassphrase
+		}
+		tried = true
+
+		passphrase, err := s.config.OpenPGP.Passphrase.Passphrase()
+		if err != nil {
+			return nil, fmt.Errorf("failed to obtain passphrase: %w", err)
+		}
+		for _, k := range keys {
+			if k.PrivateKey != nil && k.PrivateKey.Encrypted {
+				_ = k.PrivateKey.Decrypt([]byte(passphrase))
+			}
+		}
+		return nil, nil
+	}
+}
+
+// pgpKeyIDs lists the recipient key ids of an encrypted message.
+func pgpKeyIDs(raw []byte) string {
+	var ids []string
+	packets := packet.NewReader(bytes.NewReader(raw))
+	for {
+		p, err := packets.Next()
+		if err != nil {
+			break
+		}
+		ek, ok := p.(*packet.EncryptedKey)
+		if !ok {
+			break
+		}
+		ids = append(ids, fmt.Sprintf("%016X", ek.KeyId))
+	}
+
+	if len(ids) == 0 {
+		return "no known key ids"
+	}
+	return strings.Join(ids, ", ")
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,429 @@
+package keystore
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	// PaperParityLines is how many lines of a paper backup are parity. Up to
+	// this many damaged lines can be recovered.
+	PaperParityLines = 3
+
+	paperVersion    = 1
+	paperAAD        = "kspaper1"
+	paperLineBytes  = 10 // 16 base32 characters
+	paperGroupSize  = 4
+	paperCheckBytes = 3 // the first 20 bits are written as 4 characters
+	paperCheckChars = 4
+)
+
+// paperPayloadSize is the version byte, salt, nonce and sealed key.
+const paperPayloadSize = 1 + saltLen + 12 + privateKeySize + 16
+
+var paperEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// paperConfusables maps characters that are not in the base32 alphabet to
+// the letters they are most often mistaken for.
+var paperConfusables = strings.NewReplacer("0", "O", "1", "I", "8", "B")
+
+// PaperBackup is the primary key encrypted under a passphrase and encoded
+// for transcription onto paper. Rendering is left to the caller.
+type PaperBackup struct {
+	// Address is the address of the backed up key, for labelling the copy.
+	Address string `json:"address"`
+
+	// Lines are the lines to write down, in order. Each reads
+	// "NN/TT XXXX XXXX XXXX XXXX CCCC": the line number and total, four
+	// groups of base32 data and a checksum group. The last ParityLines
+	// lines are Reed-Solomon parity over the others.
+	Lines []string `json:"lines"`
+
+	// ParityLines is the number of parity lines, and so the number of
+	// damaged or missing lines ImportPaperBackup can recover.
+	ParityLines int `json:"parity_lines"`
+}
+
+// PaperBackupError reports lines of a paper backup whose checksum does not
+// match. Damaged lists their 1-based numbers. It matches
+// ErrPaperBackupDamaged with errors.Is.
+type PaperBackupError struct {
+	Damaged     []int
+	Recoverable int
+}
+
+func (e *PaperBackupError) Error() string {
+	lines := make([]string, len(e.Damaged))
+	for i, n := range e.Damaged {
+		lines[i] = strconv.Itoa(n)
+	}
+	return fmt.Sprintf("%v: lines %s are damaged, at most %d can be recovered",
+		ErrPaperBackupDamaged, strings.Join(lines, ", "), e.Recoverable)
+}
+
+func (e *PaperBackupError) Unwrap() error {
+	return ErrPaperBackupDamaged
+}
+
+// ExportPaperBackup encrypts the primary key with passphrase and encodes
+// it as a PaperBackup. It can be gated by listing AuthExportPaperBackup in
+// Config.RequireAuthorizationFor, and by Config.RequireExportTicket.
+func (s *Store) ExportPaperBackup(passphrase string, opts ...ExportOption) (backup PaperBackup, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer func() { s.audit(AuditExport, "", err) }()
+
+	if err := s.authorized(AuthExportPaperBackup); err != nil {
+		return PaperBackup{}, err
+	}
+	if err := s.redeemExport("ExportPaperBackup", ExportScopeFull, opts); err != nil {
+		return PaperBackup{}, err
+	}
+	if passphrase == "" {
+		return PaperBackup{}, fmt.Errorf("%w: paper backup passphrase", ErrEmptyPassphrase)
+	}
+
+	key, privateKeyHex, err := s.primaryKey()
+	if err != nil {
+		return PaperBackup{}, err
+	}
+	raw, err := hex.DecodeString(privateKeyHex)
+	if err != nil {
+		return PaperBackup{}, s.invalidStoredKey("private_key", err)
+	}
+	defer wipe(raw)
+
+	payload, err := sealPaper(raw, passphrase)
+	if err != nil {
+		return PaperBackup{}, err
+	}
+
+	return PaperBackup{
+		Address:     crypto.PubkeyToAddress(key.PublicKey).Hex(),
+		Lines:       encodePaper(payload),
+		ParityLines: PaperParityLines,
+	}, nil
+}
+
+// ImportPaperBackup decodes lines written from a PaperBackup, decrypts the
+// key they hold with passphrase and saves it as the primary key. Blank lines
+// are ignored, and case, spacing and the digits 0, 1 and 8 misread for O, I
+// and B are tolerated. Up to PaperParityLines damaged lines are corrected;
+// beyond that it fails with a PaperBackupError naming them.
+func (s *Store) ImportPaperBackup(lines []string, passphrase string) error {
+	payload, corrected, err := decodePaper(lines)
+	if err != nil {
+		return err
+	}
+
+	raw, err := openPaper(payload, passphrase)
+	if err != nil {
+		return err
+	}
+	defer wipe(raw)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(corrected) > 0 {
+		s.config.Logger.Warn("keystore: corrected damaged paper backup lines", "lines", corrected)
+	}
+
+	privateKeyHex := hex.EncodeToString(raw)
+	key, err := s.checkPrivateKey(privateKeyHex)
+	if err != nil {
+		return err
+	}
+
+	return s.updateScope(scopeKey, func() error {
+		return s.setPrimaryKey(privateKeyHex, key, s.newProvenance(ProvenanceRestored, "paper backup"))
+	})
+}
+
+// sealPaper returns the version byte, salt, nonce and the key sealed with
+// AES-GCM under a key derived from passphrase.
+func sealPaper(raw []byte, passphrase string) ([]byte, error) {
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	gcm, err := passphraseCipher(passphrase, salt, ScryptParams{N: scryptN, R: scryptR, P: scryptP})
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	out := append([]byte{paperVersion}, salt...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, raw, []byte(paperAAD)), nil
+}
+
+func openPaper(payload []byte, passphrase string) ([]byte, error) {
+	if payload[0] != paperVersion {
+		return nil, fmt.Errorf("%w: unsupported paper backup version %d", ErrUnsupportedVersion, payload[0])
+	}
+
+	salt := payload[1 : 1+saltLen]
+	gcm, err := passphraseCipher(passphrase, salt, ScryptParams{N: scryptN, R: scryptR, P: scryptP})
+	if err != nil {
+		return nil, err
+	}
+
+	rest := payload[1+saltLen:]
+	raw, err := gcm.Open(nil, rest[:gcm.NonceSize()], rest[gcm.NonceSize():], []byte(paperAAD))
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return raw, nil
+}
+
+// encodePaper splits payload into data lines, adds the parity lines and
+// formats them.
+func encodePaper(payload []byte) []string {
+	shards := paperShards(len(payload))
+	rows := make([][]byte, shards+PaperParityLines)
+	for i := 0; i < shards; i++ {
+		rows[i] = make([]byte, paperLineBytes)
+		copy(rows[i], payload[min(i*paperLineBytes, len(payload)):])
+	}
+	for i, p := range rsParity(rows[:shards], PaperParityLines) {
+		rows[shards+i] = p
+	}
+
+	lines := make([]string, len(rows))
+	for i, row := range rows {
+		lines[i] = formatPaperLine(i+1, len(rows), row)
+	}
+	return lines
+}
+
+// decodePaper parses lines, recovering damaged ones from parity, and
+// returns the payload and the numbers of the lines it corrected.
+func decodePaper(lines []string) ([]byte, []int, error) {
+	var entered []string
+	for _, l := range lines {
+		if strings.TrimSpace(l) != "" {
+			entered = append(entered, l)
+		}
+	}
+
+	shards := paperShards(paperPayloadSize)
+	total := shards + PaperParityLines
+	if len(entered) > total {
+		return nil, nil, fmt.Errorf("%w: expected %d lines, got %d", ErrPaperBackupDamaged, total, len(entered))
+	}
+
+	rows := make([][]byte, total)
+	for _, l := range entered {
+		n, t, row, ok := parsePaperLine(l)
+		if ok && t == total && rows[n-1] == nil {
+			rows[n-1] = row
+		}
+	}
+
+	var damaged []int
+	for i, row := range rows {
+		if row == nil {
+			damaged = append(damaged, i+1)
+		}
+	}
+	if len(damaged) > PaperParityLines {
+		return nil, nil, &PaperBackupError{Damaged: damaged, Recoverable: PaperParityLines}
+	}
+	if len(damaged) > 0 {
+		if err := rsRecover(rows, shards); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	payload := make([]byte, 0, shards*paperLineBytes)
+	for _, row := range rows[:shards] {
+		payload = append(payload, row...)
+	}
+	return payload[:paperPayloadSize], damaged, nil
+}
+
+func paperShards(size int) int {
+	return (size + paperLineBytes - 1) / paperLineBytes
+}
+
+func formatPaperLine(n, total int, row []byte) string {
+	text := paperEncoding.EncodeToString(row) + paperChecksum(n, total, row)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%02d/%02d", n, total)
+	for i := 0; i < len(text); i += paperGroupSize {
+		b.WriteByte(' ')
+		b.WriteString(text[i:min(i+paperGroupSize, len(text))])
+	}
+	return b.String()
+}
+
+// parsePaperLine returns the line number, total and data of a line whose
+// checksum matches.
+func parsePaperLine(line string) (n, total int, row []byte, ok bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return 0, 0, nil, false
+	}
+
+	num, tot, found := strings.Cut(fields[0], "/")
+	n, err1 := strconv.Atoi(num)
+	total, err2 := strconv.Atoi(tot)
+	if !found || err1 != nil || err2 != nil || n < 1 || n > total {
+		return 0, 0, nil, false
+	}
+
+	text := paperConfusables.Replace(strings.ToUpper(strings.Join(fields[1:], "")))
+	dataChars := paperEncoding.EncodedLen(paperLineBytes)
+	if len(text) != dataChars+paperCheckChars {
+		return 0, 0, nil, false
+	}
+
+	row, err := paperEncoding.DecodeString(text[:dataChars])
+	if err != nil || paperChecksum(n, total, row) != text[dataChars:] {
+		return 0, 0, nil, false
+	}
+	return n, total, row, true
+}
+
+// paperChecksum covers the data and position of a line, so that swapped
+// lines are detected too.
+func paperChecksum(n, total int, row []byte) string {
+	h := sha256.New()
+	h.Write([]byte(paperAAD))
+	h.Write([]byte{byte(n), byte(total)})
+	h.Write(row)
+	return paperEncoding.EncodeToString(h.Sum(nil)[:paperCheckBytes])[:paperCheckChars]
+}
+
+// Paper backups use Reed-Solomon erasure coding over the GF(256) of the
+// Shamir code, with a systematic Cauchy generator: parity row i is the sum
+// over data rows j of data[j] scaled by 1/(x_i + y_j), with x_i = k+i and
+// y_j = j. Every square submatrix of a Cauchy matrix is invertible, so any
+// k of the k+m rows recover the data.
+
+// rsRow returns the generator row of shard i out of k data shards.
+func rsRow(i, k int) []byte {
+	row := make([]byte, k)
+	if i < k {
+		row[i] = 1
+		return row
+	}
+	for j := range row {
+		row[j] = gfDiv(1, byte(i)^byte(j))
+	}
+	return row
+}
+
+func rsParity(data [][]byte, m int) [][]byte {
+	k := len(data)
+	parity := make([][]byte, m)
+	for i := range parity {
+		coef := rsRow(k+i, k)
+		parity[i] = make([]byte, len(data[0]))
+		for j, d := range data {
+			for c := range d {
+				parity[i][c] ^= gfMul(coef[j], d[c])
+			}
+		}
+	}
+	return parity
+}
+
+// rsRecover fills in the nil data rows of rows from the rows present.
+func rsRecover(rows [][]byte, k int) error {
+	var present []int
+	for i, row := range rows {
+		if row != nil {
+			present = append(present, i)
+		}
+	}
+	if len(present) < k {
+		return fmt.Errorf("%w: not enough lines to recover", ErrPaperBackupDamaged)
+	}
+	sort.Ints(present)
+	present = present[:k]
+
+	m := make([][]byte, k)
+	for r, i := range present {
+		m[r] = rsRow(i, k)
+	}
+	inv, err := gfInvert(m)
+	if err != nil {
+		return err
+	}
+
+	width := len(rows[present[0]])
+	for j := 0; j < k; j++ {
+		if rows[j] != nil {
+			continue
+		}
+		row := make([]byte, width)
+		for r, i := range present {
+			for c := range row {
+				row[c] ^= gfMul(inv[j][r], rows[i][c])
+			}
+		}
+		rows[j] = row
+	}
+	return nil
+}
+
+// gfInvert inverts a square matrix by Gauss-Jordan elimination.
+func gfInvert(m [][]byte) ([][]byte, error) {
+	n := len(m)
+	a := make([][]byte, n)
+	for i := range m {
+		a[i] = make([]byte, 2*n)
+		copy(a[i], m[i])
+		a[i][n+i] = 1
+	}
+
+	for col := 0; col < n; col++ {
+		pivot := -1
+		for r := col; r < n; r++ {
+			if a[r][col] != 0 {
+				pivot = r
+				break
+			}
+		}
+		if pivot < 0 {
+			return nil, fmt.Errorf("%w: singular recovery matrix", ErrPaperBackupDamaged)
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+
+		scale := gfDiv(1, a[col][col])
+		for c := range a[col] {
+			a[col][c] = gfMul(a[col][c], scale)
+		}
+		for r := 0; r < n; r++ {
+			if r == col || a[r][col] == 0 {
+				continue
+			}
+			f := a[r][col]
+			for c := range a[r] {
+				a[r][c] ^= gfMul(f, a[col][c])
+			}
+		}
+	}
+
+	inv := make([][]byte, n)
+	for i := range a {
+		inv[i] = a[i][n:]
+	}
+	return inv, nil
+}
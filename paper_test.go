@@ -0,0 +1,268 @@
+package keystore_test
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/theblitlabs/keystore"
+)
+
+const paperPassphrase = "paper passphrase"
+
+// exportPaper returns a paper backup of a store holding fileKeyHex.
+func exportPaper(t *testing.T) keystore.PaperBackup {
+	t.Helper()
+
+	ks := newErrorStore(t, keystore.Config{})
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatalf("SavePrivateKey: %v", err)
+	}
+	backup, err := ks.ExportPaperBackup(paperPassphrase)
+	if err != nil {
+		t.Fatalf("ExportPaperBackup: %v", err)
+	}
+	return backup
+}
+
+// damageLine changes one data character of the line at index i, keeping it
+// in the base32 alphabet so that only the checksum catches it.
+func damageLine(lines []string, i int) []string {
+	out := append([]string(nil), lines...)
+	b := []byte(out[i])
+	const at = len("NN/TT ")
+	if b[at] == 'A' {
+		b[at] = 'B'
+	} else {
+		b[at] = 'A'
+	}
+	out[i] = string(b)
+	return out
+}
+
+// dropLines removes the lines at the given indexes.
+func dropLines(lines []string, idx ...int) []string {
+	var out []string
+	for i, l := range lines {
+		dropped := false
+		for _, j := range idx {
+			dropped = dropped || i == j
+		}
+		if !dropped {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+func TestPaperBackupRoundTrip(t *testing.T) {
+	backup := exportPaper(t)
+
+	if want := crypto.PubkeyToAddress(mustKey(t, fileKeyHex).PublicKey).Hex(); backup.Address != want {
+		t.Fatalf("Address = %s, want %s", backup.Address, want)
+	}
+	if backup.ParityLines != keystore.PaperParityLines {
+		t.Fatalf("ParityLines = %d, want %d", backup.ParityLines, keystore.PaperParityLines)
+	}
+	total := len(backup.Lines)
+	for i, l := range backup.Lines {
+		if prefix := fmt.Sprintf("%02d/%02d ", i+1, total); !strings.HasPrefix(l, prefix) {
+			t.Fatalf("line %d = %q, want prefix %q", i+1, l, prefix)
+		}
+		if groups := strings.Fields(l)[1:]; len(groups) != 5 {
+			t.Fatalf("line %d has %d groups, want 5", i+1, len(groups))
+		}
+	}
+
+	ks := newErrorStore(t, keystore.Config{})
+	if err := ks.ImportPaperBackup(backup.Lines, paperPassphrase); err != nil {
+		t.Fatalf("ImportPaperBackup: %v", err)
+	}
+	assertPaperRestored(t, ks)
+
+	if _, err := ks.ExportPaperBackup(""); !errors.Is(err, keystore.ErrEmptyPassphrase) {
+		t.Fatalf("ExportPaperBackup with an empty passphrase: got %v, want ErrEmptyPassphrase", err)
+	}
+}
+
+func TestPaperBackupCorruption(t *testing.T) {
+	backup := exportPaper(t)
+	lines := backup.Lines
+	total := len(lines)
+	data := total - keystore.PaperParityLines
+
+	type edit func([]string) []string
+	tests := []struct {
+		name string
+		edit edit
+	}{
+		{"intact", func(l []string) []string { return l }},
+		{"reordered", func(l []string) []string {
+			out := make([]string, len(l))
+			for i := range l {
+				out[len(l)-1-i] = l[i]
+			}
+			return out
+		}},
+		{"lowercase", func(l []string) []string {
+			out := make([]string, len(l))
+			for i := range l {
+				out[i] = strings.ToLower(l[i])
+			}
+			return out
+		}},
+		{"irregular spacing", func(l []string) []string {
+			out := make([]string, len(l))
+			for i := range l {
+				out[i] = "  " + strings.ReplaceAll(l[i], " ", " \t ") + " "
+			}
+			return out
+		}},
+		{"confusable digits", func(l []string) []string {
+			out := make([]string, len(l))
+			for i := range l {
+				out[i] = strings.NewReplacer("O", "0", "I", "1", "B", "8").Replace(l[i])
+			}
+			return out
+		}},
+		{"blank lines", func(l []string) []string {
+			out := []string{"", "   "}
+			for _, line := range l {
+				out = append(out, line, "")
+			}
+			return out
+		}},
+		{"checksum group damaged", func(l []string) []string {
+			out := append([]string(nil), l...)
+			last := strings.LastIndexByte(out[0], ' ') + 1
+			b := []byte(out[0])
+			if b[last] == 'A' {
+				b[last] = 'B'
+			} else {
+				b[last] = 'A'
+			}
+			out[0] = string(b)
+			return out
+		}},
+		{"line numbers swapped", func(l []string) []string {
+			out := append([]string(nil), l...)
+			out[1] = fmt.Sprintf("03/%02d", total) + l[1][len("NN/TT"):]
+			out[2] = fmt.Sprintf("02/%02d", total) + l[2][len("NN/TT"):]
+			return out
+		}},
+		{"wrong total", func(l []string) []string {
+			out := append([]string(nil), l...)
+			out[4] = fmt.Sprintf("05/%02d", total+1) + l[4][len("NN/TT"):]
+			return out
+		}},
+		{"missing first and last", func(l []string) []string { return dropLines(l, 0, total-1) }},
+		{"two data lines damaged", func(l []string) []string { return damageLine(damageLine(l, 2), 5) }},
+		{"three data lines missing", func(l []string) []string { return dropLines(l, 0, 1, data-1) }},
+		{"every parity line damaged", func(l []string) []string {
+			for i := data; i < total; i++ {
+				l = damageLine(l, i)
+			}
+			return l
+		}},
+		{"data and parity mixed", func(l []string) []string { return dropLines(damageLine(l, 3), 6, data+1) }},
+	}
+	for i := 0; i < total; i++ {
+		i := i
+		tests = append(tests, struct {
+			name string
+			edit edit
+		}{fmt.Sprintf("line %d damaged", i+1), func(l []string) []string { return damageLine(l, i) }})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ks := newErrorStore(t, keystore.Config{})
+			if err := ks.ImportPaperBackup(tt.edit(lines), paperPassphrase); err != nil {
+				t.Fatalf("ImportPaperBackup: %v", err)
+			}
+			assertPaperRestored(t, ks)
+		})
+	}
+}
+
+func TestPaperBackupUnrecoverable(t *testing.T) {
+	backup := exportPaper(t)
+	lines := backup.Lines
+	total := len(lines)
+
+	// More damaged lines than parity fail before the passphrase is tried,
+	// so every combination of four is cheap to check.
+	ks := newErrorStore(t, keystore.Config{})
+	for a := 0; a < total; a++ {
+		for b := a + 1; b < total; b++ {
+			for c := b + 1; c < total; c++ {
+				for d := c + 1; d < total; d++ {
+					damaged := lines
+					for _, i := range []int{a, b, c, d} {
+						damaged = damageLine(damaged, i)
+					}
+					err := ks.ImportPaperBackup(damaged, paperPassphrase)
+
+					var perr *keystore.PaperBackupError
+					if !errors.As(err, &perr) || !errors.Is(err, keystore.ErrPaperBackupDamaged) {
+						t.Fatalf("lines %d %d %d %d: got %v, want a PaperBackupError", a+1, b+1, c+1, d+1, err)
+					}
+					if want := []int{a + 1, b + 1, c + 1, d + 1}; !reflect.DeepEqual(perr.Damaged, want) {
+						t.Fatalf("Damaged = %v, want %v", perr.Damaged, want)
+					}
+					if perr.Recoverable != keystore.PaperParityLines {
+						t.Fatalf("Recoverable = %d, want %d", perr.Recoverable, keystore.PaperParityLines)
+					}
+				}
+			}
+		}
+	}
+
+	tests := []struct {
+		name       string
+		lines      []string
+		passphrase string
+		want       error
+	}{
+		{"no lines", nil, paperPassphrase, keystore.ErrPaperBackupDamaged},
+		{"not a paper backup", []string{"not a paper backup"}, paperPassphrase, keystore.ErrPaperBackupDamaged},
+		{"too many lines", append(append([]string(nil), lines...), lines[0]), paperPassphrase, keystore.ErrPaperBackupDamaged},
+		{"wrong passphrase", lines, "wrong passphrase", keystore.ErrWrongPassphrase},
+		{"wrong passphrase after recovery", damageLine(lines, 0), "wrong passphrase", keystore.ErrWrongPassphrase},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ks := newErrorStore(t, keystore.Config{})
+			if err := ks.ImportPaperBackup(tt.lines, tt.passphrase); !errors.Is(err, tt.want) {
+				t.Fatalf("ImportPaperBackup: got %v, want %v", err, tt.want)
+			}
+			if _, err := ks.LoadPrivateKey(); !errors.Is(err, keystore.ErrNoKeystore) {
+				t.Fatalf("LoadPrivateKey after a failed import: got %v, want ErrNoKeystore", err)
+			}
+		})
+	}
+}
+
+// assertPaperRestored checks that ks holds fileKeyHex, recorded as restored
+// from a paper backup.
+func assertPaperRestored(t *testing.T, ks *keystore.Store) {
+	t.Helper()
+
+	key, err := ks.LoadPrivateKey()
+	if err != nil {
+		t.Fatalf("LoadPrivateKey: %v", err)
+	}
+	if got := hexKey(key); got != fileKeyHex {
+		t.Fatalf("restored key = %s, want %s", got, fileKeyHex)
+	}
+	p, err := ks.KeyProvenance("")
+	if err != nil {
+		t.Fatalf("KeyProvenance: %v", err)
+	}
+	if p.Origin != keystore.ProvenanceRestored || p.Source != "paper backup" {
+		t.Fatalf("provenance = %+v, want restored from a paper backup", p)
+	}
+}
@@ -0,0 +1,247 @@
+//go:build piv
+
+package keystore
+
+import (
+	"crypto"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/go-piv/piv-go/piv"
+)
+
+// ExternalKeyPIV is the ExternalKeyRef type for keys held in a PIV slot.
+const ExternalKeyPIV = "piv"
+
+// PIVConfig selects a PIV device and slot.
+type PIVConfig struct {
+	// Serial selects the device by serial number. Zero uses the first
+	// device found.
+	Serial uint32
+
+	// Slot is the PIV slot holding the key. Defaults to the signature
+	// slot (9c).
+	Slot piv.Slot
+
+	// PIN supplies the device PIN when the key's PIN policy requires it.
+	PIN PassphraseProvider
+
+	// OnTouch is called before each signature that needs a physical touch,
+	// so callers can prompt the user. The device blocks until touched.
+	OnTouch func()
+
+	// ManagementKey is used for on-device key generation. Defaults to
+	// piv.DefaultManagementKey.
+	ManagementKey *[24]byte
+}
+
+// PIVSigner is an ExternalSigner backed by a key in a PIV slot, such as on
+// a YubiKey. PIV devices only hold NIST curve keys, so signatures are ASN.1
+// DER ECDSA over P-256 or P-384 and are not usable for Ethereum transactions.
+type PIVSigner struct {
+	mu     sync.Mutex
+	yk     *piv.YubiKey
+	cfg    PIVConfig
+	serial uint32
+	info   pivKeyInfo
+}
+
+// pivKeyInfo is the public key and policies of a PIV slot.
+type pivKeyInfo struct {
+	PublicKey   crypto.PublicKey
+	PINPolicy   piv.PINPolicy
+	TouchPolicy piv.TouchPolicy
+}
+
+// NewPIVSigner opens the configured device and reads the public key from
+// its slot.
+func NewPIVSigner(cfg PIVConfig) (*PIVSigner, error) {
+	if cfg.Slot == (piv.Slot{}) {
+		cfg.Slot = piv.SlotSignature
+	}
+
+	yk, serial, err := openPIV(cfg.Serial)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := readPIVKey(yk, cfg.Slot)
+	if err != nil {
+		yk.Close()
+		if errors.Is(err, piv.ErrNotFound) {
+			return nil, fmt.Errorf("%w: slot %x on device %d is empty", ErrNoPrivateKey, cfg.Slot.Key, serial)
+		}
+		return nil, fmt.Errorf("failed to read PIV slot %x: %w", cfg.Slot.Key, err)
+	}
+
+	return &PIVSigner{yk: yk, cfg: cfg, serial: serial, info: info}, nil
+}
+
+// readPIVKey reads the public key and policies of the key in slot. They are
+// taken from the slot's attestation for keys generated on the device, and
+// from the slot certificate with unknown policies for imported keys.
+func readPIVKey(yk *piv.YubiKey, slot piv.Slot) (pivKeyInfo, error) {
+	if slotCert, err := yk.Attest(slot); err == nil {
+		if deviceCert, err := yk.AttestationCertificate(); err == nil {
+			if a, err := piv.Verify(deviceCert, slotCert); err == nil {
+				return pivKeyInfo{PublicKey: slotCert.PublicKey, PINPolicy: a.PINPolicy, TouchPolicy: a.TouchPolicy}, nil
+			}
+		}
+	}
+
+	cert, err := yk.Certificate(slot)
+	if err != nil {
+		return pivKeyInfo{}, err
+	}
+	// Without the policies, ask for the PIN once and expect touches.
+	return pivKeyInfo{PublicKey: cert.PublicKey, PINPolicy: piv.PINPolicyOnce}, nil
+}
+
+func openPIV(serial uint32) (*piv.YubiKey, uint32, error) {
+	cards, err := piv.Cards()
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", ErrDeviceNotFound, err)
+	}
+
+	for _, card := range cards {
+		yk, err := piv.Open(card)
+		if err != nil {
+			continue
+		}
+
+		got, err := yk.Serial()
+		if err == nil && (serial == 0 || got == serial) {
+			return yk, got, nil
+		}
+		yk.Close()
+	}
+
+	if serial != 0 {
+		return nil, 0, fmt.Errorf("%w: no device with serial %d", ErrDeviceNotFound, serial)
+	}
+	return nil, 0, ErrDeviceNotFound
+}
+
+// Public returns the slot's public key.
+func (p *PIVSigner) Public() crypto.PublicKey {
+	return p.info.PublicKey
+}
+
+// ID identifies the device and slot, as recorded in ExternalKeyRef.ID.
+func (p *PIVSigner) ID() string {
+	return fmt.Sprintf("%d/%x", p.serial, p.cfg.Slot.Key)
+}
+
+// SignDigest signs digest on the device, returning an ASN.1 DER signature.
+func (p *PIVSigner) SignDigest(digest []byte) ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.yk == nil {
+		return nil, fmt.Errorf("%w: signer is closed", ErrDeviceNotFound)
+	}
+
+	auth := piv.KeyAuth{PINPolicy: p.info.PINPolicy}
+	if p.cfg.PIN != nil {
+		auth.PINPrompt = p.cfg.PIN.Passphrase
+	}
+
+	key, err := p.yk.PrivateKey(p.cfg.Slot, p.info.PublicKey, auth)
+	if err != nil {
+		return nil, pivError(err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w: PIV slot %x does not hold a signing key", ErrWrongKeyType, p.cfg.Slot.Key)
+	}
+
+	if p.info.TouchPolicy != piv.TouchPolicyNever && p.cfg.OnTouch != nil {
+		p.cfg.OnTouch()
+	}
+
+	sig, err := signer.Sign(rand.Reader, digest, crypto.Hash(0))
+	if err != nil {
+		return nil, pivError(err)
+	}
+	return sig, nil
+}
+
+// Close releases the device.
+func (p *PIVSigner) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.yk == nil {
+		return nil
+	}
+	err := p.yk.Close()
+	p.yk = nil
+	return err
+}
+
+// pivError maps device errors onto the package's sentinels.
+func pivError(err error) error {
+	var authErr piv.AuthErr
+	if errors.As(err, &authErr) {
+		if authErr.Retries == 0 {
+			return ErrPINBlocked
+		}
+		return fmt.Errorf("%w: %d PIN retries left", ErrWrongPassphrase, authErr.Retries)
+	}
+
+	// A touch timeout is reported as an unsatisfied security status.
+	if strings.Contains(err.Error(), "security status not satisfied") {
+		return fmt.Errorf("%w: %v", ErrTouchRequired, err)
+	}
+
+	return fmt.Errorf("PIV operation failed: %w", err)
+}
+
+// GenerateOnPIV generates a P-256 key in the configured slot, replacing any
+// key already there, and records only a reference to it in the keystore.
+// The key requires the PIN once per session and a touch for every signature.
+func (s *Store) GenerateOnPIV(cfg PIVConfig) (*PIVSigner, error) {
+	if cfg.Slot == (piv.Slot{}) {
+		cfg.Slot = piv.SlotSignature
+	}
+
+	mgmt := piv.DefaultManagementKey
+	if cfg.ManagementKey != nil {
+		mgmt = *cfg.ManagementKey
+	}
+
+	yk, serial, err := openPIV(cfg.Serial)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = yk.GenerateKey(mgmt, cfg.Slot, piv.Key{
+		Algorithm:   piv.AlgorithmEC256,
+		PINPolicy:   piv.PINPolicyOnce,
+		TouchPolicy: piv.TouchPolicyAlways,
+	})
+	yk.Close()
+	if err != nil {
+		return nil, pivError(err)
+	}
+
+	cfg.Serial = serial
+	signer, err := NewPIVSigner(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.saveExternalKey(ExternalKeyPIV, signer.ID(), signer.Public()); err != nil {
+		signer.Close()
+		return nil, err
+	}
+
+	return signer, nil
+}
@@ -0,0 +1,357 @@
+package keystore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// policyWindow is the period MaxTxPerHour counts transactions over
+const policyWindow = time.Hour
+
+// SigningPolicy limits what the keystore signs, per account. It is stored
+// in the keystore file, so once in place it can only be changed with
+// UpdatePolicy.
+type SigningPolicy struct {
+	// Accounts holds the limits of each account, keyed by account name;
+	// the empty name is the primary key. Accounts without an entry are
+	// unrestricted.
+	Accounts map[string]AccountPolicy `json:"accounts"`
+}
+
+// AccountPolicy is the set of limits applied to one account. Zero values
+// impose no limit.
+type AccountPolicy struct {
+	// MaxValue is the most wei a single transaction may transfer.
+	MaxValue *big.Int `json:"max_value,omitempty"`
+
+	// AllowedTo lists the only destinations transactions may have;
+	// contract creations are refused when it is set.
+	AllowedTo []common.Address `json:"allowed_to,omitempty"`
+
+	// AllowedChainIDs lists the only chains transactions may be signed for.
+	AllowedChainIDs []*big.Int `json:"allowed_chain_ids,omitempty"`
+
+	// MaxTxPerHour is the most transactions signed in any hour. The count
+	// is persisted, so restarting the process does not reset it.
+	MaxTxPerHour int `json:"max_tx_per_hour,omitempty"`
+
+	// AllowDigests permits SignDigest, SignWithAccount and BatchSigner,
+	// which sign hashes the policy cannot inspect.
+	AllowDigests bool `json:"allow_digests,omitempty"`
+}
+
+func (p *SigningPolicy) validate() error {
+	if p == nil {
+		return nil
+	}
+	for name, ap := range p.Accounts {
+		if ap.MaxValue != nil && ap.MaxValue.Sign() < 0 {
+			return fmt.Errorf("%w: account %q: MaxValue is negative", ErrInvalidPolicy, name)
+		}
+		if ap.MaxTxPerHour < 0 {
+			return fmt.Errorf("%w: account %q: MaxTxPerHour is negative", ErrInvalidPolicy, name)
+		}
+		for _, id := range ap.AllowedChainIDs {
+			if id == nil || id.Sign() <= 0 {
+				return fmt.Errorf("%w: account %q: invalid chain id %v", ErrInvalidPolicy, name, id)
+			}
+		}
+	}
+	return nil
+}
+
+// UpdatePolicy replaces the signing policy stored in the keystore; nil
+// removes it. Transaction counts are kept. It can be gated by listing
+// AuthUpdatePolicy in Config.RequireAuthorizationFor.
+func (s *Store) UpdatePolicy(p *SigningPolicy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.authorized(AuthUpdatePolicy); err != nil {
+		return err
+	}
+	if err := p.validate(); err != nil {
+		return err
+	}
+
+	return s.updateScope(scopeKey, func() error {
+		s.Policy = p.copy()
+		s.pruneUsage(s.now())
+		return nil
+	})
+}
+
+// SigningPolicy returns a copy of the signing policy in force, nil if
+// there is none.
+func (s *Store) SigningPolicy() (*SigningPolicy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil && !isNoKeystore(err) {
+		return nil, err
+	}
+	return s.signingPolicy().copy(), nil
+}
+
+// SignTransactionWithAccount signs tx for chainID with the named account,
+// subject to its chain metadata and signing policy like SignTransaction.
+func (s *Store) SignTransactionWithAccount(name string, tx *types.Transaction, chainID *big.Int) (signed *types.Transaction, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer func() { s.audit(AuditSign, name, err) }()
+
+	if err := s.authorized(AuthSignTransaction); err != nil {
+		return nil, err
+	}
+	if chainID == nil {
+		return nil, fmt.Errorf("%w: chain id is required", ErrInvalidChainID)
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	key, err := s.accountKey(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkSigningKey(name); err != nil {
+		return nil, err
+	}
+
+	stored, err := s.parseChainID(s.Accounts[name].ChainID)
+	if err != nil {
+		return nil, err
+	}
+	if stored != nil && stored.Cmp(chainID) != 0 {
+		mismatch := fmt.Errorf("%w: account %q is for chain %s, signing for chain %s", ErrChainMismatch, name, stored, chainID)
+		if !s.config.AllowChainMismatch {
+			return nil, mismatch
+		}
+		s.config.Logger.Warn("keystore: signing for a different chain than the account was saved for", "error", mismatch)
+	}
+
+	if txChain := tx.ChainId(); tx.Type() != types.LegacyTxType && txChain.Cmp(chainID) != 0 {
+		return nil, fmt.Errorf("%w: transaction is for chain %s, signing for %s", ErrChainMismatch, txChain, chainID)
+	}
+
+	if err := s.enforcePolicy(name, tx, chainID); err != nil {
+		return nil, err
+	}
+	return types.SignTx(tx, types.LatestSignerForChainID(chainID), key)
+}
+
+// signingPolicy returns the policy in force: the one stored in the
+// keystore or, until one is stored, Config.SigningPolicy.
+func (s *Store) signingPolicy() *SigningPolicy {
+	if s.Policy != nil {
+		if !s.policyWarned && s.config.SigningPolicy != nil && !s.Policy.equal(s.config.SigningPolicy) {
+			s.policyWarned = true
+			s.config.Logger.Warn("keystore: Config.SigningPolicy differs from the stored policy and is ignored; use UpdatePolicy")
+		}
+		return s.Policy
+	}
+	return s.config.SigningPolicy
+}
+
+// accountPolicy returns the limits of account, or false if it has none.
+func (s *Store) accountPolicy(account string) (AccountPolicy, bool) {
+	p := s.signingPolicy()
+	if p == nil {
+		return AccountPolicy{}, false
+	}
+	ap, ok := p.Accounts[account]
+	return ap, ok
+}
+
+// enforcePolicy fails with ErrPolicyViolation if the policy of account
+// forbids signing tx for chainID. Otherwise the transaction is counted and
+// saved before returning, so no signature is produced that the persisted
+// count does not include. The first check also stores
+// Config.SigningPolicy, from then on changeable only with UpdatePolicy.
+func (s *Store) enforcePolicy(account string, tx *types.Transaction, chainID *big.Int) error {
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	ap, ok := s.accountPolicy(account)
+	if !ok {
+		return nil
+	}
+	if err := ap.check(tx, chainID); err != nil {
+		if s.Policy == nil {
+			// Refusing counts as the first check too, so a looser
+			// Config.SigningPolicy cannot replace this one later.
+			serr := s.updateScope(scopeKey, func() error {
+				if s.Policy == nil {
+					s.Policy = s.config.SigningPolicy.copy()
+				}
+				return nil
+			})
+			if serr != nil {
+				return serr
+			}
+		}
+		return policyViolation(account, err)
+	}
+
+	if ap.MaxTxPerHour == 0 && s.Policy != nil {
+		return nil
+	}
+
+	return s.updateScope(scopeKey, func() error {
+		if s.Policy == nil {
+			s.Policy = s.config.SigningPolicy.copy()
+		}
+		// The stored policy may have changed since the check above.
+		ap, ok := s.Policy.Accounts[account]
+		if !ok {
+			return nil
+		}
+		if err := ap.check(tx, chainID); err != nil {
+			return policyViolation(account, err)
+		}
+		if ap.MaxTxPerHour == 0 {
+			return nil
+		}
+
+		now := s.now()
+		s.pruneUsage(now)
+		if n := len(s.PolicyUsage[account]); n >= ap.MaxTxPerHour {
+			return policyViolation(account, fmt.Errorf("%d transactions in the last hour, limit %d", n, ap.MaxTxPerHour))
+		}
+
+		if s.PolicyUsage == nil {
+			s.PolicyUsage = make(map[string][]int64)
+		}
+		s.PolicyUsage[account] = append(s.PolicyUsage[account], now.Unix())
+		return nil
+	})
+}
+
+// check applies the limits that depend on the transaction alone.
+func (ap AccountPolicy) check(tx *types.Transaction, chainID *big.Int) error {
+	if len(ap.AllowedChainIDs) > 0 && !containsChain(ap.AllowedChainIDs, chainID) {
+		return fmt.Errorf("chain %s is not allowed", chainID)
+	}
+
+	if ap.MaxValue != nil && tx.Value().Cmp(ap.MaxValue) > 0 {
+		return fmt.Errorf("value %s wei exceeds the limit of %s wei", tx.Value(), ap.MaxValue)
+	}
+
+	if len(ap.AllowedTo) > 0 {
+		to := tx.To()
+		if to == nil {
+			return fmt.Errorf("contract creation is not allowed")
+		}
+		allowed := false
+		for _, a := range ap.AllowedTo {
+			if a == *to {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("destination %s is not allowed", to.Hex())
+		}
+	}
+	return nil
+}
+
+// allowDigests fails with ErrPolicyViolation if account is under a policy
+// that does not permit signing bare digests. The caller has loaded the
+// keystore.
+func (s *Store) allowDigests(account string) error {
+	ap, ok := s.accountPolicy(account)
+	if !ok || ap.AllowDigests {
+		return nil
+	}
+	return policyViolation(account, fmt.Errorf("digest signing is not allowed"))
+}
+
+// pruneUsage drops transaction times that have left the window, and the
+// counts of accounts no longer under a policy.
+func (s *Store) pruneUsage(now time.Time) {
+	cutoff := now.Add(-policyWindow).Unix()
+	for account, times := range s.PolicyUsage {
+		if _, ok := s.Policy.accounts()[account]; !ok {
+			delete(s.PolicyUsage, account)
+			continue
+		}
+		kept := times[:0]
+		for _, t := range times {
+			if t > cutoff {
+				kept = append(kept, t)
+			}
+		}
+		if len(kept) == 0 {
+			delete(s.PolicyUsage, account)
+		} else {
+			s.PolicyUsage[account] = kept
+		}
+	}
+	if len(s.PolicyUsage) == 0 {
+		s.PolicyUsage = nil
+	}
+}
+
+func (p *SigningPolicy) accounts() map[string]AccountPolicy {
+	if p == nil {
+		return nil
+	}
+	return p.Accounts
+}
+
+// equal compares policies by their persisted form.
+func (p *SigningPolicy) equal(other *SigningPolicy) bool {
+	a, aerr := json.Marshal(p)
+	b, berr := json.Marshal(other)
+	return aerr == nil && berr == nil && bytes.Equal(a, b)
+}
+
+func (p *SigningPolicy) copy() *SigningPolicy {
+	if p == nil {
+		return nil
+	}
+
+	c := &SigningPolicy{Accounts: make(map[string]AccountPolicy, len(p.Accounts))}
+	for name, ap := range p.Accounts {
+		if ap.MaxValue != nil {
+			ap.MaxValue = new(big.Int).Set(ap.MaxValue)
+		}
+		ap.AllowedTo = append([]common.Address(nil), ap.AllowedTo...)
+		ids := make([]*big.Int, len(ap.AllowedChainIDs))
+		for i, id := range ap.AllowedChainIDs {
+			ids[i] = new(big.Int).Set(id)
+		}
+		if len(ids) == 0 {
+			ids = nil
+		}
+		ap.AllowedChainIDs = ids
+		c.Accounts[name] = ap
+	}
+	return c
+}
+
+func containsChain(ids []*big.Int, chainID *big.Int) bool {
+	for _, id := range ids {
+		if id.Cmp(chainID) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func policyViolation(account string, err error) error {
+	who := "primary key"
+	if account != "" {
+		who = fmt.Sprintf("account %q", account)
+	}
+	return fmt.Errorf("%w: %s: %v", ErrPolicyViolation, who, err)
+}
@@ -0,0 +1,235 @@
+package keystore_test
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/theblitlabs/keystore"
+)
+
+var (
+	policyChain = big.NewInt(1)
+	allowedTo   = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	otherTo     = common.HexToAddress("0x00000000000000000000000000000000000000bb")
+)
+
+func policyTx(to *common.Address, wei int64) *types.Transaction {
+	return types.NewTx(&types.DynamicFeeTx{
+		ChainID:   policyChain,
+		To:        to,
+		Value:     big.NewInt(wei),
+		Gas:       21000,
+		GasFeeCap: big.NewInt(1),
+		GasTipCap: big.NewInt(1),
+	})
+}
+
+func newPolicyStore(t *testing.T, clock *testClock, dir string, p *keystore.SigningPolicy) *keystore.Store {
+	t.Helper()
+
+	ks, err := keystore.NewKeystore(clock.config(keystore.Config{DirPath: dir, SigningPolicy: p, Logger: discardLogger}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ks
+}
+
+func TestSigningPolicyRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  keystore.AccountPolicy
+		sign    func(ks *keystore.Store) error
+		wantErr string
+	}{
+		{
+			name:   "value at the limit",
+			policy: keystore.AccountPolicy{MaxValue: big.NewInt(100)},
+			sign:   signTx(policyTx(&allowedTo, 100), policyChain),
+		},
+		{
+			name:    "value above the limit",
+			policy:  keystore.AccountPolicy{MaxValue: big.NewInt(100)},
+			sign:    signTx(policyTx(&allowedTo, 101), policyChain),
+			wantErr: "exceeds the limit",
+		},
+		{
+			name:   "allowed destination",
+			policy: keystore.AccountPolicy{AllowedTo: []common.Address{allowedTo}},
+			sign:   signTx(policyTx(&allowedTo, 1), policyChain),
+		},
+		{
+			name:    "other destination",
+			policy:  keystore.AccountPolicy{AllowedTo: []common.Address{allowedTo}},
+			sign:    signTx(policyTx(&otherTo, 1), policyChain),
+			wantErr: "destination " + otherTo.Hex() + " is not allowed",
+		},
+		{
+			name:    "contract creation",
+			policy:  keystore.AccountPolicy{AllowedTo: []common.Address{allowedTo}},
+			sign:    signTx(policyTx(nil, 0), policyChain),
+			wantErr: "contract creation",
+		},
+		{
+			name:   "allowed chain",
+			policy: keystore.AccountPolicy{AllowedChainIDs: []*big.Int{big.NewInt(5), policyChain}},
+			sign:   signTx(policyTx(&allowedTo, 1), policyChain),
+		},
+		{
+			name:    "other chain",
+			policy:  keystore.AccountPolicy{AllowedChainIDs: []*big.Int{big.NewInt(5)}},
+			sign:    signTx(policyTx(&allowedTo, 1), policyChain),
+			wantErr: "chain 1 is not allowed",
+		},
+		{
+			name:    "digests refused",
+			policy:  keystore.AccountPolicy{MaxValue: big.NewInt(100)},
+			sign:    signDigest,
+			wantErr: "digest signing is not allowed",
+		},
+		{
+			name:   "digests allowed",
+			policy: keystore.AccountPolicy{AllowDigests: true},
+			sign:   signDigest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ks := newPolicyStore(t, newTestClock(epoch), t.TempDir(), &keystore.SigningPolicy{
+				Accounts: map[string]keystore.AccountPolicy{"": tt.policy},
+			})
+			if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+				t.Fatal(err)
+			}
+			if err := ks.SaveAccount("free", credentialKeyHex); err != nil {
+				t.Fatal(err)
+			}
+
+			err := tt.sign(ks)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("signing: %v", err)
+				}
+			} else if !errors.Is(err, keystore.ErrPolicyViolation) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("signing: got %v, want a policy violation mentioning %q", err, tt.wantErr)
+			}
+
+			// Accounts without a policy are unrestricted.
+			if _, err := ks.SignTransactionWithAccount("free", policyTx(nil, 1e18), policyChain); err != nil {
+				t.Fatalf("signing with an account without policy: %v", err)
+			}
+		})
+	}
+}
+
+func signTx(tx *types.Transaction, chainID *big.Int) func(*keystore.Store) error {
+	return func(ks *keystore.Store) error {
+		_, err := ks.SignTransaction(tx, chainID)
+		return err
+	}
+}
+
+func signDigest(ks *keystore.Store) error {
+	_, err := ks.SignDigest(crypto.Keccak256([]byte("policy")))
+	return err
+}
+
+func TestSigningPolicyRateLimitPersists(t *testing.T) {
+	clock := newTestClock(epoch)
+	dir := t.TempDir()
+	policy := &keystore.SigningPolicy{Accounts: map[string]keystore.AccountPolicy{"": {MaxTxPerHour: 2}}}
+	ks := newPolicyStore(t, clock, dir, policy)
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+
+	sign := signTx(policyTx(&allowedTo, 1), policyChain)
+	for i := 0; i < 2; i++ {
+		if err := sign(ks); err != nil {
+			t.Fatalf("transaction %d: %v", i+1, err)
+		}
+		clock.Advance(10 * time.Minute)
+	}
+	if err := sign(ks); !errors.Is(err, keystore.ErrPolicyViolation) {
+		t.Fatalf("third transaction: got %v, want ErrPolicyViolation", err)
+	}
+
+	// A restarted process sees the same count.
+	restarted := newPolicyStore(t, clock, dir, policy)
+	if err := sign(restarted); !errors.Is(err, keystore.ErrPolicyViolation) {
+		t.Fatalf("after restarting: got %v, want ErrPolicyViolation", err)
+	}
+
+	// The first transaction leaves the window an hour after it was signed.
+	clock.Set(epoch.Add(time.Hour + time.Second))
+	if err := sign(restarted); err != nil {
+		t.Fatalf("after the first transaction left the window: %v", err)
+	}
+	if err := sign(restarted); !errors.Is(err, keystore.ErrPolicyViolation) {
+		t.Fatalf("second transaction in the new window: got %v, want ErrPolicyViolation", err)
+	}
+}
+
+func TestUpdatePolicy(t *testing.T) {
+	clock := newTestClock(epoch)
+	dir := t.TempDir()
+	strict := &keystore.SigningPolicy{Accounts: map[string]keystore.AccountPolicy{"": {MaxValue: big.NewInt(10)}}}
+	ks := newPolicyStore(t, clock, dir, strict)
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	overLimit := signTx(policyTx(&allowedTo, 1000), policyChain)
+	if err := overLimit(ks); !errors.Is(err, keystore.ErrPolicyViolation) {
+		t.Fatalf("over the configured limit: got %v, want ErrPolicyViolation", err)
+	}
+
+	// Once stored, the policy cannot be loosened through Config.
+	loose := &keystore.SigningPolicy{Accounts: map[string]keystore.AccountPolicy{"": {MaxValue: big.NewInt(1e6)}}}
+	if err := overLimit(newPolicyStore(t, clock, dir, loose)); !errors.Is(err, keystore.ErrPolicyViolation) {
+		t.Fatalf("with a looser Config.SigningPolicy: got %v, want ErrPolicyViolation", err)
+	}
+	if err := overLimit(newPolicyStore(t, clock, dir, nil)); !errors.Is(err, keystore.ErrPolicyViolation) {
+		t.Fatalf("without Config.SigningPolicy: got %v, want ErrPolicyViolation", err)
+	}
+
+	invalid := []*keystore.SigningPolicy{
+		{Accounts: map[string]keystore.AccountPolicy{"": {MaxValue: big.NewInt(-1)}}},
+		{Accounts: map[string]keystore.AccountPolicy{"": {MaxTxPerHour: -1}}},
+		{Accounts: map[string]keystore.AccountPolicy{"": {AllowedChainIDs: []*big.Int{big.NewInt(0)}}}},
+	}
+	for _, p := range invalid {
+		if err := ks.UpdatePolicy(p); !errors.Is(err, keystore.ErrInvalidPolicy) {
+			t.Errorf("UpdatePolicy(%+v): got %v, want ErrInvalidPolicy", p.Accounts[""], err)
+		}
+	}
+
+	if err := ks.UpdatePolicy(loose); err != nil {
+		t.Fatalf("UpdatePolicy: %v", err)
+	}
+	if err := overLimit(ks); err != nil {
+		t.Fatalf("after UpdatePolicy: %v", err)
+	}
+	got, err := newPolicyStore(t, clock, dir, nil).SigningPolicy()
+	if err != nil || got.Accounts[""].MaxValue.Cmp(big.NewInt(1e6)) != 0 {
+		t.Fatalf("stored policy = %+v, %v", got, err)
+	}
+
+	// The returned policy is a copy.
+	got.Accounts[""].MaxValue.SetInt64(0)
+	if err := overLimit(ks); err != nil {
+		t.Fatalf("after editing the returned policy: %v", err)
+	}
+
+	if err := ks.UpdatePolicy(nil); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := newPolicyStore(t, clock, dir, nil).SigningPolicy(); err != nil || p != nil {
+		t.Fatalf("SigningPolicy after removing it = %+v, %v", p, err)
+	}
+}
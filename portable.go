@@ -0,0 +1,220 @@
+package keystore
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// PortablePrefix starts every string produced by MarshalPortable
+const PortablePrefix = "ksp1."
+
+// MarshalPortable encodes the whole keystore as one compact string,
+// compressed and encrypted with passphrase, for platforms where state has
+// to travel in an environment variable or a parameter store entry.
+// Encrypted keys stay encrypted under their own passphrase.
+func (s *Store) MarshalPortable(passphrase string, opts ...ExportOption) (portable string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer func() { s.audit(AuditExport, "", err) }()
+
+	if err := s.redeemExport("MarshalPortable", ExportScopeFull, opts); err != nil {
+		return "", err
+	}
+
+	if err := s.load(); err != nil {
+		return "", err
+	}
+	if err := s.frozenError(); err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal((*storeJSON)(s))
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal keystore: %w", err)
+	}
+	defer wipe(data)
+
+	return encodePortable(data, passphrase)
+}
+
+// NewKeystoreFromPortable returns a Store holding the keystore encoded in
+// portable. It lives in memory and saves fail with ErrReadOnly; use
+// NewPortableBackend with a save callback to persist changes.
+func NewKeystoreFromPortable(portable, passphrase string) (*Store, error) {
+	backend, err := NewPortableBackend(portable, passphrase, nil)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeystore(Config{Backend: backend})
+}
+
+// PortableBackend keeps a keystore decoded from a portable string in
+// memory. Each write is re-encoded and handed to the save callback, which
+// typically stores it in SSM or Secrets Manager; Remove passes "".
+type PortableBackend struct {
+	mem        *MemoryBackend
+	passphrase string
+	onSave     func(portable string) error
+}
+
+// NewPortableBackend decodes portable with passphrase. An empty portable
+// string starts an empty keystore. With a nil onSave the backend is
+// read-only.
+func NewPortableBackend(portable, passphrase string, onSave func(portable string) error) (*PortableBackend, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("%w: portable passphrase", ErrEmptyPassphrase)
+	}
+
+	b := &PortableBackend{mem: NewMemoryBackend(), passphrase: passphrase, onSave: onSave}
+	if portable == "" {
+		return b, nil
+	}
+
+	data, err := decodePortable(portable, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(data)
+
+	if err := b.mem.Write(data); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *PortableBackend) String() string {
+	return "portable"
+}
+
+func (b *PortableBackend) Read() ([]byte, error) {
+	return b.mem.Read()
+}
+
+func (b *PortableBackend) Write(data []byte) error {
+	if b.onSave == nil {
+		return fmt.Errorf("portable keystore has no save callback: %w", ErrReadOnly)
+	}
+
+	// Indented JSON is compacted to keep the string small.
+	doc := data
+	var compact bytes.Buffer
+	if json.Compact(&compact, data) == nil {
+		doc = compact.Bytes()
+		defer wipe(doc)
+	}
+
+	portable, err := encodePortable(doc, b.passphrase)
+	if err != nil {
+		return err
+	}
+	if err := b.onSave(portable); err != nil {
+		return fmt.Errorf("failed to save portable keystore: %w", err)
+	}
+	return b.mem.Write(data)
+}
+
+func (b *PortableBackend) Remove() error {
+	if b.onSave == nil {
+		return fmt.Errorf("portable keystore has no save callback: %w", ErrReadOnly)
+	}
+	if err := b.onSave(""); err != nil {
+		return fmt.Errorf("failed to save portable keystore: %w", err)
+	}
+	return b.mem.Remove()
+}
+
+func (b *PortableBackend) stamp() (backendStamp, error) {
+	return b.mem.stamp()
+}
+
+// encodePortable returns PortablePrefix followed by the unpadded base64url
+// encoding of salt, nonce and the AES-GCM sealed, deflated document. The
+// prefix is authenticated as additional data.
+func encodePortable(data []byte, passphrase string) (string, error) {
+	if passphrase == "" {
+		return "", fmt.Errorf("%w: portable passphrase", ErrEmptyPassphrase)
+	}
+
+	var compressed bytes.Buffer
+	w, err := flate.NewWriter(&compressed, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(data); err != nil {
+		return "", fmt.Errorf("failed to compress keystore: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("failed to compress keystore: %w", err)
+	}
+	defer wipe(compressed.Bytes())
+
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	gcm, err := passphraseCipher(passphrase, salt, ScryptParams{N: scryptN, R: scryptR, P: scryptP})
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	out := append(salt, nonce...)
+	out = gcm.Seal(out, nonce, compressed.Bytes(), []byte(PortablePrefix))
+	return PortablePrefix + base64.RawURLEncoding.EncodeToString(out), nil
+}
+
+func decodePortable(portable, passphrase string) ([]byte, error) {
+	body, ok := strings.CutPrefix(strings.TrimSpace(portable), PortablePrefix)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing %q prefix", ErrInvalidPortable, PortablePrefix)
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPortable, err)
+	}
+
+	params := ScryptParams{N: scryptN, R: scryptR, P: scryptP}
+	if len(raw) < saltLen {
+		return nil, fmt.Errorf("%w: truncated", ErrInvalidPortable)
+	}
+	gcm, err := passphraseCipher(passphrase, raw[:saltLen], params)
+	if err != nil {
+		return nil, err
+	}
+
+	rest := raw[saltLen:]
+	if len(rest) < gcm.NonceSize()+gcm.Overhead() {
+		return nil, fmt.Errorf("%w: truncated", ErrInvalidPortable)
+	}
+
+	compressed, err := gcm.Open(nil, rest[:gcm.NonceSize()], rest[gcm.NonceSize():], []byte(PortablePrefix))
+	if err != nil {
+		return nil, fmt.Errorf("%w or corrupted portable keystore", ErrWrongPassphrase)
+	}
+	defer wipe(compressed)
+
+	r := flate.NewReader(bytes.NewReader(compressed))
+	defer r.Close()
+
+	data, err := io.ReadAll(io.LimitReader(r, DefaultMaxFileSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPortable, err)
+	}
+	if len(data) > DefaultMaxFileSize {
+		wipe(data)
+		return nil, fmt.Errorf("%w of %d bytes", ErrKeystoreTooLarge, DefaultMaxFileSize)
+	}
+	return data, nil
+}
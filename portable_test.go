@@ -0,0 +1,173 @@
+package keystore_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/theblitlabs/keystore"
+)
+
+const portablePassphrase = "portable"
+
+func TestPortableRoundTrip(t *testing.T) {
+	ks, err := keystore.NewKeystore(keystore.Config{
+		DirPath:    t.TempDir(),
+		Passphrase: keystore.StaticPassphrase("store"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveToken("portable-token"); err != nil {
+		t.Fatal(err)
+	}
+	want, err := ks.GetAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	portable, err := ks.MarshalPortable(portablePassphrase)
+	if err != nil {
+		t.Fatalf("MarshalPortable: %v", err)
+	}
+	if !strings.HasPrefix(portable, keystore.PortablePrefix) {
+		t.Fatalf("portable string %q lacks the prefix", portable)
+	}
+	// Well within the 4 KB Lambda limit on all environment variables.
+	if len(portable) > 1024 {
+		t.Fatalf("portable string is %d bytes, want at most 1024", len(portable))
+	}
+	if strings.Contains(portable, fileKeyHex) || strings.Contains(portable, "portable-token") {
+		t.Fatal("portable string holds secrets in the clear")
+	}
+
+	restored, err := keystore.NewKeystoreFromPortable(portable, portablePassphrase)
+	if err != nil {
+		t.Fatalf("NewKeystoreFromPortable: %v", err)
+	}
+	if token, err := restored.LoadToken(); err != nil || token != "portable-token" {
+		t.Fatalf("LoadToken = %q, %v", token, err)
+	}
+	if got, err := restored.GetAddress(); err != nil || got != want {
+		t.Fatalf("GetAddress = %s, %v, want %s", got, err, want)
+	}
+
+	if err := restored.SaveToken("changed"); !errors.Is(err, keystore.ErrReadOnly) {
+		t.Fatalf("SaveToken without a save callback: got %v, want ErrReadOnly", err)
+	}
+}
+
+func TestPortableBackendSaves(t *testing.T) {
+	var saved []string
+	backend, err := keystore.NewPortableBackend("", portablePassphrase, func(portable string) error {
+		saved = append(saved, portable)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks, err := keystore.NewKeystore(keystore.Config{Backend: backend})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ks.SaveToken("first"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 2 {
+		t.Fatalf("save callback ran %d times, want 2", len(saved))
+	}
+
+	restored, err := keystore.NewKeystoreFromPortable(saved[len(saved)-1], portablePassphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token, err := restored.LoadToken(); err != nil || token != "first" {
+		t.Fatalf("LoadToken = %q, %v", token, err)
+	}
+	key, err := restored.LoadPrivateKey()
+	if err != nil || hexKey(key) != fileKeyHex {
+		t.Fatalf("LoadPrivateKey: %v", err)
+	}
+
+	if err := ks.Destroy(); err != nil {
+		t.Fatal(err)
+	}
+	if saved[len(saved)-1] != "" {
+		t.Fatal("Destroy did not hand an empty string to the save callback")
+	}
+}
+
+func TestPortableBackendSaveFails(t *testing.T) {
+	backend, err := keystore.NewPortableBackend("", portablePassphrase, func(string) error {
+		return errors.New("parameter store unavailable")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks, err := keystore.NewKeystore(keystore.Config{Backend: backend})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ks.SaveToken("lost"); err == nil {
+		t.Fatal("SaveToken succeeded although the callback failed")
+	}
+	if _, err := ks.LoadToken(); !errors.Is(err, keystore.ErrNoKeystore) {
+		t.Fatalf("LoadToken after a failed save: got %v, want ErrNoKeystore", err)
+	}
+}
+
+func TestPortableInvalid(t *testing.T) {
+	ks, err := keystore.NewKeystore(keystore.Config{DirPath: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveToken("token"); err != nil {
+		t.Fatal(err)
+	}
+	portable, err := ks.MarshalPortable(portablePassphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := portable[len(keystore.PortablePrefix):]
+	flipped := []byte(body)
+	if flipped[len(flipped)/2] == 'A' {
+		flipped[len(flipped)/2] = 'B'
+	} else {
+		flipped[len(flipped)/2] = 'A'
+	}
+
+	tests := []struct {
+		name       string
+		portable   string
+		passphrase string
+		want       error
+	}{
+		{name: "wrong passphrase", portable: portable, passphrase: "wrong", want: keystore.ErrWrongPassphrase},
+		{name: "tampered", portable: keystore.PortablePrefix + string(flipped), passphrase: portablePassphrase, want: keystore.ErrWrongPassphrase},
+		{name: "missing prefix", portable: body, passphrase: portablePassphrase, want: keystore.ErrInvalidPortable},
+		{name: "truncated", portable: portable[:len(keystore.PortablePrefix)+8], passphrase: portablePassphrase, want: keystore.ErrInvalidPortable},
+		{name: "not base64", portable: keystore.PortablePrefix + "!!!", passphrase: portablePassphrase, want: keystore.ErrInvalidPortable},
+		{name: "empty passphrase", portable: portable, want: keystore.ErrEmptyPassphrase},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := keystore.NewKeystoreFromPortable(tt.portable, tt.passphrase); !errors.Is(err, tt.want) {
+				t.Fatalf("NewKeystoreFromPortable: got %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := ks.MarshalPortable(""); !errors.Is(err, keystore.ErrEmptyPassphrase) {
+		t.Fatalf("MarshalPortable with an empty passphrase: got %v, want ErrEmptyPassphrase", err)
+	}
+}
@@ -0,0 +1,159 @@
+package keystore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// EnvPassphrase returns a PassphraseProvider reading the environment
+// variable name. An unset variable yields ErrNoPassphrase.
+func EnvPassphrase(name string) PassphraseProvider {
+	return PassphraseFunc(func() (string, error) {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("%w: %s is not set", ErrNoPassphrase, name)
+		}
+		return value, nil
+	})
+}
+
+// FilePassphrase returns a PassphraseProvider reading the file at path,
+// without its trailing newline. A missing file yields ErrNoPassphrase.
+func FilePassphrase(path string) PassphraseProvider {
+	return PassphraseFunc(func() (string, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return "", fmt.Errorf("%w: %s does not exist", ErrNoPassphrase, path)
+			}
+			return "", fmt.Errorf("failed to read passphrase file: %w", err)
+		}
+		defer wipe(data)
+		return strings.TrimRight(string(data), "\r\n"), nil
+	})
+}
+
+// FirstOf returns a PassphraseProvider that asks each provider in turn,
+// moving on when one reports ErrNoPassphrase or ErrNonInteractive. Any
+// other error is returned immediately. When every provider is skipped the
+// error wraps each of their errors.
+func FirstOf(providers ...PassphraseProvider) PassphraseProvider {
+	return PassphraseFunc(func() (string, error) {
+		var skipped []error
+		for _, p := range providers {
+			passphrase, err := p.Passphrase()
+			if err == nil {
+				return passphrase, nil
+			}
+			if !errors.Is(err, ErrNoPassphrase) && !errors.Is(err, ErrNonInteractive) {
+				return "", err
+			}
+			skipped = append(skipped, err)
+		}
+		if len(skipped) == 0 {
+			return "", ErrNoPassphrase
+		}
+		return "", fmt.Errorf("no passphrase provider succeeded: %w", errors.Join(skipped...))
+	})
+}
+
+// TerminalPrompt is a PassphraseProvider that reads the passphrase from a
+// terminal without echo. It fails fast with ErrNonInteractive when its
+// input is not a terminal, so services and CI jobs never hang on it.
+type TerminalPrompt struct {
+	// Prompt is written before reading. Defaults to "Passphrase: ".
+	Prompt string
+
+	// Timeout bounds how long the prompt waits. Zero waits until Context
+	// is done.
+	Timeout time.Duration
+
+	// Context cancels the prompt. Defaults to context.Background.
+	Context context.Context
+
+	// In and Out default to os.Stdin and os.Stderr.
+	In  *os.File
+	Out io.Writer
+}
+
+type promptResult struct {
+	passphrase []byte
+	err        error
+}
+
+// Passphrase prompts for the passphrase. The terminal state is restored if
+// the prompt times out, is cancelled or is interrupted with SIGINT; an
+// interrupt is reported as context.Canceled.
+func (t *TerminalPrompt) Passphrase() (string, error) {
+	in, out := t.In, t.Out
+	if in == nil {
+		in = os.Stdin
+	}
+	if out == nil {
+		out = os.Stderr
+	}
+
+	fd := int(in.Fd())
+	if !term.IsTerminal(fd) {
+		return "", ErrNonInteractive
+	}
+
+	state, err := term.GetState(fd)
+	if err != nil {
+		return "", fmt.Errorf("failed to read terminal state: %w", err)
+	}
+
+	ctx := t.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if t.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.Timeout)
+		defer cancel()
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	prompt := t.Prompt
+	if prompt == "" {
+		prompt = "Passphrase: "
+	}
+	fmt.Fprint(out, prompt)
+
+	// ReadPassword cannot be cancelled, so an abandoned read finishes in
+	// the background when the next line arrives.
+	done := make(chan promptResult, 1)
+	go func() {
+		passphrase, err := term.ReadPassword(fd)
+		done <- promptResult{passphrase, err}
+	}()
+
+	select {
+	case r := <-done:
+		fmt.Fprintln(out)
+		if r.err != nil {
+			return "", fmt.Errorf("failed to read passphrase: %w", r.err)
+		}
+		defer wipe(r.passphrase)
+		return string(r.passphrase), nil
+	case <-interrupt:
+		err = context.Canceled
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	term.Restore(fd, state)
+	fmt.Fprintln(out)
+	return "", fmt.Errorf("passphrase prompt aborted: %w", err)
+}
@@ -0,0 +1,102 @@
+package keystore_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/theblitlabs/keystore"
+	"golang.org/x/sys/unix"
+)
+
+// openPTY opens a pseudo-terminal pair: the prompt reads from tty while the
+// test types into and reads the echo from pty.
+func openPTY(t *testing.T) (pty, tty *os.File) {
+	t.Helper()
+
+	pty, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("no pseudo-terminals: %v", err)
+	}
+	t.Cleanup(func() { pty.Close() })
+
+	fd := int(pty.Fd())
+	if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		t.Fatal(err)
+	}
+	n, err := unix.IoctlGetUint32(fd, unix.TIOCGPTN)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tty, err = os.OpenFile("/dev/pts/"+strconv.Itoa(int(n)), os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tty.Close() })
+
+	// Drain the echo so writes to the terminal never block.
+	go io.Copy(io.Discard, pty)
+	return pty, tty
+}
+
+func echoEnabled(t *testing.T, tty *os.File) bool {
+	t.Helper()
+
+	termios, err := unix.IoctlGetTermios(int(tty.Fd()), unix.TCGETS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return termios.Lflag&unix.ECHO != 0
+}
+
+func TestTerminalPromptReads(t *testing.T) {
+	pty, tty := openPTY(t)
+
+	go pty.Write([]byte("hunter2\n"))
+
+	prompt := &keystore.TerminalPrompt{In: tty, Out: io.Discard, Timeout: 5 * time.Second}
+	got, err := prompt.Passphrase()
+	if err != nil || got != "hunter2" {
+		t.Fatalf("Passphrase = %q, %v, want hunter2", got, err)
+	}
+	if !echoEnabled(t, tty) {
+		t.Fatal("echo left disabled")
+	}
+}
+
+func TestTerminalPromptAborts(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		cancel  bool
+		want    error
+	}{
+		{name: "timeout", timeout: 50 * time.Millisecond, want: context.DeadlineExceeded},
+		{name: "cancelled", cancel: true, want: context.Canceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, tty := openPTY(t)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				time.AfterFunc(50*time.Millisecond, cancel)
+			}
+
+			prompt := &keystore.TerminalPrompt{In: tty, Out: io.Discard, Timeout: tt.timeout, Context: ctx}
+			if _, err := prompt.Passphrase(); !errors.Is(err, tt.want) {
+				t.Fatalf("Passphrase: got %v, want %v", err, tt.want)
+			}
+			if !echoEnabled(t, tty) {
+				t.Fatal("echo left disabled after the prompt was aborted")
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package keystore_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/theblitlabs/keystore"
+)
+
+func TestTerminalPromptNonInteractive(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	prompt := &keystore.TerminalPrompt{In: r, Out: w}
+	if _, err := prompt.Passphrase(); !errors.Is(err, keystore.ErrNonInteractive) {
+		t.Fatalf("Passphrase: got %v, want ErrNonInteractive", err)
+	}
+}
+
+func TestFirstOf(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "passphrase")
+	if err := os.WriteFile(file, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("KEYSTORE_TEST_PASSPHRASE", "from-env")
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	var (
+		env      = keystore.EnvPassphrase("KEYSTORE_TEST_PASSPHRASE")
+		unset    = keystore.EnvPassphrase("KEYSTORE_TEST_UNSET")
+		present  = keystore.FilePassphrase(file)
+		missing  = keystore.FilePassphrase(filepath.Join(dir, "missing"))
+		terminal = &keystore.TerminalPrompt{In: r, Out: w}
+		broken   = keystore.PassphraseFunc(func() (string, error) { return "", errors.New("vault unreachable") })
+	)
+
+	tests := []struct {
+		name      string
+		providers []keystore.PassphraseProvider
+		want      string
+		wantErr   error
+	}{
+		{name: "env first", providers: []keystore.PassphraseProvider{env, present, terminal}, want: "from-env"},
+		{name: "unset env falls through", providers: []keystore.PassphraseProvider{unset, present, terminal}, want: "from-file"},
+		{name: "missing file falls through", providers: []keystore.PassphraseProvider{unset, missing, env}, want: "from-env"},
+		{name: "non-interactive falls through", providers: []keystore.PassphraseProvider{terminal, present}, want: "from-file"},
+		{name: "all skipped", providers: []keystore.PassphraseProvider{unset, missing, terminal}, wantErr: keystore.ErrNonInteractive},
+		{name: "all skipped wraps each", providers: []keystore.PassphraseProvider{unset, missing, terminal}, wantErr: keystore.ErrNoPassphrase},
+		{name: "no providers", wantErr: keystore.ErrNoPassphrase},
+		{name: "other errors stop the chain", providers: []keystore.PassphraseProvider{unset, broken, env}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := keystore.FirstOf(tt.providers...).Passphrase()
+			switch {
+			case tt.want != "":
+				if err != nil || got != tt.want {
+					t.Fatalf("Passphrase = %q, %v, want %q", got, err, tt.want)
+				}
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Passphrase: got %v, want %v", err, tt.wantErr)
+				}
+			default:
+				if err == nil || errors.Is(err, keystore.ErrNoPassphrase) {
+					t.Fatalf("Passphrase: got %v, want the provider's own error", err)
+				}
+			}
+		})
+	}
+}
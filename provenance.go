@@ -0,0 +1,176 @@
+package keystore
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Key origins recorded in Provenance.Origin
+const (
+	ProvenanceUnknown   = "unknown"
+	ProvenanceGenerated = "generated"
+	ProvenanceMnemonic  = "mnemonic"
+	ProvenanceHex       = "imported_hex"
+	ProvenanceImported  = "imported"
+	ProvenanceGeth      = "imported_geth"
+	ProvenanceLegacy    = "imported_legacy"
+	ProvenanceRestored  = "restored"
+)
+
+var provenanceOrigins = map[string]bool{
+	ProvenanceUnknown:   true,
+	ProvenanceGenerated: true,
+	ProvenanceMnemonic:  true,
+	ProvenanceHex:       true,
+	ProvenanceImported:  true,
+	ProvenanceGeth:      true,
+	ProvenanceLegacy:    true,
+	ProvenanceRestored:  true,
+}
+
+// Provenance records where a key came from. It is set when a key is first
+// stored and kept as long as the key does not change; only
+// OverrideProvenance rewrites it. Keys stored before provenance was
+// recorded are marked ProvenanceUnknown.
+type Provenance struct {
+	Origin     string `json:"origin"`
+	RecordedAt int64  `json:"recorded_at,omitempty"`
+	Source     string `json:"source,omitempty"`
+}
+
+func (s *Store) newProvenance(origin, source string) *Provenance {
+	return &Provenance{Origin: origin, RecordedAt: s.now().Unix(), Source: source}
+}
+
+func (p *Provenance) copy() *Provenance {
+	if p == nil {
+		return nil
+	}
+	c := *p
+	return &c
+}
+
+// GeneratePrivateKey generates a new secp256k1 primary key, recorded with
+// ProvenanceGenerated, and returns its address.
+func (s *Store) GeneratePrivateKey() (common.Address, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to generate key: %w", err)
+	}
+	privateKeyHex := hex.EncodeToString(crypto.FromECDSA(key))
+
+	if _, err := s.checkPrivateKey(privateKeyHex); err != nil {
+		return common.Address{}, err
+	}
+
+	err = s.updateScope(scopeKey, func() error {
+		return s.setPrimaryKey(privateKeyHex, key, s.newProvenance(ProvenanceGenerated, ""))
+	})
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(key.PublicKey), nil
+}
+
+// KeyProvenance returns the provenance of the primary key, or of the named
+// account when account is not empty.
+func (s *Store) KeyProvenance(account string) (*Provenance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	p, err := s.provenanceOf(account)
+	if err != nil {
+		return nil, err
+	}
+	return p.copy(), nil
+}
+
+// OverrideProvenance replaces the recorded provenance of the primary key,
+// or of the named account, which is otherwise immutable. Use it to record
+// an origin the keystore could not see, such as a key generated by the
+// caller and saved with SaveECDSAKey.
+func (s *Store) OverrideProvenance(account, origin, source string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !provenanceOrigins[origin] {
+		return fmt.Errorf("%w: unknown origin %q", ErrInvalidProvenance, origin)
+	}
+
+	return s.update(func() error {
+		p := s.newProvenance(origin, source)
+		if account == "" {
+			if !s.hasPrimaryKey() {
+				return ErrNoPrivateKey
+			}
+			s.Provenance = p
+			return nil
+		}
+
+		a, ok := s.Accounts[account]
+		if !ok {
+			return fmt.Errorf("%w: %q", ErrAccountNotFound, account)
+		}
+		if a.WatchOnly {
+			return fmt.Errorf("%w: %q is watch-only", ErrNoPrivateKey, account)
+		}
+		a.Provenance = p
+		return nil
+	})
+}
+
+// provenanceOf returns the in-memory provenance of the primary key or of a
+// named account.
+func (s *Store) provenanceOf(account string) (*Provenance, error) {
+	if account == "" {
+		if !s.hasPrimaryKey() {
+			return nil, ErrNoPrivateKey
+		}
+		return s.Provenance, nil
+	}
+
+	a, ok := s.Accounts[account]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrAccountNotFound, account)
+	}
+	return a.Provenance, nil
+}
+
+func (s *Store) hasPrimaryKey() bool {
+	return s.persisted.PrivateKey != "" || s.EncryptedKey != nil || s.KeyShares != nil
+}
+
+// auditProvenance returns the origin of the key used by an operation,
+// without touching storage.
+func (s *Store) auditProvenance(account string) string {
+	p, err := s.provenanceOf(account)
+	if err != nil || p == nil {
+		return ""
+	}
+	return p.Origin
+}
+
+// migrateProvenance marks keys stored before provenance was recorded as
+// ProvenanceUnknown.
+func migrateProvenance(s *Store) {
+	if s.hasPrimaryKey() && s.Provenance == nil {
+		s.Provenance = &Provenance{Origin: ProvenanceUnknown}
+	}
+	for _, accounts := range []map[string]*Account{s.Accounts, s.Trash} {
+		for _, a := range accounts {
+			if !a.WatchOnly && a.Provenance == nil {
+				a.Provenance = &Provenance{Origin: ProvenanceUnknown}
+			}
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package keystore_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/theblitlabs/keystore"
+	"github.com/theblitlabs/keystore/keystoretest"
+)
+
+func TestProvenanceRecorded(t *testing.T) {
+	tests := []struct {
+		name    string
+		account string
+		store   func(t *testing.T, ks *keystore.Store) error
+		origin  string
+		source  string
+	}{
+		{
+			name:   "SavePrivateKey",
+			store:  func(t *testing.T, ks *keystore.Store) error { return ks.SavePrivateKey(fileKeyHex) },
+			origin: keystore.ProvenanceHex,
+		},
+		{
+			name: "GeneratePrivateKey",
+			store: func(t *testing.T, ks *keystore.Store) error {
+				_, err := ks.GeneratePrivateKey()
+				return err
+			},
+			origin: keystore.ProvenanceGenerated,
+		},
+		{
+			name:   "SaveECDSAKey",
+			store:  func(t *testing.T, ks *keystore.Store) error { return ks.SaveECDSAKey(mustKey(t, fileKeyHex)) },
+			origin: keystore.ProvenanceImported,
+		},
+		{
+			name:    "SaveAccount",
+			account: "hot",
+			store:   func(t *testing.T, ks *keystore.Store) error { return ks.SaveAccount("hot", fileKeyHex) },
+			origin:  keystore.ProvenanceHex,
+		},
+		{
+			name: "ImportLegacyFiles",
+			store: func(t *testing.T, ks *keystore.Store) error {
+				legacy := writeLegacy(t, map[string]string{keystore.LegacyKeyFile: fileKeyHex})
+				_, err := ks.ImportLegacyFiles(legacy)
+				return err
+			},
+			origin: keystore.ProvenanceLegacy,
+			source: keystore.LegacyKeyFile,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newTestClock(epoch)
+			var audited []keystore.AuditEvent
+			ks, err := keystore.NewKeystore(clock.config(keystore.Config{
+				DirPath: t.TempDir(),
+				Audit:   func(e keystore.AuditEvent) { audited = append(audited, e) },
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.store(t, ks); err != nil {
+				t.Fatalf("storing the key: %v", err)
+			}
+
+			p, err := ks.KeyProvenance(tt.account)
+			if err != nil {
+				t.Fatalf("KeyProvenance: %v", err)
+			}
+			if p.Origin != tt.origin || p.RecordedAt != epoch.Unix() {
+				t.Fatalf("provenance = %+v, want %s at %d", p, tt.origin, epoch.Unix())
+			}
+			if tt.source != "" && filepath.Base(p.Source) != tt.source {
+				t.Fatalf("source = %q, want %s", p.Source, tt.source)
+			}
+
+			if tt.account == "" {
+				status, err := ks.Status()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if status.Provenance == nil || status.Provenance.Origin != tt.origin {
+					t.Errorf("Status().Provenance = %+v", status.Provenance)
+				}
+				if _, err := ks.SignDigest(crypto.Keccak256([]byte("provenance"))); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				infos, err := ks.ListAccounts()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(infos) != 1 || infos[0].Provenance == nil || infos[0].Provenance.Origin != tt.origin {
+					t.Errorf("ListAccounts = %+v", infos)
+				}
+				if _, err := ks.SignWithAccount(tt.account, crypto.Keccak256([]byte("provenance"))); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			last := audited[len(audited)-1]
+			if last.Op != keystore.AuditSign || last.Origin != tt.origin {
+				t.Errorf("audit event = %+v, want a sign event with origin %s", last, tt.origin)
+			}
+		})
+	}
+}
+
+func TestProvenanceImmutable(t *testing.T) {
+	clock := newTestClock(epoch)
+	ks, err := keystore.NewKeystore(clock.config(keystore.Config{DirPath: t.TempDir()}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+
+	// Saving the same key again, in any way, keeps the first record.
+	clock.Advance(time.Hour)
+	if err := ks.SaveECDSAKey(mustKey(t, fileKeyHex)); err != nil {
+		t.Fatal(err)
+	}
+	p, err := ks.KeyProvenance("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Origin != keystore.ProvenanceHex || p.RecordedAt != epoch.Unix() {
+		t.Fatalf("provenance after re-saving the key = %+v", p)
+	}
+
+	// A different key gets its own.
+	if err := ks.SaveECDSAKey(mustKey(t, credentialKeyHex)); err != nil {
+		t.Fatal(err)
+	}
+	if p, _ = ks.KeyProvenance(""); p.Origin != keystore.ProvenanceImported || p.RecordedAt != epoch.Add(time.Hour).Unix() {
+		t.Fatalf("provenance of a new key = %+v", p)
+	}
+
+	if err := ks.OverrideProvenance("", keystore.ProvenanceGenerated, "hsm ceremony"); err != nil {
+		t.Fatal(err)
+	}
+	if p, _ = ks.KeyProvenance(""); p.Origin != keystore.ProvenanceGenerated || p.Source != "hsm ceremony" {
+		t.Fatalf("provenance after OverrideProvenance = %+v", p)
+	}
+}
+
+func TestOverrideProvenanceErrors(t *testing.T) {
+	ks, err := keystore.NewKeystore(keystore.Config{DirPath: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveWatchAddress("watched", crypto.PubkeyToAddress(mustKey(t, fileKeyHex).PublicKey)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		account string
+		origin  string
+		want    error
+	}{
+		{name: "unknown origin", origin: "bogus", want: keystore.ErrInvalidProvenance},
+		{name: "no primary key", origin: keystore.ProvenanceHex, want: keystore.ErrNoPrivateKey},
+		{name: "missing account", account: "missing", origin: keystore.ProvenanceHex, want: keystore.ErrAccountNotFound},
+		{name: "watch-only account", account: "watched", origin: keystore.ProvenanceHex, want: keystore.ErrNoPrivateKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ks.OverrideProvenance(tt.account, tt.origin, ""); !errors.Is(err, tt.want) {
+				t.Fatalf("OverrideProvenance: got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestProvenanceMigratedAsUnknown(t *testing.T) {
+	data, err := fs.ReadFile(keystoretest.Fixtures, "v1.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, keystore.DefaultFileName), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ks, err := keystore.NewKeystore(keystore.Config{DirPath: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, err := ks.KeyProvenance(""); err != nil || p.Origin != keystore.ProvenanceUnknown {
+		t.Fatalf("primary key provenance = %+v, %v", p, err)
+	}
+	infos, err := ks.ListAccounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, info := range infos {
+		if !info.WatchOnly && (info.Provenance == nil || info.Provenance.Origin != keystore.ProvenanceUnknown) {
+			t.Errorf("account %s provenance = %+v", info.Name, info.Provenance)
+		}
+	}
+}
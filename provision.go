@@ -0,0 +1,181 @@
+package keystore
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const provisionSaltSize = 16
+
+// Provisioning records that the keystore was set up by ProvisionOnce, and
+// a salted digest of the provisioning token used, so that a replay of the
+// token can be told apart from an attempt with another one.
+type Provisioning struct {
+	ProvisionedAt int64  `json:"provisioned_at"`
+	TokenDigest   string `json:"token_digest"`
+	TokenSalt     string `json:"token_salt"`
+}
+
+// Provisioner sets up the keystore inside ProvisionOnce. Its changes are
+// staged in memory and only written if the provisioning function returns
+// nil. It must not be used after that function returns.
+type Provisioner struct {
+	store *Store
+}
+
+// GenerateKey generates the primary key, as Store.GeneratePrivateKey does.
+func (p *Provisioner) GenerateKey() (common.Address, error) {
+	return p.store.GeneratePrivateKey()
+}
+
+// SavePrivateKey stores privateKeyHex as the primary key.
+func (p *Provisioner) SavePrivateKey(privateKeyHex string) error {
+	return p.store.SavePrivateKey(privateKeyHex)
+}
+
+// SaveToken stores the real auth token with the configured TTL.
+func (p *Provisioner) SaveToken(token string) error {
+	return p.store.SaveToken(token)
+}
+
+// SaveTokenWithExpiry stores the real auth token with the given TTL.
+func (p *Provisioner) SaveTokenWithExpiry(token string, ttl time.Duration) error {
+	return p.store.SaveTokenWithExpiry(token, ttl)
+}
+
+// SaveAccount stores a named account.
+func (p *Provisioner) SaveAccount(name, privateKeyHex string) error {
+	return p.store.SaveAccount(name, privateKeyHex)
+}
+
+// ProvisionOnce performs the first-boot setup of a device. provToken is the
+// one-time provisioning token the device shipped with: if the keystore
+// already holds a token, as a factory keystore does, provToken must match
+// it, regardless of its expiry. fn then receives a Provisioner to establish
+// the real key and auth token.
+//
+// The result replaces the keystore in a single atomic write that also
+// records the provisioning time and a digest of provToken; the
+// provisioning token itself is not kept unless fn saves it. If fn fails,
+// or the process dies before the write, nothing is persisted and
+// ProvisionOnce can be retried. Once the keystore is provisioned, further
+// calls fail with ErrAlreadyProvisioned, and a replayed provisioning token
+// is logged. A keystore holding keys but no provisioning record is never
+// replaced and fails with ErrKeystoreExists.
+func (s *Store) ProvisionOnce(provToken string, fn func(p *Provisioner) error) error {
+	if provToken == "" {
+		return fmt.Errorf("%w: provisioning token is empty", ErrEmptyToken)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.writeStaged(func(staging *Store, exists bool) (bool, error) {
+		if exists {
+			if err := s.checkProvisionable(provToken); err != nil {
+				return false, err
+			}
+		}
+
+		record, err := newProvisioning(provToken, s.now())
+		if err != nil {
+			return false, err
+		}
+		if err := fn(&Provisioner{store: staging}); err != nil {
+			return false, err
+		}
+
+		staging.mu.Lock()
+		defer staging.mu.Unlock()
+
+		if err := staging.load(); err != nil && !isNoKeystore(err) {
+			return false, err
+		}
+		// Continue the revision sequence of the keystore being replaced.
+		staging.Rev = s.Rev
+		staging.Provisioning = record
+		return true, staging.save()
+	})
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%w: %v", ErrAlreadyProvisioned, err)
+	}
+	return err
+}
+
+// ProvisionedAt returns when ProvisionOnce set up the keystore, or the zero
+// time if it was not provisioned.
+func (s *Store) ProvisionedAt() (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return time.Time{}, err
+	}
+	if s.Provisioning == nil {
+		return time.Time{}, nil
+	}
+	return time.Unix(s.Provisioning.ProvisionedAt, 0), nil
+}
+
+// checkProvisionable reports why the loaded keystore cannot be provisioned
+// with provToken.
+func (s *Store) checkProvisionable(provToken string) error {
+	if p := s.Provisioning; p != nil {
+		at := time.Unix(p.ProvisionedAt, 0).UTC().Format(time.RFC3339)
+		if p.matches(provToken) {
+			s.config.Logger.Warn("keystore: provisioning token replayed", "location", s.location(), "provisioned_at", at)
+			return fmt.Errorf("%w at %s; the provisioning token was already used", ErrAlreadyProvisioned, at)
+		}
+		return fmt.Errorf("%w at %s", ErrAlreadyProvisioned, at)
+	}
+
+	if s.hasPrimaryKey() || len(s.Accounts) > 0 {
+		return fmt.Errorf("%w: %s holds keys but was never provisioned", ErrKeystoreExists, s.location())
+	}
+
+	stored, err := s.storedToken()
+	if err != nil {
+		return err
+	}
+	if stored != nil && subtle.ConstantTimeCompare([]byte(stored.value), []byte(provToken)) != 1 {
+		return fmt.Errorf("%w: provisioning token does not match the one the keystore shipped with", ErrInvalidToken)
+	}
+	return nil
+}
+
+func newProvisioning(provToken string, now time.Time) (*Provisioning, error) {
+	salt := make([]byte, provisionSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate provisioning salt: %w", err)
+	}
+	return &Provisioning{
+		ProvisionedAt: now.Unix(),
+		TokenDigest:   provisionDigest(salt, provToken),
+		TokenSalt:     hex.EncodeToString(salt),
+	}, nil
+}
+
+// matches reports whether provToken is the token the keystore was
+// provisioned with.
+func (p *Provisioning) matches(provToken string) bool {
+	salt, err := hex.DecodeString(p.TokenSalt)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(provisionDigest(salt, provToken)), []byte(p.TokenDigest)) == 1
+}
+
+func provisionDigest(salt []byte, provToken string) string {
+	h := sha256.New()
+	h.Write(salt)
+	h.Write([]byte(provToken))
+	return TokenDigestPrefix + hex.EncodeToString(h.Sum(nil))
+}
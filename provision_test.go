@@ -0,0 +1,276 @@
+package keystore_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/theblitlabs/keystore"
+	"github.com/theblitlabs/keystore/faultinject"
+)
+
+const factoryToken = "factory-token"
+
+// provisionDirEnv tells TestProvisionCrashHelperProcess which keystore to
+// provision.
+const provisionDirEnv = "KEYSTORE_TEST_PROVISION_DIR"
+
+// newFactoryKeystore writes a keystore holding only factoryToken, as a
+// device ships with, and returns its contents.
+func newFactoryKeystore(t *testing.T, cfg keystore.Config) []byte {
+	t.Helper()
+
+	ks := newErrorStore(t, cfg)
+	if err := ks.SaveToken(factoryToken); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(cfg.DirPath, keystore.DefaultFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// provision is a provisioning function establishing a key and real token.
+func provision(p *keystore.Provisioner) error {
+	if _, err := p.GenerateKey(); err != nil {
+		return err
+	}
+	return p.SaveToken("real-token")
+}
+
+// assertUnprovisioned checks that the keystore in dir still holds exactly
+// factory and that ProvisionOnce succeeds on it.
+func assertUnprovisioned(t *testing.T, dir string, factory []byte) {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join(dir, keystore.DefaultFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, factory) {
+		t.Fatal("a failed provisioning changed the keystore")
+	}
+
+	ks := newErrorStore(t, keystore.Config{DirPath: dir})
+	if at, err := ks.ProvisionedAt(); err != nil || !at.IsZero() {
+		t.Fatalf("ProvisionedAt = %v, %v, want unprovisioned", at, err)
+	}
+	if err := ks.ProvisionOnce(factoryToken, provision); err != nil {
+		t.Fatalf("retrying ProvisionOnce: %v", err)
+	}
+	if token, err := ks.LoadToken(); err != nil || token != "real-token" {
+		t.Fatalf("LoadToken after retrying = %q, %v", token, err)
+	}
+}
+
+func TestProvisionOnce(t *testing.T) {
+	dir := t.TempDir()
+	clock := newTestClock(epoch)
+	cfg := clock.config(keystore.Config{DirPath: dir, Logger: discardLogger})
+	newFactoryKeystore(t, cfg)
+
+	ks := newErrorStore(t, cfg)
+	if err := ks.ProvisionOnce("wrong-token", provision); !errors.Is(err, keystore.ErrInvalidToken) {
+		t.Fatalf("ProvisionOnce with the wrong token: got %v, want ErrInvalidToken", err)
+	}
+	if err := ks.ProvisionOnce("", provision); !errors.Is(err, keystore.ErrEmptyToken) {
+		t.Fatalf("ProvisionOnce with no token: got %v, want ErrEmptyToken", err)
+	}
+
+	clock.Advance(time.Hour)
+	if err := ks.ProvisionOnce(factoryToken, provision); err != nil {
+		t.Fatalf("ProvisionOnce: %v", err)
+	}
+	if at, err := ks.ProvisionedAt(); err != nil || !at.Equal(epoch.Add(time.Hour)) {
+		t.Fatalf("ProvisionedAt = %v, %v, want %v", at, err, epoch.Add(time.Hour))
+	}
+	if token, err := ks.LoadToken(); err != nil || token != "real-token" {
+		t.Fatalf("LoadToken = %q, %v, want the real token", token, err)
+	}
+	if _, err := ks.LoadPrivateKey(); err != nil {
+		t.Fatalf("LoadPrivateKey: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, keystore.DefaultFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), factoryToken) {
+		t.Fatal("the provisioning token was kept")
+	}
+
+	for _, token := range []string{factoryToken, "other-token"} {
+		err := newErrorStore(t, cfg).ProvisionOnce(token, provision)
+		if !errors.Is(err, keystore.ErrAlreadyProvisioned) {
+			t.Fatalf("ProvisionOnce(%q) again: got %v, want ErrAlreadyProvisioned", token, err)
+		}
+		if replay := strings.Contains(err.Error(), "already used"); replay != (token == factoryToken) {
+			t.Fatalf("ProvisionOnce(%q) again: replay reported as %v in %q", token, replay, err)
+		}
+	}
+}
+
+func TestProvisionOnceRefusals(t *testing.T) {
+	t.Run("no keystore", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "new")
+		ks := newErrorStore(t, keystore.Config{DirPath: dir})
+		if err := ks.ProvisionOnce(factoryToken, provision); err != nil {
+			t.Fatalf("ProvisionOnce: %v", err)
+		}
+		if at, err := ks.ProvisionedAt(); err != nil || at.IsZero() {
+			t.Fatalf("ProvisionedAt = %v, %v", at, err)
+		}
+	})
+
+	t.Run("keys but never provisioned", func(t *testing.T) {
+		ks := newErrorStore(t, keystore.Config{})
+		if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+			t.Fatal(err)
+		}
+		if err := ks.ProvisionOnce(factoryToken, provision); !errors.Is(err, keystore.ErrKeystoreExists) {
+			t.Fatalf("ProvisionOnce: got %v, want ErrKeystoreExists", err)
+		}
+		if key, err := ks.LoadPrivateKey(); err != nil || hexKey(key) != fileKeyHex {
+			t.Fatalf("the existing key was replaced: %v", err)
+		}
+	})
+}
+
+func TestProvisionOnceFailureIsRetryable(t *testing.T) {
+	diskFull := errors.New("disk full")
+
+	tests := []struct {
+		name string
+		fn   func(inj *faultinject.Injector) func(*keystore.Provisioner) error
+	}{
+		{"provisioning function fails", func(*faultinject.Injector) func(*keystore.Provisioner) error {
+			return func(p *keystore.Provisioner) error {
+				if err := provision(p); err != nil {
+					return err
+				}
+				return diskFull
+			}
+		}},
+		{"staging save fails", func(inj *faultinject.Injector) func(*keystore.Provisioner) error {
+			return func(p *keystore.Provisioner) error {
+				if err := provision(p); err != nil {
+					return err
+				}
+				inj.Once(keystore.FaultOpSave, keystore.Fault{Err: diskFull})
+				return nil
+			}
+		}},
+		{"keystore write fails", func(inj *faultinject.Injector) func(*keystore.Provisioner) error {
+			return func(p *keystore.Provisioner) error {
+				if err := provision(p); err != nil {
+					return err
+				}
+				// The staging save writes first, then the keystore.
+				inj.Nth(keystore.FaultOpWrite, inj.Calls(keystore.FaultOpWrite)+2, keystore.Fault{Err: diskFull})
+				return nil
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			inj := faultinject.New()
+			factory := newFactoryKeystore(t, keystore.Config{DirPath: dir})
+
+			ks := newErrorStore(t, keystore.Config{DirPath: dir, FaultInjector: inj})
+			if err := ks.ProvisionOnce(factoryToken, tt.fn(inj)); !errors.Is(err, diskFull) {
+				t.Fatalf("ProvisionOnce: got %v, want the injected failure", err)
+			}
+			if token, err := ks.LoadToken(); err != nil || token != factoryToken {
+				t.Fatalf("LoadToken after the failure = %q, %v, want the factory token", token, err)
+			}
+			assertUnprovisioned(t, dir, factory)
+		})
+	}
+}
+
+// TestProvisionCrashHelperProcess is run as a child process by
+// TestProvisionOnceCrash. It dies in the middle of provisioning.
+func TestProvisionCrashHelperProcess(t *testing.T) {
+	dir := os.Getenv(provisionDirEnv)
+	if dir == "" {
+		t.Skip("run by TestProvisionOnceCrash")
+	}
+
+	ks, err := keystore.NewKeystore(keystore.Config{DirPath: dir, Logger: discardLogger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks.ProvisionOnce(factoryToken, func(p *keystore.Provisioner) error {
+		if err := provision(p); err != nil {
+			t.Fatal(err)
+		}
+		os.Exit(3)
+		return nil
+	})
+	t.Fatal("ProvisionOnce returned")
+}
+
+func TestProvisionOnceCrash(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts a child process")
+	}
+	dir := t.TempDir()
+	factory := newFactoryKeystore(t, keystore.Config{DirPath: dir})
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestProvisionCrashHelperProcess$")
+	cmd.Env = append(os.Environ(), provisionDirEnv+"="+dir)
+	out, err := cmd.CombinedOutput()
+	var exit *exec.ExitError
+	if !errors.As(err, &exit) || exit.ExitCode() != 3 {
+		t.Fatalf("child: got %v, want exit status 3\n%s", err, out)
+	}
+
+	// The child died holding the lock; its stale lock is taken over.
+	if _, err := os.Stat(filepath.Join(dir, keystore.DefaultFileName+".lock")); err != nil {
+		t.Fatalf("the crashed child left no lock file: %v", err)
+	}
+	assertUnprovisioned(t, dir, factory)
+}
+
+func TestProvisionOnceSaveSideEffects(t *testing.T) {
+	dir := t.TempDir()
+	mirror := filepath.Join(t.TempDir(), "mirror.json")
+	clock := newTestClock(epoch)
+	cfg := clock.config(keystore.Config{DirPath: dir, MirrorPath: mirror, BackupRetain: 5, Logger: discardLogger})
+	factory := newFactoryKeystore(t, cfg)
+
+	ks := newErrorStore(t, cfg)
+	if names := backupNames(t, ks); len(names) != 0 {
+		t.Fatalf("backups before provisioning = %v", names)
+	}
+	clock.Advance(time.Minute)
+	if err := ks.ProvisionOnce(factoryToken, provision); err != nil {
+		t.Fatal(err)
+	}
+
+	// The replaced factory keystore is backed up and the result mirrored.
+	backups, err := ks.ListBackups()
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("backups after provisioning = %+v, %v, want the factory keystore", backups, err)
+	}
+	if data, err := os.ReadFile(backups[0].Path); err != nil || !bytes.Equal(data, factory) {
+		t.Fatalf("backup does not hold the factory keystore: %v", err)
+	}
+	assertMirrored(t, dir, mirror)
+
+	// The provisioned revision counts as written by this Store, so a
+	// rollback to the factory keystore is noticed.
+	if err := os.WriteFile(filepath.Join(dir, keystore.DefaultFileName), factory, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.LoadToken(); !errors.Is(err, keystore.ErrStaleRead) {
+		t.Fatalf("LoadToken after a rollback: got %v, want ErrStaleRead", err)
+	}
+}
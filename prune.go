@@ -0,0 +1,127 @@
+package keystore
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// PrunePolicy controls what Prune removes.
+type PrunePolicy struct {
+	// TokenGrace keeps expired tokens until they have been expired for this
+	// long. Tokens that have not expired are never removed.
+	TokenGrace time.Duration
+
+	// DryRun reports what would be removed without changing anything.
+	DryRun bool
+}
+
+// PruneEntry describes one item removed, or to be removed, by Prune.
+type PruneEntry struct {
+	Item   string `json:"item"`
+	Reason string `json:"reason"`
+}
+
+// PruneReport lists what Prune removed.
+type PruneReport struct {
+	Removed []PruneEntry `json:"removed"`
+	DryRun  bool         `json:"dry_run"`
+}
+
+// Prune removes data that is no longer useful: tokens past their expiry plus
+// policy.TokenGrace, accounts in the trash for longer than
+// Config.TrashRetention and empty account and label maps. The private key and
+// unexpired tokens are never removed. With policy.DryRun the report lists
+// what would be removed and nothing is written. Config.PrunePolicy applies
+// the same pruning on every save.
+func (s *Store) Prune(policy PrunePolicy) (PruneReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := PruneReport{Removed: []PruneEntry{}, DryRun: policy.DryRun}
+
+	if err := s.load(); err != nil {
+		if isNoKeystore(err) {
+			return report, nil
+		}
+		return report, err
+	}
+
+	report.Removed = s.prune(policy, false)
+	if policy.DryRun || len(report.Removed) == 0 {
+		return report, nil
+	}
+
+	err := s.update(func() error {
+		report.Removed = s.prune(policy, true)
+		return nil
+	})
+	return report, err
+}
+
+// prune returns what policy selects for removal, removing it from memory
+// when apply is set.
+func (s *Store) prune(policy PrunePolicy, apply bool) []PruneEntry {
+	removed := []PruneEntry{}
+
+	if (s.persisted.AuthToken != "" || s.EncryptedToken != nil) && s.tokenExpired() {
+		expiresAt := time.Unix(s.ExpiresAt, 0)
+		if s.now().After(expiresAt.Add(s.skewTolerance() + policy.TokenGrace)) {
+			removed = append(removed, PruneEntry{Item: "auth_token", Reason: fmt.Sprintf("expired at %s", expiresAt.UTC().Format(time.RFC3339))})
+			if apply {
+				s.persisted.AuthToken = ""
+				s.EncryptedToken = nil
+				s.TokenDevice = ""
+				s.persisted.CreatedAt = 0
+				s.ExpiresAt = 0
+			}
+		}
+	}
+
+	urls := make([]string, 0, len(s.URLTokens))
+	for key := range s.URLTokens {
+		urls = append(urls, key)
+	}
+	sort.Strings(urls)
+
+	for _, key := range urls {
+		entry := s.URLTokens[key]
+		if !s.tokenExpiredAt(entry.CreatedAt, entry.ExpiresAt) {
+			continue
+		}
+		expiresAt := time.Unix(entry.ExpiresAt, 0)
+		if s.now().After(expiresAt.Add(s.skewTolerance() + policy.TokenGrace)) {
+			removed = append(removed, PruneEntry{Item: "url_token:" + key, Reason: fmt.Sprintf("expired at %s", expiresAt.UTC().Format(time.RFC3339))})
+			if apply {
+				delete(s.URLTokens, key)
+			}
+		}
+	}
+
+	removed = append(removed, s.pruneTrash(apply)...)
+
+	if s.Accounts != nil && len(s.Accounts) == 0 {
+		removed = append(removed, PruneEntry{Item: "accounts", Reason: "empty"})
+		if apply {
+			s.Accounts = nil
+		}
+	}
+
+	names := make([]string, 0, len(s.Accounts))
+	for name := range s.Accounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		account := s.Accounts[name]
+		if account.Labels != nil && len(account.Labels) == 0 {
+			removed = append(removed, PruneEntry{Item: "account:" + name + ":labels", Reason: "empty"})
+			if apply {
+				account.Labels = nil
+			}
+		}
+	}
+
+	return removed
+}
@@ -0,0 +1,160 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// PublicCacheFormat identifies a public side-cache file
+	PublicCacheFormat = "keystore-pub"
+
+	publicCacheSuffix = ".pub.json"
+)
+
+// PublicData is the non-secret data derived from a keystore, as served from
+// the public side-cache by PublicData.
+type PublicData struct {
+	Address        string        `json:"address,omitempty"`
+	PublicKey      string        `json:"public_key,omitempty"`
+	KeyFingerprint string        `json:"key_fingerprint,omitempty"`
+	KeyCurve       string        `json:"key_curve,omitempty"`
+	KeyEncrypted   bool          `json:"key_encrypted"`
+	Accounts       []AccountInfo `json:"accounts"`
+	HasToken       bool          `json:"has_token"`
+	TokenExpiresAt *time.Time    `json:"token_expires_at,omitempty"`
+}
+
+// publicCache is the side-cache file. Source is the hash of the keystore
+// file it was derived from.
+type publicCache struct {
+	Format string     `json:"format"`
+	Source string     `json:"source"`
+	Data   PublicData `json:"data"`
+}
+
+// PublicData returns the keystore's addresses, fingerprints, labels and
+// token expiry without unlocking it. With Config.PublicCache they are read
+// from the side-cache next to the keystore file as long as it was derived
+// from the current file; otherwise the keystore is loaded, which may need
+// the passphrase, and the cache rewritten.
+func (s *Store) PublicData() (PublicData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if path, ok := s.publicCachePath(); ok {
+		if raw, err := s.readBackend(); err == nil {
+			cache, err := readPublicCache(path)
+			if err == nil && cache.Source == sourceHash(raw) {
+				return cache.Data, nil
+			}
+		}
+	}
+
+	if err := s.load(); err != nil {
+		return PublicData{}, err
+	}
+	return s.publicData(), nil
+}
+
+// publicCachePath returns where the side-cache lives, or false when it is
+// disabled.
+func (s *Store) publicCachePath() (string, bool) {
+	if !s.config.PublicCache {
+		return "", false
+	}
+	b, ok := s.backend.(*FileBackend)
+	if !ok {
+		return "", false
+	}
+	return strings.TrimSuffix(b.path, filepath.Ext(b.path)) + publicCacheSuffix, true
+}
+
+// publicData derives PublicData from the in-memory state. Usage counts are
+// left out since they change on every use.
+func (s *Store) publicData() PublicData {
+	data := PublicData{
+		Address:      s.Address,
+		PublicKey:    s.PublicKey,
+		KeyCurve:     s.KeyCurve,
+		KeyEncrypted: s.EncryptedKey != nil || s.KeyShares != nil,
+		Accounts:     s.accountInfos(),
+		HasToken:     s.persisted.AuthToken != "" || s.EncryptedToken != nil,
+	}
+
+	if pub, err := hex.DecodeString(s.PublicKey); err == nil && len(pub) > 0 {
+		data.KeyFingerprint = keyFingerprint(pub)
+	}
+	for i := range data.Accounts {
+		data.Accounts[i].UseCount = 0
+		data.Accounts[i].LastUsedAt = nil
+	}
+	if data.HasToken && s.ExpiresAt != 0 {
+		expiresAt := time.Unix(s.ExpiresAt, 0).UTC()
+		data.TokenExpiresAt = &expiresAt
+	}
+
+	return data
+}
+
+// syncPublicCache brings the side-cache in line with raw, the keystore
+// file just loaded or saved. A cache derived from raw whose contents differ
+// from the decrypted data was tampered with or corrupted and is rewritten
+// with a warning.
+func (s *Store) syncPublicCache(raw []byte) {
+	path, ok := s.publicCachePath()
+	if !ok {
+		return
+	}
+
+	want := publicCache{Format: PublicCacheFormat, Source: sourceHash(raw), Data: s.publicData()}
+	encoded, err := json.MarshalIndent(want, "", "  ")
+	if err != nil {
+		s.config.Logger.Warn("keystore: failed to encode public cache", "error", err)
+		return
+	}
+
+	current, err := readPublicCache(path)
+	switch {
+	case err == nil && current.Source == want.Source:
+		if got, _ := json.MarshalIndent(current, "", "  "); bytes.Equal(got, encoded) {
+			return
+		}
+		s.config.Logger.Warn("keystore: public cache does not match keystore, rewriting", "path", path)
+	case err != nil && !errors.Is(err, os.ErrNotExist):
+		s.config.Logger.Warn("keystore: ignoring unreadable public cache", "path", path, "error", err)
+	}
+
+	if err := writeFileAtomic(path, encoded, DefaultFileMode); err != nil {
+		s.config.Logger.Warn("keystore: failed to write public cache", "path", path, "error", err)
+	}
+}
+
+func readPublicCache(path string) (*publicCache, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cache publicCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil, fmt.Errorf("invalid public cache: %w", err)
+	}
+	if cache.Format != PublicCacheFormat {
+		return nil, fmt.Errorf("invalid public cache format %q", cache.Format)
+	}
+	return &cache, nil
+}
+
+func sourceHash(raw []byte) string {
+	sum := sha256.Sum256(raw)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,260 @@
+package keystore_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/theblitlabs/keystore"
+)
+
+// newPublicCacheStore writes an encrypted keystore with an account and a
+// token to dir and returns its public cache path.
+func newPublicCacheStore(t *testing.T, dir string) string {
+	t.Helper()
+
+	ks, err := keystore.NewKeystore(keystore.Config{
+		DirPath:     dir,
+		Passphrase:  keystore.StaticPassphrase("right"),
+		PublicCache: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveAccount("hot", credentialKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveToken("pubcache-token"); err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "keystore.pub.json")
+}
+
+func TestPublicCacheWithoutPassphrase(t *testing.T) {
+	dir := t.TempDir()
+	path := newPublicCacheStore(t, dir)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("public cache not written: %v", err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o600 {
+		t.Fatalf("public cache mode = %o, want 600", mode)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{fileKeyHex, credentialKeyHex, "pubcache-token", "right"} {
+		if bytes.Contains(raw, []byte(secret)) {
+			t.Fatalf("public cache contains a secret: %s", raw)
+		}
+	}
+
+	var prompts atomic.Int32
+	ks, err := keystore.NewKeystore(keystore.Config{
+		DirPath:     dir,
+		Passphrase:  countingPassphrase("right", 0, &prompts),
+		PublicCache: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ks.PublicData()
+	if err != nil {
+		t.Fatalf("PublicData: %v", err)
+	}
+	if n := prompts.Load(); n != 0 {
+		t.Fatalf("PublicData prompted %d times", n)
+	}
+
+	key, err := ks.LoadPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.ToLower(crypto.PubkeyToAddress(key.PublicKey).Hex()); strings.ToLower(data.Address) != want {
+		t.Errorf("address = %s, want %s", data.Address, want)
+	}
+	if !data.KeyEncrypted || data.KeyFingerprint == "" {
+		t.Errorf("key data = %+v", data)
+	}
+	if len(data.Accounts) != 1 || data.Accounts[0].Name != "hot" {
+		t.Errorf("accounts = %+v", data.Accounts)
+	}
+	if !data.HasToken || data.TokenExpiresAt == nil {
+		t.Errorf("token data = %+v", data)
+	}
+}
+
+func TestPublicCacheRegenerated(t *testing.T) {
+	tests := []struct {
+		name   string
+		damage func(t *testing.T, dir, path string)
+	}{
+		{
+			name: "missing",
+			damage: func(t *testing.T, dir, path string) {
+				if err := os.Remove(path); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "unreadable",
+			damage: func(t *testing.T, dir, path string) {
+				if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "stale",
+			damage: func(t *testing.T, dir, path string) {
+				other, err := keystore.NewKeystore(keystore.Config{DirPath: dir, Passphrase: keystore.StaticPassphrase("right")})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := other.DeleteAccount("hot"); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := newPublicCacheStore(t, dir)
+			tt.damage(t, dir, path)
+
+			ks, err := keystore.NewKeystore(keystore.Config{DirPath: dir, PublicCache: true, Logger: discardLogger})
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := ks.PublicData()
+			if err != nil {
+				t.Fatalf("PublicData: %v", err)
+			}
+
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("public cache not regenerated: %v", err)
+			}
+			var cache struct {
+				Data keystore.PublicData `json:"data"`
+			}
+			if err := json.Unmarshal(raw, &cache); err != nil {
+				t.Fatalf("regenerated cache: %v", err)
+			}
+			if cache.Data.Address != data.Address || len(cache.Data.Accounts) != len(data.Accounts) {
+				t.Fatalf("cache %+v, PublicData %+v", cache.Data, data)
+			}
+			if tt.name == "stale" && len(data.Accounts) != 0 {
+				t.Fatalf("stale cache served: %+v", data.Accounts)
+			}
+		})
+	}
+}
+
+func TestPublicCacheTamperedIsRewritten(t *testing.T) {
+	dir := t.TempDir()
+	path := newPublicCacheStore(t, dir)
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cache map[string]any
+	if err := json.Unmarshal(raw, &cache); err != nil {
+		t.Fatal(err)
+	}
+	cache["data"].(map[string]any)["address"] = "0x000000000000000000000000000000000000dEaD"
+	tampered, err := json.Marshal(cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, tampered, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var logs bytes.Buffer
+	ks, err := keystore.NewKeystore(keystore.Config{
+		DirPath:     dir,
+		PublicCache: true,
+		Logger:      slog.New(slog.NewTextHandler(&logs, nil)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The cache is untrusted: PublicData serves it, but the next load
+	// notices the mismatch.
+	if data, err := ks.PublicData(); err != nil || !strings.EqualFold(data.Address, "0x000000000000000000000000000000000000dEaD") {
+		t.Fatalf("PublicData = %+v, %v", data, err)
+	}
+	if _, err := ks.LoadToken(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs.String(), "public cache does not match") {
+		t.Fatalf("no warning logged: %s", logs.String())
+	}
+
+	data, err := ks.PublicData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.EqualFold(data.Address, "0x000000000000000000000000000000000000dEaD") {
+		t.Fatal("tampered cache not rewritten")
+	}
+}
+
+func TestPublicCacheExpiry(t *testing.T) {
+	clock := newTestClock(epoch)
+	dir := t.TempDir()
+	ks, err := keystore.NewKeystore(clock.config(keystore.Config{DirPath: dir, PublicCache: true, TokenTTL: time.Hour}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveToken("pubcache-token"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ks.PublicData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.TokenExpiresAt == nil || !data.TokenExpiresAt.Equal(epoch.Add(time.Hour)) {
+		t.Fatalf("token expiry = %v, want %v", data.TokenExpiresAt, epoch.Add(time.Hour))
+	}
+	if data.Address != "" || data.KeyEncrypted {
+		t.Fatalf("key data without a key = %+v", data)
+	}
+}
+
+func TestPublicCacheDisabled(t *testing.T) {
+	dir := t.TempDir()
+	ks, err := keystore.NewKeystore(keystore.Config{DirPath: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "keystore.pub.json")); !os.IsNotExist(err) {
+		t.Fatalf("public cache written without Config.PublicCache: %v", err)
+	}
+	if data, err := ks.PublicData(); err != nil || data.Address == "" {
+		t.Fatalf("PublicData = %+v, %v", data, err)
+	}
+}
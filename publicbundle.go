@@ -0,0 +1,276 @@
+package keystore
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+)
+
+// PublicBundleFormat identifies public bundles
+const PublicBundleFormat = "keystore-public-bundle"
+
+const publicBundleVersion = 1
+
+// publicBundleDomain separates bundle self-signatures from signatures over
+// arbitrary digests made with the same key.
+const publicBundleDomain = PublicBundleFormat + "\x00"
+
+// privateFieldWords mark the JSON field names ParsePublicBundle refuses,
+// in addition to manifestSecretFields.
+var privateFieldWords = []string{"private", "secret", "mnemonic", "seed", "passphrase", "password"}
+
+// privateKeyValue matches a string that could be a raw secp256k1 private
+// key.
+var privateKeyValue = regexp.MustCompile(`^(0x)?[0-9a-fA-F]{64}$`)
+
+// PublicBundle is the public side of a keystore, signed by its primary key,
+// for verifiers that check signatures made by the keystore but must hold
+// no private material. It is produced by Store.PublicBundle, serialized
+// with Marshal and read back with ParsePublicBundle.
+type PublicBundle struct {
+	Format         string                `json:"format"`
+	Version        int                   `json:"version"`
+	CreatedAt      int64                 `json:"created_at"`
+	Address        string                `json:"address"`
+	PublicKey      string                `json:"public_key"`
+	KeyFingerprint string                `json:"key_fingerprint"`
+	Accounts       []PublicBundleAccount `json:"accounts,omitempty"`
+
+	// Signature is the 65-byte secp256k1 signature of the primary key over
+	// the Keccak-256 digest of the canonical bundle without it.
+	Signature string `json:"signature,omitempty"`
+}
+
+// PublicBundleAccount is a named or watch-only account in a PublicBundle.
+type PublicBundleAccount struct {
+	Name      string            `json:"name"`
+	Address   string            `json:"address"`
+	WatchOnly bool              `json:"watch_only,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// PublicBundle returns the addresses, public key, fingerprint, accounts
+// and labels of the keystore, signed by the primary key. The key is needed
+// to sign, so an encrypted keystore must be unlocked.
+func (s *Store) PublicBundle(opts ...ExportOption) (bundle PublicBundle, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer func() { s.audit(AuditExport, "", err) }()
+
+	if err := s.redeemExport("PublicBundle", ExportScopePublic, opts); err != nil {
+		return PublicBundle{}, err
+	}
+
+	key, _, err := s.primaryKey()
+	if err != nil {
+		return PublicBundle{}, err
+	}
+
+	pub := ethcrypto.FromECDSAPub(&key.PublicKey)
+	bundle = PublicBundle{
+		Format:         PublicBundleFormat,
+		Version:        publicBundleVersion,
+		CreatedAt:      s.now().Unix(),
+		Address:        ethcrypto.PubkeyToAddress(key.PublicKey).Hex(),
+		PublicKey:      hex.EncodeToString(pub),
+		KeyFingerprint: keyFingerprint(pub),
+	}
+	for _, info := range s.accountInfos() {
+		bundle.Accounts = append(bundle.Accounts, PublicBundleAccount{
+			Name:      info.Name,
+			Address:   info.Address.Hex(),
+			WatchOnly: info.WatchOnly,
+			Labels:    info.Labels,
+		})
+	}
+
+	// Refuse to produce a bundle that ParsePublicBundle would reject, such
+	// as one with a label value shaped like a private key.
+	data, err := bundle.Marshal()
+	if err != nil {
+		return PublicBundle{}, fmt.Errorf("failed to encode public bundle: %w", err)
+	}
+	doc, err := decodeDocument(data)
+	if err != nil {
+		return PublicBundle{}, err
+	}
+	if err := checkPublicOnly(doc, ""); err != nil {
+		return PublicBundle{}, err
+	}
+
+	digest, err := bundle.digest()
+	if err != nil {
+		return PublicBundle{}, err
+	}
+	sig, err := ethcrypto.Sign(digest, key)
+	if err != nil {
+		return PublicBundle{}, fmt.Errorf("failed to sign public bundle: %w", err)
+	}
+	bundle.Signature = hex.EncodeToString(sig)
+	return bundle, nil
+}
+
+// Marshal encodes the bundle as compact JSON.
+func (b PublicBundle) Marshal() ([]byte, error) {
+	return json.Marshal(b)
+}
+
+// ParsePublicBundle decodes a bundle encoded with Marshal and checks its
+// self-signature. It fails with ErrPrivateMaterial if the data has any
+// field that looks like it holds a secret, and with ErrInvalidBundle if it
+// is malformed or its signature does not match.
+func ParsePublicBundle(data []byte) (PublicBundle, error) {
+	doc, err := decodeDocument(data)
+	if err != nil {
+		return PublicBundle{}, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+	if err := checkPublicOnly(doc, ""); err != nil {
+		return PublicBundle{}, err
+	}
+
+	var b PublicBundle
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&b); err != nil {
+		return PublicBundle{}, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+	if err := b.verify(); err != nil {
+		return PublicBundle{}, err
+	}
+	return b, nil
+}
+
+// VerifyWithBundle reports whether sig, a signature over the Keccak-256
+// digest of msg as RecoverAddressFromHash accepts, was made by the primary
+// key or one of the accounts of bundle. The bundle's self-signature is checked first, so
+// an edited bundle, or one whose accounts were swapped in from another,
+// fails with ErrInvalidBundle. A bundle signed by another key entirely is
+// self-consistent too, so verifiers should pin bundle.Address or
+// KeyFingerprint to a value obtained out of band. It needs no Store, so
+// verifiers can be built without any keystore on disk.
+func VerifyWithBundle(bundle PublicBundle, msg, sig []byte) (bool, error) {
+	if err := bundle.verify(); err != nil {
+		return false, err
+	}
+	signer, err := RecoverAddressFromHash(ethcrypto.Keccak256(msg), sig)
+	if err != nil {
+		return false, err
+	}
+
+	if signer == common.HexToAddress(bundle.Address) {
+		return true, nil
+	}
+	for _, a := range bundle.Accounts {
+		if signer == common.HexToAddress(a.Address) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// verify checks the format, that the public key matches the address and
+// fingerprint, and the self-signature.
+func (b PublicBundle) verify() error {
+	if b.Format != PublicBundleFormat {
+		return fmt.Errorf("%w: format %q", ErrInvalidBundle, b.Format)
+	}
+	if b.Version > publicBundleVersion {
+		return fmt.Errorf("%w: bundle version %d, supported %d", ErrUnsupportedVersion, b.Version, publicBundleVersion)
+	}
+
+	pubBytes, err := hex.DecodeString(b.PublicKey)
+	if err != nil {
+		return fmt.Errorf("%w: malformed public key", ErrInvalidBundle)
+	}
+	pub, err := ethcrypto.UnmarshalPubkey(pubBytes)
+	if err != nil {
+		return fmt.Errorf("%w: malformed public key", ErrInvalidBundle)
+	}
+	if ethcrypto.PubkeyToAddress(*pub).Hex() != b.Address {
+		return fmt.Errorf("%w: public key does not match address %s", ErrInvalidBundle, b.Address)
+	}
+	if keyFingerprint(pubBytes) != b.KeyFingerprint {
+		return fmt.Errorf("%w: fingerprint does not match public key", ErrInvalidBundle)
+	}
+
+	sig, err := hex.DecodeString(b.Signature)
+	if err != nil || len(sig) != ethcrypto.SignatureLength {
+		return fmt.Errorf("%w: malformed signature", ErrInvalidBundle)
+	}
+	digest, err := b.digest()
+	if err != nil {
+		return err
+	}
+	if !ethcrypto.VerifySignature(pubBytes, digest, sig[:64]) {
+		return fmt.Errorf("%w: signature does not match content", ErrInvalidBundle)
+	}
+	return nil
+}
+
+// digest hashes the canonical form of the bundle without its signature.
+func (b PublicBundle) digest() ([]byte, error) {
+	b.Signature = ""
+	data, err := json.Marshal(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode public bundle: %w", err)
+	}
+	doc, err := decodeDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	canonical, err := canonicalJSON(doc)
+	if err != nil {
+		return nil, err
+	}
+	return ethcrypto.Keccak256([]byte(publicBundleDomain), canonical), nil
+}
+
+// checkPublicOnly fails if v, a decoded JSON value at path, has a field
+// named like a secret or a string shaped like a raw private key. Label
+// values are free text and only checked for key-shaped strings.
+func checkPublicOnly(v any, path string) error {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			field := strings.TrimPrefix(path+"."+k, ".")
+			if !strings.HasSuffix(path, ".labels") && privateFieldName(k) {
+				return fmt.Errorf("%w: field %s", ErrPrivateMaterial, field)
+			}
+			if err := checkPublicOnly(e, field); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for i, e := range v {
+			if err := checkPublicOnly(e, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case string:
+		if privateKeyValue.MatchString(v) {
+			return fmt.Errorf("%w: %s holds a value shaped like a private key", ErrPrivateMaterial, path)
+		}
+	}
+	return nil
+}
+
+func privateFieldName(name string) bool {
+	lower := strings.ToLower(name)
+	for _, f := range manifestSecretFields {
+		if lower == f {
+			return true
+		}
+	}
+	for _, w := range privateFieldWords {
+		if strings.Contains(lower, w) {
+			return true
+		}
+	}
+	return false
+}
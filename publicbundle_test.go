@@ -0,0 +1,248 @@
+package keystore_test
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/theblitlabs/keystore"
+)
+
+// newBundleStore returns a Store with fileKeyHex as its primary key, a
+// labelled account and a watch-only address.
+func newBundleStore(t *testing.T) *keystore.Store {
+	t.Helper()
+
+	ks := newErrorStore(t, keystore.Config{})
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveAccount("ops", credentialKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SetAccountLabel("ops", "role", "deploy"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveWatchAddress("cold", common.HexToAddress("0x00000000000000000000000000000000000000c0")); err != nil {
+		t.Fatal(err)
+	}
+	return ks
+}
+
+// editBundle returns data with edit applied to its decoded JSON.
+func editBundle(t *testing.T, data []byte, edit func(doc map[string]any)) []byte {
+	t.Helper()
+
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	edit(doc)
+	out, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func bundleAccount(doc map[string]any, i int) map[string]any {
+	return doc["accounts"].([]any)[i].(map[string]any)
+}
+
+func TestPublicBundleRoundTrip(t *testing.T) {
+	ks := newBundleStore(t)
+	bundle, err := ks.PublicBundle()
+	if err != nil {
+		t.Fatalf("PublicBundle: %v", err)
+	}
+	data, err := bundle.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), fileKeyHex) || strings.Contains(string(data), credentialKeyHex) {
+		t.Fatal("bundle contains a private key")
+	}
+
+	parsed, err := keystore.ParsePublicBundle(data)
+	if err != nil {
+		t.Fatalf("ParsePublicBundle: %v", err)
+	}
+	if want := crypto.PubkeyToAddress(mustKey(t, fileKeyHex).PublicKey).Hex(); parsed.Address != want {
+		t.Fatalf("Address = %s, want %s", parsed.Address, want)
+	}
+	if len(parsed.Accounts) != 2 {
+		t.Fatalf("Accounts = %+v, want ops and cold", parsed.Accounts)
+	}
+	for _, a := range parsed.Accounts {
+		switch a.Name {
+		case "ops":
+			if a.WatchOnly || a.Labels["role"] != "deploy" {
+				t.Errorf("ops = %+v", a)
+			}
+		case "cold":
+			if !a.WatchOnly {
+				t.Errorf("cold = %+v, want watch-only", a)
+			}
+		default:
+			t.Errorf("unexpected account %+v", a)
+		}
+	}
+
+	msg := []byte("verify me")
+	primarySig, err := ks.SignDigest(crypto.Keccak256(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	accountSig, err := ks.SignWithAccount("ops", crypto.Keccak256(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	strangerSig, err := crypto.Sign(crypto.Keccak256(msg), mustKey(t, envKeyHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		msg  []byte
+		sig  []byte
+		want bool
+	}{
+		{"primary key", msg, primarySig, true},
+		{"account", msg, accountSig, true},
+		{"other key", msg, strangerSig, false},
+		{"other message", []byte("something else"), primarySig, false},
+	}
+	for _, tt := range tests {
+		ok, err := keystore.VerifyWithBundle(parsed, tt.msg, tt.sig)
+		if err != nil || ok != tt.want {
+			t.Errorf("%s: VerifyWithBundle = %v, %v, want %v", tt.name, ok, err, tt.want)
+		}
+	}
+	if _, err := keystore.VerifyWithBundle(parsed, msg, primarySig[:64]); !errors.Is(err, keystore.ErrInvalidSignature) {
+		t.Errorf("64-byte signature: got %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestPublicBundleTampering(t *testing.T) {
+	bundle, err := newBundleStore(t).PublicBundle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := bundle.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A bundle of another keystore, to swap parts in from.
+	other := newErrorStore(t, keystore.Config{})
+	if err := other.SavePrivateKey(envKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	otherBundle, err := other.PublicBundle()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validSig, err := crypto.Sign(crypto.Keccak256([]byte("msg")), mustKey(t, fileKeyHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		edit func(doc map[string]any)
+		want error
+	}{
+		{"address", func(doc map[string]any) { doc["address"] = otherBundle.Address }, keystore.ErrInvalidBundle},
+		{"public key and address", func(doc map[string]any) {
+			doc["address"], doc["public_key"] = otherBundle.Address, otherBundle.PublicKey
+		}, keystore.ErrInvalidBundle},
+		{"whole identity", func(doc map[string]any) {
+			doc["address"], doc["public_key"], doc["key_fingerprint"] = otherBundle.Address, otherBundle.PublicKey, otherBundle.KeyFingerprint
+		}, keystore.ErrInvalidBundle},
+		{"fingerprint", func(doc map[string]any) { doc["key_fingerprint"] = otherBundle.KeyFingerprint }, keystore.ErrInvalidBundle},
+		{"created at", func(doc map[string]any) { doc["created_at"] = doc["created_at"].(float64) + 1 }, keystore.ErrInvalidBundle},
+		{"account address", func(doc map[string]any) { bundleAccount(doc, 0)["address"] = otherBundle.Address }, keystore.ErrInvalidBundle},
+		{"account added", func(doc map[string]any) {
+			doc["accounts"] = append(doc["accounts"].([]any), map[string]any{"name": "extra", "address": otherBundle.Address})
+		}, keystore.ErrInvalidBundle},
+		{"account removed", func(doc map[string]any) { doc["accounts"] = doc["accounts"].([]any)[:1] }, keystore.ErrInvalidBundle},
+		{"label", func(doc map[string]any) {
+			for _, a := range doc["accounts"].([]any) {
+				if labels, ok := a.(map[string]any)["labels"].(map[string]any); ok {
+					labels["role"] = "admin"
+				}
+			}
+		}, keystore.ErrInvalidBundle},
+		{"signature", func(doc map[string]any) {
+			sig := []byte(doc["signature"].(string))
+			if sig[0] == '0' {
+				sig[0] = '1'
+			} else {
+				sig[0] = '0'
+			}
+			doc["signature"] = string(sig)
+		}, keystore.ErrInvalidBundle},
+		{"signature swapped in", func(doc map[string]any) { doc["signature"] = otherBundle.Signature }, keystore.ErrInvalidBundle},
+		{"signature removed", func(doc map[string]any) { delete(doc, "signature") }, keystore.ErrInvalidBundle},
+		{"format", func(doc map[string]any) { doc["format"] = "something-else" }, keystore.ErrInvalidBundle},
+		{"newer version", func(doc map[string]any) { doc["version"] = 2 }, keystore.ErrUnsupportedVersion},
+		{"unknown field", func(doc map[string]any) { doc["comment"] = "hello" }, keystore.ErrInvalidBundle},
+
+		{"private key field", func(doc map[string]any) { doc["private_key"] = "redacted" }, keystore.ErrPrivateMaterial},
+		{"account secret field", func(doc map[string]any) { bundleAccount(doc, 0)["client_secret"] = "x" }, keystore.ErrPrivateMaterial},
+		{"mnemonic field", func(doc map[string]any) { doc["Mnemonic"] = "abandon abandon" }, keystore.ErrPrivateMaterial},
+		{"key-shaped value", func(doc map[string]any) { doc["public_key"] = "0x" + fileKeyHex }, keystore.ErrPrivateMaterial},
+		{"key-shaped label", func(doc map[string]any) {
+			bundleAccount(doc, 0)["labels"] = map[string]any{"note": fileKeyHex}
+		}, keystore.ErrPrivateMaterial},
+	}
+	// Decoding into a PublicBundle drops these edits, so only
+	// ParsePublicBundle can see them.
+	parseOnly := map[string]bool{
+		"unknown field":        true,
+		"private key field":    true,
+		"account secret field": true,
+		"mnemonic field":       true,
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edited := editBundle(t, data, tt.edit)
+			_, err := keystore.ParsePublicBundle(edited)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("ParsePublicBundle: got %v, want %v", err, tt.want)
+			}
+
+			// VerifyWithBundle refuses a tampered bundle decoded without
+			// ParsePublicBundle too, even for a genuine signature.
+			var b keystore.PublicBundle
+			if parseOnly[tt.name] || json.Unmarshal(edited, &b) != nil {
+				return
+			}
+			if ok, err := keystore.VerifyWithBundle(b, []byte("msg"), validSig); ok || err == nil {
+				t.Fatalf("VerifyWithBundle: got %v, %v, want an error", ok, err)
+			}
+		})
+	}
+
+	for _, bad := range []string{"", "{", "[]", `"bundle"`} {
+		if _, err := keystore.ParsePublicBundle([]byte(bad)); !errors.Is(err, keystore.ErrInvalidBundle) {
+			t.Errorf("ParsePublicBundle(%q): got %v, want ErrInvalidBundle", bad, err)
+		}
+	}
+}
+
+func TestPublicBundleRefusesKeyShapedLabels(t *testing.T) {
+	ks := newBundleStore(t)
+	if err := ks.SetAccountLabel("ops", "note", credentialKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.PublicBundle(); !errors.Is(err, keystore.ErrPrivateMaterial) {
+		t.Fatalf("PublicBundle: got %v, want ErrPrivateMaterial", err)
+	}
+}
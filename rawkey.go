@@ -0,0 +1,67 @@
+package keystore
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// privateKeySize is the length of a raw secp256k1 private key
+const privateKeySize = 32
+
+// KeyBytes holds a raw private key returned by PrivateKeyBytes.
+type KeyBytes []byte
+
+// Wipe zeroes the key in place. Copies made of it are not wiped.
+func (b KeyBytes) Wipe() {
+	wipe(b)
+}
+
+// SavePrivateKeyBytes saves a raw 32-byte big-endian secp256k1 private key
+// as the primary key, with the same checks as SavePrivateKey. A 33-byte key
+// with a leading zero byte, as some serializers emit, is accepted without
+// it. The caller's slice is not modified.
+func (s *Store) SavePrivateKeyBytes(b []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(b) == privateKeySize+1 && b[0] == 0 {
+		b = b[1:]
+	}
+	if len(b) != privateKeySize {
+		return fmt.Errorf("%w: expected %d bytes, got %d", ErrInvalidPrivateKey, privateKeySize, len(b))
+	}
+
+	privateKeyHex := hex.EncodeToString(b)
+	key, err := s.checkPrivateKey(privateKeyHex)
+	if err != nil {
+		return err
+	}
+
+	return s.updateScope(scopeKey, func() error {
+		return s.setPrimaryKey(privateKeyHex, key, s.newProvenance(ProvenanceImported, ""))
+	})
+}
+
+// PrivateKeyBytes returns the primary key as 32 raw big-endian bytes. Call
+// Wipe on the result once done with it.
+func (s *Store) PrivateKeyBytes() (key KeyBytes, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer func() { s.audit(AuditKeyAccess, "", err) }()
+
+	if err := s.authorized(AuthPrivateKeyBytes); err != nil {
+		return nil, err
+	}
+
+	_, privateKeyHex, err := s.primaryKey()
+	if err != nil {
+		return nil, err
+	}
+
+	key, err = hex.DecodeString(privateKeyHex)
+	if err != nil || len(key) != privateKeySize {
+		wipe(key)
+		return nil, s.invalidStoredKey("private_key", fmt.Errorf("not %d hex-encoded bytes", privateKeySize))
+	}
+	return key, nil
+}
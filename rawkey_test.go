@@ -0,0 +1,91 @@
+package keystore_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/theblitlabs/keystore"
+)
+
+func TestSavePrivateKeyBytes(t *testing.T) {
+	raw, err := hex.DecodeString(fileKeyHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leadingZero := crypto.FromECDSA(mustKey(t, "00"+fileKeyHex[2:]))
+	order := secp256k1Order.FillBytes(make([]byte, 32))
+
+	tests := []struct {
+		name    string
+		input   []byte
+		want    []byte
+		wantErr error
+	}{
+		{name: "32 bytes", input: raw, want: raw},
+		{name: "32 bytes with a leading zero", input: leadingZero, want: leadingZero},
+		{name: "33 bytes with a leading zero", input: append([]byte{0}, raw...), want: raw},
+		{name: "33 bytes with a leading one", input: append([]byte{1}, raw...), wantErr: keystore.ErrInvalidPrivateKey},
+		{name: "31 bytes", input: raw[:31], wantErr: keystore.ErrInvalidPrivateKey},
+		{name: "31 bytes with a leading zero", input: append([]byte{0}, raw[:30]...), wantErr: keystore.ErrInvalidPrivateKey},
+		{name: "64 bytes", input: append(append([]byte{}, raw...), raw...), wantErr: keystore.ErrInvalidPrivateKey},
+		{name: "empty", wantErr: keystore.ErrInvalidPrivateKey},
+		{name: "zero", input: make([]byte, 32), wantErr: keystore.ErrInvalidPrivateKey},
+		{name: "group order", input: order, wantErr: keystore.ErrInvalidPrivateKey},
+		{name: "above group order", input: new(big.Int).Add(secp256k1Order, big.NewInt(1)).FillBytes(make([]byte, 32)), wantErr: keystore.ErrInvalidPrivateKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ks, err := keystore.NewKeystore(keystore.Config{DirPath: t.TempDir()})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			input := append([]byte(nil), tt.input...)
+			err = ks.SavePrivateKeyBytes(input)
+			if !bytes.Equal(input, tt.input) {
+				t.Fatal("SavePrivateKeyBytes modified its input")
+			}
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("SavePrivateKeyBytes: got %v, want %v", err, tt.wantErr)
+				}
+				if _, err := ks.LoadPrivateKey(); !errors.Is(err, keystore.ErrNoKeystore) {
+					t.Fatalf("rejected key was stored: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SavePrivateKeyBytes: %v", err)
+			}
+
+			// The key reads back the same through both paths.
+			key, err := ks.PrivateKeyBytes()
+			if err != nil {
+				t.Fatalf("PrivateKeyBytes: %v", err)
+			}
+			if !bytes.Equal(key, tt.want) {
+				t.Fatalf("PrivateKeyBytes = %x, want %x", []byte(key), tt.want)
+			}
+			loaded, err := ks.LoadPrivateKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(crypto.FromECDSA(loaded), tt.want) {
+				t.Fatal("LoadPrivateKey returned a different key")
+			}
+
+			key.Wipe()
+			if !bytes.Equal(key, make([]byte, 32)) {
+				t.Fatalf("Wipe left %x", []byte(key))
+			}
+			if again, _ := ks.PrivateKeyBytes(); !bytes.Equal(again, tt.want) {
+				t.Fatal("Wipe changed the stored key")
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package keystore
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"syscall"
+	"time"
+)
+
+// ReadOnlyRetryInterval is how long a Store keeps failing saves with the
+// last ReadOnlyError before touching storage again
+const ReadOnlyRetryInterval = 5 * time.Second
+
+// ReadOnlyError reports that keystore storage cannot be written, either
+// because the filesystem is mounted read-only (EROFS) or because access is
+// denied (EACCES). It matches ErrStorageReadOnly and the underlying errno
+// with errors.Is.
+type ReadOnlyError struct {
+	Path       string
+	Errno      syscall.Errno
+	RetryAfter time.Time
+}
+
+func (e *ReadOnlyError) Error() string {
+	return fmt.Sprintf("%v: %s: %v", ErrStorageReadOnly, e.Path, e.Errno)
+}
+
+func (e *ReadOnlyError) Unwrap() []error {
+	return []error{ErrStorageReadOnly, e.Errno}
+}
+
+// readOnlyError converts err into a ReadOnlyError if it is an EROFS or
+// EACCES failure, using path when err does not name one.
+func readOnlyError(err error, path string) (*ReadOnlyError, bool) {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) || (errno != syscall.EROFS && errno != syscall.EACCES) {
+		return nil, false
+	}
+
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		path = pathErr.Path
+	}
+	return &ReadOnlyError{Path: path, Errno: errno}, true
+}
+
+// chooseDir creates dir, or the first of fallbacks that can be written
+// when dir is on read-only storage. With fallbacks configured, an existing
+// dir is also probed for writability.
+func chooseDir(dir string, fallbacks []string, logger *slog.Logger) (string, error) {
+	first, err := prepareDir(dir, len(fallbacks) > 0)
+	if err == nil {
+		return dir, nil
+	}
+	if first == nil {
+		return "", fmt.Errorf("failed to create keystore directory: %w", err)
+	}
+
+	for _, fallback := range fallbacks {
+		if _, err := prepareDir(fallback, true); err != nil {
+			logger.Warn("keystore: fallback directory unusable", "dir", fallback, "error", err)
+			continue
+		}
+		logger.Warn("keystore: directory is read-only, using fallback", "dir", dir, "fallback", fallback)
+		return fallback, nil
+	}
+
+	return "", first
+}
+
+// prepareDir creates dir and, if probe is set, checks that a file can be
+// created in it.
+func prepareDir(dir string, probe bool) (*ReadOnlyError, error) {
+	err := os.MkdirAll(dir, DefaultDirMode)
+	if err == nil && probe {
+		var f *os.File
+		if f, err = os.CreateTemp(dir, ".probe-*"); err == nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}
+	if err == nil {
+		return nil, nil
+	}
+
+	if roErr, ok := readOnlyError(err, dir); ok {
+		return roErr, roErr
+	}
+	return nil, err
+}
+
+// checkReadOnly fails fast with the last ReadOnlyError until
+// ReadOnlyRetryInterval has passed, so callers retrying in a loop do not
+// hammer the storage. Stores opened with NewKeystoreFromFS always fail with
+// ErrReadOnly.
+func (s *Store) checkReadOnly() error {
+	if b, ok := s.backend.(*fsBackend); ok {
+		return b.readOnly()
+	}
+	if s.readOnly != nil && s.now().Before(s.readOnly.RetryAfter) {
+		return s.readOnly
+	}
+	s.readOnly = nil
+	return nil
+}
+
+// noteReadOnly records err if it is a read-only failure, returning the
+// ReadOnlyError to report in its place, or nil.
+func (s *Store) noteReadOnly(err error) error {
+	roErr, ok := readOnlyError(err, s.location())
+	if !ok {
+		return nil
+	}
+
+	roErr.RetryAfter = s.now().Add(ReadOnlyRetryInterval)
+	s.readOnly = roErr
+	return roErr
+}
+
+// Dir returns the directory holding the keystore, which is a fallback
+// directory when Config.DirPath was read-only. It is empty for custom
+// backends.
+func (s *Store) Dir() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.config.Backend != nil {
+		return ""
+	}
+	return s.config.DirPath
+}
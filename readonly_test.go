@@ -0,0 +1,71 @@
+package keystore_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/theblitlabs/keystore"
+)
+
+// readOnlyDir returns a directory that cannot be written, skipping the test
+// where permissions do not stop writes, as for root.
+func readOnlyDir(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0o555); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(dir, 0o755) })
+	if f, err := os.CreateTemp(dir, "probe"); err == nil {
+		f.Close()
+		os.Remove(f.Name())
+		t.Skip("a read-only directory is still writable, as it is for root")
+	}
+	return dir
+}
+
+func TestFallbackDirs(t *testing.T) {
+	ro := readOnlyDir(t)
+	fallback := filepath.Join(t.TempDir(), "fallback")
+
+	// The first fallback cannot be created, so the next one is used.
+	ks, err := keystore.NewKeystore(keystore.Config{
+		DirPath:      ro,
+		FallbackDirs: []string{filepath.Join(ro, "nested"), fallback},
+		Logger:       discardLogger,
+	})
+	if err != nil {
+		t.Fatalf("NewKeystore: %v", err)
+	}
+	if dir := ks.Dir(); dir != fallback {
+		t.Fatalf("Dir = %s, want the fallback %s", dir, fallback)
+	}
+	if err := ks.SaveToken("token"); err != nil {
+		t.Fatalf("SaveToken: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(fallback, keystore.DefaultFileName)); err != nil {
+		t.Fatalf("keystore in the fallback: %v", err)
+	}
+	if entries, err := os.ReadDir(ro); err != nil || len(entries) != 0 {
+		t.Fatalf("the read-only directory holds %d entries, %v", len(entries), err)
+	}
+
+	// A writable DirPath is used as it is.
+	writable := t.TempDir()
+	if ks := newErrorStore(t, keystore.Config{DirPath: writable, FallbackDirs: []string{fallback}}); ks.Dir() != writable {
+		t.Fatalf("Dir = %s, want the writable %s", ks.Dir(), writable)
+	}
+
+	// Without a usable fallback the read-only error is reported.
+	_, err = keystore.NewKeystore(keystore.Config{
+		DirPath:      ro,
+		FallbackDirs: []string{filepath.Join(ro, "nested")},
+		Logger:       discardLogger,
+	})
+	if !errors.Is(err, keystore.ErrStorageReadOnly) {
+		t.Fatalf("NewKeystore without a usable fallback: got %v, want ErrStorageReadOnly", err)
+	}
+}
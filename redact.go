@@ -0,0 +1,186 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// storeJSON is the on-disk form of a Store. Marshalling through it bypasses
+// the redacting Store.MarshalJSON.
+type storeJSON Store
+
+// secretFields are the document fields holding plaintext secrets.
+var secretFields = []string{"private_key", "auth_token", "ssh_key"}
+
+// nestedSecretMaps are the document maps whose entries hold secretFields.
+var nestedSecretMaps = []string{"accounts", "url_tokens", "trash"}
+
+// redact replaces a secret with a short fingerprint and its length so that
+// values can still be told apart in logs.
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(secret))
+	return fmt.Sprintf("[redacted sha256:%x len=%d]", sum[:4], len(secret))
+}
+
+// redaction holds the redacted description of a Store's persisted fields,
+// refreshed under the Store's lock after every load and save so that
+// formatting the Store never takes the lock.
+type redaction struct {
+	doc atomic.Pointer[map[string]any]
+}
+
+// refreshRedaction snapshots the redacted persisted fields. The caller
+// holds s.mu.
+func (s *Store) refreshRedaction() {
+	if s.redaction == nil {
+		return
+	}
+
+	doc, err := s.redacted()
+	if err != nil {
+		s.redaction.doc.Store(nil)
+		return
+	}
+	s.redaction.doc.Store(&doc)
+}
+
+// redactedDoc returns the redacted persisted fields as of the last load or
+// save, or nil if there are none. Stores not made by NewKeystore, such as
+// bundles, are never shared and are described from their current fields.
+func (s *Store) redactedDoc() map[string]any {
+	if s.redaction != nil {
+		if doc := s.redaction.doc.Load(); doc != nil {
+			return *doc
+		}
+		return nil
+	}
+
+	doc, err := s.redacted()
+	if err != nil {
+		return nil
+	}
+	return doc
+}
+
+// redacted returns the persisted fields of s with every plaintext secret
+// replaced by its fingerprint.
+func (s *Store) redacted() (map[string]any, error) {
+	data, err := json.Marshal((*storeJSON)(s))
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(data)
+
+	var doc map[string]any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	redactFields(doc)
+	if secrets, ok := doc["secrets"].(map[string]any); ok {
+		for name, v := range secrets {
+			if value, ok := v.(string); ok {
+				secrets[name] = redact(value)
+			}
+		}
+	}
+	for _, name := range nestedSecretMaps {
+		if entries, ok := doc[name].(map[string]any); ok {
+			for _, entry := range entries {
+				if fields, ok := entry.(map[string]any); ok {
+					redactFields(fields)
+				}
+			}
+		}
+	}
+
+	return doc, nil
+}
+
+func redactFields(doc map[string]any) {
+	for _, name := range secretFields {
+		if v, ok := doc[name].(string); ok {
+			doc[name] = redact(v)
+		}
+	}
+}
+
+// MarshalJSON encodes the Store with secrets redacted, as of the last load
+// or save. The keystore file itself is written in full. It does not take
+// the Store's lock, so it can be logged from hooks called with the lock
+// held, and it has a value receiver so copies of a Store are redacted too.
+func (s Store) MarshalJSON() ([]byte, error) {
+	doc := s.redactedDoc()
+	if doc == nil {
+		doc = map[string]any{}
+	}
+	return json.Marshal(doc)
+}
+
+// String describes the Store with secrets redacted, as of the last load or
+// save. Like MarshalJSON, it does not take the lock.
+func (s Store) String() string {
+	return s.describe()
+}
+
+// GoString is String, so %#v does not bypass redaction.
+func (s Store) GoString() string {
+	return s.describe()
+}
+
+func (s *Store) describe() string {
+	doc := s.redactedDoc()
+	if doc == nil {
+		if s.backend == nil {
+			return "keystore.Store{}"
+		}
+		return "keystore.Store{" + s.location() + "}"
+	}
+	return "keystore.Store" + formatFields(doc)
+}
+
+// String describes the account with its key redacted.
+func (a Account) String() string {
+	return fmt.Sprintf("keystore.Account{Address:%s PrivateKey:%s Encrypted:%t WatchOnly:%t CreatedAt:%d Labels:%v ChainID:%s NetworkName:%s}",
+		a.Address, redact(a.PrivateKey), a.EncryptedKey != nil, a.WatchOnly, a.CreatedAt, a.Labels, a.ChainID, a.NetworkName)
+}
+
+// GoString is String, so %#v does not bypass redaction.
+func (a Account) GoString() string {
+	return a.String()
+}
+
+// formatFields renders a decoded document as {key:value ...} in key order.
+func formatFields(doc map[string]any) string {
+	keys := make([]string, 0, len(doc))
+	for k := range doc {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		switch v := doc[k].(type) {
+		case map[string]any:
+			fmt.Fprintf(&b, "%s:%s", k, formatFields(v))
+		default:
+			fmt.Fprintf(&b, "%s:%v", k, v)
+		}
+	}
+	b.WriteByte('}')
+	return b.String()
+}
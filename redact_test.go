@@ -0,0 +1,130 @@
+package keystore_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/theblitlabs/keystore"
+)
+
+const redactToken = "secret-bearer-token-value"
+
+func redactionStore(t *testing.T, cfg keystore.Config) *keystore.Store {
+	t.Helper()
+
+	s, err := keystore.NewKeystore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveAccount("alice", credentialKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveToken(redactToken); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveTokenForURL("https://api.example.com", redactToken+"-url", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PutSecret("db", strings.NewReader("db-password-value"), int64(len("db-password-value"))); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func assertRedacted(t *testing.T, how, out string) {
+	t.Helper()
+
+	for _, secret := range []string{fileKeyHex, credentialKeyHex, redactToken, "db-password-value", "ZGItcGFzc3dvcmQtdmFsdWU"} {
+		if strings.Contains(strings.ToLower(out), strings.ToLower(secret)) {
+			t.Errorf("%s leaks %q: %s", how, secret, out)
+		}
+	}
+	if !strings.Contains(out, "redacted") {
+		t.Errorf("%s shows no redacted fields: %s", how, out)
+	}
+}
+
+func TestStoreFormattingIsRedacted(t *testing.T) {
+	dir := t.TempDir()
+	s := redactionStore(t, keystore.Config{DirPath: dir})
+
+	for _, verb := range []string{"%v", "%+v", "%#v", "%s"} {
+		assertRedacted(t, verb, fmt.Sprintf(verb, s))
+		assertRedacted(t, verb+" of a value copy", fmt.Sprintf(verb, *s))
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertRedacted(t, "json.Marshal", string(data))
+
+	data, err = json.Marshal(*s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertRedacted(t, "json.Marshal of a value copy", string(data))
+
+	var log strings.Builder
+	slog.New(slog.NewJSONHandler(&log, nil)).Info("store", "ks", s)
+	slog.New(slog.NewTextHandler(&log, nil)).Info("store", "ks", s)
+	assertRedacted(t, "slog", log.String())
+
+	// The keystore file itself is written in full.
+	raw, err := os.ReadFile(filepath.Join(dir, keystore.DefaultFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(raw), fileKeyHex) {
+		t.Error("keystore file does not hold the private key")
+	}
+}
+
+func TestStoreFormattingWithLockHeld(t *testing.T) {
+	var s *keystore.Store
+	var logged []string
+	cfg := keystore.Config{
+		DirPath: t.TempDir(),
+		Audit: func(keystore.AuditEvent) {
+			data, _ := json.Marshal(s)
+			logged = append(logged, fmt.Sprintf("%v %+v %#v", s, s, s), string(data))
+		},
+	}
+
+	var err error
+	if s, err = keystore.NewKeystore(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := s.SavePrivateKey(fileKeyHex); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("formatting the Store from an audit hook deadlocked")
+	}
+
+	if len(logged) == 0 {
+		t.Fatal("audit hook was not called")
+	}
+	for _, out := range logged {
+		if strings.Contains(out, fileKeyHex) {
+			t.Errorf("audit hook output leaks the private key: %s", out)
+		}
+	}
+}
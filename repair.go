@@ -0,0 +1,333 @@
+package keystore
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Problems detected by Repair, reported in RepairItem.Problem
+const (
+	RepairTempFile    = "temp_file"
+	RepairStaleLock   = "stale_lock"
+	RepairPermissions = "permissions"
+	RepairAddress     = "missing_address"
+	RepairSchema      = "schema_version"
+)
+
+// tempFileMinAge is how old a temporary file must be before Repair removes
+// it, so that a write in progress is left alone.
+const tempFileMinAge = time.Minute
+
+// RepairOptions configures Repair.
+type RepairOptions struct {
+	// DryRun reports the intended actions as Planned without changing
+	// anything.
+	DryRun bool
+}
+
+// RepairItem is one problem found by Repair and what was done about it.
+type RepairItem struct {
+	Problem string `json:"problem"`
+	Path    string `json:"path,omitempty"`
+	Action  string `json:"action"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// RepairReport lists the problems Repair found, by outcome. Planned is only
+// filled in a dry run.
+type RepairReport struct {
+	DryRun  bool         `json:"dry_run"`
+	Planned []RepairItem `json:"planned"`
+	Fixed   []RepairItem `json:"fixed"`
+	Skipped []RepairItem `json:"skipped"`
+	Failed  []RepairItem `json:"failed"`
+}
+
+// Repair detects and fixes common problems with a file keystore: temporary
+// files left by interrupted writes, lock files whose owning process is
+// gone, keystore files or a directory readable by other users, a missing
+// primary key address and an outdated schema version. The last two are
+// fixed by rewriting the keystore; secret values are re-serialized but
+// never changed. Stale locks are removed first, then the keystore lock is
+// held for the remaining fixes as for a save. A dry run takes no lock.
+func (s *Store) Repair(opts RepairOptions) (RepairReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := &repairRun{
+		dryRun: opts.DryRun,
+		report: RepairReport{
+			DryRun:  opts.DryRun,
+			Planned: []RepairItem{},
+			Fixed:   []RepairItem{},
+			Skipped: []RepairItem{},
+			Failed:  []RepairItem{},
+		},
+	}
+
+	files := s.repairFiles()
+	for _, path := range files {
+		r.staleLock(path + lockSuffix)
+	}
+
+	if !opts.DryRun {
+		if err := s.checkReadOnly(); err != nil {
+			return r.report, err
+		}
+		if b, ok := s.backend.(lockingBackend); ok {
+			release, err := b.acquireLock(scopeStore, s.lockTimeout())
+			if err != nil {
+				return r.report, err
+			}
+			defer release()
+		}
+	}
+
+	if len(files) > 0 {
+		dir := s.config.DirPath
+		r.tempFiles(dir)
+		r.permissions(dir, DefaultDirMode)
+		for _, path := range files {
+			r.permissions(path, DefaultFileMode)
+		}
+	}
+
+	if err := s.load(); err != nil {
+		if isNoKeystore(err) {
+			return r.report, nil
+		}
+		return r.report, err
+	}
+
+	var rewrite []RepairItem
+	if s.fileVersion < SchemaVersion {
+		rewrite = append(rewrite, RepairItem{
+			Problem: RepairSchema,
+			Action:  fmt.Sprintf("rewrite schema version %d as %d", s.fileVersion, SchemaVersion),
+		})
+	}
+	item, address := s.repairAddress()
+	switch {
+	case address != "":
+		rewrite = append(rewrite, item)
+	case item.Reason != "":
+		r.report.Skipped = append(r.report.Skipped, item)
+	}
+
+	if len(rewrite) == 0 {
+		return r.report, nil
+	}
+	if opts.DryRun {
+		r.report.Planned = append(r.report.Planned, rewrite...)
+		return r.report, nil
+	}
+
+	if address != "" {
+		s.Address = address
+	}
+	if err := s.save(); err != nil {
+		for _, item := range rewrite {
+			r.fail(item, err)
+		}
+		return r.report, nil
+	}
+	r.report.Fixed = append(r.report.Fixed, rewrite...)
+	return r.report, nil
+}
+
+// repairFiles returns the keystore files of a file-based backend.
+func (s *Store) repairFiles() []string {
+	switch b := s.backend.(type) {
+	case *FileBackend:
+		return []string{b.path}
+	case *SplitFileBackend:
+		files := []string{b.key.path, b.token.path}
+		if b.legacy != nil {
+			files = append(files, b.legacy.path)
+		}
+		return files
+	}
+	return nil
+}
+
+// repairAddress derives the missing address of the primary key from its
+// stored public key or, for a plaintext key, from the key itself. It
+// returns an empty address, with a reason in the item if the address is
+// missing, when there is nothing to record or the key must be unlocked
+// first.
+func (s *Store) repairAddress() (RepairItem, string) {
+	item := RepairItem{Problem: RepairAddress, Action: "record the address derived from the key"}
+	if s.Address != "" || !s.hasPrimaryKey() || (s.KeyCurve != "" && s.KeyCurve != CurveSecp256k1) {
+		return item, ""
+	}
+
+	var pub *ecdsa.PublicKey
+	switch {
+	case s.PublicKey != "":
+		data, err := hex.DecodeString(s.PublicKey)
+		if err == nil {
+			pub, err = crypto.UnmarshalPubkey(data)
+		}
+		if err != nil {
+			item.Reason = "stored public key is invalid"
+			return item, ""
+		}
+	case s.persisted.PrivateKey != "":
+		key, err := parsePrivateKeyHex(s.persisted.PrivateKey)
+		if err != nil {
+			item.Reason = "stored private key is invalid"
+			return item, ""
+		}
+		pub = &key.PublicKey
+	default:
+		item.Reason = "the key is encrypted; LoadPrivateKey records the address once it is unlocked"
+		return item, ""
+	}
+
+	return item, crypto.PubkeyToAddress(*pub).Hex()
+}
+
+// repairRun collects the outcome of the file checks of one Repair call.
+type repairRun struct {
+	dryRun bool
+	report RepairReport
+}
+
+// act records item as planned in a dry run, otherwise runs fix and records
+// the outcome.
+func (r *repairRun) act(item RepairItem, fix func() error) {
+	if r.dryRun {
+		r.report.Planned = append(r.report.Planned, item)
+		return
+	}
+	if err := fix(); err != nil {
+		r.fail(item, err)
+		return
+	}
+	r.report.Fixed = append(r.report.Fixed, item)
+}
+
+func (r *repairRun) skip(item RepairItem, reason string) {
+	item.Reason = reason
+	r.report.Skipped = append(r.report.Skipped, item)
+}
+
+func (r *repairRun) fail(item RepairItem, err error) {
+	item.Reason = err.Error()
+	r.report.Failed = append(r.report.Failed, item)
+}
+
+// staleLock removes the lock file at path if it was left by a process that
+// no longer holds it, as acquireLock would take it over. Locks held by this
+// process, by a running process or by an unreadable owner are left in place.
+func (r *repairRun) staleLock(path string) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return
+	}
+
+	item := RepairItem{Problem: RepairStaleLock, Path: path, Action: "remove lock file"}
+	if err != nil {
+		r.fail(item, err)
+		return
+	}
+
+	owner, ok := parseLockOwner(data)
+	info, reason, stale := staleLock(path)
+	switch {
+	case stale:
+		item.Reason = reason
+		r.act(item, func() error { return takeOverLock(path, info) })
+	case !ok:
+		r.skip(item, "lock file does not hold a PID")
+	case !owner.local():
+		r.skip(item, fmt.Sprintf("lock is held by process %d on %s", owner.pid, owner.host))
+	case owner.pid == os.Getpid():
+		r.skip(item, "lock is held by this process")
+	default:
+		r.skip(item, fmt.Sprintf("lock is held by running process %d", owner.pid))
+	}
+}
+
+// tempFiles removes the temporary files that interrupted atomic writes
+// left in dir.
+func (r *repairRun) tempFiles(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			r.fail(RepairItem{Problem: RepairTempFile, Path: dir, Action: "scan for temporary files"}, err)
+		}
+		return
+	}
+
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".tmp") {
+			continue
+		}
+
+		path := filepath.Join(dir, e.Name())
+		item := RepairItem{Problem: RepairTempFile, Path: path, Action: "remove temporary file"}
+		info, err := e.Info()
+		if err != nil {
+			r.fail(item, err)
+			continue
+		}
+		if time.Since(info.ModTime()) < tempFileMinAge {
+			r.skip(item, "modified less than a minute ago; a write may be in progress")
+			continue
+		}
+		r.act(item, func() error { return os.Remove(path) })
+	}
+}
+
+// permissions restricts path to want if other users have access to it.
+// Windows permissions are not represented by mode bits and are not checked.
+func (r *repairRun) permissions(path string, want os.FileMode) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			r.fail(RepairItem{Problem: RepairPermissions, Path: path, Action: "check permissions"}, err)
+		}
+		return
+	}
+
+	mode := info.Mode().Perm()
+	if mode&^want == 0 {
+		return
+	}
+	r.act(RepairItem{
+		Problem: RepairPermissions,
+		Path:    path,
+		Action:  fmt.Sprintf("change mode %04o to %04o", mode, want),
+	}, func() error { return os.Chmod(path, want) })
+}
+
+// processAlive reports whether a process with the given PID is running. On
+// Windows, finding the process is enough; elsewhere it is sent signal 0.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		p.Release()
+		return true
+	}
+
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, os.ErrPermission)
+}
@@ -0,0 +1,232 @@
+package keystore_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/theblitlabs/keystore"
+)
+
+// damagedKeystore writes an unversioned keystore without an address and
+// surrounds it with the debris Repair cleans up. It returns the keystore
+// directory and its original contents.
+func damagedKeystore(t *testing.T) (string, []byte) {
+	t.Helper()
+
+	dir := filepath.Join(t.TempDir(), "keystore")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	data := []byte(fmt.Sprintf(`{"auth_token": "repair-token", "private_key": %q, "created_at": 1704067200}`, fileKeyHex))
+	path := filepath.Join(dir, keystore.DefaultFileName)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	old := time.Now().Add(-time.Hour)
+	for name, mtime := range map[string]time.Time{"keystore.json.123.tmp": old, "keystore.json.456.tmp": time.Now()} {
+		tmp := filepath.Join(dir, name)
+		if err := os.WriteFile(tmp, []byte("partial"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(tmp, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeLock(t, dir, fmt.Sprint(deadPID(t)), 0)
+	return dir, data
+}
+
+func problems(items []keystore.RepairItem) []string {
+	var names []string
+	for _, item := range items {
+		name := item.Problem
+		if item.Path != "" {
+			name += " " + filepath.Base(item.Path)
+		}
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestRepair(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permissions are not mode bits on Windows")
+	}
+
+	wantActions := []string{
+		keystore.RepairAddress,
+		keystore.RepairPermissions + " keystore",
+		keystore.RepairPermissions + " " + keystore.DefaultFileName,
+		keystore.RepairSchema,
+		keystore.RepairStaleLock + " " + keystore.DefaultFileName + ".lock",
+		keystore.RepairTempFile + " keystore.json.123.tmp",
+	}
+	wantSkipped := []string{keystore.RepairTempFile + " keystore.json.456.tmp"}
+
+	t.Run("dry run", func(t *testing.T) {
+		dir, data := damagedKeystore(t)
+		ks, err := keystore.NewKeystore(keystore.Config{DirPath: dir, Logger: discardLogger})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		report, err := ks.Repair(keystore.RepairOptions{DryRun: true})
+		if err != nil {
+			t.Fatalf("Repair: %v", err)
+		}
+		if got := problems(report.Planned); !slices.Equal(got, wantActions) {
+			t.Errorf("Planned = %v, want %v", got, wantActions)
+		}
+		if got := problems(report.Skipped); !slices.Equal(got, wantSkipped) {
+			t.Errorf("Skipped = %v, want %v", got, wantSkipped)
+		}
+		if !report.DryRun || len(report.Fixed) != 0 || len(report.Failed) != 0 {
+			t.Errorf("report = %+v", report)
+		}
+
+		// Nothing changed.
+		if got, _ := os.ReadFile(filepath.Join(dir, keystore.DefaultFileName)); string(got) != string(data) {
+			t.Error("dry run rewrote the keystore")
+		}
+		for _, name := range []string{"keystore.json.123.tmp", keystore.DefaultFileName + ".lock"} {
+			if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+				t.Errorf("dry run removed %s", name)
+			}
+		}
+		if info, _ := os.Stat(dir); info.Mode().Perm() != 0o755 {
+			t.Errorf("dry run changed the directory mode to %v", info.Mode().Perm())
+		}
+	})
+
+	t.Run("repair", func(t *testing.T) {
+		dir, _ := damagedKeystore(t)
+		ks, err := keystore.NewKeystore(newTestClock(epoch).config(keystore.Config{DirPath: dir, Logger: discardLogger}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		report, err := ks.Repair(keystore.RepairOptions{})
+		if err != nil {
+			t.Fatalf("Repair: %v", err)
+		}
+		if got := problems(report.Fixed); !slices.Equal(got, wantActions) {
+			t.Errorf("Fixed = %v, want %v", got, wantActions)
+		}
+		if got := problems(report.Skipped); !slices.Equal(got, wantSkipped) {
+			t.Errorf("Skipped = %v, want %v", got, wantSkipped)
+		}
+		if report.DryRun || len(report.Planned) != 0 || len(report.Failed) != 0 {
+			t.Errorf("report = %+v", report)
+		}
+
+		path := filepath.Join(dir, keystore.DefaultFileName)
+		for name, want := range map[string]os.FileMode{dir: keystore.DefaultDirMode, path: keystore.DefaultFileMode} {
+			if info, err := os.Stat(name); err != nil || info.Mode().Perm() != want {
+				t.Errorf("mode of %s = %v, want %v", name, info.Mode().Perm(), want)
+			}
+		}
+		for _, name := range []string{"keystore.json.123.tmp", keystore.DefaultFileName + ".lock"} {
+			if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+				t.Errorf("%s was not removed", name)
+			}
+		}
+
+		// The rewrite kept the secrets and filled in the rest.
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var doc struct {
+			Version int    `json:"version"`
+			Address string `json:"address"`
+		}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			t.Fatal(err)
+		}
+		if doc.Version != keystore.SchemaVersion || doc.Address != "0x2c7536E3605D9C16a7a3D7b1898e529396a65c23" {
+			t.Errorf("rewritten keystore has version %d and address %q", doc.Version, doc.Address)
+		}
+		if key, err := ks.LoadPrivateKey(); err != nil || hexKey(key) != fileKeyHex {
+			t.Errorf("private key changed: %v", err)
+		}
+		if token, err := ks.LoadToken(); err != nil || token != "repair-token" {
+			t.Errorf("token = %q, %v", token, err)
+		}
+
+		// Everything left is reported as skipped again, nothing else.
+		again, err := ks.Repair(keystore.RepairOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(again.Fixed) != 0 || len(again.Failed) != 0 || !slices.Equal(problems(again.Skipped), wantSkipped) {
+			t.Errorf("second Repair = %+v", again)
+		}
+	})
+}
+
+func TestRepairLiveLock(t *testing.T) {
+	dir := t.TempDir()
+	ks, err := keystore.NewKeystore(keystore.Config{DirPath: dir, LockTimeout: 20 * time.Millisecond, Logger: discardLogger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveToken("token"); err != nil {
+		t.Fatal(err)
+	}
+	writeLock(t, dir, fmt.Sprint(os.Getpid()), time.Hour)
+
+	report, err := ks.Repair(keystore.RepairOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	want := []string{keystore.RepairStaleLock + " " + keystore.DefaultFileName + ".lock"}
+	if got := problems(report.Skipped); !slices.Equal(got, want) {
+		t.Fatalf("report = %+v, want the live lock skipped", report)
+	}
+
+	// Repairs need the lock, like a save.
+	if _, err := ks.Repair(keystore.RepairOptions{}); err == nil {
+		t.Fatal("Repair ran while another writer held the lock")
+	}
+}
+
+func TestRepairEncryptedKeyWithoutAddress(t *testing.T) {
+	dir := t.TempDir()
+	ks, err := keystore.NewKeystore(keystore.Config{DirPath: dir, Logger: discardLogger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.EncryptInPlace(portablePassphrase); err != nil {
+		t.Fatal(err)
+	}
+	editKeystore(t, dir, func(doc map[string]any) {
+		delete(doc, "address")
+		delete(doc, "public_key")
+	})
+
+	reopened, err := keystore.NewKeystore(keystore.Config{DirPath: dir, Logger: discardLogger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := reopened.Repair(keystore.RepairOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := problems(report.Skipped); !slices.Equal(got, []string{keystore.RepairAddress}) || report.Skipped[0].Reason == "" {
+		t.Fatalf("report = %+v, want the address skipped with a reason", report)
+	}
+}
@@ -0,0 +1,119 @@
+package keystore
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"time"
+)
+
+const (
+	// DefaultRetryAttempts is the number of times a transient storage error
+	// is attempted before giving up
+	DefaultRetryAttempts = 3
+
+	// DefaultRetryBackoff is the base delay between storage retries
+	DefaultRetryBackoff = 50 * time.Millisecond
+
+	maxRetryBackoff = 2 * time.Second
+)
+
+// isTransient reports whether err is a storage error worth retrying, such as
+// those seen on network filesystems. Missing files, permission errors and
+// parse errors are never transient.
+func isTransient(err error) bool {
+	for _, errno := range []syscall.Errno{syscall.EINTR, syscall.EAGAIN, syscall.ESTALE, syscall.EIO} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) retryAttempts() int {
+	switch {
+	case s.config.RetryAttempts < 0:
+		return 1
+	case s.config.RetryAttempts == 0:
+		return DefaultRetryAttempts
+	default:
+		return s.config.RetryAttempts
+	}
+}
+
+func (s *Store) retryBackoff() time.Duration {
+	if s.config.RetryBackoff > 0 {
+		return s.config.RetryBackoff
+	}
+	return DefaultRetryBackoff
+}
+
+// withRetry runs fn, retrying transient errors with jittered exponential
+// backoff. Each retry is logged and reported to Config.OnRetry.
+func (s *Store) withRetry(op string, fn func() error) error {
+	attempts := s.retryAttempts()
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil || !isTransient(err) || attempt >= attempts {
+			return err
+		}
+
+		s.config.Logger.Warn("keystore: retrying after transient storage error",
+			"op", op, "attempt", attempt, "error", err)
+		if s.config.OnRetry != nil {
+			s.config.OnRetry(op, attempt, err)
+		}
+
+		time.Sleep(backoff(s.retryBackoff(), maxRetryBackoff, attempt))
+	}
+}
+
+// readBackend reads the serialized keystore, enforcing Config.MaxFileSize.
+// File backends stop reading at the limit rather than loading the whole file.
+func (s *Store) readBackend() ([]byte, error) {
+	max := s.maxFileSize()
+
+	var data []byte
+	err := s.withRetry("read", func() error {
+		f, err := s.injectFault(FaultOpRead)
+		if err != nil {
+			return err
+		}
+		if b, ok := s.backend.(limitedReader); ok {
+			data, err = b.readLimited(max)
+		} else {
+			data, err = s.backend.Read()
+		}
+		if err == nil && f.Corrupt {
+			data = data[:len(data)/2]
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) > max {
+		wipe(data)
+		return nil, fmt.Errorf("%w of %d bytes", ErrKeystoreTooLarge, max)
+	}
+
+	return data, nil
+}
+
+func (s *Store) writeBackend(data []byte) error {
+	err := s.withRetry("write", func() error {
+		if _, err := s.injectFault(FaultOpWrite); err != nil {
+			return err
+		}
+		if b, ok := s.backend.(scopedBackend); ok && s.scope != scopeStore {
+			return b.writeScope(s.scope, data)
+		}
+		return s.backend.Write(data)
+	})
+	if err == nil {
+		s.bumpGeneration()
+	}
+	return err
+}
@@ -0,0 +1,171 @@
+package keystore_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/theblitlabs/keystore"
+	"github.com/theblitlabs/keystore/faultinject"
+)
+
+// retryCall is one Config.OnRetry call.
+type retryCall struct {
+	op      string
+	attempt int
+	err     error
+}
+
+// newRetryStore returns a Store on dir whose backend fails as inj says,
+// recording retries in calls.
+func newRetryStore(t *testing.T, dir string, attempts int, inj *faultinject.Injector, calls *[]retryCall) *keystore.Store {
+	t.Helper()
+
+	return newErrorStore(t, keystore.Config{
+		DirPath:       dir,
+		FaultInjector: inj,
+		RetryAttempts: attempts,
+		RetryBackoff:  time.Millisecond,
+		OnRetry: func(op string, attempt int, err error) {
+			*calls = append(*calls, retryCall{op, attempt, err})
+		},
+		Logger: discardLogger,
+	})
+}
+
+// failNext makes the next n calls of op fail with err.
+func failNext(inj *faultinject.Injector, op keystore.FaultOp, n int, err error) {
+	next := inj.Calls(op) + 1
+	for i := 0; i < n; i++ {
+		inj.Nth(op, next+i, keystore.Fault{Err: err})
+	}
+}
+
+func TestRetryTransientErrors(t *testing.T) {
+	ops := []struct {
+		op    keystore.FaultOp
+		name  string
+		run   func(ks *keystore.Store) error
+		check func(t *testing.T, dir string)
+	}{
+		{keystore.FaultOpRead, "read", func(ks *keystore.Store) error {
+			_, err := ks.LoadToken()
+			return err
+		}, func(t *testing.T, dir string) {}},
+		{keystore.FaultOpWrite, "write", func(ks *keystore.Store) error {
+			return ks.SaveToken("retried")
+		}, func(t *testing.T, dir string) {
+			if token, err := newErrorStore(t, keystore.Config{DirPath: dir}).LoadToken(); err != nil || token != "retried" {
+				t.Fatalf("persisted token = %q, %v", token, err)
+			}
+		}},
+	}
+
+	for _, op := range ops {
+		op := op
+		for _, errno := range []syscall.Errno{syscall.EIO, syscall.EAGAIN, syscall.ESTALE, syscall.EINTR} {
+			for failures := 0; failures < 3; failures++ {
+				errno, failures := errno, failures
+				t.Run(fmt.Sprintf("%s/%s/%d", op.name, errno, failures), func(t *testing.T) {
+					dir := t.TempDir()
+					if err := newErrorStore(t, keystore.Config{DirPath: dir}).SaveToken("token"); err != nil {
+						t.Fatal(err)
+					}
+					inj := faultinject.New()
+					var calls []retryCall
+					ks := newRetryStore(t, dir, 3, inj, &calls)
+
+					// The backend fails failures times and then succeeds, which
+					// the caller never notices.
+					failNext(inj, op.op, failures, errno)
+					before := inj.Calls(op.op)
+					if err := op.run(ks); err != nil {
+						t.Fatalf("%s after %d transient failures: %v", op.name, failures, err)
+					}
+					if n := inj.Calls(op.op) - before; n != failures+1 {
+						t.Fatalf("%d attempts, want %d", n, failures+1)
+					}
+					op.check(t, dir)
+
+					var want []retryCall
+					for attempt := 1; attempt <= failures; attempt++ {
+						want = append(want, retryCall{op.name, attempt, errno})
+					}
+					if !reflect.DeepEqual(calls, want) {
+						t.Fatalf("OnRetry calls = %v, want %v", calls, want)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		attempts int
+		want     int
+	}{
+		{"default", 0, keystore.DefaultRetryAttempts},
+		{"configured", 5, 5},
+		{"disabled", -1, 1},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			inj := faultinject.New()
+			var calls []retryCall
+			ks := newRetryStore(t, t.TempDir(), tt.attempts, inj, &calls)
+
+			// A backend failing on every attempt fails the operation with its
+			// error once the attempts run out.
+			failNext(inj, keystore.FaultOpWrite, tt.want+1, syscall.EIO)
+			if err := ks.SaveToken("token"); !errors.Is(err, syscall.EIO) {
+				t.Fatalf("SaveToken: got %v, want EIO", err)
+			}
+			if n := inj.Calls(keystore.FaultOpWrite); n != tt.want {
+				t.Fatalf("%d attempts, want %d", n, tt.want)
+			}
+			if len(calls) != tt.want-1 {
+				t.Fatalf("OnRetry called %d times, want %d", len(calls), tt.want-1)
+			}
+			for i, c := range calls {
+				if c.op != "write" || c.attempt != i+1 || !errors.Is(c.err, syscall.EIO) {
+					t.Fatalf("OnRetry call %d = %+v", i, c)
+				}
+			}
+
+			// The next save, with the backend healthy again, succeeds.
+			inj.Reset()
+			if err := ks.SaveToken("token"); err != nil {
+				t.Fatalf("SaveToken after the backend recovered: %v", err)
+			}
+		})
+	}
+}
+
+func TestRetryPermanentErrors(t *testing.T) {
+	for _, err := range []error{os.ErrPermission, syscall.ENOSPC, errors.New("disk full")} {
+		err := err
+		t.Run(err.Error(), func(t *testing.T) {
+			inj := faultinject.New()
+			var calls []retryCall
+			ks := newRetryStore(t, t.TempDir(), 5, inj, &calls)
+
+			// Errors that will not go away are reported at the first attempt.
+			inj.Once(keystore.FaultOpWrite, keystore.Fault{Err: err})
+			if got := ks.SaveToken("token"); !errors.Is(got, err) {
+				t.Fatalf("SaveToken: got %v, want %v", got, err)
+			}
+			if n := inj.Calls(keystore.FaultOpWrite); n != 1 {
+				t.Fatalf("%d attempts, want 1", n)
+			}
+			if len(calls) != 0 {
+				t.Fatalf("OnRetry calls = %v, want none", calls)
+			}
+		})
+	}
+}
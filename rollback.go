@@ -0,0 +1,214 @@
+package keystore
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// EncryptionBackupSuffix is appended to the keystore path for the copy kept
+// while EncryptInPlace runs
+const EncryptionBackupSuffix = ".pre-encryption"
+
+// RollbackEncryption restores the plaintext keystore saved by an
+// EncryptInPlace that has not yet completed, then removes the backup. It
+// fails with ErrNoBackup once the migration has finished.
+func (s *Store) RollbackEncryption() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path, ok := s.encryptionBackupPath()
+	if !ok {
+		return fmt.Errorf("encryption rollback: %w", ErrNotFileBacked)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: %s", ErrNoBackup, path)
+		}
+		return fmt.Errorf("failed to read backup: %w", err)
+	}
+	defer wipe(data)
+
+	if b, ok := s.backend.(lockingBackend); ok {
+		release, err := b.acquireLock(scopeStore, s.lockTimeout())
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+
+	if err := s.restoreEncryptionBackup(data); err != nil {
+		return err
+	}
+	return s.removeEncryptionBackup()
+}
+
+// encryptionBackupPath returns where the encryption backup is kept.
+// Custom backends keep no backup on disk.
+func (s *Store) encryptionBackupPath() (string, bool) {
+	if s.config.Backend != nil {
+		return "", false
+	}
+	return s.path() + EncryptionBackupSuffix, true
+}
+
+// writeEncryptionBackup saves the original document before it is
+// encrypted.
+func (s *Store) writeEncryptionBackup(original []byte) error {
+	path, ok := s.encryptionBackupPath()
+	if !ok {
+		return nil
+	}
+
+	if err := writeFileAtomic(path, original, DefaultFileMode); err != nil {
+		return fmt.Errorf("failed to write encryption backup: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) restoreEncryptionBackup(original []byte) error {
+	s.cache = nil
+	if err := s.writeBackend(original); err != nil {
+		return fmt.Errorf("failed to restore keystore: %w", err)
+	}
+	// The original is older than what this Store wrote since.
+	s.writtenRev = 0
+	return nil
+}
+
+func (s *Store) removeEncryptionBackup() error {
+	path, ok := s.encryptionBackupPath()
+	if !ok {
+		return nil
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove encryption backup: %w", err)
+	}
+	return nil
+}
+
+// finishEncryption completes an interrupted migration: if a backup is
+// left behind the keystore is verified and the backup removed.
+func (s *Store) finishEncryption() error {
+	if !s.hasEncryptionBackup() {
+		return nil
+	}
+
+	if err := s.verifyEncrypted(); err != nil {
+		return fmt.Errorf("encrypted keystore failed verification, backup kept: %w", err)
+	}
+	return s.removeEncryptionBackup()
+}
+
+func (s *Store) hasEncryptionBackup() bool {
+	path, ok := s.encryptionBackupPath()
+	if !ok {
+		return false
+	}
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// autoEncrypt applies Config.AutoEncryptOnLoad.
+func (s *Store) autoEncrypt() error {
+	if !s.config.AutoEncryptOnLoad || s.config.Passphrase == nil {
+		return nil
+	}
+
+	if err := s.load(); err != nil {
+		if isNoKeystore(err) {
+			return nil
+		}
+		return err
+	}
+
+	if !s.needsEncryption() && !s.hasEncryptionBackup() {
+		return nil
+	}
+
+	passphrase, err := s.passphrase()
+	if err != nil {
+		return err
+	}
+	return s.encryptInPlace(passphrase)
+}
+
+// verifyEncrypted reads the keystore back and checks that every key
+// decrypts, parses and matches its recorded address, and that the token
+// decrypts.
+func (s *Store) verifyEncrypted() error {
+	s.cache = nil
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	if s.needsEncryption() {
+		return fmt.Errorf("%w: values are still in plaintext after encryption", ErrPlaintextKey)
+	}
+
+	if s.EncryptedKey != nil {
+		privateKeyHex, err := s.privateKeyHex()
+		if err != nil {
+			return err
+		}
+		if s.checkEthereumKey() != nil {
+			_, err = parseCurveKey(privateKeyHex, s.KeyCurve)
+		} else {
+			err = verifyKeyAddress(privateKeyHex, s.Address)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.EncryptedSSHKey != nil {
+		if _, err := s.sshKey(); err != nil {
+			return fmt.Errorf("SSH key: %w", err)
+		}
+	}
+
+	for name, account := range s.Accounts {
+		if account.EncryptedKey == nil {
+			continue
+		}
+		privateKeyHex, err := s.openKey("", account.EncryptedKey)
+		if err != nil {
+			return fmt.Errorf("account %q: %w", name, err)
+		}
+		if err := verifyKeyAddress(privateKeyHex, account.Address); err != nil {
+			return fmt.Errorf("account %q: %w", name, err)
+		}
+	}
+
+	if _, err := s.authToken(); err != nil {
+		return fmt.Errorf("token: %w", err)
+	}
+
+	for key, entry := range s.URLTokens {
+		if _, err := s.openToken(entry.AuthToken, entry.EncryptedToken); err != nil {
+			return fmt.Errorf("token for %s: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+func verifyKeyAddress(privateKeyHex, address string) error {
+	key, err := crypto.HexToECDSA(privateKeyHex)
+	if err != nil {
+		return fmt.Errorf("invalid private key: %w", err)
+	}
+
+	if address == "" {
+		return nil
+	}
+	if derived := crypto.PubkeyToAddress(key.PublicKey); derived != common.HexToAddress(address) {
+		return fmt.Errorf("%w: stored %s, key derives to %s", ErrAddressMismatch, address, derived.Hex())
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package keystore_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/theblitlabs/keystore"
+)
+
+func TestRollbackEncryption(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, keystore.DefaultFileName)
+	backup := path + keystore.EncryptionBackupSuffix
+	ks := newErrorStore(t, keystore.Config{DirPath: dir})
+	if err := ks.SaveToken("token"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveAccount("ops", credentialKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A completed migration leaves nothing to roll back to.
+	if err := ks.EncryptInPlace("correct horse"); err != nil {
+		t.Fatalf("EncryptInPlace: %v", err)
+	}
+	assertNoPlaintext(t, dir, fileKeyHex)
+	if _, err := os.Stat(backup); !os.IsNotExist(err) {
+		t.Fatalf("backup after a completed EncryptInPlace: %v", err)
+	}
+	if err := ks.RollbackEncryption(); !errors.Is(err, keystore.ErrNoBackup) {
+		t.Fatalf("RollbackEncryption after a completed migration: got %v, want ErrNoBackup", err)
+	}
+
+	// An EncryptInPlace interrupted after writing the encrypted file leaves
+	// the plaintext backup next to it, which RollbackEncryption restores.
+	encrypted, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(backup, plaintext, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.RollbackEncryption(); err != nil {
+		t.Fatalf("RollbackEncryption: %v", err)
+	}
+	if data, err := os.ReadFile(path); err != nil || !bytes.Equal(data, plaintext) {
+		t.Fatalf("the keystore after RollbackEncryption is not the plaintext original: %v", err)
+	}
+	if _, err := os.Stat(backup); !os.IsNotExist(err) {
+		t.Fatalf("backup after RollbackEncryption: %v", err)
+	}
+
+	// The plaintext key, its address and the account are intact, for the
+	// Store that rolled back and for one without a passphrase.
+	wantAddress := crypto.PubkeyToAddress(mustKey(t, fileKeyHex).PublicKey)
+	for name, store := range map[string]*keystore.Store{"same": ks, "fresh": newErrorStore(t, keystore.Config{DirPath: dir})} {
+		if key, err := store.GetPrivateKeyHex(); err != nil || key != fileKeyHex {
+			t.Fatalf("%s Store: GetPrivateKeyHex = %v, want the original key", name, err)
+		}
+		if addr, err := store.GetAddress(); err != nil || addr != wantAddress {
+			t.Fatalf("%s Store: GetAddress = %s, %v, want %s", name, addr, err, wantAddress.Hex())
+		}
+		if key, err := store.LoadAccountKey("ops"); err != nil || hexKey(key) != credentialKeyHex {
+			t.Fatalf("%s Store: LoadAccountKey = %v, want the original key", name, err)
+		}
+		if token, err := store.LoadToken(); err != nil || token != "token" {
+			t.Fatalf("%s Store: LoadToken = %q, %v", name, token, err)
+		}
+	}
+
+	// A second rollback fails cleanly and leaves the keystore alone.
+	if err := ks.RollbackEncryption(); !errors.Is(err, keystore.ErrNoBackup) {
+		t.Fatalf("second RollbackEncryption: got %v, want ErrNoBackup", err)
+	}
+	if data, err := os.ReadFile(path); err != nil || !bytes.Equal(data, plaintext) || bytes.Equal(data, encrypted) {
+		t.Fatalf("a failed RollbackEncryption changed the keystore: %v", err)
+	}
+
+	// Backends without a directory keep no backup.
+	mem := newErrorStore(t, keystore.Config{Backend: keystore.NewMemoryBackend()})
+	if err := mem.RollbackEncryption(); !errors.Is(err, keystore.ErrNotFileBacked) {
+		t.Fatalf("RollbackEncryption on a memory backend: got %v, want ErrNotFileBacked", err)
+	}
+}
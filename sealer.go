@@ -0,0 +1,116 @@
+package keystore
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+// sealedKeyLen is the size of the data-encryption key protected by a
+// KeySealer
+const sealedKeyLen = 32
+
+// KeySealer protects the data-encryption key used for encrypted values by
+// binding it to hardware, such as a TPM. The sealed form is stored in the
+// keystore file and is useless on any other machine.
+type KeySealer interface {
+	Seal(key []byte) (*SealedKey, error)
+	Unseal(sealed *SealedKey) ([]byte, error)
+}
+
+// SealedKey is a sealed data-encryption key as stored in the keystore.
+// Recovery, if present, is the same key encrypted with the recovery
+// passphrase so it can be re-sealed when the seal can no longer be opened.
+type SealedKey struct {
+	Type     string          `json:"type"`
+	Blob     []byte          `json:"blob"`
+	PCRs     []int           `json:"pcrs,omitempty"`
+	Recovery *EncryptedValue `json:"recovery,omitempty"`
+}
+
+// sealedPassphrase returns the unsealed data-encryption key in hex, sealing
+// a fresh key on first use. It is used in place of a passphrase.
+func (s *Store) sealedPassphrase() (string, error) {
+	if s.Sealed == nil {
+		if err := s.newSealedKey(); err != nil {
+			return "", err
+		}
+	}
+
+	key, err := s.config.Sealer.Unseal(s.Sealed)
+	if err != nil {
+		return "", err
+	}
+	defer wipe(key)
+
+	return hex.EncodeToString(key), nil
+}
+
+func (s *Store) newSealedKey() error {
+	key := make([]byte, sealedKeyLen)
+	if _, err := rand.Read(key); err != nil {
+		return fmt.Errorf("failed to generate data key: %w", err)
+	}
+	defer wipe(key)
+
+	return s.seal(key, nil)
+}
+
+// seal seals key with the configured sealer, keeping recovery if given and
+// otherwise creating it from Config.SealerRecovery.
+func (s *Store) seal(key []byte, recovery *EncryptedValue) error {
+	sealed, err := s.config.Sealer.Seal(key)
+	if err != nil {
+		return fmt.Errorf("failed to seal data key: %w", err)
+	}
+
+	if recovery == nil && s.config.SealerRecovery != nil {
+		passphrase, err := s.config.SealerRecovery.Passphrase()
+		if err != nil {
+			return fmt.Errorf("failed to obtain recovery passphrase: %w", err)
+		}
+		if recovery, err = encryptValue(passphrase, key); err != nil {
+			return fmt.Errorf("failed to encrypt recovery key: %w", err)
+		}
+	}
+
+	sealed.Recovery = recovery
+	s.Sealed = sealed
+	return nil
+}
+
+// Reseal seals the data-encryption key again with the current sealer
+// configuration, for example after a firmware update changed the PCR values
+// and unsealing fails with ErrPCRMismatch. With an empty recovery
+// passphrase the key is unsealed normally, which only works while the
+// existing seal still opens; otherwise the recovery copy is decrypted.
+func (s *Store) Reseal(recovery string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.config.Sealer == nil {
+		return configError("Sealer", "no sealer configured")
+	}
+
+	return s.update(func() error {
+		if s.Sealed == nil {
+			return fmt.Errorf("%w: keystore has no sealed key", ErrNoSealedKey)
+		}
+
+		var key []byte
+		var err error
+		if recovery == "" {
+			key, err = s.config.Sealer.Unseal(s.Sealed)
+		} else if s.Sealed.Recovery == nil {
+			return fmt.Errorf("%w: sealed key has no recovery copy", ErrNoSealedKey)
+		} else {
+			key, err = decryptValue(recovery, s.Sealed.Recovery)
+		}
+		if err != nil {
+			return err
+		}
+		defer wipe(key)
+
+		return s.seal(key, s.Sealed.Recovery)
+	})
+}
@@ -0,0 +1,270 @@
+package keystore
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// secretsSuffix names the directory next to the key file in which the
+// split backend stores secrets.
+const secretsSuffix = ".secrets"
+
+var secretNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+
+// SecretBackend is implemented by backends that store secrets apart from
+// the keystore document, one value each, so that they can be streamed
+// without reading or rewriting the rest of the keystore. Secrets on other
+// backends are stored in the document.
+//
+// OpenSecret and DeleteSecret return an error matching fs.ErrNotExist for
+// a missing secret. PutSecret reads r to the end and must not make a
+// partial value visible to readers if it fails.
+type SecretBackend interface {
+	OpenSecret(name string) (io.ReadCloser, error)
+	PutSecret(name string, r io.Reader) error
+	DeleteSecret(name string) error
+	SecretNames() ([]string, error)
+}
+
+// PutSecret stores size bytes read from r under name, replacing any value
+// stored before. Values larger than Config.MaxSecretSize fail with
+// ErrSecretTooLarge before anything is read, and a reader yielding more or
+// less than size bytes fails the write. On a SecretBackend, such as the
+// split backend, the value is streamed to storage and replaces the old one
+// only once complete. Elsewhere, it is read into memory and saved with the
+// keystore. Secrets are stored as given: encrypt sensitive values before
+// storing them unless the whole keystore is encrypted with Config.OpenPGP.
+func (s *Store) PutSecret(name string, r io.Reader, size int64) error {
+	if err := validateSecretName(name); err != nil {
+		return err
+	}
+	if size < 0 {
+		return fmt.Errorf("%w: must not be negative, got %d", ErrInvalidSecretSize, size)
+	}
+	if max := s.maxSecretSize(); size > max {
+		return fmt.Errorf("%w: %d bytes, limit %d", ErrSecretTooLarge, size, max)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r = &sizedReader{r: r, left: size}
+	if b, ok := s.backend.(SecretBackend); ok {
+		if err := s.checkReadOnly(); err != nil {
+			return err
+		}
+		if err := b.PutSecret(name, r); err != nil {
+			return fmt.Errorf("failed to store secret %q: %w", name, err)
+		}
+		s.bumpGeneration()
+		return nil
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read secret %q: %w", name, err)
+	}
+	defer wipe(data)
+
+	return s.update(func() error {
+		if s.Secrets == nil {
+			s.Secrets = make(map[string]string)
+		}
+		s.Secrets[name] = base64.StdEncoding.EncodeToString(data)
+		return nil
+	})
+}
+
+// OpenSecret returns a reader of the secret stored under name, or
+// ErrNoSecret. On a SecretBackend the value is streamed from storage; the
+// reader sees the value stored when it was opened even if it is replaced
+// meanwhile. The caller must close it.
+func (s *Store) OpenSecret(name string) (io.ReadCloser, error) {
+	if err := validateSecretName(name); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if b, ok := s.backend.(SecretBackend); ok {
+		rc, err := b.OpenSecret(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %q", ErrNoSecret, name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to open secret %q: %w", name, err)
+		}
+		return rc, nil
+	}
+
+	if err := s.load(); err != nil && !isNoKeystore(err) {
+		return nil, err
+	}
+	encoded, ok := s.Secrets[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrNoSecret, name)
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, s.corrupt("secrets."+name, err)
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// DeleteSecret removes the secret stored under name, or returns
+// ErrNoSecret.
+func (s *Store) DeleteSecret(name string) error {
+	if err := validateSecretName(name); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if b, ok := s.backend.(SecretBackend); ok {
+		if err := s.checkReadOnly(); err != nil {
+			return err
+		}
+		err := b.DeleteSecret(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("%w: %q", ErrNoSecret, name)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to delete secret %q: %w", name, err)
+		}
+		s.bumpGeneration()
+		return nil
+	}
+
+	return s.update(func() error {
+		if _, ok := s.Secrets[name]; !ok {
+			return fmt.Errorf("%w: %q", ErrNoSecret, name)
+		}
+		delete(s.Secrets, name)
+		return nil
+	})
+}
+
+// SecretNames returns the names of the stored secrets in order.
+func (s *Store) SecretNames() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var names []string
+	if b, ok := s.backend.(SecretBackend); ok {
+		var err error
+		if names, err = b.SecretNames(); err != nil {
+			return nil, fmt.Errorf("failed to list secrets: %w", err)
+		}
+	} else {
+		if err := s.load(); err != nil && !isNoKeystore(err) {
+			return nil, err
+		}
+		for name := range s.Secrets {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *Store) maxSecretSize() int64 {
+	if s.config.MaxSecretSize > 0 {
+		return s.config.MaxSecretSize
+	}
+	return DefaultMaxSecretSize
+}
+
+func validateSecretName(name string) error {
+	if !secretNamePattern.MatchString(name) || strings.HasSuffix(name, ".tmp") {
+		return fmt.Errorf("%w: %q", ErrInvalidSecretName, name)
+	}
+	return nil
+}
+
+// sizedReader fails unless the underlying reader yields exactly left more
+// bytes.
+type sizedReader struct {
+	r    io.Reader
+	left int64
+}
+
+func (r *sizedReader) Read(p []byte) (int, error) {
+	if r.left == 0 {
+		var probe [1]byte
+		if n, _ := io.ReadFull(r.r, probe[:]); n > 0 {
+			return 0, errors.New("secret is longer than its declared size")
+		}
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > r.left {
+		p = p[:r.left]
+	}
+	n, err := r.r.Read(p)
+	r.left -= int64(n)
+	if err == io.EOF && r.left > 0 {
+		return n, fmt.Errorf("secret is %d bytes shorter than its declared size: %w", r.left, io.ErrUnexpectedEOF)
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// secretsDir is next to the key file, which holds the rest of the data
+// that rarely changes.
+func (b *SplitFileBackend) secretsDir() string {
+	return b.key.path + secretsSuffix
+}
+
+func (b *SplitFileBackend) OpenSecret(name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(b.secretsDir(), name))
+}
+
+// PutSecret writes the secret to a temporary file renamed over the old one
+// once complete.
+func (b *SplitFileBackend) PutSecret(name string, r io.Reader) error {
+	if err := os.MkdirAll(b.secretsDir(), 0o700); err != nil {
+		return err
+	}
+	return writeAtomic(filepath.Join(b.secretsDir(), name), DefaultFileMode, func(w io.Writer) error {
+		_, err := io.Copy(w, r)
+		return err
+	})
+}
+
+func (b *SplitFileBackend) DeleteSecret(name string) error {
+	return os.Remove(filepath.Join(b.secretsDir(), name))
+}
+
+// SecretNames lists the secret files, leaving out temporary files of
+// writes in progress.
+func (b *SplitFileBackend) SecretNames() ([]string, error) {
+	entries, err := os.ReadDir(b.secretsDir())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && validateSecretName(e.Name()) == nil {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,301 @@
+package keystore_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/theblitlabs/keystore"
+)
+
+// secretBackends returns configurations for a backend that streams
+// secrets and for backends that keep them in the keystore document.
+func secretBackends(t *testing.T) map[string]keystore.Config {
+	return map[string]keystore.Config{
+		"split":  {DirPath: t.TempDir(), SplitFiles: true},
+		"file":   {DirPath: t.TempDir()},
+		"memory": {Backend: keystore.NewMemoryBackend()},
+	}
+}
+
+// secretValue returns n bytes that differ from one offset to the next.
+func secretValue(n int, seed byte) []byte {
+	v := make([]byte, n)
+	for i := range v {
+		v[i] = byte(i*7) + seed
+	}
+	return v
+}
+
+// readSecret returns the secret stored under name.
+func readSecret(t *testing.T, ks *keystore.Store, name string) []byte {
+	t.Helper()
+
+	rc, err := ks.OpenSecret(name)
+	if err != nil {
+		t.Fatalf("OpenSecret(%q): %v", name, err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("reading secret %q: %v", name, err)
+	}
+	return data
+}
+
+// failingReader yields data and then fails.
+type failingReader struct {
+	data []byte
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, errors.New("connection reset")
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// unreadReader fails the test if it is read.
+type unreadReader struct {
+	t *testing.T
+}
+
+func (r unreadReader) Read([]byte) (int, error) {
+	r.t.Error("an oversized secret was read")
+	return 0, io.EOF
+}
+
+func TestSecrets(t *testing.T) {
+	for name, cfg := range secretBackends(t) {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			ks := newErrorStore(t, cfg)
+			value := secretValue(200<<10, 1)
+			if err := ks.PutSecret("service-account.json", bytes.NewReader(value), int64(len(value))); err != nil {
+				t.Fatalf("PutSecret: %v", err)
+			}
+			if err := ks.PutSecret("empty", strings.NewReader(""), 0); err != nil {
+				t.Fatalf("PutSecret of an empty value: %v", err)
+			}
+			if got := readSecret(t, ks, "service-account.json"); !bytes.Equal(got, value) {
+				t.Fatalf("OpenSecret returned %d bytes, want the %d stored", len(got), len(value))
+			}
+			if got := readSecret(t, ks, "empty"); len(got) != 0 {
+				t.Fatalf("empty secret read back as %d bytes", len(got))
+			}
+
+			// Another Store on the keystore sees the same secrets, and a
+			// replaced value is read back in full.
+			other := newErrorStore(t, cfg)
+			replaced := secretValue(1000, 2)
+			if err := other.PutSecret("service-account.json", bytes.NewReader(replaced), int64(len(replaced))); err != nil {
+				t.Fatal(err)
+			}
+			if got := readSecret(t, ks, "service-account.json"); !bytes.Equal(got, replaced) {
+				t.Fatal("OpenSecret did not return the replaced value")
+			}
+
+			if names, err := ks.SecretNames(); err != nil || strings.Join(names, ",") != "empty,service-account.json" {
+				t.Fatalf("SecretNames = %v, %v", names, err)
+			}
+			if err := ks.DeleteSecret("empty"); err != nil {
+				t.Fatalf("DeleteSecret: %v", err)
+			}
+			if err := ks.DeleteSecret("empty"); !errors.Is(err, keystore.ErrNoSecret) {
+				t.Fatalf("DeleteSecret of a deleted secret: got %v, want ErrNoSecret", err)
+			}
+			if _, err := ks.OpenSecret("empty"); !errors.Is(err, keystore.ErrNoSecret) {
+				t.Fatalf("OpenSecret of a deleted secret: got %v, want ErrNoSecret", err)
+			}
+			if names, err := ks.SecretNames(); err != nil || len(names) != 1 {
+				t.Fatalf("SecretNames after deleting = %v, %v", names, err)
+			}
+
+			if err := ks.Destroy(); err != nil {
+				t.Fatal(err)
+			}
+			if names, err := newErrorStore(t, cfg).SecretNames(); err != nil || len(names) != 0 {
+				t.Fatalf("SecretNames after Destroy = %v, %v", names, err)
+			}
+		})
+	}
+}
+
+func TestSecretsStreamed(t *testing.T) {
+	dir := t.TempDir()
+	ks := newErrorStore(t, keystore.Config{DirPath: dir, SplitFiles: true})
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(dir, "key.json")
+	before, err := os.ReadFile(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	genBefore, err := ks.Generation()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The value goes to its own file; the keystore document is neither
+	// rewritten nor needed to read it.
+	value := secretValue(200<<10, 3)
+	if err := ks.PutSecret("chain.pem", bytes.NewReader(value), int64(len(value))); err != nil {
+		t.Fatal(err)
+	}
+	if after, err := os.ReadFile(keyPath); err != nil || !bytes.Equal(before, after) {
+		t.Fatalf("PutSecret rewrote the key file: %v", err)
+	}
+	stored, err := os.ReadFile(filepath.Join(keyPath+".secrets", "chain.pem"))
+	if err != nil || !bytes.Equal(stored, value) {
+		t.Fatalf("secret file holds %d bytes, %v, want the value", len(stored), err)
+	}
+	if err := os.Remove(keyPath); err != nil {
+		t.Fatal(err)
+	}
+	if got := readSecret(t, ks, "chain.pem"); !bytes.Equal(got, value) {
+		t.Fatal("OpenSecret did not stream the stored value")
+	}
+
+	// Readers watching the generation still see the change.
+	if gen, err := ks.Generation(); err != nil || gen <= genBefore {
+		t.Fatalf("Generation after PutSecret = %d, %v, want more than %d", gen, err, genBefore)
+	}
+}
+
+func TestSecretsFallback(t *testing.T) {
+	dir := t.TempDir()
+	ks := newErrorStore(t, keystore.Config{DirPath: dir})
+	value := []byte("certificate chain")
+	if err := ks.PutSecret("chain.pem", bytes.NewReader(value), int64(len(value))); err != nil {
+		t.Fatal(err)
+	}
+
+	// The single-file backend keeps the value in the document.
+	if _, err := os.Stat(filepath.Join(dir, keystore.DefaultFileName+".secrets")); !os.IsNotExist(err) {
+		t.Fatalf("single-file backend created a secrets directory: %v", err)
+	}
+	editKeystore(t, dir, func(doc map[string]any) {
+		secrets, _ := doc["secrets"].(map[string]any)
+		if secrets["chain.pem"] == nil {
+			t.Fatalf("keystore document has no secret: %v", doc["secrets"])
+		}
+		secrets["chain.pem"] = "not base64!"
+	})
+	if _, err := newErrorStore(t, keystore.Config{DirPath: dir}).OpenSecret("chain.pem"); err == nil {
+		t.Fatal("OpenSecret of a damaged value succeeded")
+	}
+}
+
+func TestSecretsFailedWrites(t *testing.T) {
+	for name, cfg := range secretBackends(t) {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			ks := newErrorStore(t, cfg)
+			old := secretValue(4096, 4)
+			if err := ks.PutSecret("blob", bytes.NewReader(old), int64(len(old))); err != nil {
+				t.Fatal(err)
+			}
+			value := secretValue(8192, 5)
+
+			for _, w := range []struct {
+				name string
+				r    io.Reader
+				size int64
+			}{
+				{"reader failing halfway", &failingReader{data: value[:4096]}, int64(len(value))},
+				{"short reader", bytes.NewReader(value[:100]), int64(len(value))},
+				{"long reader", bytes.NewReader(value), 100},
+			} {
+				if err := ks.PutSecret("blob", w.r, w.size); err == nil {
+					t.Fatalf("PutSecret with a %s succeeded", w.name)
+				}
+				// Neither this Store nor another sees a partial value.
+				for _, reader := range []*keystore.Store{ks, newErrorStore(t, cfg)} {
+					if got := readSecret(t, reader, "blob"); !bytes.Equal(got, old) {
+						t.Fatalf("after a %s, the secret is %d bytes, want the old %d", w.name, len(got), len(old))
+					}
+				}
+				if names, err := ks.SecretNames(); err != nil || len(names) != 1 || names[0] != "blob" {
+					t.Fatalf("after a %s, SecretNames = %v, %v", w.name, names, err)
+				}
+			}
+
+			// A failed first write leaves no secret at all.
+			if err := ks.PutSecret("new", &failingReader{data: value[:10]}, 20); err == nil {
+				t.Fatal("PutSecret with a failing reader succeeded")
+			}
+			if _, err := ks.OpenSecret("new"); !errors.Is(err, keystore.ErrNoSecret) {
+				t.Fatalf("OpenSecret after a failed first write: got %v, want ErrNoSecret", err)
+			}
+
+			if cfg.SplitFiles {
+				entries, err := os.ReadDir(filepath.Join(cfg.DirPath, "key.json.secrets"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, e := range entries {
+					if e.Name() != "blob" {
+						t.Errorf("failed writes left %s behind", e.Name())
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSecretsLimits(t *testing.T) {
+	for name, cfg := range secretBackends(t) {
+		cfg := cfg
+		cfg.MaxSecretSize = 1024
+		t.Run(name, func(t *testing.T) {
+			ks := newErrorStore(t, cfg)
+			if err := ks.PutSecret("big", unreadReader{t}, 1025); !errors.Is(err, keystore.ErrSecretTooLarge) {
+				t.Fatalf("PutSecret over the limit: got %v, want ErrSecretTooLarge", err)
+			}
+			if err := ks.PutSecret("big", bytes.NewReader(secretValue(1024, 6)), 1024); err != nil {
+				t.Fatalf("PutSecret at the limit: %v", err)
+			}
+			if err := ks.PutSecret("negative", unreadReader{t}, -1); !errors.Is(err, keystore.ErrInvalidSecretSize) {
+				t.Fatalf("PutSecret with a negative size: got %v, want ErrInvalidSecretSize", err)
+			}
+
+			// A reader may not exceed the limit by lying about its size.
+			if err := ks.PutSecret("liar", bytes.NewReader(secretValue(2048, 7)), 10); err == nil {
+				t.Fatal("PutSecret of more bytes than declared succeeded")
+			}
+			if _, err := ks.OpenSecret("liar"); !errors.Is(err, keystore.ErrNoSecret) {
+				t.Fatalf("OpenSecret of a rejected secret: got %v, want ErrNoSecret", err)
+			}
+		})
+	}
+
+	ks := newErrorStore(t, keystore.Config{})
+	if err := ks.PutSecret("default", unreadReader{t}, keystore.DefaultMaxSecretSize+1); !errors.Is(err, keystore.ErrSecretTooLarge) {
+		t.Fatalf("PutSecret over the default limit: got %v, want ErrSecretTooLarge", err)
+	}
+}
+
+func TestSecretNamesInvalid(t *testing.T) {
+	ks := newErrorStore(t, keystore.Config{SplitFiles: true})
+	for _, name := range []string{"", ".hidden", "../escape", "a/b", "write.tmp", strings.Repeat("a", 129), "spaced name"} {
+		if err := ks.PutSecret(name, strings.NewReader("x"), 1); !errors.Is(err, keystore.ErrInvalidSecretName) {
+			t.Errorf("PutSecret(%q): got %v, want ErrInvalidSecretName", name, err)
+		}
+		if _, err := ks.OpenSecret(name); !errors.Is(err, keystore.ErrInvalidSecretName) {
+			t.Errorf("OpenSecret(%q): got %v, want ErrInvalidSecretName", name, err)
+		}
+		if err := ks.DeleteSecret(name); !errors.Is(err, keystore.ErrInvalidSecretName) {
+			t.Errorf("DeleteSecret(%q): got %v, want ErrInvalidSecretName", name, err)
+		}
+	}
+	if err := ks.PutSecret(strings.Repeat("a", 128), strings.NewReader("x"), 1); err != nil {
+		t.Fatalf("PutSecret with the longest name: %v", err)
+	}
+}
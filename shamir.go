@@ -0,0 +1,114 @@
+package keystore
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// maxShares is the largest number of shares splitSecret produces, since
+// share x coordinates are the non-zero elements of GF(256).
+const maxShares = 255
+
+// gfExp and gfLog are exponent and logarithm tables for GF(256) with the
+// AES polynomial x^8 + x^4 + x^3 + x + 1 and generator 3.
+var gfExp, gfLog = gfTables()
+
+func gfTables() (exp [510]byte, log [256]byte) {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		exp[i] = x
+		exp[i+255] = x
+		log[x] = byte(i)
+		x ^= gfDouble(x)
+	}
+	return exp, log
+}
+
+func gfDouble(x byte) byte {
+	if x&0x80 != 0 {
+		return x<<1 ^ 0x1b
+	}
+	return x << 1
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+255-int(gfLog[b])]
+}
+
+// splitSecret splits secret into n Shamir shares, any threshold of which
+// recover it. Each share is its x coordinate followed by one y byte per
+// secret byte.
+func splitSecret(secret []byte, n, threshold int) ([][]byte, error) {
+	if threshold < 2 || threshold > n || n > maxShares {
+		return nil, fmt.Errorf("%w: threshold %d of %d", ErrInvalidShare, threshold, n)
+	}
+
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, 1+len(secret))
+		shares[i][0] = byte(i + 1)
+	}
+
+	coeffs := make([]byte, threshold)
+	defer wipe(coeffs)
+	for j, b := range secret {
+		coeffs[0] = b
+		if _, err := rand.Read(coeffs[1:]); err != nil {
+			return nil, fmt.Errorf("failed to generate shares: %w", err)
+		}
+		for _, share := range shares {
+			x, y := share[0], byte(0)
+			for k := threshold - 1; k >= 0; k-- {
+				y = gfMul(y, x) ^ coeffs[k]
+			}
+			share[1+j] = y
+		}
+	}
+
+	return shares, nil
+}
+
+// combineShares recovers a secret from shares produced by splitSecret by
+// Lagrange interpolation at zero. It cannot tell whether enough shares were
+// given; callers verify the result.
+func combineShares(shares [][]byte) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, errors.New("no shares")
+	}
+
+	size := len(shares[0])
+	seen := make(map[byte]bool, len(shares))
+	for _, share := range shares {
+		if len(share) != size || size < 2 || share[0] == 0 || seen[share[0]] {
+			return nil, errors.New("malformed shares")
+		}
+		seen[share[0]] = true
+	}
+
+	secret := make([]byte, size-1)
+	for i, share := range shares {
+		// basis is the Lagrange basis polynomial for share i evaluated at 0.
+		basis := byte(1)
+		for j, other := range shares {
+			if i != j {
+				basis = gfMul(basis, gfDiv(other[0], other[0]^share[0]))
+			}
+		}
+		for k := range secret {
+			secret[k] ^= gfMul(share[1+k], basis)
+		}
+	}
+
+	return secret, nil
+}
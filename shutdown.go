@@ -0,0 +1,79 @@
+package keystore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// shutdownSignals are the signals that trigger the wipe installed by
+// RegisterShutdownWipe.
+var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// RegisterShutdownWipe wipes the in-memory secrets of s when the process
+// receives SIGINT or SIGTERM, so that decrypted keys do not end up in a
+// core dump taken while the process exits. With Config.DisableCoreDumps,
+// core dumps are also disabled for the whole process; this is only
+// supported on Unix.
+//
+// The returned context is done once the wipe has run, or when ctx is done,
+// which also removes the handler. Like signal.NotifyContext, the handler
+// keeps the signals from terminating the process: the application should
+// shut down when the returned context is done. Handlers the application
+// installs with signal.Notify still receive the signals.
+//
+// The wipe clears the same state as Lock and Close: cached keys are zeroed,
+// including keys previously returned by LoadPrivateKey, and passphrases,
+// reconstructed shares and batch signers are dropped. Using s afterwards
+// reloads from storage. RegisterShutdownWipe may be called more than once.
+func (s *Store) RegisterShutdownWipe(ctx context.Context) (context.Context, error) {
+	if s.config.DisableCoreDumps {
+		if err := disableCoreDumps(); err != nil {
+			return nil, fmt.Errorf("failed to disable core dumps: %w", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, shutdownSignals...)
+
+	go func() {
+		defer signal.Stop(sig)
+		defer cancel()
+
+		select {
+		case got := <-sig:
+			s.config.Logger.Info("keystore: wiping secrets on shutdown", "signal", got.String())
+			s.WipeSecrets()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, nil
+}
+
+// WipeSecrets zeroes cached keys and drops the secrets s holds in memory,
+// as RegisterShutdownWipe does on a signal. Keys and tokens sourced from
+// systemd credentials or the environment are kept, since they cannot be
+// read again. The persisted keystore is untouched and is reloaded if s is
+// used again.
+func (s *Store) WipeSecrets() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cache != nil {
+		wipeECDSA(s.cache.key)
+		s.cache = nil
+	}
+	s.unlocked = nil
+	s.shareKey = nil
+	s.authorizedUntil = time.Time{}
+	s.exportTickets = nil
+	s.closeSigners()
+	s.wipeCeremony()
+	s.resetUnlocks()
+	s.reset()
+	s.updateGauges()
+}
@@ -0,0 +1,80 @@
+package keystore_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/theblitlabs/keystore"
+)
+
+func TestWipeSecrets(t *testing.T) {
+	ks, err := keystore.NewKeystore(keystore.Config{DirPath: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	key, err := ks.LoadPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sg, err := ks.BatchSigner(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ks.WipeSecrets()
+
+	if key.D.Sign() != 0 {
+		t.Fatal("WipeSecrets left the loaded key in memory")
+	}
+	if _, err := sg.SignDigests([][]byte{crypto.Keccak256([]byte("wiped"))}); !errors.Is(err, keystore.ErrSignerClosed) {
+		t.Fatalf("batch signer after WipeSecrets: got %v, want ErrSignerClosed", err)
+	}
+
+	// The persisted keystore is untouched and loads again.
+	again, err := ks.LoadPrivateKey()
+	if err != nil || hexKey(again) != fileKeyHex {
+		t.Fatalf("LoadPrivateKey after WipeSecrets: %v", err)
+	}
+}
+
+func TestRegisterShutdownWipeContext(t *testing.T) {
+	ks, err := keystore.NewKeystore(keystore.Config{DirPath: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	key, err := ks.LoadPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Canceling the parent removes the handler without wiping.
+	ctx, cancel := context.WithCancel(context.Background())
+	first, err := ks.RegisterShutdownWipe(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := ks.RegisterShutdownWipe(ctx)
+	if err != nil {
+		t.Fatalf("registering twice: %v", err)
+	}
+	cancel()
+	for _, done := range []context.Context{first, second} {
+		select {
+		case <-done.Done():
+		case <-time.After(time.Second):
+			t.Fatal("handler context not done after canceling its parent")
+		}
+	}
+	if key.D.Sign() == 0 {
+		t.Fatal("canceling the context wiped the key")
+	}
+}
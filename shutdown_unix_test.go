@@ -0,0 +1,122 @@
+//go:build unix
+
+package keystore_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/theblitlabs/keystore"
+)
+
+// shutdownDirEnv tells TestShutdownWipeHelperProcess where its keystore is.
+const shutdownDirEnv = "KEYSTORE_TEST_SHUTDOWN_DIR"
+
+func TestShutdownWipeHelperProcess(t *testing.T) {
+	dir := os.Getenv(shutdownDirEnv)
+	if dir == "" {
+		t.Skip("run by TestShutdownWipeOnSignal")
+	}
+
+	ks, err := keystore.NewKeystore(keystore.Config{DirPath: dir, DisableCoreDumps: true, Logger: discardLogger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ks.LoadPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The application's own handler still sees the signal.
+	app := make(chan os.Signal, 1)
+	signal.Notify(app, syscall.SIGTERM)
+
+	if _, err := ks.RegisterShutdownWipe(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	done, err := ks.RegisterShutdownWipe(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var core syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_CORE, &core); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Printf("shutdown ready core=%d\n", core.Cur)
+
+	<-done.Done()
+	got := <-app
+	fmt.Printf("shutdown done wiped=%v app=%v\n", key.D.Sign() == 0, got == syscall.SIGTERM)
+}
+
+func TestShutdownWipeOnSignal(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts a child process")
+	}
+
+	dir := t.TempDir()
+	ks, err := keystore.NewKeystore(keystore.Config{DirPath: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestShutdownWipeHelperProcess$", "-test.v")
+	cmd.Env = append(os.Environ(), shutdownDirEnv+"="+dir)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			if line, ok := strings.CutPrefix(scanner.Text(), "shutdown "); ok {
+				lines <- line
+			}
+		}
+	}()
+	next := func() string {
+		t.Helper()
+		select {
+		case line := <-lines:
+			return line
+		case <-time.After(10 * time.Second):
+			cmd.Process.Kill()
+			t.Fatal("child process did not report")
+		}
+		return ""
+	}
+
+	if line := next(); line != "ready core=0" {
+		t.Fatalf("child reported %q, want core dumps disabled", line)
+	}
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	if line := next(); line != "done wiped=true app=true" {
+		t.Fatalf("child reported %q after SIGTERM", line)
+	}
+	for range lines {
+	}
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("child process: %v", err)
+	}
+}
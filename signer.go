@@ -0,0 +1,105 @@
+package keystore
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"fmt"
+
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+)
+
+// ExternalSigner signs with a key held outside the keystore, such as on a
+// hardware token. Only the public key is ever visible to this package.
+type ExternalSigner interface {
+	Public() crypto.PublicKey
+	SignDigest(digest []byte) ([]byte, error)
+}
+
+// ExternalKeyRef is the persisted reference to a key held by an external
+// signer. It carries no secret material.
+type ExternalKeyRef struct {
+	Type      string `json:"type"`
+	ID        string `json:"id"`
+	PublicKey string `json:"public_key"`
+}
+
+// SignDigest signs a digest with Config.Signer if one is configured,
+// otherwise with the primary key. Primary key signatures are 65-byte
+// secp256k1 [R || S || V] signatures; external signatures are in the
+// signer's own format. A primary key for encryption only fails with
+// ErrWrongKeyPurpose.
+func (s *Store) SignDigest(digest []byte) (sig []byte, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer func() { s.audit(AuditSign, "", err) }()
+
+	if err := s.authorized(AuthSignDigest); err != nil {
+		return nil, err
+	}
+
+	if s.config.Signer != nil {
+		if err := s.checkFrozen(); err != nil {
+			return nil, err
+		}
+		if err := s.checkLease(); err != nil {
+			return nil, err
+		}
+		return s.config.Signer.SignDigest(digest)
+	}
+
+	key, _, err := s.primaryKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkSigningKey(""); err != nil {
+		return nil, err
+	}
+	if err := s.allowDigests(""); err != nil {
+		return nil, err
+	}
+	return ethcrypto.Sign(digest, key)
+}
+
+// ExternalKey returns the reference to the external key recorded in the
+// keystore, or nil if there is none.
+func (s *Store) ExternalKey() (*ExternalKeyRef, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	if s.External == nil {
+		return nil, nil
+	}
+	ref := *s.External
+	return &ref, nil
+}
+
+// saveExternalKey records a reference to a key held by an external signer.
+func (s *Store) saveExternalKey(typ, id string, pub crypto.PublicKey) error {
+	encoded, err := encodePublicKey(pub)
+	if err != nil {
+		return err
+	}
+
+	return s.update(func() error {
+		s.External = &ExternalKeyRef{Type: typ, ID: id, PublicKey: encoded}
+		return nil
+	})
+}
+
+func encodePublicKey(pub crypto.PublicKey) (string, error) {
+	ec, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return "", fmt.Errorf("%w: unsupported key type %T", ErrInvalidPublicKey, pub)
+	}
+
+	data, err := ec.ECDH()
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidPublicKey, err)
+	}
+	return hex.EncodeToString(data.Bytes()), nil
+}
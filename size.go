@@ -0,0 +1,153 @@
+package keystore
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// largestSectionsReported is how many sections ErrKeystoreTooLarge and the
+// size warning name.
+const largestSectionsReported = 3
+
+// SectionSize is the serialized size of one top-level field of the
+// keystore document, such as "accounts" or "trash".
+type SectionSize struct {
+	Name  string `json:"name"`
+	Bytes int64  `json:"bytes"`
+}
+
+// CompactReport lists what Compact removed and the size of the keystore
+// file before and after.
+type CompactReport struct {
+	Removed    []PruneEntry `json:"removed"`
+	SizeBefore int64        `json:"size_before"`
+	SizeAfter  int64        `json:"size_after"`
+}
+
+// Compact drops the data that can be pruned so that saves stay under
+// Config.MaxFileSize: expired tokens, accounts in the trash past
+// Config.TrashRetention, empty maps and signing policy usage that has left
+// its window. The keystore is rewritten even if nothing was removed, and
+// backups beyond Config.BackupRetain or Config.BackupMaxAge are deleted.
+// Unlike Prune, expired tokens get no grace period. If the result is still
+// over the limit, the save fails with ErrKeystoreTooLarge and nothing is
+// written.
+func (s *Store) Compact() (CompactReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := CompactReport{Removed: []PruneEntry{}}
+
+	if err := s.load(); err != nil {
+		return report, err
+	}
+	report.SizeBefore = s.fileSize
+
+	err := s.update(func() error {
+		report.Removed = s.prune(PrunePolicy{}, true)
+		if s.Policy != nil {
+			s.pruneUsage(s.now())
+		} else if s.PolicyUsage != nil {
+			report.Removed = append(report.Removed, PruneEntry{Item: "policy_usage", Reason: "no signing policy"})
+			s.PolicyUsage = nil
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+	report.SizeAfter = s.fileSize
+
+	if s.backupsEnabled() {
+		s.pruneBackups()
+	}
+	return report, nil
+}
+
+// checkFileSize fails with ErrKeystoreTooLarge if data, about to be
+// written, exceeds Config.MaxFileSize, naming the largest sections.
+func (s *Store) checkFileSize(data []byte) error {
+	max := s.maxFileSize()
+	if int64(len(data)) <= max {
+		return nil
+	}
+
+	var largest string
+	if sections, err := s.sections(); err == nil && len(sections) > 0 {
+		if len(sections) > largestSectionsReported {
+			sections = sections[:largestSectionsReported]
+		}
+		names := make([]string, len(sections))
+		for i, sec := range sections {
+			names[i] = fmt.Sprintf("%s (%d bytes)", sec.Name, sec.Bytes)
+		}
+		largest = "; largest sections: " + strings.Join(names, ", ")
+	}
+	return fmt.Errorf("%w: saving %d bytes, limit %d%s", ErrKeystoreTooLarge, len(data), max, largest)
+}
+
+// noteFileSize records the size of the keystore as last read or written,
+// warning once it passes Config.FileSizeWarning.
+func (s *Store) noteFileSize(size int64, saved bool) {
+	s.fileSize = size
+	if s.stats != nil {
+		s.stats.fileSize.Store(size)
+	}
+
+	threshold := s.fileSizeWarning()
+	if !saved || threshold <= 0 || size <= threshold {
+		return
+	}
+
+	sections, _ := s.sections()
+	largest := sections
+	if len(largest) > largestSectionsReported {
+		largest = largest[:largestSectionsReported]
+	}
+	s.config.Logger.Warn("keystore: file is approaching its size limit",
+		"location", s.location(), "size", size, "limit", s.maxFileSize(), "largest_sections", largest)
+	if s.config.OnSizeWarning != nil {
+		s.config.OnSizeWarning(size, sections)
+	}
+}
+
+func (s *Store) fileSizeWarning() int64 {
+	switch {
+	case s.config.FileSizeWarning < 0:
+		return 0
+	case s.config.FileSizeWarning == 0:
+		return s.maxFileSize() / 4 * 3
+	default:
+		return s.config.FileSizeWarning
+	}
+}
+
+// sections returns the serialized size of each top-level field of the
+// in-memory keystore, largest first.
+func (s *Store) sections() ([]SectionSize, error) {
+	data, err := json.Marshal((*storeJSON)(s))
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(data)
+
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	sections := make([]SectionSize, 0, len(doc))
+	for name, raw := range doc {
+		sections = append(sections, SectionSize{Name: name, Bytes: int64(len(raw))})
+		wipe(raw)
+	}
+	sort.Slice(sections, func(i, j int) bool {
+		if sections[i].Bytes != sections[j].Bytes {
+			return sections[i].Bytes > sections[j].Bytes
+		}
+		return sections[i].Name < sections[j].Name
+	})
+	return sections, nil
+}
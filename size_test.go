@@ -0,0 +1,191 @@
+package keystore_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/theblitlabs/keystore"
+)
+
+const sizeLimit = 4 << 10
+
+// fillAccounts saves generated accounts until a save fails, and returns
+// their names and the error that stopped it.
+func fillAccounts(t *testing.T, ks *keystore.Store) ([]string, error) {
+	t.Helper()
+
+	var names []string
+	for i := 0; i < 1000; i++ {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := fmt.Sprintf("account-%03d", i)
+		if err := ks.SaveAccount(name, hexKey(key)); err != nil {
+			return names, err
+		}
+		names = append(names, name)
+	}
+	t.Fatal("the size limit was never reached")
+	return nil, nil
+}
+
+func TestStatusFileSize(t *testing.T) {
+	ks := newErrorStore(t, keystore.Config{})
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveAccount("ops", credentialKeyHex); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := ks.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(ks.Dir(), keystore.DefaultFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.FileSize != info.Size() {
+		t.Fatalf("FileSize = %d, want %d", st.FileSize, info.Size())
+	}
+
+	if len(st.Sections) == 0 || st.Sections[0].Name != "accounts" {
+		t.Fatalf("Sections = %+v, want accounts first", st.Sections)
+	}
+	for i := 1; i < len(st.Sections); i++ {
+		if st.Sections[i].Bytes > st.Sections[i-1].Bytes {
+			t.Fatalf("Sections not sorted largest first: %+v", st.Sections)
+		}
+	}
+}
+
+func TestMaxFileSize(t *testing.T) {
+	dir := t.TempDir()
+	cfg := keystore.Config{DirPath: dir, MaxFileSize: sizeLimit, FileSizeWarning: -1}
+	ks := newErrorStore(t, cfg)
+
+	names, err := fillAccounts(t, ks)
+	if !errors.Is(err, keystore.ErrKeystoreTooLarge) {
+		t.Fatalf("save over the limit: got %v, want ErrKeystoreTooLarge", err)
+	}
+	if !strings.Contains(err.Error(), "accounts (") {
+		t.Fatalf("error %q does not name the accounts section", err)
+	}
+
+	// The refused save wrote nothing, and the keystore still loads.
+	info, err := os.Stat(filepath.Join(dir, keystore.DefaultFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() > sizeLimit {
+		t.Fatalf("keystore is %d bytes, over the %d byte limit", info.Size(), sizeLimit)
+	}
+	accounts, err := newErrorStore(t, cfg).ListAccounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != len(names) {
+		t.Fatalf("%d accounts on disk, want the %d saved", len(accounts), len(names))
+	}
+}
+
+func TestFileSizeWarning(t *testing.T) {
+	var warnings []int64
+	ks := newErrorStore(t, keystore.Config{
+		MaxFileSize:     sizeLimit,
+		FileSizeWarning: sizeLimit / 2,
+		OnSizeWarning: func(size int64, sections []keystore.SectionSize) {
+			if len(sections) == 0 {
+				t.Error("OnSizeWarning without sections")
+			}
+			warnings = append(warnings, size)
+		},
+	})
+
+	if err := ks.SaveToken("token"); err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 0 {
+		t.Fatalf("warned at %v, below the threshold", warnings)
+	}
+
+	if _, err := fillAccounts(t, ks); !errors.Is(err, keystore.ErrKeystoreTooLarge) {
+		t.Fatal(err)
+	}
+	if len(warnings) == 0 {
+		t.Fatal("no warning before reaching the limit")
+	}
+	for _, size := range warnings {
+		if size <= sizeLimit/2 || size > sizeLimit {
+			t.Fatalf("warned at %d bytes, want between %d and %d", size, sizeLimit/2, sizeLimit)
+		}
+	}
+}
+
+func TestCompact(t *testing.T) {
+	clock := newTestClock(epoch)
+	cfg := clock.config(keystore.Config{
+		MaxFileSize:     sizeLimit,
+		FileSizeWarning: -1,
+		TrashRetention:  time.Hour,
+	})
+	ks := newErrorStore(t, cfg)
+	if err := ks.SaveTokenWithExpiry("token", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	// Deleted accounts stay in the trash, so deleting frees no space
+	// until the retention has passed and Compact purges them.
+	var trashed []string
+	for i := 0; i < 6; i++ {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := fmt.Sprintf("trashed-%d", i)
+		if err := ks.SaveAccount(name, hexKey(key)); err != nil {
+			t.Fatal(err)
+		}
+		if err := ks.DeleteAccount(name); err != nil {
+			t.Fatal(err)
+		}
+		trashed = append(trashed, name)
+	}
+	if _, err := fillAccounts(t, ks); !errors.Is(err, keystore.ErrKeystoreTooLarge) {
+		t.Fatal(err)
+	}
+	if err := ks.SaveAccount("late", credentialKeyHex); !errors.Is(err, keystore.ErrKeystoreTooLarge) {
+		t.Fatalf("save at the limit: got %v, want ErrKeystoreTooLarge", err)
+	}
+
+	clock.Advance(2 * time.Hour)
+	report, err := ks.Compact()
+	if err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	if report.SizeAfter >= report.SizeBefore {
+		t.Fatalf("Compact went from %d to %d bytes", report.SizeBefore, report.SizeAfter)
+	}
+	removed := map[string]bool{}
+	for _, e := range report.Removed {
+		removed[e.Item] = true
+	}
+	if !removed["auth_token"] || !removed["trash:"+trashed[0]] || len(report.Removed) != len(trashed)+1 {
+		t.Fatalf("Compact removed %+v, want the expired token and every trashed account", report.Removed)
+	}
+
+	if err := ks.SaveAccount("late", credentialKeyHex); err != nil {
+		t.Fatalf("save after Compact: %v", err)
+	}
+	if st, err := ks.Status(); err != nil || st.FileSize > sizeLimit {
+		t.Fatalf("Status after Compact = %d bytes, %v", st.FileSize, err)
+	}
+}
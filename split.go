@@ -0,0 +1,275 @@
+package keystore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// DefaultKeyFileName is the file holding keys in split mode
+	DefaultKeyFileName = "key.json"
+
+	// DefaultTokenFileName is the file holding the auth token in split mode
+	DefaultTokenFileName = "token.json"
+)
+
+// tokenFields are the top-level keystore fields written to the token file in
+// split mode. saved_at and revision live there too so that token refreshes
+// leave the key file untouched.
+var tokenFields = map[string]bool{
+	"auth_token":      true,
+	"encrypted_token": true,
+	"created_at":      true,
+	"expires_at":      true,
+	"token_device":    true,
+	"token_salt":      true,
+	"token_binding":   true,
+	"saved_at":        true,
+	"revision":        true,
+}
+
+// SplitFileBackend stores the auth token and the keys in two separate files,
+// so the rarely changing key file can be backed up independently of the
+// frequently refreshed token. Either file may be absent.
+type SplitFileBackend struct {
+	key    *FileBackend
+	token  *FileBackend
+	legacy *FileBackend
+}
+
+func NewSplitFileBackend(keyPath, tokenPath string) *SplitFileBackend {
+	return &SplitFileBackend{key: NewFileBackend(keyPath), token: NewFileBackend(tokenPath)}
+}
+
+func (b *SplitFileBackend) String() string {
+	return b.key.path + " and " + b.token.path
+}
+
+// KeyPath returns the path of the key file.
+func (b *SplitFileBackend) KeyPath() string {
+	return b.key.path
+}
+
+// TokenPath returns the path of the token file.
+func (b *SplitFileBackend) TokenPath() string {
+	return b.token.path
+}
+
+func (b *SplitFileBackend) Read() ([]byte, error) {
+	return b.read(func(f *FileBackend) ([]byte, error) { return f.Read() })
+}
+
+func (b *SplitFileBackend) readLimited(max int64) ([]byte, error) {
+	return b.read(func(f *FileBackend) ([]byte, error) { return f.readLimited(max) })
+}
+
+// read merges both files into a single document. Until the first write,
+// a combined keystore file written before split mode was enabled is read
+// instead.
+func (b *SplitFileBackend) read(readFile func(*FileBackend) ([]byte, error)) ([]byte, error) {
+	keyData, err := readFile(b.key)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	tokenData, terr := readFile(b.token)
+	if terr != nil && !errors.Is(terr, fs.ErrNotExist) {
+		return nil, terr
+	}
+
+	if keyData == nil && tokenData == nil {
+		if b.legacy != nil {
+			return readFile(b.legacy)
+		}
+		return nil, fmt.Errorf("split keystore files are missing: %w", fs.ErrNotExist)
+	}
+
+	doc := make(map[string]json.RawMessage)
+	for _, data := range [][]byte{keyData, tokenData} {
+		if data == nil {
+			continue
+		}
+		var part map[string]json.RawMessage
+		if err := json.Unmarshal(data, &part); err != nil {
+			return nil, fmt.Errorf("failed to parse split keystore file: %w", err)
+		}
+		for k, v := range part {
+			doc[k] = v
+		}
+	}
+
+	return json.Marshal(doc)
+}
+
+// Write stores the token fields and everything else in their own files.
+// A file whose contents are unchanged is not rewritten.
+func (b *SplitFileBackend) Write(data []byte) error {
+	keyPart, tokenPart, err := splitDocument(data)
+	if err != nil {
+		return err
+	}
+
+	for _, part := range []struct {
+		file   *FileBackend
+		fields map[string]json.RawMessage
+	}{{b.key, keyPart}, {b.token, tokenPart}} {
+		if err := writePart(part.file, part.fields); err != nil {
+			return err
+		}
+	}
+
+	if b.legacy != nil {
+		if err := b.legacy.Remove(); err != nil {
+			return fmt.Errorf("failed to remove combined keystore file: %w", err)
+		}
+		b.legacy = nil
+	}
+
+	return nil
+}
+
+// writeScope writes only the file holding the fields in scope.
+func (b *SplitFileBackend) writeScope(scope lockScope, data []byte) error {
+	if scope == scopeStore || b.legacy != nil {
+		return b.Write(data)
+	}
+
+	keyPart, tokenPart, err := splitDocument(data)
+	if err != nil {
+		return err
+	}
+	if scope == scopeToken {
+		return writePart(b.token, tokenPart)
+	}
+	return writePart(b.key, keyPart)
+}
+
+// splitDocument divides a keystore document into its key and token parts.
+// The format header and schema version are copied to both.
+func splitDocument(data []byte) (keyPart, tokenPart map[string]json.RawMessage, err error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("failed to split keystore: %w", err)
+	}
+
+	keyPart = make(map[string]json.RawMessage)
+	tokenPart = make(map[string]json.RawMessage)
+	for k, v := range doc {
+		if tokenFields[k] {
+			tokenPart[k] = v
+		} else {
+			keyPart[k] = v
+		}
+	}
+	for _, k := range []string{"_format", "version"} {
+		if v, ok := doc[k]; ok {
+			tokenPart[k] = v
+		}
+	}
+	return keyPart, tokenPart, nil
+}
+
+// splitBackend builds the backend used when Config.SplitFiles is set.
+func (s *Store) splitBackend() *SplitFileBackend {
+	keyName, tokenName := s.config.KeyFileName, s.config.TokenFileName
+	if keyName == "" {
+		keyName = DefaultKeyFileName
+	}
+	if tokenName == "" {
+		tokenName = DefaultTokenFileName
+	}
+
+	b := NewSplitFileBackend(filepath.Join(s.config.DirPath, keyName), filepath.Join(s.config.DirPath, tokenName))
+	if _, err := os.Stat(s.path()); err == nil {
+		b.legacy = NewFileBackend(s.path())
+	}
+	return b
+}
+
+// writePart writes fields in the canonical form, so that each file is as
+// reproducible as a combined keystore file.
+func writePart(file *FileBackend, fields map[string]json.RawMessage) error {
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	defer wipe(raw)
+
+	data, err := Canonicalize(raw)
+	if err != nil {
+		return err
+	}
+
+	if current, err := file.Read(); err == nil && bytes.Equal(current, data) {
+		return nil
+	}
+
+	return file.Write(data)
+}
+
+func (b *SplitFileBackend) Remove() error {
+	for _, f := range []*FileBackend{b.key, b.token, b.legacy} {
+		if f == nil {
+			continue
+		}
+		if err := f.Remove(); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(b.secretsDir())
+}
+
+// stamp tracks the key file only, since the parsed key cache does not depend
+// on the token. The generation counts token writes too and is left out.
+func (b *SplitFileBackend) stamp() (backendStamp, error) {
+	return b.key.fileStamp()
+}
+
+// lockScope reports the requested scope, since each file has its own lock,
+// except while a combined keystore file remains: the first write replaces
+// it with both files and so needs both locks.
+func (b *SplitFileBackend) lockScope(scope lockScope) lockScope {
+	if b.legacy != nil {
+		return scopeStore
+	}
+	return scope
+}
+
+// acquireLock takes the lock of the token file, the key file or, for the
+// whole store, both: the key file's first, then the token file's, an order
+// every writer follows so that none can deadlock another.
+func (b *SplitFileBackend) acquireLock(scope lockScope, timeout time.Duration) (func(), error) {
+	switch scope {
+	case scopeToken:
+		return b.token.acquireLock(scope, timeout)
+	case scopeKey:
+		return b.key.acquireLock(scope, timeout)
+	}
+
+	releaseKey, err := b.key.acquireLock(scope, timeout)
+	if err != nil {
+		return nil, err
+	}
+	releaseToken, err := b.token.acquireLock(scope, timeout)
+	if err != nil {
+		releaseKey()
+		return nil, err
+	}
+	return func() {
+		releaseToken()
+		releaseKey()
+	}, nil
+}
+
+// fileInfoPath returns the file described by Store.FileInfo.
+func (b *SplitFileBackend) fileInfoPath() string {
+	if _, err := os.Stat(b.key.path); err != nil && b.legacy != nil {
+		return b.legacy.path
+	}
+	return b.key.path
+}
@@ -0,0 +1,169 @@
+package keystore_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/theblitlabs/keystore"
+)
+
+// TestSplitFilesMixedOperations runs token, key and whole-store writes and
+// reads from several Stores sharing one split keystore. Each Store has its
+// own in-process mutex, so they contend only on the lock files, as
+// separate processes would.
+func TestSplitFilesMixedOperations(t *testing.T) {
+	const (
+		stores = 4
+		rounds = 8
+	)
+	dir := t.TempDir()
+	open := func() *keystore.Store {
+		ks, err := keystore.NewKeystore(keystore.Config{DirPath: dir, SplitFiles: true, Logger: discardLogger})
+		if err != nil {
+			t.Fatalf("NewKeystore: %v", err)
+		}
+		return ks
+	}
+	if err := open().SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, stores*4*rounds)
+	for i := 0; i < stores; i++ {
+		i, ks := i, open()
+		workers := []func(j int) error{
+			func(j int) error { return ks.SaveToken(fmt.Sprintf("token-%d-%d", i, j)) },
+			func(j int) error { return ks.SaveAccount(fmt.Sprintf("key-%d-%d", i, j), fileKeyHex) },
+			func(j int) error {
+				return ks.SaveWatchAddress(fmt.Sprintf("watch-%d-%d", i, j), common.BigToAddress(common.Big1))
+			},
+			func(int) error {
+				if _, err := ks.LoadPrivateKey(); err != nil {
+					return err
+				}
+				_, err := ks.LoadToken()
+				if err == keystore.ErrNoToken {
+					err = nil
+				}
+				return err
+			},
+		}
+		for _, work := range workers {
+			wg.Add(1)
+			go func(work func(int) error) {
+				defer wg.Done()
+				for j := 0; j < rounds; j++ {
+					if err := work(j); err != nil {
+						errs <- err
+					}
+				}
+			}(work)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Minute):
+		t.Fatal("operations deadlocked")
+	}
+	close(errs)
+	for err := range errs {
+		t.Errorf("operation failed: %v", err)
+	}
+
+	// Every account written survives, whichever lock it was written under.
+	ks := open()
+	infos, err := ks.ListAccounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]bool)
+	for _, info := range infos {
+		names[info.Name] = true
+	}
+	for i := 0; i < stores; i++ {
+		for j := 0; j < rounds; j++ {
+			for _, name := range []string{fmt.Sprintf("key-%d-%d", i, j), fmt.Sprintf("watch-%d-%d", i, j)} {
+				if !names[name] {
+					t.Errorf("account %s was lost", name)
+				}
+			}
+		}
+	}
+
+	// Token and whole-store writes each advance the revision once; key
+	// writes leave it alone.
+	if rev, err := ks.Revision(); err != nil || rev != 2*stores*rounds {
+		t.Errorf("Revision = %d, %v, want %d", rev, err, 2*stores*rounds)
+	}
+}
+
+// TestSplitFilesLockScopes holds one file's lock, as a live process would,
+// and checks which operations still go through.
+func TestSplitFilesLockScopes(t *testing.T) {
+	tests := []struct {
+		name      string
+		held      string
+		tokenOK   bool
+		keyOK     bool
+		wholeOK   bool
+		readKeyOK bool
+	}{
+		{name: "token lock held", held: keystore.DefaultTokenFileName, keyOK: true, readKeyOK: true},
+		{name: "key lock held", held: keystore.DefaultKeyFileName, tokenOK: true, readKeyOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			ks, err := keystore.NewKeystore(keystore.Config{
+				DirPath:     dir,
+				SplitFiles:  true,
+				LockTimeout: 50 * time.Millisecond,
+				Logger:      discardLogger,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+				t.Fatal(err)
+			}
+			if err := ks.SaveToken("token"); err != nil {
+				t.Fatal(err)
+			}
+
+			lock := filepath.Join(dir, tt.held+".lock")
+			if err := os.WriteFile(lock, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			check := func(op string, err error, ok bool) {
+				t.Helper()
+				if ok && err != nil {
+					t.Errorf("%s: %v", op, err)
+				}
+				if !ok && !errors.Is(err, keystore.ErrLockTimeout) {
+					t.Errorf("%s: got %v, want ErrLockTimeout", op, err)
+				}
+			}
+			check("SaveToken", ks.SaveToken("refreshed"), tt.tokenOK)
+			check("SaveAccount", ks.SaveAccount("hot", fileKeyHex), tt.keyOK)
+			check("SaveWatchAddress", ks.SaveWatchAddress("cold", common.BigToAddress(common.Big1)), tt.wholeOK)
+			_, err = ks.LoadPrivateKey()
+			check("LoadPrivateKey", err, tt.readKeyOK)
+		})
+	}
+}
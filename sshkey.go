@@ -0,0 +1,201 @@
+package keystore
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// DefaultSSHAgentLifetime is how long a key added by AddToAgent stays in the
+// agent unless Config.SSHAgentLifetime says otherwise
+const DefaultSSHAgentLifetime = 1 * time.Hour
+
+// SaveSSHKey stores an SSH private key in PEM or OpenSSH format. Ed25519 and
+// ECDSA keys are supported. The key is encrypted like the primary key when a
+// passphrase is configured.
+func (s *Store) SaveSSHKey(pemOrOpenSSH []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	raw, err := ssh.ParseRawPrivateKey(pemOrOpenSSH)
+	if err != nil {
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) {
+			return fmt.Errorf("SSH key is passphrase-protected - use SaveSSHKeyWithPassphrase: %w", err)
+		}
+		return fmt.Errorf("invalid SSH private key: %w", err)
+	}
+	return s.saveSSHKey(raw)
+}
+
+// SaveSSHKeyWithPassphrase is SaveSSHKey for keys protected by passphrase.
+// The key is stored without the import passphrase.
+func (s *Store) SaveSSHKeyWithPassphrase(pemOrOpenSSH, passphrase []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	raw, err := ssh.ParseRawPrivateKeyWithPassphrase(pemOrOpenSSH, passphrase)
+	if err != nil {
+		if errors.Is(err, x509.IncorrectPasswordError) {
+			return fmt.Errorf("%w: %v", ErrWrongPassphrase, err)
+		}
+		return fmt.Errorf("invalid SSH private key: %w", err)
+	}
+	return s.saveSSHKey(raw)
+}
+
+func (s *Store) saveSSHKey(raw any) error {
+	key, err := sshPrivateKey(raw)
+	if err != nil {
+		return err
+	}
+
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return fmt.Errorf("invalid SSH private key: %w", err)
+	}
+
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		return fmt.Errorf("failed to encode SSH key: %w", err)
+	}
+	text := string(pem.EncodeToMemory(block))
+	wipe(block.Bytes)
+
+	pub := strings.TrimSuffix(string(ssh.MarshalAuthorizedKey(signer.PublicKey())), "\n")
+
+	return s.update(func() error {
+		plain, ev, err := s.sealKey(text)
+		if err != nil {
+			return err
+		}
+		s.SSHKey = plain
+		s.EncryptedSSHKey = ev
+		s.SSHPublicKey = pub
+		return nil
+	})
+}
+
+// sshPrivateKey normalizes a parsed key, rejecting unsupported types.
+func sshPrivateKey(raw any) (crypto.Signer, error) {
+	switch k := raw.(type) {
+	case ed25519.PrivateKey:
+		return k, nil
+	case *ed25519.PrivateKey:
+		return *k, nil
+	case *ecdsa.PrivateKey:
+		return k, nil
+	}
+	return nil, fmt.Errorf("%w: SSH key type %T, want ed25519 or ECDSA", ErrWrongKeyType, raw)
+}
+
+// GetSSHSigner returns a signer for the stored SSH key.
+func (s *Store) GetSSHSigner() (ssh.Signer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, err := s.sshKey()
+	s.audit(AuditKeyAccess, "", err)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SSH key in keystore: %w", err)
+	}
+	return signer, nil
+}
+
+// SSHPublicKeyAuthorizedFormat returns the stored SSH public key as an
+// authorized_keys line. The key need not be unlocked.
+func (s *Store) SSHPublicKeyAuthorizedFormat() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return "", err
+	}
+
+	if s.SSHPublicKey != "" {
+		return s.SSHPublicKey, nil
+	}
+
+	key, err := s.sshKey()
+	if err != nil {
+		return "", err
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return "", fmt.Errorf("invalid SSH key in keystore: %w", err)
+	}
+	return strings.TrimSuffix(string(ssh.MarshalAuthorizedKey(signer.PublicKey())), "\n"), nil
+}
+
+// AddToAgent adds the stored SSH key to the ssh-agent reachable over conn,
+// typically a connection to $SSH_AUTH_SOCK. The agent drops the key after
+// Config.SSHAgentLifetime.
+func (s *Store) AddToAgent(conn net.Conn) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	defer func() { s.audit(AuditExport, "", err) }()
+
+	key, err := s.sshKey()
+	if err != nil {
+		return err
+	}
+	if k, ok := key.(ed25519.PrivateKey); ok {
+		defer wipe(k)
+	}
+
+	lifetime := s.config.SSHAgentLifetime
+	if lifetime <= 0 {
+		lifetime = DefaultSSHAgentLifetime
+	}
+
+	err = agent.NewClient(conn).Add(agent.AddedKey{
+		PrivateKey:   key,
+		Comment:      "keystore " + s.location(),
+		LifetimeSecs: uint32((lifetime + time.Second - 1) / time.Second),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add SSH key to agent: %w", err)
+	}
+	return nil
+}
+
+// sshKey loads and parses the stored SSH key.
+func (s *Store) sshKey() (crypto.Signer, error) {
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	if s.SSHKey == "" && s.EncryptedSSHKey == nil {
+		return nil, ErrNoSSHKey
+	}
+	if err := s.frozenError(); err != nil {
+		return nil, err
+	}
+
+	text, err := s.openKey(s.SSHKey, s.EncryptedSSHKey)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := ssh.ParseRawPrivateKey([]byte(text))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SSH key in keystore: %w", err)
+	}
+	return sshPrivateKey(raw)
+}
@@ -0,0 +1,227 @@
+package keystore_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/theblitlabs/keystore"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func TestSSHKeyFormats(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	openSSH := func(key crypto.PrivateKey) []byte {
+		block, err := ssh.MarshalPrivateKey(key, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pem.EncodeToMemory(block)
+	}
+	protected := func(key crypto.PrivateKey) []byte {
+		block, err := ssh.MarshalPrivateKeyWithPassphrase(key, "", []byte("import"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pem.EncodeToMemory(block)
+	}
+	sec1, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		key        crypto.Signer
+		data       []byte
+		passphrase string
+	}{
+		{name: "ed25519 OpenSSH", key: edKey, data: openSSH(edKey)},
+		{name: "ECDSA OpenSSH", key: ecKey, data: openSSH(ecKey)},
+		{name: "ECDSA SEC1 PEM", key: ecKey, data: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1})},
+		{name: "ed25519 protected", key: edKey, data: protected(edKey), passphrase: "import"},
+		{name: "ECDSA protected", key: ecKey, data: protected(ecKey), passphrase: "import"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			ks, err := keystore.NewKeystore(keystore.Config{DirPath: dir})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.passphrase != "" {
+				if err := ks.SaveSSHKey(tt.data); err == nil {
+					t.Fatal("SaveSSHKey accepted a protected key without its passphrase")
+				}
+				if err := ks.SaveSSHKeyWithPassphrase(tt.data, []byte("wrong")); !errors.Is(err, keystore.ErrWrongPassphrase) {
+					t.Fatalf("wrong passphrase: got %v, want ErrWrongPassphrase", err)
+				}
+				err = ks.SaveSSHKeyWithPassphrase(tt.data, []byte(tt.passphrase))
+			} else {
+				err = ks.SaveSSHKey(tt.data)
+			}
+			if err != nil {
+				t.Fatalf("save: %v", err)
+			}
+
+			other, err := keystore.NewKeystore(keystore.Config{DirPath: dir})
+			if err != nil {
+				t.Fatal(err)
+			}
+			signer, err := other.GetSSHSigner()
+			if err != nil {
+				t.Fatalf("GetSSHSigner: %v", err)
+			}
+			want, err := ssh.NewPublicKey(tt.key.Public())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(signer.PublicKey().Marshal()) != string(want.Marshal()) {
+				t.Fatal("signer has a different public key")
+			}
+
+			sig, err := signer.Sign(rand.Reader, []byte("challenge"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := want.Verify([]byte("challenge"), sig); err != nil {
+				t.Fatalf("signature does not verify: %v", err)
+			}
+
+			line, err := other.SSHPublicKeyAuthorizedFormat()
+			if err != nil {
+				t.Fatalf("SSHPublicKeyAuthorizedFormat: %v", err)
+			}
+			parsed, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+			if err != nil {
+				t.Fatalf("authorized_keys line %q: %v", line, err)
+			}
+			if string(parsed.Marshal()) != string(want.Marshal()) {
+				t.Fatal("authorized_keys line has a different key")
+			}
+		})
+	}
+}
+
+func TestSSHKeyEncrypted(t *testing.T) {
+	dir := t.TempDir()
+	cfg := keystore.Config{DirPath: dir, Passphrase: keystore.StaticPassphrase("store")}
+	ks, err := keystore.NewKeystore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveSSHKey(pem.EncodeToMemory(block)); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, keystore.DefaultFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "OPENSSH PRIVATE KEY") {
+		t.Fatal("SSH key stored in plaintext despite a passphrase")
+	}
+
+	// The public key stays readable without the passphrase.
+	locked, err := keystore.NewKeystore(keystore.Config{DirPath: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := locked.SSHPublicKeyAuthorizedFormat(); err != nil {
+		t.Fatalf("SSHPublicKeyAuthorizedFormat without passphrase: %v", err)
+	}
+	if _, err := locked.GetSSHSigner(); err == nil {
+		t.Fatal("GetSSHSigner succeeded without the passphrase")
+	}
+}
+
+func TestSSHKeyRejected(t *testing.T) {
+	ks, err := keystore.NewKeystore(keystore.Config{DirPath: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ks.GetSSHSigner(); !errors.Is(err, keystore.ErrNoKeystore) {
+		t.Fatalf("GetSSHSigner without a keystore: got %v, want ErrNoKeystore", err)
+	}
+	if err := ks.SaveToken("token"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.GetSSHSigner(); !errors.Is(err, keystore.ErrNoSSHKey) {
+		t.Fatalf("GetSSHSigner: got %v, want ErrNoSSHKey", err)
+	}
+
+	if err := ks.SaveSSHKey([]byte("not a key")); err == nil {
+		t.Fatal("SaveSSHKey accepted garbage")
+	}
+}
+
+func TestAddToAgent(t *testing.T) {
+	ks, err := keystore.NewKeystore(keystore.Config{DirPath: t.TempDir(), SSHAgentLifetime: 90 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveSSHKey(pem.EncodeToMemory(block)); err != nil {
+		t.Fatal(err)
+	}
+
+	keyring := agent.NewKeyring()
+	client, server := net.Pipe()
+	defer client.Close()
+	go agent.ServeAgent(keyring, server)
+
+	if err := ks.AddToAgent(client); err != nil {
+		t.Fatalf("AddToAgent: %v", err)
+	}
+
+	keys, err := keyring.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ssh.NewPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || string(keys[0].Marshal()) != string(want.Marshal()) {
+		t.Fatalf("agent holds %v", keys)
+	}
+}
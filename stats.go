@@ -0,0 +1,128 @@
+package keystore
+
+import (
+	"expvar"
+	"sync/atomic"
+	"time"
+)
+
+// StatsSnapshot reports a Store's counters since it was created, along with
+// gauges as of its latest load or save. It contains no secrets.
+type StatsSnapshot struct {
+	Loads            int64 `json:"loads"`
+	LoadErrors       int64 `json:"load_errors"`
+	Saves            int64 `json:"saves"`
+	SaveErrors       int64 `json:"save_errors"`
+	ExpiryRejections int64 `json:"expiry_rejections"`
+	UnlockFailures   int64 `json:"unlock_failures"`
+
+	HasToken              bool  `json:"has_token"`
+	TokenRemainingSeconds int64 `json:"token_remaining_seconds"`
+	Locked                bool  `json:"locked"`
+	FileSize              int64 `json:"file_size"`
+}
+
+// storeStats holds the counters and gauges shared by a Store and its views.
+// Every field is accessed atomically, so Stats never waits for the Store's
+// lock.
+type storeStats struct {
+	loads            atomic.Int64
+	loadErrors       atomic.Int64
+	saves            atomic.Int64
+	saveErrors       atomic.Int64
+	expiryRejections atomic.Int64
+	unlockFailures   atomic.Int64
+
+	hasToken       atomic.Bool
+	tokenExpiresAt atomic.Int64
+	locked         atomic.Bool
+	fileSize       atomic.Int64
+}
+
+// Stats returns the Store's counters and gauges. It is safe to call
+// concurrently with any other method and does not touch storage.
+func (s *Store) Stats() StatsSnapshot {
+	st := s.stats
+	snap := StatsSnapshot{
+		Loads:            st.loads.Load(),
+		LoadErrors:       st.loadErrors.Load(),
+		Saves:            st.saves.Load(),
+		SaveErrors:       st.saveErrors.Load(),
+		ExpiryRejections: st.expiryRejections.Load(),
+		UnlockFailures:   st.unlockFailures.Load(),
+		HasToken:         st.hasToken.Load(),
+		Locked:           st.locked.Load(),
+		FileSize:         st.fileSize.Load(),
+	}
+
+	if expiresAt := st.tokenExpiresAt.Load(); expiresAt > 0 {
+		if remaining := time.Unix(expiresAt, 0).Sub(s.now()); remaining > 0 {
+			snap.TokenRemainingSeconds = int64(remaining / time.Second)
+		}
+	}
+
+	return snap
+}
+
+// PublishExpvar registers the Store's Stats with the expvar package under
+// name, so they are served on /debug/vars. Like expvar.Publish, it panics
+// if name is already registered.
+func (s *Store) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() any { return s.Stats() }))
+}
+
+// observe updates the stats after a load or save.
+func (s *Store) observe(op string, err error) {
+	st := s.stats
+	if st == nil {
+		return
+	}
+
+	switch op {
+	case AuditLoad:
+		st.loads.Add(1)
+		if err != nil && !isNoKeystore(err) {
+			st.loadErrors.Add(1)
+		}
+	case AuditSave:
+		st.saves.Add(1)
+		if err != nil {
+			st.saveErrors.Add(1)
+		}
+	default:
+		return
+	}
+
+	if err == nil {
+		s.updateGauges()
+	}
+}
+
+// updateGauges records the in-memory state in the gauges.
+func (s *Store) updateGauges() {
+	st := s.stats
+	if st == nil {
+		return
+	}
+
+	hasToken := s.creds.authToken != "" || s.persisted.AuthToken != "" || s.EncryptedToken != nil
+	st.hasToken.Store(hasToken)
+	if hasToken && s.creds.authToken == "" {
+		st.tokenExpiresAt.Store(s.ExpiresAt)
+	} else {
+		st.tokenExpiresAt.Store(0)
+	}
+	st.locked.Store(s.keyLocked())
+}
+
+func (s *Store) countExpiryRejection() {
+	if s.stats != nil {
+		s.stats.expiryRejections.Add(1)
+	}
+}
+
+func (s *Store) countUnlockFailure() {
+	if s.stats != nil {
+		s.stats.unlockFailures.Add(1)
+	}
+}
@@ -0,0 +1,214 @@
+package keystore_test
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/theblitlabs/keystore"
+	"github.com/theblitlabs/keystore/faultinject"
+)
+
+const statsToken = "stats-token-value"
+
+func TestStatsCounters(t *testing.T) {
+	clock := newTestClock(epoch)
+	inj := faultinject.New()
+	ks, err := keystore.NewKeystore(clock.config(keystore.Config{
+		DirPath:       t.TempDir(),
+		TokenTTL:      time.Hour,
+		FaultInjector: inj,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ks.LoadToken(); !errors.Is(err, keystore.ErrNoKeystore) {
+		t.Fatalf("LoadToken: got %v, want ErrNoKeystore", err)
+	}
+	if got := ks.Stats(); got.Loads != 1 || got.LoadErrors != 0 {
+		t.Fatalf("missing keystore counted as %+v, want one load without errors", got)
+	}
+
+	if err := ks.SaveToken(statsToken); err != nil {
+		t.Fatal(err)
+	}
+	inj.Once(keystore.FaultOpSave, keystore.Fault{Err: errors.New("disk full")})
+	if err := ks.SaveToken(statsToken); err == nil {
+		t.Fatal("SaveToken with a failing save succeeded")
+	}
+
+	clock.Advance(2 * time.Hour)
+	for i := 0; i < 2; i++ {
+		if _, err := ks.LoadToken(); !errors.Is(err, keystore.ErrTokenExpired) {
+			t.Fatalf("LoadToken: got %v, want ErrTokenExpired", err)
+		}
+	}
+
+	got := ks.Stats()
+	if got.Saves != 2 || got.SaveErrors != 1 {
+		t.Errorf("saves = %d, errors %d, want 2 and 1", got.Saves, got.SaveErrors)
+	}
+	if got.ExpiryRejections != 2 {
+		t.Errorf("expiry rejections = %d, want 2", got.ExpiryRejections)
+	}
+	if got.UnlockFailures != 0 {
+		t.Errorf("unlock failures = %d, want 0", got.UnlockFailures)
+	}
+}
+
+func TestStatsGauges(t *testing.T) {
+	clock := newTestClock(epoch)
+	dir := t.TempDir()
+	ks, err := keystore.NewKeystore(clock.config(keystore.Config{DirPath: dir, TokenTTL: time.Hour}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := ks.Stats(); got.HasToken || got.TokenRemainingSeconds != 0 || got.Locked {
+		t.Fatalf("empty store gauges = %+v", got)
+	}
+
+	if err := ks.SaveToken(statsToken); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(15 * time.Minute)
+	got := ks.Stats()
+	if !got.HasToken || got.TokenRemainingSeconds != 45*60 {
+		t.Fatalf("token gauges = %+v, want 2700 seconds remaining", got)
+	}
+	if got.FileSize <= 0 {
+		t.Fatalf("file size = %d", got.FileSize)
+	}
+
+	clock.Advance(time.Hour)
+	if got := ks.Stats(); !got.HasToken || got.TokenRemainingSeconds != 0 {
+		t.Fatalf("expired token gauges = %+v", got)
+	}
+
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.EncryptInPlace("right"); err != nil {
+		t.Fatal(err)
+	}
+	ks.Lock()
+	if !ks.Stats().Locked {
+		t.Fatal("Locked gauge false after Lock")
+	}
+	if err := ks.Unlock("wrong"); !errors.Is(err, keystore.ErrWrongPassphrase) {
+		t.Fatalf("Unlock: got %v, want ErrWrongPassphrase", err)
+	}
+	if got := ks.Stats(); !got.Locked || got.UnlockFailures != 1 {
+		t.Fatalf("after a wrong passphrase: %+v", got)
+	}
+	if err := ks.Unlock("right"); err != nil {
+		t.Fatal(err)
+	}
+	if ks.Stats().Locked {
+		t.Fatal("Locked gauge true after Unlock")
+	}
+}
+
+func TestStatsSharedWithViews(t *testing.T) {
+	ks, err := keystore.NewKeystore(keystore.Config{DirPath: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	view := ks.WithContextInfo(map[string]string{"request": "42"})
+
+	if err := view.SaveToken(statsToken); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.LoadToken(); err != nil {
+		t.Fatal(err)
+	}
+	if a, b := ks.Stats(), view.Stats(); a != b || a.Saves != 1 || a.Loads == 0 {
+		t.Fatalf("store stats %+v, view stats %+v", a, b)
+	}
+}
+
+func TestStatsConcurrent(t *testing.T) {
+	ks, err := keystore.NewKeystore(keystore.Config{DirPath: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const writers, saves = 4, 10
+	var wg sync.WaitGroup
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				ks.Stats()
+			}
+		}
+	}()
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < saves; j++ {
+				if err := ks.SaveToken(statsToken); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	<-stopped
+
+	if got := ks.Stats().Saves; got != writers*saves {
+		t.Fatalf("saves = %d, want %d", got, writers*saves)
+	}
+}
+
+func TestPublishExpvar(t *testing.T) {
+	ks, err := keystore.NewKeystore(keystore.Config{DirPath: t.TempDir(), Passphrase: keystore.StaticPassphrase("right")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveToken(statsToken); err != nil {
+		t.Fatal(err)
+	}
+
+	ks.PublishExpvar("keystore_stats_test")
+	v := expvar.Get("keystore_stats_test")
+	if v == nil {
+		t.Fatal("stats not published")
+	}
+
+	out := v.String()
+	for _, secret := range []string{fileKeyHex, statsToken, "right"} {
+		if strings.Contains(out, secret) {
+			t.Fatalf("published stats contain a secret: %s", out)
+		}
+	}
+
+	var got keystore.StatsSnapshot
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("published stats are not JSON: %v", err)
+	}
+	if got != ks.Stats() {
+		t.Fatalf("published %+v, Stats %+v", got, ks.Stats())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("publishing a name twice did not panic")
+		}
+	}()
+	ks.PublishExpvar("keystore_stats_test")
+}
@@ -0,0 +1,179 @@
+package keystore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Status summarizes the keystore for display. It never contains secret
+// values.
+type Status struct {
+	Exists        bool        `json:"exists"`
+	Backend       string      `json:"backend"`
+	Location      string      `json:"location"`
+	Path          string      `json:"path,omitempty"`
+	Mode          os.FileMode `json:"mode,omitempty"`
+	SchemaVersion int         `json:"schema_version,omitempty"`
+	Format        *FormatInfo `json:"format,omitempty"`
+
+	// FileSize is the size of the keystore as last read or written, and
+	// Sections the serialized size of its top-level fields, largest first.
+	FileSize int64         `json:"file_size,omitempty"`
+	Sections []SectionSize `json:"sections,omitempty"`
+
+	HasPrivateKey  bool   `json:"has_private_key"`
+	KeySource      string `json:"key_source,omitempty"`
+	Address        string `json:"address,omitempty"`
+	KeyFingerprint string `json:"key_fingerprint,omitempty"`
+	KeyEncrypted   bool   `json:"key_encrypted"`
+	ChainID        string `json:"chain_id,omitempty"`
+	NetworkName    string `json:"network_name,omitempty"`
+	Accounts       int    `json:"accounts"`
+
+	Provenance *Provenance `json:"provenance,omitempty"`
+
+	KeyUseCount   int64      `json:"key_use_count,omitempty"`
+	KeyLastUsedAt *time.Time `json:"key_last_used_at,omitempty"`
+
+	MnemonicBackedUp bool `json:"mnemonic_backed_up"`
+
+	HasToken          bool       `json:"has_token"`
+	TokenSource       string     `json:"token_source,omitempty"`
+	TokenExpiresAt    *time.Time `json:"token_expires_at,omitempty"`
+	TokenRemaining    int64      `json:"token_remaining_seconds,omitempty"`
+	TokenExpired      bool       `json:"token_expired"`
+	TokenDeviceBound  bool       `json:"token_device_bound"`
+	TokenEncrypted    bool       `json:"token_encrypted"`
+	EncryptionEnabled bool       `json:"encryption_enabled"`
+	RequireEncryption bool       `json:"require_encryption"`
+	Locked            bool       `json:"locked"`
+
+	Frozen       bool       `json:"frozen"`
+	FrozenReason string     `json:"frozen_reason,omitempty"`
+	FrozenAt     *time.Time `json:"frozen_at,omitempty"`
+
+	// Error is set by Manager.StatusAll when Status failed.
+	Error string `json:"error,omitempty"`
+}
+
+// Status reports what is stored and how, without decrypting anything. A
+// missing keystore is not an error; it yields Exists false and zero values.
+func (s *Store) Status() (Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.status()
+}
+
+func (s *Store) status() (Status, error) {
+	st := Status{
+		Location:          s.location(),
+		EncryptionEnabled: s.encryptionEnabled(),
+		RequireEncryption: s.config.RequireEncryption,
+	}
+
+	switch b := s.backend.(type) {
+	case *FileBackend:
+		st.Backend = "file"
+		st.Path = b.path
+	case *SplitFileBackend:
+		st.Backend = "split"
+		st.Path = b.fileInfoPath()
+	case *MemoryBackend:
+		st.Backend = "memory"
+	default:
+		st.Backend = "custom"
+	}
+
+	if err := s.load(); err != nil {
+		if !isNoKeystore(err) {
+			return st, err
+		}
+		s.reset()
+	} else {
+		st.Exists = true
+		st.SchemaVersion = s.fileVersion
+		st.Format = s.fileFormat
+		st.FileSize = s.fileSize
+		st.Sections, _ = s.sections()
+	}
+
+	if st.Path != "" {
+		if info, err := os.Stat(st.Path); err == nil {
+			st.Mode = info.Mode().Perm()
+		}
+	}
+
+	switch {
+	case s.creds.privateKey != "":
+		st.HasPrivateKey = true
+		st.KeySource = s.creds.keySource
+		if key, err := crypto.HexToECDSA(s.creds.privateKey); err == nil {
+			st.Address = crypto.PubkeyToAddress(key.PublicKey).Hex()
+			st.KeyFingerprint = keyFingerprint(crypto.FromECDSAPub(&key.PublicKey))
+		}
+	case s.persisted.PrivateKey != "" || s.EncryptedKey != nil || s.KeyShares != nil:
+		st.HasPrivateKey = true
+		st.KeySource = "keystore"
+		st.Address = s.Address
+		st.Provenance = s.Provenance.copy()
+		st.KeyEncrypted = s.EncryptedKey != nil || s.KeyShares != nil
+		st.ChainID = s.ChainID
+		st.NetworkName = s.NetworkName
+		if pub, err := hex.DecodeString(s.PublicKey); err == nil && len(pub) > 0 {
+			st.KeyFingerprint = keyFingerprint(pub)
+		}
+	}
+	st.Accounts = len(s.Accounts)
+	st.KeyUseCount, st.KeyLastUsedAt = s.usageOf("", s.UseCount, s.LastUsedAt)
+	st.MnemonicBackedUp = s.MnemonicBackedUpAt != 0
+	st.Locked = s.keyLocked()
+	if s.Frozen != nil {
+		frozenAt := time.Unix(s.Frozen.FrozenAt, 0)
+		st.Frozen = true
+		st.FrozenReason = s.Frozen.Reason
+		st.FrozenAt = &frozenAt
+	}
+
+	switch {
+	case s.creds.authToken != "":
+		st.HasToken = true
+		st.TokenSource = "systemd-credential"
+	case s.persisted.AuthToken != "" || s.EncryptedToken != nil:
+		st.HasToken = true
+		st.TokenSource = "keystore"
+		expiresAt := time.Unix(s.ExpiresAt, 0)
+		st.TokenExpiresAt = &expiresAt
+		st.TokenExpired = s.tokenExpired()
+		if remaining := expiresAt.Sub(s.now()); remaining > 0 {
+			st.TokenRemaining = int64(remaining / time.Second)
+		}
+		st.TokenDeviceBound = s.TokenDevice != ""
+		st.TokenEncrypted = s.EncryptedToken != nil
+	}
+
+	return st, nil
+}
+
+// keyFingerprint is a short identifier of a public key.
+func keyFingerprint(pub []byte) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// keyLocked reports whether the in-memory primary key is encrypted, or
+// split, and cannot currently be opened.
+func (s *Store) keyLocked() bool {
+	switch {
+	case s.creds.privateKey != "":
+		return false
+	case s.KeyShares != nil:
+		return s.shareKey == nil
+	default:
+		return s.EncryptedKey != nil && s.unlocked == nil && s.config.Passphrase == nil && s.config.Sealer == nil
+	}
+}
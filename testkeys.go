@@ -0,0 +1,173 @@
+package keystore
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Environment is the kind of deployment a Store runs in.
+type Environment string
+
+// Environments for Config.Environment
+const (
+	// EnvironmentDev allows any key. It is the default.
+	EnvironmentDev Environment = "dev"
+
+	// EnvironmentProd refuses well-known test keys and low-entropy keys.
+	EnvironmentProd Environment = "prod"
+)
+
+// testKeyDomain separates test key fingerprints from other hashes of
+// addresses.
+const testKeyDomain = "keystore-test-key\x00"
+
+var testKeyFingerprintPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// wellKnownTestKeys holds the fingerprints of the addresses of keys
+// published by development tools, so the keys themselves are not shipped.
+var wellKnownTestKeys = map[string]bool{
+	// Hardhat and Anvil default accounts
+	"04c78398f6aced80286bbc553bf2a292": true,
+	"07311a7c9a77803e02677ee342104584": true,
+	"e9d136d16786084c19349df87caca496": true,
+	"e631384eb6b8272a9253ceadbb1fb840": true,
+	"eb73a1ac2ff17583887a67fc67077ff8": true,
+	"45d6f317a0341208a2539a03f292f808": true,
+	"9c33cb5e3910c692193cfd451a3f0eb5": true,
+	"5677c7c8c5b1f0dbf8a3f0eaea622424": true,
+	"1c8cf7e07269b84b2194b22cda8b4f10": true,
+	"442195b1ec9867504d7676d272a9dcbe": true,
+	"3110ff7d5104bff8f92946179d2cb113": true,
+	"82494290b866f84e80280b359053e896": true,
+	"44c08bef7d3870e76a36cbf2a9af01c3": true,
+	"82a88f16700434168a7ea5efb154d65f": true,
+	"9f4cc40a408385a66505dd73bae62f7d": true,
+	"094bf8ed44c6505d2c8c4b13faf2cb2e": true,
+	"2de6db69fa35471ef94f3da38086d7c5": true,
+	"a59947a94d41e8d4124e3e0e725d9ee5": true,
+	"97488937e119dfc4214b394501e5d34d": true,
+	"cad8855bb4a480363ee6e3cb44d460f4": true,
+	// Ganache deterministic accounts
+	"8103aadfbfb5ffbcdb7dad84b16eafae": true,
+	"570acca792b29a0cd2ba8899cf3d9eb2": true,
+	"f561b2e185c7a1b93aa73b2e15d18794": true,
+	"11da564cc197ee8571850d4f28e112ea": true,
+	"60df3a8dccd56db6ed31eaaf23241c45": true,
+	"73658d5e4a012d2fd5ee1d0bd1aee9f6": true,
+	"380c03408eef4da48bb894400afda516": true,
+	"2213d50a08f13e435a26075bc8d3e04c": true,
+	"d1b18e15cb6c1a0a35323e3a2fac475e": true,
+	"18afc572ade2ef086b88912c59e9240d": true,
+	// Private keys 1, 2 and 3
+	"bcc0114115e72109102d3ca2f818bb8d": true,
+	"be58093c92c311b58b138cd1d323b0d1": true,
+	"664d1e90567ab603db708330bf868e87": true,
+}
+
+// TestKeyFingerprint returns the fingerprint of the key with address as
+// Config.AdditionalForbiddenKeys takes it: the first 16 bytes of the
+// SHA-256 digest of a domain string and the address, in hex.
+func TestKeyFingerprint(address string) (string, error) {
+	if !common.IsHexAddress(address) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidAddress, address)
+	}
+	return testKeyFingerprint(common.HexToAddress(address)), nil
+}
+
+func testKeyFingerprint(addr common.Address) string {
+	sum := sha256.Sum256(append([]byte(testKeyDomain), addr.Bytes()...))
+	return hex.EncodeToString(sum[:16])
+}
+
+func validateEnvironment(cfg Config) error {
+	switch cfg.Environment {
+	case "", EnvironmentDev, EnvironmentProd:
+	default:
+		return configError("Environment", fmt.Sprintf("unknown environment %q", cfg.Environment))
+	}
+	for _, fp := range cfg.AdditionalForbiddenKeys {
+		if !testKeyFingerprintPattern.MatchString(fp) {
+			return configError("AdditionalForbiddenKeys", fmt.Sprintf("%q is not a fingerprint from TestKeyFingerprint", fp))
+		}
+	}
+	return nil
+}
+
+// isTestKey reports whether addr belongs to a well-known test key or one
+// of Config.AdditionalForbiddenKeys.
+func (s *Store) isTestKey(addr common.Address) bool {
+	fp := testKeyFingerprint(addr)
+	if wellKnownTestKeys[fp] {
+		return true
+	}
+	for _, forbidden := range s.config.AdditionalForbiddenKeys {
+		if fp == forbidden {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTestKey refuses, in the prod environment, a key that is well known
+// or has an obviously low-entropy pattern. It runs wherever a key is
+// saved or imported.
+func (s *Store) checkTestKey(key *ecdsa.PrivateKey) error {
+	if s.config.Environment != EnvironmentProd {
+		return nil
+	}
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+	if s.isTestKey(addr) {
+		return fmt.Errorf("%w: %s", ErrWellKnownTestKey, addr.Hex())
+	}
+	if pattern := lowEntropyPattern(key); pattern != "" {
+		return fmt.Errorf("%w: %s key for %s", ErrWellKnownTestKey, pattern, addr.Hex())
+	}
+	return nil
+}
+
+// lowEntropyPattern describes the pattern of a key chosen by hand rather
+// than generated: a small number, a short repeated sequence of bytes, or
+// bytes counting up or down by a fixed step. It returns "" for other keys.
+func lowEntropyPattern(key *ecdsa.PrivateKey) string {
+	d := make([]byte, 32)
+	key.D.FillBytes(d)
+	defer wipe(d)
+
+	small := true
+	for _, b := range d[:24] {
+		if b != 0 {
+			small = false
+			break
+		}
+	}
+	if small {
+		return "small"
+	}
+
+	for _, period := range []int{1, 2, 4, 8} {
+		repeated := true
+		for i := period; i < len(d); i++ {
+			if d[i] != d[i-period] {
+				repeated = false
+				break
+			}
+		}
+		if repeated {
+			return "repeated"
+		}
+	}
+
+	step := d[1] - d[0]
+	for i := 2; i < len(d); i++ {
+		if d[i]-d[i-1] != step {
+			return ""
+		}
+	}
+	return "sequential"
+}
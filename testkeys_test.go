@@ -0,0 +1,261 @@
+package keystore_test
+
+import (
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/theblitlabs/keystore"
+)
+
+const (
+	// The first Hardhat and Anvil default accounts, and the first Ganache
+	// deterministic account.
+	hardhatKeyHex  = "ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80"
+	hardhat1KeyHex = "59c6995e998f97a5a0044966f0945389dc9e86dae88c7a8412f4603b6b78690d"
+	ganacheKeyHex  = "4f3edf983ac636a65a842ce7c78d9aa706d3b113bce9c46f30d7d21715b23b1d"
+)
+
+// lowEntropyKeys holds keys chosen by hand rather than generated.
+var lowEntropyKeys = map[string]string{
+	"one":        strings.Repeat("0", 63) + "1",
+	"two":        strings.Repeat("0", 63) + "2",
+	"small":      strings.Repeat("0", 48) + "deadbeefcafebabe",
+	"repeated":   strings.Repeat("11", 32),
+	"pairs":      strings.Repeat("abcd", 16),
+	"words":      strings.Repeat("0badf00d", 8),
+	"ascending":  "0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20",
+	"descending": "201f1e1d1c1b1a191817161514131211100f0e0d0c0b0a090807060504030201",
+	"stepping":   "0306090c0f1215181b1e2124272a2d303336393c3f4245484b4e5154575a5d60",
+}
+
+// testKeyOps are the ways a key gets into a keystore.
+var testKeyOps = []struct {
+	name string
+	run  func(t *testing.T, ks *keystore.Store, keyHex string) error
+}{
+	{"SavePrivateKey", func(t *testing.T, ks *keystore.Store, keyHex string) error {
+		return ks.SavePrivateKey(keyHex)
+	}},
+	{"SavePrivateKeyBytes", func(t *testing.T, ks *keystore.Store, keyHex string) error {
+		b, err := hex.DecodeString(keyHex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ks.SavePrivateKeyBytes(b)
+	}},
+	{"SaveECDSAKey", func(t *testing.T, ks *keystore.Store, keyHex string) error {
+		return ks.SaveECDSAKey(mustKey(t, keyHex))
+	}},
+	{"SavePrivateKeyForChain", func(t *testing.T, ks *keystore.Store, keyHex string) error {
+		return ks.SavePrivateKeyForChain(keyHex, big.NewInt(1), "mainnet")
+	}},
+	{"SavePrivateKeyWithPurpose", func(t *testing.T, ks *keystore.Store, keyHex string) error {
+		return ks.SavePrivateKeyWithPurpose(keyHex, keystore.KeyPurposeSigning)
+	}},
+	{"SaveAccount", func(t *testing.T, ks *keystore.Store, keyHex string) error {
+		return ks.SaveAccount("deployer", keyHex)
+	}},
+	{"SaveAccountForChain", func(t *testing.T, ks *keystore.Store, keyHex string) error {
+		return ks.SaveAccountForChain("deployer", keyHex, big.NewInt(1), "mainnet")
+	}},
+	{"SaveAccountWithPurpose", func(t *testing.T, ks *keystore.Store, keyHex string) error {
+		return ks.SaveAccountWithPurpose("deployer", keyHex, keystore.KeyPurposeSigning)
+	}},
+	{"Merge", func(t *testing.T, ks *keystore.Store, keyHex string) error {
+		dir := t.TempDir()
+		other := newErrorStore(t, keystore.Config{DirPath: dir})
+		if err := other.SavePrivateKey(keyHex); err != nil {
+			t.Fatal(err)
+		}
+		_, err := ks.Merge(filepath.Join(dir, keystore.DefaultFileName), keystore.FailOnConflict)
+		return err
+	}},
+	{"ImportBundle", func(t *testing.T, ks *keystore.Store, keyHex string) error {
+		path := filepath.Join(t.TempDir(), "bundle")
+		other := newErrorStore(t, keystore.Config{})
+		if err := other.SaveAccount("deployer", keyHex); err != nil {
+			t.Fatal(err)
+		}
+		if err := other.ExportBundle(path, "bundle passphrase", keystore.BundleAll); err != nil {
+			t.Fatal(err)
+		}
+		_, err := ks.ImportBundle(path, "bundle passphrase", keystore.FailOnConflict)
+		return err
+	}},
+	{"ImportKeystoreDir", func(t *testing.T, ks *keystore.Store, keyHex string) error {
+		src := t.TempDir()
+		writeV3(t, src, "key.json", keyHex, "geth")
+		report, err := ks.ImportKeystoreDir(src, func(string) (string, error) { return "geth", nil })
+		if err != nil {
+			return err
+		}
+		if len(report.Failed) > 0 {
+			if reason := report.Failed[0].Reason; strings.Contains(reason, keystore.ErrWellKnownTestKey.Error()) {
+				return keystore.ErrWellKnownTestKey
+			}
+			return errors.New(report.Failed[0].Reason)
+		}
+		return nil
+	}},
+}
+
+// assertNoKeys fails if ks holds a primary key or an account.
+func assertNoKeys(t *testing.T, ks *keystore.Store) {
+	t.Helper()
+
+	if _, err := ks.LoadPrivateKey(); !errors.Is(err, keystore.ErrNoPrivateKey) && !errors.Is(err, keystore.ErrNoKeystore) {
+		t.Fatalf("a refused key was saved: LoadPrivateKey = %v", err)
+	}
+	if names, err := ks.ListAccounts(); err != nil && !errors.Is(err, keystore.ErrNoKeystore) || len(names) != 0 {
+		t.Fatalf("a refused key was saved: ListAccounts = %v, %v", names, err)
+	}
+}
+
+func TestWellKnownTestKeysProd(t *testing.T) {
+	prod := keystore.Config{Environment: keystore.EnvironmentProd}
+
+	// Every way in refuses a well-known key.
+	for _, op := range testKeyOps {
+		op := op
+		t.Run(op.name, func(t *testing.T) {
+			ks := newErrorStore(t, prod)
+			if err := op.run(t, ks, hardhatKeyHex); !errors.Is(err, keystore.ErrWellKnownTestKey) {
+				t.Fatalf("got %v, want ErrWellKnownTestKey", err)
+			}
+			assertNoKeys(t, ks)
+
+			if err := op.run(t, ks, fileKeyHex); err != nil {
+				t.Fatalf("a generated key was refused: %v", err)
+			}
+		})
+	}
+
+	keys := map[string]string{"hardhat": hardhatKeyHex, "hardhat #1": hardhat1KeyHex, "ganache": ganacheKeyHex}
+	for name, keyHex := range lowEntropyKeys {
+		keys[name] = keyHex
+	}
+	for name, keyHex := range keys {
+		ks := newErrorStore(t, prod)
+		if err := ks.SavePrivateKey(keyHex); !errors.Is(err, keystore.ErrWellKnownTestKey) {
+			t.Errorf("SavePrivateKey of the %s key: got %v, want ErrWellKnownTestKey", name, err)
+		}
+		if err := ks.SaveAccount("deployer", keyHex); !errors.Is(err, keystore.ErrWellKnownTestKey) {
+			t.Errorf("SaveAccount of the %s key: got %v, want ErrWellKnownTestKey", name, err)
+		}
+		assertNoKeys(t, ks)
+	}
+
+	// Generated keys pass.
+	ks := newErrorStore(t, prod)
+	if _, err := ks.GeneratePrivateKey(); err != nil {
+		t.Fatalf("GeneratePrivateKey: %v", err)
+	}
+	if _, err := ks.GenerateKeyPairSet(); err != nil {
+		t.Fatalf("GenerateKeyPairSet: %v", err)
+	}
+}
+
+func TestWellKnownTestKeysDev(t *testing.T) {
+	dir := t.TempDir()
+	for _, env := range []keystore.Environment{"", keystore.EnvironmentDev} {
+		ks := newErrorStore(t, keystore.Config{Environment: env})
+		if err := ks.SavePrivateKey(hardhatKeyHex); err != nil {
+			t.Fatalf("SavePrivateKey in %q: %v", env, err)
+		}
+		if err := ks.SaveAccount("sequential", lowEntropyKeys["ascending"]); err != nil {
+			t.Fatalf("SaveAccount in %q: %v", env, err)
+		}
+	}
+
+	// Verify flags well-known keys in any environment, more severely in
+	// prod. Low-entropy keys are refused when saved but not looked for.
+	ks := newErrorStore(t, keystore.Config{DirPath: dir})
+	if err := ks.SavePrivateKey(hardhatKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveAccount("ganache", ganacheKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveAccount("sequential", lowEntropyKeys["ascending"]); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveAccount("ops", credentialKeyHex); err != nil {
+		t.Fatal(err)
+	}
+
+	for env, severity := range map[keystore.Environment]string{
+		keystore.EnvironmentDev:  keystore.VerifySeverityWarning,
+		keystore.EnvironmentProd: keystore.VerifySeverityError,
+	} {
+		issues := verifyIssues(t, newErrorStore(t, keystore.Config{DirPath: dir, Environment: env}), keystore.VerifyWellKnownTestKey)
+		if len(issues) != 2 || issues["primary"].Severity != severity || issues["ganache"].Severity != severity {
+			t.Fatalf("%s: Verify reported %+v, want %s issues for primary and ganache", env, issues, severity)
+		}
+	}
+}
+
+func TestAdditionalForbiddenKeys(t *testing.T) {
+	addr := crypto.PubkeyToAddress(mustKey(t, credentialKeyHex).PublicKey)
+	fp, err := keystore.TestKeyFingerprint(addr.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lower, err := keystore.TestKeyFingerprint(strings.ToLower(addr.Hex())); err != nil || lower != fp {
+		t.Fatalf("fingerprint depends on the address case: %q, %v", lower, err)
+	}
+	if strings.Contains(fp, strings.ToLower(addr.Hex()[2:])) || strings.Contains(fp, credentialKeyHex) {
+		t.Fatalf("fingerprint %q holds the address or key", fp)
+	}
+	if _, err := keystore.TestKeyFingerprint("not an address"); !errors.Is(err, keystore.ErrInvalidAddress) {
+		t.Fatalf("TestKeyFingerprint of a bad address: got %v, want ErrInvalidAddress", err)
+	}
+
+	dir := t.TempDir()
+	prod := newErrorStore(t, keystore.Config{DirPath: dir, Environment: keystore.EnvironmentProd, AdditionalForbiddenKeys: []string{fp}})
+	if err := prod.SaveAccount("ops", credentialKeyHex); !errors.Is(err, keystore.ErrWellKnownTestKey) {
+		t.Fatalf("SaveAccount of a forbidden key: got %v, want ErrWellKnownTestKey", err)
+	}
+	if err := prod.SaveAccount("file", fileKeyHex); err != nil {
+		t.Fatalf("SaveAccount of another key: %v", err)
+	}
+
+	dev := newErrorStore(t, keystore.Config{DirPath: dir, AdditionalForbiddenKeys: []string{fp}})
+	if err := dev.SaveAccount("ops", credentialKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if issues := verifyIssues(t, dev, keystore.VerifyWellKnownTestKey); len(issues) != 1 || issues["ops"].Severity != keystore.VerifySeverityWarning {
+		t.Fatalf("Verify reported %+v, want a warning for ops", issues)
+	}
+}
+
+func TestEnvironmentConfig(t *testing.T) {
+	for field, cfg := range map[string]keystore.Config{
+		"Environment":             {Environment: "production"},
+		"AdditionalForbiddenKeys": {AdditionalForbiddenKeys: []string{"0x" + strings.Repeat("ab", 20)}},
+	} {
+		cfg.DirPath = t.TempDir()
+		_, err := keystore.NewKeystore(cfg)
+		var cerr *keystore.ConfigError
+		if !errors.As(err, &cerr) || cerr.Field != field {
+			t.Errorf("NewKeystore: got %v, want a %s ConfigError", err, field)
+		}
+	}
+
+	// The list ships fingerprints, not keys or addresses.
+	src, err := os.ReadFile("testkeys.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, keyHex := range []string{hardhatKeyHex, hardhat1KeyHex, ganacheKeyHex} {
+		addr := crypto.PubkeyToAddress(mustKey(t, keyHex).PublicKey)
+		if strings.Contains(string(src), keyHex) || strings.Contains(strings.ToLower(string(src)), strings.ToLower(addr.Hex()[2:])) {
+			t.Errorf("testkeys.go holds %s in plaintext", addr.Hex())
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package keystore
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+)
+
+// tokenAttestationDomain separates token attestations from other
+// signatures made with the same key.
+const tokenAttestationDomain = "keystore-token-attestation\x00"
+
+// TokenBinding is the attestation stored with a token saved under
+// Config.BindTokenToKey: the address of the primary key and its signature
+// over the token and expiry.
+type TokenBinding struct {
+	Address   string `json:"address"`
+	Signature string `json:"signature"`
+}
+
+// TokenAttestation returns the stored token with the signature made by the
+// primary key when it was saved, for the client to present together. The
+// signature is a 65-byte [R || S || V] secp256k1 signature over the digest
+// VerifyTokenAttestation checks. It fails with ErrTokenNotAttested if the
+// token was saved without Config.BindTokenToKey or before the keystore had
+// a primary key, or if the primary key changed since.
+func (s *Store) TokenAttestation() (token string, sig []byte, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.creds.authToken != "" {
+		return "", nil, fmt.Errorf("%w: token is provided by systemd credentials", ErrTokenNotAttested)
+	}
+
+	if token, err = s.loadToken(); err != nil {
+		return "", nil, err
+	}
+	if err := s.checkTokenAttestation(token); err != nil {
+		return "", nil, err
+	}
+
+	sig, err = hex.DecodeString(s.TokenBinding.Signature)
+	if err != nil {
+		return "", nil, s.corrupt("token_binding", err)
+	}
+	return token, sig, nil
+}
+
+// VerifyTokenAttestation reports whether sig, as returned by
+// TokenAttestation, was made by addr over token and its expiry as a Unix
+// time. It fails with ErrInvalidSignature if sig is malformed.
+func VerifyTokenAttestation(addr, token string, expiresAt int64, sig []byte) (bool, error) {
+	if !common.IsHexAddress(addr) {
+		return false, fmt.Errorf("%w: %q", ErrInvalidAddress, addr)
+	}
+	signer, err := RecoverAddressFromHash(tokenAttestationDigest(token, expiresAt), sig)
+	if err != nil {
+		return false, err
+	}
+	return signer == common.HexToAddress(addr), nil
+}
+
+// tokenAttestationDigest is the Keccak-256 digest of the domain, the token
+// and the expiry as a big-endian 64-bit Unix time.
+func tokenAttestationDigest(token string, expiresAt int64) []byte {
+	var expiry [8]byte
+	binary.BigEndian.PutUint64(expiry[:], uint64(expiresAt))
+	return ethcrypto.Keccak256([]byte(tokenAttestationDomain), []byte(token), expiry[:])
+}
+
+// attestToken replaces the stored attestation with one over token and the
+// stored expiry, if Config.BindTokenToKey is set and the keystore holds a
+// primary key. It reads the key from memory, since it runs inside updates.
+func (s *Store) attestToken(token string) error {
+	s.TokenBinding = nil
+	if !s.config.BindTokenToKey {
+		return nil
+	}
+
+	privateKeyHex := s.creds.privateKey
+	if privateKeyHex == "" {
+		if !s.hasPrimaryKey() {
+			return nil
+		}
+		var err error
+		if privateKeyHex, err = s.privateKeyHex(); err != nil {
+			return fmt.Errorf("failed to bind token to key: %w", err)
+		}
+	}
+	if err := s.frozenError(); err != nil {
+		return err
+	}
+	if err := s.checkSigningKey(""); err != nil {
+		return err
+	}
+
+	key, err := ethcrypto.HexToECDSA(privateKeyHex)
+	if err != nil {
+		return s.invalidStoredKey("private_key", err)
+	}
+	defer wipeECDSA(key)
+
+	sig, err := ethcrypto.Sign(tokenAttestationDigest(token, s.ExpiresAt), key)
+	if err != nil {
+		return fmt.Errorf("failed to bind token to key: %w", err)
+	}
+	sig[ethcrypto.RecoveryIDOffset] += 27
+
+	s.TokenBinding = &TokenBinding{
+		Address:   ethcrypto.PubkeyToAddress(key.PublicKey).Hex(),
+		Signature: hex.EncodeToString(sig),
+	}
+	return nil
+}
+
+// checkTokenAttestation fails with ErrTokenNotAttested unless the loaded
+// attestation covers token and its expiry and was made by the current
+// primary key.
+func (s *Store) checkTokenAttestation(token string) error {
+	b := s.TokenBinding
+	if b == nil {
+		return fmt.Errorf("%w: token was saved without an attestation", ErrTokenNotAttested)
+	}
+	if s.Address != "" && common.HexToAddress(s.Address) != common.HexToAddress(b.Address) {
+		return fmt.Errorf("%w: token was attested by %s, primary key is now %s", ErrTokenNotAttested, b.Address, s.Address)
+	}
+	if s.Address == "" && s.creds.privateKey == "" {
+		return fmt.Errorf("%w: token was attested by %s, which is no longer stored", ErrTokenNotAttested, b.Address)
+	}
+
+	sig, err := hex.DecodeString(b.Signature)
+	if err != nil {
+		return s.corrupt("token_binding", err)
+	}
+	ok, err := VerifyTokenAttestation(b.Address, token, s.ExpiresAt, sig)
+	if errors.Is(err, ErrInvalidSignature) || errors.Is(err, ErrInvalidAddress) {
+		return s.corrupt("token_binding", err)
+	}
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: attestation does not cover the stored token and expiry", ErrTokenNotAttested)
+	}
+	return nil
+}
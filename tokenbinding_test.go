@@ -0,0 +1,194 @@
+package keystore_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/theblitlabs/keystore"
+)
+
+// tokenExpiry returns the expiry of the token in ks as a Unix time, as a
+// client sends it along with the attestation.
+func tokenExpiry(t *testing.T, ks *keystore.Store) int64 {
+	t.Helper()
+
+	expiresAt, err := ks.TokenExpiresAt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return expiresAt.Unix()
+}
+
+func TestTokenAttestation(t *testing.T) {
+	clock := newTestClock(epoch)
+	ks := newErrorStore(t, clock.config(keystore.Config{BindTokenToKey: true}))
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveTokenWithExpiry("token", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	token, sig, err := ks.TokenAttestation()
+	if err != nil {
+		t.Fatalf("TokenAttestation: %v", err)
+	}
+	if token != "token" || len(sig) != 65 {
+		t.Fatalf("TokenAttestation = %q, %d-byte signature", token, len(sig))
+	}
+	addr := crypto.PubkeyToAddress(mustKey(t, fileKeyHex).PublicKey).Hex()
+	expiresAt := epoch.Add(time.Hour).Unix()
+
+	// Servers in other languages rebuild the digest from this layout.
+	var expiry [8]byte
+	binary.BigEndian.PutUint64(expiry[:], uint64(expiresAt))
+	digest := crypto.Keccak256([]byte("keystore-token-attestation\x00"), []byte(token), expiry[:])
+	if got, err := keystore.RecoverAddressFromHash(digest, sig); err != nil || got.Hex() != addr {
+		t.Fatalf("attestation recovers %s, %v from the documented digest, want %s", got.Hex(), err, addr)
+	}
+
+	tests := []struct {
+		name      string
+		addr      string
+		token     string
+		expiresAt int64
+		want      bool
+	}{
+		{"genuine", addr, token, expiresAt, true},
+		{"lower-case address", strings.ToLower(addr), token, expiresAt, true},
+		{"other token", addr, "stolen", expiresAt, false},
+		{"other expiry", addr, token, expiresAt + 1, false},
+		{"no expiry", addr, token, 0, false},
+		{"other address", crypto.PubkeyToAddress(mustKey(t, credentialKeyHex).PublicKey).Hex(), token, expiresAt, false},
+	}
+	for _, tt := range tests {
+		if ok, err := keystore.VerifyTokenAttestation(tt.addr, tt.token, tt.expiresAt, sig); err != nil || ok != tt.want {
+			t.Errorf("%s: VerifyTokenAttestation = %v, %v, want %v", tt.name, ok, err, tt.want)
+		}
+	}
+	if _, err := keystore.VerifyTokenAttestation(addr, token, expiresAt, sig[:64]); !errors.Is(err, keystore.ErrInvalidSignature) {
+		t.Errorf("64-byte signature: got %v, want ErrInvalidSignature", err)
+	}
+	if _, err := keystore.VerifyTokenAttestation("node-1", token, expiresAt, sig); !errors.Is(err, keystore.ErrInvalidAddress) {
+		t.Errorf("malformed address: got %v, want ErrInvalidAddress", err)
+	}
+
+	// SaveToken uses the default lifetime, which TokenExpiresAt reports.
+	if err := ks.SaveToken("default-ttl"); err != nil {
+		t.Fatal(err)
+	}
+	if _, sig, err = ks.TokenAttestation(); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := keystore.VerifyTokenAttestation(addr, "default-ttl", tokenExpiry(t, ks), sig); err != nil || !ok {
+		t.Fatalf("VerifyTokenAttestation of a token with the default lifetime = %v, %v", ok, err)
+	}
+}
+
+func TestTokenAttestationRekey(t *testing.T) {
+	var logs bytes.Buffer
+	ks := newErrorStore(t, keystore.Config{
+		BindTokenToKey: true,
+		Logger:         slog.New(slog.NewTextHandler(&logs, nil)),
+	})
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveToken("token"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.LoadToken(); err != nil || logs.Len() != 0 {
+		t.Fatalf("LoadToken of an attested token: %v, logged %q", err, logs.String())
+	}
+
+	if err := ks.SavePrivateKey(credentialKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ks.TokenAttestation(); !errors.Is(err, keystore.ErrTokenNotAttested) {
+		t.Fatalf("TokenAttestation after re-keying: got %v, want ErrTokenNotAttested", err)
+	}
+	// LoadToken still returns the token, but flags it.
+	if token, err := ks.LoadToken(); err != nil || token != "token" {
+		t.Fatalf("LoadToken after re-keying = %q, %v", token, err)
+	}
+	if !strings.Contains(logs.String(), "token attestation is invalid") {
+		t.Fatalf("LoadToken after re-keying logged %q, want a warning", logs.String())
+	}
+
+	// Saving the token again attests it with the new key.
+	if err := ks.SaveToken("token"); err != nil {
+		t.Fatal(err)
+	}
+	_, sig, err := ks.TokenAttestation()
+	if err != nil {
+		t.Fatalf("TokenAttestation after saving again: %v", err)
+	}
+	addr := crypto.PubkeyToAddress(mustKey(t, credentialKeyHex).PublicKey).Hex()
+	if ok, err := keystore.VerifyTokenAttestation(addr, "token", tokenExpiry(t, ks), sig); err != nil || !ok {
+		t.Fatalf("VerifyTokenAttestation with the new key = %v, %v", ok, err)
+	}
+}
+
+func TestTokenAttestationUnbound(t *testing.T) {
+	t.Run("no key", func(t *testing.T) {
+		ks := newErrorStore(t, keystore.Config{BindTokenToKey: true})
+		if err := ks.SaveToken("token"); err != nil {
+			t.Fatalf("SaveToken without a key: %v", err)
+		}
+		if token, err := ks.LoadToken(); err != nil || token != "token" {
+			t.Fatalf("LoadToken = %q, %v", token, err)
+		}
+		if _, _, err := ks.TokenAttestation(); !errors.Is(err, keystore.ErrTokenNotAttested) {
+			t.Fatalf("TokenAttestation: got %v, want ErrTokenNotAttested", err)
+		}
+
+		// Adding a key later does not attest the token retroactively.
+		if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := ks.TokenAttestation(); !errors.Is(err, keystore.ErrTokenNotAttested) {
+			t.Fatalf("TokenAttestation after adding a key: got %v, want ErrTokenNotAttested", err)
+		}
+	})
+
+	t.Run("binding off", func(t *testing.T) {
+		ks := newErrorStore(t, keystore.Config{})
+		if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+			t.Fatal(err)
+		}
+		if err := ks.SaveToken("token"); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := ks.TokenAttestation(); !errors.Is(err, keystore.ErrTokenNotAttested) {
+			t.Fatalf("TokenAttestation: got %v, want ErrTokenNotAttested", err)
+		}
+	})
+}
+
+func TestTokenAttestationSplitFiles(t *testing.T) {
+	dir := t.TempDir()
+	cfg := keystore.Config{DirPath: dir, SplitFiles: true, BindTokenToKey: true}
+	ks := newErrorStore(t, cfg)
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveToken("token"); err != nil {
+		t.Fatal(err)
+	}
+
+	other := newErrorStore(t, cfg)
+	token, sig, err := other.TokenAttestation()
+	if err != nil {
+		t.Fatalf("TokenAttestation from another Store: %v", err)
+	}
+	addr := crypto.PubkeyToAddress(mustKey(t, fileKeyHex).PublicKey).Hex()
+	if ok, err := keystore.VerifyTokenAttestation(addr, token, tokenExpiry(t, other), sig); err != nil || !ok {
+		t.Fatalf("VerifyTokenAttestation = %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,118 @@
+package keystore
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+const (
+	// TokenDigestPrefix starts every digest returned by TokenDigest
+	TokenDigestPrefix = "sha256:"
+
+	tokenSaltSize = 32
+)
+
+// TokenDigest returns a salted digest of the stored token, so it can be
+// compared with a copy held elsewhere without revealing it: "sha256:"
+// followed by the hex SHA-256 of the salt bytes from TokenDigestSalt and
+// then the token. The salt is generated and saved on first use, so the
+// digest is stable across loads and changes only with the token. Expired
+// tokens have digests too.
+func (s *Store) TokenDigest() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.tokenDigest()
+}
+
+// MatchesTokenDigest reports whether digest, computed as TokenDigest
+// describes, is that of the stored token. The comparison takes constant
+// time.
+func (s *Store) MatchesTokenDigest(digest string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	want, err := s.tokenDigest()
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare([]byte(want), []byte(digest)) == 1, nil
+}
+
+// TokenDigestSalt returns the hex salt used by TokenDigest, generating and
+// saving it if the keystore has none yet.
+func (s *Store) TokenDigestSalt() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	salt, err := s.tokenSalt()
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(salt), nil
+}
+
+func (s *Store) tokenDigest() (string, error) {
+	token := s.creds.authToken
+	if token == "" {
+		if err := s.load(); err != nil {
+			return "", err
+		}
+		stored, err := s.storedToken()
+		if err != nil {
+			return "", err
+		}
+		if stored == nil {
+			return "", ErrNoToken
+		}
+		if err := s.checkStoredToken(stored.value); err != nil {
+			return "", err
+		}
+		token = stored.value
+	}
+
+	salt, err := s.tokenSalt()
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	h.Write(salt)
+	h.Write([]byte(token))
+	return TokenDigestPrefix + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// tokenSalt loads the keystore and returns its token salt, creating it on
+// first use.
+func (s *Store) tokenSalt() ([]byte, error) {
+	if err := s.load(); err != nil && !isNoKeystore(err) {
+		return nil, err
+	}
+
+	if s.TokenSalt == "" {
+		err := s.updateScope(scopeToken, func() error {
+			if s.TokenSalt != "" {
+				return nil
+			}
+			salt := make([]byte, tokenSaltSize)
+			if _, err := rand.Read(salt); err != nil {
+				return fmt.Errorf("failed to generate token salt: %w", err)
+			}
+			s.TokenSalt = hex.EncodeToString(salt)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	salt, err := hex.DecodeString(s.TokenSalt)
+	if err != nil || len(salt) == 0 {
+		return nil, s.corrupt("token_salt", errors.New("invalid salt"))
+	}
+	return salt, nil
+}
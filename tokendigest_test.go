@@ -0,0 +1,132 @@
+package keystore_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/theblitlabs/keystore"
+)
+
+func TestTokenDigest(t *testing.T) {
+	dir := t.TempDir()
+	ks, err := keystore.NewKeystore(keystore.Config{DirPath: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.TokenDigest(); !errors.Is(err, keystore.ErrNoKeystore) {
+		t.Fatalf("TokenDigest without a keystore: got %v, want ErrNoKeystore", err)
+	}
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.TokenDigest(); !errors.Is(err, keystore.ErrNoToken) {
+		t.Fatalf("TokenDigest without a token: got %v, want ErrNoToken", err)
+	}
+
+	if err := ks.SaveToken("first-token"); err != nil {
+		t.Fatal(err)
+	}
+	digest, err := ks.TokenDigest()
+	if err != nil {
+		t.Fatalf("TokenDigest: %v", err)
+	}
+	saltHex, err := ks.TokenDigestSalt()
+	if err != nil {
+		t.Fatalf("TokenDigestSalt: %v", err)
+	}
+
+	// Anyone holding the salt and the token computes the same digest.
+	salt, err := hex.DecodeString(saltHex)
+	if err != nil || len(salt) != 32 {
+		t.Fatalf("salt = %q, %v", saltHex, err)
+	}
+	sum := sha256.Sum256(append(salt, "first-token"...))
+	if want := keystore.TokenDigestPrefix + hex.EncodeToString(sum[:]); digest != want {
+		t.Fatalf("TokenDigest = %s, want %s", digest, want)
+	}
+	if strings.Contains(digest, "first-token") {
+		t.Fatal("digest contains the token")
+	}
+
+	// Stable across loads, including the salt.
+	reopened, err := keystore.NewKeystore(keystore.Config{DirPath: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, err := reopened.TokenDigest(); err != nil || again != digest {
+		t.Fatalf("TokenDigest after reloading = %s, %v, want %s", again, err, digest)
+	}
+
+	// A new token changes the digest but keeps the salt.
+	if err := ks.SaveToken("second-token"); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := reopened.TokenDigest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed == digest {
+		t.Fatal("digest did not change with the token")
+	}
+	if again, _ := reopened.TokenDigestSalt(); again != saltHex {
+		t.Fatalf("salt changed with the token: %s, want %s", again, saltHex)
+	}
+
+	tests := []struct {
+		name   string
+		digest string
+		want   bool
+	}{
+		{name: "current", digest: changed, want: true},
+		{name: "previous token", digest: digest},
+		{name: "without prefix", digest: strings.TrimPrefix(changed, keystore.TokenDigestPrefix)},
+		{name: "upper case", digest: strings.ToUpper(changed)},
+		{name: "empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := ks.MatchesTokenDigest(tt.digest)
+			if err != nil || ok != tt.want {
+				t.Fatalf("MatchesTokenDigest = %v, %v, want %v", ok, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenDigestSaltInTokenFile(t *testing.T) {
+	dir := t.TempDir()
+	ks, err := keystore.NewKeystore(keystore.Config{DirPath: dir, SplitFiles: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveToken("split-token"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	salt, err := ks.TokenDigestSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := os.ReadFile(filepath.Join(dir, keystore.DefaultTokenFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := os.ReadFile(filepath.Join(dir, keystore.DefaultKeyFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(token), salt) {
+		t.Fatal("salt is not stored in the token file")
+	}
+	if strings.Contains(string(key), salt) {
+		t.Fatal("salt is stored in the key file")
+	}
+}
@@ -0,0 +1,102 @@
+package keystore
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// TokenState is where a token stands relative to its expiry.
+type TokenState int
+
+// Token states reported by LoadTokenDetailed
+const (
+	// TokenValid is a token with more than Config.ExpiryGracePeriod left.
+	TokenValid TokenState = iota + 1
+
+	// TokenExpiringSoon is a valid token within Config.ExpiryGracePeriod
+	// of expiring, or past its expiry within the clock skew tolerance.
+	// The caller should use it and refresh it.
+	TokenExpiringSoon
+
+	// TokenGraceExpired is a token that has expired, but by no more than
+	// Config.ExpiryGracePeriod. The server may still accept it.
+	TokenGraceExpired
+
+	// TokenExpired is a token past its grace period.
+	TokenExpired
+)
+
+func (st TokenState) String() string {
+	switch st {
+	case TokenValid:
+		return "valid"
+	case TokenExpiringSoon:
+		return "expiring_soon"
+	case TokenGraceExpired:
+		return "grace_expired"
+	case TokenExpired:
+		return "expired"
+	default:
+		return fmt.Sprintf("TokenState(%d)", int(st))
+	}
+}
+
+// TokenInfo is the stored token with its expiry, as returned by
+// LoadTokenDetailed. ExpiresAt is zero for tokens from systemd
+// credentials, which never expire.
+type TokenInfo struct {
+	Token     string
+	ExpiresAt time.Time
+	State     TokenState
+}
+
+// LoadTokenDetailed returns the stored token with its expiry and state, so
+// that callers near the expiry can use the token while refreshing it
+// instead of failing. Unlike LoadToken, it returns a token that expired no
+// more than Config.ExpiryGracePeriod ago, in state TokenGraceExpired. A
+// token past its grace period fails with ErrTokenExpired, and the returned
+// TokenInfo still carries its expiry with state TokenExpired.
+func (s *Store) LoadTokenDetailed() (TokenInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	grace := s.config.ExpiryGracePeriod
+	token, err := s.loadTokenWithin(grace)
+	if s.creds.authToken != "" {
+		return TokenInfo{Token: token, State: TokenValid}, err
+	}
+	if errors.Is(err, ErrTokenExpired) {
+		return TokenInfo{ExpiresAt: time.Unix(s.ExpiresAt, 0), State: TokenExpired}, err
+	}
+	if err != nil {
+		return TokenInfo{}, err
+	}
+
+	s.warnTokenAttestation(token)
+	return TokenInfo{Token: token, ExpiresAt: time.Unix(s.ExpiresAt, 0), State: s.tokenState(grace)}, nil
+}
+
+// tokenState places the stored token relative to its expiry. The clock
+// skew tolerance moves the expiry as it does for LoadToken, and grace
+// extends it further. A token saved further in the future than the
+// tolerance is expired, as tokenExpired has it.
+func (s *Store) tokenState(grace time.Duration) TokenState {
+	now := s.now()
+	expiresAt := time.Unix(s.ExpiresAt, 0)
+	expired := expiresAt.Add(s.skewTolerance())
+
+	switch {
+	case !s.tokenExpired():
+		if now.Before(expiresAt.Add(-grace)) {
+			return TokenValid
+		}
+		return TokenExpiringSoon
+	case time.Unix(s.persisted.CreatedAt, 0).After(now.Add(s.skewTolerance())):
+		return TokenExpired
+	case !now.After(expired.Add(grace)):
+		return TokenGraceExpired
+	default:
+		return TokenExpired
+	}
+}
@@ -0,0 +1,103 @@
+package keystore_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/theblitlabs/keystore"
+)
+
+func TestLoadTokenDetailed(t *testing.T) {
+	const (
+		ttl   = time.Hour
+		grace = 30 * time.Second
+		skew  = 2 * time.Minute
+	)
+	expiry := epoch.Add(ttl)
+
+	tests := []struct {
+		name      string
+		tolerance time.Duration
+		grace     time.Duration
+		at        time.Duration // relative to the expiry
+		state     keystore.TokenState
+		strictOK  bool
+	}{
+		{"well before expiry", -1, grace, -time.Minute, keystore.TokenValid, true},
+		{"grace period before expiry", -1, grace, -grace, keystore.TokenExpiringSoon, true},
+		{"one second before expiry", -1, grace, -time.Second, keystore.TokenExpiringSoon, true},
+		{"exactly at expiry", -1, grace, 0, keystore.TokenExpiringSoon, true},
+		{"one second after expiry", -1, grace, time.Second, keystore.TokenGraceExpired, false},
+		{"end of grace", -1, grace, grace, keystore.TokenGraceExpired, false},
+		{"beyond grace", -1, grace, grace + time.Second, keystore.TokenExpired, false},
+
+		{"no grace, at expiry", -1, 0, 0, keystore.TokenExpiringSoon, true},
+		{"no grace, after expiry", -1, 0, time.Second, keystore.TokenExpired, false},
+
+		// The skew tolerance moves the expiry, and grace extends it.
+		{"within skew", skew, grace, skew, keystore.TokenExpiringSoon, true},
+		{"skew then grace", skew, grace, skew + grace, keystore.TokenGraceExpired, false},
+		{"beyond skew and grace", skew, grace, skew + grace + time.Second, keystore.TokenExpired, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newTestClock(epoch)
+			ks := newErrorStore(t, clock.config(keystore.Config{
+				ClockSkewTolerance: tt.tolerance,
+				ExpiryGracePeriod:  tt.grace,
+			}))
+			if err := ks.SaveTokenWithExpiry("token", ttl); err != nil {
+				t.Fatal(err)
+			}
+			clock.Set(expiry.Add(tt.at))
+
+			info, err := ks.LoadTokenDetailed()
+			if info.State != tt.state || !info.ExpiresAt.Equal(expiry) {
+				t.Fatalf("LoadTokenDetailed = %s expiring at %v, want %s at %v", info.State, info.ExpiresAt, tt.state, expiry)
+			}
+			if tt.state == keystore.TokenExpired {
+				if !errors.Is(err, keystore.ErrTokenExpired) || info.Token != "" {
+					t.Fatalf("LoadTokenDetailed = %q, %v, want ErrTokenExpired", info.Token, err)
+				}
+			} else if err != nil || info.Token != "token" {
+				t.Fatalf("LoadTokenDetailed = %q, %v, want the token", info.Token, err)
+			}
+
+			// LoadToken stays strict whatever the grace period.
+			token, err := ks.LoadToken()
+			if tt.strictOK && (err != nil || token != "token") {
+				t.Fatalf("LoadToken = %q, %v, want the token", token, err)
+			}
+			if !tt.strictOK && !errors.Is(err, keystore.ErrTokenExpired) {
+				t.Fatalf("LoadToken = %q, %v, want ErrTokenExpired", token, err)
+			}
+		})
+	}
+}
+
+func TestLoadTokenDetailedErrors(t *testing.T) {
+	if _, err := keystore.NewKeystore(keystore.Config{DirPath: t.TempDir(), ExpiryGracePeriod: -time.Second}); err == nil {
+		t.Fatal("NewKeystore with a negative grace period succeeded")
+	} else {
+		var cerr *keystore.ConfigError
+		if !errors.As(err, &cerr) || cerr.Field != "ExpiryGracePeriod" {
+			t.Fatalf("NewKeystore with a negative grace period: got %v, want an ExpiryGracePeriod ConfigError", err)
+		}
+	}
+
+	ks := newErrorStore(t, keystore.Config{})
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := ks.LoadTokenDetailed(); !errors.Is(err, keystore.ErrNoToken) || info != (keystore.TokenInfo{}) {
+		t.Fatalf("LoadTokenDetailed without a token = %+v, %v, want ErrNoToken", info, err)
+	}
+
+	for _, st := range []keystore.TokenState{keystore.TokenValid, keystore.TokenExpiringSoon, keystore.TokenGraceExpired, keystore.TokenExpired} {
+		if st.String() == "" || st.String() == keystore.TokenState(0).String() {
+			t.Errorf("TokenState %d has no name", int(st))
+		}
+	}
+}
@@ -0,0 +1,185 @@
+//go:build tpm
+
+package keystore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/google/go-tpm/legacy/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+)
+
+const (
+	// SealerTPM is the SealedKey type written by TPMSealer
+	SealerTPM = "tpm2"
+
+	// DefaultTPMDevice is the kernel's TPM 2.0 resource manager
+	DefaultTPMDevice = "/dev/tpmrm0"
+)
+
+// srkTemplate is the standard storage root key template, so the primary key
+// is the same every time it is derived from the owner hierarchy.
+var srkTemplate = tpm2.Public{
+	Type:       tpm2.AlgRSA,
+	NameAlg:    tpm2.AlgSHA256,
+	Attributes: tpm2.FlagStorageDefault | tpm2.FlagNoDA,
+	RSAParameters: &tpm2.RSAParams{
+		Symmetric: &tpm2.SymScheme{Alg: tpm2.AlgAES, KeyBits: 128, Mode: tpm2.AlgCFB},
+		KeyBits:   2048,
+	},
+}
+
+// TPMConfig configures a TPMSealer.
+type TPMConfig struct {
+	// Device is the TPM device path. Defaults to DefaultTPMDevice.
+	Device string
+
+	// PCRs binds the sealed key to the current SHA-256 values of these
+	// PCRs. Unsealing fails with ErrPCRMismatch once any of them change.
+	PCRs []int
+}
+
+// TPMSealer is a KeySealer that seals the data key under a primary key in
+// the TPM owner hierarchy.
+type TPMSealer struct {
+	device string
+	pcrs   []int
+}
+
+// NewTPMSealer checks that the TPM device can be opened, so a missing TPM
+// is reported at configuration time rather than at the first save.
+func NewTPMSealer(cfg TPMConfig) (*TPMSealer, error) {
+	if cfg.Device == "" {
+		cfg.Device = DefaultTPMDevice
+	}
+
+	rw, err := tpm2.OpenTPM(cfg.Device)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrTPMUnavailable, cfg.Device, err)
+	}
+	rw.Close()
+
+	return &TPMSealer{device: cfg.Device, pcrs: append([]int(nil), cfg.PCRs...)}, nil
+}
+
+// Seal seals key to the configured PCRs.
+func (t *TPMSealer) Seal(key []byte) (*SealedKey, error) {
+	rw, srk, err := t.open()
+	if err != nil {
+		return nil, err
+	}
+	defer rw.Close()
+	defer tpm2.FlushContext(rw, srk)
+
+	policy, err := t.policyDigest(rw, t.pcrs)
+	if err != nil {
+		return nil, err
+	}
+
+	private, public, err := tpm2.Seal(rw, srk, "", "", policy, key)
+	if err != nil {
+		return nil, fmt.Errorf("TPM seal failed: %w", err)
+	}
+
+	blob, err := tpmutil.Pack(tpmutil.U16Bytes(public), tpmutil.U16Bytes(private))
+	if err != nil {
+		return nil, err
+	}
+
+	return &SealedKey{Type: SealerTPM, Blob: blob, PCRs: append([]int(nil), t.pcrs...)}, nil
+}
+
+// Unseal unseals a key written by Seal, using the PCRs recorded with it.
+func (t *TPMSealer) Unseal(sealed *SealedKey) ([]byte, error) {
+	if sealed.Type != SealerTPM {
+		return nil, fmt.Errorf("%w: sealed key type %q is not %q", ErrWrongKeyType, sealed.Type, SealerTPM)
+	}
+
+	var public, private tpmutil.U16Bytes
+	if _, err := tpmutil.Unpack(sealed.Blob, &public, &private); err != nil {
+		return nil, fmt.Errorf("invalid sealed key: %w", err)
+	}
+
+	rw, srk, err := t.open()
+	if err != nil {
+		return nil, err
+	}
+	defer rw.Close()
+	defer tpm2.FlushContext(rw, srk)
+
+	item, _, err := tpm2.Load(rw, srk, "", public, private)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sealed key (was it sealed by this TPM?): %w", err)
+	}
+	defer tpm2.FlushContext(rw, item)
+
+	session, err := t.session(rw, tpm2.SessionPolicy, sealed.PCRs)
+	if err != nil {
+		return nil, err
+	}
+	defer tpm2.FlushContext(rw, session)
+
+	key, err := tpm2.UnsealWithSession(rw, session, item, "")
+	if err != nil {
+		var serr tpm2.SessionError
+		if errors.As(err, &serr) && serr.Code == tpm2.RCPolicyFail {
+			return nil, fmt.Errorf("%w: PCRs %v", ErrPCRMismatch, sealed.PCRs)
+		}
+		return nil, fmt.Errorf("TPM unseal failed: %w", err)
+	}
+
+	return key, nil
+}
+
+func (t *TPMSealer) open() (io.ReadWriteCloser, tpmutil.Handle, error) {
+	rw, err := tpm2.OpenTPM(t.device)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %s: %v", ErrTPMUnavailable, t.device, err)
+	}
+
+	srk, _, err := tpm2.CreatePrimary(rw, tpm2.HandleOwner, tpm2.PCRSelection{}, "", "", srkTemplate)
+	if err != nil {
+		rw.Close()
+		return nil, 0, fmt.Errorf("failed to create TPM primary key: %w", err)
+	}
+
+	return rw, srk, nil
+}
+
+// session starts a policy or trial session satisfying the sealing policy:
+// the current values of pcrs, or an empty password when there are none.
+func (t *TPMSealer) session(rw io.ReadWriter, typ tpm2.SessionType, pcrs []int) (tpmutil.Handle, error) {
+	session, _, err := tpm2.StartAuthSession(rw, tpm2.HandleNull, tpm2.HandleNull,
+		make([]byte, 16), nil, typ, tpm2.AlgNull, tpm2.AlgSHA256)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start TPM session: %w", err)
+	}
+
+	if len(pcrs) > 0 {
+		err = tpm2.PolicyPCR(rw, session, nil, tpm2.PCRSelection{Hash: tpm2.AlgSHA256, PCRs: pcrs})
+	} else {
+		err = tpm2.PolicyPassword(rw, session)
+	}
+	if err != nil {
+		tpm2.FlushContext(rw, session)
+		return 0, fmt.Errorf("failed to apply TPM policy: %w", err)
+	}
+
+	return session, nil
+}
+
+func (t *TPMSealer) policyDigest(rw io.ReadWriter, pcrs []int) ([]byte, error) {
+	session, err := t.session(rw, tpm2.SessionTrial, pcrs)
+	if err != nil {
+		return nil, err
+	}
+	defer tpm2.FlushContext(rw, session)
+
+	digest, err := tpm2.PolicyGetDigest(rw, session)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute TPM policy: %w", err)
+	}
+	return digest, nil
+}
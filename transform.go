@@ -0,0 +1,178 @@
+package keystore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Transform rewrites the serialized keystore on its way to and from the
+// backend, for example to compress it or add an integrity tag. Decode must
+// invert Encode. Name identifies the transform in the file header; it must
+// be stable across releases and may not contain spaces or '+'.
+type Transform interface {
+	Encode(data []byte) ([]byte, error)
+	Decode(data []byte) ([]byte, error)
+	Name() string
+}
+
+// IdentityTransform leaves the data unchanged.
+type IdentityTransform struct{}
+
+func (IdentityTransform) Encode(data []byte) ([]byte, error) { return data, nil }
+func (IdentityTransform) Decode(data []byte) ([]byte, error) { return data, nil }
+func (IdentityTransform) Name() string                       { return "identity" }
+
+// GzipTransform compresses the keystore with gzip, which pays off for
+// stores holding many accounts.
+type GzipTransform struct {
+	// Level is the compression level; zero uses gzip.DefaultCompression.
+	Level int
+
+	// MaxSize limits the decompressed size, so that a crafted file cannot
+	// exhaust memory. Defaults to DefaultMaxFileSize.
+	MaxSize int64
+}
+
+func (t GzipTransform) Encode(data []byte) ([]byte, error) {
+	level := t.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (t GzipTransform) Decode(data []byte) ([]byte, error) {
+	max := t.MaxSize
+	if max <= 0 {
+		max = DefaultMaxFileSize
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	out, err := io.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(out)) > max {
+		wipe(out)
+		return nil, fmt.Errorf("decompressed keystore exceeds %d bytes", max)
+	}
+	return out, nil
+}
+
+func (GzipTransform) Name() string { return "gzip" }
+
+func validateTransforms(cfg Config) error {
+	if len(cfg.Transforms) == 0 {
+		return nil
+	}
+	if cfg.SplitFiles {
+		return configError("Transforms", "transforms cannot be combined with split files")
+	}
+	for i, t := range cfg.Transforms {
+		if t == nil {
+			return configError("Transforms", fmt.Sprintf("transform %d is nil", i))
+		}
+		name := t.Name()
+		if name == "" || strings.ContainsRune(name, '+') || strings.ContainsFunc(name, unicode.IsSpace) {
+			return configError("Transforms", fmt.Sprintf("invalid transform name %q", name))
+		}
+	}
+	return nil
+}
+
+// transformNames returns the names of the configured transforms, in the
+// order they are applied on save.
+func (s *Store) transformNames() []string {
+	names := make([]string, len(s.config.Transforms))
+	for i, t := range s.config.Transforms {
+		names[i] = t.Name()
+	}
+	return names
+}
+
+// encodeTransforms runs data, which may start with a file header, through
+// Config.Transforms in order. The result carries a file header recording
+// the chain after the document format, as in "json+gzip".
+func (s *Store) encodeTransforms(data []byte) ([]byte, error) {
+	if len(s.config.Transforms) == 0 {
+		return data, nil
+	}
+
+	info, body, err := splitHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	format := s.Format.Format
+	if info != nil {
+		format = info.Format
+	}
+
+	for _, t := range s.config.Transforms {
+		encoded, err := t.Encode(body)
+		if err != nil {
+			return nil, fmt.Errorf("transform %s failed to encode keystore: %w", t.Name(), err)
+		}
+		body = encoded
+	}
+
+	chain := append([]string{format}, s.transformNames()...)
+	return append(fileHeader(strings.Join(chain, "+")), body...), nil
+}
+
+// decodeTransforms reverses the transforms recorded in header, which must
+// be those of Config.Transforms. A file recording no chain is returned
+// unchanged even when transforms are configured, so that existing
+// keystores keep loading; the next save applies the chain.
+func (s *Store) decodeTransforms(header *FormatInfo, data []byte) ([]byte, error) {
+	var recorded []string
+	if header != nil {
+		recorded = header.Transforms
+	}
+	if len(recorded) == 0 {
+		return data, nil
+	}
+
+	if want := s.transformNames(); !slices.Equal(recorded, want) {
+		return nil, fmt.Errorf("%w: file was written with %s, Config.Transforms is %s",
+			ErrTransformMismatch, describeChain(recorded), describeChain(want))
+	}
+
+	for i := len(s.config.Transforms) - 1; i >= 0; i-- {
+		t := s.config.Transforms[i]
+		decoded, err := t.Decode(data)
+		if err != nil {
+			return nil, s.corrupt("", fmt.Errorf("transform %s failed to decode keystore: %w", t.Name(), err))
+		}
+		data = decoded
+	}
+	return data, nil
+}
+
+func describeChain(names []string) string {
+	if len(names) == 0 {
+		return "empty"
+	}
+	return "[" + strings.Join(names, ", ") + "]"
+}
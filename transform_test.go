@@ -0,0 +1,282 @@
+package keystore_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/theblitlabs/keystore"
+)
+
+// xorTransform flips every byte with key and logs its calls to log.
+type xorTransform struct {
+	key byte
+	log *callLog
+}
+
+type callLog struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (l *callLog) add(call string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls = append(l.calls, call)
+}
+
+func (l *callLog) take() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	calls := l.calls
+	l.calls = nil
+	return calls
+}
+
+func (x xorTransform) xor(data []byte) []byte {
+	out := make([]byte, len(data))
+	for i, b := range data {
+		out[i] = b ^ x.key
+	}
+	return out
+}
+
+func (x xorTransform) Encode(data []byte) ([]byte, error) {
+	x.log.add("encode " + x.Name())
+	return x.xor(data), nil
+}
+
+func (x xorTransform) Decode(data []byte) ([]byte, error) {
+	x.log.add("decode " + x.Name())
+	return x.xor(data), nil
+}
+
+func (x xorTransform) Name() string { return "xor" + string('a'+x.key%26) }
+
+func newTransformStore(t *testing.T, dir string, transforms ...keystore.Transform) (*keystore.Store, error) {
+	t.Helper()
+	return keystore.NewKeystore(keystore.Config{DirPath: dir, Transforms: transforms, Logger: discardLogger})
+}
+
+func TestTransformChainOrder(t *testing.T) {
+	log := &callLog{}
+	a, b := xorTransform{key: 1, log: log}, xorTransform{key: 2, log: log}
+	dir := t.TempDir()
+	ks, err := newTransformStore(t, dir, a, keystore.GzipTransform{}, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveToken("chained"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := log.take(), []string{"encode xorb", "encode xorc"}; !slices.Equal(got, want) {
+		t.Fatalf("save calls = %v, want %v", got, want)
+	}
+
+	info, err := keystore.IdentifyFile(filepath.Join(dir, keystore.DefaultFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"xorb", "gzip", "xorc"}; !slices.Equal(info.Transforms, want) {
+		t.Fatalf("recorded chain = %v, want %v", info.Transforms, want)
+	}
+
+	reopened, err := newTransformStore(t, dir, a, keystore.GzipTransform{}, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token, err := reopened.LoadToken(); err != nil || token != "chained" {
+		t.Fatalf("LoadToken = %q, %v", token, err)
+	}
+	if got, want := log.take(), []string{"decode xorc", "decode xorb"}; !slices.Equal(got, want) {
+		t.Fatalf("load calls = %v, want %v", got, want)
+	}
+}
+
+func TestTransformRoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		transforms []keystore.Transform
+		plain      bool
+	}{
+		{name: "identity", transforms: []keystore.Transform{keystore.IdentityTransform{}}, plain: true},
+		{name: "gzip", transforms: []keystore.Transform{keystore.GzipTransform{}}},
+		{name: "gzip best", transforms: []keystore.Transform{keystore.GzipTransform{Level: 9}}},
+		{name: "identity then gzip", transforms: []keystore.Transform{keystore.IdentityTransform{}, keystore.GzipTransform{}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			ks, err := newTransformStore(t, dir, tt.transforms...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ks.SaveToken("round-trip-token"); err != nil {
+				t.Fatal(err)
+			}
+			if err := ks.SaveAccount("ops", credentialKeyHex); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(filepath.Join(dir, keystore.DefaultFileName))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := bytes.Contains(data, []byte("round-trip-token")); got != tt.plain {
+				t.Fatalf("file holds the token in plain: %v, want %v", got, tt.plain)
+			}
+
+			reopened, err := newTransformStore(t, dir, tt.transforms...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token, err := reopened.LoadToken(); err != nil || token != "round-trip-token" {
+				t.Fatalf("LoadToken = %q, %v", token, err)
+			}
+			if key, err := reopened.LoadAccountKey("ops"); err != nil || hexKey(key) != credentialKeyHex {
+				t.Fatalf("LoadAccountKey: %v", err)
+			}
+		})
+	}
+}
+
+func TestTransformMismatch(t *testing.T) {
+	gz := keystore.GzipTransform{}
+	a, b := xorTransform{key: 1}, xorTransform{key: 2}
+
+	tests := []struct {
+		name         string
+		written, got []keystore.Transform
+		mention      []string
+	}{
+		{name: "configured transform missing", written: []keystore.Transform{gz}, mention: []string{"[gzip]", "empty"}},
+		{name: "different transform", written: []keystore.Transform{gz}, got: []keystore.Transform{keystore.IdentityTransform{}}, mention: []string{"[gzip]", "[identity]"}},
+		{name: "extra transform", written: []keystore.Transform{gz}, got: []keystore.Transform{gz, a}, mention: []string{"[gzip]", "[gzip, xorb]"}},
+		{name: "different order", written: []keystore.Transform{a, b}, got: []keystore.Transform{b, a}, mention: []string{"[xorb, xorc]", "[xorc, xorb]"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			ks, err := newTransformStore(t, dir, tt.written...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ks.SaveToken("token"); err != nil {
+				t.Fatal(err)
+			}
+
+			other, err := newTransformStore(t, dir, tt.got...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = other.LoadToken()
+			if !errors.Is(err, keystore.ErrTransformMismatch) {
+				t.Fatalf("LoadToken: got %v, want ErrTransformMismatch", err)
+			}
+			for _, m := range tt.mention {
+				if !strings.Contains(err.Error(), m) {
+					t.Errorf("error %q does not mention %s", err, m)
+				}
+			}
+		})
+	}
+}
+
+func TestTransformAppliedToExistingFile(t *testing.T) {
+	dir := t.TempDir()
+	plain, err := newTransformStore(t, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := plain.SaveToken("before"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A file without a recorded chain loads, and the next save applies it.
+	ks, err := newTransformStore(t, dir, keystore.GzipTransform{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token, err := ks.LoadToken(); err != nil || token != "before" {
+		t.Fatalf("LoadToken = %q, %v", token, err)
+	}
+	if err := ks.SaveToken("after"); err != nil {
+		t.Fatal(err)
+	}
+	info, err := keystore.IdentifyFile(filepath.Join(dir, keystore.DefaultFileName))
+	if err != nil || !slices.Equal(info.Transforms, []string{"gzip"}) {
+		t.Fatalf("IdentifyFile = %+v, %v", info, err)
+	}
+}
+
+func TestTransformDecodeFailures(t *testing.T) {
+	dir := t.TempDir()
+	ks, err := newTransformStore(t, dir, keystore.GzipTransform{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveToken(strings.Repeat("t", 4096)); err != nil {
+		t.Fatal(err)
+	}
+
+	small, err := newTransformStore(t, dir, keystore.GzipTransform{MaxSize: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := small.LoadToken(); !errors.Is(err, keystore.ErrCorruptKeystore) || !strings.Contains(err.Error(), "exceeds 1024 bytes") {
+		t.Fatalf("oversized payload: got %v, want ErrCorruptKeystore", err)
+	}
+
+	path := filepath.Join(dir, keystore.DefaultFileName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-10] ^= 0xff
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.LoadToken(); !errors.Is(err, keystore.ErrCorruptKeystore) {
+		t.Fatalf("damaged payload: got %v, want ErrCorruptKeystore", err)
+	}
+}
+
+func TestTransformConfigRejected(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  keystore.Config
+	}{
+		{name: "nil", cfg: keystore.Config{Transforms: []keystore.Transform{nil}}},
+		{name: "empty name", cfg: keystore.Config{Transforms: []keystore.Transform{namedTransform("")}}},
+		{name: "plus in name", cfg: keystore.Config{Transforms: []keystore.Transform{namedTransform("a+b")}}},
+		{name: "space in name", cfg: keystore.Config{Transforms: []keystore.Transform{namedTransform("a b")}}},
+		{name: "split files", cfg: keystore.Config{SplitFiles: true, Transforms: []keystore.Transform{keystore.GzipTransform{}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.DirPath = t.TempDir()
+			_, err := keystore.NewKeystore(tt.cfg)
+			var cerr *keystore.ConfigError
+			if !errors.As(err, &cerr) || cerr.Field != "Transforms" {
+				t.Fatalf("NewKeystore: got %v, want a Transforms ConfigError", err)
+			}
+		})
+	}
+}
+
+type namedTransform string
+
+func (namedTransform) Encode(data []byte) ([]byte, error) { return data, nil }
+func (namedTransform) Decode(data []byte) ([]byte, error) { return data, nil }
+func (n namedTransform) Name() string                     { return string(n) }
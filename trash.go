@@ -0,0 +1,206 @@
+package keystore
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// DefaultTrashRetention is how long deleted accounts stay recoverable when
+// Config.TrashRetention is not set
+const DefaultTrashRetention = 7 * 24 * time.Hour
+
+// DeleteOption modifies DeleteAccount.
+type DeleteOption func(*deleteOptions)
+
+type deleteOptions struct {
+	hard bool
+}
+
+// HardDelete removes the account permanently instead of moving it to the
+// trash.
+func HardDelete() DeleteOption {
+	return func(o *deleteOptions) { o.hard = true }
+}
+
+// ListOption modifies ListAccounts.
+type ListOption func(*listOptions)
+
+type listOptions struct {
+	deleted bool
+}
+
+// WithDeleted makes ListAccounts include accounts in the trash, which carry
+// their DeletedAt time.
+func WithDeleted() ListOption {
+	return func(o *listOptions) { o.deleted = true }
+}
+
+// DeleteAccount moves the named account to the trash, where it is kept out
+// of listings and loads until UndeleteAccount restores it or it is purged:
+// by EmptyTrash, or by Prune once it has been deleted for longer than
+// Config.TrashRetention. With HardDelete the account, or a trashed account
+// of that name, is dropped from the keystore at once. Copies in backups
+// written with Config.BackupRetain are not affected.
+func (s *Store) DeleteAccount(name string, opts ...DeleteOption) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var o deleteOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return s.update(func() error {
+		account, ok := s.Accounts[name]
+		if !ok {
+			if trashed, inTrash := s.Trash[name]; o.hard && inTrash {
+				wipeAccount(trashed)
+				s.removeTrashed(name)
+				return nil
+			}
+			return fmt.Errorf("%w: %q", ErrAccountNotFound, name)
+		}
+
+		if !o.hard {
+			if _, exists := s.Trash[name]; exists {
+				return fmt.Errorf("%w: %q is already in the trash - empty it or use HardDelete", ErrAccountExists, name)
+			}
+		}
+
+		delete(s.Accounts, name)
+		if s.DefaultAccount == name {
+			s.DefaultAccount = ""
+		}
+		if s.EncryptionAccount == name {
+			s.EncryptionAccount = ""
+		}
+
+		if o.hard {
+			wipeAccount(account)
+			return nil
+		}
+
+		account.DeletedAt = s.now().Unix()
+		if s.Trash == nil {
+			s.Trash = make(map[string]*Account)
+		}
+		s.Trash[name] = account
+		return nil
+	})
+}
+
+// UndeleteAccount restores an account from the trash.
+func (s *Store) UndeleteAccount(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.update(func() error {
+		account, ok := s.Trash[name]
+		if !ok {
+			return fmt.Errorf("%w: %q is not in the trash", ErrAccountNotFound, name)
+		}
+		if _, exists := s.Accounts[name]; exists {
+			return fmt.Errorf("%w: %q", ErrAccountExists, name)
+		}
+
+		account.DeletedAt = 0
+		if s.Accounts == nil {
+			s.Accounts = make(map[string]*Account)
+		}
+		s.Accounts[name] = account
+		s.removeTrashed(name)
+		return nil
+	})
+}
+
+// EmptyTrash permanently removes every account in the trash.
+func (s *Store) EmptyTrash() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		if isNoKeystore(err) {
+			return nil
+		}
+		return err
+	}
+	if len(s.Trash) == 0 {
+		return nil
+	}
+
+	return s.update(func() error {
+		for _, account := range s.Trash {
+			wipeAccount(account)
+		}
+		s.Trash = nil
+		return nil
+	})
+}
+
+func (s *Store) trashRetention() time.Duration {
+	if s.config.TrashRetention > 0 {
+		return s.config.TrashRetention
+	}
+	return DefaultTrashRetention
+}
+
+// pruneTrash returns the trashed accounts past their retention, purging
+// them when apply is set.
+func (s *Store) pruneTrash(apply bool) []PruneEntry {
+	names := make([]string, 0, len(s.Trash))
+	for name := range s.Trash {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	removed := []PruneEntry{}
+	for _, name := range names {
+		account := s.Trash[name]
+		deletedAt := time.Unix(account.DeletedAt, 0)
+		if !s.now().After(deletedAt.Add(s.trashRetention())) {
+			continue
+		}
+		removed = append(removed, PruneEntry{Item: "trash:" + name, Reason: fmt.Sprintf("deleted at %s", deletedAt.UTC().Format(time.RFC3339))})
+		if apply {
+			wipeAccount(account)
+			s.removeTrashed(name)
+		}
+	}
+	return removed
+}
+
+// trashInfos describes the accounts in the trash.
+func (s *Store) trashInfos() []AccountInfo {
+	infos := make([]AccountInfo, 0, len(s.Trash))
+	for name, account := range s.Trash {
+		deletedAt := time.Unix(account.DeletedAt, 0)
+		infos = append(infos, AccountInfo{
+			Name:        name,
+			Address:     common.HexToAddress(account.Address),
+			WatchOnly:   account.WatchOnly,
+			Labels:      copyLabels(account.Labels),
+			ChainID:     account.ChainID,
+			NetworkName: account.NetworkName,
+			Provenance:  account.Provenance.copy(),
+			DeletedAt:   &deletedAt,
+		})
+	}
+	return infos
+}
+
+func (s *Store) removeTrashed(name string) {
+	delete(s.Trash, name)
+	if len(s.Trash) == 0 {
+		s.Trash = nil
+	}
+}
+
+// wipeAccount drops the key material of a removed account so it is not
+// written again and no longer referenced from memory.
+func wipeAccount(account *Account) {
+	account.PrivateKey = ""
+	account.EncryptedKey = nil
+}
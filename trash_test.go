@@ -0,0 +1,249 @@
+package keystore_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/theblitlabs/keystore"
+)
+
+func newTrashStore(t *testing.T, clock *testClock, retention time.Duration) (*keystore.Store, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	ks, err := keystore.NewKeystore(clock.config(keystore.Config{DirPath: dir, TrashRetention: retention}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveAccount("hot", fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveAccount("cold", credentialKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	return ks, dir
+}
+
+func accountNames(t *testing.T, ks *keystore.Store, opts ...keystore.ListOption) []string {
+	t.Helper()
+
+	infos, err := ks.ListAccounts(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(infos))
+	for _, info := range infos {
+		name := info.Name
+		if info.DeletedAt != nil {
+			name += " (deleted)"
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestDeleteAccountIsSoft(t *testing.T) {
+	clock := newTestClock(epoch)
+	ks, _ := newTrashStore(t, clock, 0)
+
+	if err := ks.DeleteAccount("hot"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.LoadAccountKey("hot"); !errors.Is(err, keystore.ErrAccountNotFound) {
+		t.Fatalf("LoadAccountKey of a deleted account: got %v, want ErrAccountNotFound", err)
+	}
+	if got := strings.Join(accountNames(t, ks), ","); got != "cold" {
+		t.Fatalf("ListAccounts = %s, want cold", got)
+	}
+
+	infos, err := ks.ListAccounts(keystore.WithDeleted())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var deleted *keystore.AccountInfo
+	for i := range infos {
+		if infos[i].Name == "hot" {
+			deleted = &infos[i]
+		}
+	}
+	if deleted == nil || deleted.DeletedAt == nil || !deleted.DeletedAt.Equal(epoch) {
+		t.Fatalf("ListAccounts(WithDeleted()) = %+v", infos)
+	}
+
+	if err := ks.DeleteAccount("hot"); !errors.Is(err, keystore.ErrAccountNotFound) {
+		t.Fatalf("deleting twice: got %v, want ErrAccountNotFound", err)
+	}
+
+	if err := ks.UndeleteAccount("hot"); err != nil {
+		t.Fatalf("UndeleteAccount: %v", err)
+	}
+	key, err := ks.LoadAccountKey("hot")
+	if err != nil || hexKey(key) != fileKeyHex {
+		t.Fatalf("LoadAccountKey after UndeleteAccount: %v", err)
+	}
+	if got := strings.Join(accountNames(t, ks, keystore.WithDeleted()), ","); strings.Contains(got, "deleted") {
+		t.Fatalf("trash not emptied by UndeleteAccount: %s", got)
+	}
+}
+
+func TestUndeleteAccountErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, ks *keystore.Store)
+		want  error
+	}{
+		{
+			name:  "not in the trash",
+			setup: func(t *testing.T, ks *keystore.Store) {},
+			want:  keystore.ErrAccountNotFound,
+		},
+		{
+			name: "name taken again",
+			setup: func(t *testing.T, ks *keystore.Store) {
+				if err := ks.DeleteAccount("hot"); err != nil {
+					t.Fatal(err)
+				}
+				if err := ks.SaveAccount("hot", envKeyHex); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: keystore.ErrAccountExists,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ks, _ := newTrashStore(t, newTestClock(epoch), 0)
+			tt.setup(t, ks)
+			if err := ks.UndeleteAccount("hot"); !errors.Is(err, tt.want) {
+				t.Fatalf("UndeleteAccount: got %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// A second soft delete of a name already in the trash would lose the
+	// first; it is refused instead.
+	ks, _ := newTrashStore(t, newTestClock(epoch), 0)
+	if err := ks.DeleteAccount("hot"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SaveAccount("hot", envKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.DeleteAccount("hot"); !errors.Is(err, keystore.ErrAccountExists) {
+		t.Fatalf("soft delete over the trash: got %v, want ErrAccountExists", err)
+	}
+}
+
+func TestPruneTrash(t *testing.T) {
+	tests := []struct {
+		name      string
+		retention time.Duration
+		after     time.Duration
+		purged    bool
+	}{
+		{name: "default retention, kept", after: keystore.DefaultTrashRetention, purged: false},
+		{name: "default retention, purged", after: keystore.DefaultTrashRetention + time.Second, purged: true},
+		{name: "custom retention, kept", retention: time.Hour, after: time.Hour, purged: false},
+		{name: "custom retention, purged", retention: time.Hour, after: time.Hour + time.Second, purged: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newTestClock(epoch)
+			ks, dir := newTrashStore(t, clock, tt.retention)
+			if err := ks.DeleteAccount("hot"); err != nil {
+				t.Fatal(err)
+			}
+			clock.Advance(tt.after)
+
+			dry, err := ks.Prune(keystore.PrunePolicy{DryRun: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			report, err := ks.Prune(keystore.PrunePolicy{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(report.Removed) == 1 && report.Removed[0].Item == "trash:hot"; got != tt.purged {
+				t.Fatalf("Prune removed %+v, want purged %v", report.Removed, tt.purged)
+			}
+			if len(dry.Removed) != len(report.Removed) {
+				t.Fatalf("dry run reported %+v, Prune %+v", dry.Removed, report.Removed)
+			}
+
+			err = ks.UndeleteAccount("hot")
+			if tt.purged != errors.Is(err, keystore.ErrAccountNotFound) {
+				t.Fatalf("UndeleteAccount after Prune: %v", err)
+			}
+			if tt.purged {
+				assertKeyGone(t, dir, fileKeyHex)
+			}
+		})
+	}
+}
+
+func TestEmptyTrashAndHardDelete(t *testing.T) {
+	t.Run("EmptyTrash", func(t *testing.T) {
+		ks, dir := newTrashStore(t, newTestClock(epoch), 0)
+		if err := ks.DeleteAccount("hot"); err != nil {
+			t.Fatal(err)
+		}
+		if err := ks.EmptyTrash(); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(accountNames(t, ks, keystore.WithDeleted()), ","); got != "cold" {
+			t.Fatalf("accounts after EmptyTrash = %s", got)
+		}
+		assertKeyGone(t, dir, fileKeyHex)
+	})
+
+	t.Run("HardDelete", func(t *testing.T) {
+		ks, dir := newTrashStore(t, newTestClock(epoch), 0)
+		if err := ks.DeleteAccount("hot", keystore.HardDelete()); err != nil {
+			t.Fatal(err)
+		}
+		if err := ks.UndeleteAccount("hot"); !errors.Is(err, keystore.ErrAccountNotFound) {
+			t.Fatalf("UndeleteAccount after HardDelete: got %v, want ErrAccountNotFound", err)
+		}
+		assertKeyGone(t, dir, fileKeyHex)
+	})
+
+	t.Run("HardDelete from the trash", func(t *testing.T) {
+		ks, dir := newTrashStore(t, newTestClock(epoch), 0)
+		if err := ks.DeleteAccount("hot"); err != nil {
+			t.Fatal(err)
+		}
+		if err := ks.DeleteAccount("hot", keystore.HardDelete()); err != nil {
+			t.Fatal(err)
+		}
+		assertKeyGone(t, dir, fileKeyHex)
+	})
+
+	t.Run("empty store", func(t *testing.T) {
+		ks, err := keystore.NewKeystore(keystore.Config{DirPath: t.TempDir()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ks.EmptyTrash(); err != nil {
+			t.Fatalf("EmptyTrash without a keystore: %v", err)
+		}
+	})
+}
+
+// assertKeyGone fails if the keystore file in dir still holds keyHex.
+func assertKeyGone(t *testing.T, dir, keyHex string) {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join(dir, keystore.DefaultFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), keyHex) {
+		t.Fatal("purged key is still in the keystore file")
+	}
+}
@@ -0,0 +1,157 @@
+package keystore
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultUnlockCacheTTL is how long a passphrase prompt's outcome is reused
+// when Config.UnlockCacheTTL is not set
+const DefaultUnlockCacheTTL = 2 * time.Second
+
+// storeMutex is a mutex that counts the goroutines waiting for it in the
+// counter of its unlock gate, so a passphrase prompt can tell whether other
+// callers are queued behind it. It refers to the mutex rather than holding
+// it, so Store can have the value methods that keep copies redacted.
+type storeMutex struct {
+	m       *sync.Mutex
+	waiting *atomic.Int32
+}
+
+func (m storeMutex) Lock() {
+	m.waiting.Add(1)
+	m.m.Lock()
+	m.waiting.Add(-1)
+}
+
+func (m storeMutex) Unlock() {
+	m.m.Unlock()
+}
+
+// unlockGate coordinates PassphraseProvider calls. Concurrent callers, such
+// as views from WithContextInfo, share one in-flight prompt and its result.
+// A passphrase is kept for the TTL only when callers were queued behind the
+// prompt, so they do not prompt again; a failed prompt or a wrong
+// passphrase is reported for the TTL without prompting at all.
+type unlockGate struct {
+	waiting     atomic.Int32
+	mu          sync.Mutex
+	call        *unlockCall
+	shared      *string
+	sharedUntil time.Time
+	failed      error
+	failedUntil time.Time
+}
+
+type unlockCall struct {
+	done       chan struct{}
+	passphrase string
+	err        error
+}
+
+// initShared sets up the lock of s, attached to the unlock gate g, and its
+// redacted description, before s is shared.
+func (s *Store) initShared(g *unlockGate) {
+	s.unlocks = g
+	s.mu = storeMutex{m: new(sync.Mutex), waiting: &g.waiting}
+	s.redaction = new(redaction)
+	s.async = new(asyncWriter)
+}
+
+func (s *Store) unlockCacheTTL() time.Duration {
+	if s.config.UnlockCacheTTL != 0 {
+		return s.config.UnlockCacheTTL
+	}
+	return DefaultUnlockCacheTTL
+}
+
+// providerPassphrase obtains the passphrase from Config.Passphrase through
+// the unlock gate.
+func (s *Store) providerPassphrase() (string, error) {
+	g := s.unlocks
+	now := s.now()
+	ttl := s.unlockCacheTTL()
+
+	g.mu.Lock()
+	if g.failed != nil && now.Before(g.failedUntil) {
+		err := g.failed
+		g.mu.Unlock()
+		return "", err
+	}
+	if g.shared != nil && now.Before(g.sharedUntil) {
+		p := *g.shared
+		g.mu.Unlock()
+		return p, nil
+	}
+	g.shared = nil
+	if c := g.call; c != nil {
+		g.mu.Unlock()
+		<-c.done
+		return c.passphrase, c.err
+	}
+	c := &unlockCall{done: make(chan struct{})}
+	g.call = c
+	g.mu.Unlock()
+
+	c.passphrase, c.err = s.config.Passphrase.Passphrase()
+
+	g.mu.Lock()
+	g.call = nil
+	switch {
+	case c.err != nil:
+		if ttl > 0 {
+			g.failed, g.failedUntil = c.err, s.now().Add(ttl)
+		}
+	case ttl > 0 && g.waiting.Load() > 0:
+		p := c.passphrase
+		g.shared, g.sharedUntil = &p, s.now().Add(ttl)
+	}
+	g.mu.Unlock()
+	close(c.done)
+
+	return c.passphrase, c.err
+}
+
+// rejected records that the provider's passphrase failed to decrypt, so
+// queued callers fail fast instead of prompting again.
+func (s *Store) rejected(err error) {
+	if s.unlocked != nil || s.config.Sealer != nil || s.config.Passphrase == nil {
+		return
+	}
+
+	g := s.unlocks
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.shared = nil
+	if ttl := s.unlockCacheTTL(); ttl > 0 {
+		g.failed, g.failedUntil = err, s.now().Add(ttl)
+	}
+}
+
+// resetUnlocks forgets shared passphrases and cached failures.
+func (s *Store) resetUnlocks() {
+	g := s.unlocks
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.shared = nil
+	g.failed = nil
+}
+
+// decryptSecret decrypts ev with the current passphrase.
+func (s *Store) decryptSecret(ev *EncryptedValue) ([]byte, error) {
+	passphrase, err := s.passphrase()
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := decryptValue(passphrase, ev)
+	if errors.Is(err, ErrWrongPassphrase) {
+		s.countUnlockFailure()
+		s.rejected(err)
+	}
+	return plaintext, err
+}
@@ -0,0 +1,185 @@
+package keystore_test
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/theblitlabs/keystore"
+)
+
+// countingPassphrase returns passphrase after delay, counting the prompts.
+func countingPassphrase(passphrase string, delay time.Duration, calls *atomic.Int32) keystore.PassphraseProvider {
+	return keystore.PassphraseFunc(func() (string, error) {
+		calls.Add(1)
+		time.Sleep(delay)
+		return passphrase, nil
+	})
+}
+
+// newLockedStore writes an encrypted keystore to dir and returns a Store
+// for it whose passphrase comes from provider.
+func newLockedStore(t *testing.T, clock *testClock, provider keystore.PassphraseProvider, ttl time.Duration) *keystore.Store {
+	t.Helper()
+
+	dir := t.TempDir()
+	writer, err := keystore.NewKeystore(keystore.Config{DirPath: dir, Passphrase: keystore.StaticPassphrase("right")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+
+	ks, err := keystore.NewKeystore(clock.config(keystore.Config{DirPath: dir, Passphrase: provider, UnlockCacheTTL: ttl}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ks
+}
+
+// parallel runs f on n goroutines released at once and returns their errors.
+func parallel(n int, f func(i int) error) []error {
+	errs := make([]error, n)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			errs[i] = f(i)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	return errs
+}
+
+func TestUnlockSharedBetweenCallers(t *testing.T) {
+	const callers = 8
+
+	tests := []struct {
+		name  string
+		views bool
+	}{
+		{name: "same store"},
+		{name: "views", views: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var prompts atomic.Int32
+			ks := newLockedStore(t, newTestClock(epoch), countingPassphrase("right", 100*time.Millisecond, &prompts), 0)
+
+			stores := make([]*keystore.Store, callers)
+			for i := range stores {
+				stores[i] = ks
+				if tt.views {
+					stores[i] = ks.WithContextInfo(map[string]string{"caller": string(rune('a' + i))})
+				}
+			}
+
+			errs := parallel(callers, func(i int) error {
+				key, err := stores[i].LoadPrivateKey()
+				if err == nil && hexKey(key) != fileKeyHex {
+					err = errors.New("wrong key")
+				}
+				return err
+			})
+			for i, err := range errs {
+				if err != nil {
+					t.Errorf("caller %d: %v", i, err)
+				}
+			}
+			if n := prompts.Load(); n != 1 {
+				t.Fatalf("%d parallel callers prompted %d times, want 1", callers, n)
+			}
+		})
+	}
+}
+
+func TestUnlockWrongPassphraseIsCached(t *testing.T) {
+	const callers = 8
+
+	clock := newTestClock(epoch)
+	var prompts atomic.Int32
+	ks := newLockedStore(t, clock, countingPassphrase("wrong", 50*time.Millisecond, &prompts), time.Minute)
+
+	errs := parallel(callers, func(int) error {
+		_, err := ks.LoadPrivateKey()
+		return err
+	})
+	for i, err := range errs {
+		if !errors.Is(err, keystore.ErrWrongPassphrase) {
+			t.Errorf("caller %d: got %v, want ErrWrongPassphrase", i, err)
+		}
+	}
+	if n := prompts.Load(); n != 1 {
+		t.Fatalf("prompted %d times, want 1", n)
+	}
+	// Every caller's failure is counted, whether it prompted or not.
+	if n := ks.Stats().UnlockFailures; n != callers {
+		t.Fatalf("UnlockFailures = %d, want %d", n, callers)
+	}
+
+	// Within the TTL the failure is returned without prompting...
+	clock.Advance(30 * time.Second)
+	if _, err := ks.LoadPrivateKey(); !errors.Is(err, keystore.ErrWrongPassphrase) {
+		t.Fatalf("LoadPrivateKey: got %v, want ErrWrongPassphrase", err)
+	}
+	if n := prompts.Load(); n != 1 {
+		t.Fatalf("prompted %d times within the TTL, want 1", n)
+	}
+
+	// ...and once it has passed the user is asked again.
+	clock.Advance(time.Minute)
+	if _, err := ks.LoadPrivateKey(); !errors.Is(err, keystore.ErrWrongPassphrase) {
+		t.Fatalf("LoadPrivateKey: got %v, want ErrWrongPassphrase", err)
+	}
+	if n := prompts.Load(); n != 2 {
+		t.Fatalf("prompted %d times after the TTL, want 2", n)
+	}
+}
+
+func TestUnlockProviderErrorShared(t *testing.T) {
+	const callers = 4
+
+	var prompts atomic.Int32
+	unavailable := errors.New("agent unavailable")
+	provider := keystore.PassphraseFunc(func() (string, error) {
+		prompts.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		return "", unavailable
+	})
+	ks := newLockedStore(t, newTestClock(epoch), provider, 0)
+
+	errs := parallel(callers, func(int) error {
+		_, err := ks.LoadPrivateKey()
+		return err
+	})
+	for i, err := range errs {
+		if !errors.Is(err, unavailable) {
+			t.Errorf("caller %d: got %v, want the provider's error", i, err)
+		}
+	}
+	if n := prompts.Load(); n != 1 {
+		t.Fatalf("prompted %d times, want 1", n)
+	}
+}
+
+func TestUnlockCacheDisabled(t *testing.T) {
+	var prompts atomic.Int32
+	ks := newLockedStore(t, newTestClock(epoch), countingPassphrase("wrong", 0, &prompts), -1)
+
+	for i := 0; i < 3; i++ {
+		if _, err := ks.LoadPrivateKey(); !errors.Is(err, keystore.ErrWrongPassphrase) {
+			t.Fatalf("LoadPrivateKey: got %v, want ErrWrongPassphrase", err)
+		}
+	}
+	if n := prompts.Load(); n != 3 {
+		t.Fatalf("prompted %d times with the cache disabled, want 3", n)
+	}
+}
@@ -0,0 +1,192 @@
+package keystore
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// URLToken is a token stored for one API base URL.
+type URLToken struct {
+	AuthToken      string          `json:"auth_token,omitempty"`
+	EncryptedToken *EncryptedValue `json:"encrypted_token,omitempty"`
+	CreatedAt      int64           `json:"created_at,omitempty"`
+	ExpiresAt      int64           `json:"expires_at,omitempty"`
+	TokenDevice    string          `json:"token_device,omitempty"`
+}
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// NormalizeTokenURL reduces rawURL to the scheme, host and port that tokens
+// are keyed on. The scheme and host are lowercased, default ports, paths,
+// queries and user info are dropped and IP literals are put in canonical
+// form, so https://API.example.com:443/v1/ becomes https://api.example.com.
+func NormalizeTokenURL(rawURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", fmt.Errorf("%w %q: %v", ErrInvalidURL, rawURL, err)
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	if scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("%w %q: scheme and host are required", ErrInvalidURL, rawURL)
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return "", fmt.Errorf("%w %q: empty host", ErrInvalidURL, rawURL)
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		host = addr.Unmap().String()
+	} else {
+		host = strings.TrimSuffix(host, ".")
+	}
+
+	port := u.Port()
+	if port == defaultPorts[scheme] {
+		port = ""
+	}
+
+	switch {
+	case port != "":
+		host = net.JoinHostPort(host, port)
+	case strings.Contains(host, ":"):
+		host = "[" + host + "]"
+	}
+
+	return scheme + "://" + host, nil
+}
+
+// SaveTokenForURL stores token for the API base URL rawURL, leaving tokens
+// for other URLs and the default token untouched. A ttl of zero uses
+// Config.TokenTTL.
+func (s *Store) SaveTokenForURL(rawURL, token string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, err := NormalizeTokenURL(rawURL)
+	if err != nil {
+		return err
+	}
+
+	if token == "" {
+		return ErrEmptyToken
+	}
+
+	if ttl <= 0 {
+		ttl = s.tokenTTL()
+	}
+
+	return s.update(func() error {
+		entry, err := s.newURLToken(token, ttl)
+		if err != nil {
+			return err
+		}
+		if s.URLTokens == nil {
+			s.URLTokens = map[string]*URLToken{}
+		}
+		s.URLTokens[key] = entry
+		return nil
+	})
+}
+
+func (s *Store) newURLToken(token string, ttl time.Duration) (*URLToken, error) {
+	now := s.now()
+	entry := &URLToken{CreatedAt: now.Unix(), ExpiresAt: now.Add(ttl).Unix()}
+
+	value := token
+	if s.config.DeviceBound {
+		id, err := currentMachineID()
+		if err != nil {
+			return nil, err
+		}
+		if value, err = sealForDevice(id, token); err != nil {
+			return nil, err
+		}
+		entry.TokenDevice = deviceFingerprint(id)
+	}
+
+	var err error
+	if entry.AuthToken, entry.EncryptedToken, err = s.sealToken(value); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// TokenForURL returns the token saved for the API base URL rawURL, after
+// normalizing it like SaveTokenForURL. ErrNoTokenForURL names the URLs
+// that do have tokens.
+func (s *Store) TokenForURL(rawURL string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, err := NormalizeTokenURL(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.load(); err != nil {
+		return "", err
+	}
+
+	entry, ok := s.URLTokens[key]
+	if !ok {
+		return "", s.noTokenForURL(key)
+	}
+
+	if s.tokenExpiredAt(entry.CreatedAt, entry.ExpiresAt) {
+		s.countExpiryRejection()
+		return "", ErrTokenExpired
+	}
+
+	token, err := s.openToken(entry.AuthToken, entry.EncryptedToken)
+	if err != nil {
+		return "", err
+	}
+
+	if entry.TokenDevice != "" {
+		id, err := currentMachineID()
+		if err != nil {
+			return "", err
+		}
+		if deviceFingerprint(id) != entry.TokenDevice {
+			return "", ErrDeviceMismatch
+		}
+		return openForDevice(id, token)
+	}
+
+	return token, nil
+}
+
+func (s *Store) noTokenForURL(key string) error {
+	urls := make([]string, 0, len(s.URLTokens))
+	for u := range s.URLTokens {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+
+	if len(urls) == 0 {
+		return fmt.Errorf("%w: %s (no URLs have tokens)", ErrNoTokenForURL, key)
+	}
+	return fmt.Errorf("%w: %s (tokens are stored for %s)", ErrNoTokenForURL, key, strings.Join(urls, ", "))
+}
+
+// hasPlaintextToken reports whether any token is stored unencrypted.
+func (s *Store) hasPlaintextToken() bool {
+	if s.persisted.AuthToken != "" {
+		return true
+	}
+	for _, entry := range s.URLTokens {
+		if entry.AuthToken != "" {
+			return true
+		}
+	}
+	return false
+}
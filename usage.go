@@ -0,0 +1,173 @@
+package keystore
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultUsageFlushInterval is how often recorded key usage is written when
+// Config.TrackUsage is set
+const DefaultUsageFlushInterval = 1 * time.Minute
+
+// usageDelta is usage recorded in memory but not yet written.
+type usageDelta struct {
+	count int64
+	last  int64
+}
+
+// usageTracker batches key usage so signing does not write the keystore.
+// Pending usage is written by a timer, on Close and on FlushUsage through
+// the regular update cycle, so a crash loses at most the unflushed window
+// and never leaves a partial file. Views from WithContextInfo share the
+// tracker of the Store they were made from.
+type usageTracker struct {
+	mu      sync.Mutex
+	pending map[string]*usageDelta
+	stop    func() bool
+	owner   *Store
+}
+
+func (s *Store) trackUsage() {
+	if s.config.TrackUsage {
+		s.usage = &usageTracker{owner: s}
+	}
+}
+
+func (s *Store) usageFlushInterval() time.Duration {
+	if s.config.UsageFlushInterval > 0 {
+		return s.config.UsageFlushInterval
+	}
+	return DefaultUsageFlushInterval
+}
+
+// recordUse notes one use of the primary key, or of the named account.
+func (s *Store) recordUse(account string) {
+	t := s.usage
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.pending == nil {
+		t.pending = make(map[string]*usageDelta)
+	}
+	d, ok := t.pending[account]
+	if !ok {
+		d = &usageDelta{}
+		t.pending[account] = d
+	}
+	d.count++
+	d.last = s.now().Unix()
+
+	if t.stop == nil {
+		t.stop = t.owner.afterFunc(t.owner.usageFlushInterval(), t.flushLater)
+	}
+}
+
+func (t *usageTracker) flushLater() {
+	s := t.owner
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.flushUsage(); err != nil {
+		s.config.Logger.Warn("keystore: failed to write key usage", "error", err)
+	}
+}
+
+// FlushUsage writes usage recorded since the last flush. It is a no-op
+// unless Config.TrackUsage is set.
+func (s *Store) FlushUsage() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.flushUsage()
+}
+
+func (s *Store) flushUsage() error {
+	t := s.usage
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	pending := t.pending
+	t.pending = nil
+	if t.stop != nil {
+		t.stop()
+		t.stop = nil
+	}
+	t.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	err := s.updateScope(scopeKey, func() error {
+		s.applyUsage(pending)
+		return nil
+	})
+	if err != nil {
+		t.restore(pending)
+		return fmt.Errorf("failed to write key usage: %w", err)
+	}
+	return nil
+}
+
+// restore puts back usage that could not be written and retries later.
+func (t *usageTracker) restore(pending map[string]*usageDelta) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.pending == nil {
+		t.pending = make(map[string]*usageDelta)
+	}
+	for account, d := range pending {
+		if cur, ok := t.pending[account]; ok {
+			cur.count += d.count
+			cur.last = max(cur.last, d.last)
+		} else {
+			t.pending[account] = d
+		}
+	}
+
+	if t.stop == nil {
+		t.stop = t.owner.afterFunc(t.owner.usageFlushInterval(), t.flushLater)
+	}
+}
+
+// applyUsage adds pending usage to the in-memory state. Usage of accounts
+// deleted in the meantime is dropped.
+func (s *Store) applyUsage(pending map[string]*usageDelta) {
+	for account, d := range pending {
+		if account == "" {
+			s.UseCount += d.count
+			s.LastUsedAt = max(s.LastUsedAt, d.last)
+			continue
+		}
+		if a, ok := s.Accounts[account]; ok {
+			a.UseCount += d.count
+			a.LastUsedAt = max(a.LastUsedAt, d.last)
+		}
+	}
+}
+
+// usageOf returns the use count and last use, including unflushed usage.
+func (s *Store) usageOf(account string, count, last int64) (int64, *time.Time) {
+	if t := s.usage; t != nil {
+		t.mu.Lock()
+		if d, ok := t.pending[account]; ok {
+			count += d.count
+			last = max(last, d.last)
+		}
+		t.mu.Unlock()
+	}
+
+	if last == 0 {
+		return count, nil
+	}
+	at := time.Unix(last, 0)
+	return count, &at
+}
@@ -0,0 +1,216 @@
+package keystore_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/theblitlabs/keystore"
+	"github.com/theblitlabs/keystore/faultinject"
+)
+
+// persistedUsage reads the primary key's usage from the keystore file.
+func persistedUsage(t *testing.T, dir string) (count, last int64) {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join(dir, keystore.DefaultFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		UseCount   int64 `json:"use_count"`
+		LastUsedAt int64 `json:"last_used_at"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc.UseCount, doc.LastUsedAt
+}
+
+func newUsageStore(t *testing.T, clock *testClock, in *faultinject.Injector) (*keystore.Store, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	cfg := clock.config(keystore.Config{DirPath: dir, TrackUsage: true, UsageFlushInterval: time.Minute, Logger: discardLogger})
+	if in != nil {
+		cfg.FaultInjector = in
+	}
+	ks, err := keystore.NewKeystore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	return ks, dir
+}
+
+func TestUsageIsBatched(t *testing.T) {
+	clock := newTestClock(epoch)
+	ks, dir := newUsageStore(t, clock, nil)
+
+	digest := crypto.Keccak256([]byte("usage"))
+	for i := 0; i < 5; i++ {
+		if _, err := ks.SignDigest(digest); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if count, _ := persistedUsage(t, dir); count != 0 {
+		t.Fatalf("signing wrote usage before the flush interval: %d", count)
+	}
+	st, err := ks.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.KeyUseCount != 5 || st.KeyLastUsedAt == nil || !st.KeyLastUsedAt.Equal(epoch) {
+		t.Fatalf("Status reports %d uses, last %v, want 5 at %v", st.KeyUseCount, st.KeyLastUsedAt, epoch)
+	}
+
+	clock.Advance(30 * time.Second)
+	if _, err := ks.LoadPrivateKey(); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(30 * time.Second)
+
+	count, last := persistedUsage(t, dir)
+	if count != 6 || last != epoch.Add(30*time.Second).Unix() {
+		t.Fatalf("flushed usage = %d at %d, want 6 at %d", count, last, epoch.Add(30*time.Second).Unix())
+	}
+	if clock.Pending() != 0 {
+		t.Fatal("flush timer still armed with nothing pending")
+	}
+}
+
+func TestUsageFlushedOnClose(t *testing.T) {
+	clock := newTestClock(epoch)
+	ks, dir := newUsageStore(t, clock, nil)
+
+	if _, err := ks.LoadPrivateKey(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := persistedUsage(t, dir); count != 1 {
+		t.Fatalf("usage after Close = %d, want 1", count)
+	}
+}
+
+func TestUsageCrashLosesOnlyTheWindow(t *testing.T) {
+	clock := newTestClock(epoch)
+	ks, dir := newUsageStore(t, clock, nil)
+
+	for i := 0; i < 3; i++ {
+		if _, err := ks.LoadPrivateKey(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ks.FlushUsage(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.LoadPrivateKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The process dies here: a fresh Store sees the flushed usage only,
+	// and the file is intact.
+	restarted, err := keystore.NewKeystore(clock.config(keystore.Config{DirPath: dir, TrackUsage: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := restarted.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.KeyUseCount != 3 {
+		t.Fatalf("usage after a crash = %d, want 3", st.KeyUseCount)
+	}
+	if _, err := restarted.LoadPrivateKey(); err != nil {
+		t.Fatalf("keystore damaged: %v", err)
+	}
+}
+
+func TestUsageFailedFlushIsRetried(t *testing.T) {
+	clock := newTestClock(epoch)
+	in := faultinject.New()
+	ks, dir := newUsageStore(t, clock, in)
+
+	if _, err := ks.LoadPrivateKey(); err != nil {
+		t.Fatal(err)
+	}
+	in.Once(keystore.FaultOpSave, keystore.Fault{Err: errors.New("disk full")})
+	if err := ks.FlushUsage(); err == nil {
+		t.Fatal("FlushUsage succeeded despite the fault")
+	}
+	if _, err := ks.LoadPrivateKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The failed usage was kept and is written by the re-armed timer.
+	clock.Advance(time.Minute)
+	if count, _ := persistedUsage(t, dir); count != 2 {
+		t.Fatalf("usage after retry = %d, want 2", count)
+	}
+}
+
+func TestUsageAccounts(t *testing.T) {
+	clock := newTestClock(epoch)
+	ks, _ := newUsageStore(t, clock, nil)
+	if err := ks.SaveAccount("ops", credentialKeyHex); err != nil {
+		t.Fatal(err)
+	}
+
+	digest := crypto.Keccak256([]byte("usage"))
+	for i := 0; i < 2; i++ {
+		if _, err := ks.SignWithAccount("ops", digest); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ks.FlushUsage(); err != nil {
+		t.Fatal(err)
+	}
+
+	accounts, err := ks.ListAccounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range accounts {
+		if a.Name == "ops" {
+			if a.UseCount != 2 || a.LastUsedAt == nil {
+				t.Fatalf("ops usage = %d, %v, want 2", a.UseCount, a.LastUsedAt)
+			}
+			return
+		}
+	}
+	t.Fatal("account ops not listed")
+}
+
+func TestUsageDisabled(t *testing.T) {
+	dir := t.TempDir()
+	ks, err := keystore.NewKeystore(keystore.Config{DirPath: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SavePrivateKey(fileKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.LoadPrivateKey(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := ks.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := persistedUsage(t, dir); count != 0 || st.KeyUseCount != 0 {
+		t.Fatalf("usage tracked without TrackUsage: %d, %d", count, st.KeyUseCount)
+	}
+}
@@ -0,0 +1,114 @@
+package keystore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+// UsersDirName is the directory under DirPath holding per-user keystores
+const UsersDirName = "users"
+
+var userIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._@-]{0,127}$`)
+
+func validateUserID(id string) error {
+	if !userIDPattern.MatchString(id) || id == "." || id == ".." {
+		return fmt.Errorf("%w: %q", ErrInvalidUserID, id)
+	}
+	return nil
+}
+
+func (s *Store) usersDir() (string, error) {
+	if s.config.Backend != nil {
+		return "", fmt.Errorf("per-user keystores: %w", ErrNotFileBacked)
+	}
+	return filepath.Join(s.config.DirPath, UsersDirName), nil
+}
+
+func (s *Store) userDir(id string) (string, error) {
+	if err := validateUserID(id); err != nil {
+		return "", err
+	}
+
+	root, err := s.usersDir()
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(root, id)
+	if rel, err := filepath.Rel(root, dir); err != nil || rel != id {
+		return "", fmt.Errorf("%w: %q", ErrInvalidUserID, id)
+	}
+
+	return dir, nil
+}
+
+// ForUser returns a Store namespaced to a single user under
+// DirPath/users/<id>/, sharing this Store's configuration. Systemd credentials
+// and KeyFromEnv are service-wide and are not applied to per-user stores.
+func (s *Store) ForUser(id string) (*Store, error) {
+	dir, err := s.userDir(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dir), DefaultDirMode); err != nil {
+		return nil, fmt.Errorf("failed to create users directory: %w", err)
+	}
+
+	cfg := s.config
+	cfg.DirPath = dir
+	cfg.SystemdCredentials = false
+	cfg.KeyFromEnv = ""
+
+	return NewKeystore(cfg)
+}
+
+// ListUsers returns the ids of all users with a keystore directory.
+func (s *Store) ListUsers() ([]string, error) {
+	root, err := s.usersDir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	users := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() && validateUserID(entry.Name()) == nil {
+			users = append(users, entry.Name())
+		}
+	}
+
+	sort.Strings(users)
+	return users, nil
+}
+
+// DeleteUser removes a user's keystore directory.
+func (s *Store) DeleteUser(id string) error {
+	dir, err := s.userDir(id)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(dir); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: %q", ErrUserNotFound, id)
+		}
+		return fmt.Errorf("failed to stat user directory: %w", err)
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	return nil
+}
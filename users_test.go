@@ -0,0 +1,219 @@
+package keystore_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/theblitlabs/keystore"
+)
+
+// craftedUserIDs try to reach outside the user's own directory.
+var craftedUserIDs = []string{
+	"", ".", "..", "../alice", "../../alice", "alice/../bob", "bob/..", "./alice",
+	"alice/", "/alice", `..\alice`, `alice\bob`, ".hidden", "-flag", "alice bob",
+	"alice\x00", strings.Repeat("a", 129),
+}
+
+// snapshotDir returns the contents of every file and directory under dir.
+func snapshotDir(t *testing.T, dir string) map[string]string {
+	t.Helper()
+
+	files := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			files[rel] = "<dir>"
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		files[rel] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// newUserStores returns a Store on a fresh directory with users alice and
+// bob, each holding their own token and key.
+func newUserStores(t *testing.T) (root, alice, bob *keystore.Store, dir string) {
+	t.Helper()
+
+	dir = t.TempDir()
+	root = newErrorStore(t, keystore.Config{DirPath: dir})
+	users := make([]*keystore.Store, 2)
+	for i, u := range []struct{ id, token, key string }{
+		{"alice", "alice-token", fileKeyHex},
+		{"bob", "bob-token", credentialKeyHex},
+	} {
+		ks, err := root.ForUser(u.id)
+		if err != nil {
+			t.Fatalf("ForUser(%q): %v", u.id, err)
+		}
+		if err := ks.SaveToken(u.token); err != nil {
+			t.Fatal(err)
+		}
+		if err := ks.SavePrivateKey(u.key); err != nil {
+			t.Fatal(err)
+		}
+		users[i] = ks
+	}
+	return root, users[0], users[1], dir
+}
+
+// assertUser fails unless the user id holds its own token and key.
+func assertUser(t *testing.T, root *keystore.Store, id, token, keyHex string) {
+	t.Helper()
+
+	ks, err := root.ForUser(id)
+	if err != nil {
+		t.Fatalf("ForUser(%q): %v", id, err)
+	}
+	if got, err := ks.LoadToken(); err != nil || got != token {
+		t.Fatalf("%s token = %q, %v, want %q", id, got, err, token)
+	}
+	if got, err := ks.GetPrivateKeyHex(); err != nil || got != keyHex {
+		t.Fatalf("%s key = %v, want its own", id, err)
+	}
+}
+
+func TestUserIsolation(t *testing.T) {
+	root, alice, _, dir := newUserStores(t)
+	assertUser(t, root, "alice", "alice-token", fileKeyHex)
+	assertUser(t, root, "bob", "bob-token", credentialKeyHex)
+
+	// Users live in their own directories, and not in the parent keystore.
+	for _, id := range []string{"alice", "bob"} {
+		if _, err := os.Stat(filepath.Join(dir, keystore.UsersDirName, id, keystore.DefaultFileName)); err != nil {
+			t.Fatalf("keystore of %s: %v", id, err)
+		}
+	}
+	if _, err := root.LoadToken(); !errors.Is(err, keystore.ErrNoKeystore) {
+		t.Fatalf("parent LoadToken: got %v, want ErrNoKeystore", err)
+	}
+
+	// A write by one user leaves the other's files as they were.
+	before := snapshotDir(t, filepath.Join(dir, keystore.UsersDirName, "bob"))
+	if err := alice.SaveToken("alice-token-2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := alice.SaveAccount("ops", envKeyHex); err != nil {
+		t.Fatal(err)
+	}
+	if after := snapshotDir(t, filepath.Join(dir, keystore.UsersDirName, "bob")); !reflect.DeepEqual(before, after) {
+		t.Fatal("a write by alice changed bob's files")
+	}
+
+	// Crafted ids are refused by every method, and nothing is touched.
+	before = snapshotDir(t, dir)
+	for _, id := range craftedUserIDs {
+		if _, err := root.ForUser(id); !errors.Is(err, keystore.ErrInvalidUserID) {
+			t.Errorf("ForUser(%q): got %v, want ErrInvalidUserID", id, err)
+		}
+		if err := root.DeleteUser(id); !errors.Is(err, keystore.ErrInvalidUserID) {
+			t.Errorf("DeleteUser(%q): got %v, want ErrInvalidUserID", id, err)
+		}
+	}
+	if after := snapshotDir(t, dir); !reflect.DeepEqual(before, after) {
+		t.Fatal("crafted user ids changed the keystore directory")
+	}
+
+	// A user Store cannot reach a sibling through its own ForUser either:
+	// it nests below itself.
+	nested, err := alice.ForUser("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := nested.LoadToken(); !errors.Is(err, keystore.ErrNoKeystore) {
+		t.Fatalf("alice's user bob: got %v, want ErrNoKeystore", err)
+	}
+	assertUser(t, root, "bob", "bob-token", credentialKeyHex)
+}
+
+func TestDeleteUser(t *testing.T) {
+	root, _, _, dir := newUserStores(t)
+	if err := os.WriteFile(filepath.Join(dir, "other-file"), []byte("kept"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := root.DeleteUser("alice"); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, keystore.UsersDirName, "alice")); !os.IsNotExist(err) {
+		t.Fatalf("alice's directory after DeleteUser: %v", err)
+	}
+	assertUser(t, root, "bob", "bob-token", credentialKeyHex)
+	if data, err := os.ReadFile(filepath.Join(dir, "other-file")); err != nil || string(data) != "kept" {
+		t.Fatalf("DeleteUser touched a file outside the user: %q, %v", data, err)
+	}
+
+	if err := root.DeleteUser("alice"); !errors.Is(err, keystore.ErrUserNotFound) {
+		t.Fatalf("DeleteUser of a deleted user: got %v, want ErrUserNotFound", err)
+	}
+	if err := root.DeleteUser("carol"); !errors.Is(err, keystore.ErrUserNotFound) {
+		t.Fatalf("DeleteUser of an unknown user: got %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestListUsers(t *testing.T) {
+	dir := t.TempDir()
+	root := newErrorStore(t, keystore.Config{DirPath: dir})
+
+	users, err := root.ListUsers()
+	if err != nil || users == nil || len(users) != 0 {
+		t.Fatalf("ListUsers without users = %#v, %v, want an empty list", users, err)
+	}
+
+	for _, id := range []string{"carol", "alice", "bob@example.com"} {
+		ks, err := root.ForUser(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ks.SaveToken(id + "-token"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Entries that are not user directories are skipped.
+	usersDir := filepath.Join(dir, keystore.UsersDirName)
+	if err := os.Mkdir(filepath.Join(usersDir, ".cache"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(usersDir, "notes.txt"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	users, err = root.ListUsers()
+	if want := []string{"alice", "bob@example.com", "carol"}; err != nil || !reflect.DeepEqual(users, want) {
+		t.Fatalf("ListUsers = %v, %v, want %v", users, err, want)
+	}
+
+	if err := root.DeleteUser("bob@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	users, err = root.ListUsers()
+	if want := []string{"alice", "carol"}; err != nil || !reflect.DeepEqual(users, want) {
+		t.Fatalf("ListUsers after DeleteUser = %v, %v, want %v", users, err, want)
+	}
+
+	// Per-user keystores need a directory.
+	mem := newErrorStore(t, keystore.Config{Backend: keystore.NewMemoryBackend()})
+	if _, err := mem.ListUsers(); !errors.Is(err, keystore.ErrNotFileBacked) {
+		t.Fatalf("ListUsers on a memory backend: got %v, want ErrNotFileBacked", err)
+	}
+	if _, err := mem.ForUser("alice"); !errors.Is(err, keystore.ErrNotFileBacked) {
+		t.Fatalf("ForUser on a memory backend: got %v, want ErrNotFileBacked", err)
+	}
+}
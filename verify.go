@@ -0,0 +1,132 @@
+package keystore
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Problems reported by Verify in VerifyIssue.Problem
+const (
+	VerifyDualUseKey        = "dual_use_key"
+	VerifyUnknownPurpose    = "unknown_purpose"
+	VerifyEncryptionAccount = "encryption_account"
+	VerifyWellKnownTestKey  = "well_known_test_key"
+)
+
+// Severities of a VerifyIssue
+const (
+	VerifySeverityWarning = "warning"
+	VerifySeverityError   = "error"
+)
+
+// VerifyIssue is one problem found by Verify. Key is "primary" for the
+// primary key, otherwise the account name.
+type VerifyIssue struct {
+	Severity string `json:"severity"`
+	Problem  string `json:"problem"`
+	Key      string `json:"key"`
+	Message  string `json:"message"`
+}
+
+// VerifyReport lists the problems Verify found.
+type VerifyReport struct {
+	Issues []VerifyIssue `json:"issues"`
+}
+
+// OK reports whether Verify found no errors. Warnings do not count.
+func (r VerifyReport) OK() bool {
+	for _, issue := range r.Issues {
+		if issue.Severity == VerifySeverityError {
+			return false
+		}
+	}
+	return true
+}
+
+// Verify checks the keys of the keystore and their purposes without using
+// any key. Keys with no purpose, which can both sign and decrypt, are reported as
+// warnings, since reusing one key for both weakens each; GenerateKeyPairSet
+// creates separate keys. Unknown purposes, which every key operation
+// refuses, and an encryption account that is missing or for signing only
+// are reported as errors. Well-known test keys, told apart by address, are
+// reported as warnings, and as errors with EnvironmentProd.
+func (s *Store) Verify() (VerifyReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := VerifyReport{Issues: []VerifyIssue{}}
+	if err := s.load(); err != nil {
+		return report, err
+	}
+
+	testKeySeverity := VerifySeverityWarning
+	if s.config.Environment == EnvironmentProd {
+		testKeySeverity = VerifySeverityError
+	}
+
+	check := func(key, address string, purpose KeyPurpose) {
+		if s.isTestKey(common.HexToAddress(address)) {
+			report.Issues = append(report.Issues, VerifyIssue{
+				Severity: testKeySeverity,
+				Problem:  VerifyWellKnownTestKey,
+				Key:      key,
+				Message:  fmt.Sprintf("%s is a well-known test key", address),
+			})
+		}
+		switch {
+		case !purpose.orAny().valid():
+			report.Issues = append(report.Issues, VerifyIssue{
+				Severity: VerifySeverityError,
+				Problem:  VerifyUnknownPurpose,
+				Key:      key,
+				Message:  fmt.Sprintf("unknown purpose %q; the key cannot be used", purpose),
+			})
+		case purpose.orAny() == KeyPurposeAny:
+			report.Issues = append(report.Issues, VerifyIssue{
+				Severity: VerifySeverityWarning,
+				Problem:  VerifyDualUseKey,
+				Key:      key,
+				Message:  "key can both sign and decrypt",
+			})
+		}
+	}
+
+	if s.hasPrimaryKey() {
+		check("primary", s.Address, s.KeyPurpose)
+	}
+
+	names := make([]string, 0, len(s.Accounts))
+	for name, account := range s.Accounts {
+		if !account.WatchOnly {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		check(name, s.Accounts[name].Address, s.Accounts[name].Purpose)
+	}
+
+	if name := s.EncryptionAccount; name != "" {
+		account, ok := s.Accounts[name]
+		switch {
+		case !ok:
+			report.Issues = append(report.Issues, VerifyIssue{
+				Severity: VerifySeverityError,
+				Problem:  VerifyEncryptionAccount,
+				Key:      name,
+				Message:  "encryption account does not exist; Decrypt and SharedSecret fail",
+			})
+		case account.Purpose.allows(KeyPurposeEncryption, "") != nil || account.WatchOnly:
+			report.Issues = append(report.Issues, VerifyIssue{
+				Severity: VerifySeverityError,
+				Problem:  VerifyEncryptionAccount,
+				Key:      name,
+				Message:  "encryption account cannot decrypt",
+			})
+		}
+	}
+
+	return report, nil
+}